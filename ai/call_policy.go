@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"slices"
+	"time"
+)
+
+// ErrorCodeTimeout is the error code of the function calling which is timed out by the bridge
+const ErrorCodeTimeout = "timeout"
+
+// ErrorCodeCanceled is the error code of the function calling which is canceled by the caller of the bridge
+const ErrorCodeCanceled = "canceled"
+
+// ErrorCodeUnavailable is the error code of the function calling which can't be sent to the sfn by the bridge
+const ErrorCodeUnavailable = "unavailable"
+
+// ErrorCodeNotFound is the error code of the function calling whose function is not registered
+const ErrorCodeNotFound = "not_found"
+
+// ErrorCodeInternal is the error code of the failed function calling which returns no error code
+const ErrorCodeInternal = "internal"
+
+// CallPolicy is the retry policy and timeout of the function calling declared by the sfn,
+// the bridge honors it when calling the function.
+type CallPolicy struct {
+	// Timeout is the timeout of each attempt, zero means waiting for the result without timeout.
+	Timeout time.Duration `json:"timeout,omitempty"`
+	// MaxAttempts is the maximum number of attempts including the first one, the function
+	// calling is not retried if it is less than 2.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+	// RetryableErrors are the error codes which can be retried, eg: ErrorCodeTimeout,
+	// all the errors are retryable if it is empty.
+	RetryableErrors []string `json:"retryable_errors,omitempty"`
+	// Backoff is the delay before the first retry, it is doubled for every next retry, the failed
+	// function calling is retried immediately if it is zero.
+	Backoff time.Duration `json:"backoff,omitempty"`
+	// MaxBackoff caps the delay before the retries, the delay is not capped if it is zero.
+	MaxBackoff time.Duration `json:"max_backoff,omitempty"`
+	// Alternate routes the retries to all the instances of the function instead of the nearest one
+	// which failed, it takes effect only if the bridge routes the tool calls to the nearest instance.
+	Alternate bool `json:"alternate,omitempty"`
+}
+
+// Retryable reports whether the failed function calling with the error code can be retried
+// after the attempt.
+func (p CallPolicy) Retryable(attempt int, code string) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	return len(p.RetryableErrors) == 0 || slices.Contains(p.RetryableErrors, code)
+}
+
+// Delay returns the delay before retrying the failed attempt.
+func (p CallPolicy) Delay(attempt int) time.Duration {
+	if p.Backoff <= 0 || attempt < 1 {
+		return 0
+	}
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
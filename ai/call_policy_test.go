@@ -0,0 +1,48 @@
+package ai
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallPolicyRetryable(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  CallPolicy
+		attempt int
+		code    string
+		want    bool
+	}{
+		{name: "no retry", policy: CallPolicy{}, attempt: 1, code: ErrorCodeTimeout, want: false},
+		{name: "any error", policy: CallPolicy{MaxAttempts: 3}, attempt: 2, code: "", want: true},
+		{name: "attempts exhausted", policy: CallPolicy{MaxAttempts: 3}, attempt: 3, code: "", want: false},
+		{name: "retryable code", policy: CallPolicy{MaxAttempts: 2, RetryableErrors: []string{ErrorCodeTimeout}}, attempt: 1, code: ErrorCodeTimeout, want: true},
+		{name: "not retryable code", policy: CallPolicy{MaxAttempts: 2, RetryableErrors: []string{ErrorCodeTimeout}}, attempt: 1, code: "bad_request", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.Retryable(tt.attempt, tt.code))
+		})
+	}
+}
+
+func TestCallPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  CallPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{name: "no backoff", policy: CallPolicy{}, attempt: 1, want: 0},
+		{name: "first retry", policy: CallPolicy{Backoff: 100 * time.Millisecond}, attempt: 1, want: 100 * time.Millisecond},
+		{name: "doubled", policy: CallPolicy{Backoff: 100 * time.Millisecond}, attempt: 3, want: 400 * time.Millisecond},
+		{name: "capped", policy: CallPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 250 * time.Millisecond}, attempt: 3, want: 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.policy.Delay(tt.attempt))
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FunctionCallVersion is the version of the JSON envelope of the function calls, the envelope is the payload
+// of the data frames of the tool calls sent to the sfns, and of the results sent back to the reducer. The sfns
+// in any language interop with the bridge by the envelope instead of mirroring the Go structs.
+//
+// The envelope of version 1 is a JSON object, the fields unknown to the reader are ignored:
+//
+//	v                 int      the version of the envelope, it is 1, the envelope without it is read as version 1
+//	tid               string   the transaction id of the chat completion
+//	req_id            string   the request id of the parallel tool calls, the results must carry it back
+//	tool_call_id      string   the id of the tool call, the results must carry it back
+//	function_name     string   the name of the called function
+//	arguments         string   the JSON arguments of the tool call generated by the llm
+//	attempt           int      the attempt of the tool call starting from 1, the results should carry it back
+//	user_query        string   the user prompt which fires the tool call
+//	call_chain        []string the functions invoking this function, see FunctionInvokeTag
+//
+// The sfn writes the result to ReducerTag with the fields above and:
+//
+//	is_ok             bool     true if the function succeeds
+//	result            string   the text result of the function
+//	tool_result       object   the structured result of the function, it takes precedence over result, see ToolResult
+//	is_partial        bool     true if the result is an incremental progress chunk, the final result is written without it
+//	error             string   the error message if the function fails
+//	error_code        string   the error code if the function fails, eg: timeout, it decides whether to retry
+//
+// The changes breaking the readers of the envelope bump the version, the readers reject the newer versions.
+const FunctionCallVersion = 1
+
+// ErrUnsupportedVersion is returned when decoding the envelope of a newer version.
+type ErrUnsupportedVersion struct {
+	Version int
+}
+
+func (e ErrUnsupportedVersion) Error() string {
+	return fmt.Sprintf("unsupported function call envelope version %d, the max is %d", e.Version, FunctionCallVersion)
+}
+
+// EncodeFunctionCall encodes the function call as the envelope of FunctionCallVersion.
+func EncodeFunctionCall(fc *FunctionCall) ([]byte, error) {
+	envelope := *fc
+	if envelope.Version == 0 {
+		envelope.Version = FunctionCallVersion
+	}
+	return json.Marshal(&envelope)
+}
+
+// DecodeFunctionCall decodes the envelope of the function call, the envelope without the version is read
+// as version 1, and the newer versions are rejected with ErrUnsupportedVersion.
+func DecodeFunctionCall(b []byte) (*FunctionCall, error) {
+	fc := &FunctionCall{}
+	if err := json.Unmarshal(b, fc); err != nil {
+		return nil, err
+	}
+	if fc.Version == 0 {
+		fc.Version = FunctionCallVersion
+	}
+	if fc.Version > FunctionCallVersion {
+		return nil, ErrUnsupportedVersion{Version: fc.Version}
+	}
+	return fc, nil
+}
@@ -0,0 +1,33 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFunctionCallEnvelope(t *testing.T) {
+	t.Run("encode", func(t *testing.T) {
+		buf, err := EncodeFunctionCall(&FunctionCall{ReqID: "req-1", ToolCallID: "call-1", FunctionName: "get-weather", Arguments: `{"city":"Paris"}`, Attempt: 1})
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"v":1,"req_id":"req-1","tool_call_id":"call-1","function_name":"get-weather","arguments":"{\"city\":\"Paris\"}","attempt":1,"is_ok":false}`, string(buf))
+	})
+
+	t.Run("decode the result of another language", func(t *testing.T) {
+		fc, err := DecodeFunctionCall([]byte(`{"v":1,"req_id":"req-1","tool_call_id":"call-1","is_ok":false,"error":"city not found","error_code":"not_found","extra":"ignored"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, &FunctionCall{Version: 1, ReqID: "req-1", ToolCallID: "call-1", Error: "city not found", ErrorCode: "not_found"}, fc)
+	})
+
+	t.Run("decode without version", func(t *testing.T) {
+		fc, err := DecodeFunctionCall([]byte(`{"req_id":"req-1","is_ok":true,"result":"sunny"}`))
+		assert.NoError(t, err)
+		assert.Equal(t, FunctionCallVersion, fc.Version)
+		assert.Equal(t, "sunny", fc.Result)
+	})
+
+	t.Run("decode newer version", func(t *testing.T) {
+		_, err := DecodeFunctionCall([]byte(`{"v":2,"req_id":"req-1"}`))
+		assert.Equal(t, ErrUnsupportedVersion{Version: 2}, err)
+	})
+}
@@ -1,8 +1,6 @@
 package ai
 
 import (
-	"encoding/json"
-
 	"github.com/yomorun/yomo/serverless"
 )
 
@@ -11,6 +9,8 @@ var ReducerTag uint32 = 0xE001
 
 // FunctionCall describes the data structure when invoking the sfn function
 type FunctionCall struct {
+	// Version is the version of the envelope, see FunctionCallVersion, it is set by Bytes.
+	Version int `json:"v,omitempty"`
 	// TransID is the transaction id of the function calling chain, it is used for
 	// multi-turn llm request.
 	TransID string `json:"tid,omitempty"`
@@ -19,6 +19,8 @@ type FunctionCall struct {
 	ReqID string `json:"req_id"`
 	// Result is the struct result of the function calling.
 	Result string `json:"result,omitempty"`
+	// ToolResult is the structured result of the function calling, it takes precedence over Result.
+	ToolResult *ToolResult `json:"tool_result,omitempty"`
 	// RetrievalResult is the string result of the function calling.
 	RetrievalResult string `json:"retrieval_result,omitempty"`
 	// Arguments is the arguments of the function calling. This should be kept in this
@@ -30,30 +32,66 @@ type FunctionCall struct {
 	FunctionName string `json:"function_name,omitempty"`
 	// IsOK is the flag to indicate the function calling is ok or not
 	IsOK bool `json:"is_ok"`
+	// IsPartial is the flag to indicate the result is an incremental progress chunk, the final
+	// result is written without it.
+	IsPartial bool `json:"is_partial,omitempty"`
 	// Error is the error message
 	Error string `json:"error,omitempty"`
-	ctx   serverless.Context
+	// ErrorCode is the error code, it is used to decide whether the function calling can be retried
+	ErrorCode string `json:"error_code,omitempty"`
+	// Attempt is the attempt number of the function calling, it is started from 1
+	Attempt int `json:"attempt,omitempty"`
+	// CallChain is the names of the functions which invoke this function, it is used to limit the depth
+	// and detect the cycles of the function composition.
+	CallChain []string `json:"call_chain,omitempty"`
+	// UserQuery is the original user prompt which fires the function calling, tools can use it
+	// to adapt behavior to the broader question.
+	UserQuery string `json:"user_query,omitempty"`
+	ctx       serverless.Context
 }
 
-// Bytes serialize the []byte of FunctionCallObject
+// Bytes serialize the []byte of FunctionCallObject, the envelope is stamped with FunctionCallVersion.
 func (fco *FunctionCall) Bytes() ([]byte, error) {
-	return json.Marshal(fco)
+	return EncodeFunctionCall(fco)
+}
+
+// SetToolResult sets the structured result of the function calling, the function calling
+// fails if the result is an error.
+func (fco *FunctionCall) SetToolResult(result *ToolResult) error {
+	content, err := result.ToolMessageContent()
+	if err != nil {
+		return err
+	}
+	fco.ToolResult = result
+	fco.IsOK = result.Type != ToolResultError
+	if !fco.IsOK {
+		fco.Error = content
+		fco.ErrorCode = result.Code
+	}
+	return nil
 }
 
 // FromBytes deserialize the FunctionCallObject from the given []byte
 func (fco *FunctionCall) FromBytes(b []byte) error {
-	obj := &FunctionCall{}
-	err := json.Unmarshal(b, &obj)
+	obj, err := DecodeFunctionCall(b)
 	if err != nil {
 		return err
 	}
+	fco.Version = obj.Version
 	fco.TransID = obj.TransID
 	fco.ReqID = obj.ReqID
 	fco.Arguments = obj.Arguments
 	fco.FunctionName = obj.FunctionName
 	fco.ToolCallID = obj.ToolCallID
 	fco.Result = obj.Result
+	fco.ToolResult = obj.ToolResult
 	fco.RetrievalResult = obj.RetrievalResult
 	fco.IsOK = obj.IsOK
+	fco.IsPartial = obj.IsPartial
+	fco.Error = obj.Error
+	fco.ErrorCode = obj.ErrorCode
+	fco.Attempt = obj.Attempt
+	fco.UserQuery = obj.UserQuery
+	fco.CallChain = obj.CallChain
 	return nil
 }
@@ -9,8 +9,11 @@ import (
 
 var jsonStr = "{\"req_id\":\"yYdzyl\",\"arguments\":\"{\\n  \\\"sourceTimezone\\\": \\\"America/Los_Angeles\\\",\\n  \\\"targetTimezone\\\": \\\"Asia/Singapore\\\",\\n  \\\"timeString\\\": \\\"2024-03-25 07:00:00\\\"\\n}\",\"tool_call_id\":\"call_aZrtm5xcLs1qtP0SWo4CZi75\",\"function_name\":\"fn-timezone-converter\",\"is_ok\":false}"
 
+// the envelope written by Bytes carries the version, the one without it is read as version 1
+var jsonStrV1 = "{\"v\":1," + jsonStr[1:]
+
 var jsonStrWithResult = func(result string) string {
-	return fmt.Sprintf("{\"req_id\":\"yYdzyl\",\"result\":\"%s\",\"arguments\":\"{\\n  \\\"sourceTimezone\\\": \\\"America/Los_Angeles\\\",\\n  \\\"targetTimezone\\\": \\\"Asia/Singapore\\\",\\n  \\\"timeString\\\": \\\"2024-03-25 07:00:00\\\"\\n}\",\"tool_call_id\":\"call_aZrtm5xcLs1qtP0SWo4CZi75\",\"function_name\":\"fn-timezone-converter\",\"is_ok\":true}", result)
+	return fmt.Sprintf("{\"v\":1,\"req_id\":\"yYdzyl\",\"result\":\"%s\",\"arguments\":\"{\\n  \\\"sourceTimezone\\\": \\\"America/Los_Angeles\\\",\\n  \\\"targetTimezone\\\": \\\"Asia/Singapore\\\",\\n  \\\"timeString\\\": \\\"2024-03-25 07:00:00\\\"\\n}\",\"tool_call_id\":\"call_aZrtm5xcLs1qtP0SWo4CZi75\",\"function_name\":\"fn-timezone-converter\",\"is_ok\":true}", result)
 }
 
 var jsonStrWithError = func(err string) string {
@@ -37,7 +40,7 @@ func TestFunctionCallBytes(t *testing.T) {
 	// err = target.fromBytes(bytes)
 
 	assert.NoError(t, err)
-	assert.Equal(t, string(bytes), jsonStr, "Original and bytes should be equal")
+	assert.Equal(t, string(bytes), jsonStrV1, "Original and bytes should be equal")
 }
 
 func TestReadFunctionCall(t *testing.T) {
@@ -54,6 +57,16 @@ func TestReadFunctionCall(t *testing.T) {
 		err := ctx.ReadLLMFunctionCall(&fnCall)
 		assert.Error(t, err)
 	})
+
+	t.Run("ctx.Data carries the user query", func(t *testing.T) {
+		ctx := NewMockContext([]byte(`{"tid":"mock-tid","req_id":"mock-req-id","arguments":"{}","user_query":"what's the time in Singapore?"}`), 0)
+		fnCall := &FunctionCall{}
+		err := ctx.ReadLLMFunctionCall(fnCall)
+		assert.NoError(t, err)
+		assert.Equal(t, "mock-tid", fnCall.TransID)
+		assert.Equal(t, "mock-req-id", fnCall.ReqID)
+		assert.Equal(t, "what's the time in Singapore?", fnCall.UserQuery)
+	})
 }
 
 func TestReadLLMArguments(t *testing.T) {
@@ -83,3 +96,28 @@ func TestWriteLLMResult(t *testing.T) {
 	assert.Equal(t, ReducerTag, res[0].Tag)
 	assert.Equal(t, jsonStrWithResult("test result"), string(res[0].Data))
 }
+
+func TestWriteLLMPartialResult(t *testing.T) {
+	ctx := NewMockContext([]byte(jsonStr), 0x10)
+
+	// write before read
+	assert.Error(t, ctx.WriteLLMPartialResult("1 row found"))
+
+	target := make(map[string]string)
+	assert.NoError(t, ctx.ReadLLMArguments(&target))
+	assert.NoError(t, ctx.WriteLLMPartialResult("1 row found"))
+	assert.NoError(t, ctx.WriteLLMResult("2 rows found"))
+
+	res := ctx.RecordsWritten()
+	assert.Len(t, res, 2)
+
+	partial := &FunctionCall{}
+	assert.NoError(t, partial.FromBytes(res[0].Data))
+	assert.True(t, partial.IsPartial)
+	assert.Equal(t, "1 row found", partial.Result)
+
+	final := &FunctionCall{}
+	assert.NoError(t, final.FromBytes(res[1].Data))
+	assert.False(t, final.IsPartial)
+	assert.Equal(t, jsonStrWithResult("2 rows found"), string(res[1].Data))
+}
@@ -0,0 +1,32 @@
+package ai
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FunctionInvokeTag is the observed tag of the bridge, the sfn writes to it to invoke another function by name
+var FunctionInvokeTag uint32 = 0xE002
+
+// FunctionInvokeResultTag is the observed tag of the llm sfn to receive the results of the functions it invoked
+var FunctionInvokeResultTag uint32 = 0xE003
+
+// MaxCallDepth is the maximum number of the functions in the call chain of the function composition
+var MaxCallDepth = 5
+
+// FunctionInvokeTimeout is the timeout of waiting for the result of the invoked function
+var FunctionInvokeTimeout = time.Minute
+
+// CheckCallChain checks whether the function can be invoked by the last function of the call chain,
+// it returns an error if the call chain is too deep or the function is already in the call chain.
+func CheckCallChain(callChain []string, name string) error {
+	if slices.Contains(callChain, name) {
+		return fmt.Errorf("function call cycle detected: %s -> %s", strings.Join(callChain, " -> "), name)
+	}
+	if len(callChain) >= MaxCallDepth {
+		return fmt.Errorf("function call depth exceeds the limit %d: %s -> %s", MaxCallDepth, strings.Join(callChain, " -> "), name)
+	}
+	return nil
+}
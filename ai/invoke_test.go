@@ -0,0 +1,32 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckCallChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		callChain []string
+		fn        string
+		wantErr   bool
+	}{
+		{name: "empty", callChain: nil, fn: "get-weather"},
+		{name: "ok", callChain: []string{"plan-trip", "get-weather"}, fn: "get-currency"},
+		{name: "cycle", callChain: []string{"plan-trip", "get-weather"}, fn: "plan-trip", wantErr: true},
+		{name: "self", callChain: []string{"plan-trip"}, fn: "plan-trip", wantErr: true},
+		{name: "too deep", callChain: []string{"a", "b", "c", "d", "e"}, fn: "f", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckCallChain(tt.callChain, tt.fn)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yomorun/yomo/serverless"
+)
+
+const (
+	// ErrorCodeInvalidArguments is the error code of the function calling with the invalid arguments
+	ErrorCodeInvalidArguments = "invalid_arguments"
+	// ErrorCodePanic is the error code of the function calling which panics
+	ErrorCodePanic = "panic"
+)
+
+// ToolHandler is the handler of the llm function calling, it is the handler of the llm sfn.
+type ToolHandler = func(ctx serverless.Context)
+
+// ToolMiddleware wraps the tool handler to share the common logic between the tools,
+// eg: validates the arguments, recovers the panic, logs and measures the calling.
+type ToolMiddleware func(next ToolHandler) ToolHandler
+
+// UseToolMiddlewares wraps the handler with the middlewares, the first middleware is the outermost one.
+func UseToolMiddlewares(handler ToolHandler, middlewares ...ToolMiddleware) ToolHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Recover recovers the panic of the tool handler, the panic is returned to the llm as the error result
+// with ErrorCodePanic, unless the handler has written the result.
+func Recover() ToolMiddleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx serverless.Context) {
+			tc := newToolContext(ctx)
+			defer func() {
+				if r := recover(); r != nil {
+					if _, _, written := tc.result(); written {
+						return
+					}
+					// the handler may panic before reading the function call
+					_ = ctx.ReadLLMArguments(&json.RawMessage{})
+					_ = ctx.WriteLLMToolResult(ErrorResultWithCode(ErrorCodePanic, fmt.Errorf("function panicked: %v", r)))
+				}
+			}()
+			next(tc)
+		}
+	}
+}
+
+// ValidateArguments validates the arguments by the input model of the function before calling the tool handler,
+// the arguments must be decoded to the input model without unknown fields, and the fields without `omitempty`
+// are required. The invalid arguments are returned to the llm as the error result with ErrorCodeInvalidArguments.
+func ValidateArguments(inputModel any) ToolMiddleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx serverless.Context) {
+			fnCall := &FunctionCall{}
+			if err := ctx.ReadLLMFunctionCall(fnCall); err != nil {
+				next(ctx)
+				return
+			}
+			if err := validateArguments(fnCall.Arguments, inputModel); err != nil {
+				_ = ctx.ReadLLMArguments(&json.RawMessage{})
+				_ = ctx.WriteLLMToolResult(ErrorResultWithCode(ErrorCodeInvalidArguments, err))
+				return
+			}
+			next(ctx)
+		}
+	}
+}
+
+func validateArguments(arguments string, inputModel any) error {
+	typ := reflect.TypeOf(inputModel)
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil
+	}
+	if arguments == "" {
+		arguments = "{}"
+	}
+
+	dec := json.NewDecoder(strings.NewReader(arguments))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(reflect.New(typ).Interface()); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(arguments), &fields); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	var missing []string
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || strings.Contains(opts, "omitempty") {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if v, ok := fields[name]; !ok || string(v) == "null" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("invalid arguments: missing required fields: " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ToolMetrics is the measurement of a tool calling.
+type ToolMetrics struct {
+	// FunctionName is the name of the called function
+	FunctionName string
+	// Duration is the time spent by the tool handler
+	Duration time.Duration
+	// IsOK reports whether the tool handler has written a successful result
+	IsOK bool
+	// ErrorCode is the error code of the error result
+	ErrorCode string
+}
+
+// Metrics measures the tool calling, observe is called with the measurement after the tool handler returns.
+func Metrics(observe func(ToolMetrics)) ToolMiddleware {
+	return func(next ToolHandler) ToolHandler {
+		return func(ctx serverless.Context) {
+			fnCall := &FunctionCall{}
+			_ = ctx.ReadLLMFunctionCall(fnCall)
+
+			tc := newToolContext(ctx)
+			start := time.Now()
+			defer func() {
+				isOK, code, _ := tc.result()
+				observe(ToolMetrics{
+					FunctionName: fnCall.FunctionName,
+					Duration:     time.Since(start),
+					IsOK:         isOK,
+					ErrorCode:    code,
+				})
+			}()
+			next(tc)
+		}
+	}
+}
+
+// Logging logs the tool calling by the logger.
+func Logging(logger *slog.Logger) ToolMiddleware {
+	return Metrics(func(m ToolMetrics) {
+		if m.IsOK {
+			logger.Info("tool call", "function", m.FunctionName, "duration", m.Duration)
+			return
+		}
+		logger.Warn("tool call failed", "function", m.FunctionName, "duration", m.Duration, "error_code", m.ErrorCode)
+	})
+}
+
+// toolContext records the result written by the tool handler.
+type toolContext struct {
+	serverless.Context
+
+	mu        sync.Mutex
+	written   bool
+	isOK      bool
+	errorCode string
+}
+
+func newToolContext(ctx serverless.Context) *toolContext {
+	return &toolContext{Context: ctx}
+}
+
+func (c *toolContext) WriteLLMResult(result string) error {
+	err := c.Context.WriteLLMResult(result)
+	if err == nil {
+		c.record(true, "")
+	}
+	return err
+}
+
+func (c *toolContext) WriteLLMToolResult(result any) error {
+	err := c.Context.WriteLLMToolResult(result)
+	if err == nil {
+		if r, ok := result.(*ToolResult); ok && r.Type == ToolResultError {
+			c.record(false, r.Code)
+		} else {
+			c.record(true, "")
+		}
+	}
+	return err
+}
+
+func (c *toolContext) record(isOK bool, errorCode string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = true
+	c.isOK = isOK
+	c.errorCode = errorCode
+}
+
+func (c *toolContext) result() (isOK bool, errorCode string, written bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.isOK, c.errorCode, c.written
+}
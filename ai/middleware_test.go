@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/serverless"
+)
+
+type timezoneArguments struct {
+	SourceTimezone string `json:"sourceTimezone"`
+	TargetTimezone string `json:"targetTimezone"`
+	TimeString     string `json:"timeString"`
+	Format         string `json:"format,omitempty"`
+}
+
+func readResult(t *testing.T, ctx *MockContext) *FunctionCall {
+	records := ctx.RecordsWritten()
+	assert.Len(t, records, 1)
+	fnCall := &FunctionCall{}
+	assert.NoError(t, fnCall.FromBytes(records[0].Data))
+	return fnCall
+}
+
+func TestRecover(t *testing.T) {
+	t.Run("panic", func(t *testing.T) {
+		ctx := NewMockContext([]byte(jsonStr), 0x10)
+		handler := UseToolMiddlewares(func(ctx serverless.Context) {
+			panic("boom")
+		}, Recover())
+
+		assert.NotPanics(t, func() { handler(ctx) })
+
+		fnCall := readResult(t, ctx)
+		assert.False(t, fnCall.IsOK)
+		assert.Equal(t, ErrorCodePanic, fnCall.ErrorCode)
+		assert.Equal(t, "function panicked: boom", fnCall.Error)
+	})
+
+	t.Run("panic after writing the result", func(t *testing.T) {
+		ctx := NewMockContext([]byte(jsonStr), 0x10)
+		handler := UseToolMiddlewares(func(ctx serverless.Context) {
+			_ = ctx.ReadLLMArguments(&timezoneArguments{})
+			_ = ctx.WriteLLMResult("ok")
+			panic("boom")
+		}, Recover())
+
+		handler(ctx)
+
+		fnCall := readResult(t, ctx)
+		assert.True(t, fnCall.IsOK)
+		assert.Equal(t, "ok", fnCall.Result)
+	})
+}
+
+func TestValidateArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		arguments string
+		wantErr   bool
+	}{
+		{name: "ok", arguments: `{"sourceTimezone":"UTC","targetTimezone":"Asia/Singapore","timeString":"2024-03-25 07:00:00"}`},
+		{name: "missing required", arguments: `{"sourceTimezone":"UTC"}`, wantErr: true},
+		{name: "null required", arguments: `{"sourceTimezone":"UTC","targetTimezone":null,"timeString":"2024-03-25 07:00:00"}`, wantErr: true},
+		{name: "unknown field", arguments: `{"sourceTimezone":"UTC","targetTimezone":"UTC","timeString":"07:00","zone":"x"}`, wantErr: true},
+		{name: "wrong type", arguments: `{"sourceTimezone":1,"targetTimezone":"UTC","timeString":"07:00"}`, wantErr: true},
+		{name: "empty", arguments: ``, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf, _ := (&FunctionCall{ReqID: "req", ToolCallID: "call", Arguments: tt.arguments}).Bytes()
+			ctx := NewMockContext(buf, 0x10)
+
+			called := false
+			handler := UseToolMiddlewares(func(ctx serverless.Context) {
+				called = true
+			}, ValidateArguments(&timezoneArguments{}))
+			handler(ctx)
+
+			assert.Equal(t, !tt.wantErr, called)
+			if tt.wantErr {
+				fnCall := readResult(t, ctx)
+				assert.False(t, fnCall.IsOK)
+				assert.Equal(t, ErrorCodeInvalidArguments, fnCall.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var got []ToolMetrics
+	observe := func(m ToolMetrics) { got = append(got, m) }
+
+	ok := UseToolMiddlewares(func(ctx serverless.Context) {
+		_ = ctx.ReadLLMArguments(&timezoneArguments{})
+		_ = ctx.WriteLLMResult("ok")
+	}, Metrics(observe))
+	ok(NewMockContext([]byte(jsonStr), 0x10))
+
+	panics := UseToolMiddlewares(func(ctx serverless.Context) {
+		panic("boom")
+	}, Metrics(observe), Recover())
+	panics(NewMockContext([]byte(jsonStr), 0x10))
+
+	assert.Len(t, got, 2)
+	assert.Equal(t, "fn-timezone-converter", got[0].FunctionName)
+	assert.True(t, got[0].IsOK)
+	assert.False(t, got[1].IsOK)
+	assert.Equal(t, ErrorCodePanic, got[1].ErrorCode)
+}
@@ -1,31 +1,43 @@
 package ai
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"sync"
 
+	"github.com/yomorun/yomo/core/metadata"
 	"github.com/yomorun/yomo/serverless"
 	"github.com/yomorun/yomo/serverless/guest"
 )
 
-var _ serverless.Context = (*MockContext)(nil)
+var (
+	_ serverless.Context      = (*MockContext)(nil)
+	_ serverless.StateContext = (*MockContext)(nil)
+)
 
-// WriteRecord composes the data, tag and target.
+// WriteRecord composes the data, tag, target and metadata.
 type WriteRecord struct {
-	Data   []byte
-	Tag    uint32
-	Target string
+	Data     []byte
+	Tag      uint32
+	Target   string
+	Metadata map[string]string
 }
 
 // MockContext mock context.
 type MockContext struct {
 	data   []byte
 	tag    uint32
+	md     map[string]string
 	fnCall *FunctionCall
 
-	mu      sync.Mutex
-	wrSlice []WriteRecord
+	mu       sync.Mutex
+	wrSlice  []WriteRecord
+	state    *MockState
+	invokeFn func(name string, args any) (string, error)
 }
 
 // NewMockContext returns the mock context.
@@ -42,14 +54,41 @@ func (c *MockContext) Data() []byte {
 	return c.data
 }
 
+// DataReader returns the reader of the incoming data.
+func (c *MockContext) DataReader() io.Reader {
+	return bytes.NewReader(c.data)
+}
+
 // Tag incoming tag.
 func (c *MockContext) Tag() uint32 {
 	return c.tag
 }
 
 // Metadata returns the metadata by the given key.
-func (c *MockContext) Metadata(_ string) (string, bool) {
-	panic("not implemented")
+func (c *MockContext) Metadata(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.md[key]
+	return v, ok
+}
+
+// SetMetadata sets the metadata by the given key.
+func (c *MockContext) SetMetadata(key, value string) error {
+	if key == "" {
+		return errors.New("metadata key is empty")
+	}
+	if metadata.IsReservedKey(key) {
+		return fmt.Errorf("metadata key %s is reserved", key)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.md == nil {
+		c.md = make(map[string]string)
+	}
+	c.md[key] = value
+	return nil
 }
 
 // HTTP returns the HTTP interface.H
@@ -70,6 +109,14 @@ func (c *MockContext) Write(tag uint32, data []byte) error {
 	return nil
 }
 
+// WriteContext writes the data with the given tag, it fails if the ctx is done.
+func (c *MockContext) WriteContext(ctx context.Context, tag uint32, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return context.Cause(ctx)
+	}
+	return c.Write(tag, data)
+}
+
 // WriteWithTarget writes the data with the given tag and target.
 func (c *MockContext) WriteWithTarget(tag uint32, data []byte, target string) error {
 	c.mu.Lock()
@@ -84,6 +131,25 @@ func (c *MockContext) WriteWithTarget(tag uint32, data []byte, target string) er
 	return nil
 }
 
+// WriteWithMetadata writes the data with the given tag and metadata.
+func (c *MockContext) WriteWithMetadata(tag uint32, data []byte, md map[string]string) error {
+	for k := range md {
+		if metadata.IsReservedKey(k) {
+			return fmt.Errorf("metadata key %s is reserved", k)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.wrSlice = append(c.wrSlice, WriteRecord{
+		Data:     data,
+		Tag:      tag,
+		Metadata: md,
+	})
+
+	return nil
+}
+
 // ReadLLMArguments reads LLM function arguments.
 func (c *MockContext) ReadLLMArguments(args any) error {
 	fnCall := &FunctionCall{}
@@ -122,6 +188,58 @@ func (c *MockContext) WriteLLMResult(result string) error {
 	return nil
 }
 
+// WriteLLMPartialResult writes an incremental progress chunk of the LLM function result.
+func (c *MockContext) WriteLLMPartialResult(chunk string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fnCall == nil {
+		return errors.New("no function call, can't write result")
+	}
+	partial := *c.fnCall
+	partial.IsOK = true
+	partial.IsPartial = true
+	partial.Result = chunk
+	partial.ToolResult = nil
+	buf, err := partial.Bytes()
+	if err != nil {
+		return err
+	}
+
+	c.wrSlice = append(c.wrSlice, WriteRecord{
+		Data: buf,
+		Tag:  ReducerTag,
+	})
+	return nil
+}
+
+// WriteLLMToolResult writes the structured LLM function result.
+func (c *MockContext) WriteLLMToolResult(result any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.fnCall == nil {
+		return errors.New("no function call, can't write result")
+	}
+	toolResult, ok := result.(*ToolResult)
+	if !ok {
+		return errors.New("given object is not *ai.ToolResult")
+	}
+	if err := c.fnCall.SetToolResult(toolResult); err != nil {
+		return err
+	}
+	buf, err := c.fnCall.Bytes()
+	if err != nil {
+		return err
+	}
+
+	c.wrSlice = append(c.wrSlice, WriteRecord{
+		Data: buf,
+		Tag:  ReducerTag,
+	})
+	return nil
+}
+
 // ReadLLMFunctionCall reads LLM function call.
 func (c *MockContext) ReadLLMFunctionCall(fnCall any) error {
 	if c.data == nil {
@@ -134,6 +252,70 @@ func (c *MockContext) ReadLLMFunctionCall(fnCall any) error {
 	return fco.FromBytes(c.data)
 }
 
+// SetInvokeFunction sets the function which serves InvokeFunction(), it mocks the functions registered in the zipper.
+func (c *MockContext) SetInvokeFunction(fn func(name string, args any) (string, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invokeFn = fn
+}
+
+// InvokeFunction invokes the function set by SetInvokeFunction.
+func (c *MockContext) InvokeFunction(name string, args any) (string, error) {
+	c.mu.Lock()
+	fn := c.invokeFn
+	c.mu.Unlock()
+
+	if fn == nil {
+		return "", fmt.Errorf("function %s is not registered", name)
+	}
+	return fn(name, args)
+}
+
+// State returns the in-memory state of the mock context.
+func (c *MockContext) State() serverless.State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == nil {
+		c.state = &MockState{data: make(map[string][]byte)}
+	}
+	return c.state
+}
+
+// MockState is the in-memory state for testing.
+type MockState struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+// Get returns the value of the key.
+func (s *MockState) Get(key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	value, ok := s.data[key]
+	return value, ok, nil
+}
+
+// Set sets the value of the key.
+func (s *MockState) Set(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data[key] = value
+	return nil
+}
+
+// Delete deletes the key.
+func (s *MockState) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data, key)
+	return nil
+}
+
 // RecordsWritten returns the data records be written with `ctx.Write`.
 func (c *MockContext) RecordsWritten() []WriteRecord {
 	c.mu.Lock()
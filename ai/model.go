@@ -1,7 +1,12 @@
 // Package ai contains the model for LLM Function Calling features
 package ai
 
-import "github.com/sashabaranov/go-openai"
+import (
+	"encoding/json"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+)
 
 // ErrorResponse is the response for error
 type ErrorResponse struct {
@@ -52,11 +57,21 @@ type FunctionParameters struct {
 	Required   []string                      `json:"required"`
 }
 
-// ParameterProperty defines the property of the parameter
+// ParameterProperty defines the property of the parameter, it is a JSON Schema object.
+// The nested objects are described by Properties and Required, and the elements of arrays by Items.
 type ParameterProperty struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description"`
-	Enum        []string `json:"enum,omitempty"`
+	Type        string                        `json:"type"`
+	Description string                        `json:"description"`
+	Enum        []any                         `json:"enum,omitempty"`
+	Minimum     json.Number                   `json:"minimum,omitempty"`
+	Maximum     json.Number                   `json:"maximum,omitempty"`
+	MinLength   *uint64                       `json:"minLength,omitempty"`
+	MaxLength   *uint64                       `json:"maxLength,omitempty"`
+	MinItems    *uint64                       `json:"minItems,omitempty"`
+	MaxItems    *uint64                       `json:"maxItems,omitempty"`
+	Items       *ParameterProperty            `json:"items,omitempty"`
+	Properties  map[string]*ParameterProperty `json:"properties,omitempty"`
+	Required    []string                      `json:"required,omitempty"`
 }
 
 // ToolMessage used for OpenAI tool message
@@ -64,6 +79,83 @@ type ToolMessage struct {
 	Role       string `json:"role"`
 	Content    string `json:"content"`
 	ToolCallId string `json:"tool_call_id"`
+	// Error is the error of the failed tool call, the content is the JSON of it for the llm.
+	Error *ToolError `json:"error,omitempty"`
+}
+
+// ToolError is the error of the failed tool call.
+type ToolError struct {
+	// Code is the error code, eg: ErrorCodeTimeout.
+	Code string `json:"code"`
+	// Message is the error message.
+	Message string `json:"message"`
+}
+
+// ToolProgress is the incremental progress of a tool call, it is emitted as the `progress` event
+// of the server-sent events when the chat completion is streamed.
+type ToolProgress struct {
+	ToolCallID   string `json:"tool_call_id"`
+	FunctionName string `json:"function_name"`
+	Content      string `json:"content"`
+}
+
+// The server-sent events of the streamed chat completion, the data of the events are JSON of the stable shapes,
+// so the frontends can render the call stack live. The `progress` events are always emitted, the others are
+// emitted if `include_call_stack` is true in the request. The chunks of the chat completion are the unnamed
+// events as usual, and the stream ends with `data: [DONE]`.
+const (
+	// EventProgress is the event of ToolProgress.
+	EventProgress = "progress"
+	// EventToolCall is the event of ToolCallEvent, it's emitted before the tool is called.
+	EventToolCall = "tool_call"
+	// EventToolResult is the event of ToolResultEvent, it's emitted after the tool returns.
+	EventToolResult = "tool_result"
+	// EventUsage is the event of UsageEvent, it's emitted before the done event if the usage is reported
+	// by the llm provider, eg: `stream_options.include_usage` is true.
+	EventUsage = "usage"
+	// EventDone is the event of DoneEvent, it's the last event before `data: [DONE]`.
+	EventDone = "done"
+)
+
+// ToolCallEvent is the data of the `tool_call` event.
+type ToolCallEvent struct {
+	ToolCallID   string `json:"tool_call_id"`
+	FunctionName string `json:"function_name"`
+	Arguments    string `json:"arguments"`
+}
+
+// ToolResultEvent is the data of the `tool_result` event.
+type ToolResultEvent struct {
+	ToolCallID   string `json:"tool_call_id"`
+	FunctionName string `json:"function_name"`
+	Content      string `json:"content"`
+}
+
+// UsageEvent is the data of the `usage` event, it sums up the usage of all the llm calls of the request.
+type UsageEvent struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// DoneEvent is the data of the `done` event.
+type DoneEvent struct {
+	TransID      string `json:"trans_id"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// ChatCompletionResponse is the non-streamed chat completion response with the call stack, it's returned
+// if `include_call_stack` is true in the request.
+type ChatCompletionResponse struct {
+	openai.ChatCompletionResponse
+	// CallStack is the tool calls executed for the chat completion and their results
+	CallStack CallStack `json:"call_stack"`
+}
+
+// CallStack is the tool calls executed for the chat completion and their results.
+type CallStack struct {
+	ToolCalls    []openai.ToolCall `json:"tool_calls"`
+	ToolMessages []ToolMessage     `json:"tool_messages"`
 }
 
 // ChainMessage is the message for chaining llm request with preceeding `tool_calls` response
@@ -76,3 +168,55 @@ type ChainMessage struct {
 
 // FunctionDefinitionKey is the yomo metadata key for function definition
 const FunctionDefinitionKey = "function-definition"
+
+// FunctionVersionKey is the yomo metadata key for the version of the registered function
+const FunctionVersionKey = "function-version"
+
+// FunctionAliasesKey is the yomo metadata key for the comma separated aliases of the registered function
+const FunctionAliasesKey = "function-aliases"
+
+// FunctionVersionPinKey returns the metadata key which pins the version of the function, the bridge
+// exposes the latest version of the function if the key is not in the metadata of the credential.
+func FunctionVersionPinKey(name string) string {
+	return "function-version:" + name
+}
+
+// FunctionDescriptionKey returns the yomo metadata key for the description of the registered function
+// in the language, eg: zh-CN.
+func FunctionDescriptionKey(lang string) string {
+	return "function-description:" + lang
+}
+
+// FunctionPolicyKey is the yomo metadata key for the JSON encoded call policy of the registered function
+const FunctionPolicyKey = "function-policy"
+
+// AcceptLanguageKey is the yomo metadata key for the preferred languages of the request, it is in the
+// format of the Accept-Language header, the descriptions of the functions are localized by it.
+const AcceptLanguageKey = "accept-language"
+
+// ScopeKey is the yomo metadata key for the comma separated scopes, eg: tenant-a,tenant-b. The scopes of
+// the sfn are carried in the metadata returned by its authentication, the scopes of the credential of the
+// bridge are carried in the metadata returned by the ExchangeMetadataFunc, they are replaced by the scopes
+// of the caller if the caller is authenticated by the server. A completion only sees and invokes the functions
+// registered by the sfns whose scopes overlap the scopes of its credential, the scope "*" of the credential
+// overlaps all the scopes. The zipper only routes the tool calls to the sfns of the overlapped scopes.
+const ScopeKey = metadata.ScopeKey
+
+// PriorityKey is the yomo metadata key for the priority of the credential of the bridge, eg: 10, it is carried
+// in the metadata returned by the ExchangeMetadataFunc. When the llm provider is rate limited, the queued requests
+// of the higher priorities are sent first, the default priority is 0.
+const PriorityKey = "priority"
+
+// FunctionRegistration is the function definition registered by the sfn, the version and aliases
+// are carried along with the definition, so the changed schema of the function can be rolled out safely.
+type FunctionRegistration struct {
+	*FunctionDefinition
+	// Version is the version of the function, eg: v1.2.0, the latest version is exposed by default.
+	Version string `json:"version,omitempty"`
+	// Aliases are the other names of the function, the function can be invoked by them.
+	Aliases []string `json:"aliases,omitempty"`
+	// Descriptions are the localized descriptions of the function, the key is the language tag, eg: zh-CN.
+	Descriptions map[string]string `json:"descriptions,omitempty"`
+	// Policy is the retry policy and timeout of the function calling
+	Policy *CallPolicy `json:"policy,omitempty"`
+}
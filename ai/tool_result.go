@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ToolResultType is the content type of the structured tool result
+type ToolResultType string
+
+const (
+	// ToolResultText is the plain text result
+	ToolResultText ToolResultType = "text"
+	// ToolResultJSON is the JSON value result
+	ToolResultJSON ToolResultType = "json"
+	// ToolResultMarkdown is the markdown result
+	ToolResultMarkdown ToolResultType = "markdown"
+	// ToolResultImage is the image reference result, the content is the url of the image
+	ToolResultImage ToolResultType = "image"
+	// ToolResultError is the error result, the content is the error message
+	ToolResultError ToolResultType = "error"
+)
+
+// ToolResult is the structured result of the llm function calling, it is serialized by the sfn,
+// and interpreted by the bridge when building the tool message.
+type ToolResult struct {
+	// Type is the content type of the result
+	Type ToolResultType `json:"type"`
+	// Content is the content of the result, it is a JSON value for ToolResultJSON, and a string for others
+	Content any `json:"content"`
+	// Code is the error code of ToolResultError, the bridge retries the function calling by it
+	Code string `json:"code,omitempty"`
+}
+
+// TextResult returns the plain text tool result
+func TextResult(text string) *ToolResult {
+	return &ToolResult{Type: ToolResultText, Content: text}
+}
+
+// JSONResult returns the JSON value tool result, the value is marshaled by encoding/json
+func JSONResult(value any) *ToolResult {
+	return &ToolResult{Type: ToolResultJSON, Content: value}
+}
+
+// MarkdownResult returns the markdown tool result
+func MarkdownResult(markdown string) *ToolResult {
+	return &ToolResult{Type: ToolResultMarkdown, Content: markdown}
+}
+
+// ImageResult returns the image reference tool result
+func ImageResult(url string) *ToolResult {
+	return &ToolResult{Type: ToolResultImage, Content: url}
+}
+
+// ErrorResult returns the error tool result, the function calling is regarded as failed
+func ErrorResult(err error) *ToolResult {
+	return &ToolResult{Type: ToolResultError, Content: err.Error()}
+}
+
+// ErrorResultWithCode returns the error tool result with the error code, the function calling
+// is retried if the code is retryable in the call policy of the function
+func ErrorResultWithCode(code string, err error) *ToolResult {
+	return &ToolResult{Type: ToolResultError, Content: err.Error(), Code: code}
+}
+
+// ToolMessageContent returns the content of the tool message which is sent to the llm
+func (r *ToolResult) ToolMessageContent() (string, error) {
+	switch r.Type {
+	case ToolResultJSON:
+		buf, err := json.Marshal(r.Content)
+		if err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	case ToolResultImage:
+		return fmt.Sprintf("![image](%v)", r.Content), nil
+	case ToolResultText, ToolResultMarkdown, ToolResultError:
+		if s, ok := r.Content.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(r.Content), nil
+	default:
+		return "", fmt.Errorf("unknown tool result type: %s", r.Type)
+	}
+}
@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToolMessageContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  *ToolResult
+		want    string
+		wantErr bool
+	}{
+		{name: "text", result: TextResult("sunny"), want: "sunny"},
+		{name: "json", result: JSONResult(map[string]any{"temp": 25}), want: `{"temp":25}`},
+		{name: "markdown", result: MarkdownResult("# weather"), want: "# weather"},
+		{name: "image", result: ImageResult("https://yomo.run/sunny.png"), want: "![image](https://yomo.run/sunny.png)"},
+		{name: "error", result: ErrorResult(errors.New("city not found")), want: "city not found"},
+		{name: "unknown", result: &ToolResult{Type: "audio"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.result.ToolMessageContent()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWriteLLMToolResult(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		ctx := NewMockContext([]byte(jsonStr), 0x10)
+		assert.NoError(t, ctx.ReadLLMArguments(&map[string]string{}))
+		assert.NoError(t, ctx.WriteLLMToolResult(JSONResult(map[string]any{"time": "22:00"})))
+
+		fnCall := &FunctionCall{}
+		assert.NoError(t, fnCall.FromBytes(ctx.RecordsWritten()[0].Data))
+		assert.True(t, fnCall.IsOK)
+		assert.Equal(t, ToolResultJSON, fnCall.ToolResult.Type)
+		content, err := fnCall.ToolResult.ToolMessageContent()
+		assert.NoError(t, err)
+		assert.Equal(t, `{"time":"22:00"}`, content)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		ctx := NewMockContext([]byte(jsonStr), 0x10)
+		assert.NoError(t, ctx.ReadLLMArguments(&map[string]string{}))
+		assert.NoError(t, ctx.WriteLLMToolResult(ErrorResult(errors.New("invalid timezone"))))
+
+		fnCall := &FunctionCall{}
+		assert.NoError(t, fnCall.FromBytes(ctx.RecordsWritten()[0].Data))
+		assert.False(t, fnCall.IsOK)
+		assert.Equal(t, "invalid timezone", fnCall.Error)
+	})
+
+	t.Run("error with code", func(t *testing.T) {
+		ctx := NewMockContext([]byte(jsonStr), 0x10)
+		assert.NoError(t, ctx.ReadLLMArguments(&map[string]string{}))
+		assert.NoError(t, ctx.WriteLLMToolResult(ErrorResultWithCode("unavailable", errors.New("service unavailable"))))
+
+		fnCall := &FunctionCall{}
+		assert.NoError(t, fnCall.FromBytes(ctx.RecordsWritten()[0].Data))
+		assert.False(t, fnCall.IsOK)
+		assert.Equal(t, "unavailable", fnCall.ErrorCode)
+	})
+
+	t.Run("not a tool result", func(t *testing.T) {
+		ctx := NewMockContext([]byte(jsonStr), 0x10)
+		assert.NoError(t, ctx.ReadLLMArguments(&map[string]string{}))
+		assert.Error(t, ctx.WriteLLMToolResult("raw string"))
+	})
+}
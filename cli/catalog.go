@@ -0,0 +1,87 @@
+/*
+Copyright © 2021 Allegro Networks
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yomorun/yomo/pkg/log"
+)
+
+var (
+	catalogEndpoint   string
+	catalogAdminToken string
+)
+
+// catalogCmd represents the catalog command
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Dump the registered AI functions",
+	Long:  "Dump the AI functions registered to the LLM bridge as JSON, eg: yomo catalog > catalog.json",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := dumpCatalog(catalogEndpoint, catalogAdminToken, os.Stdout); err != nil {
+			log.FailureStatusEvent(os.Stderr, "Dump the catalog failure with the error: %v", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// dumpCatalog gets the catalog from GET /admin/catalog of the llm bridge with the admin token, and writes it as
+// indented JSON.
+func dumpCatalog(endpoint string, adminToken string, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(endpoint, "/")+"/admin/catalog", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, body)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+func init() {
+	rootCmd.AddCommand(catalogCmd)
+
+	catalogCmd.Flags().StringVarP(&catalogEndpoint, "endpoint", "e", "http://localhost:8000", "The endpoint of the LLM bridge")
+	catalogCmd.Flags().StringVarP(&catalogAdminToken, "admin-token", "t", os.Getenv("YOMO_ADMIN_TOKEN"), "The admin_token of the LLM bridge, default is $YOMO_ADMIN_TOKEN")
+}
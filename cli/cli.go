@@ -61,7 +61,15 @@ func loadOptionsFromViper(v *viper.Viper, opts *serverless.Options) {
 	opts.Credential = v.GetString("credential")
 	opts.ModFile = v.GetString("modfile")
 	opts.Runtime = v.GetString("runtime")
+	opts.Config = v.GetString("config")
 	opts.WASI = v.GetBool("wasi")
+	opts.WasmCompilationMode = v.GetString("wasm-compilation-mode")
+	opts.WasmCacheDir = v.GetString("wasm-cache-dir")
+	opts.WasmNoCache = v.GetBool("no-cache")
+	opts.WasmMemoryLimit = v.GetUint32("wasm-memory-limit")
+	opts.WasmTimeout = v.GetDuration("wasm-timeout")
+	opts.WasmFuel = v.GetUint64("wasm-fuel")
+	opts.WasmWatch = v.GetBool("wasm-watch")
 }
 
 func parseFileArg(args []string, opts *serverless.Options, defaultFiles ...string) error {
@@ -23,6 +23,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/yomorun/yomo/cli/serverless/golang"
+	"github.com/yomorun/yomo/cli/serverless/rust"
 	"github.com/yomorun/yomo/pkg/file"
 	"github.com/yomorun/yomo/pkg/log"
 )
@@ -30,6 +31,7 @@ import (
 var (
 	name string
 	rx   bool
+	lang string
 )
 
 // initCmd represents the init command
@@ -49,6 +51,15 @@ var initCmd = &cobra.Command{
 
 		log.PendingStatusEvent(os.Stdout, "Initializing the Stream Function...")
 		name = strings.ReplaceAll(name, " ", "_")
+		switch lang {
+		case "go":
+		case "rust":
+			initRust(name)
+			return
+		default:
+			log.FailureStatusEvent(os.Stdout, "Unsupported language: %s, go and rust are supported", lang)
+			return
+		}
 		// create app.go
 		fname := filepath.Join(name, defaultSFNSourceFile)
 		contentTmpl := golang.InitTmpl
@@ -81,9 +92,32 @@ var initCmd = &cobra.Command{
 	},
 }
 
+// initRust initializes a rust wasm stream function with the yomo crate.
+func initRust(name string) {
+	// create Cargo.toml
+	fname := filepath.Join(name, "Cargo.toml")
+	if err := file.PutContents(fname, rust.CargoTmpl); err != nil {
+		log.FailureStatusEvent(os.Stdout, "Write stream function into Cargo.toml file failure with the error: %v", err)
+		return
+	}
+
+	// create src/lib.rs
+	fname = filepath.Join(name, "src", "lib.rs")
+	if err := file.PutContents(fname, rust.LibTmpl); err != nil {
+		log.FailureStatusEvent(os.Stdout, "Write stream function into src/lib.rs file failure with the error: %v", err)
+		return
+	}
+
+	log.SuccessStatusEvent(os.Stdout, "Congratulations! You have initialized the stream function successfully.")
+	log.InfoStatusEvent(os.Stdout, "You can enjoy the YoMo Stream Function via the command: ")
+	log.InfoStatusEvent(os.Stdout, "\tStep 1: cd %s && cargo build --release --target wasm32-wasip1", name)
+	log.InfoStatusEvent(os.Stdout, "\tStep 2: yomo run target/wasm32-wasip1/release/sfn.wasm")
+}
+
 func init() {
 	rootCmd.AddCommand(initCmd)
 
 	initCmd.Flags().StringVarP(&name, "name", "n", "", "The name of Stream Function")
 	initCmd.Flags().BoolVarP(&rx, "rx", "r", false, "Use RxStream Handler")
+	initCmd.Flags().StringVarP(&lang, "lang", "l", "go", "The language of Stream Function, go or rust")
 }
@@ -18,16 +18,19 @@ package cli
 import (
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
+	pkgconfig "github.com/yomorun/yomo/pkg/config"
 	"github.com/yomorun/yomo/pkg/log"
+	"github.com/yomorun/yomo/pkg/trace"
 
 	// serverless registrations
 	"github.com/yomorun/yomo/cli/serverless"
 	_ "github.com/yomorun/yomo/cli/serverless/deno"
 	_ "github.com/yomorun/yomo/cli/serverless/exec"
 	_ "github.com/yomorun/yomo/cli/serverless/golang"
-	_ "github.com/yomorun/yomo/cli/serverless/wasm"
+	"github.com/yomorun/yomo/cli/serverless/wasm"
 	"github.com/yomorun/yomo/cli/viper"
 )
 
@@ -48,6 +51,13 @@ var runCmd = &cobra.Command{
 			log.FailureStatusEvent(os.Stdout, "YoMo Stream Function's Name is empty, please set name used by `-n` flag")
 			return
 		}
+		// tracing
+		if opts.Config != "" {
+			if err := setupTracing(opts.Config); err != nil {
+				log.FailureStatusEvent(os.Stdout, err.Error())
+				return
+			}
+		}
 		// resolve serverless
 		log.PendingStatusEvent(os.Stdout, "Create YoMo Stream Function instance...")
 		if err := parseZipperAddr(&opts); err != nil {
@@ -82,7 +92,7 @@ var runCmd = &cobra.Command{
 		if ext := filepath.Ext(opts.Filename); ext == ".wasm" {
 			wasmRuntime := opts.Runtime
 			if wasmRuntime == "" {
-				wasmRuntime = "wazero"
+				wasmRuntime = wasm.DefaultRuntime
 			}
 			log.InfoStatusEvent(os.Stdout, "WASM runtime: %s", wasmRuntime)
 		}
@@ -99,6 +109,26 @@ var runCmd = &cobra.Command{
 	},
 }
 
+// setupTracing applies the tracing config to the sfn, the config is passed to the sfn
+// processes by the OTEL_* environment variables.
+func setupTracing(config string) error {
+	conf, err := pkgconfig.ParseTracingConfig(config)
+	if err != nil {
+		return err
+	}
+	if conf == nil {
+		return nil
+	}
+	for _, kv := range conf.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+	// the wasm sfn runs in the cli process
+	return trace.SetTracerProviderWithConfig("yomo", *conf)
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 
@@ -107,6 +137,15 @@ func init() {
 	runCmd.Flags().StringVarP(&opts.ModFile, "modfile", "m", "", "custom go.mod")
 	runCmd.Flags().StringVarP(&opts.Credential, "credential", "d", "", "client credential payload, eg: `token:dBbBiRE7`")
 	runCmd.Flags().StringVarP(&opts.Runtime, "runtime", "r", "", "serverless runtime type")
+	runCmd.Flags().StringVarP(&opts.Config, "config", "c", "", "config file, the tracing config in it is applied to the sfn")
+	runCmd.Flags().StringVar(&opts.WasmCompilationMode, "wasm-compilation-mode", "", "wasm runtime compilation mode, compiler or interpreter")
+	runCmd.Flags().StringVar(&opts.WasmCacheDir, "wasm-cache-dir", "", "directory to cache the compiled wasm modules, default is yomo/wasm in the user cache directory")
+	runCmd.Flags().BoolVar(&opts.WasmNoCache, "no-cache", false, "disable caching the compiled wasm modules on disk")
+	runCmd.Flags().Uint32Var(&opts.WasmMemoryLimit, "wasm-memory-limit", 0, "maximum linear memory of the wasm sfn in MiB, 0 means no limit")
+	runCmd.Flags().DurationVar(&opts.WasmTimeout, "wasm-timeout", 0, "maximum execution time of one wasm sfn invocation, eg: `5s`, 0 means no limit")
+	runCmd.Flags().Uint64Var(&opts.WasmFuel, "wasm-fuel", 0, "maximum fuel of one wasm sfn invocation (wasmtime only), 0 means no limit")
+	runCmd.Flags().BoolVar(&opts.WasmWatch, "wasm-watch", false, "reload the wasm sfn without reconnecting when the wasm file is changed")
+	runCmd.Flags().StringVar(&opts.WasmReloadAddr, "wasm-reload-addr", "", "address of the http endpoint reloading the wasm sfn by POST /reload, eg: `localhost:9001`")
 
 	viper.BindPFlags(viper.RunViper, runCmd.Flags())
 }
@@ -17,19 +17,32 @@ package cli
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"os"
+	"reflect"
+	"runtime"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/yomorun/yomo"
 	"github.com/yomorun/yomo/core/ylog"
 	pkgconfig "github.com/yomorun/yomo/pkg/config"
+	"github.com/yomorun/yomo/pkg/dedup"
 	"github.com/yomorun/yomo/pkg/log"
+	"github.com/yomorun/yomo/pkg/redact"
+	"github.com/yomorun/yomo/pkg/signature"
+	pkgtls "github.com/yomorun/yomo/pkg/tls"
+	"github.com/yomorun/yomo/pkg/trace"
+	"github.com/yomorun/yomo/pkg/webhook"
+	"golang.org/x/crypto/acme"
 
 	"github.com/yomorun/yomo/pkg/bridge/ai"
 	"github.com/yomorun/yomo/pkg/bridge/ai/provider/azopenai"
 	"github.com/yomorun/yomo/pkg/bridge/ai/provider/cfazure"
 	"github.com/yomorun/yomo/pkg/bridge/ai/provider/cfopenai"
+	"github.com/yomorun/yomo/pkg/bridge/ai/provider/compat"
+	"github.com/yomorun/yomo/pkg/bridge/ai/provider/localllm"
 	"github.com/yomorun/yomo/pkg/bridge/ai/provider/openai"
 )
 
@@ -47,11 +60,32 @@ var serveCmd = &cobra.Command{
 		// log.InfoStatusEvent(os.Stdout, "")
 		ylog.Info("Starting Zipper...")
 		// config
-		conf, err := pkgconfig.ParseConfigFile(config)
+		source, err := pkgconfig.NewSource(config)
 		if err != nil {
 			log.FailureStatusEvent(os.Stdout, err.Error())
 			return
 		}
+		conf, err := pkgconfig.LoadConfig(context.Background(), source)
+		if err != nil {
+			log.FailureStatusEvent(os.Stdout, err.Error())
+			return
+		}
+		// redact the secrets from the logs and the traces
+		if conf.Redact != nil {
+			redactor, err := redact.New(*conf.Redact)
+			if err != nil {
+				log.FailureStatusEvent(os.Stdout, err.Error())
+				return
+			}
+			redact.SetDefault(redactor)
+		}
+		// tracing of the zipper and the bridge
+		if conf.Tracing != nil {
+			if err := trace.SetTracerProviderWithConfig("yomo", *conf.Tracing); err != nil {
+				log.FailureStatusEvent(os.Stdout, err.Error())
+				return
+			}
+		}
 		ctx := context.Background()
 		// listening address.
 		listenAddr := fmt.Sprintf("%s:%d", conf.Host, conf.Port)
@@ -63,6 +97,52 @@ var serveCmd = &cobra.Command{
 				options = append(options, yomo.WithAuth("token", tokenString))
 			}
 		}
+		// the certificates obtained and renewed by acme
+		var acmeTLSConfig *tls.Config
+		if conf.TLS != nil && conf.TLS.ACME != nil {
+			acmeTLSConfig, err = acmeServerTLSConfig(*conf.TLS.ACME, conf.Host)
+			if err != nil {
+				log.FailureStatusEvent(os.Stdout, err.Error())
+				return
+			}
+			options = append(options, yomo.WithZipperTLSConfig(acmeTLSConfig))
+		}
+		// handle the data frames by the worker pool
+		if conf.FrameWorkers != nil {
+			workers, queueSize := conf.FrameWorkers.Workers, conf.FrameWorkers.QueueSize
+			if workers == 0 {
+				workers = runtime.NumCPU()
+			}
+			if queueSize == 0 {
+				queueSize = 1024
+			}
+			options = append(options, yomo.WithZipperFrameWorkers(workers, queueSize))
+		}
+		// ask the clients to reconnect once their connections are too old
+		if conf.Drain != nil && conf.Drain.MaxConnectionAge > 0 {
+			grace := conf.Drain.Grace
+			if grace == 0 {
+				grace = 30 * time.Second
+			}
+			options = append(options, yomo.WithZipperMaxConnectionAge(conf.Drain.MaxConnectionAge, grace))
+		}
+		// suppress the duplicate data frames
+		if conf.Dedup != nil {
+			options = append(options, yomo.WithZipperDedup(dedup.New(conf.Name, *conf.Dedup)))
+		}
+		// verify the signed data frames
+		if conf.Signature != nil {
+			verifier, err := signature.NewVerifier(*conf.Signature)
+			if err != nil {
+				log.FailureStatusEvent(os.Stdout, err.Error())
+				return
+			}
+			options = append(options, yomo.WithZipperVerifier(verifier))
+		}
+		// notify the connection and registration events to the webhooks
+		if conf.Webhook != nil {
+			webhook.SetDefault(webhook.New(*conf.Webhook, ylog.Default()))
+		}
 		// check llm bridge server config
 		// parse the llm bridge config
 		bridgeConf := conf.Bridge
@@ -78,6 +158,22 @@ var serveCmd = &cobra.Command{
 		if aiConfig != nil {
 			// add AI connection middleware
 			options = append(options, yomo.WithZipperConnMiddleware(ai.ConnMiddleware))
+			// audit the ai function inventory changes
+			if aiConfig.Server.Audit != nil {
+				ai.SetAuditor(ai.NewAuditor(*aiConfig.Server.Audit))
+			}
+			// serve the bridge over https with the acme certificates
+			if acmeTLSConfig != nil {
+				aiConfig.Server.TLSConfig = acmeTLSConfig.Clone()
+				aiConfig.Server.TLSConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+			} else if aiConfig.Server.TLS {
+				// or the certificate of the zipper, which is rotated when the files are changed
+				aiConfig.Server.TLSConfig, err = pkgtls.CreateHTTPServerTLSConfig(conf.Host)
+				if err != nil {
+					log.FailureStatusEvent(os.Stdout, err.Error())
+					return
+				}
+			}
 		}
 		// new zipper
 		zipper, err := yomo.NewZipper(
@@ -88,12 +184,19 @@ var serveCmd = &cobra.Command{
 			log.FailureStatusEvent(os.Stdout, err.Error())
 			return
 		}
-		zipper.Logger().Info("using config file", "file_path", config)
+		zipper.Logger().Info("using config", "source", source.String())
+
+		// watch the config, the mesh changes are applied without restarting the zipper, the downstreams
+		// are connected by the same options as the zipper, eg: the tls, the auth and the signing.
+		go watchConfig(ctx, source, zipper, conf, options...)
 
 		// AI Server
 		if aiConfig != nil {
 			// register the llm provider
-			registerAIProvider(aiConfig)
+			if err := registerAIProvider(ctx, aiConfig); err != nil {
+				log.FailureStatusEvent(os.Stdout, err.Error())
+				return
+			}
 			// start the llm api server
 			go func() {
 				err := ai.Serve(aiConfig, listenAddr, fmt.Sprintf("token:%s", tokenString))
@@ -113,35 +216,60 @@ var serveCmd = &cobra.Command{
 	},
 }
 
-func registerAIProvider(aiConfig *ai.Config) error {
+// acmeServerTLSConfig starts the acme HTTP-01 challenge server, and returns the tls config of the certificates
+// obtained and renewed by acme.
+func acmeServerTLSConfig(conf pkgtls.ACMEConfig, host string) (*tls.Config, error) {
+	m, err := pkgtls.NewACMEManager(conf)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := pkgtls.ServeACMEChallenge(m, conf.HTTPAddr); err != nil {
+			log.FailureStatusEvent(os.Stdout, "acme challenge server: %s", err.Error())
+		}
+	}()
+	ylog.Info("obtain certificates by acme", "domains", conf.Domains, "challenge_addr", conf.HTTPAddr)
+
+	return pkgtls.CreateACMEServerTLSConfig(m, host)
+}
+
+func watchConfig(ctx context.Context, source pkgconfig.Source, zipper yomo.Zipper, conf pkgconfig.Config, options ...yomo.ZipperOption) {
+	pkgconfig.WatchConfig(ctx, source, func(newConf pkgconfig.Config) {
+		zipper.Logger().Info("config is changed", "source", source.String())
+
+		if err := yomo.UpdateZipperMesh(zipper, conf.Mesh, newConf.Mesh, options...); err != nil {
+			zipper.Logger().Error("failed to update the mesh", "err", err)
+		} else {
+			conf.Mesh = newConf.Mesh
+		}
+		if restartRequired(conf, newConf) {
+			zipper.Logger().Warn("the changes except the mesh take effect after the zipper is restarted")
+		}
+	})
+}
+
+// restartRequired reports whether the config is changed except the mesh.
+func restartRequired(conf, newConf pkgconfig.Config) bool {
+	conf.Mesh, newConf.Mesh = nil, nil
+	return !reflect.DeepEqual(conf, newConf)
+}
+
+func registerAIProvider(ctx context.Context, aiConfig *ai.Config) error {
 	for name, provider := range aiConfig.Providers {
-		switch name {
-		case "azopenai":
-			ai.RegisterProvider(azopenai.NewProvider(
-				provider["api_key"],
-				provider["api_endpoint"],
-				provider["deployment_id"],
-				provider["api_version"],
-			))
-		case "openai":
-			ai.RegisterProvider(openai.NewProvider(provider["api_key"], provider["model"]))
-		case "cloudflare_azure":
-			ai.RegisterProvider(cfazure.NewProvider(
-				provider["endpoint"],
-				provider["api_key"],
-				provider["resource"],
-				provider["deployment_id"],
-				provider["api_version"],
-			))
-		case "cloudflare_openai":
-			ai.RegisterProvider(cfopenai.NewProvider(
-				provider["endpoint"],
-				provider["api_key"],
-				provider["model"],
-			))
-		default:
+		// the api keys may reference the secrets, which are refreshed periodically.
+		p, err := ai.NewSecretProvider(ctx, provider, aiConfig.Server.SecretRefresh, func(conf ai.Provider) ai.LLMProvider {
+			return ai.NewKeyPoolProvider(conf, func(conf ai.Provider) ai.LLMProvider {
+				return newAIProvider(ctx, name, conf)
+			})
+		})
+		if err != nil {
+			return err
+		}
+		if p == nil {
 			log.WarningStatusEvent(os.Stdout, "unknown provider: %s", name)
+			continue
 		}
+		ai.RegisterProvider(ai.NewToolEmulationProvider(provider, p))
 	}
 
 	// log.InfoStatusEvent(os.Stdout, "registered [%d] AI provider", len(ai.ListProviders()))
@@ -149,8 +277,56 @@ func registerAIProvider(aiConfig *ai.Config) error {
 	return nil
 }
 
+func newAIProvider(ctx context.Context, name string, provider ai.Provider) ai.LLMProvider {
+	switch name {
+	case "azopenai":
+		return azopenai.NewProvider(
+			provider["api_key"],
+			provider["api_endpoint"],
+			provider["deployment_id"],
+			provider["api_version"],
+		)
+	case "openai":
+		return openai.NewProvider(provider["api_key"], provider["model"])
+	case "cloudflare_azure":
+		return cfazure.NewProvider(
+			provider["endpoint"],
+			provider["api_key"],
+			provider["resource"],
+			provider["deployment_id"],
+			provider["api_version"],
+		)
+	case "cloudflare_openai":
+		return cfopenai.NewProvider(
+			provider["endpoint"],
+			provider["api_key"],
+			provider["model"],
+		)
+	case "compat":
+		return compat.NewProvider(
+			ctx,
+			provider["base_url"],
+			provider["api_key"],
+			provider["model"],
+			provider["health_interval"],
+			provider["inline_images"],
+		)
+	case "localllm":
+		return localllm.NewProvider(
+			ctx,
+			provider["endpoint"],
+			provider["model_path"],
+			provider["context_size"],
+			provider["gpu_layers"],
+			provider["server_path"],
+		)
+	default:
+		return nil
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(serveCmd)
 
-	serveCmd.Flags().StringVarP(&config, "config", "c", "", "config file")
+	serveCmd.Flags().StringVarP(&config, "config", "c", "", "config file, or the config source, eg: etcd://127.0.0.1:2379/yomo/zipper, consul://127.0.0.1:8500/yomo/zipper")
 }
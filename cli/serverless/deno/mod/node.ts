@@ -0,0 +1,156 @@
+// The runtime-agnostic yomo serverless module, it only depends on the node
+// compatible APIs, so the sfn can run under Deno, Bun or Node.
+import { Buffer } from "node:buffer";
+import { readFileSync } from "node:fs";
+import { connect, Socket } from "node:net";
+import process from "node:process";
+
+export class Context {
+  tag: number;
+  input: Uint8Array;
+  private conn: Socket;
+
+  constructor(tag: number, input: Uint8Array, conn: Socket) {
+    this.tag = tag;
+    this.input = input;
+    this.conn = conn;
+  }
+
+  async write(tag: number, data: Uint8Array) {
+    await writeBytes(this.conn, numberToBytes(tag));
+    await writeData(this.conn, data);
+  }
+}
+
+function numberToBytes(val: number): Uint8Array {
+  const buf = Buffer.alloc(4);
+  buf.writeUInt32LE(val);
+  return buf;
+}
+
+function writeBytes(conn: Socket, data: Uint8Array): Promise<void> {
+  return new Promise((resolve, reject) => {
+    conn.write(data, (err?: Error | null) => err ? reject(err) : resolve());
+  });
+}
+
+async function writeData(conn: Socket, data: Uint8Array) {
+  await writeBytes(conn, numberToBytes(data.length));
+  await writeBytes(conn, data);
+}
+
+// Reader buffers the data of the socket, and reads exactly n bytes.
+class Reader {
+  private chunks: Buffer[] = [];
+  private size = 0;
+  private ended = false;
+  private wake: (() => void) | null = null;
+
+  constructor(conn: Socket) {
+    conn.on("data", (chunk: Buffer) => {
+      this.chunks.push(chunk);
+      this.size += chunk.length;
+      this.notify();
+    });
+    conn.on("end", () => {
+      this.ended = true;
+      this.notify();
+    });
+    conn.on("error", () => {
+      this.ended = true;
+      this.notify();
+    });
+  }
+
+  private notify() {
+    const wake = this.wake;
+    this.wake = null;
+    wake?.();
+  }
+
+  async read(n: number): Promise<Buffer | null> {
+    while (this.size < n) {
+      if (this.ended) {
+        return null;
+      }
+      await new Promise<void>((resolve) => this.wake = resolve);
+    }
+    const buf = Buffer.concat(this.chunks);
+    this.chunks = [buf.subarray(n)];
+    this.size -= n;
+    return buf.subarray(0, n);
+  }
+
+  async readNumber(): Promise<number | null> {
+    const buf = await this.read(4);
+    return buf == null ? null : buf.readUInt32LE();
+  }
+
+  async readData(): Promise<Uint8Array | null> {
+    const length = await this.readNumber();
+    if (length == null) {
+      return null;
+    }
+    return await this.read(length);
+  }
+}
+
+// loadEnv exports the variables in the env file to process.env.
+function loadEnv(path: string) {
+  for (const line of readFileSync(path, "utf8").split(/\r?\n/)) {
+    const trimmed = line.trim();
+    if (trimmed === "" || trimmed.startsWith("#")) {
+      continue;
+    }
+    const i = trimmed.indexOf("=");
+    if (i <= 0) {
+      continue;
+    }
+    const key = trimmed.slice(0, i).trim();
+    const value = trimmed.slice(i + 1).trim().replace(/^(['"])(.*)\1$/, "$2");
+    process.env[key] = value;
+  }
+}
+
+export async function run(
+  observed: number[],
+  handler: (ctx: Context) => Promise<void>,
+) {
+  const args = process.argv.slice(2);
+  const sock = args.length > 0 ? args[0] : "./sfn.sock";
+  if (args.length > 1) {
+    loadEnv(args[1]);
+  }
+
+  const conn = connect(sock);
+  await new Promise<void>((resolve, reject) => {
+    conn.once("connect", resolve);
+    conn.once("error", reject);
+  });
+  const reader = new Reader(conn);
+
+  await writeBytes(conn, numberToBytes(observed.length));
+  for (const tag of observed) {
+    await writeBytes(conn, numberToBytes(tag));
+  }
+
+  for (;;) {
+    const tag = await reader.readNumber();
+    if (tag == null) {
+      break;
+    }
+
+    const data = await reader.readData();
+    if (data == null) {
+      break;
+    }
+
+    const ctx = new Context(tag, data, conn);
+    await handler(ctx);
+
+    await writeBytes(conn, numberToBytes(0)); // tag
+    await writeBytes(conn, numberToBytes(0)); // length
+  }
+
+  conn.end();
+}
@@ -4,6 +4,7 @@ package deno
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -65,8 +66,43 @@ func accept(listener *net.UnixListener) ([]frame.Tag, *net.UnixConn, error) {
 	return observed, conn, nil
 }
 
-func runDeno(jsPath string, socketPath string, errCh chan<- error) {
-	cmd := exec.Command(
+// Supported js/ts runtimes, all of them execute typescript natively.
+const (
+	RuntimeDeno = "deno"
+	RuntimeBun  = "bun"
+	// RuntimeNode detects the installed runtime, deno is preferred.
+	RuntimeNode = "node"
+)
+
+// lookRuntime returns the js/ts runtime to execute the sfn, an empty runtime is the same as node.
+func lookRuntime(runtime string) (string, error) {
+	switch runtime {
+	case "", RuntimeNode:
+		for _, r := range []string{RuntimeDeno, RuntimeBun} {
+			if _, err := exec.LookPath(r); err == nil {
+				return r, nil
+			}
+		}
+		return "", errors.New("[deno] neither deno nor bun was found. For details, visit https://deno.land or https://bun.sh")
+	case RuntimeDeno:
+		if _, err := exec.LookPath("deno"); err != nil {
+			return "", errors.New("[deno] command was not found. For details, visit https://deno.land")
+		}
+	case RuntimeBun:
+		if _, err := exec.LookPath("bun"); err != nil {
+			return "", errors.New("[bun] command was not found. For details, visit https://bun.sh")
+		}
+	default:
+		return "", fmt.Errorf("invalid js runtime: %s, deno, bun and node are supported", runtime)
+	}
+	return runtime, nil
+}
+
+func runtimeCommand(runtime string, jsPath string, socketPath string) *exec.Cmd {
+	if runtime == RuntimeBun {
+		return exec.Command("bun", "run", jsPath, socketPath)
+	}
+	return exec.Command(
 		"deno",
 		"run",
 		"--unstable",
@@ -77,6 +113,10 @@ func runDeno(jsPath string, socketPath string, errCh chan<- error) {
 		jsPath,
 		socketPath,
 	)
+}
+
+func runJS(runtime string, jsPath string, socketPath string, errCh chan<- error) {
+	cmd := runtimeCommand(runtime, jsPath, socketPath)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -167,9 +207,10 @@ func startSfn(name string, zipperAddr string, credential string, observed []fram
 	return sfn, nil
 }
 
-func run(name string, zipperAddr string, credential string, jsPath string, socketPath string) error {
-	if _, err := exec.LookPath("deno"); err != nil {
-		return errors.New("[deno] command was not found. For details, visit https://deno.land")
+func run(name string, zipperAddr string, credential string, runtime string, jsPath string, socketPath string) error {
+	runtime, err := lookRuntime(runtime)
+	if err != nil {
+		return err
 	}
 
 	errCh := make(chan error)
@@ -179,7 +220,7 @@ func run(name string, zipperAddr string, credential string, jsPath string, socke
 		return err
 	}
 
-	go runDeno(jsPath, socketPath, errCh)
+	go runJS(runtime, jsPath, socketPath, errCh)
 
 	observed, conn, err := accept(listener)
 	if err != nil {
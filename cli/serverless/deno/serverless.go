@@ -5,12 +5,13 @@ import (
 	"github.com/yomorun/yomo/cli/serverless"
 )
 
-// denoServerless will start deno program to run serverless functions.
+// denoServerless will start deno or bun program to run serverless functions.
 type denoServerless struct {
 	name       string
 	fileName   string
 	zipperAddr string
 	credential string
+	runtime    string
 }
 
 // Init initializes the serverless
@@ -19,6 +20,7 @@ func (s *denoServerless) Init(opts *serverless.Options) error {
 	s.fileName = opts.Filename
 	s.zipperAddr = opts.ZipperAddr
 	s.credential = opts.Credential
+	s.runtime = opts.Runtime
 	return nil
 }
 
@@ -27,9 +29,9 @@ func (s *denoServerless) Build(clean bool) error {
 	return nil
 }
 
-// Run the wasm serverless function
+// Run the js/ts serverless function with deno or bun
 func (s *denoServerless) Run(verbose bool) error {
-	return run(s.name, s.zipperAddr, s.credential, s.fileName, "./"+s.name+".sock")
+	return run(s.name, s.zipperAddr, s.credential, s.runtime, s.fileName, "./"+s.name+".sock")
 }
 
 // Executable shows whether the program needs to be built
@@ -52,9 +52,15 @@ func (s *GolangServerless) Init(opts *serverless.Options) error {
 		ZipperAddr:       s.opts.ZipperAddr,
 		Credential:       s.opts.Credential,
 		WithInitFunc:     opt.WithInit,
+		WithCloseFunc:    opt.WithClose,
 		WithWantedTarget: opt.WithWantedTarget,
 		WithDescription:  opt.WithDescription,
 		WithInputSchema:  opt.WithInputSchema,
+		WithVersion:      opt.WithVersion,
+		WithAliases:      opt.WithAliases,
+		WithDescriptions: opt.WithDescriptions,
+		WithCallPolicy:   opt.WithCallPolicy,
+		WithMiddlewares:  opt.WithMiddlewares,
 	}
 
 	// determine: rx stream serverless or raw bytes serverless.
@@ -266,9 +272,15 @@ func generateCode(fset *token.FileSet, file *ast.File) ([]byte, error) {
 
 type AppOpts struct {
 	WithInit         bool
+	WithClose        bool
 	WithWantedTarget bool
 	WithDescription  bool
 	WithInputSchema  bool
+	WithVersion      bool
+	WithAliases      bool
+	WithDescriptions bool
+	WithCallPolicy   bool
+	WithMiddlewares  bool
 }
 
 // ParseSrc parse app option from source code to run serverless
@@ -286,12 +298,24 @@ func ParseSrc(appFile string) (*AppOpts, error) {
 			switch d.Name.String() {
 			case "Init":
 				opts.WithInit = true
+			case "Close":
+				opts.WithClose = true
 			case "Description":
 				opts.WithDescription = true
 			case "InputSchema":
 				opts.WithInputSchema = true
 			case "WantedTarget":
 				opts.WithWantedTarget = true
+			case "Version":
+				opts.WithVersion = true
+			case "Aliases":
+				opts.WithAliases = true
+			case "Descriptions":
+				opts.WithDescriptions = true
+			case "CallPolicy":
+				opts.WithCallPolicy = true
+			case "Middlewares":
+				opts.WithMiddlewares = true
 			}
 		}
 	}
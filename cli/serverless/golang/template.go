@@ -38,12 +38,24 @@ type Context struct {
 	Credential string
 	// WithInitFunc determines whether to work with init function
 	WithInitFunc bool
+	// WithCloseFunc determines whether to work with close function
+	WithCloseFunc bool
 	// WithWantedTarget determines whether to work with SetWantedTarget
 	WithWantedTarget bool
 	// WithDescription determines whether to work with description
 	WithDescription bool
 	// WithInputSchema determines whether to work with input schema
 	WithInputSchema bool
+	// WithVersion determines whether to work with the version of the ai function
+	WithVersion bool
+	// WithAliases determines whether to work with the aliases of the ai function
+	WithAliases bool
+	// WithDescriptions determines whether to work with the localized descriptions of the ai function
+	WithDescriptions bool
+	// WithCallPolicy determines whether to work with the call policy of the ai function
+	WithCallPolicy bool
+	// WithMiddlewares determines whether to wrap the handler with the tool middlewares
+	WithMiddlewares bool
 }
 
 // RenderTmpl renders the template with the given context
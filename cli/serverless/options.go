@@ -1,5 +1,7 @@
 package serverless
 
+import "time"
+
 // Options describles the command arguments of serverless.
 type Options struct {
 	// Filename is the path to the serverless file.
@@ -14,6 +16,24 @@ type Options struct {
 	Credential string
 	// Runtime specifies the serverless runtime environment type
 	Runtime string
+	// Config is the path to the config file, the tracing config in it is applied to the sfn
+	Config string
 	// WASI build with WASI target
 	WASI bool
+	// WasmCompilationMode is the compilation mode of the wasm runtime, `compiler` or `interpreter`
+	WasmCompilationMode string
+	// WasmCacheDir is the directory to cache the compiled wasm modules
+	WasmCacheDir string
+	// WasmNoCache disables caching the compiled wasm modules on disk
+	WasmNoCache bool
+	// WasmMemoryLimit is the maximum linear memory of the wasm sfn in MiB
+	WasmMemoryLimit uint32
+	// WasmTimeout is the maximum execution time of one wasm sfn invocation
+	WasmTimeout time.Duration
+	// WasmFuel is the maximum fuel that one wasm sfn invocation can consume
+	WasmFuel uint64
+	// WasmWatch reloads the wasm sfn when the wasm file is changed
+	WasmWatch bool
+	// WasmReloadAddr is the address of the http endpoint reloading the wasm sfn, empty means disabled
+	WasmReloadAddr string
 }
@@ -0,0 +1,16 @@
+// Package rust provides the templates of the rust wasm serverless
+package rust
+
+import (
+	_ "embed"
+)
+
+// CargoTmpl the Cargo.toml template of the rust serverless
+//
+//go:embed templates/Cargo.toml.tmpl
+var CargoTmpl []byte
+
+// LibTmpl the src/lib.rs template of the rust serverless
+//
+//go:embed templates/lib.rs.tmpl
+var LibTmpl []byte
@@ -0,0 +1,28 @@
+package wasm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCacheDir returns the default directory to cache the compiled wasm modules, it is
+// `$YOMO_WASM_CACHE_DIR` if set, otherwise `yomo/wasm` in the user cache directory.
+func DefaultCacheDir() string {
+	if dir := os.Getenv("YOMO_WASM_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "yomo", "wasm")
+}
+
+// moduleHash returns the sha256 hex of the wasm module, it is the key of the compiled artifact
+// in the cache, so a changed module is always recompiled.
+func moduleHash(wasmBytes []byte) string {
+	sum := sha256.Sum256(wasmBytes)
+	return hex.EncodeToString(sum[:])
+}
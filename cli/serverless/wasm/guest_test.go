@@ -0,0 +1,250 @@
+package wasm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/serverless"
+)
+
+// the wasm opcodes used by the test guests.
+const (
+	opUnreachable = 0x00
+	opLoop        = 0x03
+	opIf          = 0x04
+	opElse        = 0x05
+	opEnd         = 0x0B
+	opBr          = 0x0C
+	opCall        = 0x10
+	opDrop        = 0x1A
+	opI32Load     = 0x28
+	opI32Store    = 0x36
+	opMemoryGrow  = 0x40
+	opI32Const    = 0x41
+	opI32Eqz      = 0x45
+	opI32Eq       = 0x46
+	blockVoid     = 0x40
+	valueI32      = 0x7F
+)
+
+// the host functions imported by the test guests, the functions of the guest are indexed after them.
+const (
+	funcObserveDataTag = iota
+	funcEmitAfter
+	funcEmitEvery
+	funcCancelTimer
+	funcWrite
+)
+
+// guest describes a wasm sfn for the tests, the functions are the bodies of the exported functions
+// without the end opcode, yomo_init returns 0 if its body is empty.
+type guest struct {
+	tag      uint32
+	memory   uint32 // the initial pages of the memory
+	data     string // the data at the offset 0 of the memory
+	init     []byte
+	handler  []byte
+	closeFns []byte
+}
+
+// i32Const returns the instruction pushing the i32 constant.
+func i32Const(v int32) []byte {
+	return append([]byte{opI32Const}, sleb(v)...)
+}
+
+// call returns the instruction calling the function.
+func call(fn uint32) []byte {
+	return append([]byte{opCall}, uleb(fn)...)
+}
+
+// instrs concatenates the instructions.
+func instrs(ins ...[]byte) []byte {
+	var b []byte
+	for _, in := range ins {
+		b = append(b, in...)
+	}
+	return b
+}
+
+// emitCall returns the instructions calling yomo_emit_after or yomo_emit_every with the data of the guest,
+// the timer id is left on the stack.
+func emitCall(fn uint32, ms int32, tag uint32, length int32) []byte {
+	return instrs(i32Const(ms), i32Const(int32(tag)), i32Const(0), i32Const(length), call(fn))
+}
+
+// write writes the guest to a wasm file in the temp dir, and returns the path of the file.
+func (g guest) write(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sfn.wasm")
+	if err := os.WriteFile(path, g.bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// bytes encodes the guest in the wasm binary format.
+func (g guest) bytes() []byte {
+	memory := g.memory
+	if memory == 0 {
+		memory = 1
+	}
+	init := g.init
+	if len(init) == 0 {
+		init = i32Const(0)
+	}
+
+	types := vec(
+		functype([]byte{valueI32}, nil),                                            // 0: (i32) -> ()
+		functype([]byte{valueI32, valueI32, valueI32, valueI32}, []byte{valueI32}), // 1: (i32, i32, i32, i32) -> i32
+		functype([]byte{valueI32}, []byte{valueI32}),                               // 2: (i32) -> i32
+		functype(nil, nil),              // 3: () -> ()
+		functype(nil, []byte{valueI32}), // 4: () -> i32
+		functype([]byte{valueI32, valueI32, valueI32}, []byte{valueI32}), // 5: (i32, i32, i32) -> i32
+	)
+	imports := vec(
+		importFunc(WasmFuncObserveDataTag, 0),
+		importFunc(WasmFuncEmitAfter, 1),
+		importFunc(WasmFuncEmitEvery, 1),
+		importFunc(WasmFuncCancelTimer, 2),
+		importFunc(WasmFuncWrite, 5),
+	)
+	exports := []struct {
+		name string
+		typ  uint32
+		body []byte
+	}{
+		{WasmFuncObserveDataTags, 3, instrs(i32Const(int32(g.tag)), call(funcObserveDataTag))},
+		{WasmFuncWantedTarget, 3, nil},
+		{WasmFuncInit, 4, init},
+		{WasmFuncHandler, 3, g.handler},
+		{WasmFuncClose, 3, g.closeFns},
+	}
+	var (
+		funcs    [][]byte
+		codes    [][]byte
+		exported [][]byte
+	)
+	for i, fn := range exports {
+		funcs = append(funcs, uleb(fn.typ))
+		body := append([]byte{0x00}, fn.body...) // no locals
+		body = append(body, opEnd)
+		codes = append(codes, append(uleb(uint32(len(body))), body...))
+		exported = append(exported, append(name(fn.name), append([]byte{0x00}, uleb(uint32(funcWrite+1+i))...)...))
+	}
+	exported = append(exported, append(name("memory"), 0x02, 0x00))
+
+	module := []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}
+	module = append(module, section(1, types)...)
+	module = append(module, section(2, imports)...)
+	module = append(module, section(3, vec(funcs...))...)
+	module = append(module, section(5, vec(append([]byte{0x00}, uleb(memory)...)))...)
+	module = append(module, section(7, vec(exported...))...)
+	module = append(module, section(10, vec(codes...))...)
+	if g.data != "" {
+		segment := instrs([]byte{0x00}, i32Const(0), []byte{opEnd}, uleb(uint32(len(g.data))), []byte(g.data))
+		module = append(module, section(11, vec(segment))...)
+	}
+	return module
+}
+
+func functype(params, results []byte) []byte {
+	b := append([]byte{0x60}, uleb(uint32(len(params)))...)
+	b = append(b, params...)
+	b = append(b, uleb(uint32(len(results)))...)
+	return append(b, results...)
+}
+
+func importFunc(field string, typ uint32) []byte {
+	b := append(name("env"), name(field)...)
+	return append(append(b, 0x00), uleb(typ)...)
+}
+
+func name(s string) []byte {
+	return append(uleb(uint32(len(s))), s...)
+}
+
+func vec(items ...[]byte) []byte {
+	b := uleb(uint32(len(items)))
+	for _, item := range items {
+		b = append(b, item...)
+	}
+	return b
+}
+
+func section(id byte, content []byte) []byte {
+	return append(append([]byte{id}, uleb(uint32(len(content)))...), content...)
+}
+
+func uleb(v uint32) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+		if v == 0 {
+			return b
+		}
+	}
+}
+
+func sleb(v int32) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7F)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// testContext is the serverless context of the invocations in the tests, the methods not used by the
+// tests are not implemented. ai.MockContext is not used because its http interface is only linked in wasm.
+type testContext struct {
+	serverless.Context
+	tag    uint32
+	data   []byte
+	fnCall *ai.FunctionCall
+
+	mu      sync.Mutex
+	written []emitted
+}
+
+func newTestContext(tag uint32, data string) *testContext {
+	return &testContext{tag: tag, data: []byte(data)}
+}
+
+func (c *testContext) Tag() uint32 { return c.tag }
+
+func (c *testContext) Data() []byte { return c.data }
+
+func (c *testContext) Metadata(string) (string, bool) { return "", false }
+
+func (c *testContext) Write(tag uint32, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, emitted{tag: tag, data: string(data)})
+	return nil
+}
+
+func (c *testContext) ReadLLMFunctionCall(fnCall any) error {
+	if c.fnCall == nil {
+		return errors.New("not a llm function call")
+	}
+	*fnCall.(*ai.FunctionCall) = *c.fnCall
+	return nil
+}
+
+func (c *testContext) recordsWritten() []emitted {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.written
+}
@@ -0,0 +1,166 @@
+// Package wasm provides WebAssembly serverless function runtimes.
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	pkglog "github.com/yomorun/yomo/pkg/log"
+)
+
+// reloadDelay debounces the file events, the wasm file is usually written in several steps.
+const reloadDelay = 200 * time.Millisecond
+
+var errReloadClosed = errors.New("the sfn has been closed")
+
+// reload loads the wasm file into a new runtime, and swaps the running runtime between invocations,
+// the zipper connection is kept. The observed datatags and wanted target can not be changed
+// by reloading, because they have been registered to the zipper. It's a no-op once the sfn is closed.
+func (s *wasmServerless) reload() error {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return errReloadClosed
+	}
+
+	runtime, err := NewRuntime(s.runtimeType, s.runtimeOpts)
+	if err != nil {
+		return err
+	}
+	if err := runtime.Init(s.filename); err != nil {
+		runtime.Close()
+		return err
+	}
+	if !slices.Equal(runtime.GetObserveDataTags(), s.observed) || runtime.GetWantedTarget() != s.wantedTarget {
+		runtime.Close()
+		return errors.New("observed datatags or wanted target changed, restart the sfn to apply")
+	}
+	if err := runtime.RunInit(); err != nil {
+		runtime.Close()
+		return err
+	}
+
+	s.mu.Lock()
+	// the sfn may be closed while the new runtime was loading
+	if s.closed {
+		s.mu.Unlock()
+		runtime.Close()
+		return errReloadClosed
+	}
+	old := s.runtime
+	s.runtime = runtime
+	s.mu.Unlock()
+
+	return old.Close()
+}
+
+// close closes the running runtime, the sfn can not be reloaded after closing.
+func (s *wasmServerless) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.runtime.Close()
+}
+
+func (s *wasmServerless) reloadAndLog() {
+	if err := s.reload(); err != nil {
+		pkglog.FailureStatusEvent(os.Stderr, "Reload %s failed: %v", s.filename, err)
+		return
+	}
+	pkglog.SuccessStatusEvent(os.Stdout, "Reloaded %s", s.filename)
+}
+
+// watch reloads the wasm file when it is changed, it returns a function to stop watching.
+func (s *wasmServerless) watch() (func() error, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// watch the directory, the file may be replaced by renaming.
+	if err := watcher.Add(filepath.Dir(s.filename)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	name := filepath.Clean(s.filename)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var timer *time.Timer
+		// the pending reload is dropped when stopping watching
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != name || !event.Has(fsnotify.Write|fsnotify.Create) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDelay, s.reloadAndLog)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				pkglog.WarningStatusEvent(os.Stdout, "Watch %s: %v", s.filename, err)
+			}
+		}
+	}()
+
+	return func() error {
+		err := watcher.Close()
+		<-done
+		return err
+	}, nil
+}
+
+// serveReload serves the http endpoint reloading the wasm sfn on addr:
+// - `POST /reload` reloads the wasm file, it responds with the error if reloading fails
+// It returns a function to stop serving.
+func (s *wasmServerless) serveReload(addr string) (func() error, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reload", s.handleReload)
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+
+	pkglog.InfoStatusEvent(os.Stdout, "Reload %s by POST http://%s/reload", s.filename, listener.Addr())
+	return server.Close, nil
+}
+
+func (s *wasmServerless) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if err := s.reload(); err != nil {
+		pkglog.FailureStatusEvent(os.Stderr, "Reload %s failed: %v", s.filename, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	pkglog.SuccessStatusEvent(os.Stdout, "Reloaded %s", s.filename)
+	w.WriteHeader(http.StatusOK)
+}
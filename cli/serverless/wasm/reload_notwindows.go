@@ -0,0 +1,28 @@
+//go:build !windows
+// +build !windows
+
+// Package wasm provides WebAssembly serverless function runtimes.
+package wasm
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// reloadOnSignal reloads the wasm file when receiving SIGHUP:
+// - `kill -SIGHUP <pid>` reload the wasm file
+// It returns a function to stop listening.
+func (s *wasmServerless) reloadOnSignal() func() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for range c {
+			s.reloadAndLog()
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(c)
+	}
+}
@@ -0,0 +1,152 @@
+package wasm
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	cli "github.com/yomorun/yomo/cli/serverless"
+)
+
+// versionGuest observes the tag, and writes the version to tag 0x22 in the handler.
+func versionGuest(tag uint32, version string) guest {
+	return guest{
+		tag:  tag,
+		data: version,
+		handler: instrs(
+			i32Const(0x22), i32Const(0), i32Const(int32(len(version))), call(funcWrite), []byte{opDrop},
+		),
+	}
+}
+
+func newReloadServerless(t *testing.T) (*wasmServerless, string) {
+	t.Helper()
+	filename := versionGuest(0x11, "v1").write(t)
+
+	s := &wasmServerless{}
+	require.NoError(t, s.Init(&cli.Options{Filename: filename, Name: "sfn", WasmNoCache: true}))
+	t.Cleanup(func() { s.close() })
+	return s, filename
+}
+
+func writeGuest(t *testing.T, filename string, g guest) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filename, g.bytes(), 0o644))
+}
+
+// runningVersion returns the version written by the running wasm sfn.
+func runningVersion(t *testing.T, s *wasmServerless) string {
+	t.Helper()
+	ctx := newTestContext(0x11, "data")
+	s.handle(ctx)
+
+	written := ctx.recordsWritten()
+	require.Len(t, written, 1)
+	return written[0].data
+}
+
+func TestReload(t *testing.T) {
+	s, filename := newReloadServerless(t)
+	assert.Equal(t, "v1", runningVersion(t, s))
+
+	t.Run("reload", func(t *testing.T) {
+		writeGuest(t, filename, versionGuest(0x11, "v2"))
+
+		require.NoError(t, s.reload())
+		assert.Equal(t, "v2", runningVersion(t, s))
+	})
+
+	t.Run("datatags changed", func(t *testing.T) {
+		writeGuest(t, filename, versionGuest(0x12, "v3"))
+
+		err := s.reload()
+		assert.EqualError(t, err, "observed datatags or wanted target changed, restart the sfn to apply")
+		assert.Equal(t, "v2", runningVersion(t, s))
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		writeGuest(t, filename, versionGuest(0x11, "v4"))
+		require.NoError(t, s.close())
+
+		assert.ErrorIs(t, s.reload(), errReloadClosed)
+	})
+}
+
+func TestHandleReload(t *testing.T) {
+	s, filename := newReloadServerless(t)
+
+	reload := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleReload(w, httptest.NewRequest(method, "/reload", nil))
+		return w
+	}
+
+	t.Run("method not allowed", func(t *testing.T) {
+		w := reload(http.MethodGet)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		writeGuest(t, filename, versionGuest(0x11, "v2"))
+
+		w := reload(http.MethodPost)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "v2", runningVersion(t, s))
+	})
+
+	t.Run("reload failed", func(t *testing.T) {
+		writeGuest(t, filename, versionGuest(0x12, "v3"))
+
+		w := reload(http.MethodPost)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Contains(t, w.Body.String(), "observed datatags or wanted target changed")
+		assert.Equal(t, "v2", runningVersion(t, s))
+	})
+}
+
+func TestServeReload(t *testing.T) {
+	s, filename := newReloadServerless(t)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+
+	_, err = s.serveReload(addr)
+	assert.Error(t, err, "the address is in use")
+	listener.Close()
+
+	stop, err := s.serveReload(addr)
+	require.NoError(t, err)
+	defer stop()
+
+	writeGuest(t, filename, versionGuest(0x11, "v2"))
+	resp, err := http.Post("http://"+addr+"/reload", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "v2", runningVersion(t, s))
+}
+
+func TestWatch(t *testing.T) {
+	s, filename := newReloadServerless(t)
+
+	stop, err := s.watch()
+	require.NoError(t, err)
+
+	writeGuest(t, filename, versionGuest(0x11, "v2"))
+	assert.Eventually(t, func() bool {
+		return runningVersion(t, s) == "v2"
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// the pending reload is dropped when stopping watching
+	writeGuest(t, filename, versionGuest(0x11, "v3"))
+	time.Sleep(reloadDelay / 4)
+	require.NoError(t, stop())
+	time.Sleep(2 * reloadDelay)
+	assert.Equal(t, "v2", runningVersion(t, s))
+}
@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+// Package wasm provides WebAssembly serverless function runtimes.
+package wasm
+
+// reloadOnSignal is not supported on windows, use the file watch instead.
+func (s *wasmServerless) reloadOnSignal() func() {
+	return func() {}
+}
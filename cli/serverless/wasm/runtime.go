@@ -2,7 +2,12 @@
 package wasm
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/yomorun/yomo/serverless"
 )
@@ -11,6 +16,7 @@ import (
 const (
 	WasmFuncStart = "_start"
 	WasmFuncInit  = "yomo_init"
+	WasmFuncClose = "yomo_close"
 	// WasmFuncObserveDataTags guest module should implement this function
 	WasmFuncObserveDataTags = "yomo_observe_datatags"
 	// WasmFuncObserveDataTag host module should implement this function
@@ -23,6 +29,13 @@ const (
 	WasmFuncContextTag      = "yomo_context_tag"
 	WasmFuncContextData     = "yomo_context_data"
 	WasmFuncContextDataSize = "yomo_context_data_size"
+	// WasmFuncWriteWithMetadata writes data with json encoded metadata
+	WasmFuncWriteWithMetadata = "yomo_write_with_metadata"
+	// timer
+	WasmFuncNow         = "yomo_now"
+	WasmFuncEmitAfter   = "yomo_emit_after"
+	WasmFuncEmitEvery   = "yomo_emit_every"
+	WasmFuncCancelTimer = "yomo_cancel_timer"
 )
 
 // Runtime is the abstract interface for wasm runtime
@@ -42,20 +55,93 @@ type Runtime interface {
 	// RunHandler runs the wasm application (request -> response mode)
 	RunHandler(ctx serverless.Context) error
 
-	// Close releases all the resources related to the runtime
+	// Close runs the close function of the wasm sfn, and releases all the resources related to the runtime
 	Close() error
 }
 
+// DefaultRuntime is the default wasm runtime type.
+const DefaultRuntime = "wazero"
+
+// Compilation modes of the wasm runtime.
+const (
+	CompilationModeCompiler    = "compiler"
+	CompilationModeInterpreter = "interpreter"
+)
+
+// RuntimeOptions are the options for creating a wasm runtime.
+type RuntimeOptions struct {
+	// CompilationMode is the compilation mode of the runtime, `compiler` or `interpreter`,
+	// empty means the default mode of the runtime.
+	CompilationMode string
+	// CacheDir is the directory to cache the compiled modules on disk, the artifacts are keyed by
+	// the module hash. Empty means caching in memory.
+	CacheDir string
+	// MemoryLimit is the maximum linear memory of the wasm sfn in MiB, 0 means no limit.
+	MemoryLimit uint32
+	// Timeout is the maximum execution time of one invocation, 0 means no limit.
+	Timeout time.Duration
+	// Fuel is the maximum fuel that one invocation can consume, 0 means no limit.
+	// Only the wasmtime runtime supports fuel metering.
+	Fuel uint64
+	// TimerWriter writes the data emitted by the timers of the wasm sfn, the timers are not
+	// scheduled if it's nil.
+	TimerWriter TimerWriter
+}
+
+// TimerCanceler is implemented by the runtimes supporting the timers of the wasm sfn.
+type TimerCanceler interface {
+	// CancelTimers cancels all the timers scheduled by the wasm sfn, eg: when the sfn disconnects.
+	CancelTimers()
+}
+
+// ErrExecutionLimitExceeded is returned when an invocation of the wasm sfn is terminated
+// because it exceeded the execution timeout or fuel.
+var ErrExecutionLimitExceeded = errors.New("wasm: execution limit exceeded")
+
+// NewRuntimeFunc creates a wasm runtime with the options.
+type NewRuntimeFunc func(opts RuntimeOptions) (Runtime, error)
+
+var (
+	runtimesMu sync.RWMutex
+	runtimes   = make(map[string]NewRuntimeFunc)
+)
+
+// RegisterRuntime registers a wasm runtime with the runtime type, it panics if the runtime type
+// has been registered.
+func RegisterRuntime(runtimeType string, fn NewRuntimeFunc) {
+	runtimesMu.Lock()
+	defer runtimesMu.Unlock()
+	if fn == nil {
+		panic("wasm: RegisterRuntime runtime is nil")
+	}
+	if _, dup := runtimes[runtimeType]; dup {
+		panic("wasm: RegisterRuntime called twice for runtime " + runtimeType)
+	}
+	runtimes[runtimeType] = fn
+}
+
 // NewRuntime returns a specific wasm runtime instance according to the type parameter
-func NewRuntime(runtimeType string) (Runtime, error) {
-	switch runtimeType {
-	case "", "wazero":
-		return newWazeroRuntime()
-	case "wasmtime":
-		return newWasmtimeRuntime()
-	case "wasmedge":
-		return newWasmEdgeRuntime()
-	default:
-		return nil, fmt.Errorf("invalid runtime type: %s, wasmtime and wasmedge are supported in current version", runtimeType)
+func NewRuntime(runtimeType string, opts RuntimeOptions) (Runtime, error) {
+	if runtimeType == "" {
+		runtimeType = DefaultRuntime
+	}
+	runtimesMu.RLock()
+	fn, ok := runtimes[runtimeType]
+	runtimesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("invalid runtime type: %s, %s are supported in current version", runtimeType, strings.Join(runtimeTypes(), ", "))
+	}
+	return fn(opts)
+}
+
+func runtimeTypes() []string {
+	runtimesMu.RLock()
+	defer runtimesMu.RUnlock()
+
+	types := make([]string, 0, len(runtimes))
+	for t := range runtimes {
+		types = append(types, t)
 	}
+	sort.Strings(types)
+	return types
 }
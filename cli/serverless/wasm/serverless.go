@@ -2,11 +2,14 @@
 package wasm
 
 import (
+	"errors"
 	"log"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/ai"
 	cli "github.com/yomorun/yomo/cli/serverless"
 	pkglog "github.com/yomorun/yomo/pkg/log"
 	"github.com/yomorun/yomo/serverless"
@@ -20,12 +23,37 @@ type wasmServerless struct {
 	observed     []uint32
 	wantedTarget string
 	credential   string
-	mu           sync.Mutex
+	filename     string
+	runtimeType  string
+	runtimeOpts  RuntimeOptions
+	watchFile    bool
+	reloadAddr   string
+	// closed is true once the runtime is closed, the sfn can not be reloaded after closing
+	closed bool
+	// timerSource writes the data emitted by the timers of the wasm sfn
+	timerSource yomo.Source
+	mu          sync.Mutex
 }
 
 // Init initializes the serverless
 func (s *wasmServerless) Init(opts *cli.Options) error {
-	runtime, err := NewRuntime(opts.Runtime)
+	// cache the compiled modules on disk by default, so restarts and reloads skip the compilation
+	cacheDir := opts.WasmCacheDir
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir()
+	}
+	if opts.WasmNoCache {
+		cacheDir = ""
+	}
+	runtimeOpts := RuntimeOptions{
+		CompilationMode: opts.WasmCompilationMode,
+		CacheDir:        cacheDir,
+		MemoryLimit:     opts.WasmMemoryLimit,
+		Timeout:         opts.WasmTimeout,
+		Fuel:            opts.WasmFuel,
+		TimerWriter:     s.emit,
+	}
+	runtime, err := NewRuntime(opts.Runtime, runtimeOpts)
 	if err != nil {
 		return err
 	}
@@ -41,6 +69,11 @@ func (s *wasmServerless) Init(opts *cli.Options) error {
 	s.observed = runtime.GetObserveDataTags()
 	s.wantedTarget = runtime.GetWantedTarget()
 	s.credential = opts.Credential
+	s.filename = opts.Filename
+	s.runtimeType = opts.Runtime
+	s.runtimeOpts = runtimeOpts
+	s.watchFile = opts.WasmWatch
+	s.reloadAddr = opts.WasmReloadAddr
 
 	return nil
 }
@@ -52,53 +85,117 @@ func (s *wasmServerless) Build(clean bool) error {
 
 // Run the wasm serverless function
 func (s *wasmServerless) Run(verbose bool) error {
+	// the timers emit the data through their own source, so the data are not bound to the invocations
+	s.timerSource = yomo.NewSource(s.name, s.zipperAddr, yomo.WithCredential(s.credential))
+	if err := s.timerSource.Connect(); err != nil {
+		return err
+	}
+	defer s.timerSource.Close()
+
 	sfn := yomo.NewStreamFunction(
 		s.name,
 		s.zipperAddr,
 		yomo.WithSfnCredential(s.credential),
 	)
-	// init
-	err := sfn.Init(func() error {
+	// init, it runs when the sfn connects to the zipper
+	sfn.SetInitHandler(func() error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
 		return s.runtime.RunInit()
 	})
-	if err != nil {
-		return err
-	}
 	// set observe data tags
 	sfn.SetObserveDataTags(s.observed...)
 
 	// set wanted target
 	sfn.SetWantedTarget(s.wantedTarget)
 
-	sfn.SetHandler(
-		func(ctx serverless.Context) {
-			s.mu.Lock()
-			defer s.mu.Unlock()
-			err := s.runtime.RunHandler(ctx)
-			if err != nil {
-				pkglog.FailureStatusEvent(os.Stderr, "%v", err)
-			}
-		},
-	)
+	sfn.SetHandler(s.handle)
 
 	sfn.SetErrorHandler(
 		func(err error) {
 			log.Printf("[wasm] error handler: %T %v\n", err, err)
+			// the error handler is called when the sfn disconnects, the timers are not kept across the connections
+			s.cancelTimers()
 		},
 	)
 
-	err = sfn.Connect()
+	err := sfn.Connect()
 	if err != nil {
 		return err
 	}
 	defer sfn.Close()
-	defer s.runtime.Close()
+	// closing the runtime also runs the close function of the wasm sfn
+	defer s.close()
+
+	// hot-swap the wasm module without reconnecting
+	defer s.reloadOnSignal()()
+	if s.watchFile {
+		stop, err := s.watch()
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+	if s.reloadAddr != "" {
+		stop, err := s.serveReload(s.reloadAddr)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
 
 	sfn.Wait()
 
 	return nil
 }
 
+// handle runs the handler of the wasm sfn, the error of the handler is written to the reducer
+// if the handler is invoked by llm function calling.
+func (s *wasmServerless) handle(ctx serverless.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := runHandlerWithTrace(s.runtime, s.runtimeType, filepath.Base(s.filename), ctx)
+	if err != nil {
+		pkglog.FailureStatusEvent(os.Stderr, "%v", err)
+		writeLLMError(ctx, err)
+	}
+}
+
+// emit writes the data emitted by the timers of the wasm sfn, every data is written with its own metadata.
+func (s *wasmServerless) emit(tag uint32, data []byte) error {
+	if s.timerSource == nil {
+		return errors.New("the timers of the wasm sfn are not started")
+	}
+	return s.timerSource.Write(tag, data)
+}
+
+// cancelTimers cancels the timers scheduled by the running wasm sfn.
+func (s *wasmServerless) cancelTimers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if canceler, ok := s.runtime.(TimerCanceler); ok {
+		canceler.CancelTimers()
+	}
+}
+
+// writeLLMError writes the error to the reducer if the handler is invoked by llm function calling,
+// so the caller gets the error at once instead of waiting until timeout.
+func writeLLMError(ctx serverless.Context, err error) {
+	fnCall := &ai.FunctionCall{}
+	if ctx.ReadLLMFunctionCall(fnCall) != nil || fnCall.ReqID == "" {
+		return
+	}
+	fnCall.IsOK = false
+	fnCall.Error = err.Error()
+	buf, err := fnCall.Bytes()
+	if err != nil {
+		return
+	}
+	if err := ctx.Write(ai.ReducerTag, buf); err != nil {
+		pkglog.FailureStatusEvent(os.Stderr, "write error to reducer: %v", err)
+	}
+}
+
 // Executable shows whether the program needs to be built
 func (s *wasmServerless) Executable() bool {
 	return true
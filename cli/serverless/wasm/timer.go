@@ -0,0 +1,138 @@
+// Package wasm provides WebAssembly serverless function runtimes.
+package wasm
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// TimerWriter writes the data emitted by the timers of the wasm sfn, it's owned by the host,
+// so every data is written with its own metadata instead of the metadata of the invocation
+// scheduling the timer.
+type TimerWriter func(tag uint32, data []byte) error
+
+// timers holds the timers scheduled by the wasm sfn, the timers are owned by the host,
+// so they are cancelled when the runtime is closed or the sfn disconnects.
+type timers struct {
+	start  time.Time
+	write  TimerWriter
+	mu     sync.Mutex
+	seq    uint32
+	stops  map[uint32]func()
+	closed bool
+}
+
+func newTimers(write TimerWriter) *timers {
+	return &timers{
+		start: time.Now(),
+		write: write,
+		stops: make(map[uint32]func()),
+	}
+}
+
+// now returns the monotonic time in nanoseconds since the runtime was created.
+func (t *timers) now() int64 {
+	return int64(time.Since(t.start))
+}
+
+// emitAfter writes data with tag through the writer of the host after d, if periodic is true,
+// the data will be written every d until the timer is cancelled.
+// It returns the timer id, 0 means the timer was not scheduled.
+func (t *timers) emitAfter(d time.Duration, tag uint32, data []byte, periodic bool) uint32 {
+	if t.write == nil || d <= 0 {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return 0
+	}
+	t.seq++
+	id := t.seq
+
+	emit := func() {
+		if err := t.write(tag, data); err != nil {
+			log.Printf("[wasm] timer %d emit error: %v\n", id, err)
+		}
+	}
+
+	if !periodic {
+		timer := time.AfterFunc(d, func() {
+			// the timer cancelled concurrently does not emit
+			if _, ok := t.remove(id); ok {
+				emit()
+			}
+		})
+		t.stops[id] = func() { timer.Stop() }
+		return id
+	}
+
+	ticker := time.NewTicker(d)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				select {
+				case <-done:
+					return
+				default:
+					emit()
+				}
+			}
+		}
+	}()
+	t.stops[id] = func() {
+		ticker.Stop()
+		close(done)
+	}
+	return id
+}
+
+// cancel cancels the timer, it returns false if the timer does not exist.
+func (t *timers) cancel(id uint32) bool {
+	stop, ok := t.remove(id)
+	if ok {
+		stop()
+	}
+	return ok
+}
+
+func (t *timers) remove(id uint32) (func(), bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stop, ok := t.stops[id]
+	delete(t.stops, id)
+	return stop, ok
+}
+
+// cancelAll cancels all the timers, the timers can be scheduled again, eg: after the sfn reconnects.
+func (t *timers) cancelAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stopAll()
+}
+
+// close cancels all the timers, no more timers can be scheduled after closing.
+func (t *timers) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	t.stopAll()
+}
+
+// stopAll stops and removes all the timers, t.mu must be held.
+func (t *timers) stopAll() {
+	for id, stop := range t.stops {
+		stop()
+		delete(t.stops, id)
+	}
+}
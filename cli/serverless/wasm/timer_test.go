@@ -0,0 +1,178 @@
+package wasm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yomorun/yomo"
+)
+
+const timerTag = 0x33
+
+type emitted struct {
+	tag  uint32
+	data string
+}
+
+// newTimerRuntime returns a wazero runtime of the guest, the data emitted by its timers are sent to the channel.
+func newTimerRuntime(t *testing.T, g guest) (Runtime, chan emitted) {
+	t.Helper()
+	ch := make(chan emitted, 100)
+	runtime, err := NewRuntime("wazero", RuntimeOptions{
+		TimerWriter: func(tag uint32, data []byte) error {
+			ch <- emitted{tag: tag, data: string(data)}
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, runtime.Init(g.write(t)))
+	require.NoError(t, runtime.RunInit())
+	return runtime, ch
+}
+
+func receive(t *testing.T, ch chan emitted) emitted {
+	t.Helper()
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("the timer did not emit")
+		return emitted{}
+	}
+}
+
+func assertNotEmitted(t *testing.T, ch chan emitted) {
+	t.Helper()
+	// drain the data emitted before the timers were cancelled
+	time.Sleep(30 * time.Millisecond)
+	for len(ch) > 0 {
+		<-ch
+	}
+	select {
+	case e := <-ch:
+		t.Fatalf("unexpected data emitted: %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestTimerEmitAfter(t *testing.T) {
+	runtime, ch := newTimerRuntime(t, guest{
+		tag:     0x11,
+		data:    "hello",
+		handler: instrs(emitCall(funcEmitAfter, 10, timerTag, 5), []byte{opDrop}),
+	})
+	defer runtime.Close()
+
+	ctx := newTestContext(0x11, "data")
+	require.NoError(t, runtime.RunHandler(ctx))
+
+	assert.Equal(t, emitted{tag: timerTag, data: "hello"}, receive(t, ch))
+	assertNotEmitted(t, ch)
+	// the data are written by the host instead of the context of the invocation
+	assert.Empty(t, ctx.recordsWritten())
+}
+
+func TestTimerEmitEvery(t *testing.T) {
+	// the first invocation schedules the timer and stores its id at 16, the next one cancels it
+	runtime, ch := newTimerRuntime(t, guest{
+		tag:  0x11,
+		data: "tick",
+		handler: instrs(
+			i32Const(16), []byte{opI32Load, 0x02, 0x00}, []byte{opI32Eqz},
+			[]byte{opIf, blockVoid},
+			i32Const(16), emitCall(funcEmitEvery, 10, timerTag, 4), []byte{opI32Store, 0x02, 0x00},
+			[]byte{opElse},
+			i32Const(16), []byte{opI32Load, 0x02, 0x00}, call(funcCancelTimer), []byte{opDrop},
+			[]byte{opEnd},
+		),
+	})
+	defer runtime.Close()
+
+	ctx := newTestContext(0x11, "data")
+	require.NoError(t, runtime.RunHandler(ctx))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, emitted{tag: timerTag, data: "tick"}, receive(t, ch))
+	}
+
+	require.NoError(t, runtime.RunHandler(ctx))
+	assertNotEmitted(t, ch)
+	assert.Empty(t, ctx.recordsWritten())
+}
+
+func TestTimerCancel(t *testing.T) {
+	runtime, ch := newTimerRuntime(t, guest{
+		tag:     0x11,
+		data:    "tick",
+		handler: instrs(emitCall(funcEmitEvery, 10, timerTag, 4), []byte{opDrop}),
+	})
+
+	ctx := newTestContext(0x11, "data")
+	require.NoError(t, runtime.RunHandler(ctx))
+	receive(t, ch)
+
+	t.Run("cancel timers", func(t *testing.T) {
+		runtime.(TimerCanceler).CancelTimers()
+		assertNotEmitted(t, ch)
+
+		// the timers can be scheduled again, eg: after the sfn reconnects
+		require.NoError(t, runtime.RunHandler(ctx))
+		receive(t, ch)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		require.NoError(t, runtime.Close())
+		assertNotEmitted(t, ch)
+	})
+}
+
+func TestCancelUnknownTimer(t *testing.T) {
+	timers := newTimers(func(tag uint32, data []byte) error { return nil })
+
+	assert.False(t, timers.cancel(1))
+
+	id := timers.emitAfter(time.Hour, timerTag, nil, false)
+	assert.NotZero(t, id)
+	assert.True(t, timers.cancel(id))
+	assert.False(t, timers.cancel(id))
+
+	timers.close()
+	assert.Zero(t, timers.emitAfter(time.Hour, timerTag, nil, false))
+}
+
+type mockSource struct {
+	yomo.Source
+	written []emitted
+}
+
+func (s *mockSource) Write(tag uint32, data []byte) error {
+	s.written = append(s.written, emitted{tag: tag, data: string(data)})
+	return nil
+}
+
+func TestServerlessEmit(t *testing.T) {
+	s := &wasmServerless{}
+	assert.Error(t, s.emit(timerTag, []byte("hello")))
+
+	source := &mockSource{}
+	s.timerSource = source
+	require.NoError(t, s.emit(timerTag, []byte("hello")))
+	assert.Equal(t, []emitted{{tag: timerTag, data: "hello"}}, source.written)
+}
+
+func TestServerlessCancelTimers(t *testing.T) {
+	runtime, ch := newTimerRuntime(t, guest{
+		tag:     0x11,
+		data:    "tick",
+		handler: instrs(emitCall(funcEmitEvery, 10, timerTag, 4), []byte{opDrop}),
+	})
+	defer runtime.Close()
+
+	s := &wasmServerless{runtime: runtime}
+	s.handle(newTestContext(0x11, "data"))
+	receive(t, ch)
+
+	s.cancelTimers()
+	assertNotEmitted(t, ch)
+}
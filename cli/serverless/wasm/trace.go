@@ -0,0 +1,109 @@
+package wasm
+
+import (
+	"context"
+
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/trace"
+	"github.com/yomorun/yomo/serverless"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// FuelMeter is implemented by the runtimes which meter the fuel, eg: wasmtime.
+type FuelMeter interface {
+	// FuelConsumed returns the fuel consumed by the last invocation of the handler,
+	// ok is false if the fuel metering is disabled.
+	FuelConsumed() (fuel uint64, ok bool)
+}
+
+const tracerName = "github.com/yomorun/yomo/cli/serverless/wasm"
+
+// runHandlerWithTrace runs the handler in the span of the guest invocation, the span is the child of
+// the span of the incoming frame. The incoming data read by the guest and the results written by the guest
+// are traced as the decode and encode child spans.
+func runHandlerWithTrace(runtime Runtime, runtimeType string, module string, ctx serverless.Context) error {
+	tracer := otel.Tracer(tracerName)
+
+	spanCtx, span := tracer.Start(
+		trace.NewContextWithMetadata(traceMetadata(ctx)),
+		"wasm handler",
+		oteltrace.WithAttributes(
+			attribute.String("wasm.module", module),
+			attribute.String("wasm.runtime", runtimeType),
+			attribute.Int("recv_data_tag", int(ctx.Tag())),
+		),
+	)
+	defer span.End()
+
+	err := runtime.RunHandler(&tracedContext{Context: ctx, ctx: spanCtx, tracer: tracer})
+	if meter, ok := runtime.(FuelMeter); ok {
+		if fuel, ok := meter.FuelConsumed(); ok {
+			span.SetAttributes(attribute.Int64("wasm.fuel_consumed", int64(fuel)))
+		}
+	}
+	trace.RecordError(span, err)
+
+	return err
+}
+
+// traceMetadata returns the trace info of the incoming frame.
+func traceMetadata(ctx serverless.Context) metadata.M {
+	md := metadata.M{}
+	for _, k := range []string{metadata.TraceIDKey, metadata.SpanIDKey, metadata.TraceFlagsKey} {
+		if v, ok := ctx.Metadata(k); ok {
+			md.Set(k, v)
+		}
+	}
+	return md
+}
+
+// tracedContext traces the data read and written by the guest.
+type tracedContext struct {
+	serverless.Context
+	ctx    context.Context
+	tracer oteltrace.Tracer
+}
+
+// Data returns the incoming data, which is decoded by the guest.
+func (c *tracedContext) Data() []byte {
+	_, span := c.tracer.Start(c.ctx, "wasm decode")
+	defer span.End()
+
+	data := c.Context.Data()
+	span.SetAttributes(attribute.Int("recv_data_len", len(data)))
+	return data
+}
+
+func (c *tracedContext) encode(tag uint32, data []byte, write func() error) error {
+	_, span := c.tracer.Start(c.ctx, "wasm encode", oteltrace.WithAttributes(
+		attribute.Int("send_data_tag", int(tag)),
+		attribute.Int("send_data_len", len(data)),
+	))
+	defer span.End()
+
+	err := write()
+	trace.RecordError(span, err)
+	return err
+}
+
+// Write writes the result encoded by the guest.
+func (c *tracedContext) Write(tag uint32, data []byte) error {
+	return c.encode(tag, data, func() error { return c.Context.Write(tag, data) })
+}
+
+// WriteContext writes the result encoded by the guest, the write is canceled once the ctx is done.
+func (c *tracedContext) WriteContext(ctx context.Context, tag uint32, data []byte) error {
+	return c.encode(tag, data, func() error { return c.Context.WriteContext(ctx, tag, data) })
+}
+
+// WriteWithTarget writes the result encoded by the guest to the target.
+func (c *tracedContext) WriteWithTarget(tag uint32, data []byte, target string) error {
+	return c.encode(tag, data, func() error { return c.Context.WriteWithTarget(tag, data, target) })
+}
+
+// WriteWithMetadata writes the result encoded by the guest with the metadata.
+func (c *tracedContext) WriteWithMetadata(tag uint32, data []byte, md map[string]string) error {
+	return c.encode(tag, data, func() error { return c.Context.WriteWithMetadata(tag, data, md) })
+}
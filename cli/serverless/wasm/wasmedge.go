@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/second-state/WasmEdge-go/wasmedge"
 	wasmhttp "github.com/yomorun/yomo/cli/serverless/wasm/http"
@@ -16,16 +17,36 @@ import (
 )
 
 type wasmEdgeRuntime struct {
-	vm     *wasmedge.VM
-	conf   *wasmedge.Configure
-	module *wasmedge.Module
+	vm       *wasmedge.VM
+	conf     *wasmedge.Configure
+	module   *wasmedge.Module
+	cacheDir string
 
 	observed      []uint32
 	serverlessCtx serverless.Context
 }
 
-func newWasmEdgeRuntime() (*wasmEdgeRuntime, error) {
+func init() {
+	RegisterRuntime("wasmedge", newWasmEdgeRuntime)
+}
+
+func newWasmEdgeRuntime(opts RuntimeOptions) (Runtime, error) {
+	switch opts.CompilationMode {
+	case "", CompilationModeInterpreter:
+	case CompilationModeCompiler:
+		if opts.CacheDir == "" {
+			return nil, errors.New("the compiler mode of wasmedge requires the wasm cache dir")
+		}
+	default:
+		return nil, fmt.Errorf("invalid compilation mode: %s, compiler and interpreter are supported by wasmedge", opts.CompilationMode)
+	}
+	if opts.Fuel > 0 || opts.Timeout > 0 {
+		return nil, errors.New("execution fuel and timeout are not supported by wasmedge")
+	}
 	conf := wasmedge.NewConfigure(wasmedge.WASI)
+	if opts.MemoryLimit > 0 {
+		conf.SetMaxMemoryPage(uint(opts.MemoryLimit) * 16)
+	}
 	vm := wasmedge.NewVMWithConfig(conf)
 	wasi := vm.GetImportModule(wasmedge.WASI)
 	wasi.InitWasi(
@@ -34,10 +55,15 @@ func newWasmEdgeRuntime() (*wasmEdgeRuntime, error) {
 		[]string{".:."},
 	)
 
-	return &wasmEdgeRuntime{
+	runtime := &wasmEdgeRuntime{
 		vm:   vm,
 		conf: conf,
-	}, nil
+	}
+	// the modules are compiled ahead of time into the cache dir, unless the interpreter is required
+	if opts.CompilationMode != CompilationModeInterpreter {
+		runtime.cacheDir = opts.CacheDir
+	}
+	return runtime, nil
 }
 
 // Init loads the wasm file, and initialize the runtime environment
@@ -98,6 +124,13 @@ func (r *wasmEdgeRuntime) Init(wasmFile string) error {
 		return fmt.Errorf("vm.RegisterModule: %v", err)
 	}
 
+	if r.cacheDir != "" {
+		wasmFile, err = r.aotCompile(wasmFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	err = r.vm.LoadWasmFile(wasmFile)
 	if err != nil {
 		return fmt.Errorf("load wasm file %s: %v", wasmFile, err)
@@ -139,6 +172,12 @@ func (r *wasmEdgeRuntime) GetObserveDataTags() []uint32 {
 	return r.observed
 }
 
+// GetWantedTarget returns the wanted target of the wasm sfn,
+// wanted target is not supported by the WasmEdge runtime.
+func (r *wasmEdgeRuntime) GetWantedTarget() string {
+	return ""
+}
+
 // RunHandler runs the wasm application (request -> response mode)
 func (r *wasmEdgeRuntime) RunHandler(ctx serverless.Context) error {
 	r.serverlessCtx = ctx
@@ -152,6 +191,12 @@ func (r *wasmEdgeRuntime) RunHandler(ctx serverless.Context) error {
 
 // Close releases all the resources related to the runtime
 func (r *wasmEdgeRuntime) Close() error {
+	// close function is optional
+	if closeFunc := r.vm.GetActiveModule().FindFunction(WasmFuncClose); closeFunc != nil {
+		if _, err := r.vm.Execute(WasmFuncClose); err != nil {
+			log.Printf("[wasm] vm.Execute %s: %v\n", WasmFuncClose, err)
+		}
+	}
 	r.module.Release()
 	r.vm.Release()
 	r.conf.Release()
@@ -300,3 +345,32 @@ func (r *wasmEdgeRuntime) httpSend(
 	}
 	return []any{0}, wasmedge.Result_Success
 }
+
+// aotCompile compiles the wasm file ahead of time, and returns the path of the compiled artifact.
+// The artifact is cached by the module hash, so an unchanged module is compiled only once.
+func (r *wasmEdgeRuntime) aotCompile(wasmFile string) (string, error) {
+	wasmBytes, err := os.ReadFile(wasmFile)
+	if err != nil {
+		return "", fmt.Errorf("read wasm file %s: %v", wasmFile, err)
+	}
+	dir := filepath.Join(r.cacheDir, "wasmedge")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create wasm cache dir: %v", err)
+	}
+	compiledFile := filepath.Join(dir, moduleHash(wasmBytes)+".so")
+	if _, err := os.Stat(compiledFile); err == nil {
+		return compiledFile, nil
+	}
+	compiler := wasmedge.NewCompilerWithConfig(r.conf)
+	defer compiler.Release()
+	// compile to a temporary file first, so a broken artifact is never cached
+	tmpFile := compiledFile + ".tmp"
+	if err := compiler.Compile(wasmFile, tmpFile); err != nil {
+		os.Remove(tmpFile)
+		return "", fmt.Errorf("compiler.Compile: %v", err)
+	}
+	if err := os.Rename(tmpFile, compiledFile); err != nil {
+		return "", fmt.Errorf("cache compiled wasm: %v", err)
+	}
+	return compiledFile, nil
+}
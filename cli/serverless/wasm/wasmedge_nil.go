@@ -5,6 +5,10 @@ package wasm
 
 import "errors"
 
-func newWasmEdgeRuntime() (Runtime, error) {
+func init() {
+	RegisterRuntime("wasmedge", newWasmEdgeRuntime)
+}
+
+func newWasmEdgeRuntime(_ RuntimeOptions) (Runtime, error) {
 	return nil, errors.New("this cli version doesn't support WasmEdge, please rebuild cli: TAGS=wasmedge make build")
 }
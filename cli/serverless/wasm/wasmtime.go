@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/bytecodealliance/wasmtime-go/v9"
 	wasmhttp "github.com/yomorun/yomo/cli/serverless/wasm/http"
@@ -21,15 +23,48 @@ type wasmtimeRuntime struct {
 	store           *wasmtime.Store
 	memory          *wasmtime.Memory
 	init            *wasmtime.Func
+	close           *wasmtime.Func
 	observeDataTags *wasmtime.Func
 	handler         *wasmtime.Func
 
+	fuel    uint64
+	timeout time.Duration
+	// fuelConsumed is the fuel consumed by the last invocation of the handler
+	fuelConsumed uint64
+
 	observed      []uint32
+	wanted        string
 	serverlessCtx serverless.Context
 }
 
-func newWasmtimeRuntime() (*wasmtimeRuntime, error) {
-	engine := wasmtime.NewEngine()
+func init() {
+	RegisterRuntime("wasmtime", newWasmtimeRuntime)
+}
+
+func newWasmtimeRuntime(opts RuntimeOptions) (Runtime, error) {
+	config := wasmtime.NewConfig()
+	switch opts.CompilationMode {
+	case "", CompilationModeCompiler:
+		config.SetStrategy(wasmtime.StrategyCranelift)
+	default:
+		return nil, fmt.Errorf("invalid compilation mode: %s, only compiler is supported by wasmtime", opts.CompilationMode)
+	}
+	if opts.Fuel > 0 {
+		config.SetConsumeFuel(true)
+	}
+	if opts.Timeout > 0 {
+		config.SetEpochInterruption(true)
+	}
+	if opts.CacheDir != "" {
+		cacheConfig, err := writeWasmtimeCacheConfig(opts.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := config.CacheConfigLoad(cacheConfig); err != nil {
+			return nil, fmt.Errorf("wasmtime.CacheConfigLoad: %v", err)
+		}
+	}
+	engine := wasmtime.NewEngineWithConfig(config)
 	linker := wasmtime.NewLinker(engine)
 	if err := linker.DefineWasi(); err != nil {
 		return nil, fmt.Errorf("linker.DefineWasi: %v", err)
@@ -42,11 +77,42 @@ func newWasmtimeRuntime() (*wasmtimeRuntime, error) {
 	wasiConfig.PreopenDir(".", ".")
 	store := wasmtime.NewStore(engine)
 	store.SetWasi(wasiConfig)
+	if opts.MemoryLimit > 0 {
+		store.Limiter(int64(opts.MemoryLimit)<<20, -1, -1, -1, -1)
+	}
+
+	r := &wasmtimeRuntime{
+		linker:  linker,
+		store:   store,
+		fuel:    opts.Fuel,
+		timeout: opts.Timeout,
+	}
+	if err := r.refuel(); err != nil {
+		return nil, err
+	}
+	if r.timeout > 0 {
+		// the epoch is only increased when the handler exceeds the timeout.
+		store.SetEpochDeadline(1)
+	}
+
+	return r, nil
+}
 
-	return &wasmtimeRuntime{
-		linker: linker,
-		store:  store,
-	}, nil
+// refuel tops up the fuel of the store, so every invocation can consume up to the fuel limit.
+func (r *wasmtimeRuntime) refuel() error {
+	if r.fuel == 0 {
+		return nil
+	}
+	remaining, err := r.store.ConsumeFuel(0)
+	if err != nil {
+		return fmt.Errorf("store.ConsumeFuel: %v", err)
+	}
+	if remaining < r.fuel {
+		if err := r.store.AddFuel(r.fuel - remaining); err != nil {
+			return fmt.Errorf("store.AddFuel: %v", err)
+		}
+	}
+	return nil
 }
 
 // Init loads the wasm file, and initialize the runtime environment
@@ -80,6 +146,10 @@ func (r *wasmtimeRuntime) Init(wasmFile string) error {
 	if err := r.linker.FuncWrap("env", WasmFuncWrite, r.write); err != nil {
 		return fmt.Errorf("linker.FuncWrap: %s %v", WasmFuncWrite, err)
 	}
+	// wanted target
+	if err := r.linker.FuncWrap("env", WasmFuncGetWantedTarget, r.wantedTarget); err != nil {
+		return fmt.Errorf("linker.FuncWrap: %s %v", WasmFuncGetWantedTarget, err)
+	}
 	// http
 	if err := r.linker.FuncWrap("env", wasmhttp.WasmFuncHTTPSend, r.httpSend); err != nil {
 		return fmt.Errorf("linker.FuncWrap: %s %v", wasmhttp.WasmFuncHTTPSend, err)
@@ -100,6 +170,7 @@ func (r *wasmtimeRuntime) Init(wasmFile string) error {
 	}
 	// yomo init and handler
 	r.init = instance.GetFunc(r.store, WasmFuncInit)
+	r.close = instance.GetFunc(r.store, WasmFuncClose)
 	r.observeDataTags = instance.GetFunc(r.store, WasmFuncObserveDataTags)
 	r.handler = instance.GetFunc(r.store, WasmFuncHandler)
 
@@ -109,6 +180,12 @@ func (r *wasmtimeRuntime) Init(wasmFile string) error {
 	if _, err := r.observeDataTags.Call(r.store); err != nil {
 		return fmt.Errorf("%s.Call: %v", WasmFuncObserveDataTags, err)
 	}
+	// wanted target is optional
+	if wantedTarget := instance.GetFunc(r.store, WasmFuncWantedTarget); wantedTarget != nil {
+		if _, err := wantedTarget.Call(r.store); err != nil {
+			return fmt.Errorf("%s.Call: %v", WasmFuncWantedTarget, err)
+		}
+	}
 
 	return nil
 }
@@ -118,18 +195,62 @@ func (r *wasmtimeRuntime) GetObserveDataTags() []uint32 {
 	return r.observed
 }
 
+// GetWantedTarget returns the wanted target of the wasm sfn
+func (r *wasmtimeRuntime) GetWantedTarget() string {
+	return r.wanted
+}
+
 // RunHandler runs the wasm application (request -> response mode)
 func (r *wasmtimeRuntime) RunHandler(ctx serverless.Context) error {
 	r.serverlessCtx = ctx
+	if err := r.refuel(); err != nil {
+		return err
+	}
+	if r.timeout > 0 {
+		r.store.SetEpochDeadline(1)
+		timer := time.AfterFunc(r.timeout, r.store.Engine.IncrementEpoch)
+		defer timer.Stop()
+	}
 	// run handler
+	consumed, _ := r.store.FuelConsumed()
+	defer func() {
+		if fuel, ok := r.store.FuelConsumed(); ok {
+			r.fuelConsumed = fuel - consumed
+		}
+	}()
 	if _, err := r.handler.Call(r.store); err != nil {
+		var trap *wasmtime.Trap
+		if errors.As(err, &trap) {
+			if code := trap.Code(); code != nil && *code == wasmtime.Interrupt {
+				return fmt.Errorf("handler.Call: %w: timeout %s", ErrExecutionLimitExceeded, r.timeout)
+			}
+		}
+		if r.fuel > 0 {
+			if remaining, _ := r.store.ConsumeFuel(0); remaining == 0 {
+				return fmt.Errorf("handler.Call: %w: fuel %d", ErrExecutionLimitExceeded, r.fuel)
+			}
+		}
 		return fmt.Errorf("handler.Call: %v", err)
 	}
 	return nil
 }
 
+// FuelConsumed returns the fuel consumed by the last invocation of the handler
+func (r *wasmtimeRuntime) FuelConsumed() (uint64, bool) {
+	return r.fuelConsumed, r.fuel > 0
+}
+
 // Close releases all the resources related to the runtime
 func (r *wasmtimeRuntime) Close() error {
+	// close function is optional
+	if r.close != nil {
+		if err := r.refuel(); err != nil {
+			return err
+		}
+		if _, err := r.close.Call(r.store); err != nil {
+			return fmt.Errorf("%s.Call: %v", WasmFuncClose, err)
+		}
+	}
 	return nil
 }
 
@@ -139,6 +260,9 @@ func (r *wasmtimeRuntime) RunInit() error {
 		fmt.Println("init function not used")
 		return nil
 	}
+	if err := r.refuel(); err != nil {
+		return err
+	}
 	result, err := r.init.Call(r.store)
 	if err != nil {
 		return fmt.Errorf("init.Call: %v", err)
@@ -153,6 +277,11 @@ func (r *wasmtimeRuntime) observeDataTag(tag int32) {
 	r.observed = append(r.observed, uint32(tag))
 }
 
+func (r *wasmtimeRuntime) wantedTarget(pointer int32, length int32) {
+	output := r.memory.UnsafeData(r.store)[pointer : pointer+length]
+	r.wanted = string(output)
+}
+
 func (r *wasmtimeRuntime) contextTag() int32 {
 	return int32(r.serverlessCtx.Tag())
 }
@@ -224,3 +353,21 @@ func (r *wasmtimeRuntime) httpSend(
 	copy(r.memory.UnsafeData(r.store)[allocPtr:allocPtr+dataLen], respBuf)
 	return 0
 }
+
+// writeWasmtimeCacheConfig writes the wasmtime cache config file to the cache directory,
+// wasmtime only loads the cache settings from a toml file.
+func writeWasmtimeCacheConfig(cacheDir string) (string, error) {
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return "", fmt.Errorf("create wasm cache dir: %v", err)
+	}
+	cacheDir, err := filepath.Abs(cacheDir)
+	if err != nil {
+		return "", err
+	}
+	configFile := filepath.Join(cacheDir, "wasmtime-cache.toml")
+	content := fmt.Sprintf("[cache]\nenabled = true\ndirectory = %q\n", cacheDir)
+	if err := os.WriteFile(configFile, []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("write wasmtime cache config: %v", err)
+	}
+	return configFile, nil
+}
@@ -5,6 +5,10 @@ package wasm
 
 import "errors"
 
-func newWasmtimeRuntime() (Runtime, error) {
+func init() {
+	RegisterRuntime("wasmtime", newWasmtimeRuntime)
+}
+
+func newWasmtimeRuntime(_ RuntimeOptions) (Runtime, error) {
 	return nil, errors.New("this cli version doesn't support Wasmtime, please rebuild cli: TAGS=wasmtime make build")
 }
@@ -3,12 +3,14 @@ package wasm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
@@ -18,7 +20,10 @@ import (
 	"github.com/yomorun/yomo/serverless"
 )
 
-const i32 = api.ValueTypeI32
+const (
+	i32 = api.ValueTypeI32
+	i64 = api.ValueTypeI64
+)
 
 type wazeroRuntime struct {
 	wazero.Runtime
@@ -27,18 +32,60 @@ type wazeroRuntime struct {
 	module api.Module
 	cache  wazero.CompilationCache
 
+	compiled wazero.CompiledModule
+	timeout  time.Duration
+
 	observed      []uint32
 	wanted        string
 	serverlessCtx serverless.Context
+	timers        *timers
 	mu            sync.Mutex
 }
 
-func newWazeroRuntime() (*wazeroRuntime, error) {
+func init() {
+	RegisterRuntime("wazero", newWazeroRuntime)
+}
+
+func newWazeroRuntime(opts RuntimeOptions) (Runtime, error) {
 	ctx := context.Background()
 
+	var runConfig wazero.RuntimeConfig
+	switch opts.CompilationMode {
+	case "":
+		runConfig = wazero.NewRuntimeConfig()
+	case CompilationModeCompiler:
+		runConfig = wazero.NewRuntimeConfigCompiler()
+	case CompilationModeInterpreter:
+		runConfig = wazero.NewRuntimeConfigInterpreter()
+	default:
+		return nil, fmt.Errorf("invalid compilation mode: %s, compiler and interpreter are supported by wazero", opts.CompilationMode)
+	}
+	if opts.Fuel > 0 {
+		return nil, errors.New("fuel metering is not supported by wazero, use the execution timeout instead")
+	}
+	if opts.MemoryLimit > 0 {
+		// a wasm page is 64KiB, and the linear memory is limited to 4GiB (65536 pages).
+		pages := opts.MemoryLimit * 16
+		if opts.MemoryLimit > 4096 {
+			pages = 65536
+		}
+		runConfig = runConfig.WithMemoryLimitPages(pages)
+	}
+	if opts.Timeout > 0 {
+		// close the module when the invocation exceeds the timeout, so the runaway sfn can be terminated.
+		runConfig = runConfig.WithCloseOnContextDone(true)
+	}
+
 	cache := wazero.NewCompilationCache()
-	runConfig := wazero.NewRuntimeConfig().
-		WithCompilationCache(cache)
+	// the compiled modules are keyed by the module hash and the wazero version in the dir cache
+	if opts.CacheDir != "" {
+		dirCache, err := wazero.NewCompilationCacheWithDir(opts.CacheDir)
+		if err != nil {
+			return nil, fmt.Errorf("wazero.CompilationCache: %v", err)
+		}
+		cache = dirCache
+	}
+	runConfig = runConfig.WithCompilationCache(cache)
 	r := wazero.NewRuntimeWithConfig(ctx, runConfig)
 	// Instantiate WASI, which implements host functions needed for TinyGo to implement `panic`.
 	wasi_snapshot_preview1.MustInstantiate(ctx, r)
@@ -61,6 +108,8 @@ func newWazeroRuntime() (*wazeroRuntime, error) {
 		conf:    config,
 		ctx:     ctx,
 		cache:   cache,
+		timeout: opts.Timeout,
+		timers:  newTimers(opts.TimerWriter),
 	}, nil
 }
 
@@ -88,6 +137,10 @@ func (r *wazeroRuntime) Init(wasmFile string) error {
 		NewFunctionBuilder().
 		WithGoModuleFunction(api.GoModuleFunc(r.writeWithTarget), []api.ValueType{i32, i32, i32, i32, i32}, []api.ValueType{i32}).
 		Export(WasmFuncWriteWithTarget).
+		// write with metadata
+		NewFunctionBuilder().
+		WithGoModuleFunction(api.GoModuleFunc(r.writeWithMetadata), []api.ValueType{i32, i32, i32, i32, i32}, []api.ValueType{i32}).
+		Export(WasmFuncWriteWithMetadata).
 		// context tag
 		NewFunctionBuilder().
 		WithGoFunction(api.GoFunc(r.contextTag), []api.ValueType{}, []api.ValueType{i32}).
@@ -99,9 +152,31 @@ func (r *wazeroRuntime) Init(wasmFile string) error {
 		// context data size
 		NewFunctionBuilder().
 		WithGoFunction(api.GoFunc(r.contextDataSize), []api.ValueType{}, []api.ValueType{i32}).
-		Export(WasmFuncContextDataSize)
+		Export(WasmFuncContextDataSize).
+		// now
+		NewFunctionBuilder().
+		WithGoFunction(api.GoFunc(r.now), []api.ValueType{}, []api.ValueType{i64}).
+		Export(WasmFuncNow).
+		// emit after
+		NewFunctionBuilder().
+		WithGoModuleFunction(api.GoModuleFunc(r.emitAfter), []api.ValueType{i32, i32, i32, i32}, []api.ValueType{i32}).
+		Export(WasmFuncEmitAfter).
+		// emit every
+		NewFunctionBuilder().
+		WithGoModuleFunction(api.GoModuleFunc(r.emitEvery), []api.ValueType{i32, i32, i32, i32}, []api.ValueType{i32}).
+		Export(WasmFuncEmitEvery).
+		// cancel timer
+		NewFunctionBuilder().
+		WithGoFunction(api.GoFunc(r.cancelTimer), []api.ValueType{i32}, []api.ValueType{i32}).
+		Export(WasmFuncCancelTimer)
 	// http
 	host.ExportHTTPHostFuncs(builder)
+	// state
+	host.ExportStateHostFuncs(builder, r.state)
+	// metadata
+	host.ExportMetadataHostFuncs(builder, r.context)
+	// data stream
+	host.ExportStreamHostFuncs(builder, r.context)
 
 	// Instantiate
 	_, err = builder.Instantiate(r.ctx)
@@ -109,11 +184,23 @@ func (r *wazeroRuntime) Init(wasmFile string) error {
 		return fmt.Errorf("wazero.HostFunc: %v", err)
 	}
 
-	module, err := r.InstantiateWithConfig(r.ctx, wasmBytes, r.conf)
+	compiled, err := r.CompileModule(r.ctx, wasmBytes)
+	if err != nil {
+		return fmt.Errorf("wazero.Module: %v", err)
+	}
+	r.compiled = compiled
+
+	return r.instantiate()
+}
+
+// instantiate instantiates the compiled module, and collects the observed datatags and wanted target.
+func (r *wazeroRuntime) instantiate() error {
+	module, err := r.InstantiateModule(r.ctx, r.compiled, r.conf)
 	if err != nil {
 		return fmt.Errorf("wazero.Module: %v", err)
 	}
 	r.module = module
+	r.observed = nil
 
 	observeDataTagsFunc := module.ExportedFunction(WasmFuncObserveDataTags)
 	if observeDataTagsFunc == nil {
@@ -164,21 +251,56 @@ func (r *wazeroRuntime) RunHandler(ctx serverless.Context) error {
 	}
 	r.serverlessCtx = ctx
 	// run handler
+	callCtx := r.ctx
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(r.ctx, r.timeout)
+		defer cancel()
+	}
 	handler := r.module.ExportedFunction(WasmFuncHandler)
-	if _, err := handler.Call(r.ctx); err != nil {
-		if exitErr, ok := err.(*sys.ExitError); ok && exitErr.ExitCode() != 0 {
-			return fmt.Errorf("handler.Call: %v", err)
-		} else if !ok {
-			return fmt.Errorf("handler.Call: %v", err)
+	_, err := handler.Call(callCtx)
+	if err == nil {
+		return nil
+	}
+	exitErr, ok := err.(*sys.ExitError)
+	if ok && exitErr.ExitCode() == 0 {
+		return nil
+	}
+	// the module is closed if it exited or was terminated, re-instantiate it for the next invocation.
+	if r.module.IsClosed() {
+		if rerr := r.reinstantiate(); rerr != nil {
+			log.Printf("[wasm] re-instantiate module error: %v\n", rerr)
 		}
 	}
-	return nil
+	if ok && exitErr.ExitCode() == sys.ExitCodeDeadlineExceeded {
+		return fmt.Errorf("handler.Call: %w: timeout %s", ErrExecutionLimitExceeded, r.timeout)
+	}
+	return fmt.Errorf("handler.Call: %v", err)
+}
+
+func (r *wazeroRuntime) reinstantiate() error {
+	if err := r.instantiate(); err != nil {
+		return err
+	}
+	return r.RunInit()
 }
 
 // Close releases all the resources related to the runtime
 func (r *wazeroRuntime) Close() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	r.timers.close()
+	// close function is optional
+	if r.module != nil && !r.module.IsClosed() {
+		if closeFunc := r.module.ExportedFunction(WasmFuncClose); closeFunc != nil {
+			if _, err := closeFunc.Call(r.ctx); err != nil {
+				log.Printf("[wasm] %s.Call: %v\n", WasmFuncClose, err)
+			}
+		}
+	}
+	if r.compiled != nil {
+		r.compiled.Close(r.ctx)
+	}
 	r.cache.Close(r.ctx)
 	return r.Runtime.Close(r.ctx)
 }
@@ -204,6 +326,22 @@ func (r *wazeroRuntime) RunInit() error {
 	return nil
 }
 
+// context returns the serverless context of the current invocation, it is called by the host
+// functions during RunHandler, so r.mu has been held.
+func (r *wazeroRuntime) context() serverless.Context {
+	return r.serverlessCtx
+}
+
+// state returns the state of the current invocation, it is called by the host functions
+// during RunHandler, so r.mu has been held.
+func (r *wazeroRuntime) state() serverless.State {
+	if r.serverlessCtx == nil {
+		return nil
+	}
+	state, _ := serverless.GetState(r.serverlessCtx)
+	return state
+}
+
 func (r *wazeroRuntime) observeDataTag(ctx context.Context, stack []uint64) {
 	tag := uint32(stack[0])
 	r.observed = append(r.observed, tag)
@@ -272,7 +410,45 @@ func (r *wazeroRuntime) writeWithTarget(ctx context.Context, m api.Module, stack
 	tbuf := make([]byte, targetLength)
 	copy(tbuf, toutput)
 
-	if err := r.serverlessCtx.WriteWithTarget(tag, tbuf, string(tbuf)); err != nil {
+	if err := r.serverlessCtx.WriteWithTarget(tag, buf, string(tbuf)); err != nil {
+		stack[0] = 2
+		return
+	}
+	stack[0] = 0
+}
+
+func (r *wazeroRuntime) writeWithMetadata(ctx context.Context, m api.Module, stack []uint64) {
+	tag := uint32(stack[0])
+
+	pointer := uint32(stack[1])
+	length := uint32(stack[2])
+
+	mdPointer := uint32(stack[3])
+	mdLength := uint32(stack[4])
+
+	output, ok := m.Memory().Read(pointer, length)
+	if !ok {
+		log.Printf("Memory.Read(%d, %d) out of range\n", pointer, length)
+		stack[0] = 1
+		return
+	}
+	buf := make([]byte, length)
+	copy(buf, output)
+
+	mdOutput, ok := m.Memory().Read(mdPointer, mdLength)
+	if !ok {
+		log.Printf("Memory.Read(%d, %d) out of range\n", mdPointer, mdLength)
+		stack[0] = 1
+		return
+	}
+	var md map[string]string
+	if err := json.Unmarshal(mdOutput, &md); err != nil {
+		log.Printf("unmarshal metadata error: %v\n", err)
+		stack[0] = 1
+		return
+	}
+
+	if err := r.serverlessCtx.WriteWithMetadata(tag, buf, md); err != nil {
 		stack[0] = 2
 		return
 	}
@@ -306,3 +482,48 @@ func (r *wazeroRuntime) contextData(ctx context.Context, m api.Module, stack []u
 func (r *wazeroRuntime) contextDataSize(ctx context.Context, stack []uint64) {
 	stack[0] = uint64(len(r.serverlessCtx.Data()))
 }
+
+func (r *wazeroRuntime) now(ctx context.Context, stack []uint64) {
+	stack[0] = uint64(r.timers.now())
+}
+
+func (r *wazeroRuntime) emitAfter(ctx context.Context, m api.Module, stack []uint64) {
+	r.scheduleEmit(m, stack, false)
+}
+
+func (r *wazeroRuntime) emitEvery(ctx context.Context, m api.Module, stack []uint64) {
+	r.scheduleEmit(m, stack, true)
+}
+
+// scheduleEmit schedules a timer to write the payload, the timer id is returned to the guest,
+// 0 means the timer was not scheduled.
+func (r *wazeroRuntime) scheduleEmit(m api.Module, stack []uint64, periodic bool) {
+	ms := uint32(stack[0])
+	tag := uint32(stack[1])
+	pointer := uint32(stack[2])
+	length := uint32(stack[3])
+	output, ok := m.Memory().Read(pointer, length)
+	if !ok {
+		log.Printf("Memory.Read(%d, %d) out of range\n", pointer, length)
+		stack[0] = 0
+		return
+	}
+	buf := make([]byte, length)
+	copy(buf, output)
+
+	d := time.Duration(ms) * time.Millisecond
+	stack[0] = uint64(r.timers.emitAfter(d, tag, buf, periodic))
+}
+
+// CancelTimers cancels all the timers scheduled by the wasm sfn.
+func (r *wazeroRuntime) CancelTimers() {
+	r.timers.cancelAll()
+}
+
+func (r *wazeroRuntime) cancelTimer(ctx context.Context, stack []uint64) {
+	if !r.timers.cancel(uint32(stack[0])) {
+		stack[0] = 1
+		return
+	}
+	stack[0] = 0
+}
@@ -0,0 +1,116 @@
+package wazero
+
+import (
+	"context"
+	"log"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/yomorun/yomo/serverless"
+)
+
+// Define metadata host function names
+const (
+	WasmFuncContextMetadata    = "yomo_context_metadata"
+	WasmFuncContextSetMetadata = "yomo_context_set_metadata"
+)
+
+// metadataHost provides the metadata host functions, the metadata is got from the current serverless context.
+type metadataHost struct {
+	ctx func() serverless.Context
+}
+
+// ExportMetadataHostFuncs exports the metadata host functions, ctx returns the serverless context
+// of the current invocation.
+func ExportMetadataHostFuncs(builder wazero.HostModuleBuilder, ctx func() serverless.Context) {
+	h := &metadataHost{ctx: ctx}
+	builder.
+		// get
+		NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(h.get),
+			[]api.ValueType{
+				api.ValueTypeI32, // keyPtr
+				api.ValueTypeI32, // keySize
+				api.ValueTypeI32, // valuePtr
+				api.ValueTypeI32, // valueSize
+			},
+			[]api.ValueType{api.ValueTypeI32}, // ret
+		).
+		Export(WasmFuncContextMetadata).
+		// set
+		NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(h.set),
+			[]api.ValueType{
+				api.ValueTypeI32, // keyPtr
+				api.ValueTypeI32, // keySize
+				api.ValueTypeI32, // valuePtr
+				api.ValueTypeI32, // valueSize
+			},
+			[]api.ValueType{api.ValueTypeI32}, // ret
+		).
+		Export(WasmFuncContextSetMetadata)
+}
+
+// get returns 0 if the key exists, 1 if the key does not exist, and others for errors.
+func (h *metadataHost) get(ctx context.Context, m api.Module, stack []uint64) {
+	sctx := h.ctx()
+	if sctx == nil {
+		log.Printf("[Metadata] Get: context is not available\n")
+		stack[0] = 2
+		return
+	}
+	key, err := readBuffer(ctx, m, uint32(stack[0]), uint32(stack[1]))
+	if err != nil {
+		log.Printf("[Metadata] Get: get key error: %s\n", err)
+		stack[0] = 3
+		return
+	}
+	value, ok := sctx.Metadata(string(key))
+	if !ok {
+		stack[0] = 1
+		return
+	}
+	if value == "" {
+		if !m.Memory().WriteUint32Le(uint32(stack[3]), 0) {
+			stack[0] = 5
+			return
+		}
+		stack[0] = 0
+		return
+	}
+	if err := allocateBuffer(ctx, m, uint32(stack[2]), uint32(stack[3]), []byte(value)); err != nil {
+		log.Printf("[Metadata] Get: write value error: %s\n", err)
+		stack[0] = 5
+		return
+	}
+	stack[0] = 0
+}
+
+func (h *metadataHost) set(ctx context.Context, m api.Module, stack []uint64) {
+	sctx := h.ctx()
+	if sctx == nil {
+		log.Printf("[Metadata] Set: context is not available\n")
+		stack[0] = 2
+		return
+	}
+	key, err := readBuffer(ctx, m, uint32(stack[0]), uint32(stack[1]))
+	if err != nil {
+		log.Printf("[Metadata] Set: get key error: %s\n", err)
+		stack[0] = 3
+		return
+	}
+	value, err := readBuffer(ctx, m, uint32(stack[2]), uint32(stack[3]))
+	if err != nil {
+		log.Printf("[Metadata] Set: get value error: %s\n", err)
+		stack[0] = 3
+		return
+	}
+	if err := sctx.SetMetadata(string(key), string(value)); err != nil {
+		log.Printf("[Metadata] Set: %s\n", err)
+		stack[0] = 4
+		return
+	}
+	stack[0] = 0
+}
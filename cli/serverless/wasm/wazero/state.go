@@ -0,0 +1,154 @@
+package wazero
+
+import (
+	"context"
+	"log"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/yomorun/yomo/serverless"
+)
+
+// Define state host function names
+const (
+	WasmFuncStateGet    = "yomo_state_get"
+	WasmFuncStateSet    = "yomo_state_set"
+	WasmFuncStateDelete = "yomo_state_delete"
+)
+
+// stateHost provides the state host functions, the state is got from the current serverless context.
+type stateHost struct {
+	state func() serverless.State
+}
+
+// ExportStateHostFuncs exports the durable state host functions, state returns the state of
+// the current invocation.
+func ExportStateHostFuncs(builder wazero.HostModuleBuilder, state func() serverless.State) {
+	h := &stateHost{state: state}
+	builder.
+		// get
+		NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(h.get),
+			[]api.ValueType{
+				api.ValueTypeI32, // keyPtr
+				api.ValueTypeI32, // keySize
+				api.ValueTypeI32, // valuePtr
+				api.ValueTypeI32, // valueSize
+			},
+			[]api.ValueType{api.ValueTypeI32}, // ret
+		).
+		Export(WasmFuncStateGet).
+		// set
+		NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(h.set),
+			[]api.ValueType{
+				api.ValueTypeI32, // keyPtr
+				api.ValueTypeI32, // keySize
+				api.ValueTypeI32, // valuePtr
+				api.ValueTypeI32, // valueSize
+			},
+			[]api.ValueType{api.ValueTypeI32}, // ret
+		).
+		Export(WasmFuncStateSet).
+		// delete
+		NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(h.delete),
+			[]api.ValueType{
+				api.ValueTypeI32, // keyPtr
+				api.ValueTypeI32, // keySize
+			},
+			[]api.ValueType{api.ValueTypeI32}, // ret
+		).
+		Export(WasmFuncStateDelete)
+}
+
+// get returns 0 if the key exists, 1 if the key does not exist, and others for errors.
+func (h *stateHost) get(ctx context.Context, m api.Module, stack []uint64) {
+	state := h.state()
+	if state == nil {
+		log.Printf("[State] Get: state is not available\n")
+		stack[0] = 2
+		return
+	}
+	key, err := readBuffer(ctx, m, uint32(stack[0]), uint32(stack[1]))
+	if err != nil {
+		log.Printf("[State] Get: get key error: %s\n", err)
+		stack[0] = 3
+		return
+	}
+	value, ok, err := state.Get(string(key))
+	if err != nil {
+		log.Printf("[State] Get: %s\n", err)
+		stack[0] = 4
+		return
+	}
+	if !ok {
+		stack[0] = 1
+		return
+	}
+	if len(value) == 0 {
+		if !m.Memory().WriteUint32Le(uint32(stack[3]), 0) {
+			stack[0] = 5
+			return
+		}
+		stack[0] = 0
+		return
+	}
+	if err := allocateBuffer(ctx, m, uint32(stack[2]), uint32(stack[3]), value); err != nil {
+		log.Printf("[State] Get: write value error: %s\n", err)
+		stack[0] = 5
+		return
+	}
+	stack[0] = 0
+}
+
+func (h *stateHost) set(ctx context.Context, m api.Module, stack []uint64) {
+	state := h.state()
+	if state == nil {
+		log.Printf("[State] Set: state is not available\n")
+		stack[0] = 2
+		return
+	}
+	key, err := readBuffer(ctx, m, uint32(stack[0]), uint32(stack[1]))
+	if err != nil {
+		log.Printf("[State] Set: get key error: %s\n", err)
+		stack[0] = 3
+		return
+	}
+	value, err := readBuffer(ctx, m, uint32(stack[2]), uint32(stack[3]))
+	if err != nil {
+		log.Printf("[State] Set: get value error: %s\n", err)
+		stack[0] = 3
+		return
+	}
+	if err := state.Set(string(key), value); err != nil {
+		log.Printf("[State] Set: %s\n", err)
+		stack[0] = 4
+		return
+	}
+	stack[0] = 0
+}
+
+func (h *stateHost) delete(ctx context.Context, m api.Module, stack []uint64) {
+	state := h.state()
+	if state == nil {
+		log.Printf("[State] Delete: state is not available\n")
+		stack[0] = 2
+		return
+	}
+	key, err := readBuffer(ctx, m, uint32(stack[0]), uint32(stack[1]))
+	if err != nil {
+		log.Printf("[State] Delete: get key error: %s\n", err)
+		stack[0] = 3
+		return
+	}
+	if err := state.Delete(string(key)); err != nil {
+		log.Printf("[State] Delete: %s\n", err)
+		stack[0] = 4
+		return
+	}
+	stack[0] = 0
+}
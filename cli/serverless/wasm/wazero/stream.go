@@ -0,0 +1,154 @@
+package wazero
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/yomorun/yomo/serverless"
+)
+
+// Define data stream host function names
+const (
+	WasmFuncContextDataOpen  = "yomo_context_data_open"
+	WasmFuncContextDataRead  = "yomo_context_data_read"
+	WasmFuncContextDataClose = "yomo_context_data_close"
+)
+
+// streamHost provides the host functions which let the guest pull the incoming data chunk by chunk,
+// the readers are got from the serverless context of the current invocation.
+type streamHost struct {
+	ctx     func() serverless.Context
+	mu      sync.Mutex
+	next    uint32
+	readers map[uint32]*dataStream
+}
+
+// dataStream is the reader opened by the guest, it is only valid in the invocation it's opened.
+type dataStream struct {
+	ctx    serverless.Context
+	reader io.Reader
+}
+
+// ExportStreamHostFuncs exports the data stream host functions, ctx returns the serverless context
+// of the current invocation.
+func ExportStreamHostFuncs(builder wazero.HostModuleBuilder, ctx func() serverless.Context) {
+	h := &streamHost{ctx: ctx, readers: make(map[uint32]*dataStream)}
+	builder.
+		// open
+		NewFunctionBuilder().
+		WithGoFunction(
+			api.GoFunc(h.open),
+			[]api.ValueType{},
+			[]api.ValueType{api.ValueTypeI32}, // handle
+		).
+		Export(WasmFuncContextDataOpen).
+		// read
+		NewFunctionBuilder().
+		WithGoModuleFunction(
+			api.GoModuleFunc(h.read),
+			[]api.ValueType{
+				api.ValueTypeI32, // handle
+				api.ValueTypeI32, // bufPtr
+				api.ValueTypeI32, // bufSize
+			},
+			[]api.ValueType{api.ValueTypeI32}, // n
+		).
+		Export(WasmFuncContextDataRead).
+		// close
+		NewFunctionBuilder().
+		WithGoFunction(
+			api.GoFunc(h.close),
+			[]api.ValueType{api.ValueTypeI32}, // handle
+			[]api.ValueType{api.ValueTypeI32}, // ret
+		).
+		Export(WasmFuncContextDataClose)
+}
+
+// open returns the handle of the data stream, 0 means the stream is not available.
+func (h *streamHost) open(_ context.Context, stack []uint64) {
+	sctx := h.ctx()
+	if sctx == nil {
+		log.Printf("[Stream] Open: context is not available\n")
+		stack[0] = 0
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// the streams of the previous invocations are not closed by the guest, release them.
+	for handle, s := range h.readers {
+		if s.ctx != sctx {
+			h.release(handle)
+		}
+	}
+	h.next++
+	if h.next == 0 {
+		h.next = 1
+	}
+	h.readers[h.next] = &dataStream{ctx: sctx, reader: sctx.DataReader()}
+	stack[0] = uint64(h.next)
+}
+
+// read reads the next chunk into the guest buffer, it returns the number of bytes read,
+// 0 at the end of the stream, and -1 for errors.
+func (h *streamHost) read(_ context.Context, m api.Module, stack []uint64) {
+	handle := uint32(stack[0])
+	bufPtr := uint32(stack[1])
+	bufSize := uint32(stack[2])
+
+	h.mu.Lock()
+	s, ok := h.readers[handle]
+	h.mu.Unlock()
+	if !ok || s.ctx != h.ctx() {
+		log.Printf("[Stream] Read: invalid handle %d\n", handle)
+		stack[0] = api.EncodeI32(-1)
+		return
+	}
+	if bufSize == 0 {
+		stack[0] = 0
+		return
+	}
+	buf, ok := m.Memory().Read(bufPtr, bufSize)
+	if !ok {
+		log.Printf("[Stream] Read: Memory.Read(%d, %d) out of range\n", bufPtr, bufSize)
+		stack[0] = api.EncodeI32(-1)
+		return
+	}
+	// buf is a view of the guest memory, so the data is read into the guest buffer directly.
+	n, err := io.ReadAtLeast(s.reader, buf, 1)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			stack[0] = 0
+			return
+		}
+		log.Printf("[Stream] Read: %s\n", err)
+		stack[0] = api.EncodeI32(-1)
+		return
+	}
+	stack[0] = api.EncodeI32(int32(n))
+}
+
+func (h *streamHost) close(_ context.Context, stack []uint64) {
+	handle := uint32(stack[0])
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.readers[handle]; !ok {
+		stack[0] = 1
+		return
+	}
+	h.release(handle)
+	stack[0] = 0
+}
+
+// release removes the stream and closes the reader if it is closable, h.mu must be held.
+func (h *streamHost) release(handle uint32) {
+	if closer, ok := h.readers[handle].reader.(io.Closer); ok {
+		closer.Close()
+	}
+	delete(h.readers, handle)
+}
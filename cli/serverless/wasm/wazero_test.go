@@ -0,0 +1,97 @@
+package wasm
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yomorun/yomo/ai"
+)
+
+// runawayGuest never returns from the handler.
+var runawayGuest = guest{
+	tag:     0x11,
+	handler: instrs([]byte{opLoop, blockVoid}, []byte{opBr, 0x00}, []byte{opEnd}),
+}
+
+// growGuest grows the memory by 100 pages (6.25MiB) in the handler, and traps if the growth fails.
+var growGuest = guest{
+	tag: 0x11,
+	handler: instrs(
+		i32Const(100), []byte{opMemoryGrow, 0x00}, i32Const(-1), []byte{opI32Eq},
+		[]byte{opIf, blockVoid}, []byte{opUnreachable}, []byte{opEnd},
+	),
+}
+
+func newLimitedRuntime(t *testing.T, g guest, opts RuntimeOptions) Runtime {
+	t.Helper()
+	runtime, err := NewRuntime("wazero", opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { runtime.Close() })
+	require.NoError(t, runtime.Init(g.write(t)))
+	require.NoError(t, runtime.RunInit())
+	return runtime
+}
+
+func TestWazeroTimeout(t *testing.T) {
+	runtime := newLimitedRuntime(t, runawayGuest, RuntimeOptions{Timeout: 50 * time.Millisecond})
+
+	// the module is re-instantiated after the termination, so the next invocation is limited too
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		err := runtime.RunHandler(newTestContext(0x11, "data"))
+		assert.True(t, errors.Is(err, ErrExecutionLimitExceeded), "unexpected error: %v", err)
+		assert.Less(t, time.Since(start), time.Second)
+	}
+}
+
+func TestWazeroMemoryLimit(t *testing.T) {
+	t.Run("limited", func(t *testing.T) {
+		runtime := newLimitedRuntime(t, growGuest, RuntimeOptions{MemoryLimit: 1})
+
+		err := runtime.RunHandler(newTestContext(0x11, "data"))
+		assert.ErrorContains(t, err, "unreachable")
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		runtime := newLimitedRuntime(t, growGuest, RuntimeOptions{})
+
+		assert.NoError(t, runtime.RunHandler(newTestContext(0x11, "data")))
+	})
+}
+
+func TestWazeroFuel(t *testing.T) {
+	_, err := NewRuntime("wazero", RuntimeOptions{Fuel: 1000})
+	assert.ErrorContains(t, err, "fuel metering is not supported by wazero")
+}
+
+func TestHandleLimitExceeded(t *testing.T) {
+	runtime := newLimitedRuntime(t, runawayGuest, RuntimeOptions{Timeout: 50 * time.Millisecond})
+	s := &wasmServerless{runtime: runtime, runtimeType: "wazero", filename: "sfn.wasm"}
+
+	t.Run("llm function call", func(t *testing.T) {
+		ctx := newTestContext(0x11, "data")
+		ctx.fnCall = &ai.FunctionCall{ReqID: "req-1", ToolCallID: "call-1", FunctionName: "runaway"}
+		s.handle(ctx)
+
+		written := ctx.recordsWritten()
+		require.Len(t, written, 1)
+		assert.Equal(t, ai.ReducerTag, written[0].tag)
+
+		fnCall := &ai.FunctionCall{}
+		require.NoError(t, fnCall.FromBytes([]byte(written[0].data)))
+		assert.Equal(t, "req-1", fnCall.ReqID)
+		assert.Equal(t, "call-1", fnCall.ToolCallID)
+		assert.False(t, fnCall.IsOK)
+		assert.Contains(t, fnCall.Error, ErrExecutionLimitExceeded.Error())
+	})
+
+	t.Run("not llm function call", func(t *testing.T) {
+		ctx := newTestContext(0x11, "data")
+		s.handle(ctx)
+
+		assert.Empty(t, ctx.recordsWritten())
+	})
+}
@@ -10,15 +10,22 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/invopop/jsonschema"
 	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/dedup"
 	"github.com/yomorun/yomo/pkg/frame-codec/y3codec"
 	"github.com/yomorun/yomo/pkg/id"
 	yquic "github.com/yomorun/yomo/pkg/listener/quic"
+	"github.com/yomorun/yomo/pkg/signature"
+	"github.com/yomorun/yomo/serverless"
+	"golang.org/x/text/language"
 )
 
 // Client is the abstraction of a YoMo-Client. a YoMo-Client can be
@@ -44,8 +51,12 @@ type Client struct {
 	// Receiving from the reConnect channel to guarantee the client has stoped to reconnect during the reconnection.
 	reConnect chan struct{}
 
-	wrCh chan frame.Frame
-	rdCh chan readOut
+	wrCh      chan frame.Frame
+	wrBatchCh chan []frame.Frame
+	rdCh      chan readOut
+
+	// connected is true while the connection to zipper is served.
+	connected atomic.Bool
 }
 
 type readOut struct {
@@ -69,6 +80,21 @@ func NewClient(appName, zipperAddr string, clientType ClientType, opts ...Client
 
 	logger := option.logger
 
+	if option.signer == nil && (clientType == ClientTypeSource || clientType == ClientTypeStreamFunction) {
+		signer, err := signature.NewSignerFromEnv()
+		if err != nil {
+			logger.Error("the data frames are not signed", "err", err)
+		}
+		option.signer = signer
+	}
+	if option.dedup == nil && clientType == ClientTypeStreamFunction {
+		w, err := dedup.NewFromEnv(appName)
+		if err != nil {
+			logger.Error("the duplicate data frames are not suppressed", "err", err)
+		}
+		option.dedup = w
+	}
+
 	ctx, ctxCancel := context.WithCancelCause(context.Background())
 
 	return &Client{
@@ -85,6 +111,7 @@ func NewClient(appName, zipperAddr string, clientType ClientType, opts ...Client
 		done:      make(chan struct{}),
 		reConnect: make(chan struct{}),
 		wrCh:      make(chan frame.Frame),
+		wrBatchCh: make(chan []frame.Frame),
 		rdCh:      make(chan readOut),
 	}
 }
@@ -168,6 +195,10 @@ func (c *Client) runBackground(conn frame.Conn) {
 
 func (c *Client) handleConn(conn frame.Conn) (closed bool) {
 	if err := c.serveConn(conn); err != nil {
+		// the zipper drains the connection, reconnect without reporting the error.
+		if e := new(ErrGoawayReconnect); errors.As(err, &e) {
+			return false
+		}
 		if c.errorfn != nil {
 			c.errorfn(err)
 		} else {
@@ -185,7 +216,11 @@ func (c *Client) handleConn(conn frame.Conn) (closed bool) {
 }
 
 func (c *Client) connect(ctx context.Context, addr string) (frame.Conn, error) {
-	conn, err := yquic.DialAddr(ctx, addr, y3codec.Codec(), y3codec.PacketReadWriter(), c.opts.tlsConfig, c.opts.quicConfig)
+	dial := yquic.DialAddr
+	if c.opts.mux != nil {
+		dial = c.opts.mux.DialAddr
+	}
+	conn, err := dial(ctx, addr, y3codec.Codec(), y3codec.PacketReadWriter(), c.opts.tlsConfig, c.opts.quicConfig)
 	if err != nil {
 		return conn, err
 	}
@@ -203,6 +238,7 @@ func (c *Client) connect(ctx context.Context, addr string) (frame.Conn, error) {
 		AuthPayload:     c.opts.credential.Payload(),
 		Version:         Version,
 		WantedTarget:    c.wantedTarget,
+		ObserveTopics:   c.opts.observeTopics,
 	}
 
 	err = c.handshakeWithDefinition(hf)
@@ -254,6 +290,20 @@ func (c *Client) handshakeWithDefinition(hf *frame.HandshakeFrame) error {
 	if functionDefinition == nil {
 		return nil
 	}
+	if c.opts.aiFunctionVersion != "" || len(c.opts.aiFunctionAliases) > 0 || len(c.opts.aiFunctionDescriptions) > 0 ||
+		c.opts.aiFunctionCallPolicy != nil {
+		registration := &ai.FunctionRegistration{
+			Version:      c.opts.aiFunctionVersion,
+			Aliases:      c.opts.aiFunctionAliases,
+			Descriptions: c.opts.aiFunctionDescriptions,
+			Policy:       c.opts.aiFunctionCallPolicy,
+		}
+		functionDefinition, err = withAIFunctionRegistration(functionDefinition, registration)
+		if err != nil {
+			c.Logger.Error("parse ai function registration error", "err", err)
+			return err
+		}
+	}
 	hf.FunctionDefinition = functionDefinition
 	return nil
 }
@@ -281,49 +331,178 @@ func parseAIFunctionDefinition(sfnName, aiFunctionDescription string, aiFunction
 	return buf, nil
 }
 
+// withAIFunctionRegistration attaches the version, aliases, localized descriptions and call policy to the function definition,
+// the bridges which don't support them ignore them.
+func withAIFunctionRegistration(functionDefinition []byte, registration *ai.FunctionRegistration) ([]byte, error) {
+	if err := json.Unmarshal(functionDefinition, registration); err != nil {
+		return nil, err
+	}
+	for _, alias := range registration.Aliases {
+		if alias == "" || strings.Contains(alias, ",") {
+			return nil, fmt.Errorf("invalid function alias: %q", alias)
+		}
+	}
+	for lang := range registration.Descriptions {
+		if _, err := language.Parse(lang); err != nil {
+			return nil, fmt.Errorf("invalid description language: %q", lang)
+		}
+	}
+	buf, err := json.Marshal(registration)
+	if err != nil {
+		return nil, fmt.Errorf("marshal function definition error: %s", err.Error())
+	}
+	return buf, nil
+}
+
+// parseAIFunctionParameters derives the function parameters from the input model struct, the fields are described
+// by the `jsonschema` tags, eg: description, enum, minimum, maximum. The fields without `omitempty` are required,
+// and the nested structs and slices are resolved to objects and arrays.
 func parseAIFunctionParameters(inputModel any) (*ai.FunctionParameters, error) {
 	schema := jsonschema.Reflect(inputModel)
-	for _, m := range schema.Definitions {
-		functionParameters := &ai.FunctionParameters{
-			Type:       m.Type,
-			Required:   m.Required,
-			Properties: make(map[string]*ai.ParameterProperty),
+	root, err := parseParameterProperty(schema, schema.Definitions, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	if root.Type != "object" {
+		return nil, errors.New("invalid function definition")
+	}
+	functionParameters := &ai.FunctionParameters{
+		Type:       root.Type,
+		Required:   root.Required,
+		Properties: root.Properties,
+	}
+	if functionParameters.Properties == nil {
+		functionParameters.Properties = make(map[string]*ai.ParameterProperty)
+	}
+	return functionParameters, nil
+}
+
+// parseParameterProperty converts the json schema to the parameter property, the references are resolved
+// from the definitions, resolving marks the definitions being resolved to detect the recursive types.
+func parseParameterProperty(schema *jsonschema.Schema, defs jsonschema.Definitions, resolving map[string]bool) (*ai.ParameterProperty, error) {
+	description := schema.Description
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/$defs/")
+		def, ok := defs[name]
+		if !ok {
+			return nil, fmt.Errorf("definition %s not found", name)
+		}
+		if resolving[name] {
+			return nil, fmt.Errorf("recursive type %s is not supported", name)
 		}
+		resolving[name] = true
+		defer delete(resolving, name)
 
-		for pair := m.Properties.Oldest(); pair != nil; pair = pair.Next() {
-			functionParameters.Properties[pair.Key] = &ai.ParameterProperty{
-				Type:        pair.Value.Type,
-				Description: pair.Value.Description,
+		schema = def
+		if description == "" {
+			description = def.Description
+		}
+	}
+
+	property := &ai.ParameterProperty{
+		Type:        schema.Type,
+		Description: description,
+		Enum:        schema.Enum,
+		Minimum:     schema.Minimum,
+		Maximum:     schema.Maximum,
+		MinLength:   schema.MinLength,
+		MaxLength:   schema.MaxLength,
+		MinItems:    schema.MinItems,
+		MaxItems:    schema.MaxItems,
+		Required:    schema.Required,
+	}
+	if schema.Items != nil {
+		items, err := parseParameterProperty(schema.Items, defs, resolving)
+		if err != nil {
+			return nil, err
+		}
+		property.Items = items
+	}
+	if schema.Properties != nil {
+		property.Properties = make(map[string]*ai.ParameterProperty, schema.Properties.Len())
+		for pair := schema.Properties.Oldest(); pair != nil; pair = pair.Next() {
+			p, err := parseParameterProperty(pair.Value, defs, resolving)
+			if err != nil {
+				return nil, err
 			}
+			property.Properties[pair.Key] = p
 		}
-		return functionParameters, nil
 	}
-	return nil, errors.New("invalid function definition")
+	return property, nil
 }
 
 // WriteFrame write frame to client.
 func (c *Client) WriteFrame(f frame.Frame) error {
+	return c.WriteFrameContext(context.Background(), f)
+}
+
+// WriteFrameContext writes a frame to client like WriteFrame, the write blocked on a congested
+// connection returns the cause of the ctx once the ctx is done, eg: the deadline is exceeded.
+func (c *Client) WriteFrameContext(ctx context.Context, f frame.Frame) error {
+	if err := ctx.Err(); err != nil {
+		return context.Cause(ctx)
+	}
+	if df, ok := f.(*frame.DataFrame); ok && c.opts.signer != nil {
+		if err := c.opts.signer.Sign(df); err != nil {
+			return err
+		}
+	}
 	if c.opts.nonBlockWrite {
-		return c.nonBlockWriteFrame(f)
+		return c.nonBlockWriteFrame(ctx, f)
+	}
+	return c.blockWriteFrame(ctx, f)
+}
+
+// WriteFrames writes the frames to client in one write, the frames are sent back to back
+// without waiting for each other. It's always in block mode.
+func (c *Client) WriteFrames(fs ...frame.Frame) error {
+	return c.WriteFramesContext(context.Background(), fs...)
+}
+
+// WriteFramesContext writes the frames to client in one write like WriteFrames, the write
+// blocked on a congested connection returns the cause of the ctx once the ctx is done.
+func (c *Client) WriteFramesContext(ctx context.Context, fs ...frame.Frame) error {
+	if err := ctx.Err(); err != nil {
+		return context.Cause(ctx)
+	}
+	if c.opts.signer != nil {
+		for _, f := range fs {
+			if df, ok := f.(*frame.DataFrame); ok {
+				if err := c.opts.signer.Sign(df); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	select {
+	case <-c.ctx.Done():
+		return context.Cause(c.ctx)
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case c.wrBatchCh <- fs:
 	}
-	return c.blockWriteFrame(f)
+	return nil
 }
 
 // blockWriteFrame writes frames in block mode, guaranteeing that frames are not lost.
-func (c *Client) blockWriteFrame(f frame.Frame) error {
+func (c *Client) blockWriteFrame(ctx context.Context, f frame.Frame) error {
 	select {
 	case <-c.ctx.Done():
 		return context.Cause(c.ctx)
+	case <-ctx.Done():
+		return context.Cause(ctx)
 	case c.wrCh <- f:
 	}
 	return nil
 }
 
 // nonBlockWriteFrame writes frames in non-blocking mode, without guaranteeing that frames will not be lost.
-func (c *Client) nonBlockWriteFrame(f frame.Frame) error {
+func (c *Client) nonBlockWriteFrame(ctx context.Context, f frame.Frame) error {
 	select {
 	case <-c.ctx.Done():
 		return context.Cause(c.ctx)
+	case <-ctx.Done():
+		return context.Cause(ctx)
 	case c.wrCh <- f:
 		return nil
 	case <-time.After(time.Second):
@@ -357,7 +536,23 @@ func (c *Client) Wait() {
 	}
 }
 
+// writeFrames writes the frames in one write if the conn is a frame.BatchWriter, otherwise one by one.
+func writeFrames(conn frame.Conn, fs []frame.Frame) error {
+	if bw, ok := conn.(frame.BatchWriter); ok {
+		return bw.WriteFrames(fs...)
+	}
+	for _, f := range fs {
+		if err := conn.WriteFrame(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *Client) serveConn(conn frame.Conn) error {
+	c.connected.Store(true)
+	defer c.connected.Store(false)
+
 	go func() {
 		for {
 			f, err := conn.ReadFrame()
@@ -380,10 +575,25 @@ func (c *Client) serveConn(conn frame.Conn) error {
 			if err := conn.WriteFrame(f); err != nil {
 				return err
 			}
+		case fs := <-c.wrBatchCh:
+			if err := writeFrames(conn, fs); err != nil {
+				return err
+			}
 		case out := <-c.rdCh:
 			if err := out.err; err != nil {
 				return err
 			}
+			if ff, ok := out.frame.(*frame.GoawayFrame); ok && ff.Reconnect {
+				c.Logger.Info("the zipper asks to reconnect", "reason", ff.Message)
+				_ = conn.CloseWithError(ff.Message)
+				// the reading goroutine exits with the error of the closed connection.
+				for out := range c.rdCh {
+					if out.err != nil {
+						break
+					}
+				}
+				return &ErrGoawayReconnect{Reason: ff.Message}
+			}
 			func() {
 				defer func() {
 					if e := recover(); e != nil {
@@ -411,12 +621,43 @@ func (c *Client) handleFrame(f frame.Frame) {
 		c.Logger.Error("rejected error", "err", ff.Message)
 		_ = c.Close()
 	case *frame.DataFrame:
+		if err := c.verify(ff); err != nil {
+			c.Logger.Warn("dropped the data frame", "tag", ff.Tag, "err", err)
+			return
+		}
+		if c.duplicate(ff) {
+			c.Logger.Debug("dropped the duplicate data frame", "tag", ff.Tag)
+			return
+		}
 		c.processor(ff)
 	default:
 		c.Logger.Warn("received unexpected frame", "frame_type", f.Type().String())
 	}
 }
 
+func (c *Client) verify(f *frame.DataFrame) error {
+	if c.opts.verifier == nil {
+		return nil
+	}
+	md, err := metadata.Decode(f.Metadata)
+	if err != nil {
+		return err
+	}
+	return c.opts.verifier.Verify(f, md)
+}
+
+// duplicate returns true if the frame id of the data frame has been seen by the dedup window.
+func (c *Client) duplicate(f *frame.DataFrame) bool {
+	if c.opts.dedup == nil {
+		return false
+	}
+	md, err := metadata.Decode(f.Metadata)
+	if err != nil {
+		return false
+	}
+	return c.opts.dedup.Duplicate(f.Tag, md)
+}
+
 // SetDataFrameObserver sets the data frame handler.
 func (c *Client) SetDataFrameObserver(fn func(*frame.DataFrame)) {
 	c.processor = fn
@@ -427,6 +668,11 @@ func (c *Client) SetObserveDataTags(tag ...frame.Tag) {
 	c.opts.observeDataTags = tag
 }
 
+// SetObserveTopics set the topic filters that will be observed.
+func (c *Client) SetObserveTopics(filters ...string) {
+	c.opts.observeTopics = filters
+}
+
 // SetErrorHandler set error handler
 func (c *Client) SetErrorHandler(fn func(err error)) {
 	c.errorfn = fn
@@ -436,9 +682,21 @@ func (c *Client) SetErrorHandler(fn func(err error)) {
 // ClientID returns the ID of client.
 func (c *Client) ClientID() string { return c.clientID }
 
+// StateStore returns the state store of client, it returns nil if the store has not been set.
+func (c *Client) StateStore() serverless.State { return c.opts.stateStore }
+
 // Name returns the name of client.
 func (c *Client) Name() string { return c.name }
 
+// Connected returns true if the client is connected to zipper, it is false while reconnecting.
+func (c *Client) Connected() bool { return c.connected.Load() }
+
+// NearestRouting returns true if the data written by the client is routed to the nearest instance.
+func (c *Client) NearestRouting() bool { return c.opts.nearestRouting }
+
+// IsAIFunction returns true if the client is registered as an AI function.
+func (c *Client) IsAIFunction() bool { return c.opts.aiFunctionDescription != "" }
+
 // Downstream represents a frame writer that can connect to an addr.
 type Downstream interface {
 	frame.Writer
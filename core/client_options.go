@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
 	"log/slog"
@@ -13,10 +14,15 @@ import (
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/logging"
 	"github.com/quic-go/quic-go/qlog"
+	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core/auth"
 	"github.com/yomorun/yomo/core/frame"
 	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/dedup"
+	yquic "github.com/yomorun/yomo/pkg/listener/quic"
+	"github.com/yomorun/yomo/pkg/signature"
 	pkgtls "github.com/yomorun/yomo/pkg/tls"
+	"github.com/yomorun/yomo/serverless"
 )
 
 // ClientOption YoMo client options
@@ -25,15 +31,29 @@ type ClientOption func(*clientOptions)
 // clientOptions are the options for YoMo client.
 type clientOptions struct {
 	observeDataTags []frame.Tag
+	observeTopics   []string
 	quicConfig      *quic.Config
 	tlsConfig       *tls.Config
 	credential      *auth.Credential
 	reconnect       bool
 	nonBlockWrite   bool
+	nearestRouting  bool
 	logger          *slog.Logger
 	// ai function
-	aiFunctionInputModel  any
-	aiFunctionDescription string
+	aiFunctionInputModel   any
+	aiFunctionDescription  string
+	aiFunctionVersion      string
+	aiFunctionAliases      []string
+	aiFunctionDescriptions map[string]string
+	aiFunctionCallPolicy   *ai.CallPolicy
+	// state store of the sfn
+	stateStore serverless.State
+	// signing and verifying the data frames
+	signer   *signature.Signer
+	verifier *signature.Verifier
+	dedup    *dedup.Window
+	// the connections shared with the other clients
+	mux *yquic.Mux
 }
 
 // DefaultClientQuicConfig be used when the `quicConfig` of client is nil.
@@ -77,6 +97,48 @@ func WithClientTLSConfig(tc *tls.Config) ClientOption {
 	}
 }
 
+// WithClientRootCAs sets the root CAs verifying the certificate of the zipper, it overrides the CA cert of
+// YOMO_TLS_CACERT_FILE for the client, so one process can talk to the zippers in different trust domains.
+// Setting the root CAs enables verifying the certificate of the zipper even if YOMO_TLS_VERIFY_PEER is not
+// true, WithClientInsecureSkipVerify(true) after it skips verifying again.
+func WithClientRootCAs(pool *x509.CertPool) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = o.tlsConfig.Clone()
+		o.tlsConfig.RootCAs = pool
+		if pool != nil {
+			o.tlsConfig.InsecureSkipVerify = false
+		}
+	}
+}
+
+// WithClientCertificate sets the certificate presented to the zipper, it overrides the certificate of
+// YOMO_TLS_CERT_FILE and YOMO_TLS_KEY_FILE for the client.
+func WithClientCertificate(cert tls.Certificate) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = o.tlsConfig.Clone()
+		o.tlsConfig.Certificates = []tls.Certificate{cert}
+		o.tlsConfig.GetClientCertificate = nil
+	}
+}
+
+// WithClientServerName sets the server name (SNI) of the zipper verified by the client, the host of the
+// zipper address is used if it is not set.
+func WithClientServerName(name string) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = o.tlsConfig.Clone()
+		o.tlsConfig.ServerName = name
+	}
+}
+
+// WithClientInsecureSkipVerify sets whether the client skips verifying the certificate of the zipper,
+// it overrides YOMO_TLS_VERIFY_PEER for the client.
+func WithClientInsecureSkipVerify(skip bool) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = o.tlsConfig.Clone()
+		o.tlsConfig.InsecureSkipVerify = skip
+	}
+}
+
 // WithClientQuicConfig sets quic config for the client.
 func WithClientQuicConfig(qc *quic.Config) ClientOption {
 	return func(o *clientOptions) {
@@ -98,6 +160,15 @@ func WithNonBlockWrite() ClientOption {
 	}
 }
 
+// WithNearestRouting makes the data written by the client routed to the nearest one of the instances observing
+// the tag, the nearest instance is the one with the lowest RTT to the zipper, eg: the tool calls of the llm bridge
+// are executed once by the instance closest to the zipper instead of every region.
+func WithNearestRouting() ClientOption {
+	return func(o *clientOptions) {
+		o.nearestRouting = true
+	}
+}
+
 // WithLogger sets logger for the client.
 func WithLogger(logger *slog.Logger) ClientOption {
 	return func(o *clientOptions) {
@@ -113,6 +184,69 @@ func WithAIFunctionDefinition(description string, inputModel any) ClientOption {
 	}
 }
 
+// WithAIFunctionVersion sets the version and aliases of the AI function, the bridge exposes the latest version
+// of the function unless the version is pinned by the metadata of the credential.
+func WithAIFunctionVersion(version string, aliases ...string) ClientOption {
+	return func(o *clientOptions) {
+		o.aiFunctionVersion = version
+		o.aiFunctionAliases = aliases
+	}
+}
+
+// WithAIFunctionDescriptions sets the localized descriptions of the AI function, the key is the language tag,
+// eg: zh-CN. The bridge selects the description by the Accept-Language header of the request.
+func WithAIFunctionDescriptions(descriptions map[string]string) ClientOption {
+	return func(o *clientOptions) {
+		o.aiFunctionDescriptions = descriptions
+	}
+}
+
+// WithAIFunctionCallPolicy sets the retry policy and timeout of the AI function, the bridge retries the function
+// calling which fails with the retryable error codes, so the function must be idempotent to be retried.
+func WithAIFunctionCallPolicy(policy ai.CallPolicy) ClientOption {
+	return func(o *clientOptions) {
+		o.aiFunctionCallPolicy = &policy
+	}
+}
+
+// WithStateStore sets the durable state store for the client, the store is accessed by serverless.GetState(ctx) in sfn.
+func WithStateStore(store serverless.State) ClientOption {
+	return func(o *clientOptions) {
+		o.stateStore = store
+	}
+}
+
+// WithSigner signs the data frames written by the client, the signer is created from the
+// YOMO_SIGNING_* environment variables for the source and the sfn if it is not set.
+func WithSigner(signer *signature.Signer) ClientOption {
+	return func(o *clientOptions) {
+		o.signer = signer
+	}
+}
+
+// WithVerifier verifies the data frames received by the client, the frames failed to verify are dropped.
+func WithVerifier(verifier *signature.Verifier) ClientOption {
+	return func(o *clientOptions) {
+		o.verifier = verifier
+	}
+}
+
+// WithDedup drops the data frames received by the client whose frame ids have been seen in the window,
+// so the handler of the sfn handles the frames delivered more than once only once.
+func WithDedup(w *dedup.Window) ClientOption {
+	return func(o *clientOptions) {
+		o.dedup = w
+	}
+}
+
+// WithConnectionMux makes the client share the QUIC connection to the zipper with the other clients
+// dialed by the mux, the client transmits the frames upon its own stream of the connection.
+func WithConnectionMux(mux *yquic.Mux) ClientOption {
+	return func(o *clientOptions) {
+		o.mux = mux
+	}
+}
+
 // qlog helps developers to debug quic protocol.
 // See more: https://github.com/quic-go/quic-go?tab=readme-ov-file#quic-event-logging-using-qlog
 func qlogTraceEnabled() bool {
@@ -3,6 +3,10 @@ package core
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -11,6 +15,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core/frame"
 	"github.com/yomorun/yomo/core/metadata"
 	"github.com/yomorun/yomo/core/router"
@@ -337,6 +342,24 @@ type testParameters struct {
 	Age  string `json:"age" jsonschema:"description=age"`
 }
 
+type testNestedParameters struct {
+	Unit      string         `json:"unit" jsonschema:"description=temperature unit,enum=celsius,enum=fahrenheit"`
+	Days      int            `json:"days,omitempty" jsonschema:"description=forecast days,minimum=1,maximum=7"`
+	Location  testLocation   `json:"location" jsonschema:"description=the location"`
+	Waypoints []testLocation `json:"waypoints,omitempty" jsonschema:"description=the waypoints"`
+	Tags      []string       `json:"tags,omitempty" jsonschema:"maxItems=3"`
+}
+
+type testLocation struct {
+	City string  `json:"city" jsonschema:"description=city name,minLength=1"`
+	Lat  float64 `json:"lat,omitempty"`
+}
+
+type testRecursiveFn struct {
+	Name     string             `json:"name"`
+	Children []*testRecursiveFn `json:"children"`
+}
+
 func TestParseAIFunctionDefinition(t *testing.T) {
 	type args struct {
 		sfnName               string
@@ -359,12 +382,114 @@ func TestParseAIFunctionDefinition(t *testing.T) {
 			want:    []byte(`{"name":"test sfn name","description":"test description","parameters":{"type":"object","properties":{"age":{"type":"string","description":"age"},"name":{"type":"string","description":"name"}},"required":["name","age"]}}`),
 			wantErr: false,
 		},
+		{
+			name: "nested",
+			args: args{
+				sfnName:               "test sfn name",
+				aiFunctionDescription: "test description",
+				aiFunctionInputModel:  &testNestedParameters{},
+			},
+			want:    []byte(`{"name":"test sfn name","description":"test description","parameters":{"type":"object","properties":{"days":{"type":"integer","description":"forecast days","minimum":1,"maximum":7},"location":{"type":"object","description":"the location","properties":{"city":{"type":"string","description":"city name","minLength":1},"lat":{"type":"number","description":""}},"required":["city"]},"tags":{"type":"array","description":"","maxItems":3,"items":{"type":"string","description":""}},"unit":{"type":"string","description":"temperature unit","enum":["celsius","fahrenheit"]},"waypoints":{"type":"array","description":"the waypoints","items":{"type":"object","description":"","properties":{"city":{"type":"string","description":"city name","minLength":1},"lat":{"type":"number","description":""}},"required":["city"]}}},"required":["unit","location"]}}`),
+			wantErr: false,
+		},
+		{
+			name: "recursive",
+			args: args{
+				sfnName:               "test sfn name",
+				aiFunctionDescription: "test description",
+				aiFunctionInputModel:  &testRecursiveFn{},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := parseAIFunctionDefinition(tt.args.sfnName, tt.args.aiFunctionDescription, tt.args.aiFunctionInputModel)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
 			assert.NoError(t, err)
 			assert.Equal(t, string(tt.want), string(got))
 		})
 	}
 }
+
+func TestWithAIFunctionRegistration(t *testing.T) {
+	definition := []byte(`{"name":"get-weather","description":"get weather","parameters":{"type":"object"}}`)
+
+	got, err := withAIFunctionRegistration(definition, &ai.FunctionRegistration{
+		Version:      "1.2.0",
+		Aliases:      []string{"weather"},
+		Descriptions: map[string]string{"zh-CN": "获取天气"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"name":"get-weather","description":"get weather","parameters":{"type":"object"},"version":"1.2.0","aliases":["weather"],"descriptions":{"zh-CN":"获取天气"}}`, string(got))
+
+	fd := ai.FunctionDefinition{}
+	assert.NoError(t, json.Unmarshal(got, &fd), "the function definition is compatible with the bridges without versioning")
+	assert.Equal(t, "get-weather", fd.Name)
+
+	_, err = withAIFunctionRegistration(definition, &ai.FunctionRegistration{Aliases: []string{"a,b"}})
+	assert.Error(t, err)
+
+	_, err = withAIFunctionRegistration(definition, &ai.FunctionRegistration{Descriptions: map[string]string{"not a language": "desc"}})
+	assert.Error(t, err)
+}
+
+func TestClientTLSOverrides(t *testing.T) {
+	base := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"yomo"}}
+	pool := x509.NewCertPool()
+	cert := tls.Certificate{Certificate: [][]byte{[]byte("cert")}}
+
+	opts := defaultClientOption()
+	for _, o := range []ClientOption{
+		WithClientTLSConfig(base),
+		WithClientRootCAs(pool),
+		WithClientCertificate(cert),
+		WithClientServerName("zipper.example.com"),
+		WithClientInsecureSkipVerify(false),
+	} {
+		o(opts)
+	}
+
+	assert.Same(t, pool, opts.tlsConfig.RootCAs)
+	assert.Equal(t, []tls.Certificate{cert}, opts.tlsConfig.Certificates)
+	assert.Nil(t, opts.tlsConfig.GetClientCertificate)
+	assert.Equal(t, "zipper.example.com", opts.tlsConfig.ServerName)
+	assert.False(t, opts.tlsConfig.InsecureSkipVerify)
+	assert.Equal(t, []string{"yomo"}, opts.tlsConfig.NextProtos)
+
+	// the given tls config is not changed by the overrides.
+	assert.True(t, base.InsecureSkipVerify)
+	assert.Nil(t, base.RootCAs)
+
+	// the root CAs enable verifying the certificate of the zipper.
+	opts = defaultClientOption()
+	WithClientTLSConfig(base)(opts)
+	WithClientRootCAs(pool)(opts)
+	assert.False(t, opts.tlsConfig.InsecureSkipVerify)
+
+	WithClientInsecureSkipVerify(true)(opts)
+	assert.True(t, opts.tlsConfig.InsecureSkipVerify)
+}
+
+func TestClientWriteFrameContext(t *testing.T) {
+	// the client is not connected, so nothing drains the writes and they are blocked.
+	client := NewClient("source", testaddr, ClientTypeSource, WithLogger(discardingLogger))
+	f := &frame.DataFrame{Tag: 1, Payload: []byte("hello")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, client.WriteFrameContext(ctx, f), context.DeadlineExceeded)
+	assert.ErrorIs(t, client.WriteFramesContext(ctx, f, f), context.DeadlineExceeded)
+
+	cause := errors.New("request canceled")
+	ctx, cancelCause := context.WithCancelCause(context.Background())
+	time.AfterFunc(10*time.Millisecond, func() { cancelCause(cause) })
+	assert.ErrorIs(t, client.WriteFrameContext(ctx, f), cause)
+
+	// the done ctx fails the write before blocking, even in non-block mode.
+	nonBlock := NewClient("source", testaddr, ClientTypeSource, WithLogger(discardingLogger), WithNonBlockWrite())
+	assert.ErrorIs(t, nonBlock.WriteFrameContext(ctx, f), cause)
+}
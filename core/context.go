@@ -12,6 +12,8 @@ var ctxPool sync.Pool
 
 // Context is context for frame handling.
 // The lifespan of the Context should align with the lifespan of the frame.
+// The Metadata and the Payload of the Frame refer to a pooled buffer which is reused after the Context
+// is released, so copy them if they are kept after handling, eg: writing them asynchronously.
 type Context struct {
 	// Connection is the connection used for reading and writing frames.
 	Connection *Connection
@@ -99,6 +101,9 @@ func (c *Context) CloseWithError(errString string) {
 //
 // Warning: do not use any Context api after Release, It maybe cause an error.
 func (c *Context) Release() {
+	if c.Frame != nil {
+		c.Frame.Release()
+	}
 	c.reset()
 	ctxPool.Put(c)
 }
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"time"
+
+	"github.com/yomorun/yomo/pkg/bufpool"
 )
 
 // Frame is the minimum unit required for Yomo to run.
@@ -38,11 +41,27 @@ type DataFrame struct {
 	Tag Tag
 	// Payload is the data to transmit.
 	Payload []byte
+	// packet is the pooled buffer that the Metadata and the Payload are decoded from, see OwnPacket.
+	packet []byte
 }
 
 // Type returns the type of DataFrame.
 func (f *DataFrame) Type() Type { return TypeDataFrame }
 
+// OwnPacket transfers the ownership of the packet that the frame is decoded from to the frame,
+// the packet is put back to bufpool when the frame is released.
+func (f *DataFrame) OwnPacket(packet []byte) { f.packet = packet }
+
+// Release puts the packet of the frame back to bufpool, the Metadata and the Payload must not be used
+// after releasing unless they are replaced, so copy them if they are kept after the frame is handled.
+// The frame which is not released is collected by the GC as usual.
+func (f *DataFrame) Release() {
+	if f.packet != nil {
+		bufpool.Put(f.packet)
+		f.packet = nil
+	}
+}
+
 // The HandshakeFrame is the frame through which the client obtains a new connection from the server.
 // It includes essential details required for the creation of a fresh connection.
 // The server then generates the connection utilizing this provided information.
@@ -65,6 +84,9 @@ type HandshakeFrame struct {
 	FunctionDefinition []byte
 	// WantedTarget represents the target that accepts the data frames that carrying the same target.
 	WantedTarget string
+	// ObserveTopics are the topic filters observed by the sfn, the data carrying a topic is only
+	// routed to the sfn if the topic matches one of the filters.
+	ObserveTopics []string
 }
 
 // Type returns the type of HandshakeFrame.
@@ -90,6 +112,9 @@ func (f *RejectedFrame) Type() Type { return TypeRejectedFrame }
 type GoawayFrame struct {
 	// Message contains the reason why the connection be evicted.
 	Message string
+	// Reconnect asks the client to reconnect instead of closing, eg: the connection is drained
+	// for the rolling restart of the zipper.
+	Reconnect bool
 }
 
 // Type returns the type of GoawayFrame.
@@ -175,6 +200,26 @@ type Writer interface {
 	WriteFrame(Frame) error
 }
 
+// BatchWriter writes several frames in one write, the frames are sent back to back without
+// waiting for each other, eg: the frames of the parallel tool calls.
+type BatchWriter interface {
+	// WriteFrames writes the frames to underlying connection in order.
+	WriteFrames(...Frame) error
+}
+
+// ContextWriter writes frame like Writer, the write blocked on a congested connection can be
+// canceled or timed out by the context.
+type ContextWriter interface {
+	// WriteFrameContext writes frame to underlying connection, it returns once the ctx is done.
+	WriteFrameContext(context.Context, Frame) error
+}
+
+// RTTConn is a Conn which measures the round-trip time, eg: the QUIC connection.
+type RTTConn interface {
+	// RTT returns the smoothed round-trip time of the connection, it is 0 if it has not been measured.
+	RTT() time.Duration
+}
+
 // ErrReservedTag is returned when write a reserved tag.
 var ErrReservedTag = errors.New("[0xF000, 0xFFFF] is reserved; please do not write within this range")
 
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"time"
+)
+
+// framePool handles the data frames by a bounded number of workers. Each worker has its own queue, and the
+// frames of a connection are always queued to the same worker, so they are handled in order. Submitting
+// blocks when the queue is full, the backpressure slows down the reading of the connection instead of
+// spawning more goroutines under burst load.
+type framePool struct {
+	ctx     context.Context
+	queues  []chan queuedFrame
+	handler FrameHandler
+	metrics *serverMetrics
+}
+
+type queuedFrame struct {
+	c          *Context
+	enqueuedAt time.Time
+}
+
+// newFramePool starts the workers, they stop when ctx is done. The frames are handled by the handler
+// and released after handling.
+func newFramePool(ctx context.Context, workers, queueSize int, handler FrameHandler, metrics *serverMetrics) *framePool {
+	p := &framePool{
+		ctx:     ctx,
+		queues:  make([]chan queuedFrame, workers),
+		handler: handler,
+		metrics: metrics,
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan queuedFrame, queueSize)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+func (p *framePool) work(queue chan queuedFrame) {
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case f := <-queue:
+			p.metrics.addQueuedFrame(-1)
+			p.metrics.recordQueueWait(time.Since(f.enqueuedAt))
+
+			p.handler(f.c)
+			f.c.Release()
+		}
+	}
+}
+
+// submit queues the frame to the worker of its connection, the frame is dropped if the pool is stopped.
+func (p *framePool) submit(c *Context) {
+	p.metrics.addQueuedFrame(1)
+	select {
+	case <-p.ctx.Done():
+		p.metrics.addQueuedFrame(-1)
+		c.Release()
+	case p.queues[c.Connection.ID()%uint64(len(p.queues))] <- queuedFrame{c: c, enqueuedAt: time.Now()}:
+	}
+}
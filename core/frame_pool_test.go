@@ -0,0 +1,69 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+func TestFramePool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		handled  = map[uint64][]byte{}
+		active   atomic.Int32
+		maxAlive atomic.Int32
+		wg       sync.WaitGroup
+	)
+	handler := func(c *Context) {
+		defer wg.Done()
+
+		n := active.Add(1)
+		defer active.Add(-1)
+		for {
+			max := maxAlive.Load()
+			if n <= max || maxAlive.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		handled[c.Connection.ID()] = append(handled[c.Connection.ID()], c.Frame.Payload[0])
+		mu.Unlock()
+	}
+
+	const workers, conns, frames = 2, 5, 20
+	pool := newFramePool(ctx, workers, 4, handler, newServerMetrics())
+
+	var submitters sync.WaitGroup
+	for id := uint64(1); id <= conns; id++ {
+		conn := newConnection(id, "source", "source-id", ClientTypeSource, nil, nil, nil, ylog.Default())
+		submitters.Add(1)
+		go func() {
+			defer submitters.Done()
+			for i := 0; i < frames; i++ {
+				wg.Add(1)
+				pool.submit(&Context{Connection: conn, Frame: &frame.DataFrame{Payload: []byte{byte(i)}}})
+			}
+		}()
+	}
+	submitters.Wait()
+	wg.Wait()
+
+	assert.LessOrEqual(t, maxAlive.Load(), int32(workers), "the frames are handled by the bounded workers")
+	for id := uint64(1); id <= conns; id++ {
+		for i, b := range handled[id] {
+			assert.Equal(t, byte(i), b, "the frames of a connection are handled in order")
+		}
+		assert.Len(t, handled[id], frames)
+	}
+}
@@ -19,6 +19,16 @@ func GetTIDFromMetadata(m metadata.M) string {
 	return tid
 }
 
+// SetMetadataFrameID sets the frame id in metadata, the duplicate frames are suppressed by it.
+func SetMetadataFrameID(m metadata.M, frameID string) {
+	m.Set(metadata.FrameIDKey, frameID)
+}
+
+// SetMetadataNearest marks the data to be routed to the nearest instance in metadata.
+func SetMetadataNearest(m metadata.M) {
+	m.Set(metadata.NearestKey, "true")
+}
+
 // SetMetadataTarget sets target in metadata.
 func SetMetadataTarget(m metadata.M, target string) {
 	m.Set(metadata.TargetKey, target)
@@ -2,6 +2,8 @@
 package metadata
 
 import (
+	"strings"
+
 	"github.com/vmihailenco/msgpack/v5"
 )
 
@@ -48,6 +50,11 @@ func (m M) Set(k, v string) {
 	m[k] = v
 }
 
+// IsReservedKey returns true if the key is reserved by yomo, the reserved keys start with `yomo-`.
+func IsReservedKey(k string) bool {
+	return strings.HasPrefix(k, ReservedKeyPrefix)
+}
+
 // Range iterates over all keys and values.
 func (m M) Range(f func(k, v string) bool) {
 	for k, v := range m {
@@ -82,15 +89,52 @@ func (m M) Encode() ([]byte, error) {
 
 // yomo reserved metadata keys.
 const (
+	// ReservedKeyPrefix is the prefix of the keys reserved by yomo.
+	ReservedKeyPrefix = "yomo-"
+
 	// the keys for yomo working.
 	SourceIDKey = "yomo-source-id"
 	TIDKey      = "yomo-tid"
 
+	// the key for suppressing the duplicate frames, it's unique for every write of the source.
+	FrameIDKey = "yomo-frame-id"
+
 	// the keys for tracing.
-	TraceIDKey = "yomo-trace-id"
-	SpanIDKey  = "yomo-span-id"
+	TraceIDKey    = "yomo-trace-id"
+	SpanIDKey     = "yomo-span-id"
+	TraceFlagsKey = "yomo-trace-flags"
 
 	// the keys for target system working.
 	TargetKey       = "yomo-target"
 	WantedTargetKey = "yomo-wanted-target"
+
+	// the key for routing to the nearest instance.
+	NearestKey = "yomo-nearest"
+
+	// the keys for topic routing.
+	TopicKey         = "yomo-topic"
+	ObserveTopicsKey = "yomo-observe-topics"
+
+	// the keys for signing the frames.
+	SignatureKey      = "yomo-signature"
+	SignatureKeyIDKey = "yomo-signature-key-id"
+
+	// the key for scope routing, the data carrying the comma separated scopes of the caller is only routed
+	// to the scoped conns whose scopes overlap them, the scope "*" of the caller overlaps all the scopes.
+	CallerScopesKey = "yomo-caller-scopes"
 )
+
+// ScopeKey is the key for the comma separated scopes of the conn, eg: tenant-a,tenant-b, it's carried in
+// the metadata returned by the authentication of the conn.
+const ScopeKey = "scope"
+
+// ParseScopes returns the scopes of the comma separated value.
+func ParseScopes(v string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(v, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
@@ -30,6 +30,12 @@ func Test(t *testing.T) {
 
 	})
 
+	t.Run("IsReservedKey", func(t *testing.T) {
+		assert.True(t, IsReservedKey(TIDKey))
+		assert.True(t, IsReservedKey(TraceIDKey))
+		assert.False(t, IsReservedKey("tenant-id"))
+	})
+
 	t.Run("Range", func(t *testing.T) {
 		md2 := M{}
 
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// serverMetrics are the OpenTelemetry instruments of the zipper.
+type serverMetrics struct {
+	// connections is the number of the connections, by the client type.
+	connections metric.Int64UpDownCounter
+	// dataFrames is the number of the data frames routed by the zipper, by the tag.
+	dataFrames metric.Int64Counter
+	// dataFrameBytes is the payload size of the data frames routed by the zipper, by the tag.
+	dataFrameBytes metric.Int64Counter
+	// queuedFrames is the number of the data frames waiting in the queues of the frame workers.
+	queuedFrames metric.Int64UpDownCounter
+	// queueWait is the time the data frames wait in the queues of the frame workers.
+	queueWait metric.Float64Histogram
+	// drainedConnections is the number of the connections asked to reconnect, by the client type.
+	drainedConnections metric.Int64Counter
+}
+
+// newServerMetrics creates the instruments from the global MeterProvider, so the global MeterProvider
+// should be set before the server is created.
+func newServerMetrics() *serverMetrics {
+	meter := otel.Meter("github.com/yomorun/yomo/core")
+
+	connections, err := meter.Int64UpDownCounter(
+		"yomo.zipper.connections",
+		metric.WithDescription("The number of the connections to the zipper."),
+		metric.WithUnit("{connection}"),
+	)
+	otel.Handle(err)
+	dataFrames, err := meter.Int64Counter(
+		"yomo.zipper.data_frames",
+		metric.WithDescription("The number of the data frames routed by the zipper."),
+		metric.WithUnit("{frame}"),
+	)
+	otel.Handle(err)
+	dataFrameBytes, err := meter.Int64Counter(
+		"yomo.zipper.data_frame.size",
+		metric.WithDescription("The payload size of the data frames routed by the zipper."),
+		metric.WithUnit("By"),
+	)
+	otel.Handle(err)
+	queuedFrames, err := meter.Int64UpDownCounter(
+		"yomo.zipper.frame_queue.depth",
+		metric.WithDescription("The number of the data frames waiting in the queues of the frame workers."),
+		metric.WithUnit("{frame}"),
+	)
+	otel.Handle(err)
+	queueWait, err := meter.Float64Histogram(
+		"yomo.zipper.frame_queue.wait",
+		metric.WithDescription("The time the data frames wait in the queues of the frame workers."),
+		metric.WithUnit("s"),
+	)
+	otel.Handle(err)
+	drainedConnections, err := meter.Int64Counter(
+		"yomo.zipper.drained_connections",
+		metric.WithDescription("The number of the connections asked to reconnect by the zipper."),
+		metric.WithUnit("{connection}"),
+	)
+	otel.Handle(err)
+
+	return &serverMetrics{
+		connections:        connections,
+		dataFrames:         dataFrames,
+		dataFrameBytes:     dataFrameBytes,
+		queuedFrames:       queuedFrames,
+		queueWait:          queueWait,
+		drainedConnections: drainedConnections,
+	}
+}
+
+func (m *serverMetrics) addConnection(clientType ClientType, delta int64) {
+	m.connections.Add(context.Background(), delta, metric.WithAttributes(
+		attribute.String("client_type", clientType.String()),
+	))
+}
+
+func (m *serverMetrics) addDrainedConnection(clientType ClientType) {
+	m.drainedConnections.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("client_type", clientType.String()),
+	))
+}
+
+func (m *serverMetrics) addDataFrame(tag uint32, size int) {
+	attrs := metric.WithAttributes(attribute.Int("tag", int(tag)))
+	m.dataFrames.Add(context.Background(), 1, attrs)
+	m.dataFrameBytes.Add(context.Background(), int64(size), attrs)
+}
+
+func (m *serverMetrics) addQueuedFrame(delta int64) {
+	m.queuedFrames.Add(context.Background(), delta)
+}
+
+func (m *serverMetrics) recordQueueWait(d time.Duration) {
+	m.queueWait.Record(context.Background(), d.Seconds())
+}
@@ -2,6 +2,7 @@
 package router
 
 import (
+	"slices"
 	"sync"
 
 	"github.com/yomorun/yomo/core/frame"
@@ -28,21 +29,41 @@ type defaultRouter struct {
 	// targets stores the mapping between connID and the target string that conn wanted.
 	targets map[uint64]string
 
+	// topics stores the mapping between connID and the topic filters that conn observed.
+	topics map[uint64][]string
+
+	// scopes stores the mapping between connID and the scopes of the conn.
+	scopes map[uint64][]string
+
 	// data stores tag and connID connection.
 	// The key is frame tag, The value is connID connection.
 	data map[frame.Tag]map[uint64]struct{}
 }
 
 // DefaultRouter provides a default implementation of `router`,
-// It routes data according to observed tag and metadata.
+// It routes data according to observed tag and metadata, the data carrying a topic is filtered
+// by the topic filters observed by the conns, and the data carrying the caller scopes is filtered
+// by the scopes of the conns.
 func Default() *defaultRouter {
 	return &defaultRouter{
 		targets: make(map[uint64]string),
+		topics:  make(map[uint64][]string),
+		scopes:  make(map[uint64][]string),
 		data:    make(map[frame.Tag]map[uint64]struct{}),
 	}
 }
 
 func (r *defaultRouter) Add(connID uint64, observeDataTags []uint32, md metadata.M) error {
+	var filters []string
+	if v, ok := md.Get(metadata.ObserveTopicsKey); ok {
+		filters = SplitTopicFilters(v)
+		for _, filter := range filters {
+			if err := ValidateTopicFilter(filter); err != nil {
+				return err
+			}
+		}
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -50,6 +71,14 @@ func (r *defaultRouter) Add(connID uint64, observeDataTags []uint32, md metadata
 	if ok {
 		r.targets[connID] = target
 	}
+	if len(filters) > 0 {
+		r.topics[connID] = filters
+	}
+	if v, ok := md.Get(metadata.ScopeKey); ok {
+		if scopes := metadata.ParseScopes(v); len(scopes) > 0 {
+			r.scopes[connID] = scopes
+		}
+	}
 
 	for _, tag := range observeDataTags {
 		conns := r.data[tag]
@@ -68,10 +97,20 @@ func (r *defaultRouter) Route(dataTag uint32, md metadata.M) []uint64 {
 	defer r.mu.RUnlock()
 
 	target, existed := md.Get(metadata.TargetKey)
+	topic, hasTopic := md.Get(metadata.TopicKey)
+	callerScopes, hasCallerScopes := md.Get(metadata.CallerScopesKey)
 
 	var connID []uint64
 	if conns, ok := r.data[dataTag]; ok {
 		for k := range conns {
+			// the conns observing the topics only receive the data carrying a matched topic.
+			if filters, ok := r.topics[k]; ok && (!hasTopic || !matchTopicFilters(filters, topic)) {
+				continue
+			}
+			// the scoped conns only receive the data of the callers whose scopes overlap theirs.
+			if scopes, ok := r.scopes[k]; ok && hasCallerScopes && !overlapScopes(scopes, callerScopes) {
+				continue
+			}
 			if existed {
 				if wt, ok := r.targets[k]; ok && wt == target {
 					connID = append(connID, k)
@@ -90,6 +129,8 @@ func (r *defaultRouter) Remove(connID uint64) {
 	defer r.mu.Unlock()
 
 	delete(r.targets, connID)
+	delete(r.topics, connID)
+	delete(r.scopes, connID)
 
 	for _, conns := range r.data {
 		delete(conns, connID)
@@ -101,5 +142,26 @@ func (r *defaultRouter) Release() {
 	defer r.mu.Unlock()
 
 	clear(r.targets)
+	clear(r.topics)
+	clear(r.scopes)
 	clear(r.data)
 }
+
+func matchTopicFilters(filters []string, topic string) bool {
+	for _, filter := range filters {
+		if MatchTopic(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlapScopes reports whether the comma separated scopes of the caller overlap the scopes.
+func overlapScopes(scopes []string, callerScopes string) bool {
+	for _, scope := range metadata.ParseScopes(callerScopes) {
+		if scope == "*" || slices.Contains(scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
@@ -56,3 +56,69 @@ func TestTargetRouter(t *testing.T) {
 	ids = router.Route(1, nil)
 	assert.Equal(t, []uint64(nil), ids)
 }
+
+func TestTopicRouter(t *testing.T) {
+	router := Default()
+
+	err := router.Add(1, []uint32{1}, metadata.M{metadata.ObserveTopicsKey: JoinTopicFilters([]string{"sensors/+/temperature"})})
+	assert.NoError(t, err)
+
+	err = router.Add(2, []uint32{1}, metadata.M{metadata.ObserveTopicsKey: JoinTopicFilters([]string{"sensors/eu/#", "alerts"})})
+	assert.NoError(t, err)
+
+	err = router.Add(3, []uint32{1}, metadata.M{})
+	assert.NoError(t, err)
+
+	err = router.Add(4, []uint32{1}, metadata.M{metadata.ObserveTopicsKey: "sensors/#/temperature"})
+	assert.ErrorIs(t, err, ErrInvalidTopicFilter)
+
+	ids := router.Route(1, metadata.M{metadata.TopicKey: "sensors/eu/temperature"})
+	assert.ElementsMatch(t, []uint64{1, 2, 3}, ids)
+
+	ids = router.Route(1, metadata.M{metadata.TopicKey: "sensors/us/temperature"})
+	assert.ElementsMatch(t, []uint64{1, 3}, ids)
+
+	ids = router.Route(1, metadata.M{metadata.TopicKey: "alerts"})
+	assert.ElementsMatch(t, []uint64{2, 3}, ids)
+
+	ids = router.Route(1, metadata.M{})
+	assert.ElementsMatch(t, []uint64{3}, ids)
+
+	router.Remove(1)
+
+	ids = router.Route(1, metadata.M{metadata.TopicKey: "sensors/us/temperature"})
+	assert.ElementsMatch(t, []uint64{3}, ids)
+}
+
+func TestScopeRouter(t *testing.T) {
+	router := Default()
+
+	err := router.Add(1, []uint32{1}, metadata.M{metadata.ScopeKey: "tenant-a"})
+	assert.NoError(t, err)
+
+	err = router.Add(2, []uint32{1}, metadata.M{metadata.ScopeKey: "tenant-b, tenant-c"})
+	assert.NoError(t, err)
+
+	err = router.Add(3, []uint32{1}, metadata.M{})
+	assert.NoError(t, err)
+
+	ids := router.Route(1, metadata.M{metadata.CallerScopesKey: "tenant-a"})
+	assert.ElementsMatch(t, []uint64{1, 3}, ids)
+
+	ids = router.Route(1, metadata.M{metadata.CallerScopesKey: "tenant-c,tenant-d"})
+	assert.ElementsMatch(t, []uint64{2, 3}, ids)
+
+	ids = router.Route(1, metadata.M{metadata.CallerScopesKey: "*"})
+	assert.ElementsMatch(t, []uint64{1, 2, 3}, ids)
+
+	ids = router.Route(1, metadata.M{metadata.CallerScopesKey: ""})
+	assert.ElementsMatch(t, []uint64{3}, ids)
+
+	ids = router.Route(1, metadata.M{})
+	assert.ElementsMatch(t, []uint64{1, 2, 3}, ids)
+
+	router.Remove(2)
+
+	ids = router.Route(1, metadata.M{metadata.CallerScopesKey: "tenant-c"})
+	assert.ElementsMatch(t, []uint64{3}, ids)
+}
@@ -0,0 +1,86 @@
+package router
+
+import (
+	"errors"
+	"strings"
+)
+
+// The topics are hierarchical strings separated by `/`, eg: `sensors/eu/temperature`, they are mapped onto the tags,
+// the data carrying a topic is routed to the sfns observing its tag, and then filtered by their topic filters.
+//
+// The topic filters support the MQTT-style wildcards:
+//   - `+` matches exactly one level, eg: `sensors/+/temperature` matches `sensors/eu/temperature`.
+//   - `#` matches any number of the remaining levels, including the parent level, it must be the last level,
+//     eg: `sensors/#` matches `sensors`, `sensors/eu` and `sensors/eu/temperature`.
+const (
+	// TopicSeparator separates the levels of the topics.
+	TopicSeparator = "/"
+	// SingleLevelWildcard matches exactly one level of the topics.
+	SingleLevelWildcard = "+"
+	// MultiLevelWildcard matches any number of the remaining levels of the topics.
+	MultiLevelWildcard = "#"
+)
+
+var (
+	// ErrInvalidTopic is returned when the topic is empty or contains the wildcards.
+	ErrInvalidTopic = errors.New("yomo: topic must be non-empty and must not contain the wildcards or NUL")
+	// ErrInvalidTopicFilter is returned when the wildcards of the topic filter are misplaced.
+	ErrInvalidTopicFilter = errors.New("yomo: invalid topic filter, `+` must occupy an entire level and `#` must be the last level")
+)
+
+// ValidateTopic validates the topic of the data.
+func ValidateTopic(topic string) error {
+	if topic == "" || strings.ContainsAny(topic, SingleLevelWildcard+MultiLevelWildcard+"\x00") {
+		return ErrInvalidTopic
+	}
+	return nil
+}
+
+// ValidateTopicFilter validates the topic filter observed by the sfn.
+func ValidateTopicFilter(filter string) error {
+	if filter == "" || strings.Contains(filter, "\x00") {
+		return ErrInvalidTopicFilter
+	}
+	levels := strings.Split(filter, TopicSeparator)
+	for i, level := range levels {
+		if strings.Contains(level, SingleLevelWildcard) && level != SingleLevelWildcard {
+			return ErrInvalidTopicFilter
+		}
+		if strings.Contains(level, MultiLevelWildcard) && (level != MultiLevelWildcard || i != len(levels)-1) {
+			return ErrInvalidTopicFilter
+		}
+	}
+	return nil
+}
+
+// MatchTopic reports whether the topic matches the topic filter, both of them should be valid.
+func MatchTopic(filter, topic string) bool {
+	for {
+		fl, frest, fmore := strings.Cut(filter, TopicSeparator)
+		if fl == MultiLevelWildcard {
+			return true
+		}
+		tl, trest, tmore := strings.Cut(topic, TopicSeparator)
+		if fl != SingleLevelWildcard && fl != tl {
+			return false
+		}
+		if !fmore || !tmore {
+			// `sensors/#` matches `sensors` as well.
+			return fmore == tmore || (fmore && frest == MultiLevelWildcard)
+		}
+		filter, topic = frest, trest
+	}
+}
+
+// JoinTopicFilters joins the topic filters into the value of the metadata, NUL is forbidden in the topics.
+func JoinTopicFilters(filters []string) string {
+	return strings.Join(filters, "\x00")
+}
+
+// SplitTopicFilters splits the value of the metadata joined by JoinTopicFilters.
+func SplitTopicFilters(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\x00")
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"sensors/eu/temperature", "sensors/eu/temperature", true},
+		{"sensors/eu/temperature", "sensors/eu/humidity", false},
+		{"sensors/+/temperature", "sensors/eu/temperature", true},
+		{"sensors/+/temperature", "sensors/eu/north/temperature", false},
+		{"sensors/+", "sensors", false},
+		{"sensors/#", "sensors", true},
+		{"sensors/#", "sensors/eu/temperature", true},
+		{"sensors/#", "alerts/eu", false},
+		{"#", "sensors/eu/temperature", true},
+		{"+/+", "sensors/eu", true},
+		{"+/+", "sensors/eu/temperature", false},
+		{"sensors", "sensors/eu", false},
+		{"sensors//temperature", "sensors//temperature", true},
+		{"sensors/+/temperature", "sensors//temperature", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter+" "+tt.topic, func(t *testing.T) {
+			assert.Equal(t, tt.want, MatchTopic(tt.filter, tt.topic))
+		})
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		wantErr bool
+	}{
+		{"sensors/eu/temperature", false},
+		{"sensors/+/temperature", false},
+		{"sensors/#", false},
+		{"#", false},
+		{"", true},
+		{"sensors/eu+", true},
+		{"sensors/#/temperature", true},
+		{"sensors/eu#", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			err := ValidateTopicFilter(tt.filter)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidTopicFilter)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+	assert.NoError(t, ValidateTopic("sensors/eu/temperature"))
+	assert.ErrorIs(t, ValidateTopic("sensors/+"), ErrInvalidTopic)
+}
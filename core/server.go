@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core/auth"
@@ -22,6 +24,7 @@ import (
 	yquic "github.com/yomorun/yomo/pkg/listener/quic"
 	pkgtls "github.com/yomorun/yomo/pkg/tls"
 	"github.com/yomorun/yomo/pkg/trace"
+	"github.com/yomorun/yomo/pkg/webhook"
 	"go.opentelemetry.io/otel/attribute"
 )
 
@@ -52,10 +55,13 @@ type Server struct {
 	codec                frame.Codec
 	packetReadWriter     frame.PacketReadWriter
 	counterOfDataFrame   int64
+	metrics              *serverMetrics
 	downstreams          map[string]Downstream
+	connectCtx           context.Context
 	mu                   sync.Mutex
 	opts                 *serverOptions
 	frameHandler         FrameHandler
+	framePool            *framePool
 	connHandler          ConnHandler
 	listener             frame.Listener
 	logger               *slog.Logger
@@ -86,6 +92,7 @@ func NewServer(name string, opts ...ServerOption) *Server {
 		packetReadWriter:     y3codec.PacketReadWriter(),
 		opts:                 options,
 		versionNegotiateFunc: options.versionNegotiateFunc,
+		metrics:              newServerMetrics(),
 	}
 
 	if s.router == nil {
@@ -101,6 +108,9 @@ func NewServer(name string, opts ...ServerOption) *Server {
 	// work with middleware.
 	s.connHandler = composeConnHandler(s.handleConn, s.opts.connMiddlewares...)
 	s.frameHandler = composeFrameHandler(s.handleFrame, s.opts.frameMiddlewares...)
+	if s.opts.frameWorkers > 0 {
+		s.framePool = newFramePool(ctx, s.opts.frameWorkers, s.opts.frameQueueSize, s.frameHandler, s.metrics)
+	}
 
 	return s
 }
@@ -116,10 +126,13 @@ func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
 		return err
 	}
 
-	// connect to all downstreams.
+	// connect to all downstreams, the downstreams added later are connected when they are added.
+	s.mu.Lock()
+	s.connectCtx = ctx
 	for _, client := range s.downstreams {
 		go client.Connect(ctx)
 	}
+	s.mu.Unlock()
 
 	return s.Serve(ctx, conn)
 }
@@ -169,12 +182,37 @@ func (s *Server) handleFrameConn(fconn frame.Conn, logger *slog.Logger) {
 	// ack handshake
 	_ = fconn.WriteFrame(&frame.HandshakeAckFrame{})
 
+	s.metrics.addConnection(conn.ClientType(), 1)
+	s.notify(webhook.EventSfnConnected, conn)
+	stopDrain := s.scheduleDrain(conn)
 	s.connHandler(conn) // s.handleConn(conn) with middlewares
+	stopDrain()
+	s.metrics.addConnection(conn.ClientType(), -1)
 
 	if conn.ClientType() == ClientTypeStreamFunction {
 		s.router.Remove(conn.ID())
 	}
 	_ = s.connector.Remove(conn.ID())
+	s.notify(webhook.EventSfnDisconnected, conn)
+}
+
+// notify notifies the sfn connection event to the webhooks.
+func (s *Server) notify(typ string, conn *Connection) {
+	if conn.ClientType() != ClientTypeStreamFunction {
+		return
+	}
+	e := webhook.Event{
+		Type:     typ,
+		Zipper:   s.name,
+		ConnID:   conn.ID(),
+		ClientID: conn.ClientID(),
+		Name:     conn.Name(),
+		Tags:     conn.ObserveDataTags(),
+	}
+	if addr := conn.FrameConn().RemoteAddr(); addr != nil {
+		e.RemoteAddr = addr.String()
+	}
+	webhook.Default().Notify(e)
 }
 
 func rejectHandshake(w frame.Writer, err error) error {
@@ -264,6 +302,11 @@ func (s *Server) handleConn(conn *Connection) {
 				return
 			}
 
+			if s.framePool != nil {
+				s.framePool.submit(c)
+				continue
+			}
+
 			s.frameHandler(c) // s.handleFrame(c) with middlewares
 
 			c.Release()
@@ -293,6 +336,9 @@ func (s *Server) createConnection(hf *frame.HandshakeFrame, md metadata.M, fconn
 	if hf.WantedTarget != "" {
 		md.Set(metadata.WantedTargetKey, hf.WantedTarget)
 	}
+	if len(hf.ObserveTopics) > 0 {
+		md.Set(metadata.ObserveTopicsKey, router.JoinTopicFilters(hf.ObserveTopics))
+	}
 	conn := newConnection(
 		incrID(),
 		hf.Name,
@@ -315,11 +361,26 @@ func (s *Server) addSfnRouteRule(connID uint64, hf *frame.HandshakeFrame, md met
 }
 
 func (s *Server) handleFrame(c *Context) {
+	if err := s.verify(c); err != nil {
+		c.Logger.Warn("dropped the data frame", "tag", c.Frame.Tag, "err", err)
+		return
+	}
+	if s.opts.dedup != nil && s.opts.dedup.Duplicate(c.Frame.Tag, c.FrameMetadata) {
+		c.Logger.Debug("dropped the duplicate data frame", "tag", c.Frame.Tag)
+		return
+	}
+
 	// routing data frame.
-	if err := s.routingDataFrame(c); err != nil {
+	routed, err := s.routingDataFrame(c)
+	if err != nil {
 		c.CloseWithError(fmt.Sprintf("handle dataFrame err: %v", err))
 		return
 	}
+	// the local instance is nearer than the instances behind the downstreams, so the data routed to
+	// the nearest instance is not dispatched if it's routed locally.
+	if routed > 0 && isNearest(c.FrameMetadata) {
+		return
+	}
 
 	// dispatch to downstream.
 	if err := s.dispatchToDownstreams(c); err != nil {
@@ -328,32 +389,54 @@ func (s *Server) handleFrame(c *Context) {
 	}
 }
 
-func (s *Server) routingDataFrame(c *Context) error {
+func (s *Server) verify(c *Context) error {
+	if s.opts.verifier == nil || c.Connection.ClientType() == ClientTypeUpstreamZipper {
+		return nil
+	}
+	return s.opts.verifier.Verify(c.Frame, c.FrameMetadata)
+}
+
+// routingDataFrame routes the data frame to the local sfns, it returns the number of the sfns routed.
+func (s *Server) routingDataFrame(c *Context) (routed int, err error) {
 	dataFrame := c.Frame
 	dataLength := len(dataFrame.Payload)
 
 	// counter +1
 	atomic.AddInt64(&s.counterOfDataFrame, 1)
+	s.metrics.addDataFrame(dataFrame.Tag, dataLength)
 
 	// add trace
 	tracer := trace.NewTracer("Zipper")
 	span := tracer.Start(c.FrameMetadata, "zipper endpoint")
-	defer tracer.End(
-		c.FrameMetadata,
-		span,
-		attribute.Key("routing_data_tag").Int(int(dataFrame.Tag)),
-		attribute.Key("routing_data_len").Int(dataLength),
-	)
+	defer func() {
+		trace.RecordError(span, err)
+		tracer.End(
+			c.FrameMetadata,
+			span,
+			attribute.Key("routing_data_tag").Int(int(dataFrame.Tag)),
+			attribute.Key("routing_data_len").Int(dataLength),
+		)
+	}()
 
-	mdBytes, err := c.FrameMetadata.Encode()
+	// the caller scopes are consumed by the routing, they are not carried to the sfns, so the data written
+	// by the sfns are not filtered by them.
+	md := c.FrameMetadata
+	if _, ok := md.Get(metadata.CallerScopesKey); ok {
+		md = md.Clone()
+		delete(md, metadata.CallerScopesKey)
+	}
+	mdBytes, err := md.Encode()
 	if err != nil {
 		c.Logger.Error("encode metadata error", "err", err)
-		return err
+		return 0, err
 	}
 	dataFrame.Metadata = mdBytes
 
 	// find stream function ids from the router.
 	connIDs := s.router.Route(dataFrame.Tag, c.FrameMetadata)
+	if len(connIDs) > 1 && isNearest(c.FrameMetadata) {
+		connIDs = s.nearest(connIDs)
+	}
 	if len(connIDs) == 0 {
 		c.Logger.Info("no observed", "tag", dataFrame.Tag, "data_length", dataLength)
 	}
@@ -376,6 +459,7 @@ func (s *Server) routingDataFrame(c *Context) error {
 				"tag", dataFrame.Tag, "data_length", dataLength, "to_id", toID, "to_name", conn.Name(),
 			)
 		} else {
+			routed++
 			c.Logger.Info(
 				"data routing",
 				"tag", dataFrame.Tag, "data_length", dataLength, "to_id", toID, "to_name", conn.Name(),
@@ -383,7 +467,44 @@ func (s *Server) routingDataFrame(c *Context) error {
 		}
 	}
 
-	return nil
+	return routed, nil
+}
+
+// isNearest returns true if the data should be routed to the nearest instance.
+func isNearest(md metadata.M) bool {
+	v, _ := md.Get(metadata.NearestKey)
+	return v == "true"
+}
+
+// nearest returns the conn with the lowest RTT, the conns whose RTT has not been measured are the farthest.
+func (s *Server) nearest(connIDs []uint64) []uint64 {
+	var (
+		nearestID  uint64
+		nearestRTT time.Duration
+		found      bool
+	)
+	for _, id := range connIDs {
+		conn, ok, err := s.connector.Get(id)
+		if err != nil || !ok {
+			continue
+		}
+		rtt := connRTT(conn.FrameConn())
+		if !found || (rtt > 0 && (nearestRTT == 0 || rtt < nearestRTT)) {
+			nearestID, nearestRTT, found = id, rtt, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return []uint64{nearestID}
+}
+
+// connRTT returns the RTT of the conn, it is 0 if the conn doesn't measure the RTT.
+func connRTT(fconn frame.Conn) time.Duration {
+	if rc, ok := fconn.(frame.RTTConn); ok {
+		return rc.RTT()
+	}
+	return 0
 }
 
 // dispatch every DataFrames to all downstreams
@@ -395,14 +516,31 @@ func (s *Server) dispatchToDownstreams(c *Context) error {
 		return nil
 	}
 
+	s.mu.Lock()
+	downstreams := make([]Downstream, 0, len(s.downstreams))
+	for _, ds := range s.downstreams {
+		downstreams = append(downstreams, ds)
+	}
+	s.mu.Unlock()
+
+	if len(downstreams) == 0 {
+		return nil
+	}
+
 	mdBytes, err := c.FrameMetadata.Encode()
 	if err != nil {
 		c.Logger.Error("failed to dispatch to downstream", "err", err)
 		return err
 	}
-	dataFrame.Metadata = mdBytes
+	// the downstreams write the frame asynchronously, so they get a copy of the payload which is not
+	// released with the context.
+	dataFrame = &frame.DataFrame{
+		Tag:      dataFrame.Tag,
+		Metadata: mdBytes,
+		Payload:  bytes.Clone(dataFrame.Payload),
+	}
 
-	for _, ds := range s.downstreams {
+	for _, ds := range downstreams {
 		if err = ds.WriteFrame(dataFrame); err != nil {
 			c.Logger.Error(
 				"failed to dispatch to downstream",
@@ -468,7 +606,22 @@ func (s *Server) Downstreams() map[string]string {
 func (s *Server) AddDownstreamServer(c Downstream) {
 	s.mu.Lock()
 	s.downstreams[c.ID()] = c
+	if s.connectCtx != nil {
+		go c.Connect(s.connectCtx)
+	}
+	s.mu.Unlock()
+}
+
+// RemoveDownstreamServer removes the downstream server by its id and closes it.
+func (s *Server) RemoveDownstreamServer(id string) {
+	s.mu.Lock()
+	ds, ok := s.downstreams[id]
+	delete(s.downstreams, id)
 	s.mu.Unlock()
+
+	if ok {
+		ds.Close()
+	}
 }
 
 // Logger returns the logger of server.
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/yomorun/yomo/core/frame"
+)
+
+// maxConnectionAgeReason is the reason of the GoawayFrame sent to the connections older than the max age.
+const maxConnectionAgeReason = "max connection age exceeded"
+
+// ErrGoawayReconnect is returned by serving the connection drained by the zipper, the client reconnects then.
+type ErrGoawayReconnect struct {
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ErrGoawayReconnect) Error() string {
+	return fmt.Sprintf("goaway to reconnect: %s", e.Reason)
+}
+
+// Drain asks all the connected clients to reconnect by the GoawayFrame with the reason, the connections
+// which are not closed by the clients in the grace period are closed, eg: before the rolling restart of
+// the zipper. The clients reconnect to the zipper address, which may be balanced to the other zippers.
+func (s *Server) Drain(reason string, grace time.Duration) {
+	conns, _ := s.connector.Find(func(ConnectionInfo) bool { return true })
+
+	s.logger.Info("drain the connections", "reason", reason, "grace", grace, "connections", len(conns))
+	for _, conn := range conns {
+		s.drainConnection(conn, reason, grace)
+	}
+}
+
+// drainConnection asks the client of the connection to reconnect, the connection is closed after the grace
+// period if the client doesn't close it. The clients which don't support reconnecting close the connection.
+func (s *Server) drainConnection(conn *Connection, reason string, grace time.Duration) {
+	fconn := conn.FrameConn()
+	if err := fconn.WriteFrame(&frame.GoawayFrame{Message: reason, Reconnect: true}); err != nil {
+		conn.Logger.Debug("failed to drain the connection", "err", err)
+		return
+	}
+	conn.Logger.Info("drain the connection", "reason", reason)
+	s.metrics.addDrainedConnection(conn.ClientType())
+
+	timer := time.NewTimer(grace)
+	go func() {
+		defer timer.Stop()
+		select {
+		case <-fconn.Context().Done():
+		case <-timer.C:
+			conn.Logger.Info("close the connection not reconnected in the grace period", "reason", reason)
+			_ = fconn.CloseWithError(reason)
+		}
+	}()
+}
+
+// scheduleDrain drains the connection once it is older than the max connection age,
+// the returned func stops the schedule, it must be called once the connection is closed.
+func (s *Server) scheduleDrain(conn *Connection) (stop func()) {
+	age := s.opts.maxConnectionAge
+	if age <= 0 {
+		return func() {}
+	}
+	// jitter the age by up to ±10%.
+	if jitter := int64(age / 10); jitter > 0 {
+		age += time.Duration(rand.Int63n(2*jitter+1) - jitter)
+	}
+	timer := time.AfterFunc(age, func() {
+		s.drainConnection(conn, maxConnectionAgeReason, s.opts.drainGrace)
+	})
+	return func() { timer.Stop() }
+}
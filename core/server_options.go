@@ -9,6 +9,8 @@ import (
 	"github.com/yomorun/yomo/core/auth"
 	"github.com/yomorun/yomo/core/router"
 	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/dedup"
+	"github.com/yomorun/yomo/pkg/signature"
 )
 
 // DefaultQuicConfig be used when `quicConfig` is nil.
@@ -38,6 +40,12 @@ type serverOptions struct {
 	router               router.Router
 	connMiddlewares      []ConnMiddleware
 	frameMiddlewares     []FrameMiddleware
+	verifier             *signature.Verifier
+	frameWorkers         int
+	frameQueueSize       int
+	maxConnectionAge     time.Duration
+	dedup                *dedup.Window
+	drainGrace           time.Duration
 }
 
 func defaultServerOptions() *serverOptions {
@@ -120,3 +128,41 @@ func WithConnMiddleware(mws ...ConnMiddleware) ServerOption {
 		o.connMiddlewares = append(o.connMiddlewares, mws...)
 	}
 }
+
+// WithServerVerifier verifies the data frames received by the server, the frames failed to verify are dropped.
+// The frames from the upstream zippers are not verified, they have been verified by the upstream zippers.
+func WithServerVerifier(verifier *signature.Verifier) ServerOption {
+	return func(o *serverOptions) {
+		o.verifier = verifier
+	}
+}
+
+// WithServerDedup drops the data frames whose frame ids have been seen in the window, so the frames delivered
+// more than once are routed once. The frames from the upstream zippers are deduplicated as well.
+func WithServerDedup(w *dedup.Window) ServerOption {
+	return func(o *serverOptions) {
+		o.dedup = w
+	}
+}
+
+// WithFrameWorkers handles the data frames by a bounded pool of workers, each worker queues up to queueSize
+// frames. The frames of a connection are handled by the same worker in order, and the reading of the
+// connection is blocked when the queue of its worker is full. The frames are handled by the reading
+// goroutine of each connection if workers is zero.
+func WithFrameWorkers(workers, queueSize int) ServerOption {
+	return func(o *serverOptions) {
+		o.frameWorkers = workers
+		o.frameQueueSize = queueSize
+	}
+}
+
+// WithMaxConnectionAge asks the clients to reconnect by the GoawayFrame once their connections are older than
+// age, the age of each connection is jittered by up to 10% so the clients don't reconnect all at once.
+// The connections are closed if the clients don't reconnect in the grace period. It rebalances the
+// clients across the zippers and brings them to the new certificates, the connections never age if age is zero.
+func WithMaxConnectionAge(age, grace time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.maxConnectionAge = age
+		o.drainGrace = grace
+	}
+}
@@ -1,10 +1,15 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
 	_ "github.com/yomorun/yomo/pkg/auth"
 )
 
@@ -73,3 +78,66 @@ func TestConnectToNewEndpoint(t *testing.T) {
 		})
 	}
 }
+
+type rttFrameConn struct {
+	frame.Conn
+	rtt time.Duration
+}
+
+func (c *rttFrameConn) RTT() time.Duration { return c.rtt }
+
+func TestNearest(t *testing.T) {
+	s := &Server{connector: NewConnector(context.Background())}
+	defer s.connector.Close()
+
+	rtts := map[uint64]time.Duration{1: 80 * time.Millisecond, 2: 0, 3: 20 * time.Millisecond, 4: 150 * time.Millisecond}
+	for id, rtt := range rtts {
+		conn := newConnection(id, "sfn", "", ClientTypeStreamFunction, metadata.M{}, []uint32{1}, &rttFrameConn{rtt: rtt}, ylog.Default())
+		assert.NoError(t, s.connector.Store(id, conn))
+	}
+
+	assert.Equal(t, []uint64{3}, s.nearest([]uint64{1, 2, 3, 4}))
+	assert.Equal(t, []uint64{1}, s.nearest([]uint64{2, 1, 4}))
+	// the conn whose RTT has not been measured is chosen if there is no other choice.
+	assert.Equal(t, []uint64{2}, s.nearest([]uint64{2, 5}))
+	assert.Equal(t, []uint64(nil), s.nearest([]uint64{5}))
+
+	assert.True(t, isNearest(metadata.M{metadata.NearestKey: "true"}))
+	assert.False(t, isNearest(metadata.M{}))
+}
+
+func TestMaxConnectionAge(t *testing.T) {
+	t.Parallel()
+	const addr = "127.0.0.1:19994"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	connector := NewConnector(ctx)
+	server := NewServer("zipper",
+		WithServerLogger(discardingLogger),
+		WithConnector(connector),
+		WithMaxConnectionAge(200*time.Millisecond, time.Second),
+	)
+	go server.ListenAndServe(ctx, addr)
+	defer server.Close()
+
+	source := NewClient("source", addr, ClientTypeSource, WithLogger(discardingLogger), WithReConnect())
+	assert.NoError(t, source.Connect(ctx))
+	defer source.Close()
+
+	clientIDs := func() []string {
+		conns, _ := connector.Find(func(ConnectionInfo) bool { return true })
+		ids := make([]string, 0, len(conns))
+		for _, conn := range conns {
+			ids = append(ids, conn.ClientID())
+		}
+		return ids
+	}
+
+	// the drained source reconnects by itself instead of being closed.
+	assert.Eventually(t, func() bool {
+		ids := clientIDs()
+		return len(ids) == 1 && ids[0] == source.ClientID()+"-1"
+	}, 3*time.Second, 10*time.Millisecond)
+	assert.NoError(t, source.WriteFrame(&frame.DataFrame{Tag: 1, Payload: []byte("hello")}))
+}
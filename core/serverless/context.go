@@ -2,22 +2,36 @@
 package serverless
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
 	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core/frame"
 	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/serverless"
 )
 
 // Context sfn handler context
 type Context struct {
-	writer frame.Writer
-	tag    uint32
-	md     metadata.M
-	data   []byte
-	fnCall *ai.FunctionCall
+	writer  frame.Writer
+	tag     uint32
+	md      metadata.M
+	data    []byte
+	fnCall  *ai.FunctionCall
+	state   serverless.State
+	invoker Invoker
 }
 
 // NewContext creates a new serverless Context
 func NewContext(writer frame.Writer, tag uint32, md metadata.M, data []byte) *Context {
+	// the signature and the frame id of the received frame are not carried by the frames written afterwards.
+	delete(md, metadata.SignatureKey)
+	delete(md, metadata.SignatureKeyIDKey)
+	delete(md, metadata.FrameIDKey)
+
 	return &Context{
 		writer: writer,
 		tag:    tag,
@@ -26,6 +40,21 @@ func NewContext(writer frame.Writer, tag uint32, md metadata.M, data []byte) *Co
 	}
 }
 
+// SetState sets the durable state of the sfn, which is returned by State().
+func (c *Context) SetState(state serverless.State) {
+	c.state = state
+}
+
+// SetInvoker sets the invoker of the sfn, which enables InvokeFunction().
+func (c *Context) SetInvoker(invoker Invoker) {
+	c.invoker = invoker
+}
+
+// State returns the durable state of the sfn
+func (c *Context) State() serverless.State {
+	return c.state
+}
+
 // Tag returns the tag of the data frame
 func (c *Context) Tag() uint32 {
 	return c.tag
@@ -36,45 +65,88 @@ func (c *Context) Data() []byte {
 	return c.data
 }
 
+// DataReader returns a reader of the data of the data frame
+func (c *Context) DataReader() io.Reader {
+	return bytes.NewReader(c.data)
+}
+
 // Metadata returns the metadata of the data frame
 func (c *Context) Metadata(key string) (string, bool) {
 	return c.md.Get(key)
 }
 
+// SetMetadata sets the metadata carried by the data written afterwards
+func (c *Context) SetMetadata(key, value string) error {
+	if key == "" {
+		return errors.New("metadata key is empty")
+	}
+	if metadata.IsReservedKey(key) {
+		return fmt.Errorf("metadata key %s is reserved", key)
+	}
+	c.md.Set(key, value)
+	return nil
+}
+
 // Write writes the data
 func (c *Context) Write(tag uint32, data []byte) error {
 	if data == nil {
 		return nil
 	}
-	if err := frame.IsReservedTag(tag); err != nil {
-		return err
-	}
-	mdBytes, err := c.md.Encode()
-	if err != nil {
-		return err
+	return c.write(context.Background(), tag, data, c.md)
+}
+
+// WriteContext writes the data like Write, the write blocked on a congested connection returns
+// the cause of the ctx once the ctx is done, eg: the deadline is exceeded.
+func (c *Context) WriteContext(ctx context.Context, tag uint32, data []byte) error {
+	if data == nil {
+		return nil
 	}
+	return c.write(ctx, tag, data, c.md)
+}
 
-	dataFrame := &frame.DataFrame{
-		Tag:      tag,
-		Metadata: mdBytes,
-		Payload:  data,
+// WriteWithTarget writes the data to the sfn instance with the specified target,
+// the target only takes effect on this write.
+func (c *Context) WriteWithTarget(tag uint32, data []byte, target string) error {
+	if data == nil {
+		return nil
+	}
+	if target == "" {
+		return c.Write(tag, data)
+	}
+	md := c.md.Clone()
+	if md == nil {
+		md = metadata.M{}
 	}
+	md.Set(metadata.TargetKey, target)
 
-	return c.writer.WriteFrame(dataFrame)
+	return c.write(context.Background(), tag, data, md)
 }
 
-func (c *Context) WriteWithTarget(tag uint32, data []byte, target string) error {
+// WriteWithMetadata writes the data with additional metadata, the metadata is merged into the
+// incoming metadata and only takes effect on this write. The keys prefixed with `yomo-` are reserved.
+func (c *Context) WriteWithMetadata(tag uint32, data []byte, md map[string]string) error {
 	if data == nil {
 		return nil
 	}
-	if err := frame.IsReservedTag(tag); err != nil {
-		return err
+	merged := c.md.Clone()
+	if merged == nil {
+		merged = metadata.M{}
 	}
-	if target != "" {
-		c.md.Set(metadata.TargetKey, target)
+	for k, v := range md {
+		if metadata.IsReservedKey(k) {
+			return fmt.Errorf("metadata key %s is reserved", k)
+		}
+		merged.Set(k, v)
 	}
 
-	mdBytes, err := c.md.Encode()
+	return c.write(context.Background(), tag, data, merged)
+}
+
+func (c *Context) write(ctx context.Context, tag uint32, data []byte, md metadata.M) error {
+	if err := frame.IsReservedTag(tag); err != nil {
+		return err
+	}
+	mdBytes, err := md.Encode()
 	if err != nil {
 		return err
 	}
@@ -85,5 +157,8 @@ func (c *Context) WriteWithTarget(tag uint32, data []byte, target string) error
 		Payload:  data,
 	}
 
+	if w, ok := c.writer.(frame.ContextWriter); ok {
+		return w.WriteFrameContext(ctx, dataFrame)
+	}
 	return c.writer.WriteFrame(dataFrame)
 }
@@ -1,12 +1,27 @@
 package serverless
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
+	"time"
 
 	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/id"
 )
 
+// Invoker awaits the results of the functions invoked by the sfn, it is provided by the sfn.
+type Invoker interface {
+	// Name returns the name of the sfn, it is appended to the call chain of the invoked function.
+	Name() string
+	// Await returns the channel to receive the result of the invoking request, cancel must be
+	// called when the result is no longer awaited.
+	Await(reqID string) (result <-chan *ai.FunctionCall, cancel func())
+}
+
 // ReadLLMArguments reads LLM function arguments
 func (c *Context) ReadLLMArguments(args any) error {
 	fnCall := &ai.FunctionCall{}
@@ -37,6 +52,42 @@ func (c *Context) WriteLLMResult(result string) error {
 	return c.Write(ai.ReducerTag, buf)
 }
 
+// WriteLLMPartialResult writes an incremental progress chunk of the LLM function result
+func (c *Context) WriteLLMPartialResult(chunk string) error {
+	if c.fnCall == nil {
+		return errors.New("no function call, can't write result")
+	}
+	partial := *c.fnCall
+	partial.IsOK = true
+	partial.IsPartial = true
+	partial.Result = chunk
+	partial.ToolResult = nil
+	buf, err := partial.Bytes()
+	if err != nil {
+		return err
+	}
+	return c.Write(ai.ReducerTag, buf)
+}
+
+// WriteLLMToolResult writes the structured LLM function result, the result must be *ai.ToolResult
+func (c *Context) WriteLLMToolResult(result any) error {
+	if c.fnCall == nil {
+		return errors.New("no function call, can't write result")
+	}
+	toolResult, ok := result.(*ai.ToolResult)
+	if !ok {
+		return errors.New("given object is not *ai.ToolResult")
+	}
+	if err := c.fnCall.SetToolResult(toolResult); err != nil {
+		return err
+	}
+	buf, err := c.fnCall.Bytes()
+	if err != nil {
+		return err
+	}
+	return c.Write(ai.ReducerTag, buf)
+}
+
 // ReadLLMFunctionCall reads LLM function call
 func (c *Context) ReadLLMFunctionCall(fnCall any) error {
 	if c.data == nil {
@@ -48,3 +99,60 @@ func (c *Context) ReadLLMFunctionCall(fnCall any) error {
 	}
 	return fco.FromBytes(c.data)
 }
+
+// InvokeFunction invokes the LLM function registered in the zipper by name through the bridge,
+// it waits for the result until ai.FunctionInvokeTimeout.
+func (c *Context) InvokeFunction(name string, args any) (string, error) {
+	if c.invoker == nil {
+		return "", errors.New("function invoking is only available in the llm sfn")
+	}
+	arguments, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	// the function call which invokes this sfn, it is empty if the sfn is not invoked by the llm
+	parent := c.fnCall
+	if parent == nil {
+		parent = &ai.FunctionCall{}
+		_ = parent.FromBytes(c.data)
+	}
+	callChain := append(slices.Clone(parent.CallChain), c.invoker.Name())
+	if err := ai.CheckCallChain(callChain, name); err != nil {
+		return "", err
+	}
+	fnCall := &ai.FunctionCall{
+		TransID:      parent.TransID,
+		ReqID:        id.New(16),
+		FunctionName: name,
+		Arguments:    string(arguments),
+		UserQuery:    parent.UserQuery,
+		CallChain:    callChain,
+	}
+	buf, err := fnCall.Bytes()
+	if err != nil {
+		return "", err
+	}
+
+	result, cancel := c.invoker.Await(fnCall.ReqID)
+	defer cancel()
+
+	// the invoking request is sent to the bridge, so the target of the incoming data is dropped
+	md := c.md.Clone()
+	if md == nil {
+		md = metadata.M{}
+	}
+	delete(md, metadata.TargetKey)
+	if err := c.write(context.Background(), ai.FunctionInvokeTag, buf, md); err != nil {
+		return "", err
+	}
+
+	select {
+	case res := <-result:
+		if !res.IsOK {
+			return "", fmt.Errorf("invoke function %s: %s", name, res.Error)
+		}
+		return res.Result, nil
+	case <-time.After(ai.FunctionInvokeTimeout):
+		return "", fmt.Errorf("invoke function %s: timeout after %s", name, ai.FunctionInvokeTimeout)
+	}
+}
@@ -0,0 +1,73 @@
+package serverless
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+type mockWriter struct {
+	frames []*frame.DataFrame
+}
+
+func (w *mockWriter) WriteFrame(f frame.Frame) error {
+	w.frames = append(w.frames, f.(*frame.DataFrame))
+	return nil
+}
+
+func (w *mockWriter) metadata(t *testing.T, i int) metadata.M {
+	md, err := metadata.Decode(w.frames[i].Metadata)
+	assert.NoError(t, err)
+	return md
+}
+
+func TestContextDataReader(t *testing.T) {
+	ctx := NewContext(&mockWriter{}, 0x10, metadata.M{}, []byte("hello"))
+
+	data, err := io.ReadAll(ctx.DataReader())
+	assert.NoError(t, err)
+	assert.Equal(t, ctx.Data(), data)
+}
+
+func TestContextWrite(t *testing.T) {
+	w := &mockWriter{}
+	ctx := NewContext(w, 0x10, metadata.M{metadata.TIDKey: "tid"}, []byte("hello"))
+
+	t.Run("WriteWithTarget", func(t *testing.T) {
+		assert.NoError(t, ctx.WriteWithTarget(0x11, []byte("data"), "target"))
+		assert.NoError(t, ctx.Write(0x11, []byte("data")))
+
+		target, _ := w.metadata(t, 0).Get(metadata.TargetKey)
+		assert.Equal(t, "target", target)
+		_, ok := w.metadata(t, 1).Get(metadata.TargetKey)
+		assert.False(t, ok, "the target only takes effect on one write")
+	})
+
+	t.Run("WriteWithMetadata", func(t *testing.T) {
+		w.frames = nil
+
+		assert.NoError(t, ctx.WriteWithMetadata(0x11, []byte("data"), map[string]string{"tenant-id": "yomo"}))
+		assert.Error(t, ctx.WriteWithMetadata(0x11, []byte("data"), map[string]string{metadata.TIDKey: "tid2"}))
+
+		md := w.metadata(t, 0)
+		tenant, _ := md.Get("tenant-id")
+		assert.Equal(t, "yomo", tenant)
+		tid, _ := md.Get(metadata.TIDKey)
+		assert.Equal(t, "tid", tid)
+		assert.Len(t, w.frames, 1)
+	})
+
+	t.Run("SetMetadata", func(t *testing.T) {
+		w.frames = nil
+
+		assert.NoError(t, ctx.SetMetadata("trace-hint", "a"))
+		assert.Error(t, ctx.SetMetadata(metadata.TraceIDKey, "b"))
+		assert.NoError(t, ctx.Write(0x11, []byte("data")))
+
+		hint, _ := w.metadata(t, 0).Get("trace-hint")
+		assert.Equal(t, "a", hint)
+	})
+}
@@ -1,6 +1,8 @@
 package serverless
 
 import (
+	"context"
+
 	"github.com/yomorun/yomo/core/frame"
 	"github.com/yomorun/yomo/core/metadata"
 )
@@ -25,6 +27,12 @@ func NewCronContext(writer frame.Writer, md metadata.M) *CronContext {
 
 // Write writes the data to next sfn instance.
 func (c *CronContext) Write(tag uint32, data []byte) error {
+	return c.WriteContext(context.Background(), tag, data)
+}
+
+// WriteContext writes the data to next sfn instance like Write, the write blocked on a congested
+// connection returns the cause of the ctx once the ctx is done.
+func (c *CronContext) WriteContext(ctx context.Context, tag uint32, data []byte) error {
 	if data == nil {
 		return nil
 	}
@@ -37,6 +45,9 @@ func (c *CronContext) Write(tag uint32, data []byte) error {
 		Payload:  data,
 	}
 
+	if w, ok := c.writer.(frame.ContextWriter); ok {
+		return w.WriteFrameContext(ctx, dataFrame)
+	}
 	return c.writer.WriteFrame(dataFrame)
 }
 
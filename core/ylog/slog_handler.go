@@ -9,6 +9,8 @@ import (
 	"os"
 	"strings"
 	"sync"
+
+	"github.com/yomorun/yomo/pkg/redact"
 )
 
 // handler supports splitting log stream to common log stream and error log stream.
@@ -115,14 +117,13 @@ func bufferedSlogHandler(buf io.Writer, format string, level slog.Level, verbose
 	opt := &slog.HandlerOptions{
 		AddSource: verbose,
 		Level:     level,
-	}
-	if disableTime {
-		opt.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
-			if a.Key == "time" {
+		// the secrets are redacted from the messages and the attributes.
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if disableTime && a.Key == "time" {
 				return slog.Attr{}
 			}
-			return a
-		}
+			return redact.Default().Attr(a)
+		},
 	}
 
 	var h slog.Handler
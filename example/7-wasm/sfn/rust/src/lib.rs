@@ -12,8 +12,8 @@ fn observe_datatags() -> Vec<u32> {
 #[yomo::handler]
 fn handler(ctx: yomo::Context) -> anyhow::Result<()> {
     // load input tag & data
-    let tag = ctx.get_tag();
-    let input = ctx.load_input();
+    let tag = ctx.tag();
+    let input = ctx.data();
     println!(
         "wasm rust sfn received {} bytes with tag[{:#x}]",
         input.len(),
@@ -26,8 +26,8 @@ fn handler(ctx: yomo::Context) -> anyhow::Result<()> {
     // your app logic goes here
     let output = input.to_uppercase();
 
-    // return the datatag and output bytes
-    ctx.dump_output(0x34, output.into_bytes());
+    // write the output with datatag
+    ctx.write(0x34, output.as_bytes())?;
 
     Ok(())
 }
@@ -2,11 +2,18 @@ package yomo
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"log/slog"
+	"time"
 
 	"github.com/quic-go/quic-go"
+	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core"
 	"github.com/yomorun/yomo/core/router"
+	"github.com/yomorun/yomo/pkg/dedup"
+	yquic "github.com/yomorun/yomo/pkg/listener/quic"
+	"github.com/yomorun/yomo/pkg/signature"
+	"github.com/yomorun/yomo/serverless"
 )
 
 type (
@@ -25,6 +32,18 @@ var (
 	// WithSourceTLSConfig sets tls config for the Source.
 	WithSourceTLSConfig = func(tc *tls.Config) SourceOption { return SourceOption(core.WithClientTLSConfig(tc)) }
 
+	// WithSourceRootCAs sets the root CAs verifying the zipper for the Source, see core.WithClientRootCAs.
+	WithSourceRootCAs = func(pool *x509.CertPool) SourceOption { return SourceOption(core.WithClientRootCAs(pool)) }
+
+	// WithSourceCertificate sets the client certificate of the Source, see core.WithClientCertificate.
+	WithSourceCertificate = func(cert tls.Certificate) SourceOption { return SourceOption(core.WithClientCertificate(cert)) }
+
+	// WithSourceServerName sets the server name (SNI) of the zipper for the Source.
+	WithSourceServerName = func(name string) SourceOption { return SourceOption(core.WithClientServerName(name)) }
+
+	// WithSourceInsecureSkipVerify sets whether the Source skips verifying the certificate of the zipper.
+	WithSourceInsecureSkipVerify = func(skip bool) SourceOption { return SourceOption(core.WithClientInsecureSkipVerify(skip)) }
+
 	// WithSourceQuicConfig sets quic config for the Source.
 	WithSourceQuicConfig = func(qc *quic.Config) SourceOption { return SourceOption(core.WithClientQuicConfig(qc)) }
 
@@ -33,6 +52,13 @@ var (
 
 	// WithSourceReConnect makes source Connect until success, unless authentication fails.
 	WithSourceReConnect = func() SourceOption { return SourceOption(core.WithReConnect()) }
+
+	// WithSourceNearestRouting routes the data written by the Source to the nearest instance observing the tag,
+	// the nearest instance is the one with the lowest RTT to the zipper.
+	WithSourceNearestRouting = func() SourceOption { return SourceOption(core.WithNearestRouting()) }
+
+	// WithSourceSigner signs the data frames written by the Source.
+	WithSourceSigner = func(s *signature.Signer) SourceOption { return SourceOption(core.WithSigner(s)) }
 )
 
 // Sfn Options.
@@ -43,6 +69,18 @@ var (
 	// WithSfnTLSConfig sets tls config for the Sfn.
 	WithSfnTLSConfig = func(tc *tls.Config) SfnOption { return SfnOption(core.WithClientTLSConfig(tc)) }
 
+	// WithSfnRootCAs sets the root CAs verifying the zipper for the Sfn, see core.WithClientRootCAs.
+	WithSfnRootCAs = func(pool *x509.CertPool) SfnOption { return SfnOption(core.WithClientRootCAs(pool)) }
+
+	// WithSfnCertificate sets the client certificate of the Sfn, see core.WithClientCertificate.
+	WithSfnCertificate = func(cert tls.Certificate) SfnOption { return SfnOption(core.WithClientCertificate(cert)) }
+
+	// WithSfnServerName sets the server name (SNI) of the zipper for the Sfn.
+	WithSfnServerName = func(name string) SfnOption { return SfnOption(core.WithClientServerName(name)) }
+
+	// WithSfnInsecureSkipVerify sets whether the Sfn skips verifying the certificate of the zipper.
+	WithSfnInsecureSkipVerify = func(skip bool) SfnOption { return SfnOption(core.WithClientInsecureSkipVerify(skip)) }
+
 	// WithSfnQuicConfig sets quic config for the Sfn.
 	WithSfnQuicConfig = func(qc *quic.Config) SfnOption { return SfnOption(core.WithClientQuicConfig(qc)) }
 
@@ -52,10 +90,42 @@ var (
 	// WithSfnReConnect makes sfn Connect until success, unless authentication fails.
 	WithSfnReConnect = func() SfnOption { return SfnOption(core.WithReConnect()) }
 
+	// WithSfnDedup drops the data frames whose frame ids have been seen in the window, see core.WithDedup.
+	WithSfnDedup = func(w *dedup.Window) SfnOption { return SfnOption(core.WithDedup(w)) }
+
+	// WithSfnSigner signs the data frames written by the Sfn.
+	WithSfnSigner = func(s *signature.Signer) SfnOption { return SfnOption(core.WithSigner(s)) }
+
+	// WithSfnSharedConnection makes the Sfn share one QUIC connection to the zipper with the other Sfns
+	// in the process, each Sfn transmits the frames upon its own stream of the connection.
+	WithSfnSharedConnection = func() SfnOption { return SfnOption(core.WithConnectionMux(yquic.DefaultMux)) }
+
+	// WithSfnVerifier verifies the data frames received by the Sfn, the frames failed to verify are dropped.
+	WithSfnVerifier = func(v *signature.Verifier) SfnOption { return SfnOption(core.WithVerifier(v)) }
+
 	// WithSfnAIFunctionDefinition sets AI function definition for the Sfn.
 	WithSfnAIFunctionDefinition = func(description string, inputModel any) SfnOption {
 		return SfnOption(core.WithAIFunctionDefinition(description, inputModel))
 	}
+
+	// WithSfnAIFunctionVersion sets the version and aliases of the AI function for the Sfn.
+	WithSfnAIFunctionVersion = func(version string, aliases ...string) SfnOption {
+		return SfnOption(core.WithAIFunctionVersion(version, aliases...))
+	}
+
+	// WithSfnAIFunctionDescriptions sets the localized descriptions of the AI function for the Sfn.
+	WithSfnAIFunctionDescriptions = func(descriptions map[string]string) SfnOption {
+		return SfnOption(core.WithAIFunctionDescriptions(descriptions))
+	}
+
+	// WithSfnAIFunctionCallPolicy sets the retry policy and timeout of the AI function for the Sfn.
+	WithSfnAIFunctionCallPolicy = func(policy ai.CallPolicy) SfnOption {
+		return SfnOption(core.WithAIFunctionCallPolicy(policy))
+	}
+
+	// WithSfnStateStore sets the durable state store for the Sfn, the state is persisted to disk, or to the
+	// redis of the environment variable `YOMO_STATE_REDIS`, by default.
+	WithSfnStateStore = func(store serverless.State) SfnOption { return SfnOption(core.WithStateStore(store)) }
 )
 
 // ClientOption is option for the upstream Zipper.
@@ -132,6 +202,36 @@ var (
 		}
 	}
 
+	// WithZipperVerifier verifies the signatures of the data frames received by the zipper.
+	WithZipperVerifier = func(v *signature.Verifier) ZipperOption {
+		return func(o *zipperOptions) {
+			o.serverOption = append(o.serverOption, core.WithServerVerifier(v))
+		}
+	}
+
+	// WithZipperDedup drops the data frames whose frame ids have been seen in the window by the zipper.
+	WithZipperDedup = func(w *dedup.Window) ZipperOption {
+		return func(o *zipperOptions) {
+			o.serverOption = append(o.serverOption, core.WithServerDedup(w))
+		}
+	}
+
+	// WithZipperFrameWorkers handles the data frames by a bounded pool of workers in the zipper,
+	// each worker queues up to queueSize frames.
+	WithZipperFrameWorkers = func(workers, queueSize int) ZipperOption {
+		return func(o *zipperOptions) {
+			o.serverOption = append(o.serverOption, core.WithFrameWorkers(workers, queueSize))
+		}
+	}
+
+	// WithZipperMaxConnectionAge asks the clients to reconnect once their connections are older than age,
+	// the connections are closed if the clients don't reconnect in the grace period.
+	WithZipperMaxConnectionAge = func(age, grace time.Duration) ZipperOption {
+		return func(o *zipperOptions) {
+			o.serverOption = append(o.serverOption, core.WithMaxConnectionAge(age, grace))
+		}
+	}
+
 	// WithZipperFrameMiddleware sets frame middleware for the zipper.
 	WithZipperFrameMiddleware = func(mw ...core.FrameMiddleware) ZipperOption {
 		return func(o *zipperOptions) {
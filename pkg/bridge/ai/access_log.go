@@ -0,0 +1,274 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLog is the configuration of the access log of the BasicAPIServer, the access log is written
+// separately from the debug logs.
+// The configuration looks like:
+//
+//	access_log:
+//		format: json
+//		output: /var/log/yomo/access.log
+//		fields: [time, remote_addr, method, path, status, bytes, duration, trans_id]
+type AccessLog struct {
+	// Format is the format of the records, json or common (the Common Log Format), the default is json.
+	Format string `yaml:"format"`
+	// Output is stdout, stderr or the file path to append the records to, the default is stdout.
+	Output string `yaml:"output"`
+	// Fields are the fields of the json records, all the fields are written by default.
+	Fields []string `yaml:"fields"`
+}
+
+// accessLogFields are the fields can be selected, they are written in this order by default.
+var accessLogFields = []string{
+	"time",
+	"remote_addr",
+	"method",
+	"path",
+	"query",
+	"protocol",
+	"status",
+	"bytes",
+	"duration",
+	"stream",
+	"trans_id",
+	"user_agent",
+	"referer",
+	"authorization",
+}
+
+// credentialParams are the query parameters which carry the credentials, their values are redacted.
+var credentialParams = []string{"key", "api_key", "api-key", "token", "access_token", "credential"}
+
+// NewAccessLogHandler returns the handler which writes an access log record for every request after
+// it is served, the duration and bytes of the stream responses are counted until the stream ends.
+func NewAccessLogHandler(next http.Handler, conf AccessLog) (http.Handler, error) {
+	w, err := accessLogOutput(conf.Output)
+	if err != nil {
+		return nil, err
+	}
+	return newAccessLogHandler(next, conf, w)
+}
+
+func newAccessLogHandler(next http.Handler, conf AccessLog, w io.Writer) (http.Handler, error) {
+	l := &accessLogger{w: w, fields: accessLogFields}
+	switch conf.Format {
+	case "", "json":
+		l.format = l.formatJSON
+	case "common":
+		l.format = l.formatCommon
+	default:
+		return nil, fmt.Errorf("unknown access log format: %s", conf.Format)
+	}
+	if len(conf.Fields) > 0 {
+		for _, field := range conf.Fields {
+			if !slices.Contains(accessLogFields, field) {
+				return nil, fmt.Errorf("unknown access log field: %s", field)
+			}
+		}
+		l.fields = conf.Fields
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		aw := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+		l.log(r, aw, start)
+	}), nil
+}
+
+func accessLogOutput(output string) (io.Writer, error) {
+	switch strings.ToLower(output) {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open access log output: %w", err)
+		}
+		return f, nil
+	}
+}
+
+// accessLogger formats and writes the records, the records are written one by one.
+type accessLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	fields []string
+	format func(r *http.Request, aw *accessLogWriter, start time.Time) []byte
+}
+
+func (l *accessLogger) log(r *http.Request, aw *accessLogWriter, start time.Time) {
+	record := l.format(r, aw, start)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(record)
+}
+
+func (l *accessLogger) formatJSON(r *http.Request, aw *accessLogWriter, start time.Time) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range l.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field)
+		value, _ := json.Marshal(accessLogValue(field, r, aw, start))
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// formatCommon formats the record in the Common Log Format: host ident authuser [date] "request" status bytes.
+func (l *accessLogger) formatCommon(r *http.Request, aw *accessLogWriter, start time.Time) []byte {
+	size := "-"
+	if aw.bytes > 0 {
+		size = strconv.FormatInt(aw.bytes, 10)
+	}
+	return []byte(fmt.Sprintf(
+		"%s - - [%s] \"%s %s %s\" %d %s\n",
+		remoteHost(r),
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method,
+		redactURI(r.URL),
+		r.Proto,
+		aw.statusCode(),
+		size,
+	))
+}
+
+func accessLogValue(field string, r *http.Request, aw *accessLogWriter, start time.Time) any {
+	switch field {
+	case "time":
+		return start.Format(time.RFC3339Nano)
+	case "remote_addr":
+		return remoteHost(r)
+	case "method":
+		return r.Method
+	case "path":
+		return r.URL.Path
+	case "query":
+		return redactQuery(r.URL.Query())
+	case "protocol":
+		return r.Proto
+	case "status":
+		return aw.statusCode()
+	case "bytes":
+		return aw.bytes
+	case "duration":
+		return time.Since(start).Seconds()
+	case "stream":
+		return strings.HasPrefix(aw.Header().Get("Content-Type"), "text/event-stream")
+	case "trans_id":
+		return FromTransIDContext(r.Context())
+	case "user_agent":
+		return r.UserAgent()
+	case "referer":
+		return r.Referer()
+	case "authorization":
+		return redactAuthorization(r.Header.Get("Authorization"))
+	}
+	return nil
+}
+
+// remoteHost returns the host of the client, the port is stripped.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// redactAuthorization keeps the scheme of the authorization header and redacts the credential.
+func redactAuthorization(auth string) string {
+	if auth == "" {
+		return ""
+	}
+	if scheme, _, ok := strings.Cut(auth, " "); ok {
+		return scheme + " [REDACTED]"
+	}
+	return "[REDACTED]"
+}
+
+// redactQuery returns the encoded query in which the credentials are redacted.
+func redactQuery(query url.Values) string {
+	for k := range query {
+		for _, param := range credentialParams {
+			if strings.EqualFold(k, param) {
+				query.Set(k, "REDACTED")
+			}
+		}
+	}
+	return query.Encode()
+}
+
+// redactURI returns the request uri in which the credentials of the query are redacted.
+func redactURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	return u.Path + "?" + redactQuery(u.Query())
+}
+
+// accessLogWriter records the status and the bytes of the response.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush flushes the stream responses, the handlers assert the http.Flusher to write the events.
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *accessLogWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLogHandler(t *testing.T) {
+	streamHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := eventFlusher(w)
+		io.WriteString(w, "data: hello\n\n")
+		flusher.Flush()
+		io.WriteString(w, "data: [DONE]")
+		flusher.Flush()
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		handler, err := newAccessLogHandler(
+			streamHandler,
+			AccessLog{Fields: []string{"method", "path", "query", "status", "bytes", "stream", "authorization"}},
+			&buf,
+		)
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?api_key=secret&model=gpt-4o", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		assert.True(t, rr.Flushed)
+		assert.JSONEq(t, `{
+			"method": "POST",
+			"path": "/v1/chat/completions",
+			"query": "api_key=REDACTED&model=gpt-4o",
+			"status": 200,
+			"bytes": 25,
+			"stream": true,
+			"authorization": "Bearer [REDACTED]"
+		}`, buf.String())
+	})
+
+	t.Run("all fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		handler, err := newAccessLogHandler(http.NotFoundHandler(), AccessLog{}, &buf)
+		assert.NoError(t, err)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+		record := map[string]any{}
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+		assert.Len(t, record, len(accessLogFields))
+		assert.Equal(t, float64(http.StatusNotFound), record["status"])
+	})
+
+	t.Run("common", func(t *testing.T) {
+		var buf bytes.Buffer
+		handler, err := newAccessLogHandler(streamHandler, AccessLog{Format: "common"}, &buf)
+		assert.NoError(t, err)
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/invoke?token=secret", nil))
+
+		assert.Regexp(t, regexp.MustCompile(
+			`^192\.0\.2\.1 - - \[.+\] "POST /invoke\?token=REDACTED HTTP/1\.1" 200 25\n$`,
+		), buf.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := newAccessLogHandler(streamHandler, AccessLog{Format: "xml"}, io.Discard)
+		assert.Error(t, err)
+
+		_, err = newAccessLogHandler(streamHandler, AccessLog{Fields: []string{"password"}}, io.Discard)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,139 @@
+package ai
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+// AdminToken authenticates the requests of the admin API by the bearer token, the admin API is disabled if
+// it is empty.
+var AdminToken string
+
+var (
+	errAdminDisabled   = errors.New("the admin API is disabled, set admin_token to enable it")
+	errAdminToken      = errors.New("invalid admin token")
+	errCallerNotCached = errors.New("the caller is not cached")
+)
+
+// CachedCaller is a caller cached by the service cache, the credential is identified by its hash only.
+type CachedCaller struct {
+	CredentialHash string `json:"credential_hash"`
+	Age            string `json:"age"`
+	Idle           string `json:"idle"`
+	// Tools is the number of the sfns the caller can call as the tools.
+	Tools int `json:"tools"`
+}
+
+// HandleAdminServices is the handler of the admin API of the cached callers, the requests are authenticated
+// by the bearer token AdminToken. The routes are:
+//
+//	GET    /admin/services                           lists the cached callers
+//	DELETE /admin/services/{credential_hash}         evicts the caller, it's created again by its next request
+//	POST   /admin/services/{credential_hash}/refresh creates the caller again, its metadata is exchanged again
+func HandleAdminServices(w http.ResponseWriter, r *http.Request) {
+	if code, err := authorizeAdmin(r); err != nil {
+		RespondWithError(w, code, err)
+		return
+	}
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/services"), "/")
+	var segments []string
+	if path != "" {
+		segments = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		respondJSON(w, listCachedCallers())
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		evictCachedCaller(w, segments[0])
+	case len(segments) == 2 && segments[1] == "refresh" && r.Method == http.MethodPost:
+		refreshCachedCaller(w, segments[0])
+	case len(segments) <= 2:
+		RespondWithError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	default:
+		RespondWithError(w, http.StatusNotFound, fmt.Errorf("%s is not found", r.URL.Path))
+	}
+}
+
+// authorizeAdmin checks the bearer token of the request, it returns the status code if it's not authorized.
+func authorizeAdmin(r *http.Request) (int, error) {
+	if AdminToken == "" {
+		return http.StatusForbidden, errAdminDisabled
+	}
+	token := bearerToken(r.Header.Get("Authorization"))
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) != 1 {
+		return http.StatusUnauthorized, errAdminToken
+	}
+	return 0, nil
+}
+
+func listCachedCallers() []CachedCaller {
+	now := time.Now()
+	callers := []CachedCaller{}
+	for _, entry := range services.snapshot() {
+		tools, _ := register.ListToolCalls(entry.value.Metadata)
+		callers = append(callers, CachedCaller{
+			CredentialHash: credentialHash(entry.key),
+			Age:            now.Sub(entry.created).Round(time.Second).String(),
+			Idle:           now.Sub(entry.lastAccess).Round(time.Second).String(),
+			Tools:          len(tools),
+		})
+	}
+	return callers
+}
+
+// findCachedCaller returns the credential and the service of the cached caller by the hash of the credential.
+func findCachedCaller(hash string) (string, *Service, bool) {
+	for _, entry := range services.snapshot() {
+		if credentialHash(entry.key) == hash {
+			return entry.key, entry.value, true
+		}
+	}
+	return "", nil, false
+}
+
+func evictCachedCaller(w http.ResponseWriter, hash string) {
+	credential, _, ok := findCachedCaller(hash)
+	if !ok || !services.Remove(credential) {
+		RespondWithError(w, http.StatusNotFound, errCallerNotCached)
+		return
+	}
+	ylog.Info("evict the cached caller", "credential_hash", hash)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// refreshCachedCaller creates the service of the caller again, so the changes of its metadata take effect
+// without restarting the zipper. The old service is evicted after the new one is created.
+func refreshCachedCaller(w http.ResponseWriter, hash string) {
+	credential, old, ok := findCachedCaller(hash)
+	if !ok {
+		RespondWithError(w, http.StatusNotFound, errCallerNotCached)
+		return
+	}
+	s, err := newService(credential, old.zipperAddr, old.aiProvider, old.exFn)
+	if err != nil {
+		RespondWithError(w, http.StatusBadGateway, err)
+		return
+	}
+	services.Remove(credential)
+	if _, loaded := services.LoadOrStore(credential, s); loaded {
+		s.Release()
+	}
+	ylog.Info("refresh the cached caller", "credential_hash", hash)
+
+	for _, caller := range listCachedCallers() {
+		if caller.CredentialHash == hash {
+			respondJSON(w, caller)
+			return
+		}
+	}
+	RespondWithError(w, http.StatusNotFound, errCallerNotCached)
+}
@@ -0,0 +1,112 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+func TestHandleAdminServices(t *testing.T) {
+	old := services
+	services = newShardedCache(ServiceCache{Shards: 2, MaxEntries: 10, TTL: time.Minute}, (*Service).size, nil)
+	t.Cleanup(func() {
+		services.close()
+		services = old
+		AdminToken = ""
+	})
+
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0x91, &openai.FunctionDefinition{Name: "get-weather"}, 2091, md))
+	defer register.UnregisterFunction(2091, md)
+
+	exFn := func(string) (metadata.M, error) { return nil, errors.New("exchange failed") }
+	services.LoadOrStore("token-a", &Service{credential: "token-a", Metadata: md, exFn: exFn})
+	services.LoadOrStore("token-b", &Service{credential: "token-b", Metadata: md})
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		HandleAdminServices(w, r)
+		return w
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "/admin/services", "").Code)
+	})
+
+	AdminToken = "admin-token"
+
+	t.Run("unauthorized", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/admin/services", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, "/admin/services", "token-a").Code)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := serve(http.MethodGet, "/admin/services", "admin-token")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var callers []CachedCaller
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &callers))
+		assert.Len(t, callers, 2)
+		for _, caller := range callers {
+			assert.Contains(t, []string{credentialHash("token-a"), credentialHash("token-b")}, caller.CredentialHash)
+			assert.GreaterOrEqual(t, caller.Tools, 1)
+		}
+	})
+
+	t.Run("refresh fails", func(t *testing.T) {
+		w := serve(http.MethodPost, "/admin/services/"+credentialHash("token-a")+"/refresh", "admin-token")
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+		// the caller is kept if it's not created again.
+		_, ok := services.Get("token-a")
+		assert.True(t, ok)
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		w := serve(http.MethodDelete, "/admin/services/"+credentialHash("token-b"), "admin-token")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		_, ok := services.Get("token-b")
+		assert.False(t, ok)
+
+		w = serve(http.MethodDelete, "/admin/services/"+credentialHash("token-b"), "admin-token")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("the server serves the new service", func(t *testing.T) {
+		var served *Service
+		handler := WithContextService(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			served = FromServiceContext(r.Context())
+		}), "token-a", "", nil, exFn)
+		serveHTTP := func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/overview", nil))
+		}
+
+		serveHTTP()
+		old, _ := services.Get("token-a")
+		assert.Same(t, old, served)
+
+		w := serve(http.MethodDelete, "/admin/services/"+credentialHash("token-a"), "admin-token")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		// the service is created again by the next request, the evicted one is not served.
+		s := &Service{credential: "token-a", Metadata: md}
+		services.LoadOrStore("token-a", s)
+		serveHTTP()
+		assert.Same(t, s, served)
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPut, "/admin/services", "admin-token").Code)
+		assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/admin/services/a/b/c", "admin-token").Code)
+	})
+}
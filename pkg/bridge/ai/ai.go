@@ -2,14 +2,18 @@
 package ai
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core"
 	"github.com/yomorun/yomo/core/ylog"
 	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+	"github.com/yomorun/yomo/pkg/webhook"
 	"gopkg.in/yaml.v3"
 )
 
@@ -28,13 +32,20 @@ func ConnMiddleware(next core.ConnHandler) core.ConnHandler {
 		connMd := conn.Metadata().Clone()
 		definition, ok := connMd.Get(ai.FunctionDefinitionKey)
 
+		// the audit events of the registered functions, they are recorded again on unregistering
+		var registered []AuditEvent
 		defer func() {
 			// definition does not be transmitted in mesh network, It only works for handshake.
 			conn.Metadata().Set(ai.FunctionDefinitionKey, "")
 			next(conn)
 			if ok {
 				register.UnregisterFunction(conn.ID(), connMd)
+				catalog.remove(conn.ID())
 				conn.Logger.Info("unregister ai function", "name", conn.Name(), "connID", conn.ID())
+				for _, e := range registered {
+					e.Action, e.Time = AuditActionUnregister, time.Now()
+					GetAuditor().Record(e)
+				}
 			}
 		}()
 
@@ -42,6 +53,30 @@ func ConnMiddleware(next core.ConnHandler) core.ConnHandler {
 			return
 		}
 
+		// the version, aliases, localized descriptions and call policy are carried along with the definition
+		fv := ai.FunctionRegistration{}
+		if err := json.Unmarshal([]byte(definition), &fv); err != nil {
+			conn.Logger.Error("unmarshal function definition", "error", err)
+			return
+		}
+		if fv.Version != "" {
+			connMd.Set(ai.FunctionVersionKey, fv.Version)
+		}
+		if len(fv.Aliases) > 0 {
+			connMd.Set(ai.FunctionAliasesKey, strings.Join(fv.Aliases, ","))
+		}
+		for lang, description := range fv.Descriptions {
+			connMd.Set(ai.FunctionDescriptionKey(lang), description)
+		}
+		if fv.Policy != nil {
+			policy, err := json.Marshal(fv.Policy)
+			if err != nil {
+				conn.Logger.Error("marshal function call policy", "error", err)
+				return
+			}
+			connMd.Set(ai.FunctionPolicyKey, string(policy))
+		}
+
 		for _, tag := range conn.ObserveDataTags() {
 			// register ai function
 			fd := ai.FunctionDefinition{}
@@ -56,6 +91,20 @@ func ConnMiddleware(next core.ConnHandler) core.ConnHandler {
 				return
 			}
 			conn.Logger.Info("register ai function success", "name", conn.Name(), "tag", tag, "definition", string(definition))
+			e := newAuditEvent(AuditActionRegister, conn, tag, &fd, fv.Version)
+			GetAuditor().Record(e)
+			registered = append(registered, e)
+			catalog.add(conn, tag, &fd, &fv)
+			webhook.Default().Notify(webhook.Event{
+				Type:         webhook.EventFunctionRegistered,
+				Time:         e.Time,
+				ConnID:       e.ConnID,
+				ClientID:     e.ClientID,
+				Name:         e.SfnName,
+				RemoteAddr:   e.RemoteAddr,
+				Tags:         []uint32{tag},
+				FunctionName: e.FunctionName,
+			})
 		}
 
 	}
@@ -75,6 +124,14 @@ const MetadataKey = "ai"
 //			port: 8000
 //			credential: token:<CREDENTIAL>
 //			provider: openai
+//			access_log:
+//				format: json
+//				output: stdout
+//			audit:
+//				webhook: https://example.com/yomo/audit
+//			slow_call_threshold: 5s
+//			secret_refresh: 10m
+//			function_scope: strict
 //		providers:
 //			azopenai:
 //				api_endpoint: https://<RESOURCE>.openai.azure.com
@@ -82,7 +139,7 @@ const MetadataKey = "ai"
 //				api_key: <API_KEY>
 //				api_version: <API_VERSION>
 //			openai:
-//				api_key:
+//				api_key: vault://secret/data/yomo/openai#api_key
 //				api_endpoint:
 //			gemini:
 //				api_key:
@@ -99,8 +156,38 @@ type Config struct {
 
 // Server is the configuration of the BasicAPIServer, which is the endpoint for end user access
 type Server struct {
-	Addr     string `yaml:"addr"`     // Addr is the address of the server
-	Provider string `yaml:"provider"` // Provider is the llm provider to use
+	Addr              string               `yaml:"addr"`                // Addr is the address of the server
+	GRPCAddr          string               `yaml:"grpc_addr"`           // GRPCAddr is the address of the gRPC service of the chat completions, it is not served if not set
+	Provider          string               `yaml:"provider"`            // Provider is the llm provider to use
+	AccessLog         *AccessLog           `yaml:"access_log"`          // AccessLog is the access log of the server, it is disabled if not set
+	Audit             *Audit               `yaml:"audit"`               // Audit is the audit of the ai function inventory changes
+	SlowCallThreshold time.Duration        `yaml:"slow_call_threshold"` // SlowCallThreshold logs the slow tool calls and llm provider calls, eg: 5s
+	SecretRefresh     time.Duration        `yaml:"secret_refresh"`      // SecretRefresh is the interval of refreshing the secrets referenced by the providers, eg: 10m
+	FunctionScope     string               `yaml:"function_scope"`      // FunctionScope is open or strict, the strict scope denies the functions and the credentials without scopes
+	TLS               bool                 `yaml:"tls"`                 // TLS serves the server over https with the certificate of the zipper, which is rotated when the files are changed
+	TLSConfig         *tls.Config          `yaml:"-"`                   // TLSConfig serves the server over https if it is set, eg: the certificates obtained by acme
+	ServiceCache      *ServiceCache        `yaml:"service_cache"`       // ServiceCache is the cache of the services created for the credentials, the default one is used if not set
+	NearestInstance   bool                 `yaml:"nearest_instance"`    // NearestInstance routes the tool calls to the llm-sfn instance with the lowest RTT to the zipper
+	IdempotencyWindow time.Duration        `yaml:"idempotency_window"`  // IdempotencyWindow is the time the responses of the requests with the Idempotency-Key are stored, default is 24h, negative disables it
+	RateLimit         *RateLimit           `yaml:"rate_limit"`          // RateLimit queues the requests when the llm provider is rate limited, the requests fail immediately if not set
+	ContentFilter     bool                 `yaml:"content_filter"`      // ContentFilter passes the content filter results of Azure OpenAI through to the clients
+	StreamCoalesce    *StreamCoalesce      `yaml:"stream_coalesce"`     // StreamCoalesce coalesces the chunks of the stream responses, every chunk is flushed if not set
+	RequestLimits     *RequestLimits       `yaml:"request_limits"`      // RequestLimits limits the size, the messages and the tools of the requests, the body is limited to 10MB if not set
+	ArgumentRepair    string               `yaml:"argument_repair"`     // ArgumentRepair is off, local or provider, the malformed arguments of the tool calls are repaired locally if not set
+	ToolRetry         map[string]ToolRetry `yaml:"tool_retry"`          // ToolRetry is the retry policies of the tool calls by the function names, "*" is the default one
+	ToolFailure       string               `yaml:"tool_failure"`        // ToolFailure is continue or fail, the failed tool calls are answered by the error tool messages if not set
+	AdminToken        string               `yaml:"admin_token"`         // AdminToken authenticates the admin API /admin/services by the bearer token, the admin API is disabled if not set
+	Callers           []Caller             `yaml:"callers"`             // Callers authenticate the requests by their bearer tokens, the token budgets are of the callers, the requests are not authenticated if not set
+	Moderation        *Moderation          `yaml:"moderation"`          // Moderation moderates the messages of the users before the chat completion requests are sent to the llm provider, it's disabled if not set
+	MaxToolRounds     int                  `yaml:"max_tool_rounds"`     // MaxToolRounds is the max rounds of the tool calls of a chat completion, the model answers after one round if not set
+	ModelRouting      map[string]string    `yaml:"model_routing"`       // ModelRouting routes the requests to the providers by the patterns of their models, eg: "gpt-*": openai, the provider is used if no pattern matches
+	Failover          *Failover            `yaml:"failover"`            // Failover sends the requests to the secondary providers in order when the provider returns 5xx or 429, or times out, it's disabled if not set
+	ProviderRetry     *ProviderRetry       `yaml:"provider_retry"`      // ProviderRetry retries the calls of the llm provider failed by the transient errors with the exponential backoff, the calls are not retried if not set
+	PromptAudit       *PromptAudit         `yaml:"prompt_audit"`        // PromptAudit writes the redacted requests and responses of the llm requests of the audited credentials, it's disabled if not set
+	ResponseCache     *ResponseCache       `yaml:"response_cache"`      // ResponseCache caches the non-streaming chat completions by the exact match of the requests, it's disabled if not set
+	Usage             *Usage               `yaml:"usage"`               // Usage is the usage accounting of the chat completions, the recent 1000 records are kept in memory if not set
+	TokenQuota        *TokenQuota          `yaml:"token_quota"`         // TokenQuota is the daily and monthly token budgets of every credential, the requests are rejected with 429 once the budget is exhausted, the tokens are not limited if not set
+	CircuitBreaker    *CircuitBreaker      `yaml:"circuit_breaker"`     // CircuitBreaker fails the calls of the llm provider fast, or fails them over, for the cooldown after the provider fails in a row, it's disabled if not set
 }
 
 // Provider is the configuration of llm provider
@@ -6,6 +6,7 @@ import (
 	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
 
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
@@ -93,6 +94,24 @@ func TestParseConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Slow call threshold",
+			conf: map[string]interface{}{
+				"ai": map[string]interface{}{
+					"server": map[string]interface{}{
+						"addr":                "localhost:9000",
+						"slow_call_threshold": "5s",
+					},
+				},
+			},
+			expectError: false,
+			expected: &Config{
+				Server: Server{
+					Addr:              "localhost:9000",
+					SlowCallThreshold: 5 * time.Second,
+				},
+			},
+		},
 		{
 			name: "Default server address",
 			conf: map[string]interface{}{
@@ -141,6 +160,10 @@ func (m *MockLLMProvider) GetChatCompletionsStream(_ context.Context, req openai
 	return nil, nil
 }
 
+func (m *MockLLMProvider) GetEmbeddings(_ context.Context, req openai.EmbeddingRequest, _ metadata.M) (openai.EmbeddingResponse, error) {
+	return openai.EmbeddingResponse{}, nil
+}
+
 var _ LLMProvider = &MockLLMProvider{}
 
 func (m *MockLLMProvider) Name() string {
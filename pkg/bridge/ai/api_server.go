@@ -5,14 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	openai "github.com/sashabaranov/go-openai"
 	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
 	"github.com/yomorun/yomo/pkg/id"
+	"github.com/yomorun/yomo/pkg/trace"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -41,6 +47,73 @@ type BasicAPIServer struct {
 
 // Serve starts the Basic API Server
 func Serve(config *Config, zipperListenAddr string, credential string) error {
+	SlowCallThreshold = config.Server.SlowCallThreshold
+	NearestInstance = config.Server.NearestInstance
+	ContentFilterPassthrough = config.Server.ContentFilter
+	AdminToken = config.Server.AdminToken
+	if config.Server.ArgumentRepair != "" {
+		ArgumentRepair = config.Server.ArgumentRepair
+	}
+	if config.Server.ToolFailure != "" {
+		ToolFailure = config.Server.ToolFailure
+	}
+	if config.Server.IdempotencyWindow != 0 {
+		IdempotencyWindow = config.Server.IdempotencyWindow
+	}
+	register.DenyUnscoped.Store(config.Server.FunctionScope == "strict")
+	if config.Server.RateLimit != nil {
+		ConfigureRateLimit(*config.Server.RateLimit)
+	}
+	if config.Server.ToolRetry != nil {
+		ConfigureToolRetry(config.Server.ToolRetry)
+	}
+	if config.Server.RequestLimits != nil {
+		ConfigureRequestLimits(*config.Server.RequestLimits)
+	}
+	if config.Server.StreamCoalesce != nil {
+		ConfigureStreamCoalesce(*config.Server.StreamCoalesce)
+	}
+	if config.Server.ServiceCache != nil {
+		ConfigureServiceCache(*config.Server.ServiceCache)
+	}
+	if config.Server.Moderation != nil {
+		ConfigureModeration(*config.Server.Moderation)
+	}
+	if config.Server.MaxToolRounds > 0 {
+		opts := getServiceOptions()
+		opts.MaxToolRounds = config.Server.MaxToolRounds
+		ConfigureServiceOptions(opts)
+	}
+	if err := ConfigureModelRouting(config.Server.ModelRouting); err != nil {
+		return err
+	}
+	if config.Server.ProviderRetry != nil {
+		ConfigureProviderRetry(*config.Server.ProviderRetry)
+	}
+	if config.Server.ResponseCache != nil {
+		ConfigureResponseCache(*config.Server.ResponseCache)
+	}
+	if config.Server.Usage != nil {
+		if err := ConfigureUsage(*config.Server.Usage); err != nil {
+			return err
+		}
+	}
+	if err := ConfigureCallers(config.Server.Callers); err != nil {
+		return err
+	}
+	if config.Server.TokenQuota != nil {
+		if err := ConfigureTokenQuota(*config.Server.TokenQuota); err != nil {
+			return err
+		}
+	}
+	if config.Server.CircuitBreaker != nil {
+		ConfigureCircuitBreaker(*config.Server.CircuitBreaker)
+	}
+	if config.Server.Failover != nil {
+		if err := ConfigureFailover(*config.Server.Failover); err != nil {
+			return err
+		}
+	}
 	provider, err := GetProviderAndSetDefault(config.Server.Provider)
 	if err != nil {
 		return err
@@ -70,26 +143,102 @@ func NewBasicAPIServer(name string, config *Config, zipperAddr string, provider
 // invoked. These functions are invoked sequentially by YoMo. all the functions write their results to the
 // reducer-sfn.
 func (a *BasicAPIServer) Serve() error {
-	mux := http.NewServeMux()
+	// the caller API, the callers are authenticated by their bearer tokens if they are configured
+	api := http.NewServeMux()
 	// GET /overview
-	mux.HandleFunc("/overview", HandleOverview)
+	api.HandleFunc("/overview", HandleOverview)
 	// POST /invoke
-	mux.HandleFunc("/invoke", HandleInvoke)
+	api.HandleFunc("/invoke", HandleInvoke)
 	// POST /v1/chat/completions OpenAI compatible interface
-	mux.HandleFunc("/v1/chat/completions", HandleChatCompletions)
+	api.HandleFunc("/v1/chat/completions", HandleChatCompletions)
+	// POST /v1/completions the legacy text completions, translated onto the chat completions
+	api.HandleFunc("/v1/completions", HandleCompletions)
+	// POST /v1/embeddings OpenAI compatible interface
+	api.HandleFunc("/v1/embeddings", HandleEmbeddings)
+	// POST /v1/moderations OpenAI compatible interface
+	api.HandleFunc("/v1/moderations", HandleModerations)
+	// POST /v1/tokenize the tokens of a chat completion request, including the sfns added as the tools
+	api.HandleFunc("/v1/tokenize", HandleTokenize)
+	// POST /v1/responses the Responses API, translated onto the chat completions
+	api.HandleFunc("/v1/responses", HandleResponses)
+	// GET /v1/realtime the websocket of the Realtime API, see HandleRealtime
+	api.HandleFunc("/v1/realtime", HandleRealtime)
+	// /v1/threads the Assistants API threads and runs, see HandleThreads
+	api.HandleFunc("/v1/threads", HandleThreads)
+	api.HandleFunc("/v1/threads/", HandleThreads)
+	// /v1/batches the batches of the chat completions, see HandleBatches
+	api.HandleFunc("/v1/batches", HandleBatches)
+	api.HandleFunc("/v1/batches/", HandleBatches)
+	// GET /v1/models OpenAI compatible interface
+	api.HandleFunc("/v1/models", HandleModels)
+
+	// the probes and the admin API, the admin API is authenticated by the admin token
+	mux := http.NewServeMux()
+	mux.Handle("/", WithCallerAuthentication(api))
+	// GET /metrics the metrics in the Prometheus text format, it's enabled by prometheus of the tracing config
+	mux.Handle("/metrics", trace.PrometheusHandler())
+	// GET /healthz the liveness of the bridge
+	mux.HandleFunc("/healthz", HandleHealthz)
+	// GET /readyz the readiness of the bridge, it pings the llm provider and checks the connection to the zipper
+	mux.HandleFunc("/readyz", HandleReadyz)
+	// GET /providers
+	mux.HandleFunc("/providers", HandleProviders)
+	// GET /admin/cache the counters of the service cache and the cached services, see HandleAdminCache
+	mux.HandleFunc("/admin/cache", HandleAdminCache)
+	// /admin/services the admin API of the cached callers, see HandleAdminServices
+	mux.HandleFunc("/admin/services", HandleAdminServices)
+	mux.HandleFunc("/admin/services/", HandleAdminServices)
+	// GET /admin/usage the recent usage records of the chat completions, see HandleAdminUsage
+	mux.HandleFunc("/admin/usage", HandleAdminUsage)
+	// GET /admin/catalog the registered ai functions with their sfns, see HandleAdminCatalog
+	mux.HandleFunc("/admin/catalog", HandleAdminCatalog)
+	// GET /admin/audit the recent register and unregister events of the ai functions, see HandleAdminAudit
+	mux.HandleFunc("/admin/audit", HandleAdminAudit)
 
-	handler := WithContextService(mux, a.serviceCredential, a.ZipperAddr, a.Provider, DefaultExchangeMetadataFunc)
+	var (
+		handler  http.Handler = mux
+		grpcOpts []grpc.ServerOption
+	)
+	if conf := a.Config.Server.PromptAudit; conf != nil {
+		auditor, err := openPromptAuditor(*conf)
+		if err != nil {
+			return err
+		}
+		handler = auditor.handler(handler)
+		grpcOpts = auditor.grpcServerOptions(a.serviceCredential)
+	}
+	if conf := a.Config.Server.AccessLog; conf != nil {
+		h, err := NewAccessLogHandler(handler, *conf)
+		if err != nil {
+			return err
+		}
+		handler = h
+	}
+	// the access log and the prompt audit are inside of the service context, so the records carry the transID
+	handler = WithContextService(handler, a.serviceCredential, a.ZipperAddr, a.Provider, DefaultExchangeMetadataFunc)
+
+	if grpcAddr := a.Config.Server.GRPCAddr; grpcAddr != "" {
+		server := NewCachedChatCompletionsServer(a.serviceCredential, a.ZipperAddr, a.Provider, DefaultExchangeMetadataFunc)
+		go func() {
+			if err := ServeGRPC(grpcAddr, server, a.Config.Server.TLSConfig, grpcOpts...); err != nil {
+				ylog.Error("grpc server stopped", "err", err.Error())
+			}
+		}()
+	}
 
 	addr := a.Config.Server.Addr
-	ylog.Info("server is running", "addr", addr, "ai_provider", a.Name)
+	ylog.Info("server is running", "addr", addr, "ai_provider", a.Name, "tls", a.Config.Server.TLSConfig != nil)
+	if tlsConfig := a.Config.Server.TLSConfig; tlsConfig != nil {
+		srv := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig}
+		return srv.ListenAndServeTLS("", "")
+	}
 	return http.ListenAndServe(addr, handler)
 }
 
 // WithContextService adds the service to the request context
 func WithContextService(handler http.Handler, credential string, zipperAddr string, provider LLMProvider, exFn ExchangeMetadataFunc) http.Handler {
 	// create service instance when the api server starts
-	service, err := LoadOrCreateService(credential, zipperAddr, provider, exFn)
-	if err != nil {
+	if _, err := LoadOrCreateService(credential, zipperAddr, provider, exFn); err != nil {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusInternalServerError)
 			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
@@ -97,9 +246,20 @@ func WithContextService(handler http.Handler, credential string, zipperAddr stri
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the service is loaded by every request, as it may be evicted or refreshed by the service cache
+		service, err := LoadOrCreateService(credential, zipperAddr, provider, exFn)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
 		transID := id.New(32)
 		ctx := WithTransIDContext(r.Context(), transID)
 		ctx = WithServiceContext(ctx, service)
+		ctx = WithAcceptLanguageContext(ctx, r.Header.Get("Accept-Language"))
+		ctx = WithSystemPromptContext(ctx, r.Header.Get(SystemPromptOpHeader), r.Header.Get(SystemPromptHeader))
+		ctx = withResponseHeaderContext(ctx, w.Header())
+		ctx = withCacheControlContext(ctx, r.Header.Get("Cache-Control"))
 		handler.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -110,7 +270,7 @@ func HandleOverview(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	// credential := getBearerToken(r)
-	resp, err := service.GetOverview()
+	resp, err := service.GetOverview(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
@@ -128,13 +288,14 @@ func HandleInvoke(w http.ResponseWriter, r *http.Request) {
 		transID = FromTransIDContext(ctx)
 	)
 	defer r.Body.Close()
+	limitRequestBody(w, r)
 
 	var req ai.InvokeRequest
 
 	// decode the request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		ylog.Error("decode request", "err", err.Error())
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(readBodyErrorCode(err))
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
 		return
 	}
@@ -142,7 +303,7 @@ func HandleInvoke(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// Create a context with a timeout of 5 seconds
-	ctx, cancel := context.WithTimeout(context.Background(), 90*time.Second)
+	ctx, cancel := context.WithTimeout(WithAcceptLanguageContext(context.Background(), FromAcceptLanguageContext(ctx)), 90*time.Second)
 	defer cancel()
 
 	// messages
@@ -188,29 +349,123 @@ func HandleChatCompletions(w http.ResponseWriter, r *http.Request) {
 		transID = FromTransIDContext(ctx)
 	)
 	defer r.Body.Close()
+	limitRequestBody(w, r)
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ylog.Error("read request", "err", err.Error())
+		RespondWithError(w, readBodyErrorCode(err), err)
+		return
+	}
 	var req openai.ChatCompletionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.Unmarshal(body, &req); err != nil {
 		ylog.Error("decode request", "err", err.Error())
 		RespondWithError(w, http.StatusBadRequest, err)
 		return
 	}
+	if err := validateChatCompletionRequest(req); err != nil {
+		ylog.Error("validate request", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	extraBody, err := parseExtraBody(body)
+	if err != nil {
+		ylog.Error("decode request extra body", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	audioFields, audio, err := parseAudioRequest(body, &req)
+	if err != nil {
+		ylog.Error("validate request audio", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	for k, v := range audioFields {
+		if extraBody == nil {
+			extraBody = make(map[string]json.RawMessage)
+		}
+		extraBody[k] = v
+	}
+	if len(extraBody) > 0 {
+		ctx = WithExtraBodyContext(ctx, extraBody)
+	}
+	if audio {
+		ctx = withAudioContext(ctx, &audioOutput{})
+	}
+	parallelToolCalls, err := parseParallelToolCalls(body)
+	if err != nil {
+		ylog.Error("decode request parallel_tool_calls", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !parallelToolCalls {
+		ctx = withSequentialToolCalls(ctx)
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 90*time.Second)
+	// failed is true if the chat completions fail, their responses are not stored for the idempotency key
+	var failed bool
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" && IdempotencyWindow > 0 {
+		hash := requestHash(body)
+		var (
+			resp  *idempotentResponse
+			owner bool
+		)
+		// the request runs again if the request in flight with the same key fails
+		for !owner {
+			resp, owner = idempotency.begin(service.credential+"/"+key, hash, IdempotencyWindow)
+			if owner {
+				break
+			}
+			if resp.requestHash != hash {
+				RespondWithError(w, http.StatusUnprocessableEntity, errIdempotencyKeyReused)
+				return
+			}
+			ylog.Debug("replay the idempotent response", "transID", transID, "idempotencyKey", key)
+			replayed, err := resp.replay(ctx, w)
+			if err != nil {
+				ylog.Error("replay the idempotent response", "err", err.Error())
+				return
+			}
+			if replayed {
+				return
+			}
+		}
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		defer func() {
+			idempotency.finish(resp, rec.statusCode(), rec.Header().Get("Content-Type"), rec.body.Bytes(), !failed)
+		}()
+		w = rec
+		// the request runs to the end even if the client goes away, so its retry gets the response.
+		ctx = context.WithoutCancel(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
 	defer cancel()
 
-	if err := service.GetChatCompletions(ctx, req, transID, w, false); err != nil {
+	if err := service.GetChatCompletions(ctx, req, transID, w, parseIncludeCallStack(body)); err != nil {
 		ylog.Error("invoke chat completions", "err", err.Error())
-		RespondWithError(w, http.StatusBadRequest, err)
+		failed = true
+		code := http.StatusBadRequest
+		var toolErr *ToolCallError
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrQuotaExceeded) {
+			code = http.StatusTooManyRequests
+		} else if errors.Is(err, ErrCircuitOpen) {
+			code = http.StatusServiceUnavailable
+		} else if errors.As(err, &toolErr) {
+			code = http.StatusBadGateway
+		}
+		RespondWithError(w, code, err)
 		return
 	}
 }
 
 // RespondWithError writes an error to response according to the OpenAI API spec.
 func RespondWithError(w http.ResponseWriter, code int, err error) {
-	w.WriteHeader(code)
 	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(fmt.Sprintf(`{"error":{"code":"%d","message":"%s"}}`, code, err.Error())))
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]map[string]string{
+		"error": {"code": strconv.Itoa(code), "message": err.Error()},
+	})
 }
 
 func getLocalIP() (string, error) {
@@ -245,6 +500,15 @@ func FromServiceContext(ctx context.Context) *Service {
 	return service
 }
 
+// bearerToken returns the bearer token of the Authorization header of the request.
+func bearerToken(header string) string {
+	token, _ := strings.CutPrefix(header, "Bearer ")
+	if token == header {
+		return ""
+	}
+	return token
+}
+
 type transIDContextKey struct{}
 
 // WithTransIDContext adds the transID to the request context
@@ -260,3 +524,19 @@ func FromTransIDContext(ctx context.Context) string {
 	}
 	return val
 }
+
+type acceptLanguageContextKey struct{}
+
+// WithAcceptLanguageContext adds the Accept-Language header of the request to the request context
+func WithAcceptLanguageContext(ctx context.Context, acceptLanguage string) context.Context {
+	return context.WithValue(ctx, acceptLanguageContextKey{}, acceptLanguage)
+}
+
+// FromAcceptLanguageContext returns the Accept-Language header of the request from the request context
+func FromAcceptLanguageContext(ctx context.Context) string {
+	val, ok := ctx.Value(acceptLanguageContextKey{}).(string)
+	if !ok {
+		return ""
+	}
+	return val
+}
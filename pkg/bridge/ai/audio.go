@@ -0,0 +1,370 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// The audio of the chat completions, eg: gpt-4o-audio-preview, is not supported by the OpenAI client of the
+// bridge, so it's carried around the client:
+//
+//   - the input_audio parts of the messages are kept as the parts whose image_url is the data url of the audio,
+//     eg: data:audio/wav;base64,xxx, they are restored by ExtraBodyTransport in the body sent to the llm provider
+//   - the modalities and the audio parameters of the request are forwarded as the extra body
+//   - the audio of the responses is recorded by ExtraBodyTransport, and it's added back to the responses written
+//     to the client, the audio of the stream chunks is paired with the chunks in the order they are received.
+
+// ChatMessagePartTypeInputAudio is the type of the audio parts of the messages.
+const ChatMessagePartTypeInputAudio openai.ChatMessagePartType = "input_audio"
+
+// MaxInputAudioBytes is the max size of an input_audio part after it's decoded.
+const MaxInputAudioBytes = 25 << 20
+
+var (
+	inputAudioFormats  = []string{"wav", "mp3"}
+	outputAudioFormats = []string{"wav", "mp3", "flac", "opus", "pcm16"}
+)
+
+// audioRequest is the audio fields of the chat completion request which are not in openai.ChatCompletionRequest.
+type audioRequest struct {
+	Modalities []string        `json:"modalities"`
+	Audio      json.RawMessage `json:"audio"`
+	Stream     bool            `json:"stream"`
+	Messages   []struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	} `json:"messages"`
+}
+
+// audioParams is the output audio of the request.
+type audioParams struct {
+	Voice  string `json:"voice"`
+	Format string `json:"format"`
+}
+
+// audioPart is the audio part of the message content.
+type audioPart struct {
+	Type       string `json:"type"`
+	InputAudio *struct {
+		Data   string `json:"data"`
+		Format string `json:"format"`
+	} `json:"input_audio"`
+}
+
+// parseAudioRequest validates the audio of the chat completion request, the input_audio parts of the
+// request are kept as the data urls. It returns the fields forwarded as the extra body, and audio is true
+// if the request has the audio input or asks for the audio output.
+func parseAudioRequest(body []byte, req *openai.ChatCompletionRequest) (fields map[string]json.RawMessage, audio bool, err error) {
+	var raw audioRequest
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, false, err
+	}
+	for i, msg := range raw.Messages {
+		var parts []audioPart
+		if i >= len(req.Messages) || json.Unmarshal(msg.Content, &parts) != nil {
+			continue
+		}
+		for j, part := range parts {
+			if part.Type != string(ChatMessagePartTypeInputAudio) || j >= len(req.Messages[i].MultiContent) {
+				continue
+			}
+			if msg.Role != openai.ChatMessageRoleUser {
+				return nil, false, fmt.Errorf("messages[%d]: input_audio is only allowed in the user messages", i)
+			}
+			if part.InputAudio == nil {
+				return nil, false, fmt.Errorf("messages[%d].content[%d]: input_audio is required", i, j)
+			}
+			if !slices.Contains(inputAudioFormats, part.InputAudio.Format) {
+				return nil, false, fmt.Errorf("messages[%d].content[%d]: unsupported input_audio format: %q, it must be one of %s",
+					i, j, part.InputAudio.Format, strings.Join(inputAudioFormats, ", "))
+			}
+			if n := base64.StdEncoding.DecodedLen(len(part.InputAudio.Data)); n > MaxInputAudioBytes {
+				return nil, false, fmt.Errorf("messages[%d].content[%d]: input_audio exceeds %d bytes", i, j, MaxInputAudioBytes)
+			}
+			if _, err := base64.StdEncoding.DecodeString(part.InputAudio.Data); err != nil || part.InputAudio.Data == "" {
+				return nil, false, fmt.Errorf("messages[%d].content[%d]: input_audio data must be base64 encoded", i, j)
+			}
+			req.Messages[i].MultiContent[j].ImageURL = &openai.ChatMessageImageURL{
+				URL: "data:audio/" + part.InputAudio.Format + ";base64," + part.InputAudio.Data,
+			}
+			audio = true
+		}
+	}
+
+	fields = make(map[string]json.RawMessage)
+	if len(raw.Modalities) > 0 {
+		for _, m := range raw.Modalities {
+			if m != "text" && m != "audio" {
+				return nil, false, fmt.Errorf("unsupported modality: %q", m)
+			}
+		}
+		fields["modalities"], _ = json.Marshal(raw.Modalities)
+	}
+	if slices.Contains(raw.Modalities, "audio") {
+		var params audioParams
+		if len(raw.Audio) == 0 || json.Unmarshal(raw.Audio, &params) != nil || params.Voice == "" {
+			return nil, false, errors.New("audio.voice is required if the audio modality is requested")
+		}
+		if !slices.Contains(outputAudioFormats, params.Format) {
+			return nil, false, fmt.Errorf("unsupported audio format: %q, it must be one of %s", params.Format, strings.Join(outputAudioFormats, ", "))
+		}
+		if raw.Stream && params.Format != "pcm16" {
+			return nil, false, errors.New("the streamed audio must be in pcm16 format")
+		}
+		fields["audio"] = raw.Audio
+		audio = true
+	}
+	return fields, audio, nil
+}
+
+// restoreInputAudio restores the input_audio parts of the messages of the request body sent to the llm provider.
+func restoreInputAudio(body []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	var messages []map[string]json.RawMessage
+	if err := json.Unmarshal(fields["messages"], &messages); err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		var parts []map[string]json.RawMessage
+		if json.Unmarshal(msg["content"], &parts) != nil {
+			continue
+		}
+		for _, part := range parts {
+			var typ string
+			var image openai.ChatMessageImageURL
+			if json.Unmarshal(part["type"], &typ) != nil || typ != string(ChatMessagePartTypeInputAudio) ||
+				json.Unmarshal(part["image_url"], &image) != nil {
+				continue
+			}
+			format, data, ok := strings.Cut(strings.TrimPrefix(image.URL, "data:audio/"), ";base64,")
+			if !ok {
+				continue
+			}
+			delete(part, "image_url")
+			part["input_audio"], _ = json.Marshal(map[string]string{"data": data, "format": format})
+		}
+		msg["content"], _ = json.Marshal(parts)
+	}
+	fields["messages"], _ = json.Marshal(messages)
+	return json.Marshal(fields)
+}
+
+type audioContextKey struct{}
+
+// withAudioContext adds the audio output of the request to the request context.
+func withAudioContext(ctx context.Context, audio *audioOutput) context.Context {
+	return context.WithValue(ctx, audioContextKey{}, audio)
+}
+
+// fromAudioContext returns the audio output of the request, it's nil if the request has no audio.
+func fromAudioContext(ctx context.Context) *audioOutput {
+	audio, _ := ctx.Value(audioContextKey{}).(*audioOutput)
+	return audio
+}
+
+// audioOutput records the audio of the responses of the llm provider, the audio is keyed by the index of
+// the choice. It's nil-safe, the responses are written as they are if it's nil.
+type audioOutput struct {
+	mu      sync.Mutex
+	message map[int]json.RawMessage   // the audio of the last response which is not streamed
+	chunks  []map[int]json.RawMessage // the audio of the stream chunks which are not received yet
+	current map[int]json.RawMessage   // the audio of the stream chunk received last
+}
+
+// record records the audio of the response, the stream is recorded as it's read by the client.
+func (a *audioOutput) record(resp *http.Response) (*http.Response, error) {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, nil
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		resp.Body = &audioStreamReader{ReadCloser: resp.Body, audio: a}
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	a.mu.Lock()
+	a.message = choiceAudio(body, "message")
+	a.mu.Unlock()
+	return resp, nil
+}
+
+// choiceAudio returns the audio of the choices, the field is message or delta.
+func choiceAudio(data []byte, field string) map[int]json.RawMessage {
+	var resp struct {
+		Choices []map[string]json.RawMessage `json:"choices"`
+	}
+	if json.Unmarshal(data, &resp) != nil {
+		return nil
+	}
+	var audio map[int]json.RawMessage
+	for i, choice := range resp.Choices {
+		var msg struct {
+			Audio json.RawMessage `json:"audio"`
+		}
+		if json.Unmarshal(choice[field], &msg) != nil || len(msg.Audio) == 0 || string(msg.Audio) == "null" {
+			continue
+		}
+		index := i
+		_ = json.Unmarshal(choice["index"], &index)
+		if audio == nil {
+			audio = make(map[int]json.RawMessage)
+		}
+		audio[index] = msg.Audio
+	}
+	return audio
+}
+
+// next moves the audio of the next stream chunk to the current, it's called when a chunk is received.
+func (a *audioOutput) next() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.current = nil
+	if len(a.chunks) > 0 {
+		a.current, a.chunks = a.chunks[0], a.chunks[1:]
+	}
+}
+
+// recver returns the recver which pairs the chunks with their audio.
+func (a *audioOutput) recver(r ResponseRecver) ResponseRecver {
+	if a == nil {
+		return r
+	}
+	return &audioRecver{ResponseRecver: r, audio: a}
+}
+
+// marshalChunk encodes the stream chunk received last with its audio.
+func (a *audioOutput) marshalChunk(chunk openai.ChatCompletionStreamResponse) ([]byte, error) {
+	data, err := json.Marshal(chunk)
+	if err != nil || a == nil {
+		return data, err
+	}
+	a.mu.Lock()
+	audio := a.current
+	a.mu.Unlock()
+	return withChoiceAudio(data, "delta", audio)
+}
+
+// marshalResponse encodes the response, which is the last response of the llm provider, with its audio.
+func (a *audioOutput) marshalResponse(resp any) ([]byte, error) {
+	data, err := json.Marshal(resp)
+	if err != nil || a == nil {
+		return data, err
+	}
+	a.mu.Lock()
+	audio := a.message
+	a.mu.Unlock()
+	return withChoiceAudio(data, "message", audio)
+}
+
+// withChoiceAudio adds the audio to the message or the delta of the choices of the response.
+func withChoiceAudio(data []byte, field string, audio map[int]json.RawMessage) ([]byte, error) {
+	if len(audio) == 0 {
+		return data, nil
+	}
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	var choices []map[string]json.RawMessage
+	if err := json.Unmarshal(resp["choices"], &choices); err != nil {
+		return nil, err
+	}
+	for _, choice := range choices {
+		var index int
+		_ = json.Unmarshal(choice["index"], &index)
+		a, ok := audio[index]
+		if !ok {
+			continue
+		}
+		var msg map[string]json.RawMessage
+		if err := json.Unmarshal(choice[field], &msg); err != nil || msg == nil {
+			msg = make(map[string]json.RawMessage)
+		}
+		msg["audio"] = a
+		choice[field], _ = json.Marshal(msg)
+	}
+	resp["choices"], _ = json.Marshal(choices)
+	return json.Marshal(resp)
+}
+
+// audioRecver moves the audio of every chunk it receives to the current audio of the output.
+type audioRecver struct {
+	ResponseRecver
+	audio *audioOutput
+}
+
+// Recv implements ResponseRecver.
+func (r *audioRecver) Recv() (openai.ChatCompletionStreamResponse, error) {
+	chunk, err := r.ResponseRecver.Recv()
+	if err == nil {
+		r.audio.next()
+	}
+	return chunk, err
+}
+
+// audioStreamReader records the audio of the stream chunks as the stream is read, a chunk is recorded for
+// every `data: ` line as the OpenAI client returns a chunk for it, so they are paired in order.
+type audioStreamReader struct {
+	io.ReadCloser
+	audio *audioOutput
+	line  []byte
+}
+
+var (
+	audioDataPrefix  = []byte("data: ")
+	audioErrorPrefix = []byte(`data: {"error":`)
+)
+
+// Read implements io.Reader.
+func (r *audioStreamReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.line = append(r.line, p[:n]...)
+	for {
+		i := bytes.IndexByte(r.line, '\n')
+		if i < 0 {
+			break
+		}
+		r.recordLine(r.line[:i])
+		r.line = r.line[i+1:]
+	}
+	if err != nil && len(r.line) > 0 {
+		r.recordLine(r.line)
+		r.line = nil
+	}
+	return n, err
+}
+
+func (r *audioStreamReader) recordLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, audioDataPrefix) || bytes.HasPrefix(line, audioErrorPrefix) {
+		return
+	}
+	data := bytes.TrimPrefix(line, audioDataPrefix)
+	if string(data) == "[DONE]" {
+		return
+	}
+	r.audio.mu.Lock()
+	r.audio.chunks = append(r.audio.chunks, choiceAudio(data, "delta"))
+	r.audio.mu.Unlock()
+}
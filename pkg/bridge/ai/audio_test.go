@@ -0,0 +1,200 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func TestParseAudioRequest(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedFields map[string]string
+		expectedAudio  bool
+		expectedErr    string
+	}{
+		{
+			name:           "text only",
+			body:           `{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}`,
+			expectedFields: map[string]string{},
+		},
+		{
+			name:           "input audio",
+			body:           `{"model":"gpt-4o-audio-preview","modalities":["text"],"messages":[{"role":"user","content":[{"type":"text","text":"what is it?"},{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}}]}]}`,
+			expectedFields: map[string]string{"modalities": `["text"]`},
+			expectedAudio:  true,
+		},
+		{
+			name:           "output audio",
+			body:           `{"model":"gpt-4o-audio-preview","modalities":["text","audio"],"audio":{"voice":"alloy","format":"wav"},"messages":[{"role":"user","content":"hello"}]}`,
+			expectedFields: map[string]string{"modalities": `["text","audio"]`, "audio": `{"voice":"alloy","format":"wav"}`},
+			expectedAudio:  true,
+		},
+		{
+			name:        "unsupported input format",
+			body:        `{"messages":[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"ogg"}}]}]}`,
+			expectedErr: `messages[0].content[0]: unsupported input_audio format: "ogg", it must be one of wav, mp3`,
+		},
+		{
+			name:        "invalid data",
+			body:        `{"messages":[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"not base64!","format":"wav"}}]}]}`,
+			expectedErr: "messages[0].content[0]: input_audio data must be base64 encoded",
+		},
+		{
+			name:        "assistant audio",
+			body:        `{"messages":[{"role":"assistant","content":[{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}}]}]}`,
+			expectedErr: "messages[0]: input_audio is only allowed in the user messages",
+		},
+		{
+			name:        "unsupported modality",
+			body:        `{"modalities":["video"],"messages":[{"role":"user","content":"hello"}]}`,
+			expectedErr: `unsupported modality: "video"`,
+		},
+		{
+			name:        "no voice",
+			body:        `{"modalities":["text","audio"],"messages":[{"role":"user","content":"hello"}]}`,
+			expectedErr: "audio.voice is required if the audio modality is requested",
+		},
+		{
+			name:        "streamed wav",
+			body:        `{"stream":true,"modalities":["text","audio"],"audio":{"voice":"alloy","format":"wav"},"messages":[{"role":"user","content":"hello"}]}`,
+			expectedErr: "the streamed audio must be in pcm16 format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req openai.ChatCompletionRequest
+			assert.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+
+			fields, audio, err := parseAudioRequest([]byte(tt.body), &req)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedAudio, audio)
+			assert.Len(t, fields, len(tt.expectedFields))
+			for k, v := range tt.expectedFields {
+				assert.JSONEq(t, v, string(fields[k]))
+			}
+		})
+	}
+
+	t.Run("the input audio is kept as the data url", func(t *testing.T) {
+		body := `{"messages":[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"input_audio","input_audio":{"data":"SUQz","format":"mp3"}}]}]}`
+		var req openai.ChatCompletionRequest
+		assert.NoError(t, json.Unmarshal([]byte(body), &req))
+		_, _, err := parseAudioRequest([]byte(body), &req)
+		assert.NoError(t, err)
+		assert.Equal(t, &openai.ChatMessageImageURL{URL: "data:audio/mp3;base64,SUQz"}, req.Messages[0].MultiContent[1].ImageURL)
+
+		data, err := json.Marshal(req)
+		assert.NoError(t, err)
+		restored, err := restoreInputAudio(data)
+		assert.NoError(t, err)
+		assert.Contains(t, string(restored), `{"input_audio":{"data":"SUQz","format":"mp3"},"type":"input_audio"}`)
+		assert.NotContains(t, string(restored), "data:audio")
+	})
+}
+
+// clientProvider is the llm provider built on the OpenAI client, like the providers of the bridge.
+type clientProvider struct {
+	MockLLMProvider
+	client *openai.Client
+}
+
+func (p *clientProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	return p.client.CreateChatCompletion(ctx, req)
+}
+
+func (p *clientProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (ResponseRecver, error) {
+	return p.client.CreateChatCompletionStream(ctx, req)
+}
+
+func TestChatCompletionsAudio(t *testing.T) {
+	var received map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = nil
+		_ = json.Unmarshal(body, &received)
+		if strings.Contains(string(received["stream"]), "true") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"role":"assistant"}}]}`+"\n\n")
+			_, _ = io.WriteString(w, `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"audio":{"id":"audio_1","transcript":"hi"}}}]}`+"\n\n")
+			_, _ = io.WriteString(w, `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{"audio":{"data":"AAAA"}}}]}`+"\n\n")
+			_, _ = io.WriteString(w, `data: {"id":"chatcmpl-1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`+"\n\n")
+			_, _ = io.WriteString(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"chatcmpl-1","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":null,"audio":{"id":"audio_1","data":"UklGRg==","transcript":"hi","expires_at":1}}}]}`)
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("token")
+	config.BaseURL = server.URL
+	config.HTTPClient = NewExtraBodyHTTPClient()
+	provider := &clientProvider{MockLLMProvider: MockLLMProvider{name: "audio"}, client: openai.NewClientWithConfig(config)}
+
+	do := func(body string) *httptest.ResponseRecorder {
+		service := &Service{LLMProvider: provider, Metadata: metadata.M{}, credential: "token"}
+		service.SetSystemPrompt("")
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		HandleChatCompletions(w, r.WithContext(WithServiceContext(r.Context(), service)))
+		return w
+	}
+
+	t.Run("not streamed", func(t *testing.T) {
+		w := do(`{"model":"gpt-4o-audio-preview","modalities":["text","audio"],"audio":{"voice":"alloy","format":"wav"},
+			"messages":[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}}]}]}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		assert.JSONEq(t, `["text","audio"]`, string(received["modalities"]))
+		assert.JSONEq(t, `{"voice":"alloy","format":"wav"}`, string(received["audio"]))
+		assert.JSONEq(t, `[{"role":"user","content":[{"type":"input_audio","input_audio":{"data":"UklGRg==","format":"wav"}}]}]`, string(received["messages"]))
+
+		var resp struct {
+			Choices []struct {
+				Message struct {
+					Audio json.RawMessage `json:"audio"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.JSONEq(t, `{"id":"audio_1","data":"UklGRg==","transcript":"hi","expires_at":1}`, string(resp.Choices[0].Message.Audio))
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		w := do(`{"model":"gpt-4o-audio-preview","stream":true,"modalities":["text","audio"],"audio":{"voice":"alloy","format":"pcm16"},
+			"messages":[{"role":"user","content":"hello"}]}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var audio []string
+		for _, line := range strings.Split(w.Body.String(), "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok || data == "[DONE]" {
+				continue
+			}
+			var chunk struct {
+				Choices []struct {
+					Delta struct {
+						Audio json.RawMessage `json:"audio"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			assert.NoError(t, json.Unmarshal([]byte(data), &chunk))
+			audio = append(audio, string(chunk.Choices[0].Delta.Audio))
+		}
+		assert.Equal(t, []string{"", `{"id":"audio_1","transcript":"hi"}`, `{"data":"AAAA"}`, ""}, audio)
+	})
+}
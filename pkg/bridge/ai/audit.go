@@ -0,0 +1,206 @@
+package ai
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+const (
+	// AuditActionRegister is the action of registering an ai function
+	AuditActionRegister = "register"
+	// AuditActionUnregister is the action of unregistering an ai function
+	AuditActionUnregister = "unregister"
+)
+
+// AuditEvent is the audit record of the ai function inventory changes.
+type AuditEvent struct {
+	// Action is register or unregister
+	Action string `json:"action"`
+	// Time is the time when the action happens
+	Time time.Time `json:"time"`
+	// ConnID is the id of the sfn connection
+	ConnID uint64 `json:"conn_id"`
+	// ClientID is the client id of the sfn
+	ClientID string `json:"client_id"`
+	// SfnName is the name of the sfn
+	SfnName string `json:"sfn_name"`
+	// RemoteAddr is the address the sfn connects from
+	RemoteAddr string `json:"remote_addr"`
+	// Tag is the tag observed by the sfn
+	Tag uint32 `json:"tag"`
+	// FunctionName is the name of the ai function
+	FunctionName string `json:"function_name"`
+	// Version is the version of the ai function
+	Version string `json:"version,omitempty"`
+	// SchemaHash is the sha256 of the parameters schema of the ai function
+	SchemaHash string `json:"schema_hash"`
+}
+
+// Audit is the configuration of the audit of the ai function inventory changes.
+// The configuration looks like:
+//
+//	audit:
+//		size: 1000
+//		webhook: https://example.com/yomo/audit
+type Audit struct {
+	// Size is the number of the recent events kept for GET /admin/audit, the default is 1000.
+	Size int `yaml:"size"`
+	// Webhook is the url the events are POSTed to, it is optional.
+	Webhook string `yaml:"webhook"`
+}
+
+// Auditor keeps the recent audit events, and delivers them to the webhook in order.
+type Auditor struct {
+	mu     sync.Mutex
+	size   int
+	events []AuditEvent
+	queue  chan AuditEvent
+	client *http.Client
+}
+
+// auditWebhookBuffer is the number of the events waiting for the webhook, the events are dropped if it is full.
+const auditWebhookBuffer = 1024
+
+var (
+	muAuditor      sync.Mutex
+	defaultAuditor = NewAuditor(Audit{})
+)
+
+// SetAuditor sets the default auditor
+func SetAuditor(a *Auditor) {
+	muAuditor.Lock()
+	defer muAuditor.Unlock()
+	defaultAuditor = a
+}
+
+// GetAuditor gets the default auditor
+func GetAuditor() *Auditor {
+	muAuditor.Lock()
+	defer muAuditor.Unlock()
+	return defaultAuditor
+}
+
+// NewAuditor returns the auditor by the config.
+func NewAuditor(conf Audit) *Auditor {
+	a := &Auditor{size: conf.Size}
+	if a.size <= 0 {
+		a.size = 1000
+	}
+	if conf.Webhook != "" {
+		a.queue = make(chan AuditEvent, auditWebhookBuffer)
+		a.client = &http.Client{Timeout: 5 * time.Second}
+		go a.deliver(conf.Webhook)
+	}
+	return a
+}
+
+// Record records the event, the oldest event is dropped if there are more than size events.
+func (a *Auditor) Record(e AuditEvent) {
+	ylog.Info(
+		"audit ai function",
+		"action", e.Action,
+		"conn_id", e.ConnID,
+		"client_id", e.ClientID,
+		"sfn_name", e.SfnName,
+		"remote_addr", e.RemoteAddr,
+		"tag", e.Tag,
+		"function_name", e.FunctionName,
+		"version", e.Version,
+		"schema_hash", e.SchemaHash,
+	)
+
+	a.mu.Lock()
+	a.events = append(a.events, e)
+	if len(a.events) > a.size {
+		a.events = a.events[len(a.events)-a.size:]
+	}
+	a.mu.Unlock()
+
+	if a.queue == nil {
+		return
+	}
+	select {
+	case a.queue <- e:
+	default:
+		ylog.Warn("audit webhook is congested, drop the event", "action", e.Action, "function_name", e.FunctionName)
+	}
+}
+
+// Events returns the recent events, the oldest is the first.
+func (a *Auditor) Events() []AuditEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	events := make([]AuditEvent, len(a.events))
+	copy(events, a.events)
+	return events
+}
+
+func (a *Auditor) deliver(webhook string) {
+	for e := range a.queue {
+		body, err := json.Marshal(e)
+		if err != nil {
+			ylog.Error("marshal audit event", "err", err.Error())
+			continue
+		}
+		resp, err := a.client.Post(webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			ylog.Error("post audit event", "webhook", webhook, "err", err.Error())
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			ylog.Error("post audit event", "webhook", webhook, "status", resp.StatusCode)
+		}
+	}
+}
+
+// newAuditEvent returns the audit event of the ai function served by the connection.
+func newAuditEvent(action string, conn *core.Connection, tag uint32, fd *ai.FunctionDefinition, version string) AuditEvent {
+	e := AuditEvent{
+		Action:       action,
+		Time:         time.Now(),
+		ConnID:       conn.ID(),
+		ClientID:     conn.ClientID(),
+		SfnName:      conn.Name(),
+		Tag:          tag,
+		FunctionName: fd.Name,
+		Version:      version,
+		SchemaHash:   schemaHash(fd.Parameters),
+	}
+	if addr := conn.FrameConn().RemoteAddr(); addr != nil {
+		e.RemoteAddr = addr.String()
+	}
+	return e
+}
+
+// schemaHash returns the sha256 of the parameters schema, it tells whether the schema is changed.
+func schemaHash(parameters any) string {
+	b, _ := json.Marshal(parameters)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// HandleAdminAudit is the handler for GET /admin/audit, it returns the recent register and unregister events of the
+// ai functions. It's authenticated by the admin token, as the events carry the sfns and their remote addresses.
+func HandleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	if code, err := authorizeAdmin(r); err != nil {
+		RespondWithError(w, code, err)
+		return
+	}
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	respondJSON(w, map[string][]AuditEvent{"events": GetAuditor().Events()})
+}
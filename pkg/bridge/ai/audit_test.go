@@ -0,0 +1,85 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/ai"
+)
+
+func TestAuditor(t *testing.T) {
+	received := make(chan AuditEvent, 3)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e AuditEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&e))
+		received <- e
+	}))
+	defer webhook.Close()
+
+	auditor := NewAuditor(Audit{Size: 2, Webhook: webhook.URL})
+	for _, name := range []string{"fn1", "fn2", "fn3"} {
+		auditor.Record(AuditEvent{Action: AuditActionRegister, FunctionName: name})
+	}
+
+	events := auditor.Events()
+	if assert.Len(t, events, 2, "the oldest event is dropped") {
+		assert.Equal(t, "fn2", events[0].FunctionName)
+		assert.Equal(t, "fn3", events[1].FunctionName)
+	}
+
+	for _, name := range []string{"fn1", "fn2", "fn3"} {
+		select {
+		case e := <-received:
+			assert.Equal(t, name, e.FunctionName, "the events are delivered in order")
+		case <-time.After(time.Second):
+			t.Fatal("the event is not delivered to the webhook")
+		}
+	}
+}
+
+func TestHandleAdminAudit(t *testing.T) {
+	t.Cleanup(func() { AdminToken = "" })
+	AdminToken = "admin"
+	auditor := NewAuditor(Audit{})
+	auditor.Record(AuditEvent{
+		Action:       AuditActionUnregister,
+		ConnID:       1,
+		SfnName:      "sfn-weather",
+		Tag:          0x10,
+		FunctionName: "get-weather",
+		SchemaHash:   schemaHash(&ai.FunctionParameters{Type: "object"}),
+	})
+	defer SetAuditor(GetAuditor())
+	SetAuditor(auditor)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rr := httptest.NewRecorder()
+	HandleAdminAudit(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp map[string][]AuditEvent
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, auditor.Events()[0].FunctionName, resp["events"][0].FunctionName)
+	assert.Equal(t, AuditActionUnregister, resp["events"][0].Action)
+	assert.Len(t, resp["events"][0].SchemaHash, 64)
+
+	t.Run("anonymous", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		HandleAdminAudit(rr, httptest.NewRequest(http.MethodGet, "/admin/audit", nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestSchemaHash(t *testing.T) {
+	p1 := &ai.FunctionParameters{Type: "object", Properties: map[string]*ai.ParameterProperty{"city": {Type: "string"}}}
+	p2 := &ai.FunctionParameters{Type: "object", Properties: map[string]*ai.ParameterProperty{"city": {Type: "string"}}}
+	p3 := &ai.FunctionParameters{Type: "object", Properties: map[string]*ai.ParameterProperty{"city": {Type: "integer"}}}
+
+	assert.Equal(t, schemaHash(p1), schemaHash(p2))
+	assert.NotEqual(t, schemaHash(p1), schemaHash(p3))
+}
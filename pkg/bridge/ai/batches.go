@@ -0,0 +1,357 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/id"
+)
+
+const (
+	// batchConcurrency is the number of the requests of a batch run at the same time.
+	batchConcurrency = 4
+	// batchRetention is how long the finished batches are kept for retrieving their results.
+	batchRetention = 24 * time.Hour
+	// batchEndpoint is the only endpoint the batches run.
+	batchEndpoint = "/v1/chat/completions"
+)
+
+// batchInput is a line of the JSONL input of a batch, it's the format of the OpenAI Batch API.
+type batchInput struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchOutput is a line of the JSONL output of a batch.
+type batchOutput struct {
+	ID       string               `json:"id"`
+	CustomID string               `json:"custom_id"`
+	Response *batchOutputResponse `json:"response"`
+	Error    *batchOutputError    `json:"error"`
+}
+
+type batchOutputResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchOutputError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Batch is the batch of the chat completion requests, it's run in the background.
+type Batch struct {
+	ID            string             `json:"id"`
+	Object        string             `json:"object"`
+	Endpoint      string             `json:"endpoint"`
+	Status        string             `json:"status"`
+	CreatedAt     int64              `json:"created_at"`
+	InProgressAt  *int64             `json:"in_progress_at"`
+	CompletedAt   *int64             `json:"completed_at"`
+	CancelledAt   *int64             `json:"cancelled_at"`
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+}
+
+// BatchRequestCounts is the progress of a batch.
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// batchJob is the batch with its inputs and outputs, the outputs are in the order of the inputs.
+type batchJob struct {
+	mu      sync.Mutex
+	batch   Batch
+	owner   string
+	inputs  []batchInput
+	outputs []*batchOutput
+	cancel  context.CancelFunc
+}
+
+var batches sync.Map // batch id -> *batchJob
+
+var errBatchNotFound = errors.New("batch does not exist")
+
+// HandleBatches is the handler of the batches of the chat completions, the requests are run through the
+// chat completions in the background, so the sfn tool pipelines can be evaluated offline. The routes are:
+//
+//	POST /v1/batches                  the body is the JSONL input, eg: {"custom_id":"1","method":"POST","url":"/v1/chat/completions","body":{...}}
+//	GET  /v1/batches/{batch_id}        the status of the batch
+//	GET  /v1/batches/{batch_id}/output the JSONL output of the finished requests
+//	POST /v1/batches/{batch_id}/cancel cancels the requests not finished
+//
+// The batches are kept in memory for 24 hours after they are finished.
+func HandleBatches(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	limitRequestBody(w, r)
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/batches"), "/")
+	var segments []string
+	if path != "" {
+		segments = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodPost:
+		createBatch(w, r)
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		getBatch(w, r, segments[0])
+	case len(segments) == 2 && segments[1] == "output" && r.Method == http.MethodGet:
+		getBatchOutput(w, r, segments[0])
+	case len(segments) == 2 && segments[1] == "cancel" && r.Method == http.MethodPost:
+		cancelBatch(w, r, segments[0])
+	case len(segments) <= 2:
+		RespondWithError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	default:
+		RespondWithError(w, http.StatusNotFound, fmt.Errorf("%s is not found", r.URL.Path))
+	}
+}
+
+func createBatch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ylog.Error("read request", "err", err.Error())
+		RespondWithError(w, readBodyErrorCode(err), err)
+		return
+	}
+	inputs, err := parseBatchInputs(body)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var (
+		ctx     = r.Context()
+		service = FromServiceContext(ctx)
+		transID = FromTransIDContext(ctx)
+	)
+	// the batch outlives the request.
+	batchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	now := time.Now().Unix()
+	job := &batchJob{
+		batch: Batch{
+			ID:            "batch_" + id.New(24),
+			Object:        "batch",
+			Endpoint:      batchEndpoint,
+			Status:        "in_progress",
+			CreatedAt:     now,
+			InProgressAt:  &now,
+			RequestCounts: BatchRequestCounts{Total: len(inputs)},
+		},
+		owner:   credentialHash(service.credential),
+		inputs:  inputs,
+		outputs: make([]*batchOutput, len(inputs)),
+		cancel:  cancel,
+	}
+	batches.Store(job.batch.ID, job)
+
+	go job.run(batchCtx, service, transID)
+
+	respondJSON(w, job.status())
+}
+
+// parseBatchInputs parses the JSONL input, the custom ids must be unique and the url must be /v1/chat/completions.
+func parseBatchInputs(body []byte) ([]batchInput, error) {
+	var (
+		inputs    []batchInput
+		customIDs = make(map[string]bool)
+		scanner   = bufio.NewScanner(bytes.NewReader(body))
+		line      = 0
+	)
+	scanner.Buffer(nil, len(body)+1)
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var input batchInput
+		if err := json.Unmarshal(text, &input); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if input.CustomID == "" || customIDs[input.CustomID] {
+			return nil, fmt.Errorf("line %d: custom_id must be unique and not empty", line)
+		}
+		if input.URL != batchEndpoint {
+			return nil, fmt.Errorf("line %d: url must be %s", line, batchEndpoint)
+		}
+		customIDs[input.CustomID] = true
+		inputs = append(inputs, input)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(inputs) == 0 {
+		return nil, errors.New("the batch has no request")
+	}
+	return inputs, nil
+}
+
+// run runs the requests of the batch, batchConcurrency of them at the same time.
+func (job *batchJob) run(ctx context.Context, service *Service, transID string) {
+	defer job.cancel()
+
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, batchConcurrency)
+	)
+loop:
+	for i, input := range job.inputs {
+		select {
+		case <-ctx.Done():
+			break loop
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(i int, input batchInput) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			job.finish(i, runBatchInput(ctx, service, input, transID))
+		}(i, input)
+	}
+	wg.Wait()
+
+	job.mu.Lock()
+	now := time.Now().Unix()
+	if job.batch.Status == "cancelling" {
+		job.batch.Status, job.batch.CancelledAt = "cancelled", &now
+	} else {
+		job.batch.Status, job.batch.CompletedAt = "completed", &now
+	}
+	job.mu.Unlock()
+
+	time.AfterFunc(batchRetention, func() { batches.Delete(job.batch.ID) })
+}
+
+func (job *batchJob) finish(i int, output *batchOutput) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	job.outputs[i] = output
+	if output.Error != nil {
+		job.batch.RequestCounts.Failed++
+	} else {
+		job.batch.RequestCounts.Completed++
+	}
+}
+
+func (job *batchJob) status() Batch {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	return job.batch
+}
+
+// runBatchInput runs the request through the chat completions, the request is not streamed.
+func runBatchInput(ctx context.Context, service *Service, input batchInput, transID string) *batchOutput {
+	output := &batchOutput{ID: "batch_req_" + id.New(24), CustomID: input.CustomID}
+
+	var req openai.ChatCompletionRequest
+	err := json.Unmarshal(input.Body, &req)
+	if err == nil {
+		err = validateChatCompletionRequest(req)
+	}
+	if err != nil {
+		output.Error = &batchOutputError{Code: "invalid_request", Message: err.Error()}
+		return output
+	}
+	req.Stream = false
+
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+
+	rec := &responsesRecorder{header: make(http.Header)}
+	if err := service.GetChatCompletions(ctx, req, transID, rec, parseIncludeCallStack(input.Body)); err != nil {
+		code := "server_error"
+		if errors.Is(err, ErrRateLimited) {
+			code = "rate_limit_exceeded"
+		} else if errors.Is(err, ErrQuotaExceeded) {
+			code = "insufficient_quota"
+		}
+		output.Error = &batchOutputError{Code: code, Message: err.Error()}
+		return output
+	}
+	output.Response = &batchOutputResponse{
+		StatusCode: http.StatusOK,
+		RequestID:  output.ID,
+		Body:       bytes.TrimSpace(rec.body.Bytes()),
+	}
+	return output
+}
+
+func ownBatch(ctx context.Context, batchID string) (*batchJob, error) {
+	v, ok := batches.Load(batchID)
+	if !ok {
+		return nil, errBatchNotFound
+	}
+	job := v.(*batchJob)
+	if job.owner != credentialHash(FromServiceContext(ctx).credential) {
+		return nil, errBatchNotFound
+	}
+	return job, nil
+}
+
+func getBatch(w http.ResponseWriter, r *http.Request, batchID string) {
+	job, err := ownBatch(r.Context(), batchID)
+	if err != nil {
+		RespondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	respondJSON(w, job.status())
+}
+
+// getBatchOutput writes the outputs of the finished requests in the order of the inputs.
+func getBatchOutput(w http.ResponseWriter, r *http.Request, batchID string) {
+	job, err := ownBatch(r.Context(), batchID)
+	if err != nil {
+		RespondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	job.mu.Lock()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, output := range job.outputs {
+		if output != nil {
+			_ = enc.Encode(output)
+		}
+	}
+	job.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func cancelBatch(w http.ResponseWriter, r *http.Request, batchID string) {
+	job, err := ownBatch(r.Context(), batchID)
+	if err != nil {
+		RespondWithError(w, http.StatusNotFound, err)
+		return
+	}
+	job.mu.Lock()
+	if job.batch.Status == "in_progress" {
+		job.batch.Status = "cancelling"
+		job.cancel()
+	}
+	job.mu.Unlock()
+
+	respondJSON(w, job.status())
+}
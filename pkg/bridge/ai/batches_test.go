@@ -0,0 +1,108 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func TestParseBatchInputs(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expectedErr string
+	}{
+		{
+			name: "ok",
+			body: `{"custom_id":"1","method":"POST","url":"/v1/chat/completions","body":{}}` + "\n\n" +
+				`{"custom_id":"2","method":"POST","url":"/v1/chat/completions","body":{}}`,
+		},
+		{
+			name:        "empty",
+			body:        "\n",
+			expectedErr: "the batch has no request",
+		},
+		{
+			name: "duplicate custom id",
+			body: `{"custom_id":"1","method":"POST","url":"/v1/chat/completions","body":{}}` + "\n" +
+				`{"custom_id":"1","method":"POST","url":"/v1/chat/completions","body":{}}`,
+			expectedErr: "line 2: custom_id must be unique and not empty",
+		},
+		{
+			name:        "embeddings",
+			body:        `{"custom_id":"1","method":"POST","url":"/v1/embeddings","body":{}}`,
+			expectedErr: "line 1: url must be /v1/chat/completions",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseBatchInputs([]byte(tt.body))
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
+func TestHandleBatches(t *testing.T) {
+	service := &Service{LLMProvider: &completionsProvider{}, Metadata: metadata.M{}, credential: "token"}
+	service.SetSystemPrompt("")
+	other := &Service{LLMProvider: &completionsProvider{}, Metadata: metadata.M{}, credential: "other"}
+
+	do := func(service *Service, method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r = r.WithContext(WithServiceContext(r.Context(), service))
+		HandleBatches(w, r)
+		return w
+	}
+
+	w := do(service, http.MethodPost, "/v1/batches",
+		`{"custom_id":"ok","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[{"role":"user","content":"hello"}]}}`+"\n"+
+			`{"custom_id":"bad","method":"POST","url":"/v1/chat/completions","body":{"messages":"hello"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var batch Batch
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.True(t, strings.HasPrefix(batch.ID, "batch_"))
+	assert.Equal(t, 2, batch.RequestCounts.Total)
+
+	assert.Eventually(t, func() bool {
+		w := do(service, http.MethodGet, "/v1/batches/"+batch.ID, "")
+		_ = json.Unmarshal(w.Body.Bytes(), &batch)
+		return batch.Status == "completed"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, BatchRequestCounts{Total: 2, Completed: 1, Failed: 1}, batch.RequestCounts)
+
+	w = do(service, http.MethodGet, "/v1/batches/"+batch.ID+"/output", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/jsonl", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var outputs [2]batchOutput
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &outputs[0]))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &outputs[1]))
+	assert.Equal(t, "ok", outputs[0].CustomID)
+	assert.Equal(t, http.StatusOK, outputs[0].Response.StatusCode)
+	assert.Contains(t, string(outputs[0].Response.Body), `"content":" world"`)
+	assert.Nil(t, outputs[0].Error)
+	assert.Equal(t, "bad", outputs[1].CustomID)
+	assert.Nil(t, outputs[1].Response)
+	assert.Equal(t, "invalid_request", outputs[1].Error.Code)
+
+	w = do(other, http.MethodGet, "/v1/batches/"+batch.ID, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(service, http.MethodPost, "/v1/batches/"+batch.ID+"/cancel", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+	assert.Equal(t, "completed", batch.Status)
+}
@@ -0,0 +1,330 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+type sfnAsyncCall struct {
+	wg  sync.WaitGroup
+	mu  sync.RWMutex
+	val map[string]ai.ToolMessage
+	// calls are the attempts in flight, the key is the tool call id, it is guarded by mu
+	calls map[string]*toolCallAttempt
+	// onProgress is called with the progress chunks of the tool calls, it is guarded by mu
+	onProgress func(ai.ToolProgress)
+	// md is the request metadata of the tool calls, the llm-sfns are resolved and the data are routed by its scopes
+	md metadata.M
+}
+
+// toolCallAttempt collects the results of an attempt of the tool call, every sfn observing
+// the tag of the function writes a result.
+type toolCallAttempt struct {
+	attempt int
+	pending int
+	result  *ai.FunctionCall
+	done    chan struct{}
+}
+
+// begin starts the attempt of the tool call, the attempt is done after the pending results are delivered.
+func (c *sfnAsyncCall) begin(toolCallID string, attempt int, pending int) *toolCallAttempt {
+	a := &toolCallAttempt{
+		attempt: attempt,
+		pending: pending,
+		done:    make(chan struct{}),
+	}
+	c.mu.Lock()
+	c.calls[toolCallID] = a
+	c.mu.Unlock()
+	return a
+}
+
+// deliver delivers the result to the attempt in flight, it returns false if the result is dropped.
+// c.mu must be held.
+func (c *sfnAsyncCall) deliver(invoke *ai.FunctionCall) bool {
+	a, ok := c.calls[invoke.ToolCallID]
+	if !ok || a.pending == 0 {
+		return false
+	}
+	// the sfns which don't return the attempt are regarded as replying the current attempt
+	if invoke.Attempt != 0 && invoke.Attempt != a.attempt {
+		return false
+	}
+	// the ok result of an instance is kept if the other instances fail
+	if a.result == nil || !a.result.IsOK || invoke.IsOK {
+		a.result = invoke
+	}
+	a.pending--
+	if a.pending == 0 {
+		close(a.done)
+	}
+	return true
+}
+
+// await waits for the attempt to be done, timed out or canceled by ctx, zero timeout means no timeout.
+// It returns the last delivered result, or nil if no result is delivered before the timeout, and the
+// error of ctx if the attempt is canceled.
+func (c *sfnAsyncCall) await(ctx context.Context, toolCallID string, a *toolCallAttempt, timeout time.Duration) (*ai.FunctionCall, error) {
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	select {
+	case <-a.done:
+	case <-timeoutC:
+	case <-ctx.Done():
+		c.cancel(toolCallID, a)
+		return nil, ctx.Err()
+	}
+	return c.cancel(toolCallID, a), nil
+}
+
+// inFlight reports whether the tool call has an attempt in flight, c.mu must be held.
+func (c *sfnAsyncCall) inFlight(toolCallID string) bool {
+	_, ok := c.calls[toolCallID]
+	return ok
+}
+
+// cancel removes the attempt, the results delivered later are dropped. It returns the last delivered result.
+func (c *sfnAsyncCall) cancel(toolCallID string, a *toolCallAttempt) *ai.FunctionCall {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls[toolCallID] == a {
+		delete(c.calls, toolCallID)
+	}
+	return a.result
+}
+
+// finish sets the tool message of the tool call by its final result.
+func (c *sfnAsyncCall) finish(invoke *ai.FunctionCall) ai.ToolMessage {
+	content := invoke.Result
+	if invoke.ToolResult != nil {
+		var err error
+		if content, err = invoke.ToolResult.ToolMessageContent(); err != nil {
+			ylog.Error("[sfn-reducer] build tool message", "err", err.Error())
+			content = err.Error()
+		}
+	}
+
+	msg := ai.ToolMessage{
+		Role:       "tool",
+		Content:    content,
+		ToolCallId: invoke.ToolCallID,
+	}
+	if !invoke.IsOK && invoke.Error != "" {
+		code := invoke.ErrorCode
+		if code == "" {
+			code = ai.ErrorCodeInternal
+		}
+		msg = toolErrorMessage(invoke.ToolCallID, code, invoke.Error)
+	}
+	c.mu.Lock()
+	c.val[invoke.ToolCallID] = msg
+	ylog.Debug("[sfn-reducer] generate", "ToolMessage", fmt.Sprintf("%+v", c.val))
+	c.mu.Unlock()
+	return msg
+}
+
+// ToolCallFuture is the pending result of a tool call started by Service.CallAsync, it is resolved
+// when the tool call is done, failed, timed out or canceled.
+type ToolCallFuture struct {
+	// ToolCallID is the id of the tool call.
+	ToolCallID string
+	// FunctionName is the name of the called function.
+	FunctionName string
+
+	done   chan struct{}
+	msg    ai.ToolMessage
+	err    error
+	cancel context.CancelFunc
+}
+
+func newToolCallFuture(ctx context.Context, fn *openai.ToolCall) (*ToolCallFuture, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &ToolCallFuture{
+		ToolCallID:   fn.ID,
+		FunctionName: fn.Function.Name,
+		done:         make(chan struct{}),
+		cancel:       cancel,
+	}, ctx
+}
+
+// Done returns a channel that is closed when the tool call is resolved.
+func (f *ToolCallFuture) Done() <-chan struct{} { return f.done }
+
+// Result waits for the tool call to be resolved and returns the tool message. The failed, timed out and
+// canceled tool calls are resolved with the error messages for the llm, the error is returned only if
+// the function can not be called, eg: no sfn serves the function.
+func (f *ToolCallFuture) Result() (ai.ToolMessage, error) {
+	<-f.done
+	return f.msg, f.err
+}
+
+// Cancel cancels the tool call, the result delivered later is dropped. It does nothing if the tool call
+// has been resolved.
+func (f *ToolCallFuture) Cancel() { f.cancel() }
+
+func (f *ToolCallFuture) resolve(msg ai.ToolMessage, err error) {
+	f.msg, f.err = msg, err
+	f.cancel()
+	close(f.done)
+}
+
+// firedAttempt is the first attempt of a tool call fired by the pipelined write of Service.CallAsync,
+// err is the error of the write.
+type firedAttempt struct {
+	attempt *toolCallAttempt
+	err     error
+}
+
+// callLlmSfn calls the llm-sfn by the call policy of the function, the attempt is timed out by the
+// timeout of the policy, and the failed calling is retried after the backoff if the error code is retryable.
+// The tool call is canceled when ctx is done, and the future is resolved by the final result, the error
+// of the last attempt is the tool message for the llm.
+// The first attempt is not fired again if it has been fired, see firedAttempt.
+func (s *Service) callLlmSfn(ctx context.Context, tag uint32, fn *openai.ToolCall, base *ai.FunctionCall, c *sfnAsyncCall, future *ToolCallFuture, fired *firedAttempt) {
+	defer c.wg.Done()
+
+	start := time.Now()
+	policy := s.callPolicy(tag, fn.Function.Name, c.md)
+	for attempt := 1; ; attempt++ {
+		result := s.attemptLlmSfn(ctx, tag, fn, base, c, attempt, policy, fired)
+		if result == nil {
+			ylog.Error("no llm-sfn to call", "tag", tag, "function", fn.Function.Name)
+			s.metrics.recordToolCall(fn.Function.Name, start, "error")
+			future.resolve(ai.ToolMessage{}, fmt.Errorf("no llm-sfn to call function %s", fn.Function.Name))
+			return
+		}
+		if !result.IsOK && result.ErrorCode != ai.ErrorCodeCanceled && policy.Retryable(attempt, result.ErrorCode) {
+			ylog.Warn("retry function calling", "function", fn.Function.Name, "attempt", attempt, "error", result.Error, "errorCode", result.ErrorCode)
+			err := sleepContext(ctx, policy.Delay(attempt))
+			if err == nil {
+				continue
+			}
+			result = canceledResult(fn, err)
+		}
+
+		// the future is resolved last, so the call is done when its result is returned
+		status := toolCallStatus(result)
+		msg := c.finish(result)
+		s.metrics.recordToolCall(fn.Function.Name, start, status)
+		logSlowCall(
+			"slow tool call", time.Since(start), s.credential,
+			"function", fn.Function.Name,
+			"tag", tag,
+			"args_hash", argsHash(fn.Function.Arguments),
+			"attempts", attempt,
+			"status", status,
+			"transID", base.TransID,
+			"reqID", base.ReqID,
+			"toolCallID", fn.ID,
+		)
+		future.resolve(msg, nil)
+		return
+	}
+}
+
+// attemptLlmSfn fires the attempt of the tool call and awaits its result, the failures of the attempt are
+// returned as the results with the error codes. It returns nil if there is no llm-sfn to call.
+func (s *Service) attemptLlmSfn(ctx context.Context, tag uint32, fn *openai.ToolCall, base *ai.FunctionCall, c *sfnAsyncCall, attempt int, policy ai.CallPolicy, fired *firedAttempt) *ai.FunctionCall {
+	a, err := s.fireAttempt(tag, fn, base, c, attempt, policy, fired)
+	if a == nil {
+		return nil
+	}
+	if err != nil {
+		ylog.Error("send data to zipper", "err", err.Error())
+		c.cancel(fn.ID, a)
+		return &ai.FunctionCall{
+			ToolCallID:   fn.ID,
+			FunctionName: fn.Function.Name,
+			Error:        fmt.Sprintf("function %s is unavailable: %v", fn.Function.Name, err),
+			ErrorCode:    ai.ErrorCodeUnavailable,
+		}
+	}
+	result, err := c.await(ctx, fn.ID, a, policy.Timeout)
+	if err != nil {
+		return canceledResult(fn, err)
+	}
+	if result == nil {
+		return &ai.FunctionCall{
+			ToolCallID:   fn.ID,
+			FunctionName: fn.Function.Name,
+			Error:        fmt.Sprintf("function %s timed out after %s", fn.Function.Name, policy.Timeout),
+			ErrorCode:    ai.ErrorCodeTimeout,
+		}
+	}
+	return result
+}
+
+func canceledResult(fn *openai.ToolCall, err error) *ai.FunctionCall {
+	return &ai.FunctionCall{
+		ToolCallID:   fn.ID,
+		FunctionName: fn.Function.Name,
+		Error:        fmt.Sprintf("function %s is canceled: %v", fn.Function.Name, err),
+		ErrorCode:    ai.ErrorCodeCanceled,
+	}
+}
+
+// fireAttempt begins and fires the attempt of the tool call, it returns nil attempt if there is no llm-sfn to call.
+// The retries of the policy with Alternate are fired to all the llm-sfns instead of the nearest one.
+func (s *Service) fireAttempt(tag uint32, fn *openai.ToolCall, base *ai.FunctionCall, c *sfnAsyncCall, attempt int, policy ai.CallPolicy, fired *firedAttempt) (*toolCallAttempt, error) {
+	if attempt == 1 && fired != nil {
+		return fired.attempt, fired.err
+	}
+	if attempt > 1 && policy.Alternate && NearestInstance {
+		factor := register.SfnFactor(tag, c.md)
+		if factor == 0 {
+			return nil, nil
+		}
+		a := c.begin(fn.ID, attempt, factor)
+		return a, s.source.WriteBatch([]yomo.TaggedData{{
+			Tag:          tag,
+			Data:         s.llmSfnData(tag, fn, base, attempt),
+			AllInstances: true,
+			CallerScopes: callerScopes(c.md),
+		}})
+	}
+	factor := s.sfnFactor(tag, c.md)
+	if factor == 0 {
+		return nil, nil
+	}
+	a := c.begin(fn.ID, attempt, factor)
+	return a, s.fireLlmSfn(tag, fn, base, attempt, c.md)
+}
+
+// sleepContext waits for the duration, it returns the error of ctx if ctx is done before.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// toolCallStatus returns the status of the tool call result for the metrics.
+func toolCallStatus(result *ai.FunctionCall) string {
+	if result.IsOK {
+		return "ok"
+	}
+	if result.ErrorCode != "" {
+		return result.ErrorCode
+	}
+	return "error"
+}
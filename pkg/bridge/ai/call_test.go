@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+func newTestAsyncCall() *sfnAsyncCall {
+	return &sfnAsyncCall{
+		val:   make(map[string]ai.ToolMessage),
+		calls: make(map[string]*toolCallAttempt),
+	}
+}
+
+func deliver(c *sfnAsyncCall, invoke *ai.FunctionCall) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deliver(invoke)
+}
+
+func TestSfnAsyncCall(t *testing.T) {
+	t.Run("done", func(t *testing.T) {
+		c := newTestAsyncCall()
+		a := c.begin("call-1", 1, 2)
+
+		assert.True(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 1, IsOK: true, Result: "a"}))
+		assert.True(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", IsOK: true, Result: "b"}))
+		assert.False(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 1, IsOK: true, Result: "c"}))
+
+		result, err := c.await(context.Background(), "call-1", a, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, "b", result.Result)
+
+		c.finish(result)
+		assert.Equal(t, "b", c.val["call-1"].Content)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		c := newTestAsyncCall()
+		a := c.begin("call-1", 1, 1)
+
+		result, err := c.await(context.Background(), "call-1", a, 10*time.Millisecond)
+		assert.NoError(t, err)
+		assert.Nil(t, result)
+		assert.False(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 1, IsOK: true}), "the result of the timed out attempt is dropped")
+	})
+
+	t.Run("stale attempt", func(t *testing.T) {
+		c := newTestAsyncCall()
+		c.begin("call-1", 2, 1)
+
+		assert.False(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 1, IsOK: true}))
+		assert.True(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 2, IsOK: true}))
+	})
+
+	t.Run("error", func(t *testing.T) {
+		c := newTestAsyncCall()
+		c.finish(&ai.FunctionCall{ToolCallID: "call-1", Result: "partial", Error: "city not found"})
+		assert.Equal(t, `{"error":{"code":"internal","message":"city not found"}}`, c.val["call-1"].Content)
+		assert.Equal(t, &ai.ToolError{Code: ai.ErrorCodeInternal, Message: "city not found"}, c.val["call-1"].Error)
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		c := newTestAsyncCall()
+		a := c.begin("call-1", 1, 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		result, err := c.await(ctx, "call-1", a, 0)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, result)
+		assert.False(t, c.inFlight("call-1"))
+		assert.False(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 1, IsOK: true}), "the result of the canceled attempt is dropped")
+	})
+}
+
+func TestToolCallFuture(t *testing.T) {
+	fn := &openai.ToolCall{ID: "call-1", Function: openai.FunctionCall{Name: "get-weather"}}
+	future, ctx := newToolCallFuture(context.Background(), fn)
+	assert.Equal(t, "call-1", future.ToolCallID)
+	assert.Equal(t, "get-weather", future.FunctionName)
+
+	select {
+	case <-future.Done():
+		t.Fatal("the future is resolved before the result")
+	default:
+	}
+
+	future.Cancel()
+	<-ctx.Done()
+
+	future.resolve(ai.ToolMessage{Role: "tool", ToolCallId: "call-1", Content: "function get-weather is canceled"}, nil)
+	<-future.Done()
+	msg, err := future.Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "function get-weather is canceled", msg.Content)
+}
+
+type batchRecorderSource struct {
+	yomo.Source
+	mu      sync.Mutex
+	batches [][]yomo.TaggedData
+	writes  int
+}
+
+func (s *batchRecorderSource) Write(tag uint32, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes++
+	return nil
+}
+
+func (s *batchRecorderSource) WriteBatch(batch []yomo.TaggedData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func TestCallAsyncPipelined(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0x61, &openai.FunctionDefinition{Name: "get-weather"}, 1001, md))
+	assert.NoError(t, register.RegisterFunction(0x62, &openai.FunctionDefinition{Name: "get-time"}, 1002, md))
+	defer register.UnregisterFunction(1001, md)
+	defer register.UnregisterFunction(1002, md)
+
+	source := &batchRecorderSource{}
+	s := &Service{
+		Metadata:     md,
+		source:       source,
+		sfnCallCache: make(map[string]*sfnAsyncCall),
+		metrics:      newLLMMetrics(),
+	}
+
+	fns := map[uint32][]*openai.ToolCall{
+		0x61: {{ID: "call-1", Function: openai.FunctionCall{Name: "get-weather"}}},
+		0x62: {{ID: "call-2", Function: openai.FunctionCall{Name: "get-time"}}},
+	}
+	futures := s.CallAsync(context.Background(), fns, &ai.FunctionCall{ReqID: "req-1"}, nil)
+	assert.Len(t, futures, 2)
+
+	// the first attempts are written in one batch.
+	assert.Len(t, source.batches, 1)
+	assert.Len(t, source.batches[0], 2)
+	assert.Equal(t, 0, source.writes)
+
+	// the results are correlated by the tool call ids.
+	s.muCallCache.Lock()
+	c := s.sfnCallCache["req-1"]
+	s.muCallCache.Unlock()
+	assert.True(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-2", Attempt: 1, IsOK: true, Result: "12:00"}))
+	assert.True(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 1, IsOK: true, Result: "sunny"}))
+
+	results := map[string]string{}
+	for _, future := range futures {
+		msg, err := future.Result()
+		assert.NoError(t, err)
+		results[msg.ToolCallId] = msg.Content
+	}
+	assert.Equal(t, map[string]string{"call-1": "sunny", "call-2": "12:00"}, results)
+}
+
+func TestCallAsyncFastToolCall(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0x63, &openai.FunctionDefinition{Name: "fast"}, 1003, md))
+	assert.NoError(t, register.RegisterFunction(0x64, &openai.FunctionDefinition{Name: "slow"}, 1004, md))
+	defer register.UnregisterFunction(1003, md)
+	defer register.UnregisterFunction(1004, md)
+
+	s := &Service{
+		Metadata:     md,
+		source:       &batchRecorderSource{},
+		sfnCallCache: make(map[string]*sfnAsyncCall),
+		metrics:      newLLMMetrics(),
+	}
+	fns := map[uint32][]*openai.ToolCall{
+		0x63: {{ID: "call-1", Function: openai.FunctionCall{Name: "fast"}}},
+		0x64: {{ID: "call-2", Function: openai.FunctionCall{Name: "slow"}}},
+	}
+	futures := s.CallAsync(context.Background(), fns, &ai.FunctionCall{ReqID: "req-fast"}, nil)
+
+	s.muCallCache.Lock()
+	c := s.sfnCallCache["req-fast"]
+	s.muCallCache.Unlock()
+	assert.True(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 1, IsOK: true, Result: "fast"}))
+
+	// the result of the fast tool call is returned while the slow one is pending.
+	for _, future := range futures {
+		if future.ToolCallID != "call-1" {
+			defer future.Cancel()
+			continue
+		}
+		result := make(chan string, 1)
+		go func() {
+			msg, _ := future.Result()
+			result <- msg.Content
+		}()
+		select {
+		case content := <-result:
+			assert.Equal(t, "fast", content)
+		case <-time.After(time.Second):
+			t.Fatal("the fast tool call waits for the slow one")
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package ai
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// Caller is a caller of the server authenticated by its token, the requests carry the token as the bearer
+// token over HTTP and gRPC. The token budgets are of the callers, see TokenQuota. The caller sees and invokes
+// the functions whose scopes overlap its scopes, see ai.ScopeKey, and its requests are queued by its priority
+// when the llm provider is rate limited, see RateLimit. The configuration looks like:
+//
+//	callers:
+//	  - name: team-a
+//	    token: <TOKEN>
+//	    scopes: [tenant-a]
+//	    priority: 10
+//
+// The requests are not authenticated if there is no caller, and they share the budgets of the server.
+type Caller struct {
+	Name     string   `yaml:"name"`     // Name identifies the caller in the budgets and the rate limit queue
+	Token    string   `yaml:"token"`    // Token is the bearer token of the caller
+	Scopes   []string `yaml:"scopes"`   // Scopes are the scopes of the caller, "*" overlaps all the scopes
+	Priority int      `yaml:"priority"` // Priority is the priority of the caller in the rate limit queue, default is 0
+}
+
+var (
+	// callers are the configured callers, the requests are not authenticated if it is nil.
+	callers atomic.Pointer[[]Caller]
+
+	errCallerToken = errors.New("invalid bearer token of the caller")
+)
+
+// ConfigureCallers authenticates the requests by the tokens of the callers, the names and the tokens of the
+// callers must be unique.
+func ConfigureCallers(list []Caller) error {
+	if len(list) == 0 {
+		callers.Store(nil)
+		return nil
+	}
+	names := make(map[string]bool, len(list))
+	tokens := make(map[string]bool, len(list))
+	for _, caller := range list {
+		if caller.Name == "" || caller.Token == "" {
+			return fmt.Errorf("callers: the name and the token of the caller are required")
+		}
+		if names[caller.Name] {
+			return fmt.Errorf("callers: duplicate caller %s", caller.Name)
+		}
+		if tokens[caller.Token] {
+			return fmt.Errorf("callers: the token of the caller %s is duplicate", caller.Name)
+		}
+		names[caller.Name], tokens[caller.Token] = true, true
+	}
+	list = append([]Caller(nil), list...)
+	callers.Store(&list)
+	return nil
+}
+
+// authenticateCaller returns the caller of the token, it fails by errCallerToken if the token is not of any
+// caller. The caller is nil if the callers are not configured.
+func authenticateCaller(token string) (*Caller, error) {
+	list := callers.Load()
+	if list == nil {
+		return nil, nil
+	}
+	if token != "" {
+		for i, caller := range *list {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(caller.Token)) == 1 {
+				return &(*list)[i], nil
+			}
+		}
+	}
+	return nil, errCallerToken
+}
+
+// WithCallerAuthentication authenticates the callers of the handler by their bearer tokens, the requests
+// of the unknown tokens are rejected with 401. The caller is added to the request context.
+func WithCallerAuthentication(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, err := authenticateCaller(bearerToken(r.Header.Get("Authorization")))
+		if err != nil {
+			RespondWithError(w, http.StatusUnauthorized, err)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(withCallerContext(r.Context(), caller)))
+	})
+}
+
+type callerContextKey struct{}
+
+// withCallerContext adds the authenticated caller to the context.
+func withCallerContext(ctx context.Context, caller *Caller) context.Context {
+	if caller == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, callerContextKey{}, caller)
+}
+
+// fromCallerContext returns the authenticated caller, it's nil if the callers are not configured.
+func fromCallerContext(ctx context.Context) *Caller {
+	caller, _ := ctx.Value(callerContextKey{}).(*Caller)
+	return caller
+}
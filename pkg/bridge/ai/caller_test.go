@@ -0,0 +1,122 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+func TestConfigureCallers(t *testing.T) {
+	t.Cleanup(func() { ConfigureCallers(nil) })
+
+	tests := []struct {
+		name        string
+		callers     []Caller
+		expectedErr string
+	}{
+		{name: "valid", callers: []Caller{{Name: "team-a", Token: "token-a"}, {Name: "team-b", Token: "token-b"}}},
+		{name: "no token", callers: []Caller{{Name: "team-a"}}, expectedErr: "callers: the name and the token of the caller are required"},
+		{name: "duplicate name", callers: []Caller{{Name: "team-a", Token: "token-a"}, {Name: "team-a", Token: "token-b"}}, expectedErr: "callers: duplicate caller team-a"},
+		{name: "duplicate token", callers: []Caller{{Name: "team-a", Token: "token-a"}, {Name: "team-b", Token: "token-a"}}, expectedErr: "callers: the token of the caller team-b is duplicate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ConfigureCallers(tt.callers)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWithCallerAuthentication(t *testing.T) {
+	t.Cleanup(func() { ConfigureCallers(nil) })
+
+	var caller *Caller
+	handler := WithCallerAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller = fromCallerContext(r.Context())
+	}))
+	serve := func(token string) int {
+		caller = nil
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// the requests are not authenticated without the callers.
+	assert.Equal(t, http.StatusOK, serve("any"))
+	assert.Nil(t, caller)
+
+	assert.NoError(t, ConfigureCallers([]Caller{{Name: "team-a", Token: "token-a"}}))
+	assert.Equal(t, http.StatusOK, serve("token-a"))
+	assert.Equal(t, "team-a", caller.Name)
+
+	assert.Equal(t, http.StatusUnauthorized, serve("token-random"))
+	assert.Equal(t, http.StatusUnauthorized, serve(""))
+	assert.Nil(t, caller)
+}
+
+func TestCallerScopes(t *testing.T) {
+	assert.NoError(t, register.RegisterFunction(0x75, &openai.FunctionDefinition{Name: "tenant-a-fn"}, 2005, metadata.M{ai.ScopeKey: "tenant-a"}))
+	assert.NoError(t, register.RegisterFunction(0x76, &openai.FunctionDefinition{Name: "tenant-b-fn"}, 2006, metadata.M{ai.ScopeKey: "tenant-b"}))
+	defer register.UnregisterFunction(2005, nil)
+	defer register.UnregisterFunction(2006, nil)
+
+	source := &batchRecorderSource{}
+	s := &Service{
+		Metadata:     metadata.M{},
+		source:       source,
+		sfnCallCache: make(map[string]*sfnAsyncCall),
+		metrics:      newLLMMetrics(),
+	}
+	ctx := withCallerContext(context.Background(), &Caller{Name: "team-a", Token: "token-a", Scopes: []string{"tenant-a"}})
+
+	// the caller only sees the functions of its scopes
+	tcs, err := register.ListToolCalls(s.requestMetadata(ctx))
+	assert.NoError(t, err)
+	assert.Contains(t, tcs, uint32(0x75))
+	assert.NotContains(t, tcs, uint32(0x76))
+
+	// the functions of the other scopes are not invoked, and the invocations are routed by the caller scopes
+	fns := map[uint32][]*openai.ToolCall{
+		0x75: {{ID: "call-1", Function: openai.FunctionCall{Name: "tenant-a-fn"}}},
+		0x76: {{ID: "call-2", Function: openai.FunctionCall{Name: "tenant-b-fn"}}},
+	}
+	futures := s.CallAsync(ctx, fns, &ai.FunctionCall{ReqID: "req-scopes"}, nil)
+
+	s.muCallCache.Lock()
+	c := s.sfnCallCache["req-scopes"]
+	s.muCallCache.Unlock()
+	assert.True(t, deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 1, IsOK: true, Result: "ok"}))
+
+	for _, future := range futures {
+		msg, err := future.Result()
+		switch future.ToolCallID {
+		case "call-1":
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", msg.Content)
+		case "call-2":
+			assert.EqualError(t, err, "no llm-sfn to call function tenant-b-fn")
+		}
+	}
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	assert.Len(t, source.batches, 1)
+	assert.Len(t, source.batches[0], 1)
+	assert.Equal(t, uint32(0x75), source.batches[0][0].Tag)
+	assert.Equal(t, []string{"tenant-a"}, source.batches[0][0].CallerScopes)
+}
@@ -0,0 +1,147 @@
+package ai
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core"
+)
+
+// CatalogFunction is an ai function in the tool catalog, it is registered by the sfn connection.
+// The catalog can be diffed against the expected tool surface, so the schema hash and the sfn are included.
+type CatalogFunction struct {
+	// Name is the name of the ai function
+	Name string `json:"name"`
+	// Version is the version of the ai function
+	Version string `json:"version,omitempty"`
+	// Aliases are the other names of the ai function
+	Aliases []string `json:"aliases,omitempty"`
+	// Scopes are the scopes of the sfn, the function is visible to the credentials of the same scopes
+	Scopes []string `json:"scopes,omitempty"`
+	// Tag is the tag observed by the sfn
+	Tag uint32 `json:"tag"`
+	// SchemaHash is the sha256 of the parameters schema of the ai function
+	SchemaHash string `json:"schema_hash"`
+	// Definition is the definition of the ai function
+	Definition *ai.FunctionDefinition `json:"definition"`
+	// Descriptions are the localized descriptions of the ai function
+	Descriptions map[string]string `json:"descriptions,omitempty"`
+	// Policy is the call policy of the ai function
+	Policy *ai.CallPolicy `json:"policy,omitempty"`
+	// Sfn is the sfn which registers the ai function
+	Sfn CatalogSfn `json:"sfn"`
+}
+
+// CatalogSfn is the sfn connection of an ai function in the tool catalog.
+type CatalogSfn struct {
+	// Name is the name of the sfn
+	Name string `json:"name"`
+	// ClientID is the client id of the sfn
+	ClientID string `json:"client_id"`
+	// ConnID is the id of the sfn connection
+	ConnID uint64 `json:"conn_id"`
+	// RemoteAddr is the address the sfn connects from
+	RemoteAddr string `json:"remote_addr"`
+	// RegisteredAt is the time when the function is registered
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+type catalogKey struct {
+	connID uint64
+	tag    uint32
+}
+
+// toolCatalog is the registered ai functions with their sfns.
+type toolCatalog struct {
+	mu        sync.Mutex
+	functions map[catalogKey]CatalogFunction
+}
+
+var catalog = &toolCatalog{functions: make(map[catalogKey]CatalogFunction)}
+
+// add adds the ai function registered by the connection.
+func (c *toolCatalog) add(conn *core.Connection, tag uint32, fd *ai.FunctionDefinition, fv *ai.FunctionRegistration) {
+	fn := CatalogFunction{
+		Name:         fd.Name,
+		Version:      fv.Version,
+		Aliases:      fv.Aliases,
+		Tag:          tag,
+		SchemaHash:   schemaHash(fd.Parameters),
+		Definition:   fd,
+		Descriptions: fv.Descriptions,
+		Policy:       fv.Policy,
+		Sfn: CatalogSfn{
+			Name:         conn.Name(),
+			ClientID:     conn.ClientID(),
+			ConnID:       conn.ID(),
+			RegisteredAt: time.Now(),
+		},
+	}
+	if scopes, ok := conn.Metadata().Get(ai.ScopeKey); ok && scopes != "" {
+		fn.Scopes = strings.Split(scopes, ",")
+	}
+	if addr := conn.FrameConn().RemoteAddr(); addr != nil {
+		fn.Sfn.RemoteAddr = addr.String()
+	}
+
+	c.mu.Lock()
+	c.functions[catalogKey{connID: conn.ID(), tag: tag}] = fn
+	c.mu.Unlock()
+}
+
+// remove removes the ai functions registered by the connection.
+func (c *toolCatalog) remove(connID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.functions {
+		if key.connID == connID {
+			delete(c.functions, key)
+		}
+	}
+}
+
+// snapshot returns the ai functions ordered by the name, the version and the connection id,
+// so the snapshots taken at different times can be diffed.
+func (c *toolCatalog) snapshot() []CatalogFunction {
+	c.mu.Lock()
+	functions := make([]CatalogFunction, 0, len(c.functions))
+	for _, fn := range c.functions {
+		functions = append(functions, fn)
+	}
+	c.mu.Unlock()
+
+	slices.SortFunc(functions, func(a, b CatalogFunction) int {
+		if c := cmp.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Version, b.Version); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Sfn.ConnID, b.Sfn.ConnID); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Tag, b.Tag)
+	})
+	return functions
+}
+
+// HandleAdminCatalog is the handler for GET /admin/catalog, it returns all the registered ai functions with their
+// sfns. It's authenticated by the admin token, as the functions of all the scopes are returned.
+func HandleAdminCatalog(w http.ResponseWriter, r *http.Request) {
+	if code, err := authorizeAdmin(r); err != nil {
+		RespondWithError(w, code, err)
+		return
+	}
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	respondJSON(w, map[string][]CatalogFunction{"functions": catalog.snapshot()})
+}
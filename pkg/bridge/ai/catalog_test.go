@@ -0,0 +1,60 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/ai"
+)
+
+func TestHandleAdminCatalog(t *testing.T) {
+	t.Cleanup(func() { AdminToken = "" })
+	AdminToken = "admin"
+	defer func(functions map[catalogKey]CatalogFunction) { catalog.functions = functions }(catalog.functions)
+	catalog.functions = map[catalogKey]CatalogFunction{
+		{connID: 2, tag: 0x10}: {Name: "get-weather", Version: "v2", Tag: 0x10, Sfn: CatalogSfn{ConnID: 2}},
+		{connID: 1, tag: 0x10}: {Name: "get-weather", Version: "v1", Tag: 0x10, Sfn: CatalogSfn{ConnID: 1}},
+		{connID: 3, tag: 0x11}: {
+			Name:       "get-time",
+			Tag:        0x11,
+			Definition: &ai.FunctionDefinition{Name: "get-time"},
+			Sfn:        CatalogSfn{Name: "sfn-time", ConnID: 3},
+		},
+	}
+
+	get := func() []CatalogFunction {
+		req := httptest.NewRequest(http.MethodGet, "/admin/catalog", nil)
+		req.Header.Set("Authorization", "Bearer admin")
+		rr := httptest.NewRecorder()
+		HandleAdminCatalog(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp map[string][]CatalogFunction
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return resp["functions"]
+	}
+
+	functions := get()
+	if assert.Len(t, functions, 3) {
+		assert.Equal(t, "get-time", functions[0].Name)
+		assert.Equal(t, "sfn-time", functions[0].Sfn.Name)
+		assert.Equal(t, "get-time", functions[0].Definition.Name)
+		assert.Equal(t, "v1", functions[1].Version)
+		assert.Equal(t, "v2", functions[2].Version)
+	}
+
+	catalog.remove(1)
+	functions = get()
+	if assert.Len(t, functions, 2) {
+		assert.Equal(t, "v2", functions[1].Version)
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		HandleAdminCatalog(rr, httptest.NewRequest(http.MethodGet, "/admin/catalog", nil))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
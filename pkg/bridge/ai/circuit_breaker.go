@@ -0,0 +1,209 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// CircuitBreaker is the circuit breaker of the llm providers, the calls of the provider fail fast, or fail over,
+// for the cooldown after the provider fails in a row.
+type CircuitBreaker struct {
+	Failures int           `yaml:"failures"` // Failures is the number of the consecutive failures opening the circuit of the provider
+	Cooldown time.Duration `yaml:"cooldown"` // Cooldown is the time the circuit is open, a trial call is sent to the provider after it, default is 30s
+}
+
+// DefaultCircuitCooldown is the default time the circuit of the provider is open.
+const DefaultCircuitCooldown = 30 * time.Second
+
+// The states of the circuit of the provider.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen is returned when the circuit of the llm provider is open.
+var ErrCircuitOpen = errors.New("the circuit of the llm provider is open")
+
+// circuitBreaker is the circuit breaker config, it is disabled if it is nil.
+var circuitBreaker atomic.Pointer[CircuitBreaker]
+
+// circuits are the circuits of the llm providers, the key is the name of the provider.
+var circuits sync.Map
+
+// ConfigureCircuitBreaker breaks the circuits of the llm providers by the config.
+func ConfigureCircuitBreaker(conf CircuitBreaker) {
+	circuits.Range(func(name, _ any) bool {
+		circuits.Delete(name)
+		return true
+	})
+	if conf.Failures <= 0 {
+		circuitBreaker.Store(nil)
+		return
+	}
+	if conf.Cooldown <= 0 {
+		conf.Cooldown = DefaultCircuitCooldown
+	}
+	circuitBreaker.Store(&conf)
+}
+
+// circuit is the circuit of a provider. It opens after the consecutive failures, and it's half open after the
+// cooldown, when only one trial call is sent to the provider. The circuit closes if the trial call succeeds,
+// or opens again if it fails.
+type circuit struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func getCircuit(name string) *circuit {
+	c, _ := circuits.LoadOrStore(name, &circuit{})
+	return c.(*circuit)
+}
+
+// state returns the state of the circuit.
+func (c *circuit) state(now time.Time) string {
+	switch {
+	case c.openUntil.IsZero():
+		return CircuitClosed
+	case now.Before(c.openUntil):
+		return CircuitOpen
+	}
+	return CircuitHalfOpen
+}
+
+// allow reports whether the call can be sent to the provider.
+func (c *circuit) allow() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state(time.Now()) {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if c.trial {
+			return false
+		}
+		c.trial = true
+	}
+	return true
+}
+
+// done records the result of the call, it returns true if the circuit is opened by the call.
+func (c *circuit) done(failed bool, conf *CircuitBreaker) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trial = false
+	if !failed {
+		c.failures, c.openUntil = 0, time.Time{}
+		return false
+	}
+	c.failures++
+	if c.failures < conf.Failures && c.openUntil.IsZero() {
+		return false
+	}
+	c.openUntil = time.Now().Add(conf.Cooldown)
+	return true
+}
+
+// GetProviderCircuit returns the state of the circuit of the llm provider, ok is false if the circuit
+// breaker is disabled.
+func GetProviderCircuit(name string) (state string, ok bool) {
+	if circuitBreaker.Load() == nil {
+		return "", false
+	}
+	c := getCircuit(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state(time.Now()), true
+}
+
+// circuitBreakerProvider fails the calls fast by ErrCircuitOpen while the circuit of the provider is open.
+type circuitBreakerProvider struct {
+	LLMProvider
+}
+
+// withCircuitBreaker wraps the provider by the circuit breaker if it is enabled.
+func withCircuitBreaker(provider LLMProvider) LLMProvider {
+	if circuitBreaker.Load() == nil {
+		return provider
+	}
+	return &circuitBreakerProvider{LLMProvider: provider}
+}
+
+// GetChatCompletions implements LLMProvider.
+func (p *circuitBreakerProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	return callWithCircuitBreaker(ctx, modelProviderName(p.Name(), req.Model), func() (openai.ChatCompletionResponse, error) {
+		return p.LLMProvider.GetChatCompletions(ctx, req, md)
+	})
+}
+
+// GetChatCompletionsStream implements LLMProvider.
+func (p *circuitBreakerProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	return callWithCircuitBreaker(ctx, modelProviderName(p.Name(), req.Model), func() (ResponseRecver, error) {
+		return p.LLMProvider.GetChatCompletionsStream(ctx, req, md)
+	})
+}
+
+// GetEmbeddings implements LLMProvider.
+func (p *circuitBreakerProvider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, md metadata.M) (openai.EmbeddingResponse, error) {
+	return callWithCircuitBreaker(ctx, modelProviderName(p.Name(), string(req.Model)), func() (openai.EmbeddingResponse, error) {
+		return p.LLMProvider.GetEmbeddings(ctx, req, md)
+	})
+}
+
+// callWithCircuitBreaker calls the provider if its circuit allows, and records the result of the call
+// in the circuit. The errors of the requests, eg: 4xx, are not the failures of the provider.
+func callWithCircuitBreaker[T any](ctx context.Context, name string, call func() (T, error)) (T, error) {
+	conf := circuitBreaker.Load()
+	if conf == nil {
+		return call()
+	}
+	c := getCircuit(name)
+	if !c.allow() {
+		var zero T
+		return zero, fmt.Errorf("%w: %s", ErrCircuitOpen, name)
+	}
+
+	res, err := call()
+	failed := err != nil && isProviderFailure(ctx, err)
+	if !failed && errors.Is(err, context.Canceled) {
+		// the trial call is not finished, so the next call is the trial one.
+		c.mu.Lock()
+		c.trial = false
+		c.mu.Unlock()
+		return res, err
+	}
+	if c.done(failed, conf) {
+		ylog.Warn("llm provider fails in a row, open its circuit", "provider", name, "cooldown", conf.Cooldown, "err", err.Error())
+	}
+	return res, err
+}
+
+// isProviderFailure returns true if the provider returns 5xx or 429, times out, or can't be connected. The
+// call canceled by the request is not the failure.
+func isProviderFailure(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return errors.Is(context.Cause(ctx), context.DeadlineExceeded)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if code := providerStatusCode(err); code != 0 {
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	netErr := net.Error(nil)
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Cleanup(func() {
+		providers = sync.Map{}
+		defaultProvider = nil
+		failover.Store(nil)
+		ConfigureCircuitBreaker(CircuitBreaker{})
+	})
+	ConfigureCircuitBreaker(CircuitBreaker{Failures: 2, Cooldown: 50 * time.Millisecond})
+
+	unavailable := &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable}
+	primary := &failingProvider{MockLLMProvider: MockLLMProvider{name: "primary"}, err: unavailable}
+	provider := withCircuitBreaker(primary)
+
+	call := func() error {
+		_, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, nil)
+		return err
+	}
+	state := func() string {
+		s, _ := GetProviderCircuit("primary")
+		return s
+	}
+
+	t.Run("the requests errors don't open the circuit", func(t *testing.T) {
+		primary.err = &openai.APIError{HTTPStatusCode: http.StatusBadRequest}
+		defer func() { primary.err = unavailable }()
+
+		for i := 0; i < 3; i++ {
+			assert.Error(t, call())
+		}
+		assert.Equal(t, CircuitClosed, state())
+	})
+
+	t.Run("open", func(t *testing.T) {
+		assert.ErrorIs(t, call(), unavailable)
+		assert.Equal(t, CircuitClosed, state())
+		assert.ErrorIs(t, call(), unavailable)
+		assert.Equal(t, CircuitOpen, state())
+
+		err := call()
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.EqualError(t, err, "the circuit of the llm provider is open: primary")
+	})
+
+	t.Run("the trial call fails", func(t *testing.T) {
+		time.Sleep(60 * time.Millisecond)
+		assert.Equal(t, CircuitHalfOpen, state())
+		assert.ErrorIs(t, call(), unavailable)
+		assert.Equal(t, CircuitOpen, state())
+	})
+
+	t.Run("fail over", func(t *testing.T) {
+		RegisterProvider(&completionsProvider{MockLLMProvider: MockLLMProvider{name: "secondary"}})
+		assert.NoError(t, ConfigureFailover(Failover{Providers: []string{"secondary"}}))
+		defer failover.Store(nil)
+
+		resp, err := (&failoverProvider{LLMProvider: provider}).GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "chatcmpl-1", resp.ID)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		time.Sleep(60 * time.Millisecond)
+		primary.err = nil
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		// the canceled trial call doesn't close the circuit.
+		_, err := provider.GetChatCompletions(ctx, openai.ChatCompletionRequest{}, nil)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, CircuitHalfOpen, state())
+
+		// the provider answers the trial call, though the error is not the failure of the provider.
+		primary.err = errors.New("invalid request")
+		assert.Error(t, call())
+		assert.Equal(t, CircuitClosed, state())
+	})
+}
@@ -0,0 +1,234 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// completionRequest is the request of the legacy text completions, the prompt and the stop can be a string or
+// an array of strings, so they are decoded by themselves.
+type completionRequest struct {
+	Model            string         `json:"model"`
+	Prompt           any            `json:"prompt"`
+	MaxTokens        int            `json:"max_tokens,omitempty"`
+	Temperature      float32        `json:"temperature,omitempty"`
+	TopP             float32        `json:"top_p,omitempty"`
+	N                int            `json:"n,omitempty"`
+	Stream           bool           `json:"stream,omitempty"`
+	Echo             bool           `json:"echo,omitempty"`
+	Stop             any            `json:"stop,omitempty"`
+	PresencePenalty  float32        `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float32        `json:"frequency_penalty,omitempty"`
+	LogitBias        map[string]int `json:"logit_bias,omitempty"`
+	Seed             *int           `json:"seed,omitempty"`
+	User             string         `json:"user,omitempty"`
+}
+
+var (
+	errInvalidPrompt = errors.New("prompt must be a string or an array of one string")
+	errInvalidStop   = errors.New("stop must be a string or an array of strings")
+)
+
+// toChatCompletionRequest translates the text completion request onto the chat completion request, the prompt
+// is the user message.
+func (req completionRequest) toChatCompletionRequest() (openai.ChatCompletionRequest, string, error) {
+	prompt, ok := singleString(req.Prompt)
+	if !ok {
+		return openai.ChatCompletionRequest{}, "", errInvalidPrompt
+	}
+	stop, ok := stringList(req.Stop)
+	if !ok {
+		return openai.ChatCompletionRequest{}, "", errInvalidStop
+	}
+	chatReq := openai.ChatCompletionRequest{
+		Model:            req.Model,
+		Messages:         []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: prompt}},
+		MaxTokens:        req.MaxTokens,
+		Temperature:      req.Temperature,
+		TopP:             req.TopP,
+		N:                req.N,
+		Stream:           req.Stream,
+		Stop:             stop,
+		PresencePenalty:  req.PresencePenalty,
+		FrequencyPenalty: req.FrequencyPenalty,
+		LogitBias:        req.LogitBias,
+		Seed:             req.Seed,
+		User:             req.User,
+	}
+	return chatReq, prompt, nil
+}
+
+func singleString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []any:
+		if len(v) != 1 {
+			return "", false
+		}
+		s, ok := v[0].(string)
+		return s, ok
+	}
+	return "", false
+}
+
+func stringList(v any) ([]string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, true
+	case string:
+		return []string{v}, true
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			list = append(list, s)
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// toCompletionResponse translates the chat completion response onto the text completion response.
+func toCompletionResponse(resp openai.ChatCompletionResponse, echo string) openai.CompletionResponse {
+	choices := make([]openai.CompletionChoice, 0, len(resp.Choices))
+	for _, c := range resp.Choices {
+		choices = append(choices, openai.CompletionChoice{
+			Text:         echo + c.Message.Content,
+			Index:        c.Index,
+			FinishReason: string(c.FinishReason),
+		})
+	}
+	return openai.CompletionResponse{
+		ID:      resp.ID,
+		Object:  "text_completion",
+		Created: resp.Created,
+		Model:   resp.Model,
+		Choices: choices,
+		Usage:   resp.Usage,
+	}
+}
+
+// toCompletionChunk translates the chat completion chunk onto the text completion chunk.
+func toCompletionChunk(chunk openai.ChatCompletionStreamResponse) openai.CompletionResponse {
+	choices := make([]openai.CompletionChoice, 0, len(chunk.Choices))
+	for _, c := range chunk.Choices {
+		choices = append(choices, openai.CompletionChoice{
+			Text:         c.Delta.Content,
+			Index:        c.Index,
+			FinishReason: string(c.FinishReason),
+		})
+	}
+	resp := openai.CompletionResponse{
+		ID:      chunk.ID,
+		Object:  "text_completion",
+		Created: chunk.Created,
+		Model:   chunk.Model,
+		Choices: choices,
+	}
+	if chunk.Usage != nil {
+		resp.Usage = *chunk.Usage
+	}
+	return resp
+}
+
+// HandleCompletions is the handler for POST /v1/completions, the legacy text completions are translated onto
+// the chat completions of the llm provider, the ai functions are not called.
+func HandleCompletions(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		service = FromServiceContext(ctx)
+	)
+	defer r.Body.Close()
+	limitRequestBody(w, r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ylog.Error("read request", "err", err.Error())
+		RespondWithError(w, readBodyErrorCode(err), err)
+		return
+	}
+	var req completionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		ylog.Error("decode request", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	chatReq, prompt, err := req.toChatCompletionRequest()
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if extraBody, err := parseExtraBody(body); err == nil && len(extraBody) > 0 {
+		ctx = WithExtraBodyContext(ctx, extraBody)
+	}
+	echo := ""
+	if req.Echo {
+		echo = prompt
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+
+	if err := completions(ctx, service, chatReq, echo, w); err != nil {
+		ylog.Error("invoke completions", "err", err.Error())
+		code := http.StatusBadRequest
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrQuotaExceeded) {
+			code = http.StatusTooManyRequests
+		} else if errors.Is(err, ErrCircuitOpen) {
+			code = http.StatusServiceUnavailable
+		}
+		RespondWithError(w, code, err)
+	}
+}
+
+func completions(ctx context.Context, service *Service, req openai.ChatCompletionRequest, echo string, w http.ResponseWriter) error {
+	if !req.Stream {
+		resp, err := service.LLMProvider.GetChatCompletions(ctx, req, service.Metadata)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(toCompletionResponse(resp, echo))
+	}
+
+	recver, err := service.LLMProvider.GetChatCompletionsStream(ctx, req, service.Metadata)
+	if err != nil {
+		return err
+	}
+	flusher := eventFlusher(w)
+	writeChunk := func(chunk openai.CompletionResponse) {
+		_, _ = io.WriteString(w, "data: ")
+		_ = json.NewEncoder(w).Encode(chunk)
+		_, _ = io.WriteString(w, "\n")
+		flusher.Flush()
+	}
+	for {
+		chunk, err := recver.Recv()
+		if err == io.EOF {
+			_, _ = io.WriteString(w, "data: [DONE]")
+			flusher.Flush()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp := toCompletionChunk(chunk)
+		// the prompt is echoed in the first chunk.
+		if echo != "" && len(resp.Choices) > 0 {
+			resp.Choices[0].Text = echo + resp.Choices[0].Text
+			echo = ""
+		}
+		writeChunk(resp)
+	}
+}
@@ -0,0 +1,110 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+type completionsProvider struct {
+	MockLLMProvider
+	req openai.ChatCompletionRequest
+}
+
+func (p *completionsProvider) GetChatCompletions(_ context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	p.req = req
+	return openai.ChatCompletionResponse{
+		ID:      "chatcmpl-1",
+		Model:   "gpt-4o",
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Content: " world"}, FinishReason: openai.FinishReasonStop}},
+		Usage:   openai.Usage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2},
+	}, nil
+}
+
+func (p *completionsProvider) GetChatCompletionsStream(_ context.Context, req openai.ChatCompletionRequest, _ metadata.M) (ResponseRecver, error) {
+	p.req = req
+	return &sliceRecver{chunks: []openai.ChatCompletionStreamResponse{
+		{ID: "chatcmpl-1", Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: " wor"}}}},
+		{ID: "chatcmpl-1", Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "ld"}, FinishReason: openai.FinishReasonStop}}},
+	}}, nil
+}
+
+type sliceRecver struct {
+	chunks []openai.ChatCompletionStreamResponse
+}
+
+func (r *sliceRecver) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if len(r.chunks) == 0 {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+	chunk := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	return chunk, nil
+}
+
+func TestHandleCompletions(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+		expectedBody string
+		expectedReq  openai.ChatCompletionRequest
+	}{
+		{
+			name:         "completion",
+			body:         `{"model":"gpt-4o","prompt":"hello","stop":"\n","max_tokens":16,"echo":true}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"id":"chatcmpl-1","object":"text_completion","created":0,"model":"gpt-4o","choices":[{"text":"hello world","index":0,"finish_reason":"stop","logprobs":{"tokens":null,"token_logprobs":null,"top_logprobs":null,"text_offset":null}}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}` + "\n",
+			expectedReq: openai.ChatCompletionRequest{
+				Model:     "gpt-4o",
+				Messages:  []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+				MaxTokens: 16,
+				Stop:      []string{"\n"},
+			},
+		},
+		{
+			name:         "stream",
+			body:         `{"model":"gpt-4o","prompt":["hello"],"stream":true}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `data: {"id":"chatcmpl-1","object":"text_completion","created":0,"model":"","choices":[{"text":" wor","index":0,"finish_reason":"","logprobs":{"tokens":null,"token_logprobs":null,"top_logprobs":null,"text_offset":null}}],"usage":{"prompt_tokens":0,"completion_tokens":0,"total_tokens":0}}
+
+data: {"id":"chatcmpl-1","object":"text_completion","created":0,"model":"","choices":[{"text":"ld","index":0,"finish_reason":"stop","logprobs":{"tokens":null,"token_logprobs":null,"top_logprobs":null,"text_offset":null}}],"usage":{"prompt_tokens":0,"completion_tokens":0,"total_tokens":0}}
+
+data: [DONE]`,
+			expectedReq: openai.ChatCompletionRequest{
+				Model:    "gpt-4o",
+				Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+				Stream:   true,
+			},
+		},
+		{
+			name:         "multiple prompts",
+			body:         `{"model":"gpt-4o","prompt":["hello","hi"]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":{"code":"400","message":"prompt must be a string or an array of one string"}}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &completionsProvider{}
+			service := &Service{LLMProvider: provider, Metadata: metadata.M{}}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/completions", strings.NewReader(tt.body))
+			r = r.WithContext(WithServiceContext(r.Context(), service))
+
+			HandleCompletions(w, r)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+			assert.Equal(t, tt.expectedReq, provider.req)
+		})
+	}
+}
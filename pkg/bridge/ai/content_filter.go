@@ -0,0 +1,15 @@
+package ai
+
+import (
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ContentFilterPassthrough passes the content filter results of Azure OpenAI through to the clients, so they can
+// see why the outputs are filtered. Azure sends the prompt_filter_results in the stream chunks without choices,
+// which are skipped if it is false.
+var ContentFilterPassthrough bool
+
+// isContentFilterChunk returns true if the stream chunk carries the content filter results of the prompt only.
+func isContentFilterChunk(res openai.ChatCompletionStreamResponse) bool {
+	return len(res.Choices) == 0 && (len(res.PromptFilterResults) > 0 || len(res.PromptAnnotations) > 0)
+}
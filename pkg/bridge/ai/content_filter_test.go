@@ -0,0 +1,51 @@
+package ai
+
+import (
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsContentFilterChunk(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunk    openai.ChatCompletionStreamResponse
+		expected bool
+	}{
+		{
+			name: "prompt filter results",
+			chunk: openai.ChatCompletionStreamResponse{
+				PromptFilterResults: []openai.PromptFilterResult{
+					{ContentFilterResults: openai.ContentFilterResults{Hate: openai.Hate{Filtered: true, Severity: "high"}}},
+				},
+			},
+			expected: true,
+		},
+		{
+			name: "prompt annotations",
+			chunk: openai.ChatCompletionStreamResponse{
+				PromptAnnotations: []openai.PromptAnnotation{{PromptIndex: 0}},
+			},
+			expected: true,
+		},
+		{
+			name: "content chunk",
+			chunk: openai.ChatCompletionStreamResponse{
+				Choices:             []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "hi"}}},
+				PromptFilterResults: []openai.PromptFilterResult{{}},
+			},
+			expected: false,
+		},
+		{
+			name:     "empty chunk",
+			chunk:    openai.ChatCompletionStreamResponse{},
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isContentFilterChunk(tt.chunk))
+		})
+	}
+}
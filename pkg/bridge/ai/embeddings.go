@@ -0,0 +1,121 @@
+package ai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+var errEmptyInput = errors.New("input must not be empty")
+
+// base64EmbeddingResponse is the embedding response in the base64 encoding format, eg: the default of the
+// OpenAI Python SDK.
+type base64EmbeddingResponse struct {
+	Object string                `json:"object"`
+	Data   []base64Embedding     `json:"data"`
+	Model  openai.EmbeddingModel `json:"model"`
+	Usage  openai.Usage          `json:"usage"`
+}
+
+// base64Embedding is the embedding whose float32 values are encoded in little endian and base64.
+type base64Embedding struct {
+	Object    string `json:"object"`
+	Embedding string `json:"embedding"`
+	Index     int    `json:"index"`
+}
+
+// toBase64EmbeddingResponse encodes the embeddings of the response in base64, the provider returns the
+// decoded embeddings even if they are requested in base64.
+func toBase64EmbeddingResponse(resp openai.EmbeddingResponse) base64EmbeddingResponse {
+	data := make([]base64Embedding, 0, len(resp.Data))
+	for _, e := range resp.Data {
+		buf := make([]byte, 4*len(e.Embedding))
+		for i, f := range e.Embedding {
+			binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+		}
+		data = append(data, base64Embedding{
+			Object:    e.Object,
+			Embedding: base64.StdEncoding.EncodeToString(buf),
+			Index:     e.Index,
+		})
+	}
+	return base64EmbeddingResponse{
+		Object: resp.Object,
+		Data:   data,
+		Model:  resp.Model,
+		Usage:  resp.Usage,
+	}
+}
+
+// HandleEmbeddings is the handler for POST /v1/embeddings, the embeddings are computed by the llm provider,
+// so the RAG pipelines can use the bridge as the single gateway.
+func HandleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		service = FromServiceContext(ctx)
+	)
+	defer r.Body.Close()
+	limitRequestBody(w, r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ylog.Error("read request", "err", err.Error())
+		RespondWithError(w, readBodyErrorCode(err), err)
+		return
+	}
+	var req openai.EmbeddingRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		ylog.Error("decode request", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if isEmptyInput(req.Input) {
+		RespondWithError(w, http.StatusBadRequest, errEmptyInput)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+
+	resp, err := service.LLMProvider.GetEmbeddings(ctx, req, service.Metadata)
+	if err != nil {
+		ylog.Error("invoke embeddings", "err", err.Error())
+		code := http.StatusBadRequest
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrQuotaExceeded) {
+			code = http.StatusTooManyRequests
+		} else if errors.Is(err, ErrCircuitOpen) {
+			code = http.StatusServiceUnavailable
+		}
+		RespondWithError(w, code, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if req.EncodingFormat == openai.EmbeddingEncodingFormatBase64 {
+		_ = json.NewEncoder(w).Encode(toBase64EmbeddingResponse(resp))
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// isEmptyInput returns true if the embedding input is missing, an empty string or an empty array.
+func isEmptyInput(input any) bool {
+	switch v := input.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
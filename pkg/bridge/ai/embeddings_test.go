@@ -0,0 +1,75 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+type embeddingsProvider struct {
+	MockLLMProvider
+	req openai.EmbeddingRequest
+}
+
+func (p *embeddingsProvider) GetEmbeddings(_ context.Context, req openai.EmbeddingRequest, _ metadata.M) (openai.EmbeddingResponse, error) {
+	p.req = req
+	return openai.EmbeddingResponse{
+		Object: "list",
+		Data:   []openai.Embedding{{Object: "embedding", Embedding: []float32{1, -2}, Index: 0}},
+		Model:  "text-embedding-3-small",
+		Usage:  openai.Usage{PromptTokens: 1, TotalTokens: 1},
+	}, nil
+}
+
+func TestHandleEmbeddings(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+		expectedBody string
+		expectedReq  openai.EmbeddingRequest
+	}{
+		{
+			name:         "float",
+			body:         `{"model":"text-embedding-3-small","input":"hello"}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"object":"list","data":[{"object":"embedding","embedding":[1,-2],"index":0}],"model":"text-embedding-3-small","usage":{"prompt_tokens":1,"completion_tokens":0,"total_tokens":1}}` + "\n",
+			expectedReq:  openai.EmbeddingRequest{Model: "text-embedding-3-small", Input: "hello"},
+		},
+		{
+			name:         "base64",
+			body:         `{"model":"text-embedding-3-small","input":["hello"],"encoding_format":"base64"}`,
+			expectedCode: http.StatusOK,
+			expectedBody: `{"object":"list","data":[{"object":"embedding","embedding":"AACAPwAAAMA=","index":0}],"model":"text-embedding-3-small","usage":{"prompt_tokens":1,"completion_tokens":0,"total_tokens":1}}` + "\n",
+			expectedReq:  openai.EmbeddingRequest{Model: "text-embedding-3-small", Input: []any{"hello"}, EncodingFormat: openai.EmbeddingEncodingFormatBase64},
+		},
+		{
+			name:         "empty input",
+			body:         `{"model":"text-embedding-3-small","input":[]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":{"code":"400","message":"input must not be empty"}}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &embeddingsProvider{}
+			service := &Service{LLMProvider: provider, Metadata: metadata.M{}}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/embeddings", strings.NewReader(tt.body))
+			r = r.WithContext(WithServiceContext(r.Context(), service))
+
+			HandleEmbeddings(w, r)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+			assert.Equal(t, tt.expectedReq, provider.req)
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package ai
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/ai"
+)
+
+// EventResponseWriter writes the streamed chat completion as the server-sent events, the chunks are the unnamed
+// events and the call stack is the named events, see ai.EventToolCall. It's safe for concurrent use, the progress
+// of the tool calls is written by the goroutines of the calls.
+type EventResponseWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	audio   *audioOutput
+
+	usage        ai.UsageEvent
+	hasUsage     bool
+	finishReason openai.FinishReason
+}
+
+// NewEventResponseWriter sets the headers of the server-sent events, and returns the EventResponseWriter.
+func NewEventResponseWriter(w http.ResponseWriter) *EventResponseWriter {
+	return &EventResponseWriter{w: w, flusher: eventFlusher(w)}
+}
+
+// WriteChunk writes the chunk of the chat completion, the usage and the finish reason of it are recorded.
+func (e *EventResponseWriter) WriteChunk(chunk openai.ChatCompletionStreamResponse) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.recordLocked(chunk)
+	data, _ := e.audio.marshalChunk(chunk)
+	_, _ = io.WriteString(e.w, "data: ")
+	_, _ = e.w.Write(append(data, '\n'))
+	_, _ = io.WriteString(e.w, "\n")
+	e.flusher.Flush()
+}
+
+// Record records the usage and the finish reason of the chunk which is not written to the client.
+func (e *EventResponseWriter) Record(chunk openai.ChatCompletionStreamResponse) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.recordLocked(chunk)
+}
+
+func (e *EventResponseWriter) recordLocked(chunk openai.ChatCompletionStreamResponse) {
+	if u := chunk.Usage; u != nil {
+		e.usage.PromptTokens += u.PromptTokens
+		e.usage.CompletionTokens += u.CompletionTokens
+		e.usage.TotalTokens += u.TotalTokens
+		e.hasUsage = true
+	}
+	if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "" {
+		e.finishReason = chunk.Choices[0].FinishReason
+	}
+}
+
+// WriteEvent writes the named event, the data is encoded as JSON.
+func (e *EventResponseWriter) WriteEvent(event string, data any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, _ = io.WriteString(e.w, "event: "+event+"\ndata: ")
+	_ = json.NewEncoder(e.w).Encode(data)
+	_, _ = io.WriteString(e.w, "\n")
+	e.flusher.Flush()
+}
+
+// WriteToolCalls writes the `tool_call` events of the tool calls.
+func (e *EventResponseWriter) WriteToolCalls(toolCalls []openai.ToolCall) {
+	for _, tc := range toolCalls {
+		e.WriteEvent(ai.EventToolCall, ai.ToolCallEvent{
+			ToolCallID:   tc.ID,
+			FunctionName: tc.Function.Name,
+			Arguments:    tc.Function.Arguments,
+		})
+	}
+}
+
+// WriteToolResults writes the `tool_result` events of the results of the tool calls.
+func (e *EventResponseWriter) WriteToolResults(toolCalls []openai.ToolCall, results []ai.ToolMessage) {
+	names := make(map[string]string, len(toolCalls))
+	for _, tc := range toolCalls {
+		names[tc.ID] = tc.Function.Name
+	}
+	for _, result := range results {
+		e.WriteEvent(ai.EventToolResult, ai.ToolResultEvent{
+			ToolCallID:   result.ToolCallId,
+			FunctionName: names[result.ToolCallId],
+			Content:      result.Content,
+		})
+	}
+}
+
+// WriteDone ends the stream, the `usage` and the `done` events are written before `data: [DONE]` if
+// includeCallStack is true.
+func (e *EventResponseWriter) WriteDone(transID string, includeCallStack bool) {
+	if includeCallStack {
+		e.mu.Lock()
+		usage, hasUsage, finishReason := e.usage, e.hasUsage, e.finishReason
+		e.mu.Unlock()
+
+		if hasUsage {
+			e.WriteEvent(ai.EventUsage, usage)
+		}
+		e.WriteEvent(ai.EventDone, ai.DoneEvent{TransID: transID, FinishReason: string(finishReason)})
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = io.WriteString(e.w, "data: [DONE]")
+	e.flusher.Flush()
+}
+
+// includeCallStackRequest is the flag of the chat completion request to emit the call stack events.
+type includeCallStackRequest struct {
+	IncludeCallStack bool `json:"include_call_stack"`
+}
+
+// parseIncludeCallStack returns true if the chat completion request asks for the call stack events.
+func parseIncludeCallStack(body []byte) bool {
+	var req includeCallStackRequest
+	_ = json.Unmarshal(body, &req)
+	return req.IncludeCallStack
+}
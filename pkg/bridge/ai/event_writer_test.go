@@ -0,0 +1,69 @@
+package ai
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/ai"
+)
+
+func TestEventResponseWriter(t *testing.T) {
+	toolCalls := []openai.ToolCall{
+		{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+	}
+
+	t.Run("with call stack", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		w := NewEventResponseWriter(rec)
+
+		w.Record(openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{{FinishReason: openai.FinishReasonToolCalls}},
+			Usage:   &openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+		w.WriteToolCalls(toolCalls)
+		w.WriteToolResults(toolCalls, []ai.ToolMessage{{ToolCallId: "call_1", Content: "sunny"}})
+		w.WriteChunk(openai.ChatCompletionStreamResponse{
+			ID:      "chatcmpl-1",
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "It's sunny"}, FinishReason: openai.FinishReasonStop}},
+			Usage:   &openai.Usage{PromptTokens: 20, CompletionTokens: 3, TotalTokens: 23},
+		})
+		w.WriteDone("trans-1", true)
+
+		assert.Equal(t, "text/event-stream", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `event: tool_call
+data: {"tool_call_id":"call_1","function_name":"get_weather","arguments":"{\"city\":\"Paris\"}"}
+
+event: tool_result
+data: {"tool_call_id":"call_1","function_name":"get_weather","content":"sunny"}
+
+data: {"id":"chatcmpl-1","object":"","created":0,"model":"","choices":[{"index":0,"delta":{"content":"It's sunny"},"finish_reason":"stop","content_filter_results":{"hate":{"filtered":false},"self_harm":{"filtered":false},"sexual":{"filtered":false},"violence":{"filtered":false}}}],"system_fingerprint":"","usage":{"prompt_tokens":20,"completion_tokens":3,"total_tokens":23}}
+
+event: usage
+data: {"prompt_tokens":30,"completion_tokens":8,"total_tokens":38}
+
+event: done
+data: {"trans_id":"trans-1","finish_reason":"stop"}
+
+data: [DONE]`, rec.Body.String())
+	})
+
+	t.Run("without call stack", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		w := NewEventResponseWriter(rec)
+
+		w.WriteEvent(ai.EventProgress, ai.ToolProgress{ToolCallID: "call_1", FunctionName: "get_weather", Content: "querying"})
+		w.WriteDone("trans-1", false)
+
+		assert.Equal(t, `event: progress
+data: {"tool_call_id":"call_1","function_name":"get_weather","content":"querying"}
+
+data: [DONE]`, rec.Body.String())
+	})
+}
+
+func TestParseIncludeCallStack(t *testing.T) {
+	assert.True(t, parseIncludeCallStack([]byte(`{"messages":[],"include_call_stack":true}`)))
+	assert.False(t, parseIncludeCallStack([]byte(`{"messages":[]}`)))
+}
@@ -0,0 +1,116 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// The `extra_body` field of the chat completion request carries the provider-specific parameters, which are not
+// in the OpenAI-shaped request, eg: `thinking` of Anthropic or `guided_json` of vLLM. The fields of it are merged
+// into the request body sent to the llm provider untouched, the fields set by the bridge are never overridden.
+//
+//	{
+//		"model": "claude-3-7-sonnet",
+//		"messages": [...],
+//		"extra_body": {"thinking": {"type": "enabled", "budget_tokens": 2048}}
+//	}
+
+// extraBodyRequest is the extra body of the chat completion request.
+type extraBodyRequest struct {
+	ExtraBody map[string]json.RawMessage `json:"extra_body"`
+}
+
+// parseExtraBody returns the extra body of the chat completion request, it's nil if the request has no extra body.
+func parseExtraBody(body []byte) (map[string]json.RawMessage, error) {
+	var req extraBodyRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	return req.ExtraBody, nil
+}
+
+type extraBodyContextKey struct{}
+
+// WithExtraBodyContext adds the extra body of the request to the request context
+func WithExtraBodyContext(ctx context.Context, extraBody map[string]json.RawMessage) context.Context {
+	return context.WithValue(ctx, extraBodyContextKey{}, extraBody)
+}
+
+// FromExtraBodyContext returns the extra body of the request from the request context
+func FromExtraBodyContext(ctx context.Context) map[string]json.RawMessage {
+	val, ok := ctx.Value(extraBodyContextKey{}).(map[string]json.RawMessage)
+	if !ok {
+		return nil
+	}
+	return val
+}
+
+// ExtraBodyTransport merges the extra body in the request context into the JSON body of the requests sent to
+// the llm provider, and carries the audio of the request and the response, see audioOutput. The providers built
+// on the OpenAI client use it by NewExtraBodyHTTPClient.
+type ExtraBodyTransport struct {
+	// Base is the underlying transport, http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+}
+
+// NewExtraBodyHTTPClient returns the http client of the llm providers which forwards the extra body.
+func NewExtraBodyHTTPClient() *http.Client {
+	return &http.Client{Transport: &ExtraBodyTransport{}}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *ExtraBodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	extraBody := FromExtraBodyContext(req.Context())
+	audio := fromAudioContext(req.Context())
+	if (len(extraBody) == 0 && audio == nil) || req.Body == nil || req.Method != http.MethodPost {
+		return base.RoundTrip(req)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(extraBody) > 0 {
+		if merged, err := mergeExtraBody(body, extraBody); err == nil {
+			body = merged
+		}
+	}
+	if audio != nil && bytes.Contains(body, []byte(ChatMessagePartTypeInputAudio)) {
+		if restored, err := restoreInputAudio(body); err == nil {
+			body = restored
+		}
+	}
+	// the request must not be modified by the transport.
+	req = req.Clone(req.Context())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	req.ContentLength = int64(len(body))
+
+	resp, err := base.RoundTrip(req)
+	if err != nil || audio == nil {
+		return resp, err
+	}
+	return audio.record(resp)
+}
+
+// mergeExtraBody merges the fields of the extra body into the JSON object, the fields of the object are kept.
+func mergeExtraBody(body []byte, extraBody map[string]json.RawMessage) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range extraBody {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
@@ -0,0 +1,65 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExtraBody(t *testing.T) {
+	extraBody, err := parseExtraBody([]byte(`{"model":"gpt-4o","extra_body":{"guided_json":{"type":"object"}}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]json.RawMessage{"guided_json": json.RawMessage(`{"type":"object"}`)}, extraBody)
+
+	extraBody, err = parseExtraBody([]byte(`{"model":"gpt-4o"}`))
+	assert.NoError(t, err)
+	assert.Nil(t, extraBody)
+
+	_, err = parseExtraBody([]byte(`{"extra_body":"thinking"}`))
+	assert.Error(t, err)
+}
+
+func TestExtraBodyTransport(t *testing.T) {
+	var received map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = nil
+		_ = json.Unmarshal(body, &received)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"hi"}}]}`)
+	}))
+	defer server.Close()
+
+	config := openai.DefaultConfig("token")
+	config.BaseURL = server.URL
+	config.HTTPClient = NewExtraBodyHTTPClient()
+	client := openai.NewClientWithConfig(config)
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+	}
+
+	t.Run("without extra body", func(t *testing.T) {
+		_, err := client.CreateChatCompletion(context.Background(), req)
+		assert.NoError(t, err)
+		assert.NotContains(t, received, "thinking")
+	})
+
+	t.Run("with extra body", func(t *testing.T) {
+		ctx := WithExtraBodyContext(context.Background(), map[string]json.RawMessage{
+			"thinking": json.RawMessage(`{"type":"enabled","budget_tokens":2048}`),
+			"model":    json.RawMessage(`"overridden"`),
+		})
+		_, err := client.CreateChatCompletion(ctx, req)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"type":"enabled","budget_tokens":2048}`, string(received["thinking"]))
+		// the fields set by the bridge are kept.
+		assert.JSONEq(t, `"gpt-4o"`, string(received["model"]))
+	})
+}
@@ -0,0 +1,191 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// Failover is the failover chain of the llm providers, the request is sent to the next provider of the chain
+// if the provider returns 5xx or 429, or times out.
+type Failover struct {
+	Providers []string      `yaml:"providers"` // Providers are the secondary providers, they are tried in order after the provider fails
+	Timeout   time.Duration `yaml:"timeout"`   // Timeout is the timeout of the call of a provider, the streams are timed out until they start, it is not timed out if not set, eg: 30s
+}
+
+// FailoverHeader is the response header which carries the provider serving the request after the failover.
+const FailoverHeader = "X-YoMo-Failover"
+
+// failover is the failover chain of the llm providers, it is disabled if it is nil.
+var failover atomic.Pointer[Failover]
+
+// ConfigureFailover fails over the requests to the secondary providers by the config.
+func ConfigureFailover(conf Failover) error {
+	if len(conf.Providers) == 0 {
+		failover.Store(nil)
+		return nil
+	}
+	for _, name := range conf.Providers {
+		if GetProvider(name) == nil {
+			return fmt.Errorf("failover: %w: %s", ErrNotExistsProvider, name)
+		}
+	}
+	failover.Store(&conf)
+	return nil
+}
+
+// failoverProvider sends the request to the secondary providers in order if the provider fails.
+type failoverProvider struct {
+	LLMProvider
+}
+
+// GetChatCompletions implements LLMProvider.
+func (p *failoverProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	resp, cancel, err := callWithFailover(ctx, p.LLMProvider, req.Model, func(ctx context.Context, provider LLMProvider) (openai.ChatCompletionResponse, error) {
+		return provider.GetChatCompletions(ctx, req, md)
+	})
+	cancel()
+	return resp, err
+}
+
+// GetChatCompletionsStream implements LLMProvider.
+func (p *failoverProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	recver, cancel, err := callWithFailover(ctx, p.LLMProvider, req.Model, func(ctx context.Context, provider LLMProvider) (ResponseRecver, error) {
+		return provider.GetChatCompletionsStream(ctx, req, md)
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &cancelRecver{ResponseRecver: recver, cancel: cancel}, nil
+}
+
+// GetEmbeddings implements LLMProvider.
+func (p *failoverProvider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, md metadata.M) (openai.EmbeddingResponse, error) {
+	resp, cancel, err := callWithFailover(ctx, p.LLMProvider, string(req.Model), func(ctx context.Context, provider LLMProvider) (openai.EmbeddingResponse, error) {
+		return provider.GetEmbeddings(ctx, req, md)
+	})
+	cancel()
+	return resp, err
+}
+
+// callWithFailover calls the provider, and the secondary providers in order while the call fails over. The
+// context of the successful call is canceled by the returned cancel function, so the streams are read after
+// the call returns.
+func callWithFailover[T any](ctx context.Context, provider LLMProvider, model string, call func(context.Context, LLMProvider) (T, error)) (T, context.CancelFunc, error) {
+	conf := failover.Load()
+	if conf == nil {
+		res, err := call(ctx, provider)
+		return res, func() {}, err
+	}
+
+	name := modelProviderName(provider.Name(), model)
+	chain := []string{name}
+	for _, secondary := range conf.Providers {
+		if secondary != name {
+			chain = append(chain, secondary)
+		}
+	}
+	for i := 0; ; i++ {
+		// the call timed out is canceled by context.DeadlineExceeded, so it's the failure of the provider.
+		callCtx, cancel := context.WithCancelCause(ctx)
+		var timer *time.Timer
+		if conf.Timeout > 0 {
+			timer = time.AfterFunc(conf.Timeout, func() { cancel(context.DeadlineExceeded) })
+		}
+		res, err := call(callCtx, provider)
+		timedOut := timer != nil && !timer.Stop()
+		if err == nil {
+			return res, func() { cancel(nil) }, nil
+		}
+		cancel(nil)
+
+		if i == len(chain)-1 || !shouldFailover(ctx, err, timedOut) {
+			return res, func() {}, err
+		}
+		next := GetProvider(chain[i+1])
+		if next == nil {
+			return res, func() {}, err
+		}
+		recordFailover(ctx, chain[i], chain[i+1], err)
+		provider = withCircuitBreaker(next)
+	}
+}
+
+// shouldFailover returns true if the provider returns 5xx or 429, times out, or its circuit is open. The request
+// is not failed over if it is canceled or timed out by itself.
+func shouldFailover(ctx context.Context, err error, timedOut bool) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if timedOut || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	if netErr := net.Error(nil); errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	code := providerStatusCode(err)
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// providerStatusCode returns the http status code of the error returned by the provider, it's 0 if unknown.
+func providerStatusCode(err error) int {
+	if apiErr := new(openai.APIError); errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	if reqErr := new(openai.RequestError); errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+// recordFailover records the failover in the trace and the response header of the request.
+func recordFailover(ctx context.Context, from string, to string, err error) {
+	ylog.Warn("llm provider fails, fail over to the next provider", "from", from, "to", to, "err", err.Error(), "transID", FromTransIDContext(ctx))
+
+	oteltrace.SpanFromContext(ctx).AddEvent("llm failover", oteltrace.WithAttributes(
+		attribute.String("llm.failover.from", from),
+		attribute.String("llm.failover.to", to),
+		attribute.String("llm.failover.error", err.Error()),
+	))
+	if header := fromResponseHeaderContext(ctx); header != nil {
+		header.Set(FailoverHeader, to)
+	}
+}
+
+// cancelRecver cancels the context of the stream after it is received to the end.
+type cancelRecver struct {
+	ResponseRecver
+	cancel context.CancelFunc
+}
+
+func (r *cancelRecver) Recv() (openai.ChatCompletionStreamResponse, error) {
+	resp, err := r.ResponseRecver.Recv()
+	if err != nil {
+		r.cancel()
+	}
+	return resp, err
+}
+
+type responseHeaderContextKey struct{}
+
+// withResponseHeaderContext adds the header of the response to the request context, so the llm providers
+// can set the response headers before the response is written.
+func withResponseHeaderContext(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, responseHeaderContextKey{}, header)
+}
+
+func fromResponseHeaderContext(ctx context.Context) http.Header {
+	header, _ := ctx.Value(responseHeaderContextKey{}).(http.Header)
+	return header
+}
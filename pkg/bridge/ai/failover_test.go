@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// failingProvider fails the calls by err, or blocks until the call is canceled if err is nil.
+type failingProvider struct {
+	MockLLMProvider
+	err error
+}
+
+func (p *failingProvider) fail(ctx context.Context) error {
+	if p.err != nil {
+		return p.err
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (p *failingProvider) GetChatCompletions(ctx context.Context, _ openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	return openai.ChatCompletionResponse{}, p.fail(ctx)
+}
+
+func (p *failingProvider) GetChatCompletionsStream(ctx context.Context, _ openai.ChatCompletionRequest, _ metadata.M) (ResponseRecver, error) {
+	return nil, p.fail(ctx)
+}
+
+func TestFailover(t *testing.T) {
+	t.Cleanup(func() {
+		providers = sync.Map{}
+		defaultProvider = nil
+		failover.Store(nil)
+	})
+	RegisterProvider(&completionsProvider{MockLLMProvider: MockLLMProvider{name: "secondary"}})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		err := ConfigureFailover(Failover{Providers: []string{"unknown"}})
+		assert.EqualError(t, err, "failover: llm provider does not exist: unknown")
+	})
+	assert.NoError(t, ConfigureFailover(Failover{Providers: []string{"secondary"}, Timeout: 50 * time.Millisecond}))
+
+	tests := []struct {
+		name        string
+		err         error
+		expectedErr bool
+	}{
+		{name: "5xx", err: &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable}},
+		{name: "429", err: &openai.RequestError{HTTPStatusCode: http.StatusTooManyRequests, Err: errors.New("rate limited")}},
+		{name: "timeout"},
+		{name: "4xx", err: &openai.APIError{HTTPStatusCode: http.StatusBadRequest}, expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			ctx, span := tracesdk.NewTracerProvider(tracesdk.WithSyncer(exporter)).Tracer("test").Start(context.Background(), "llm round")
+			header := http.Header{}
+			ctx = withResponseHeaderContext(ctx, header)
+
+			provider := &failoverProvider{LLMProvider: &failingProvider{MockLLMProvider: MockLLMProvider{name: "primary"}, err: tt.err}}
+			resp, err := provider.GetChatCompletions(ctx, openai.ChatCompletionRequest{Model: "gpt-4o"}, nil)
+			span.End()
+
+			if tt.expectedErr {
+				assert.Error(t, err)
+				assert.Empty(t, header.Get(FailoverHeader))
+				assert.Empty(t, exporter.GetSpans()[0].Events)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "chatcmpl-1", resp.ID)
+			assert.Equal(t, "secondary", header.Get(FailoverHeader))
+
+			events := exporter.GetSpans()[0].Events
+			assert.Len(t, events, 1)
+			assert.Equal(t, "llm failover", events[0].Name)
+		})
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		provider := &failoverProvider{LLMProvider: &failingProvider{
+			MockLLMProvider: MockLLMProvider{name: "primary"},
+			err:             &openai.APIError{HTTPStatusCode: http.StatusBadGateway},
+		}}
+		recver, err := provider.GetChatCompletionsStream(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4o"}, nil)
+		assert.NoError(t, err)
+
+		chunks := 0
+		for {
+			_, err := recver.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			chunks++
+		}
+		assert.Equal(t, 2, chunks)
+	})
+
+	t.Run("the request is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		provider := &failoverProvider{LLMProvider: &failingProvider{MockLLMProvider: MockLLMProvider{name: "primary"}}}
+		_, err := provider.GetChatCompletions(ctx, openai.ChatCompletionRequest{Model: "gpt-4o"}, nil)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,305 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/id"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ChatCompletionsServiceName is the full name of the gRPC service of the chat completions, the methods are:
+//
+//	rpc ChatCompletion(ChatCompletionRequest) returns (ChatCompletionResponse);
+//	rpc ChatCompletionStream(ChatCompletionRequest) returns (stream ChatCompletionStreamResponse);
+//
+// The messages are encoded by GRPCCodec, they are the JSON of the requests and the responses of the OpenAI
+// chat completions, so the sfns are called as the tools as they are by POST /v1/chat/completions.
+const ChatCompletionsServiceName = "yomo.ai.v1.ChatCompletions"
+
+// GRPCCodec is the codec of the gRPC service of the chat completions, it encodes the messages in JSON.
+var GRPCCodec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+// ChatCompletionsServer is the server of the gRPC service of the chat completions.
+type ChatCompletionsServer interface {
+	// ChatCompletion returns the chat completion of the request.
+	ChatCompletion(context.Context, *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error)
+	// ChatCompletionStream sends the chunks of the chat completion of the request.
+	ChatCompletionStream(*openai.ChatCompletionRequest, ChatCompletionStreamServer) error
+}
+
+// ChatCompletionStreamServer is the server side of the stream of ChatCompletionStream.
+type ChatCompletionStreamServer interface {
+	Send(*openai.ChatCompletionStreamResponse) error
+	grpc.ServerStream
+}
+
+type chatCompletionStreamServer struct {
+	grpc.ServerStream
+}
+
+func (s *chatCompletionStreamServer) Send(chunk *openai.ChatCompletionStreamResponse) error {
+	return s.ServerStream.SendMsg(chunk)
+}
+
+var chatCompletionsServiceDesc = grpc.ServiceDesc{
+	ServiceName: ChatCompletionsServiceName,
+	HandlerType: (*ChatCompletionsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ChatCompletion",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(openai.ChatCompletionRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(ChatCompletionsServer).ChatCompletion(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ChatCompletionsServiceName + "/ChatCompletion"}
+				handler := func(ctx context.Context, req any) (any, error) {
+					return srv.(ChatCompletionsServer).ChatCompletion(ctx, req.(*openai.ChatCompletionRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "ChatCompletionStream",
+			Handler: func(srv any, stream grpc.ServerStream) error {
+				req := new(openai.ChatCompletionRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(ChatCompletionsServer).ChatCompletionStream(req, &chatCompletionStreamServer{stream})
+			},
+			ServerStreams: true,
+		},
+	},
+}
+
+// RegisterChatCompletionsServer registers the server of the chat completions to the gRPC server, the gRPC
+// server must be created with grpc.ForceServerCodec(GRPCCodec).
+func RegisterChatCompletionsServer(s grpc.ServiceRegistrar, srv ChatCompletionsServer) {
+	s.RegisterService(&chatCompletionsServiceDesc, srv)
+}
+
+// ChatCompletionsClient is the typed client of the gRPC service of the chat completions.
+type ChatCompletionsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewChatCompletionsClient returns the client of the gRPC service of the chat completions.
+func NewChatCompletionsClient(cc grpc.ClientConnInterface) *ChatCompletionsClient {
+	return &ChatCompletionsClient{cc: cc}
+}
+
+// ChatCompletion returns the chat completion of the request.
+func (c *ChatCompletionsClient) ChatCompletion(ctx context.Context, req openai.ChatCompletionRequest, opts ...grpc.CallOption) (openai.ChatCompletionResponse, error) {
+	var resp openai.ChatCompletionResponse
+	opts = append([]grpc.CallOption{grpc.ForceCodec(GRPCCodec)}, opts...)
+	err := c.cc.Invoke(ctx, "/"+ChatCompletionsServiceName+"/ChatCompletion", &req, &resp, opts...)
+	return resp, err
+}
+
+// ChatCompletionStream returns the receiver of the chunks of the chat completion of the request, the receiver
+// returns io.EOF after the last chunk.
+func (c *ChatCompletionsClient) ChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest, opts ...grpc.CallOption) (ResponseRecver, error) {
+	opts = append([]grpc.CallOption{grpc.ForceCodec(GRPCCodec)}, opts...)
+	stream, err := c.cc.NewStream(ctx, &chatCompletionsServiceDesc.Streams[0], "/"+ChatCompletionsServiceName+"/ChatCompletionStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &chatCompletionStreamClient{stream}, nil
+}
+
+type chatCompletionStreamClient struct {
+	grpc.ClientStream
+}
+
+func (c *chatCompletionStreamClient) Recv() (openai.ChatCompletionStreamResponse, error) {
+	var chunk openai.ChatCompletionStreamResponse
+	err := c.ClientStream.RecvMsg(&chunk)
+	return chunk, err
+}
+
+// grpcServer serves the chat completions of the service over gRPC, the service is loaded by every call.
+type grpcServer struct {
+	load func() (*Service, error)
+}
+
+// NewChatCompletionsServer returns the server of the chat completions of the service.
+func NewChatCompletionsServer(service *Service) ChatCompletionsServer {
+	return &grpcServer{load: func() (*Service, error) { return service, nil }}
+}
+
+// NewCachedChatCompletionsServer returns the server of the chat completions of the service of the credential,
+// the service is loaded from the service cache by every call, as it may be evicted or refreshed.
+func NewCachedChatCompletionsServer(credential string, zipperAddr string, provider LLMProvider, exFn ExchangeMetadataFunc) ChatCompletionsServer {
+	return &grpcServer{load: func() (*Service, error) {
+		return LoadOrCreateService(credential, zipperAddr, provider, exFn)
+	}}
+}
+
+func (s *grpcServer) ChatCompletion(ctx context.Context, req *openai.ChatCompletionRequest) (*openai.ChatCompletionResponse, error) {
+	ctx, err := grpcCallerContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateChatCompletionRequest(*req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	req.Stream = false
+
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+
+	service, err := s.load()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	rec := &responsesRecorder{header: make(http.Header)}
+	if err := service.GetChatCompletions(ctx, *req, grpcTransID(ctx), rec, false); err != nil {
+		return nil, grpcError(err)
+	}
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal(rec.body.Bytes(), &resp); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &resp, nil
+}
+
+func (s *grpcServer) ChatCompletionStream(req *openai.ChatCompletionRequest, stream ChatCompletionStreamServer) error {
+	ctx, err := grpcCallerContext(stream.Context())
+	if err != nil {
+		return err
+	}
+	if err := validateChatCompletionRequest(*req); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	req.Stream = true
+
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+
+	service, err := s.load()
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	w := &grpcStreamWriter{header: make(http.Header), stream: stream}
+	if err := service.GetChatCompletions(ctx, *req, grpcTransID(ctx), w, false); err != nil {
+		return grpcError(err)
+	}
+	return w.err
+}
+
+// grpcCallerContext authenticates the caller by the bearer token of the authorization metadata and adds it to
+// ctx, the calls of the unknown tokens fail with codes.Unauthenticated, see WithCallerAuthentication.
+func grpcCallerContext(ctx context.Context) (context.Context, error) {
+	var token string
+	md, _ := grpcmetadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		if token = bearerToken(auth); token != "" {
+			break
+		}
+	}
+	caller, err := authenticateCaller(token)
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return withCallerContext(ctx, caller), nil
+}
+
+// grpcTransID returns the transID of the call, it's set by the interceptors, eg: the prompt audit, or a new one.
+func grpcTransID(ctx context.Context) string {
+	if transID := FromTransIDContext(ctx); transID != "" {
+		return transID
+	}
+	return id.New(32)
+}
+
+// grpcStreamWriter sends the chunks of the server-sent events written by the service to the gRPC stream.
+type grpcStreamWriter struct {
+	header http.Header
+	stream ChatCompletionStreamServer
+	buf    bytes.Buffer
+	err    error
+}
+
+func (w *grpcStreamWriter) Header() http.Header { return w.header }
+func (w *grpcStreamWriter) WriteHeader(int)     {}
+func (w *grpcStreamWriter) Flush()              {}
+
+func (w *grpcStreamWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	parseChunkEvents(&w.buf, func(chunk openai.ChatCompletionStreamResponse) {
+		if w.err == nil {
+			w.err = w.stream.Send(&chunk)
+		}
+	}, func() {})
+	return len(p), nil
+}
+
+// grpcError returns the gRPC status of the error of the chat completions.
+func grpcError(err error) error {
+	var toolErr *ToolCallError
+	switch {
+	case errors.Is(err, ErrRateLimited), errors.Is(err, ErrQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, ErrCircuitOpen):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, ErrModerationFlagged), errors.Is(err, ErrStreamChoices), errors.Is(err, ErrToolChoice),
+		errors.Is(err, ErrSystemPromptOp), errors.Is(err, ErrGuardRejected):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &toolErr):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	return status.Error(codes.Unknown, err.Error())
+}
+
+// ServeGRPC serves the gRPC service of the chat completions by the server on addr, it's served over TLS if
+// tlsConfig is not nil, opts are the additional options of the gRPC server, eg: the interceptors.
+func ServeGRPC(addr string, server ChatCompletionsServer, tlsConfig *tls.Config, opts ...grpc.ServerOption) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	opts = append([]grpc.ServerOption{grpc.ForceServerCodec(GRPCCodec)}, opts...)
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	srv := grpc.NewServer(opts...)
+	RegisterChatCompletionsServer(srv, server)
+
+	ylog.Info("grpc server is running", "addr", addr, "tls", tlsConfig != nil)
+	return srv.Serve(lis)
+}
@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestChatCompletionsGRPC(t *testing.T) {
+	service := &Service{LLMProvider: &completionsProvider{}, Metadata: metadata.M{}}
+	service.SetSystemPrompt("")
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ForceServerCodec(GRPCCodec))
+	RegisterChatCompletionsServer(srv, NewChatCompletionsServer(service))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := NewChatCompletionsClient(conn)
+
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		resp, err := client.ChatCompletion(context.Background(), req)
+		assert.NoError(t, err)
+		assert.Equal(t, "chatcmpl-1", resp.ID)
+		assert.Equal(t, " world", resp.Choices[0].Message.Content)
+		assert.Equal(t, 2, resp.Usage.TotalTokens)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		recver, err := client.ChatCompletionStream(context.Background(), req)
+		assert.NoError(t, err)
+
+		var content string
+		for {
+			chunk, err := recver.Recv()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			content += chunk.Choices[0].Delta.Content
+		}
+		assert.Equal(t, " world", content)
+	})
+
+	t.Run("callers", func(t *testing.T) {
+		t.Cleanup(func() { ConfigureCallers(nil) })
+		assert.NoError(t, ConfigureCallers([]Caller{{Name: "team-a", Token: "token-a"}}))
+
+		_, err := client.ChatCompletion(context.Background(), req)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+		ctx := grpcmetadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer token-a")
+		_, err = client.ChatCompletion(ctx, req)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		assert.Equal(t, codes.ResourceExhausted, status.Code(grpcError(ErrRateLimited)))
+	})
+}
@@ -0,0 +1,93 @@
+package ai
+
+import (
+	"context"
+	"errors"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrGuardRejected is returned when a chat completion request or its response is rejected by a guard, the guards
+// wrap it to tell the reason, eg: fmt.Errorf("%w: prompt injection", ErrGuardRejected).
+var ErrGuardRejected = errors.New("the request is rejected by the guard")
+
+// RequestGuard checks the chat completion requests before they reach the llm provider, eg: it detects the
+// prompt injections or enforces the policies of the requests, see ServiceOptions.RequestGuards.
+type RequestGuard interface {
+	// GuardRequest returns the request sent to the llm provider, which may be modified, the request is rejected
+	// if it returns an error. The request has the tools and the system prompt of the service applied.
+	GuardRequest(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error)
+}
+
+// RequestGuardFunc is an adapter to use the functions as the request guards.
+type RequestGuardFunc func(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error)
+
+// GuardRequest implements RequestGuard.
+func (f RequestGuardFunc) GuardRequest(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error) {
+	return f(ctx, req)
+}
+
+// ResponseGuard checks the answers of the llm provider before they are written to the clients, eg: it filters
+// the outputs, see ServiceOptions.ResponseGuards.
+type ResponseGuard interface {
+	// GuardResponse returns the response written to the client, which may be modified, the response is rejected
+	// if it returns an error. It checks the final response of the non-streaming requests.
+	GuardResponse(ctx context.Context, req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) (openai.ChatCompletionResponse, error)
+	// GuardStreamResponse is GuardResponse of the streaming requests, it checks every chunk of the streams in
+	// order, including the chunks of the tool calls, the stream is stopped if it returns an error.
+	GuardStreamResponse(ctx context.Context, req openai.ChatCompletionRequest, chunk openai.ChatCompletionStreamResponse) (openai.ChatCompletionStreamResponse, error)
+}
+
+// guardRequest runs the request guards in order.
+func guardRequest(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error) {
+	for _, guard := range getServiceOptions().RequestGuards {
+		var err error
+		if req, err = guard.GuardRequest(ctx, req); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// guardResponse runs the response guards in order.
+func guardResponse(ctx context.Context, req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse) (openai.ChatCompletionResponse, error) {
+	for _, guard := range getServiceOptions().ResponseGuards {
+		var err error
+		if resp, err = guard.GuardResponse(ctx, req, resp); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// guardRecver returns the recver whose chunks are checked by the response guards, it returns r if there are
+// no response guards.
+func guardRecver(ctx context.Context, req openai.ChatCompletionRequest, r ResponseRecver) ResponseRecver {
+	guards := getServiceOptions().ResponseGuards
+	if len(guards) == 0 {
+		return r
+	}
+	return &guardedRecver{ResponseRecver: r, ctx: ctx, req: req, guards: guards}
+}
+
+// guardedRecver runs the response guards on every chunk it receives.
+type guardedRecver struct {
+	ResponseRecver
+	ctx    context.Context
+	req    openai.ChatCompletionRequest
+	guards []ResponseGuard
+}
+
+// Recv implements ResponseRecver.
+func (r *guardedRecver) Recv() (openai.ChatCompletionStreamResponse, error) {
+	chunk, err := r.ResponseRecver.Recv()
+	if err != nil {
+		return chunk, err
+	}
+	for _, guard := range r.guards {
+		if chunk, err = guard.GuardStreamResponse(r.ctx, r.req, chunk); err != nil {
+			return chunk, err
+		}
+	}
+	return chunk, nil
+}
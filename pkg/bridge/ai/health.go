@@ -0,0 +1,134 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+// Pinger is implemented by the llm providers which can be probed on demand by a cheap call, eg: listing
+// the models.
+type Pinger interface {
+	// Ping returns nil if the llm provider is reachable.
+	Ping(ctx context.Context) error
+}
+
+// GetProviderPinger returns the pinger of the llm provider, ok is false if the provider can't be pinged.
+func GetProviderPinger(provider LLMProvider) (pinger Pinger, ok bool) {
+	provider = unwrapProvider(provider)
+	pinger, ok = provider.(Pinger)
+	return pinger, ok
+}
+
+const (
+	// readyProbeTimeout is the timeout of pinging the llm provider.
+	readyProbeTimeout = 5 * time.Second
+	// readyProbeInterval is how long the result of pinging the llm provider is reused, so the frequent
+	// probes of the load balancers don't hit the llm provider every time.
+	readyProbeInterval = 5 * time.Second
+)
+
+// HealthReport is the health of the bridge, it's returned by GET /healthz and GET /readyz.
+type HealthReport struct {
+	// Ready is true if the llm provider is healthy and the source is connected to the zipper
+	Ready bool `json:"ready"`
+	// Provider is the health of the llm provider
+	Provider ProviderReport `json:"provider"`
+	// Sfn is the connectivity to the sfns
+	Sfn SfnReport `json:"sfn"`
+}
+
+// ProviderReport is the health of the llm provider of the bridge.
+type ProviderReport struct {
+	// Name is the name of the llm provider
+	Name string `json:"name"`
+	// Probed is false if the provider can't be pinged and doesn't check its health, then it's assumed healthy
+	Probed bool `json:"probed"`
+	ProviderHealth
+}
+
+// SfnReport is the connectivity of the bridge to the sfns.
+type SfnReport struct {
+	// Source is the state of the connection of the source to the zipper: connected, disconnected or unknown
+	Source string `json:"source"`
+	// Tools is the number of the sfns registered as the tools
+	Tools int `json:"tools"`
+}
+
+var (
+	muReadyProbe   sync.Mutex
+	lastReadyProbe = map[string]ProviderHealth{} // the last ping results by the names of the providers
+)
+
+// pingProvider pings the llm provider, the result is reused for readyProbeInterval.
+func pingProvider(ctx context.Context, name string, pinger Pinger) ProviderHealth {
+	muReadyProbe.Lock()
+	defer muReadyProbe.Unlock()
+
+	if health, ok := lastReadyProbe[name]; ok && time.Since(health.CheckedAt) < readyProbeInterval {
+		return health
+	}
+	ctx, cancel := context.WithTimeout(ctx, readyProbeTimeout)
+	defer cancel()
+
+	health := ProviderHealth{CheckedAt: time.Now()}
+	err := pinger.Ping(ctx)
+	health.Latency = time.Since(health.CheckedAt)
+	if err != nil {
+		health.Error = err.Error()
+	} else {
+		health.Healthy = true
+	}
+	lastReadyProbe[name] = health
+	return health
+}
+
+// checkHealth returns the health of the service, the llm provider is pinged if probe is true, otherwise the
+// health measured by the periodic probes of the provider is reported.
+func checkHealth(ctx context.Context, service *Service, probe bool) HealthReport {
+	name := service.LLMProvider.Name()
+	provider := GetProvider(name)
+	if provider == nil {
+		provider = service.LLMProvider
+	}
+
+	report := HealthReport{Provider: ProviderReport{Name: name, ProviderHealth: ProviderHealth{Healthy: true}}}
+	if pinger, ok := GetProviderPinger(provider); ok && probe {
+		report.Provider.Probed = true
+		report.Provider.ProviderHealth = pingProvider(ctx, name, pinger)
+	} else if health, ok := GetProviderHealth(provider); ok && !health.CheckedAt.IsZero() {
+		report.Provider.Probed = true
+		report.Provider.ProviderHealth = health
+	}
+
+	report.Sfn.Source = sourceState(service)
+	if tools, err := register.ListToolCalls(service.Metadata); err == nil {
+		report.Sfn.Tools = len(tools)
+	}
+
+	report.Ready = report.Provider.Healthy && report.Sfn.Source != "disconnected"
+	return report
+}
+
+// HandleHealthz is the handler for GET /healthz, it responds 200 as long as the bridge is serving, the body
+// reports the health measured by the periodic probes without calling the llm provider.
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, checkHealth(r.Context(), FromServiceContext(r.Context()), false))
+}
+
+// HandleReadyz is the handler for GET /readyz, it pings the llm provider and checks the connection to the
+// zipper, it responds 503 if either is down, so the load balancers route away from the degraded zippers.
+func HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := checkHealth(r.Context(), FromServiceContext(r.Context()), true)
+	if !report.Ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(report)
+		return
+	}
+	respondJSON(w, report)
+}
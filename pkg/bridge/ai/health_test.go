@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+type pingProviderMock struct {
+	MockLLMProvider
+	err   error
+	pings int
+}
+
+func (p *pingProviderMock) Ping(context.Context) error {
+	p.pings++
+	return p.err
+}
+
+type connectedSourceMock struct {
+	yomo.Source
+	connected bool
+}
+
+func (s *connectedSourceMock) Connected() bool { return s.connected }
+
+func TestHandleReadyz(t *testing.T) {
+	t.Cleanup(func() { lastReadyProbe = map[string]ProviderHealth{} })
+
+	tests := []struct {
+		name      string
+		provider  LLMProvider
+		connected bool
+		code      int
+		probed    bool
+	}{
+		{name: "ready", provider: &pingProviderMock{MockLLMProvider: MockLLMProvider{name: "ping-ok"}}, connected: true, code: http.StatusOK, probed: true},
+		{name: "provider down", provider: &pingProviderMock{MockLLMProvider: MockLLMProvider{name: "ping-down"}, err: errors.New("connection refused")}, connected: true, code: http.StatusServiceUnavailable, probed: true},
+		{name: "zipper down", provider: &pingProviderMock{MockLLMProvider: MockLLMProvider{name: "ping-zipper"}}, connected: false, code: http.StatusServiceUnavailable, probed: true},
+		{name: "not probed", provider: &MockLLMProvider{name: "no-ping"}, connected: true, code: http.StatusOK, probed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &Service{LLMProvider: tt.provider, Metadata: metadata.M{}, source: &connectedSourceMock{connected: tt.connected}}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			HandleReadyz(w, r.WithContext(WithServiceContext(r.Context(), service)))
+
+			assert.Equal(t, tt.code, w.Code)
+			var report HealthReport
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+			assert.Equal(t, tt.code == http.StatusOK, report.Ready)
+			assert.Equal(t, tt.probed, report.Provider.Probed)
+			assert.Equal(t, tt.provider.Name(), report.Provider.Name)
+		})
+	}
+
+	t.Run("the ping is reused", func(t *testing.T) {
+		provider := &pingProviderMock{MockLLMProvider: MockLLMProvider{name: "ping-reused"}}
+		service := &Service{LLMProvider: provider, Metadata: metadata.M{}}
+		for i := 0; i < 3; i++ {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/readyz", nil)
+			HandleReadyz(w, r.WithContext(WithServiceContext(r.Context(), service)))
+			assert.Equal(t, http.StatusOK, w.Code)
+		}
+		assert.Equal(t, 1, provider.pings)
+	})
+}
+
+func TestHandleHealthz(t *testing.T) {
+	provider := &pingProviderMock{MockLLMProvider: MockLLMProvider{name: "healthz"}, err: errors.New("connection refused")}
+	service := &Service{LLMProvider: provider, Metadata: metadata.M{}, source: &connectedSourceMock{connected: true}}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	HandleHealthz(w, r.WithContext(WithServiceContext(r.Context(), service)))
+
+	// the liveness doesn't call the llm provider.
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0, provider.pings)
+
+	var report HealthReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, "connected", report.Sfn.Source)
+}
@@ -0,0 +1,212 @@
+package ai
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader is the header of the idempotency key of the chat completion requests, the requests
+	// with the same key within the IdempotencyWindow return the stored response instead of calling the tools again.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set to true in the stored responses returned to the repeated requests.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// IdempotencyWindow is the time the responses of the requests with the idempotency key are stored.
+var IdempotencyWindow = 24 * time.Hour
+
+// idempotencyMaxBytes is the max bytes of the stored responses, the oldest ones are evicted if it is exceeded.
+const idempotencyMaxBytes = 64 << 20
+
+// errIdempotencyKeyReused is returned when the idempotency key is reused by a different request.
+var errIdempotencyKeyReused = errors.New("the Idempotency-Key has been used by a different request")
+
+// idempotentResponse is the response of the request with the idempotency key, it's stored after done is closed
+// if the request succeeds.
+type idempotentResponse struct {
+	key         string
+	requestHash string
+	createdAt   time.Time
+	done        chan struct{}
+
+	stored      bool
+	status      int
+	contentType string
+	body        []byte
+}
+
+// idempotencyStore stores the responses by the idempotency keys, the responses expire in the order of creation.
+type idempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]*list.Element
+	order     *list.List // the front is the oldest
+	bytes     int64
+	maxBytes  int64
+}
+
+var idempotency = newIdempotencyStore(idempotencyMaxBytes)
+
+func newIdempotencyStore(maxBytes int64) *idempotencyStore {
+	return &idempotencyStore{
+		responses: make(map[string]*list.Element),
+		order:     list.New(),
+		maxBytes:  maxBytes,
+	}
+}
+
+// begin returns the response of the key, owner is true if the response is created by the call, then the caller
+// must run the request and call finish. Otherwise, the caller waits for the response to be done and replays it.
+func (s *idempotencyStore) begin(key, requestHash string, window time.Duration) (resp *idempotentResponse, owner bool) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictExpired(now, window)
+	if elem, ok := s.responses[key]; ok {
+		return elem.Value.(*idempotentResponse), false
+	}
+	resp = &idempotentResponse{
+		key:         key,
+		requestHash: requestHash,
+		createdAt:   now,
+		done:        make(chan struct{}),
+	}
+	s.responses[key] = s.order.PushBack(resp)
+	return resp, true
+}
+
+// finish stores the response and wakes up the repeated requests waiting for it. Only the successful responses
+// with the 2xx status are stored, the failed ones are removed, so the retries of the request run it again.
+func (s *idempotencyStore) finish(resp *idempotentResponse, status int, contentType string, body []byte, succeeded bool) {
+	s.mu.Lock()
+	elem, ok := s.responses[resp.key]
+	ok = ok && elem.Value == resp
+	if !succeeded || status < 200 || status >= 300 {
+		if ok {
+			s.remove(elem)
+		}
+		s.mu.Unlock()
+		close(resp.done)
+		return
+	}
+	resp.stored, resp.status, resp.contentType, resp.body = true, status, contentType, body
+	if ok {
+		s.bytes += int64(len(body))
+		// the oldest responses are evicted, the responses in flight and the one being stored are kept.
+		for elem := s.order.Front(); elem != nil && s.bytes > s.maxBytes; {
+			next := elem.Next()
+			if r := elem.Value.(*idempotentResponse); r != resp && r.isDone() {
+				s.remove(elem)
+			}
+			elem = next
+		}
+	}
+	s.mu.Unlock()
+
+	close(resp.done)
+}
+
+// evictExpired evicts the responses created before the window, the caller must hold the lock.
+// The responses in flight are never evicted, so the repeated requests always wait for them.
+func (s *idempotencyStore) evictExpired(now time.Time, window time.Duration) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		resp := elem.Value.(*idempotentResponse)
+		if now.Sub(resp.createdAt) <= window || !resp.isDone() {
+			return
+		}
+		s.remove(elem)
+	}
+}
+
+func (s *idempotencyStore) remove(elem *list.Element) {
+	resp := s.order.Remove(elem).(*idempotentResponse)
+	delete(s.responses, resp.key)
+	s.bytes -= int64(len(resp.body))
+}
+
+func (r *idempotentResponse) isDone() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// replay waits for the response to be done and writes it, it returns the error of ctx if ctx is done first.
+// replayed is false if the request failed and its response is not stored, then the request should run again.
+func (r *idempotentResponse) replay(ctx context.Context, w http.ResponseWriter) (replayed bool, err error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-r.done:
+	}
+	if !r.stored {
+		return false, nil
+	}
+	if r.contentType != "" {
+		w.Header().Set("Content-Type", r.contentType)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(r.status)
+	_, err = w.Write(r.body)
+	return true, err
+}
+
+// requestHash returns the hash of the request body, the idempotency key can't be reused by a different request.
+func requestHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// idempotencyRecorder records the response to be stored, and writes it to the client as well. The writing errors
+// of the client are ignored, so the request runs to the end and its response is stored if the client goes away.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *idempotencyRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *idempotencyRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	_, _ = w.ResponseWriter.Write(b)
+	return len(b), nil
+}
+
+// Flush flushes the stream responses, the handlers assert the http.Flusher to write the events.
+func (w *idempotencyRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (w *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *idempotencyRecorder) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
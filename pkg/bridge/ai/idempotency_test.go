@@ -0,0 +1,96 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	store := newIdempotencyStore(10)
+
+	resp, owner := store.begin("key-1", "hash-1", time.Hour)
+	assert.True(t, owner)
+
+	// the repeated request waits for the response in flight.
+	repeated, owner := store.begin("key-1", "hash-1", time.Hour)
+	assert.False(t, owner)
+	assert.Same(t, resp, repeated)
+
+	replayed := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rr := httptest.NewRecorder()
+		ok, err := repeated.replay(context.Background(), rr)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		replayed <- rr
+	}()
+
+	rec := &idempotencyRecorder{ResponseWriter: httptest.NewRecorder()}
+	rec.Header().Set("Content-Type", "application/json")
+	rec.Write([]byte(`{"id":"1"}`))
+	store.finish(resp, rec.statusCode(), rec.Header().Get("Content-Type"), rec.body.Bytes(), true)
+
+	rr := <-replayed
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "true", rr.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, `{"id":"1"}`, rr.Body.String())
+
+	t.Run("canceled", func(t *testing.T) {
+		resp, _ := store.begin("key-2", "hash-2", time.Hour)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := resp.replay(ctx, httptest.NewRecorder())
+		assert.ErrorIs(t, err, context.Canceled)
+		store.finish(resp, http.StatusOK, "", nil, true)
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		resp, _ := store.begin("key-3", "hash-3", time.Hour)
+		store.finish(resp, http.StatusOK, "", []byte("0123456789"), true)
+
+		_, owner := store.begin("key-1", "hash-1", time.Hour)
+		assert.True(t, owner, "the oldest response is evicted")
+		_, owner = store.begin("key-3", "hash-3", time.Hour)
+		assert.False(t, owner)
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		for _, tt := range []struct {
+			name      string
+			status    int
+			succeeded bool
+		}{
+			{name: "error status", status: http.StatusBadGateway, succeeded: true},
+			{name: "error of the stream", status: http.StatusOK, succeeded: false},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				resp, _ := store.begin("key-4", "hash-4", time.Hour)
+				repeated, _ := store.begin("key-4", "hash-4", time.Hour)
+				store.finish(resp, tt.status, "", []byte("error"), tt.succeeded)
+
+				// the repeated request runs again instead of replaying the failure.
+				replayed, err := repeated.replay(context.Background(), httptest.NewRecorder())
+				assert.NoError(t, err)
+				assert.False(t, replayed)
+				retry, owner := store.begin("key-4", "hash-4", time.Hour)
+				assert.True(t, owner)
+				store.finish(retry, http.StatusOK, "", nil, true)
+				store.mu.Lock()
+				store.remove(store.responses["key-4"])
+				store.mu.Unlock()
+			})
+		}
+	})
+
+	t.Run("window", func(t *testing.T) {
+		time.Sleep(2 * time.Millisecond)
+		_, owner := store.begin("key-3", "hash-3", time.Millisecond)
+		assert.True(t, owner, "the expired response is evicted")
+	})
+}
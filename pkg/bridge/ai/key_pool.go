@@ -0,0 +1,264 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// The `api_keys` of the provider config are the API keys separated by commas, the requests rotate among them to
+// spread the rate limits of the keys:
+//
+//	openai:
+//	  api_keys: sk-aaa,sk-bbb,sk-ccc
+//	  key_rotation: least_errors ## round_robin or least_errors, default is round_robin
+//	  key_cooldown: 1m ## the key returning 429, 401 or 403 is not used for it, default is 1m
+
+const (
+	// KeyRotationRoundRobin uses the API keys in turn.
+	KeyRotationRoundRobin = "round_robin"
+	// KeyRotationLeastErrors uses the API key with the least consecutive errors, the keys are used in turn if
+	// they have the same errors.
+	KeyRotationLeastErrors = "least_errors"
+)
+
+// DefaultKeyCooldown is the default time the API key returning 429, 401 or 403 is not used.
+const DefaultKeyCooldown = time.Minute
+
+// KeyHealth is the health of an API key of the key pool.
+type KeyHealth struct {
+	// Key is the redacted API key
+	Key string `json:"key"`
+	// Requests is the number of the requests sent with the key
+	Requests int64 `json:"requests"`
+	// Errors is the number of the failed requests
+	Errors int64 `json:"errors"`
+	// ConsecutiveErrors is the number of the requests failed in a row
+	ConsecutiveErrors int `json:"consecutive_errors"`
+	// CooldownUntil is the time the key is used again after it returns 429, 401 or 403, it's omitted if the key is not
+	// cooling down
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+}
+
+// poolKey is an API key of the key pool with the provider built with it, the counters are guarded by the
+// mutex of the pool.
+type poolKey struct {
+	key      string
+	provider LLMProvider
+
+	requests          int64
+	errors            int64
+	consecutiveErrors int
+	cooldownUntil     time.Time
+}
+
+// keyPoolProvider sends the requests with the API keys of the pool in rotation.
+type keyPoolProvider struct {
+	keys     []*poolKey
+	rotation string
+	cooldown time.Duration
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewKeyPoolProvider returns the llm provider rotating among the API keys of the `api_keys` of the config, the
+// provider of every key is built by the config whose `api_key` is the key. The provider is built from the config
+// as it is if there is no `api_keys`. The build returns nil if the provider is unknown.
+func NewKeyPoolProvider(conf Provider, build func(Provider) LLMProvider) LLMProvider {
+	var keys []string
+	for _, key := range strings.Split(conf["api_keys"], ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return build(conf)
+	}
+
+	p := &keyPoolProvider{rotation: KeyRotationRoundRobin, cooldown: DefaultKeyCooldown}
+	switch rotation := conf["key_rotation"]; rotation {
+	case "", KeyRotationRoundRobin:
+	case KeyRotationLeastErrors:
+		p.rotation = rotation
+	default:
+		ylog.Warn("invalid key_rotation of the provider, use round_robin", "key_rotation", rotation)
+	}
+	if cooldown := conf["key_cooldown"]; cooldown != "" {
+		d, err := time.ParseDuration(cooldown)
+		if err != nil || d < 0 {
+			ylog.Warn("invalid key_cooldown of the provider, use the default", "key_cooldown", cooldown)
+		} else {
+			p.cooldown = d
+		}
+	}
+
+	for _, key := range keys {
+		keyConf := maps.Clone(conf)
+		keyConf["api_key"] = key
+		delete(keyConf, "api_keys")
+		delete(keyConf, "key_rotation")
+		delete(keyConf, "key_cooldown")
+
+		provider := build(keyConf)
+		if provider == nil {
+			return nil
+		}
+		p.keys = append(p.keys, &poolKey{key: key, provider: provider})
+	}
+	ylog.Debug("new key pool of llm provider", "provider", p.Name(), "keys", len(p.keys), "key_rotation", p.rotation, "key_cooldown", p.cooldown)
+	return p
+}
+
+// pick returns the key of the next request, the keys cooling down are skipped. If all the keys are cooling
+// down, the key whose cooldown ends first is used.
+func (p *keyPoolProvider) pick() *poolKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		now    = time.Now()
+		n      = len(p.keys)
+		picked = -1
+	)
+	for i := 0; i < n; i++ {
+		index := (p.next + i) % n
+		k := p.keys[index]
+		if k.cooldownUntil.After(now) {
+			continue
+		}
+		if picked == -1 || k.consecutiveErrors < p.keys[picked].consecutiveErrors {
+			picked = index
+		}
+		if p.rotation == KeyRotationRoundRobin {
+			break
+		}
+	}
+	if picked == -1 {
+		for index, k := range p.keys {
+			if picked == -1 || k.cooldownUntil.Before(p.keys[picked].cooldownUntil) {
+				picked = index
+			}
+		}
+	}
+	p.next = (picked + 1) % n
+
+	k := p.keys[picked]
+	k.requests++
+	return k
+}
+
+// done tracks the health of the key by the result of its request. The key returning 429 cools down, so does the
+// key returning 401 or 403, which is revoked or not allowed, to keep it from failing its turns of the rotation.
+func (p *keyPoolProvider) done(k *poolKey, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		k.consecutiveErrors = 0
+		return
+	}
+	k.errors++
+	k.consecutiveErrors++
+	if p.cooldown <= 0 {
+		return
+	}
+	switch {
+	case isRateLimited(err):
+		k.cooldownUntil = time.Now().Add(p.cooldown)
+		ylog.Warn("the api key of llm provider is rate limited, cool it down", "provider", p.Name(), "key", redactKey(k.key), "cooldown", p.cooldown)
+	case isKeyRejected(err):
+		k.cooldownUntil = time.Now().Add(p.cooldown)
+		ylog.Warn("the api key of llm provider is rejected, cool it down", "provider", p.Name(), "key", redactKey(k.key), "cooldown", p.cooldown, "err", err)
+	}
+}
+
+// isKeyRejected reports whether the llm provider rejects the API key with 401 or 403.
+func isKeyRejected(err error) bool {
+	code := providerStatusCode(err)
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// Health returns the health of the keys of the pool.
+func (p *keyPoolProvider) Health() []KeyHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	health := make([]KeyHealth, 0, len(p.keys))
+	for _, k := range p.keys {
+		h := KeyHealth{
+			Key:               redactKey(k.key),
+			Requests:          k.requests,
+			Errors:            k.errors,
+			ConsecutiveErrors: k.consecutiveErrors,
+		}
+		if k.cooldownUntil.After(now) {
+			until := k.cooldownUntil
+			h.CooldownUntil = &until
+		}
+		health = append(health, h)
+	}
+	return health
+}
+
+// GetProviderKeys returns the health of the API keys of the llm provider, ok is false if the provider has no key pool.
+func GetProviderKeys(provider LLMProvider) (keys []KeyHealth, ok bool) {
+	if p, isEmulated := provider.(*toolEmulationProvider); isEmulated {
+		provider = p.LLMProvider
+	}
+	if p, isSecret := provider.(*secretProvider); isSecret {
+		provider = p.current()
+	}
+	pool, ok := provider.(*keyPoolProvider)
+	if !ok {
+		return nil, false
+	}
+	return pool.Health(), true
+}
+
+// redactKey keeps the last 4 characters of the API key.
+func redactKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
+
+// Name returns the name of the llm provider.
+func (p *keyPoolProvider) Name() string { return p.keys[0].provider.Name() }
+
+// GetChatCompletions implements LLMProvider.
+func (p *keyPoolProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	k := p.pick()
+	resp, err := k.provider.GetChatCompletions(ctx, req, md)
+	p.done(k, err)
+	return resp, err
+}
+
+// GetChatCompletionsStream implements LLMProvider.
+func (p *keyPoolProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	k := p.pick()
+	recver, err := k.provider.GetChatCompletionsStream(ctx, req, md)
+	p.done(k, err)
+	return recver, err
+}
+
+// GetEmbeddings implements LLMProvider.
+func (p *keyPoolProvider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, md metadata.M) (openai.EmbeddingResponse, error) {
+	k := p.pick()
+	resp, err := k.provider.GetEmbeddings(ctx, req, md)
+	p.done(k, err)
+	return resp, err
+}
@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+// keyProvider is the provider built with an API key, the keys in limited return 429 and the keys in revoked return 401.
+type keyProvider struct {
+	MockLLMProvider
+	key     string
+	limited map[string]bool
+	revoked map[string]bool
+}
+
+func (p *keyProvider) GetChatCompletions(_ context.Context, _ openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	if p.limited[p.key] {
+		return openai.ChatCompletionResponse{}, &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests}
+	}
+	if p.revoked[p.key] {
+		return openai.ChatCompletionResponse{}, &openai.APIError{HTTPStatusCode: http.StatusUnauthorized}
+	}
+	return openai.ChatCompletionResponse{ID: p.key}, nil
+}
+
+func TestKeyPoolProvider(t *testing.T) {
+	limited, revoked := map[string]bool{}, map[string]bool{}
+	build := func(conf Provider) LLMProvider {
+		return &keyProvider{MockLLMProvider: MockLLMProvider{name: "openai"}, key: conf["api_key"], limited: limited, revoked: revoked}
+	}
+	keys := func(p LLMProvider, n int) []string {
+		var used []string
+		for i := 0; i < n; i++ {
+			resp, _ := p.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, nil)
+			used = append(used, resp.ID)
+		}
+		return used
+	}
+
+	t.Run("no api_keys", func(t *testing.T) {
+		p := NewKeyPoolProvider(Provider{"api_key": "sk-single"}, build)
+		assert.IsType(t, &keyProvider{}, p)
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		p := NewKeyPoolProvider(Provider{"api_keys": "sk-aaaa1111, sk-bbbb2222,sk-cccc3333"}, build)
+		assert.Equal(t, "openai", p.Name())
+		assert.Equal(t, []string{"sk-aaaa1111", "sk-bbbb2222", "sk-cccc3333", "sk-aaaa1111"}, keys(p, 4))
+	})
+
+	t.Run("the rate limited key cools down", func(t *testing.T) {
+		limited["sk-bbbb2222"] = true
+		defer delete(limited, "sk-bbbb2222")
+
+		p := NewKeyPoolProvider(Provider{"api_keys": "sk-aaaa1111,sk-bbbb2222,sk-cccc3333", "key_cooldown": "1h"}, build)
+		assert.Equal(t, []string{"sk-aaaa1111", "", "sk-cccc3333", "sk-aaaa1111", "sk-cccc3333"}, keys(p, 5))
+
+		health, ok := GetProviderKeys(p)
+		assert.True(t, ok)
+		assert.Equal(t, "****2222", health[1].Key)
+		assert.Equal(t, int64(1), health[1].Errors)
+		assert.NotNil(t, health[1].CooldownUntil)
+		assert.True(t, health[1].CooldownUntil.After(time.Now()))
+		assert.Nil(t, health[0].CooldownUntil)
+		assert.Equal(t, int64(2), health[0].Requests)
+	})
+
+	t.Run("the revoked key cools down", func(t *testing.T) {
+		revoked["sk-bbbb2222"] = true
+		defer delete(revoked, "sk-bbbb2222")
+
+		p := NewKeyPoolProvider(Provider{"api_keys": "sk-aaaa1111,sk-bbbb2222,sk-cccc3333"}, build)
+		assert.Equal(t, []string{"sk-aaaa1111", "", "sk-cccc3333", "sk-aaaa1111", "sk-cccc3333", "sk-aaaa1111"}, keys(p, 6))
+
+		health, _ := GetProviderKeys(p)
+		assert.Equal(t, int64(1), health[1].Requests)
+		assert.NotNil(t, health[1].CooldownUntil)
+	})
+
+	t.Run("least errors", func(t *testing.T) {
+		limited["sk-aaaa1111"] = true
+		defer delete(limited, "sk-aaaa1111")
+
+		// the errors are not rate limits if the keys don't cool down.
+		p := NewKeyPoolProvider(Provider{"api_keys": "sk-aaaa1111,sk-bbbb2222", "key_rotation": "least_errors", "key_cooldown": "0s"}, build)
+		assert.Equal(t, []string{"", "sk-bbbb2222", "sk-bbbb2222", "sk-bbbb2222"}, keys(p, 4))
+	})
+
+	t.Run("all the keys cool down", func(t *testing.T) {
+		limited["sk-aaaa1111"], limited["sk-bbbb2222"] = true, true
+		defer delete(limited, "sk-aaaa1111")
+		defer delete(limited, "sk-bbbb2222")
+
+		p := NewKeyPoolProvider(Provider{"api_keys": "sk-aaaa1111,sk-bbbb2222"}, build)
+		keys(p, 3)
+		health, _ := GetProviderKeys(p)
+		// the key whose cooldown ends first is used.
+		assert.Equal(t, int64(2), health[0].Requests)
+		assert.Equal(t, int64(1), health[1].Requests)
+	})
+}
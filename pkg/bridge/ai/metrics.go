@@ -0,0 +1,227 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// llmMetrics are the OpenTelemetry instruments of the llm bridge.
+type llmMetrics struct {
+	// completions is the number of the chat completions requested to the llm provider.
+	completions metric.Int64Counter
+	// completionDuration is the duration of the chat completions, it ends at the last chunk for streams.
+	completionDuration metric.Float64Histogram
+	// ttft is the time to the first token of the stream chat completions.
+	ttft metric.Float64Histogram
+	// tbt is the time between the tokens of the stream chat completions.
+	tbt metric.Float64Histogram
+	// toolCallDuration is the duration of the tool calls, including the retries.
+	toolCallDuration metric.Float64Histogram
+	// argumentRepairs is the number of the repairs of the malformed tool call arguments.
+	argumentRepairs metric.Int64Counter
+	// tokens is the number of the tokens used by the chat completions, the type attribute is prompt or completion.
+	tokens metric.Int64Counter
+}
+
+// newLLMMetrics creates the instruments from the global MeterProvider, so the global MeterProvider
+// should be set before the service is created.
+func newLLMMetrics() *llmMetrics {
+	meter := otel.Meter("github.com/yomorun/yomo/pkg/bridge/ai")
+
+	completions, err := meter.Int64Counter(
+		"yomo.llm.completions",
+		metric.WithDescription("The number of the chat completions requested to the llm provider."),
+		metric.WithUnit("{completion}"),
+	)
+	otel.Handle(err)
+	completionDuration, err := meter.Float64Histogram(
+		"yomo.llm.completion.duration",
+		metric.WithDescription("The duration of the chat completions."),
+		metric.WithUnit("s"),
+	)
+	otel.Handle(err)
+	ttft, err := meter.Float64Histogram(
+		"yomo.llm.time_to_first_token",
+		metric.WithDescription("The time to the first token of the stream chat completions."),
+		metric.WithUnit("s"),
+	)
+	otel.Handle(err)
+	tbt, err := meter.Float64Histogram(
+		"yomo.llm.time_between_tokens",
+		metric.WithDescription("The time between the tokens of the stream chat completions."),
+		metric.WithUnit("s"),
+	)
+	otel.Handle(err)
+	toolCallDuration, err := meter.Float64Histogram(
+		"yomo.llm.tool_call.duration",
+		metric.WithDescription("The duration of the tool calls, including the retries."),
+		metric.WithUnit("s"),
+	)
+	otel.Handle(err)
+	argumentRepairs, err := meter.Int64Counter(
+		"yomo.llm.tool_call.argument_repairs",
+		metric.WithDescription("The number of the repairs of the malformed tool call arguments, by the result: local, provider or failed."),
+		metric.WithUnit("{repair}"),
+	)
+	otel.Handle(err)
+	tokens, err := meter.Int64Counter(
+		"yomo.llm.tokens",
+		metric.WithDescription("The number of the tokens used by the chat completions, by the type: prompt or completion."),
+		metric.WithUnit("{token}"),
+	)
+	otel.Handle(err)
+
+	return &llmMetrics{
+		completions:        completions,
+		completionDuration: completionDuration,
+		ttft:               ttft,
+		tbt:                tbt,
+		toolCallDuration:   toolCallDuration,
+		argumentRepairs:    argumentRepairs,
+		tokens:             tokens,
+	}
+}
+
+// recordCompletion records the chat completion started at start, err is the error of the completion.
+func (m *llmMetrics) recordCompletion(ctx context.Context, attrs []attribute.KeyValue, start time.Time, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	opt := metric.WithAttributes(append(attrs, attribute.String("status", status))...)
+	m.completions.Add(ctx, 1, opt)
+	m.completionDuration.Record(ctx, time.Since(start).Seconds(), opt)
+}
+
+// recordUsage records the tokens used by the chat completion.
+func (m *llmMetrics) recordUsage(ctx context.Context, attrs []attribute.KeyValue, usage openai.Usage) {
+	m.tokens.Add(ctx, int64(usage.PromptTokens), metric.WithAttributes(append(attrs, attribute.String("type", "prompt"))...))
+	m.tokens.Add(ctx, int64(usage.CompletionTokens), metric.WithAttributes(append(attrs, attribute.String("type", "completion"))...))
+}
+
+// recordToolCall records the tool call started at start, the status is ok, error or the error code of the result.
+func (m *llmMetrics) recordToolCall(function string, start time.Time, status string) {
+	m.toolCallDuration.Record(context.Background(), time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("function", function),
+		attribute.String("status", status),
+	))
+}
+
+// recordArgumentRepair records the repair of the arguments of the function, the result is local, provider or failed.
+func (m *llmMetrics) recordArgumentRepair(ctx context.Context, function string, result string) {
+	m.argumentRepairs.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("function", function),
+		attribute.String("result", result),
+	))
+}
+
+// meteredProvider records the metrics of the chat completions of the llm provider, and logs the slow calls.
+type meteredProvider struct {
+	LLMProvider
+	metrics    *llmMetrics
+	credential string
+}
+
+func (p *meteredProvider) attrs(req openai.ChatCompletionRequest) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("provider", modelProviderName(p.Name(), req.Model)),
+		attribute.String("model", req.Model),
+		attribute.Bool("stream", req.Stream),
+	}
+}
+
+// done records the chat completion started at start, it ends at the last chunk for streams.
+func (p *meteredProvider) done(ctx context.Context, req openai.ChatCompletionRequest, start time.Time, err error) {
+	p.metrics.recordCompletion(ctx, p.attrs(req), start, err)
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	logSlowCall(
+		"slow llm provider call", time.Since(start), p.credential,
+		"provider", modelProviderName(p.Name(), req.Model),
+		"model", req.Model,
+		"stream", req.Stream,
+		"messages", len(req.Messages),
+		"tools", len(req.Tools),
+		"status", status,
+		"transID", FromTransIDContext(ctx),
+	)
+}
+
+func (p *meteredProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	start := time.Now()
+	resp, err := p.LLMProvider.GetChatCompletions(ctx, req, md)
+	p.done(ctx, req, start, err)
+	if err == nil {
+		p.metrics.recordUsage(ctx, p.attrs(req), resp.Usage)
+	}
+	return resp, err
+}
+
+func (p *meteredProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	start := time.Now()
+	recver, err := p.LLMProvider.GetChatCompletionsStream(ctx, req, md)
+	if err != nil {
+		p.done(ctx, req, start, err)
+		return nil, err
+	}
+	return &meteredRecver{
+		ResponseRecver: recver,
+		ctx:            ctx,
+		provider:       p,
+		req:            req,
+		attrs:          p.attrs(req),
+		start:          start,
+	}, nil
+}
+
+// meteredRecver records the time to the first token, the time between the tokens, and the completion
+// when the stream ends.
+type meteredRecver struct {
+	ResponseRecver
+	ctx      context.Context
+	provider *meteredProvider
+	req      openai.ChatCompletionRequest
+	attrs    []attribute.KeyValue
+	start    time.Time
+	last     time.Time
+	done     bool
+}
+
+func (r *meteredRecver) Recv() (openai.ChatCompletionStreamResponse, error) {
+	resp, err := r.ResponseRecver.Recv()
+	if r.done {
+		return resp, err
+	}
+	if err != nil {
+		r.done = true
+		if errors.Is(err, io.EOF) {
+			r.provider.done(r.ctx, r.req, r.start, nil)
+		} else {
+			r.provider.done(r.ctx, r.req, r.start, err)
+		}
+		return resp, err
+	}
+	if resp.Usage != nil {
+		r.provider.metrics.recordUsage(r.ctx, r.attrs, *resp.Usage)
+	}
+	now := time.Now()
+	opt := metric.WithAttributes(r.attrs...)
+	if r.last.IsZero() {
+		r.provider.metrics.ttft.Record(r.ctx, now.Sub(r.start).Seconds(), opt)
+	} else {
+		r.provider.metrics.tbt.Record(r.ctx, now.Sub(r.last).Seconds(), opt)
+	}
+	r.last = now
+	return resp, err
+}
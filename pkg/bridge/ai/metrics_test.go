@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	"go.opentelemetry.io/otel"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+type streamProvider struct {
+	MockLLMProvider
+	chunks int
+}
+
+func (p *streamProvider) GetChatCompletionsStream(_ context.Context, _ openai.ChatCompletionRequest, _ metadata.M) (ResponseRecver, error) {
+	return &chunkRecver{chunks: p.chunks}, nil
+}
+
+type chunkRecver struct {
+	chunks int
+}
+
+func (r *chunkRecver) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if r.chunks == 0 {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+	r.chunks--
+	if r.chunks == 0 {
+		// the last chunk carries the usage as stream_options.include_usage requests.
+		return openai.ChatCompletionStreamResponse{Usage: &openai.Usage{PromptTokens: 5, CompletionTokens: 3}}, nil
+	}
+	return openai.ChatCompletionStreamResponse{}, nil
+}
+
+func TestMeteredProvider(t *testing.T) {
+	reader := metricsdk.NewManualReader()
+	mp := metricsdk.NewMeterProvider(metricsdk.WithReader(reader))
+	defer otel.SetMeterProvider(otel.GetMeterProvider())
+	otel.SetMeterProvider(mp)
+
+	provider := &meteredProvider{
+		LLMProvider: &streamProvider{MockLLMProvider: MockLLMProvider{name: "mock"}, chunks: 3},
+		metrics:     newLLMMetrics(),
+	}
+	ctx := context.Background()
+
+	_, err := provider.GetChatCompletions(ctx, openai.ChatCompletionRequest{Model: "gpt-4o"}, nil)
+	assert.NoError(t, err)
+
+	recver, err := provider.GetChatCompletionsStream(ctx, openai.ChatCompletionRequest{Model: "gpt-4o", Stream: true}, nil)
+	assert.NoError(t, err)
+	for {
+		if _, err := recver.Recv(); err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+	}
+
+	provider.metrics.recordToolCall("get-weather", time.Now(), "timeout")
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(ctx, &rm))
+
+	got := make(map[string]uint64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					got[m.Name] += uint64(dp.Value)
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					got[m.Name] += dp.Count
+				}
+			}
+		}
+	}
+	assert.Equal(t, map[string]uint64{
+		"yomo.llm.completions":         2,
+		"yomo.llm.completion.duration": 2,
+		"yomo.llm.time_to_first_token": 1,
+		"yomo.llm.time_between_tokens": 2,
+		"yomo.llm.tool_call.duration":  1,
+		"yomo.llm.tokens":              8,
+	}, got)
+}
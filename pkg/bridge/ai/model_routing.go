@@ -0,0 +1,116 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync/atomic"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+// modelRoute routes the requests of the models matching the pattern to the llm provider.
+type modelRoute struct {
+	pattern  string
+	provider string
+}
+
+// modelRoutes are the routes of the models sorted by the specificity of their patterns, the requests are
+// sent to the provider of the service if it is nil.
+var modelRoutes atomic.Pointer[[]modelRoute]
+
+// ConfigureModelRouting routes the requests to the llm providers by their models, the keys of the routing are
+// the patterns of the models, eg: "claude-*" or "gpt-4o", and the values are the names of the providers. The
+// longest pattern matching the model wins, the requests of the models without a route are sent to the provider
+// of the server.
+func ConfigureModelRouting(routing map[string]string) error {
+	if len(routing) == 0 {
+		modelRoutes.Store(nil)
+		return nil
+	}
+	routes := make([]modelRoute, 0, len(routing))
+	for pattern, provider := range routing {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("model routing %q: %w", pattern, err)
+		}
+		if GetProvider(provider) == nil {
+			return fmt.Errorf("model routing %q: %w: %s", pattern, ErrNotExistsProvider, provider)
+		}
+		routes = append(routes, modelRoute{pattern: pattern, provider: provider})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if len(routes[i].pattern) != len(routes[j].pattern) {
+			return len(routes[i].pattern) > len(routes[j].pattern)
+		}
+		return routes[i].pattern < routes[j].pattern
+	})
+	modelRoutes.Store(&routes)
+	return nil
+}
+
+// routeModel returns the name of the llm provider of the model, ok is false if no route matches the model.
+func routeModel(model string) (provider string, ok bool) {
+	routes := modelRoutes.Load()
+	if routes == nil {
+		return "", false
+	}
+	for _, route := range *routes {
+		if matched, _ := path.Match(route.pattern, model); matched {
+			return route.provider, true
+		}
+	}
+	return "", false
+}
+
+// modelProvider returns the registered llm provider which serves the model, the provider of the service is
+// returned if no route matches the model.
+func (s *Service) modelProvider(model string) LLMProvider {
+	name := s.LLMProvider.Name()
+	if routed, ok := routeModel(model); ok {
+		name = routed
+	}
+	if provider := GetProvider(name); provider != nil {
+		return provider
+	}
+	return s.LLMProvider
+}
+
+// modelProviderName returns the name of the llm provider which serves the model, it's name if no route matches.
+func modelProviderName(name string, model string) string {
+	if routed, ok := routeModel(model); ok {
+		return routed
+	}
+	return name
+}
+
+// modelRoutedProvider sends the requests to the llm providers routed by their models, the requests of the
+// models without a route are sent to the wrapped provider.
+type modelRoutedProvider struct {
+	LLMProvider
+}
+
+func (p *modelRoutedProvider) route(model string) LLMProvider {
+	if name, ok := routeModel(model); ok {
+		if provider := GetProvider(name); provider != nil {
+			return provider
+		}
+	}
+	return p.LLMProvider
+}
+
+// GetChatCompletions implements LLMProvider.
+func (p *modelRoutedProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	return p.route(req.Model).GetChatCompletions(ctx, req, md)
+}
+
+// GetChatCompletionsStream implements LLMProvider.
+func (p *modelRoutedProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	return p.route(req.Model).GetChatCompletionsStream(ctx, req, md)
+}
+
+// GetEmbeddings implements LLMProvider.
+func (p *modelRoutedProvider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, md metadata.M) (openai.EmbeddingResponse, error) {
+	return p.route(string(req.Model)).GetEmbeddings(ctx, req, md)
+}
@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+// routedProvider answers the chat completions by its name.
+type routedProvider struct {
+	MockLLMProvider
+}
+
+func (p *routedProvider) GetChatCompletions(_ context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	return openai.ChatCompletionResponse{Model: req.Model, SystemFingerprint: p.name}, nil
+}
+
+func TestModelRouting(t *testing.T) {
+	t.Cleanup(func() {
+		providers = sync.Map{}
+		defaultProvider = nil
+		modelRoutes.Store(nil)
+	})
+	fallback := &routedProvider{MockLLMProvider{name: "azopenai"}}
+	RegisterProvider(fallback)
+	RegisterProvider(&routedProvider{MockLLMProvider{name: "openai"}})
+	RegisterProvider(&routedProvider{MockLLMProvider{name: "compat"}})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		err := ConfigureModelRouting(map[string]string{"claude-*": "anthropic"})
+		assert.ErrorIs(t, err, ErrNotExistsProvider)
+		assert.EqualError(t, err, `model routing "claude-*": llm provider does not exist: anthropic`)
+	})
+
+	t.Run("bad pattern", func(t *testing.T) {
+		err := ConfigureModelRouting(map[string]string{"gpt-[": "openai"})
+		assert.EqualError(t, err, `model routing "gpt-[": syntax error in pattern`)
+	})
+
+	assert.NoError(t, ConfigureModelRouting(map[string]string{
+		"gpt-*":    "openai",
+		"gpt-4o-*": "compat",
+		"Qwen/*":   "compat",
+	}))
+	provider := &modelRoutedProvider{LLMProvider: fallback}
+
+	tests := []struct {
+		model    string
+		expected string
+	}{
+		{model: "gpt-4o", expected: "openai"},
+		{model: "gpt-4o-mini", expected: "compat"},
+		{model: "Qwen/Qwen2.5-7B-Instruct", expected: "compat"},
+		{model: "o1-mini", expected: "azopenai"},
+		{model: "", expected: "azopenai"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			resp, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{Model: tt.model}, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, resp.SystemFingerprint)
+
+			service := &Service{LLMProvider: provider}
+			assert.Equal(t, tt.expected, service.modelProvider(tt.model).Name())
+			assert.Equal(t, tt.expected, modelProviderName(provider.Name(), tt.model))
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		assert.NoError(t, ConfigureModelRouting(nil))
+		resp, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{Model: "gpt-4o"}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "azopenai", resp.SystemFingerprint)
+	})
+}
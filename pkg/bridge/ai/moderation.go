@@ -0,0 +1,224 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// ModerationProvider is implemented by the llm providers which serve the moderations.
+type ModerationProvider interface {
+	// GetModerations returns the moderation of the input.
+	GetModerations(ctx context.Context, req openai.ModerationRequest, md metadata.M) (openai.ModerationResponse, error)
+}
+
+// GetProviderModeration returns the moderations of the llm provider, ok is false if the provider doesn't serve them.
+func GetProviderModeration(provider LLMProvider) (moderation ModerationProvider, ok bool) {
+	provider = unwrapProvider(provider)
+	moderation, ok = provider.(ModerationProvider)
+	return moderation, ok
+}
+
+// Moderation is the configuration of moderating the messages of the users before the chat completion
+// requests are sent to the llm provider.
+type Moderation struct {
+	Provider string `yaml:"provider"` // Provider is the llm provider which moderates the messages, the provider of the service is used if not set
+	Model    string `yaml:"model"`    // Model is the moderation model, the default model of the provider is used if not set
+	Action   string `yaml:"action"`   // Action is reject or redact, the flagged requests are rejected if not set
+}
+
+const (
+	// ModerationReject rejects the requests with the flagged messages.
+	ModerationReject = "reject"
+	// ModerationRedact replaces the content of the flagged messages with RedactedContent.
+	ModerationRedact = "redact"
+)
+
+// RedactedContent is the content of the flagged messages redacted by the moderation.
+const RedactedContent = "[redacted by moderation]"
+
+// ErrModerationFlagged is returned when a message of the request is flagged by the moderation.
+var ErrModerationFlagged = errors.New("the request is flagged by the moderation")
+
+var errModerationNotSupported = errors.New("the llm provider doesn't serve the moderations")
+
+// moderation is the pre-flight moderation of the chat completions, it is disabled if it is nil.
+var moderation atomic.Pointer[Moderation]
+
+// ConfigureModeration moderates the messages of the users of the chat completions by the config.
+func ConfigureModeration(conf Moderation) {
+	if conf.Action != ModerationRedact {
+		conf.Action = ModerationReject
+	}
+	moderation.Store(&conf)
+}
+
+// moderationProvider returns the provider which moderates the requests of the service.
+func moderationProvider(service *Service) (ModerationProvider, error) {
+	name := service.LLMProvider.Name()
+	if conf := moderation.Load(); conf != nil && conf.Provider != "" {
+		name = conf.Provider
+	}
+	provider := GetProvider(name)
+	if provider == nil {
+		provider = service.LLMProvider
+	}
+	p, ok := GetProviderModeration(provider)
+	if !ok {
+		return nil, errModerationNotSupported
+	}
+	return p, nil
+}
+
+// moderate moderates the messages of the users of the request before it is sent to the llm provider, the
+// request with a flagged message is rejected, or the content of the flagged messages is redacted.
+func (s *Service) moderate(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error) {
+	conf := moderation.Load()
+	if conf == nil {
+		return req, nil
+	}
+	provider, err := moderationProvider(s)
+	if err != nil {
+		return req, err
+	}
+
+	// the messages are copied, the redaction doesn't change the messages of the caller.
+	messages := make([]openai.ChatCompletionMessage, len(req.Messages))
+	copy(messages, req.Messages)
+	for i, msg := range messages {
+		if msg.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		input := messageText(msg)
+		if input == "" {
+			continue
+		}
+		resp, err := provider.GetModerations(ctx, openai.ModerationRequest{Input: input, Model: conf.Model}, s.Metadata)
+		if err != nil {
+			return req, err
+		}
+		categories, flagged := flaggedCategories(resp)
+		if !flagged {
+			continue
+		}
+		if conf.Action == ModerationReject {
+			return req, fmt.Errorf("%w: %s", ErrModerationFlagged, strings.Join(categories, ", "))
+		}
+		ylog.Debug("redact the flagged message", "index", i, "categories", categories)
+		messages[i] = redactMessage(msg)
+	}
+	req.Messages = messages
+	return req, nil
+}
+
+// messageText returns the text of the message, the text parts of the multi content are joined by new lines.
+func messageText(msg openai.ChatCompletionMessage) string {
+	texts := []string{}
+	if msg.Content != "" {
+		texts = append(texts, msg.Content)
+	}
+	for _, part := range msg.MultiContent {
+		if part.Type == openai.ChatMessagePartTypeText && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func redactMessage(msg openai.ChatCompletionMessage) openai.ChatCompletionMessage {
+	if msg.Content != "" {
+		msg.Content = RedactedContent
+	}
+	if len(msg.MultiContent) > 0 {
+		parts := make([]openai.ChatMessagePart, 0, len(msg.MultiContent))
+		for _, part := range msg.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				part.Text = RedactedContent
+			}
+			parts = append(parts, part)
+		}
+		msg.MultiContent = parts
+	}
+	return msg
+}
+
+// flaggedCategories returns the sorted flagged categories of the moderation, flagged is true if any result is flagged.
+func flaggedCategories(resp openai.ModerationResponse) (categories []string, flagged bool) {
+	seen := map[string]bool{}
+	for _, result := range resp.Results {
+		if !result.Flagged {
+			continue
+		}
+		flagged = true
+
+		var m map[string]bool
+		buf, _ := json.Marshal(result.Categories)
+		_ = json.Unmarshal(buf, &m)
+		for category, ok := range m {
+			if ok && !seen[category] {
+				seen[category] = true
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return categories, flagged
+}
+
+// HandleModerations is the handler for POST /v1/moderations, the input is moderated by the llm provider of the
+// moderation config, or by the llm provider of the service.
+func HandleModerations(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		service = FromServiceContext(ctx)
+	)
+	defer r.Body.Close()
+	limitRequestBody(w, r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ylog.Error("read request", "err", err.Error())
+		RespondWithError(w, readBodyErrorCode(err), err)
+		return
+	}
+	var req openai.ModerationRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		ylog.Error("decode request", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Input == "" {
+		RespondWithError(w, http.StatusBadRequest, errEmptyInput)
+		return
+	}
+	provider, err := moderationProvider(service)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if conf := moderation.Load(); req.Model == "" && conf != nil {
+		req.Model = conf.Model
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+
+	resp, err := provider.GetModerations(ctx, req, service.Metadata)
+	if err != nil {
+		ylog.Error("invoke moderations", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	respondJSON(w, resp)
+}
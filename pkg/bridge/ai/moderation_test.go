@@ -0,0 +1,123 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+// moderationsProvider flags the inputs containing "kill".
+type moderationsProvider struct {
+	completionsProvider
+	inputs []string
+}
+
+func (p *moderationsProvider) GetModerations(_ context.Context, req openai.ModerationRequest, _ metadata.M) (openai.ModerationResponse, error) {
+	p.inputs = append(p.inputs, req.Input)
+	flagged := strings.Contains(req.Input, "kill")
+	return openai.ModerationResponse{
+		ID:    "modr-1",
+		Model: "text-moderation-latest",
+		Results: []openai.Result{{
+			Flagged:    flagged,
+			Categories: openai.ResultCategories{Violence: flagged, Harassment: flagged},
+		}},
+	}, nil
+}
+
+func TestModerate(t *testing.T) {
+	t.Cleanup(func() { moderation.Store(nil) })
+
+	req := openai.ChatCompletionRequest{
+		Model: "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "kill the process if it hangs"},
+			{Role: openai.ChatMessageRoleUser, Content: "hello"},
+			{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "I will kill you"},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/a.png"}},
+			}},
+		},
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		ConfigureModeration(Moderation{})
+
+		provider := &moderationsProvider{}
+		service := &Service{LLMProvider: provider, Metadata: metadata.M{}}
+		service.SetSystemPrompt("")
+
+		err := service.GetChatCompletions(context.Background(), req, "trans-1", httptest.NewRecorder(), false)
+		assert.ErrorIs(t, err, ErrModerationFlagged)
+		assert.Contains(t, err.Error(), "harassment, violence")
+		// the system messages are not moderated, and the request doesn't reach the llm provider.
+		assert.Equal(t, []string{"hello", "I will kill you"}, provider.inputs)
+		assert.Empty(t, provider.req.Messages)
+	})
+
+	t.Run("redact", func(t *testing.T) {
+		ConfigureModeration(Moderation{Action: ModerationRedact})
+
+		provider := &moderationsProvider{}
+		service := &Service{LLMProvider: provider, Metadata: metadata.M{}}
+		service.SetSystemPrompt("")
+
+		err := service.GetChatCompletions(context.Background(), req, "trans-1", httptest.NewRecorder(), false)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", provider.req.Messages[1].Content)
+		assert.Equal(t, RedactedContent, provider.req.Messages[2].MultiContent[0].Text)
+		assert.Equal(t, "https://example.com/a.png", provider.req.Messages[2].MultiContent[1].ImageURL.URL)
+		// the messages of the caller are not changed.
+		assert.Equal(t, "I will kill you", req.Messages[2].MultiContent[0].Text)
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		ConfigureModeration(Moderation{})
+
+		service := &Service{LLMProvider: &completionsProvider{}, Metadata: metadata.M{}}
+		service.SetSystemPrompt("")
+
+		err := service.GetChatCompletions(context.Background(), req, "trans-1", httptest.NewRecorder(), false)
+		assert.ErrorIs(t, err, errModerationNotSupported)
+	})
+}
+
+func TestHandleModerations(t *testing.T) {
+	t.Cleanup(func() { moderation.Store(nil) })
+	ConfigureModeration(Moderation{Model: "text-moderation-stable"})
+
+	provider := &moderationsProvider{}
+	service := &Service{LLMProvider: provider, Metadata: metadata.M{}}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "flagged", body: `{"input":"I will kill you"}`, code: http.StatusOK},
+		{name: "empty input", body: `{"input":""}`, code: http.StatusBadRequest},
+		{name: "bad request", body: `{`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/moderations", strings.NewReader(tt.body))
+			HandleModerations(w, r.WithContext(WithServiceContext(r.Context(), service)))
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.code != http.StatusOK {
+				return
+			}
+			var resp openai.ModerationResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.True(t, resp.Results[0].Flagged)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package ai
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// MaxInlineImageBytes is the max size of an image inlined by InlineImages.
+const MaxInlineImageBytes = 20 << 20
+
+// inlineImageClient fetches the images inlined by InlineImages.
+var inlineImageClient = &http.Client{Timeout: 30 * time.Second}
+
+var errInvalidContent = errors.New("content must be a string or an array of content parts")
+
+// contentPart is a content part of a message of the chat completions, the Responses API or the Assistants
+// API. The image_url is an object {url, detail} in the chat completions and the Assistants API, and it's a
+// string in the Responses API, where the detail is a sibling of it.
+type contentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text"`
+	ImageURL json.RawMessage `json:"image_url"`
+	Detail   string          `json:"detail"`
+}
+
+// parseContentParts parses the message content, which is a string or an array of the text and image parts,
+// onto the parts of the chat message.
+func parseContentParts(content json.RawMessage) ([]openai.ChatMessagePart, error) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return []openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: text}}, nil
+	}
+	var parts []contentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil, errInvalidContent
+	}
+	result := make([]openai.ChatMessagePart, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			result = append(result, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: part.Text})
+		case "input_image", "image_url":
+			image, err := parseImageURL(part)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeImageURL, ImageURL: image})
+		default:
+			return nil, fmt.Errorf("unsupported content type: %s", part.Type)
+		}
+	}
+	return result, nil
+}
+
+func parseImageURL(part contentPart) (*openai.ChatMessageImageURL, error) {
+	image := &openai.ChatMessageImageURL{Detail: openai.ImageURLDetail(part.Detail)}
+	if err := json.Unmarshal(part.ImageURL, &image.URL); err != nil {
+		if err := json.Unmarshal(part.ImageURL, image); err != nil {
+			return nil, errors.New("image_url must be a string or an object with url")
+		}
+	}
+	if err := validateImageURL(image.URL); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// validateImageURL accepts the http(s) urls and the base64 data urls of the images.
+func validateImageURL(url string) error {
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return nil
+	}
+	if mediaType, ok := strings.CutPrefix(url, "data:"); ok && strings.HasPrefix(mediaType, "image/") && strings.Contains(mediaType, ";base64,") {
+		return nil
+	}
+	return fmt.Errorf("image url must be an http(s) url or a base64 data url of an image: %.32s", url)
+}
+
+// contentMessage returns the chat message of the parts, the text parts are joined as the content if there is
+// no image, so the providers which only accept the text content keep working.
+func contentMessage(role string, parts []openai.ChatMessagePart) openai.ChatCompletionMessage {
+	msg := openai.ChatCompletionMessage{Role: role}
+	var sb strings.Builder
+	for _, part := range parts {
+		if part.Type != openai.ChatMessagePartTypeText {
+			msg.MultiContent = parts
+			return msg
+		}
+		sb.WriteString(part.Text)
+	}
+	msg.Content = sb.String()
+	return msg
+}
+
+// InlineImages replaces the http(s) urls of the image parts of the messages with the base64 data urls, it's
+// used by the llm providers which don't fetch the images by themselves. The messages of the request are
+// copied, the images are fetched with the context and each one is at most MaxInlineImageBytes.
+func InlineImages(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error) {
+	var (
+		messages []openai.ChatCompletionMessage
+		inlined  = map[string]string{}
+	)
+	for i, msg := range req.Messages {
+		var parts []openai.ChatMessagePart
+		for j, part := range msg.MultiContent {
+			if part.Type != openai.ChatMessagePartTypeImageURL || part.ImageURL == nil || strings.HasPrefix(part.ImageURL.URL, "data:") {
+				continue
+			}
+			if parts == nil {
+				parts = append([]openai.ChatMessagePart(nil), msg.MultiContent...)
+			}
+			url := part.ImageURL.URL
+			data, ok := inlined[url]
+			if !ok {
+				var err error
+				if data, err = fetchImage(ctx, url); err != nil {
+					return req, err
+				}
+				inlined[url] = data
+			}
+			parts[j].ImageURL = &openai.ChatMessageImageURL{URL: data, Detail: part.ImageURL.Detail}
+		}
+		if parts == nil {
+			continue
+		}
+		if messages == nil {
+			messages = append([]openai.ChatCompletionMessage(nil), req.Messages...)
+		}
+		messages[i].MultiContent = parts
+	}
+	if messages != nil {
+		req.Messages = messages
+	}
+	return req, nil
+}
+
+// fetchImage fetches the image and returns its base64 data url.
+func fetchImage(ctx context.Context, url string) (string, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := inlineImageClient.Do(r)
+	if err != nil {
+		return "", fmt.Errorf("fetch image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("fetch image %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxInlineImageBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("fetch image: %w", err)
+	}
+	if len(data) > MaxInlineImageBytes {
+		return "", fmt.Errorf("image %s exceeds %d bytes", url, MaxInlineImageBytes)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("%s is not an image: %s", url, mediaType)
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,142 @@
+package ai
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseContentParts(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		expected    openai.ChatCompletionMessage
+		expectedErr string
+	}{
+		{
+			name:     "string",
+			content:  `"hello"`,
+			expected: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "hello"},
+		},
+		{
+			name:     "text parts",
+			content:  `[{"type":"text","text":"hello "},{"type":"input_text","text":"world"}]`,
+			expected: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "hello world"},
+		},
+		{
+			name:    "image_url object",
+			content: `[{"type":"text","text":"what is it?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBO","detail":"high"}}]`,
+			expected: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+				{Type: openai.ChatMessagePartTypeText, Text: "what is it?"},
+				{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "data:image/png;base64,iVBO", Detail: openai.ImageURLDetailHigh}},
+			}},
+		},
+		{
+			name:        "image_url without url",
+			content:     `[{"type":"image_url","image_url":1}]`,
+			expectedErr: "image_url must be a string or an object with url",
+		},
+		{
+			name:        "data url of a text",
+			content:     `[{"type":"image_url","image_url":{"url":"data:text/plain;base64,aGk="}}]`,
+			expectedErr: "image url must be an http(s) url or a base64 data url of an image: data:text/plain;base64,aGk=",
+		},
+		{
+			name:        "invalid content",
+			content:     `{"text":"hello"}`,
+			expectedErr: "content must be a string or an array of content parts",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := parseContentParts([]byte(tt.content))
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, contentMessage(openai.ChatMessageRoleUser, parts))
+		})
+	}
+}
+
+func TestInlineImages(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/a.png":
+			// the content type is detected from the body.
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write(png)
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	image := func(url string) openai.ChatCompletionMessage {
+		return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+			{Type: openai.ChatMessagePartTypeText, Text: "what is it?"},
+			{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: url, Detail: openai.ImageURLDetailLow}},
+		}}
+	}
+
+	t.Run("inline", func(t *testing.T) {
+		req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+			image(server.URL + "/a.png"),
+			image(server.URL + "/a.png"),
+			image("data:image/jpeg;base64,/9j/"),
+		}}
+
+		inlined, err := InlineImages(context.Background(), req)
+		assert.NoError(t, err)
+
+		data := "data:image/png;base64," + base64.StdEncoding.EncodeToString(png)
+		assert.Equal(t, []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+			image(data),
+			image(data),
+			image("data:image/jpeg;base64,/9j/"),
+		}, inlined.Messages)
+		// the same image is fetched once, and the request is not modified.
+		assert.Equal(t, 1, requests)
+		assert.Equal(t, server.URL+"/a.png", req.Messages[1].MultiContent[1].ImageURL.URL)
+	})
+
+	t.Run("not an image", func(t *testing.T) {
+		req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{image(server.URL + "/page.html")}}
+		_, err := InlineImages(context.Background(), req)
+		assert.ErrorContains(t, err, "is not an image: text/html")
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		req := openai.ChatCompletionRequest{Messages: []openai.ChatCompletionMessage{image(server.URL + "/b.png")}}
+		_, err := InlineImages(context.Background(), req)
+		assert.ErrorContains(t, err, "404 Not Found")
+	})
+}
+
+func TestThreadMessageParts(t *testing.T) {
+	parts := []openai.ChatMessagePart{
+		{Type: openai.ChatMessagePartTypeText, Text: "what is it?"},
+		{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/a.png", Detail: openai.ImageURLDetailAuto}},
+	}
+
+	content := threadMessageParts(parts)
+	assert.Equal(t, []ThreadMessageContent{
+		{Type: "text", Text: &ThreadMessageText{Value: "what is it?", Annotations: []any{}}},
+		{Type: "image_url", ImageURL: &ThreadMessageImageURL{URL: "https://example.com/a.png", Detail: "auto"}},
+	}, content)
+	assert.Equal(t, parts, threadChatParts(content))
+}
@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/pkg/id"
+)
+
+// The `parallel_tool_calls` field of the chat completion request is true by default, the tool calls of a round
+// are dispatched to the sfns at once. If it is false, the tool calls are dispatched one by one in the order of
+// the model, every tool call is dispatched after the previous one is done, so the tools which depend on the
+// order behave deterministically. The flag is also sent to the llm providers which support it.
+
+// ParallelToolCaller is implemented by the llm providers which support the `parallel_tool_calls` parameter.
+type ParallelToolCaller interface {
+	// ParallelToolCalls reports whether the provider supports the `parallel_tool_calls` parameter.
+	ParallelToolCalls() bool
+}
+
+// GetProviderParallelToolCalls reports whether the llm provider supports the `parallel_tool_calls` parameter.
+func GetProviderParallelToolCalls(provider LLMProvider) bool {
+	provider = unwrapProvider(provider)
+	caller, ok := provider.(ParallelToolCaller)
+	return ok && caller.ParallelToolCalls()
+}
+
+// parallelToolCallsRequest is the `parallel_tool_calls` field of the chat completion request.
+type parallelToolCallsRequest struct {
+	ParallelToolCalls *bool `json:"parallel_tool_calls"`
+}
+
+// parseParallelToolCalls returns the `parallel_tool_calls` field of the chat completion request, it's true if
+// the request doesn't have it.
+func parseParallelToolCalls(body []byte) (bool, error) {
+	var req parallelToolCallsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return false, err
+	}
+	return req.ParallelToolCalls == nil || *req.ParallelToolCalls, nil
+}
+
+type sequentialToolCallsContextKey struct{}
+
+// withSequentialToolCalls marks the tool calls of the request to be dispatched one by one.
+func withSequentialToolCalls(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sequentialToolCallsContextKey{}, true)
+}
+
+// sequentialToolCalls reports whether the tool calls of the request are dispatched one by one.
+func sequentialToolCalls(ctx context.Context) bool {
+	sequential, _ := ctx.Value(sequentialToolCallsContextKey{}).(bool)
+	return sequential
+}
+
+// parallelToolCallsContext sends `parallel_tool_calls: false` to the llm provider by the extra body if the tool
+// calls of the request are dispatched one by one and the provider supports it. The providers reject the flag
+// in the requests without the tools, so the call after the last round doesn't send it.
+func (s *Service) parallelToolCallsContext(ctx context.Context, req openai.ChatCompletionRequest) context.Context {
+	if !sequentialToolCalls(ctx) || len(req.Tools) == 0 || !GetProviderParallelToolCalls(s.modelProvider(req.Model)) {
+		return ctx
+	}
+	extraBody := maps.Clone(FromExtraBodyContext(ctx))
+	if extraBody == nil {
+		extraBody = make(map[string]json.RawMessage, 1)
+	}
+	extraBody["parallel_tool_calls"] = json.RawMessage("false")
+	return WithExtraBodyContext(ctx, extraBody)
+}
+
+// runSequentialFunctionCalls runs the tool calls one by one in their order, every tool call is dispatched after
+// the previous one is done.
+func (s *Service) runSequentialFunctionCalls(ctx context.Context, toolCalls []openai.ToolCall, tagTools map[uint32]openai.Tool, base *ai.FunctionCall, onProgress func(ai.ToolProgress)) ([]ai.ToolMessage, error) {
+	var llmCalls []ai.ToolMessage
+	for _, call := range toolCalls {
+		fnCalls := matchToolCalls([]openai.ToolCall{call}, tagTools)
+		// the results are correlated by the reqID, every dispatch has its own.
+		callBase := *base
+		callBase.ReqID = id.New(16)
+		results, err := s.runFunctionCalls(ctx, fnCalls, &callBase, onProgress)
+		if err != nil {
+			return nil, err
+		}
+		llmCalls = append(llmCalls, results...)
+	}
+	return llmCalls, nil
+}
@@ -0,0 +1,160 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+func TestParseParallelToolCalls(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expected    bool
+		expectedErr bool
+	}{
+		{name: "default", body: `{"model":"gpt-4o"}`, expected: true},
+		{name: "true", body: `{"parallel_tool_calls":true}`, expected: true},
+		{name: "false", body: `{"parallel_tool_calls":false}`, expected: false},
+		{name: "not a boolean", body: `{"parallel_tool_calls":"no"}`, expectedErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parallel, err := parseParallelToolCalls([]byte(tt.body))
+			if tt.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, parallel)
+		})
+	}
+}
+
+// orderedSource records the functions of the dispatches, and answers the tool calls by the result.
+type orderedSource struct {
+	toolResultSource
+	mu         sync.Mutex
+	dispatches [][]string
+}
+
+func (s *orderedSource) WriteBatch(batch []yomo.TaggedData) error {
+	functions := make([]string, 0, len(batch))
+	for _, d := range batch {
+		var invoke ai.FunctionCall
+		if err := invoke.FromBytes(d.Data); err != nil {
+			return err
+		}
+		functions = append(functions, invoke.FunctionName)
+	}
+	s.mu.Lock()
+	s.dispatches = append(s.dispatches, functions)
+	s.mu.Unlock()
+	return s.toolResultSource.WriteBatch(batch)
+}
+
+func TestSequentialToolCalls(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0xB2, &openai.FunctionDefinition{Name: "get-weather"}, 2112, md))
+	assert.NoError(t, register.RegisterFunction(0xB3, &openai.FunctionDefinition{Name: "get-time"}, 2113, md))
+	defer register.UnregisterFunction(2112, md)
+	defer register.UnregisterFunction(2113, md)
+
+	service := &Service{
+		LLMProvider:  &MockLLMProvider{name: "sequential"},
+		Metadata:     md,
+		credential:   "token",
+		sfnCallCache: make(map[string]*sfnAsyncCall),
+		metrics:      newLLMMetrics(),
+	}
+	source := &orderedSource{toolResultSource: toolResultSource{service: service, result: "ok"}}
+	service.source = source
+
+	tagTools := map[uint32]openai.Tool{
+		0xB2: {Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get-weather"}},
+		0xB3: {Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get-time"}},
+	}
+	toolCalls := []openai.ToolCall{
+		{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get-time", Arguments: "{}"}},
+		{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get-weather", Arguments: "{}"}},
+		{ID: "call_3", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get-time", Arguments: "{}"}},
+	}
+
+	ctx := withSequentialToolCalls(context.Background())
+	llmCalls, err := service.callTools(ctx, toolCalls, tagTools, &ai.FunctionCall{TransID: "trans-1", ReqID: "req-1"}, nil, nil)
+	assert.NoError(t, err)
+
+	// every tool call is dispatched by itself in the order of the model.
+	assert.Equal(t, [][]string{{"get-time"}, {"get-weather"}, {"get-time"}}, source.dispatches)
+	assert.Equal(t, []ai.ToolMessage{
+		{Role: "tool", Content: "ok", ToolCallId: "call_1"},
+		{Role: "tool", Content: "ok", ToolCallId: "call_2"},
+		{Role: "tool", Content: "ok", ToolCallId: "call_3"},
+	}, llmCalls)
+}
+
+// parallelProvider supports the parallel_tool_calls parameter.
+type parallelProvider struct {
+	MockLLMProvider
+}
+
+func (p *parallelProvider) ParallelToolCalls() bool { return true }
+
+func TestParallelToolCallsContext(t *testing.T) {
+	tools := []openai.Tool{{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get-weather"}}}
+	extraBody := map[string]json.RawMessage{"top_k": json.RawMessage("5")}
+	sequential := withSequentialToolCalls(WithExtraBodyContext(context.Background(), extraBody))
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		provider LLMProvider
+		tools    []openai.Tool
+		expected map[string]json.RawMessage
+	}{
+		{
+			name:     "sequential",
+			ctx:      sequential,
+			provider: &parallelProvider{},
+			tools:    tools,
+			expected: map[string]json.RawMessage{"top_k": json.RawMessage("5"), "parallel_tool_calls": json.RawMessage("false")},
+		},
+		{
+			name:     "parallel",
+			ctx:      WithExtraBodyContext(context.Background(), extraBody),
+			provider: &parallelProvider{},
+			tools:    tools,
+			expected: extraBody,
+		},
+		{
+			name:     "no tools",
+			ctx:      sequential,
+			provider: &parallelProvider{},
+			expected: extraBody,
+		},
+		{
+			name:     "not supported by the provider",
+			ctx:      sequential,
+			provider: &MockLLMProvider{},
+			tools:    tools,
+			expected: extraBody,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &Service{LLMProvider: tt.provider}
+			ctx := service.parallelToolCallsContext(tt.ctx, openai.ChatCompletionRequest{Tools: tt.tools})
+			assert.Equal(t, tt.expected, FromExtraBodyContext(ctx))
+		})
+	}
+	// the extra body of the request is not modified.
+	assert.Len(t, extraBody, 1)
+}
@@ -0,0 +1,409 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yomorun/yomo/pkg/id"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// PromptAudit is the configuration of the audit log of the prompts and the responses of the llm requests, the
+// requests and the responses are written in full after the redaction rules are applied. The chat completions
+// served over gRPC are audited as well.
+// The configuration looks like:
+//
+//	prompt_audit:
+//		output: /var/log/yomo/prompts.log
+//		credentials: [9f86d081884c7d65]
+//		redact:
+//			- pattern: '[\w.+-]+@[\w-]+\.[\w.]+'
+//			  replacement: '[EMAIL]'
+//			- field: user
+type PromptAudit struct {
+	// Output is stdout, stderr or the file path to append the records to, the default is stdout.
+	Output string `yaml:"output"`
+	// Credentials are the hashes of the credentials audited, see GET /admin/services, all the credentials are
+	// audited if it is empty.
+	Credentials []string `yaml:"credentials"`
+	// Redact are the redaction rules applied to the requests and the responses in order.
+	Redact []RedactRule `yaml:"redact"`
+}
+
+// RedactRule is a redaction rule of the audit log, it redacts the text matching the pattern in the string values,
+// or the whole values of the JSON field.
+type RedactRule struct {
+	// Pattern is the regular expression of the text to redact.
+	Pattern string `yaml:"pattern"`
+	// Field is the name of the JSON field whose values are redacted, in any object of the request or the response.
+	Field string `yaml:"field"`
+	// Replacement replaces the redacted text, the default is [REDACTED].
+	Replacement string `yaml:"replacement"`
+}
+
+// PromptAuditRecord is a record of the audit log of the prompts and the responses.
+type PromptAuditRecord struct {
+	Time           time.Time `json:"time"`
+	TransID        string    `json:"trans_id"`
+	CredentialHash string    `json:"credential_hash"`
+	// Method is the HTTP method, or gRPC for the gRPC calls.
+	Method string `json:"method"`
+	// Path is the HTTP path, or the full method of the gRPC calls.
+	Path string `json:"path"`
+	// Status is the HTTP status code, or the gRPC status code of the gRPC calls.
+	Status     int   `json:"status"`
+	DurationMs int64 `json:"duration_ms"`
+	// Request is the redacted request body, it's the JSON value if the body is JSON, otherwise the text. The lines
+	// of the text which are not JSON are replaced if there are the field rules, as their fields can not be redacted.
+	Request any `json:"request"`
+	// Response is the redacted response body, the stream responses are the text of the events.
+	Response any `json:"response"`
+	// Truncated is true if the body exceeds promptAuditMaxBytes, the exceeded bytes are not recorded.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// promptAuditPaths are the paths of the llm requests which are audited.
+var promptAuditPaths = []string{"/invoke", "/v1/chat/completions", "/v1/completions", "/v1/responses"}
+
+// promptAuditMaxBytes is the max bytes of the request or the response body recorded.
+const promptAuditMaxBytes = 4 << 20
+
+// defaultRedactReplacement is the default replacement of the redacted text.
+const defaultRedactReplacement = "[REDACTED]"
+
+// NewPromptAuditHandler returns the handler which writes the audit record of every llm request of the audited
+// credentials after it is served. It must be inside of the service context, which tells the credential.
+func NewPromptAuditHandler(next http.Handler, conf PromptAudit) (http.Handler, error) {
+	a, err := openPromptAuditor(conf)
+	if err != nil {
+		return nil, err
+	}
+	return a.handler(next), nil
+}
+
+func newPromptAuditHandler(next http.Handler, conf PromptAudit, w io.Writer) (http.Handler, error) {
+	a, err := newPromptAuditor(conf, w)
+	if err != nil {
+		return nil, err
+	}
+	return a.handler(next), nil
+}
+
+// promptAuditor redacts and writes the records, the records are written one by one.
+type promptAuditor struct {
+	mu          sync.Mutex
+	w           io.Writer
+	credentials []string
+	redactor    *redactor
+}
+
+// openPromptAuditor returns the auditor which writes the records to the output of the config.
+func openPromptAuditor(conf PromptAudit) (*promptAuditor, error) {
+	w, err := accessLogOutput(conf.Output)
+	if err != nil {
+		return nil, err
+	}
+	return newPromptAuditor(conf, w)
+}
+
+func newPromptAuditor(conf PromptAudit, w io.Writer) (*promptAuditor, error) {
+	redactor, err := newRedactor(conf.Redact)
+	if err != nil {
+		return nil, err
+	}
+	return &promptAuditor{w: w, credentials: conf.Credentials, redactor: redactor}, nil
+}
+
+func (a *promptAuditor) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		service := FromServiceContext(r.Context())
+		if !slices.Contains(promptAuditPaths, r.URL.Path) || service == nil || !a.audited(service.credential) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		req := &limitedBuffer{}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, req), r.Body}
+		aw := &promptAuditWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+		a.log(r, service.credential, req, aw, start)
+	})
+}
+
+func (a *promptAuditor) audited(credential string) bool {
+	return len(a.credentials) == 0 || slices.Contains(a.credentials, credentialHash(credential))
+}
+
+func (a *promptAuditor) log(r *http.Request, credential string, req *limitedBuffer, aw *promptAuditWriter, start time.Time) {
+	a.write(PromptAuditRecord{
+		Time:           start,
+		TransID:        FromTransIDContext(r.Context()),
+		CredentialHash: credentialHash(credential),
+		Method:         r.Method,
+		Path:           r.URL.Path,
+		Status:         aw.statusCode(),
+		DurationMs:     time.Since(start).Milliseconds(),
+	}, req, &aw.body)
+}
+
+// write redacts the bodies of the request and the response of the record, and writes it.
+func (a *promptAuditor) write(record PromptAuditRecord, req, resp *limitedBuffer) {
+	record.Request = a.redactor.redactBody(req.buf.Bytes())
+	record.Response = a.redactor.redactBody(resp.buf.Bytes())
+	record.Truncated = req.truncated || resp.truncated
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, _ = a.w.Write(append(b, '\n'))
+}
+
+// redactor applies the redaction rules to the bodies.
+type redactor struct {
+	patterns []*regexp.Regexp
+	fields   map[string]string
+	// replacements are the replacements of the patterns
+	replacements []string
+}
+
+func newRedactor(rules []RedactRule) (*redactor, error) {
+	r := &redactor{fields: make(map[string]string)}
+	for _, rule := range rules {
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = defaultRedactReplacement
+		}
+		switch {
+		case rule.Field != "" && rule.Pattern != "":
+			return nil, errors.New("redact rule: only one of pattern and field can be set")
+		case rule.Field != "":
+			r.fields[rule.Field] = replacement
+		case rule.Pattern != "":
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redact rule: %w", err)
+			}
+			r.patterns = append(r.patterns, re)
+			r.replacements = append(r.replacements, replacement)
+		default:
+			return nil, errors.New("redact rule: pattern or field is required")
+		}
+	}
+	return r, nil
+}
+
+// grpcServerOptions returns the interceptors which write the audit records of the chat completions served over
+// gRPC for the service of the credential, it returns nil if the credential is not audited.
+func (a *promptAuditor) grpcServerOptions(credential string) []grpc.ServerOption {
+	if !a.audited(credential) {
+		return nil
+	}
+	record := func(transID, method string, start time.Time, err error) PromptAuditRecord {
+		return PromptAuditRecord{
+			Time:           start,
+			TransID:        transID,
+			CredentialHash: credentialHash(credential),
+			Method:         "gRPC",
+			Path:           method,
+			Status:         int(status.Code(err)),
+			DurationMs:     time.Since(start).Milliseconds(),
+		}
+	}
+
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start, transID := time.Now(), id.New(32)
+		resp, err := handler(WithTransIDContext(ctx, transID), req)
+
+		reqBody, respBody := &limitedBuffer{}, &limitedBuffer{}
+		_ = json.NewEncoder(reqBody).Encode(req)
+		if err == nil {
+			_ = json.NewEncoder(respBody).Encode(resp)
+		}
+		a.write(record(transID, info.FullMethod, start, err), reqBody, respBody)
+		return resp, err
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start, transID := time.Now(), id.New(32)
+		as := &promptAuditStream{ServerStream: ss, ctx: WithTransIDContext(ss.Context(), transID)}
+		err := handler(srv, as)
+		a.write(record(transID, info.FullMethod, start, err), &as.req, &as.resp)
+		return err
+	}
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary), grpc.ChainStreamInterceptor(stream)}
+}
+
+// promptAuditStream records the request and the chunks of the gRPC stream, the chunks are recorded as the
+// events of the server-sent events, so they are redacted as the HTTP streams.
+type promptAuditStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	req  limitedBuffer
+	resp limitedBuffer
+}
+
+func (s *promptAuditStream) Context() context.Context { return s.ctx }
+
+func (s *promptAuditStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return json.NewEncoder(&s.req).Encode(m)
+}
+
+func (s *promptAuditStream) SendMsg(m any) error {
+	if b, err := json.Marshal(m); err == nil {
+		fmt.Fprintf(&s.resp, "data: %s\n\n", b)
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// redactBody returns the redacted JSON value of the body, or the redacted text if the body is not JSON, eg: the
+// events of the streams, whose data are redacted as JSON. The lines which are not JSON, eg: a truncated body,
+// are replaced as a whole if there are the field rules, so the fields are never written unredacted.
+func (r *redactor) redactBody(body []byte) any {
+	if len(body) == 0 {
+		return nil
+	}
+	var v any
+	if json.Unmarshal(body, &v) == nil {
+		return r.redactValue(v)
+	}
+
+	lines := strings.Split(string(body), "\n")
+	for i, line := range lines {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || json.Unmarshal([]byte(data), &v) != nil {
+			lines[i] = r.redactLine(line)
+			continue
+		}
+		b, _ := json.Marshal(r.redactValue(v))
+		lines[i] = "data: " + string(b)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// redactLine redacts the line which is not JSON, it's replaced as a whole if there are the field rules, except
+// the lines framing the events.
+func (r *redactor) redactLine(line string) string {
+	if len(r.fields) == 0 || isEventFraming(line) {
+		return r.redactText(line)
+	}
+	return defaultRedactReplacement
+}
+
+// isEventFraming returns true if the line of the server-sent events carries no data of the llm, eg: the event
+// names and the end of the stream.
+func isEventFraming(line string) bool {
+	if line == "" || line == "data: [DONE]" || strings.HasPrefix(line, ":") {
+		return true
+	}
+	for _, field := range []string{"event:", "id:", "retry:"} {
+		if strings.HasPrefix(line, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			if replacement, ok := r.fields[k]; ok {
+				v[k] = replacement
+				continue
+			}
+			v[k] = r.redactValue(value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = r.redactValue(value)
+		}
+		return v
+	case string:
+		return r.redactText(v)
+	}
+	return v
+}
+
+func (r *redactor) redactText(text string) string {
+	for i, re := range r.patterns {
+		text = re.ReplaceAllLiteralString(text, r.replacements[i])
+	}
+	return text
+}
+
+// limitedBuffer buffers the bytes until promptAuditMaxBytes, the exceeded bytes are dropped.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := promptAuditMaxBytes - b.buf.Len(); len(p) > n {
+		b.buf.Write(p[:n])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// promptAuditWriter records the status and the body of the response.
+type promptAuditWriter struct {
+	http.ResponseWriter
+	status int
+	body   limitedBuffer
+}
+
+func (w *promptAuditWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *promptAuditWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the stream responses, the handlers assert the http.Flusher to write the events.
+func (w *promptAuditWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (w *promptAuditWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *promptAuditWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,214 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestPromptAudit(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), `"stream":true`) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, "data: {\"choices\":[{\"delta\":{\"content\":\"mail bob@example.com\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"choices":[{"message":{"content":"mail bob@example.com"}}]}`)
+	})
+	conf := PromptAudit{
+		Credentials: []string{credentialHash("audited")},
+		Redact: []RedactRule{
+			{Pattern: `[\w.+-]+@[\w-]+\.[\w.]+`, Replacement: "[EMAIL]"},
+			{Field: "user"},
+		},
+	}
+	var out bytes.Buffer
+	handler, err := newPromptAuditHandler(next, conf, &out)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name             string
+		credential       string
+		path             string
+		body             string
+		expectedRequest  any
+		expectedResponse any
+	}{
+		{
+			name:       "completion",
+			credential: "audited",
+			path:       "/v1/chat/completions",
+			body:       `{"user":"alice","messages":[{"role":"user","content":"I'm alice@example.com"}]}`,
+			expectedRequest: map[string]any{
+				"user":     "[REDACTED]",
+				"messages": []any{map[string]any{"role": "user", "content": "I'm [EMAIL]"}},
+			},
+			expectedResponse: map[string]any{
+				"choices": []any{map[string]any{"message": map[string]any{"content": "mail [EMAIL]"}}},
+			},
+		},
+		{
+			name:             "stream",
+			credential:       "audited",
+			path:             "/v1/chat/completions",
+			body:             `{"stream":true}`,
+			expectedRequest:  map[string]any{"stream": true},
+			expectedResponse: "data: {\"choices\":[{\"delta\":{\"content\":\"mail [EMAIL]\"}}]}\n\ndata: [DONE]\n\n",
+		},
+		{name: "not audited credential", credential: "other", path: "/v1/chat/completions", body: `{}`},
+		{name: "not llm request", credential: "audited", path: "/v1/models", body: `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out.Reset()
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			r = r.WithContext(WithServiceContext(WithTransIDContext(r.Context(), "trans-1"), &Service{credential: tt.credential}))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			// the client gets the response as it is.
+			assert.Contains(t, w.Body.String(), "bob@example.com")
+			if tt.expectedRequest == nil {
+				assert.Empty(t, out.String())
+				return
+			}
+
+			var record PromptAuditRecord
+			assert.NoError(t, json.Unmarshal(out.Bytes(), &record))
+			assert.Equal(t, "trans-1", record.TransID)
+			assert.Equal(t, credentialHash("audited"), record.CredentialHash)
+			assert.Equal(t, http.StatusOK, record.Status)
+			assert.Equal(t, tt.expectedRequest, record.Request)
+			assert.Equal(t, tt.expectedResponse, record.Response)
+		})
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	r, err := newRedactor([]RedactRule{{Field: "user"}, {Pattern: "secret", Replacement: "[SECRET]"}})
+	assert.NoError(t, err)
+
+	// the truncated body is not JSON, its fields can not be redacted.
+	assert.Equal(t, defaultRedactReplacement, r.redactBody([]byte(`{"user":"alice","messages":[{"content":"sec`)))
+	assert.Equal(t,
+		"event: progress\ndata: {\"user\":\"[REDACTED]\"}\n\n[REDACTED]\ndata: [DONE]\n",
+		r.redactBody([]byte("event: progress\ndata: {\"user\":\"alice\"}\n\ndata: {\"user\":\"al\ndata: [DONE]\n")),
+	)
+
+	// the text is redacted by the patterns if there are no field rules.
+	r, err = newRedactor([]RedactRule{{Pattern: "secret", Replacement: "[SECRET]"}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"user":"[SECRET]`, r.redactBody([]byte(`{"user":"secret`)))
+}
+
+func TestPromptAuditGRPC(t *testing.T) {
+	service := &Service{LLMProvider: &completionsProvider{}, Metadata: metadata.M{}, credential: "audited"}
+	service.SetSystemPrompt("")
+
+	var out bytes.Buffer
+	auditor, err := newPromptAuditor(PromptAudit{Redact: []RedactRule{{Pattern: "hello", Replacement: "[GREETING]"}}}, &out)
+	assert.NoError(t, err)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(append([]grpc.ServerOption{grpc.ForceServerCodec(GRPCCodec)}, auditor.grpcServerOptions("audited")...)...)
+	RegisterChatCompletionsServer(srv, NewChatCompletionsServer(service))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.NoError(t, err)
+	defer conn.Close()
+	client := NewChatCompletionsClient(conn)
+
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+	}
+	records := func() []PromptAuditRecord {
+		var records []PromptAuditRecord
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			var record PromptAuditRecord
+			assert.NoError(t, json.Unmarshal([]byte(line), &record))
+			records = append(records, record)
+		}
+		out.Reset()
+		return records
+	}
+
+	t.Run("unary", func(t *testing.T) {
+		_, err := client.ChatCompletion(context.Background(), req)
+		assert.NoError(t, err)
+
+		records := records()
+		assert.Len(t, records, 1)
+		assert.Equal(t, "gRPC", records[0].Method)
+		assert.Equal(t, "/"+ChatCompletionsServiceName+"/ChatCompletion", records[0].Path)
+		assert.Equal(t, credentialHash("audited"), records[0].CredentialHash)
+		assert.NotEmpty(t, records[0].TransID)
+		assert.Contains(t, mustMarshal(t, records[0].Request), "[GREETING]")
+		assert.NotContains(t, mustMarshal(t, records[0].Request), "hello")
+		assert.Contains(t, mustMarshal(t, records[0].Response), "chatcmpl-1")
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		recver, err := client.ChatCompletionStream(context.Background(), req)
+		assert.NoError(t, err)
+		for err == nil {
+			_, err = recver.Recv()
+		}
+		assert.ErrorIs(t, err, io.EOF)
+
+		records := records()
+		assert.Len(t, records, 1)
+		assert.Equal(t, "/"+ChatCompletionsServiceName+"/ChatCompletionStream", records[0].Path)
+		assert.Contains(t, records[0].Response, `"content":" wor"`)
+	})
+
+	t.Run("not audited credential", func(t *testing.T) {
+		auditor, err := newPromptAuditor(PromptAudit{Credentials: []string{credentialHash("other")}}, &out)
+		assert.NoError(t, err)
+		assert.Nil(t, auditor.grpcServerOptions("audited"))
+	})
+}
+
+func mustMarshal(t *testing.T, v any) string {
+	b, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestNewRedactor(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       []RedactRule
+		expectedErr string
+	}{
+		{name: "empty rule", rules: []RedactRule{{}}, expectedErr: "redact rule: pattern or field is required"},
+		{name: "both", rules: []RedactRule{{Pattern: "a", Field: "b"}}, expectedErr: "redact rule: only one of pattern and field can be set"},
+		{name: "bad pattern", rules: []RedactRule{{Pattern: "("}}, expectedErr: "redact rule: error parsing regexp: missing closing ): `(`"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newRedactor(tt.rules)
+			assert.EqualError(t, err, tt.expectedErr)
+		})
+	}
+}
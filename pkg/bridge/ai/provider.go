@@ -16,6 +16,8 @@ type LLMProvider interface {
 	GetChatCompletions(context.Context, openai.ChatCompletionRequest, metadata.M) (openai.ChatCompletionResponse, error)
 	// GetChatCompletionsStream returns the chat completions in stream.
 	GetChatCompletionsStream(context.Context, openai.ChatCompletionRequest, metadata.M) (ResponseRecver, error)
+	// GetEmbeddings returns the embeddings of the input.
+	GetEmbeddings(context.Context, openai.EmbeddingRequest, metadata.M) (openai.EmbeddingResponse, error)
 }
 
 // ResponseRecver receives stream response.
@@ -79,6 +81,21 @@ func GetProviderAndSetDefault(name string) (LLMProvider, error) {
 	return nil, ErrNotExistsProvider
 }
 
+// unwrapProvider returns the llm provider which serves the requests, the tool emulation, the secret provider and
+// the key pool are unwrapped, so the optional interfaces of the provider are found.
+func unwrapProvider(provider LLMProvider) LLMProvider {
+	if p, isEmulated := provider.(*toolEmulationProvider); isEmulated {
+		provider = p.LLMProvider
+	}
+	if p, isSecret := provider.(*secretProvider); isSecret {
+		provider = p.current()
+	}
+	if p, isPool := provider.(*keyPoolProvider); isPool {
+		provider = p.keys[0].provider
+	}
+	return provider
+}
+
 // GetDefaultProvider returns the default llm provider
 func GetDefaultProvider() (LLMProvider, error) {
 	mu.Lock()
@@ -58,10 +58,21 @@ func (p *Provider) Name() string {
 	return "azopenai"
 }
 
+// Models implements ai.ModelLister, the model is the azure deployment.
+func (p *Provider) Models() []string {
+	return []string{p.DeploymentID}
+}
+
+// ParallelToolCalls implements ai.ParallelToolCaller.
+func (p *Provider) ParallelToolCalls() bool {
+	return true
+}
+
 func newConfig(apiKey string, apiEndpoint string, deploymentID string, apiVersion string) openai.ClientConfig {
 	config := openai.DefaultAzureConfig(apiKey, apiEndpoint)
 	config.AzureModelMapperFunc = func(model string) string { return deploymentID }
 	config.APIVersion = apiVersion
+	config.HTTPClient = ai.NewExtraBodyHTTPClient()
 
 	return config
 }
@@ -75,3 +86,9 @@ func (p *Provider) GetChatCompletions(ctx context.Context, req openai.ChatComple
 func (p *Provider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (ai.ResponseRecver, error) {
 	return p.client.CreateChatCompletionStream(ctx, req)
 }
+
+// GetEmbeddings implements ai.LLMProvider, the embeddings are requested to the deployment of the provider,
+// so it must be an embedding model deployment.
+func (p *Provider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, _ metadata.M) (openai.EmbeddingResponse, error) {
+	return p.client.CreateEmbeddings(ctx, req)
+}
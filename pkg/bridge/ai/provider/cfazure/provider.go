@@ -56,6 +56,16 @@ func (p *Provider) Name() string {
 	return "cloudflare_azure"
 }
 
+// Models implements ai.ModelLister, the model is the azure deployment.
+func (p *Provider) Models() []string {
+	return []string{p.DeploymentID}
+}
+
+// ParallelToolCalls implements ai.ParallelToolCaller.
+func (p *Provider) ParallelToolCalls() bool {
+	return true
+}
+
 // GetChatCompletions implements ai.LLMProvider.
 func (p *Provider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
 	return p.client.CreateChatCompletion(ctx, req)
@@ -66,12 +76,19 @@ func (p *Provider) GetChatCompletionsStream(ctx context.Context, req openai.Chat
 	return p.client.CreateChatCompletionStream(ctx, req)
 }
 
+// GetEmbeddings implements ai.LLMProvider, the embeddings are requested to the deployment of the provider,
+// so it must be an embedding model deployment.
+func (p *Provider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, _ metadata.M) (openai.EmbeddingResponse, error) {
+	return p.client.CreateEmbeddings(ctx, req)
+}
+
 func newConfig(cfEndpoint string, apiKey string, resource string, deploymentID string, apiVersion string) openai.ClientConfig {
 	baseUrl := fmt.Sprintf("%s/azure-openai/%s/%s", cfEndpoint, resource, deploymentID)
 
 	config := openai.DefaultAzureConfig(apiKey, baseUrl)
 	config.APIType = openai.APITypeCloudflareAzure
 	config.APIVersion = apiVersion
+	config.HTTPClient = ai.NewExtraBodyHTTPClient()
 
 	return config
 }
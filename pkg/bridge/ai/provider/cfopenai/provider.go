@@ -55,6 +55,16 @@ func (p *Provider) Name() string {
 	return "cloudflare_openai"
 }
 
+// Models implements ai.ModelLister.
+func (p *Provider) Models() []string {
+	return []string{p.Model}
+}
+
+// ParallelToolCalls implements ai.ParallelToolCaller.
+func (p *Provider) ParallelToolCalls() bool {
+	return true
+}
+
 // GetChatCompletions implements ai.LLMProvider.
 func (p *Provider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
 	req.Model = p.Model
@@ -69,9 +79,16 @@ func (p *Provider) GetChatCompletionsStream(ctx context.Context, req openai.Chat
 	return p.client.CreateChatCompletionStream(ctx, req)
 }
 
+// GetEmbeddings implements ai.LLMProvider, the model of the request is used because the model of the
+// provider is a chat model.
+func (p *Provider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, _ metadata.M) (openai.EmbeddingResponse, error) {
+	return p.client.CreateEmbeddings(ctx, req)
+}
+
 func newConfig(apiKey, cfEndpoint string) openai.ClientConfig {
 	config := openai.DefaultConfig(apiKey)
 	config.BaseURL = fmt.Sprintf("%s/openai", cfEndpoint)
+	config.HTTPClient = ai.NewExtraBodyHTTPClient()
 
 	return config
 }
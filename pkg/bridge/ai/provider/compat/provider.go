@@ -0,0 +1,228 @@
+// Package compat is the llm provider of the OpenAI-compatible APIs, eg: vLLM, LM Studio and OpenRouter.
+package compat
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+	bridgeai "github.com/yomorun/yomo/pkg/bridge/ai"
+)
+
+// DefaultHealthInterval is the default interval of the health probes.
+const DefaultHealthInterval = 30 * time.Second
+
+// Provider is the provider for the OpenAI-compatible APIs, it probes the `/models` of the API periodically
+// to measure its health and latency.
+type Provider struct {
+	// BaseURL is the base url of the OpenAI-compatible API, eg: http://127.0.0.1:8000/v1
+	BaseURL string
+	// APIKey is the API key of the API, it can be empty for the local servers
+	APIKey string
+	// Model is the model to use
+	Model string
+	// HealthInterval is the interval of the health probes
+	HealthInterval time.Duration
+	// InlineImages is true if the images of the messages are sent as the base64 data urls, for the APIs
+	// which can't fetch the image urls
+	InlineImages bool
+
+	client     *openai.Client
+	httpClient *http.Client
+
+	mu     sync.RWMutex
+	health bridgeai.ProviderHealth
+}
+
+// check if implements ai.Provider
+var (
+	_ bridgeai.LLMProvider        = &Provider{}
+	_ bridgeai.HealthChecker      = &Provider{}
+	_ bridgeai.ModelLister        = &Provider{}
+	_ bridgeai.RealtimeProvider   = &Provider{}
+	_ bridgeai.ModerationProvider = &Provider{}
+	_ bridgeai.Pinger             = &Provider{}
+)
+
+// NewProvider creates a new OpenAI-compatible provider, the health of the API is probed every healthInterval
+// until ctx is done, the DefaultHealthInterval is used if healthInterval is empty. The images are inlined if
+// inlineImages is "true".
+func NewProvider(ctx context.Context, baseURL, apiKey, model, healthInterval, inlineImages string) *Provider {
+	interval := DefaultHealthInterval
+	if healthInterval != "" {
+		d, err := time.ParseDuration(healthInterval)
+		if err != nil || d <= 0 {
+			ylog.Warn("invalid health_interval of compat provider, use the default", "health_interval", healthInterval)
+		} else {
+			interval = d
+		}
+	}
+	inline := false
+	if inlineImages != "" {
+		b, err := strconv.ParseBool(inlineImages)
+		if err != nil {
+			ylog.Warn("invalid inline_images of compat provider, the images are not inlined", "inline_images", inlineImages)
+		}
+		inline = b
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	config := openai.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	config.HTTPClient = bridgeai.NewExtraBodyHTTPClient()
+
+	p := &Provider{
+		BaseURL:        baseURL,
+		APIKey:         apiKey,
+		Model:          model,
+		HealthInterval: interval,
+		InlineImages:   inline,
+		client:         openai.NewClientWithConfig(config),
+		httpClient:     &http.Client{Timeout: 10 * time.Second},
+	}
+	go p.probeEvery(ctx, interval)
+
+	ylog.Debug("new compat provider", "base_url", baseURL, "model", model, "health_interval", interval, "inline_images", inline)
+	return p
+}
+
+// Name returns the name of the provider
+func (p *Provider) Name() string {
+	return "compat"
+}
+
+// Models implements ai.ModelLister, no model is listed if the model is not configured, then the models of
+// the requests are used.
+func (p *Provider) Models() []string {
+	if p.Model == "" {
+		return nil
+	}
+	return []string{p.Model}
+}
+
+// GetChatCompletions implements ai.LLMProvider.
+func (p *Provider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	if p.Model != "" {
+		req.Model = p.Model
+	}
+	if p.InlineImages {
+		var err error
+		if req, err = bridgeai.InlineImages(ctx, req); err != nil {
+			return openai.ChatCompletionResponse{}, err
+		}
+	}
+	return p.client.CreateChatCompletion(ctx, req)
+}
+
+// GetChatCompletionsStream implements ai.LLMProvider.
+func (p *Provider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (bridgeai.ResponseRecver, error) {
+	if p.Model != "" {
+		req.Model = p.Model
+	}
+	if p.InlineImages {
+		var err error
+		if req, err = bridgeai.InlineImages(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	return p.client.CreateChatCompletionStream(ctx, req)
+}
+
+// GetEmbeddings implements ai.LLMProvider, the model of the request is used because the model of the
+// provider is a chat model.
+func (p *Provider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, _ metadata.M) (openai.EmbeddingResponse, error) {
+	return p.client.CreateEmbeddings(ctx, req)
+}
+
+// GetModerations implements ai.ModerationProvider.
+func (p *Provider) GetModerations(ctx context.Context, req openai.ModerationRequest, _ metadata.M) (openai.ModerationResponse, error) {
+	return p.client.Moderations(ctx, req)
+}
+
+// Ping implements ai.Pinger, it lists the models of the API as the periodic probes do.
+func (p *Provider) Ping(ctx context.Context) error {
+	return p.listModels(ctx)
+}
+
+// Realtime implements ai.RealtimeProvider, the websocket url is the base url with the ws scheme, eg:
+// ws://127.0.0.1:8000/v1/realtime?model=xxx.
+func (p *Provider) Realtime(model string) (string, http.Header) {
+	header := http.Header{}
+	if p.APIKey != "" {
+		header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	header.Set("OpenAI-Beta", "realtime=v1")
+	base := p.BaseURL
+	if rest, ok := strings.CutPrefix(base, "https://"); ok {
+		base = "wss://" + rest
+	} else if rest, ok := strings.CutPrefix(base, "http://"); ok {
+		base = "ws://" + rest
+	}
+	return base + "/realtime?model=" + url.QueryEscape(model), header
+}
+
+// Health implements ai.HealthChecker.
+func (p *Provider) Health() bridgeai.ProviderHealth {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.health
+}
+
+func (p *Provider) probeEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe lists the models of the API, the API is healthy if it responds 2xx.
+func (p *Provider) probe(ctx context.Context) {
+	health := bridgeai.ProviderHealth{CheckedAt: time.Now()}
+	err := p.listModels(ctx)
+	health.Latency = time.Since(health.CheckedAt)
+	if err != nil {
+		health.Error = err.Error()
+		ylog.Warn("compat provider is unhealthy", "base_url", p.BaseURL, "err", err)
+	} else {
+		health.Healthy = true
+	}
+
+	p.mu.Lock()
+	p.health = health
+	p.mu.Unlock()
+}
+
+func (p *Provider) listModels(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status of GET /models: %d", resp.StatusCode)
+	}
+	return nil
+}
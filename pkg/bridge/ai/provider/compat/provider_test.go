@@ -0,0 +1,105 @@
+package compat
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompatProvider_Name(t *testing.T) {
+	provider := &Provider{}
+
+	name := provider.Name()
+
+	assert.Equal(t, "compat", name)
+}
+
+func TestNewProvider(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("with parameters", func(t *testing.T) {
+		provider := NewProvider(ctx, "http://127.0.0.1:0/v1/", "test_api_key", "test_model", "1m", "true")
+
+		assert.Equal(t, "http://127.0.0.1:0/v1", provider.BaseURL)
+		assert.Equal(t, "test_api_key", provider.APIKey)
+		assert.Equal(t, "test_model", provider.Model)
+		assert.Equal(t, time.Minute, provider.HealthInterval)
+		assert.True(t, provider.InlineImages)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		provider := NewProvider(ctx, "http://127.0.0.1:0/v1", "", "", "often", "yes")
+
+		assert.Equal(t, DefaultHealthInterval, provider.HealthInterval)
+		assert.False(t, provider.InlineImages)
+	})
+}
+
+func TestCompatProvider(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test_api_key", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v1/models":
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"object":"list","data":[]}`))
+		case "/v1/chat/completions":
+			var req openai.ChatCompletionRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+				Model:   req.Model,
+				Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "hi"}}},
+			})
+		case "/v1/embeddings":
+			var req openai.EmbeddingRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(openai.EmbeddingResponse{
+				Model: req.Model,
+				Data:  []openai.Embedding{{Embedding: []float32{0.5}}},
+			})
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	provider := NewProvider(ctx, server.URL+"/v1", "test_api_key", "test_model", "20ms", "")
+
+	assert.Eventually(t, func() bool { return provider.Health().Healthy }, time.Second, 10*time.Millisecond)
+	assert.False(t, provider.Health().CheckedAt.IsZero())
+
+	resp, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "test_model", resp.Model)
+
+	// the embeddings keep the model of the request.
+	embeddings, err := provider.GetEmbeddings(context.Background(), openai.EmbeddingRequest{
+		Model: openai.SmallEmbedding3,
+		Input: "hello",
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, openai.SmallEmbedding3, embeddings.Model)
+	assert.Equal(t, []float32{0.5}, embeddings.Data[0].Embedding)
+
+	healthy.Store(false)
+	assert.Eventually(t, func() bool { return !provider.Health().Healthy }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "unexpected status of GET /models: 502", provider.Health().Error)
+}
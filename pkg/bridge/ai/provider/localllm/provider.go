@@ -0,0 +1,239 @@
+// Package localllm is the llm provider backed by llama.cpp, the model runs on the zipper host, so the edge
+// zippers can serve the llm function calling fully offline.
+package localllm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+	bridgeai "github.com/yomorun/yomo/pkg/bridge/ai"
+)
+
+// DefaultServerPath is the default llama.cpp server binary, it's looked up in the PATH.
+const DefaultServerPath = "llama-server"
+
+// healthInterval is the interval of probing the llama.cpp server until the model is loaded.
+const healthInterval = 500 * time.Millisecond
+
+// Provider is the provider for llama.cpp, it starts the llama.cpp server with the model, or uses the running
+// one at the endpoint, and calls its OpenAI-compatible chat completions API.
+type Provider struct {
+	// Endpoint is the endpoint of the llama.cpp server, eg: http://127.0.0.1:8080
+	Endpoint string
+	// ModelPath is the path of the gguf model file
+	ModelPath string
+	// ContextSize is the size of the prompt context, the default of the model is used if it is 0
+	ContextSize int
+	// GPULayers is the number of the model layers offloaded to the GPU
+	GPULayers int
+
+	client     *openai.Client
+	httpClient *http.Client
+	startErr   error
+	exited     chan struct{} // exited is closed when the started llama.cpp server exits
+	exitErr    error
+
+	readyMu sync.Mutex
+	ready   bool
+}
+
+// check if implements ai.Provider
+var _ bridgeai.LLMProvider = &Provider{}
+
+// NewProvider creates a new llama.cpp provider. If the endpoint is empty, the llama.cpp server at serverPath is
+// started with the model, the context size and the gpu layers, and it's stopped when ctx is done.
+func NewProvider(ctx context.Context, endpoint, modelPath, contextSize, gpuLayers, serverPath string) *Provider {
+	if modelPath == "" {
+		modelPath = os.Getenv("LOCALLLM_MODEL_PATH")
+	}
+	if serverPath == "" {
+		serverPath = DefaultServerPath
+	}
+	p := &Provider{
+		Endpoint:   endpoint,
+		ModelPath:  modelPath,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+	if err := p.parseSizes(contextSize, gpuLayers); err != nil {
+		p.startErr = err
+	} else if endpoint == "" {
+		p.startErr = p.startServer(ctx, serverPath)
+	}
+	if p.startErr != nil {
+		ylog.Error("start llama.cpp server", "model_path", modelPath, "err", p.startErr)
+	}
+
+	config := openai.DefaultConfig("")
+	config.BaseURL = p.Endpoint + "/v1"
+	config.HTTPClient = bridgeai.NewExtraBodyHTTPClient()
+	p.client = openai.NewClientWithConfig(config)
+
+	ylog.Debug("new llama.cpp provider", "endpoint", p.Endpoint, "model_path", modelPath, "context_size", p.ContextSize, "gpu_layers", p.GPULayers)
+	return p
+}
+
+func (p *Provider) parseSizes(contextSize, gpuLayers string) (err error) {
+	if contextSize != "" {
+		if p.ContextSize, err = strconv.Atoi(contextSize); err != nil {
+			return fmt.Errorf("invalid context_size: %s", contextSize)
+		}
+	}
+	if gpuLayers != "" {
+		if p.GPULayers, err = strconv.Atoi(gpuLayers); err != nil {
+			return fmt.Errorf("invalid gpu_layers: %s", gpuLayers)
+		}
+	}
+	return nil
+}
+
+// startServer starts the llama.cpp server on a free local port.
+func (p *Provider) startServer(ctx context.Context, serverPath string) error {
+	if p.ModelPath == "" {
+		return errors.New("model_path is required to start the llama.cpp server")
+	}
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	p.Endpoint = "http://127.0.0.1:" + strconv.Itoa(port)
+
+	cmd := exec.CommandContext(ctx, serverPath, p.serverArgs(port)...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.exited = make(chan struct{})
+	go func() {
+		p.exitErr = cmd.Wait()
+		close(p.exited)
+	}()
+	return nil
+}
+
+func (p *Provider) serverArgs(port int) []string {
+	args := []string{"--model", p.ModelPath, "--host", "127.0.0.1", "--port", strconv.Itoa(port)}
+	if p.ContextSize > 0 {
+		args = append(args, "--ctx-size", strconv.Itoa(p.ContextSize))
+	}
+	if p.GPULayers != 0 {
+		args = append(args, "--n-gpu-layers", strconv.Itoa(p.GPULayers))
+	}
+	return args
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Name returns the name of the provider
+func (p *Provider) Name() string {
+	return "localllm"
+}
+
+// Models implements ai.ModelLister.
+func (p *Provider) Models() []string {
+	return []string{p.model()}
+}
+
+// GetChatCompletions implements ai.LLMProvider.
+func (p *Provider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	if err := p.waitReady(ctx); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	req.Model = p.model()
+	// the llama.cpp server doesn't fetch the image urls.
+	req, err := bridgeai.InlineImages(ctx, req)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	return p.client.CreateChatCompletion(ctx, req)
+}
+
+// GetChatCompletionsStream implements ai.LLMProvider.
+func (p *Provider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (bridgeai.ResponseRecver, error) {
+	if err := p.waitReady(ctx); err != nil {
+		return nil, err
+	}
+	req.Model = p.model()
+	req, err := bridgeai.InlineImages(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.client.CreateChatCompletionStream(ctx, req)
+}
+
+// GetEmbeddings implements ai.LLMProvider, the embeddings are computed by the model of the llama.cpp server.
+func (p *Provider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, _ metadata.M) (openai.EmbeddingResponse, error) {
+	if err := p.waitReady(ctx); err != nil {
+		return openai.EmbeddingResponse{}, err
+	}
+	req.Model = openai.EmbeddingModel(p.model())
+
+	return p.client.CreateEmbeddings(ctx, req)
+}
+
+// model returns the name of the model, llama.cpp serves one model, the name is informational.
+func (p *Provider) model() string {
+	if p.ModelPath == "" {
+		return "localllm"
+	}
+	return filepath.Base(p.ModelPath)
+}
+
+// waitReady waits until the llama.cpp server loads the model, the server responds 503 to the health
+// probes while the model is loading.
+func (p *Provider) waitReady(ctx context.Context) error {
+	if p.startErr != nil {
+		return p.startErr
+	}
+	p.readyMu.Lock()
+	defer p.readyMu.Unlock()
+
+	for !p.ready {
+		p.ready = p.healthy(ctx)
+		if p.ready {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.exited:
+			return fmt.Errorf("llama.cpp server exited: %v", p.exitErr)
+		case <-time.After(healthInterval):
+		}
+	}
+	return nil
+}
+
+func (p *Provider) healthy(ctx context.Context) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Endpoint+"/health", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
@@ -0,0 +1,90 @@
+package localllm
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalLLMProvider_Name(t *testing.T) {
+	provider := &Provider{}
+
+	name := provider.Name()
+
+	assert.Equal(t, "localllm", name)
+}
+
+func TestNewProvider(t *testing.T) {
+	t.Run("invalid sizes", func(t *testing.T) {
+		provider := NewProvider(context.Background(), "http://127.0.0.1:8080", "/models/qwen.gguf", "8k", "", "")
+
+		_, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, nil)
+		assert.EqualError(t, err, "invalid context_size: 8k")
+	})
+
+	t.Run("model path is required", func(t *testing.T) {
+		provider := NewProvider(context.Background(), "", "", "", "", "")
+
+		_, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("server is not found", func(t *testing.T) {
+		provider := NewProvider(context.Background(), "", "/models/qwen.gguf", "", "", "/not/found/llama-server")
+
+		_, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestServerArgs(t *testing.T) {
+	provider := &Provider{ModelPath: "/models/qwen.gguf", ContextSize: 8192, GPULayers: 99}
+
+	args := provider.serverArgs(8080)
+
+	assert.Equal(t, []string{
+		"--model", "/models/qwen.gguf", "--host", "127.0.0.1", "--port", "8080", "--ctx-size", "8192", "--n-gpu-layers", "99",
+	}, args)
+}
+
+func TestLocalLLMProvider_GetChatCompletions(t *testing.T) {
+	var probes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			// the model is loaded after the second probe.
+			if probes.Add(1) < 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case "/v1/chat/completions":
+			var req openai.ChatCompletionRequest
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &req)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+				Model:   req.Model,
+				Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "hi"}}},
+			})
+		}
+	}))
+	defer server.Close()
+
+	provider := NewProvider(context.Background(), server.URL, "/models/qwen.gguf", "", "", "")
+
+	resp, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hello"}},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "qwen.gguf", resp.Model)
+	assert.Equal(t, "hi", resp.Choices[0].Message.Content)
+	assert.Equal(t, int32(2), probes.Load())
+}
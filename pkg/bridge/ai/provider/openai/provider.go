@@ -3,6 +3,8 @@ package openai
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 	"os"
 
 	// automatically load .env file
@@ -17,6 +19,9 @@ import (
 // APIEndpoint is the endpoint for OpenAI
 const APIEndpoint = "https://api.openai.com/v1/chat/completions"
 
+// RealtimeEndpoint is the websocket endpoint of the OpenAI Realtime API
+const RealtimeEndpoint = "wss://api.openai.com/v1/realtime"
+
 // Provider is the provider for OpenAI
 type Provider struct {
 	// APIKey is the API key for OpenAI
@@ -28,7 +33,13 @@ type Provider struct {
 }
 
 // check if implements ai.Provider
-var _ bridgeai.LLMProvider = &Provider{}
+var (
+	_ bridgeai.LLMProvider        = &Provider{}
+	_ bridgeai.RealtimeProvider   = &Provider{}
+	_ bridgeai.ModerationProvider = &Provider{}
+	_ bridgeai.Pinger             = &Provider{}
+	_ bridgeai.ParallelToolCaller = &Provider{}
+)
 
 // NewProvider creates a new OpenAIProvider
 func NewProvider(apiKey string, model string) *Provider {
@@ -40,10 +51,13 @@ func NewProvider(apiKey string, model string) *Provider {
 	}
 
 	ylog.Debug("new openai provider", "api_endpoint", APIEndpoint, "api_key", apiKey, "model", model)
+	config := openai.DefaultConfig(apiKey)
+	config.HTTPClient = bridgeai.NewExtraBodyHTTPClient()
+
 	return &Provider{
 		APIKey: apiKey,
 		Model:  model,
-		client: openai.NewClient(apiKey),
+		client: openai.NewClientWithConfig(config),
 	}
 }
 
@@ -52,6 +66,24 @@ func (p *Provider) Name() string {
 	return "openai"
 }
 
+// Models implements ai.ModelLister.
+func (p *Provider) Models() []string {
+	return []string{p.Model}
+}
+
+// ParallelToolCalls implements ai.ParallelToolCaller.
+func (p *Provider) ParallelToolCalls() bool {
+	return true
+}
+
+// Realtime implements ai.RealtimeProvider.
+func (p *Provider) Realtime(model string) (string, http.Header) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.APIKey)
+	header.Set("OpenAI-Beta", "realtime=v1")
+	return RealtimeEndpoint + "?model=" + url.QueryEscape(model), header
+}
+
 // GetChatCompletions implements ai.LLMProvider.
 func (p *Provider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
 	req.Model = p.Model
@@ -65,3 +97,20 @@ func (p *Provider) GetChatCompletionsStream(ctx context.Context, req openai.Chat
 
 	return p.client.CreateChatCompletionStream(ctx, req)
 }
+
+// GetEmbeddings implements ai.LLMProvider, the model of the request is used because the model of the
+// provider is a chat model.
+func (p *Provider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, _ metadata.M) (openai.EmbeddingResponse, error) {
+	return p.client.CreateEmbeddings(ctx, req)
+}
+
+// GetModerations implements ai.ModerationProvider.
+func (p *Provider) GetModerations(ctx context.Context, req openai.ModerationRequest, _ metadata.M) (openai.ModerationResponse, error) {
+	return p.client.Moderations(ctx, req)
+}
+
+// Ping implements ai.Pinger, it lists the models of the API.
+func (p *Provider) Ping(ctx context.Context) error {
+	_, err := p.client.ListModels(ctx)
+	return err
+}
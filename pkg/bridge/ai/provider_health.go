@@ -0,0 +1,90 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ProviderHealth is the health of the llm provider measured by the periodic probes.
+type ProviderHealth struct {
+	// Healthy is true if the last probe succeeded
+	Healthy bool `json:"healthy"`
+	// Latency is the latency of the last probe
+	Latency time.Duration `json:"latency"`
+	// CheckedAt is the time of the last probe, it's zero if the provider has not been probed
+	CheckedAt time.Time `json:"checked_at"`
+	// Error is the error of the last probe
+	Error string `json:"error,omitempty"`
+}
+
+// HealthChecker is implemented by the llm providers which probe their health periodically, the health
+// is the signal for choosing among the providers.
+type HealthChecker interface {
+	// Health returns the health measured by the last probe.
+	Health() ProviderHealth
+}
+
+// GetProviderHealth returns the health of the llm provider, ok is false if the provider doesn't check its health.
+func GetProviderHealth(provider LLMProvider) (health ProviderHealth, ok bool) {
+	provider = unwrapProvider(provider)
+	checker, ok := provider.(HealthChecker)
+	if !ok {
+		return ProviderHealth{}, false
+	}
+	return checker.Health(), true
+}
+
+// ProviderStatus is the status of a registered llm provider.
+type ProviderStatus struct {
+	// Name is the name of the llm provider
+	Name string `json:"name"`
+	// Default is true if the llm provider is the default one
+	Default bool `json:"default"`
+	// Health is the health of the llm provider, it's omitted if the provider doesn't check its health
+	Health *ProviderHealth `json:"health,omitempty"`
+	// Keys is the health of the API keys of the key pool, it's omitted if the provider has no key pool or the request
+	// is not authorized by the admin token
+	Keys []KeyHealth `json:"keys,omitempty"`
+	// Circuit is the state of the circuit of the llm provider, it's omitted if the circuit breaker is disabled
+	Circuit string `json:"circuit,omitempty"`
+}
+
+// HandleProviders is the handler for GET /providers, it returns the registered llm providers with their health
+// and the states of their circuits. The health of their API keys is returned only if the request carries the
+// admin token as the bearer token.
+func HandleProviders(w http.ResponseWriter, r *http.Request) {
+	_, err := authorizeAdmin(r)
+	withKeys := err == nil
+
+	names := ListProviders()
+	slices.Sort(names)
+
+	defaultName := ""
+	if p, err := GetDefaultProvider(); err == nil {
+		defaultName = p.Name()
+	}
+	statuses := make([]ProviderStatus, 0, len(names))
+	for _, name := range names {
+		provider := GetProvider(name)
+		if provider == nil {
+			continue
+		}
+		status := ProviderStatus{Name: name, Default: name == defaultName}
+		if health, ok := GetProviderHealth(provider); ok {
+			status.Health = &health
+		}
+		if keys, ok := GetProviderKeys(provider); ok && withKeys {
+			status.Keys = keys
+		}
+		if circuit, ok := GetProviderCircuit(name); ok {
+			status.Circuit = circuit
+		}
+		statuses = append(statuses, status)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string][]ProviderStatus{"providers": statuses})
+}
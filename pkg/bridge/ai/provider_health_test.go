@@ -0,0 +1,67 @@
+package ai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type healthProvider struct {
+	MockLLMProvider
+	health ProviderHealth
+}
+
+func (p *healthProvider) Health() ProviderHealth { return p.health }
+
+func TestHandleProviders(t *testing.T) {
+	t.Cleanup(func() {
+		providers = sync.Map{}
+		defaultProvider = nil
+	})
+	checkedAt := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	RegisterProvider(&MockLLMProvider{name: "openai"})
+	RegisterProvider(&healthProvider{
+		MockLLMProvider: MockLLMProvider{name: "compat"},
+		health:          ProviderHealth{Healthy: true, Latency: 20 * time.Millisecond, CheckedAt: checkedAt},
+	})
+	RegisterProvider(NewKeyPoolProvider(Provider{"api_keys": "sk-aaaa1111,sk-bbbb2222"}, func(Provider) LLMProvider {
+		return &MockLLMProvider{name: "pool"}
+	}))
+	SetDefaultProvider("openai")
+
+	t.Run("anonymous", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		HandleProviders(w, httptest.NewRequest(http.MethodGet, "/providers", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"providers":[
+			{"name":"compat","default":false,"health":{"healthy":true,"latency":20000000,"checked_at":"2024-06-01T00:00:00Z"}},
+			{"name":"openai","default":true},
+			{"name":"pool","default":false}
+		]}`, w.Body.String())
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		t.Cleanup(func() { AdminToken = "" })
+		AdminToken = "admin"
+
+		req := httptest.NewRequest(http.MethodGet, "/providers", nil)
+		req.Header.Set("Authorization", "Bearer admin")
+		w := httptest.NewRecorder()
+		HandleProviders(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"providers":[
+			{"name":"compat","default":false,"health":{"healthy":true,"latency":20000000,"checked_at":"2024-06-01T00:00:00Z"}},
+			{"name":"openai","default":true},
+			{"name":"pool","default":false,"keys":[
+				{"key":"****1111","requests":0,"errors":0,"consecutive_errors":0},
+				{"key":"****2222","requests":0,"errors":0,"consecutive_errors":0}
+			]}
+		]}`, w.Body.String())
+	})
+}
@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ModelLister is implemented by the llm providers which know the models they serve, eg: the configured model
+// or the azure deployment.
+type ModelLister interface {
+	// Models returns the IDs of the models served by the provider.
+	Models() []string
+}
+
+// GetProviderModels returns the models served by the llm provider, ok is false if the provider doesn't list its models.
+func GetProviderModels(provider LLMProvider) (models []string, ok bool) {
+	provider = unwrapProvider(provider)
+	lister, ok := provider.(ModelLister)
+	if !ok {
+		return nil, false
+	}
+	return lister.Models(), true
+}
+
+// modelsCreatedAt is reported as the creation time of the models, the bridge doesn't know when the models
+// were created by the vendors, so the start of the bridge is reported.
+var modelsCreatedAt = time.Now().Unix()
+
+// Model is the model in the OpenAI compatible model list.
+type Model struct {
+	// ID is the model ID
+	ID string `json:"id"`
+	// Object is always "model"
+	Object string `json:"object"`
+	// Created is the unix time the model was created
+	Created int64 `json:"created"`
+	// OwnedBy is the name of the llm provider serving the model
+	OwnedBy string `json:"owned_by"`
+}
+
+// ModelList is the OpenAI compatible model list.
+type ModelList struct {
+	// Object is always "list"
+	Object string `json:"object"`
+	// Data is the models
+	Data []Model `json:"data"`
+}
+
+// HandleModels is the handler for GET /v1/models, it lists the models served by the registered llm providers,
+// so the OpenAI SDK clients can discover the models through the bridge. The models of the default provider
+// come first, a model served by more than one provider is listed once.
+func HandleModels(w http.ResponseWriter, r *http.Request) {
+	names := ListProviders()
+	slices.Sort(names)
+	if p, err := GetDefaultProvider(); err == nil {
+		if i := slices.Index(names, p.Name()); i > 0 {
+			names = append(append([]string{p.Name()}, names[:i]...), names[i+1:]...)
+		}
+	}
+
+	list := ModelList{Object: "list", Data: []Model{}}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		provider := GetProvider(name)
+		if provider == nil {
+			continue
+		}
+		models, ok := GetProviderModels(provider)
+		if !ok {
+			continue
+		}
+		for _, id := range models {
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			list.Data = append(list.Data, Model{ID: id, Object: "model", Created: modelsCreatedAt, OwnedBy: name})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type modelsProvider struct {
+	MockLLMProvider
+	models []string
+}
+
+func (p *modelsProvider) Models() []string { return p.models }
+
+func TestHandleModels(t *testing.T) {
+	t.Cleanup(func() {
+		providers = sync.Map{}
+		defaultProvider = nil
+	})
+	RegisterProvider(&modelsProvider{MockLLMProvider: MockLLMProvider{name: "azopenai"}, models: []string{"gpt-4o"}})
+	RegisterProvider(&modelsProvider{MockLLMProvider: MockLLMProvider{name: "openai"}, models: []string{"gpt-4o-mini", "gpt-4o"}})
+	RegisterProvider(&MockLLMProvider{name: "gemini"})
+	SetDefaultProvider("openai")
+
+	w := httptest.NewRecorder()
+	HandleModels(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, fmt.Sprintf(`{"object":"list","data":[
+		{"id":"gpt-4o-mini","object":"model","created":%[1]d,"owned_by":"openai"},
+		{"id":"gpt-4o","object":"model","created":%[1]d,"owned_by":"openai"}
+	]}`, modelsCreatedAt), w.Body.String())
+}
@@ -0,0 +1,104 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// ProviderRetry is the retry policy of the calls of the llm provider, the transient failures of the provider
+// are retried with the exponential backoff before they are returned to the clients.
+type ProviderRetry struct {
+	MaxAttempts int           `yaml:"max_attempts"` // MaxAttempts is the maximum number of attempts including the first one, the calls are not retried if it is less than 2
+	Backoff     time.Duration `yaml:"backoff"`      // Backoff is the delay before the first retry, it is doubled for every next retry
+	MaxBackoff  time.Duration `yaml:"max_backoff"`  // MaxBackoff caps the delay before the retries
+	StatusCodes []int         `yaml:"status_codes"` // StatusCodes are the http status codes of the provider which are retried, default is 429, 500, 502, 503 and 504
+}
+
+// DefaultRetryStatusCodes are the http status codes of the provider retried if the status codes are not configured.
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// providerRetry is the retry policy of the provider calls, it is disabled if it is nil.
+var providerRetry atomic.Pointer[ProviderRetry]
+
+// ConfigureProviderRetry retries the failed calls of the llm provider by the policy.
+func ConfigureProviderRetry(conf ProviderRetry) {
+	if conf.MaxAttempts < 2 {
+		providerRetry.Store(nil)
+		return
+	}
+	if len(conf.StatusCodes) == 0 {
+		conf.StatusCodes = DefaultRetryStatusCodes
+	}
+	providerRetry.Store(&conf)
+}
+
+// retryProvider retries the failed calls of the provider by the retry policy. The streams are retried
+// until they start, the failures after the first chunk are returned as they are.
+type retryProvider struct {
+	LLMProvider
+}
+
+// GetChatCompletions implements LLMProvider.
+func (p *retryProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	return callWithRetry(ctx, p.Name(), func() (openai.ChatCompletionResponse, error) {
+		return p.LLMProvider.GetChatCompletions(ctx, req, md)
+	})
+}
+
+// GetChatCompletionsStream implements LLMProvider.
+func (p *retryProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	return callWithRetry(ctx, p.Name(), func() (ResponseRecver, error) {
+		return p.LLMProvider.GetChatCompletionsStream(ctx, req, md)
+	})
+}
+
+// callWithRetry calls the provider, and retries the call after the backoff while it fails with the retryable
+// errors. The error of the last attempt is returned.
+func callWithRetry[T any](ctx context.Context, name string, call func() (T, error)) (T, error) {
+	conf := providerRetry.Load()
+	if conf == nil {
+		return call()
+	}
+	policy := ai.CallPolicy{MaxAttempts: conf.MaxAttempts, Backoff: conf.Backoff, MaxBackoff: conf.MaxBackoff}
+
+	for attempt := 1; ; attempt++ {
+		res, err := call()
+		if err == nil || attempt >= policy.MaxAttempts || !shouldRetry(ctx, err, conf.StatusCodes) {
+			return res, err
+		}
+		delay := policy.Delay(attempt)
+		ylog.Warn("llm provider fails, retry the call", "provider", name, "attempt", attempt, "backoff", delay, "err", err.Error(), "transID", FromTransIDContext(ctx))
+		if sleepContext(ctx, delay) != nil {
+			return res, err
+		}
+	}
+}
+
+// shouldRetry returns true if the provider returns one of the status codes, or the connection to the
+// provider fails. The call is not retried if the request is canceled or timed out by itself.
+func shouldRetry(ctx context.Context, err error, statusCodes []int) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if code := providerStatusCode(err); code != 0 {
+		return slices.Contains(statusCodes, code)
+	}
+	netErr := net.Error(nil)
+	return errors.As(err, &netErr)
+}
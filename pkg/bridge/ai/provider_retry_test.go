@@ -0,0 +1,106 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+// flakyProvider fails the first calls by the errors, then it answers by the completionsProvider.
+type flakyProvider struct {
+	completionsProvider
+	errs  []error
+	calls int
+}
+
+func (p *flakyProvider) fail() error {
+	p.calls++
+	if p.calls <= len(p.errs) {
+		return p.errs[p.calls-1]
+	}
+	return nil
+}
+
+func (p *flakyProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	if err := p.fail(); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	return p.completionsProvider.GetChatCompletions(ctx, req, md)
+}
+
+func (p *flakyProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	if err := p.fail(); err != nil {
+		return nil, err
+	}
+	return p.completionsProvider.GetChatCompletionsStream(ctx, req, md)
+}
+
+func TestProviderRetry(t *testing.T) {
+	t.Cleanup(func() { providerRetry.Store(nil) })
+
+	unavailable := &openai.APIError{HTTPStatusCode: http.StatusServiceUnavailable}
+	badRequest := &openai.APIError{HTTPStatusCode: http.StatusBadRequest}
+
+	t.Run("disabled", func(t *testing.T) {
+		ConfigureProviderRetry(ProviderRetry{MaxAttempts: 1})
+		assert.Nil(t, providerRetry.Load())
+	})
+
+	ConfigureProviderRetry(ProviderRetry{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond})
+	assert.Equal(t, DefaultRetryStatusCodes, providerRetry.Load().StatusCodes)
+
+	tests := []struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		expectedErr   error
+	}{
+		{name: "success", expectedCalls: 1},
+		{name: "retried", errs: []error{unavailable, &openai.RequestError{HTTPStatusCode: http.StatusTooManyRequests}}, expectedCalls: 3},
+		{name: "too many attempts", errs: []error{unavailable, unavailable, unavailable}, expectedCalls: 3, expectedErr: unavailable},
+		{name: "not retryable", errs: []error{badRequest}, expectedCalls: 1, expectedErr: badRequest},
+		{name: "canceled", errs: []error{context.Canceled}, expectedCalls: 1, expectedErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyProvider{errs: tt.errs}
+			provider := &retryProvider{LLMProvider: flaky}
+
+			resp, err := provider.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, nil)
+			assert.Equal(t, tt.expectedCalls, flaky.calls)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "chatcmpl-1", resp.ID)
+		})
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		flaky := &flakyProvider{errs: []error{unavailable}}
+		provider := &retryProvider{LLMProvider: flaky}
+
+		recver, err := provider.GetChatCompletionsStream(context.Background(), openai.ChatCompletionRequest{}, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, recver)
+		assert.Equal(t, 2, flaky.calls)
+	})
+
+	t.Run("the request is canceled during the backoff", func(t *testing.T) {
+		ConfigureProviderRetry(ProviderRetry{MaxAttempts: 3, Backoff: time.Hour})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		flaky := &flakyProvider{errs: []error{unavailable, unavailable}}
+		provider := &retryProvider{LLMProvider: flaky}
+		_, err := provider.GetChatCompletions(ctx, openai.ChatCompletionRequest{}, nil)
+		assert.ErrorIs(t, err, unavailable)
+		assert.Equal(t, 1, flaky.calls)
+	})
+}
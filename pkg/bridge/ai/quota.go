@@ -0,0 +1,366 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/state"
+)
+
+// TokenQuota is the token budgets of every credential, the prompt and completion tokens of the credential are
+// counted in the days and months of UTC. The credential is the authenticated caller, see Caller, or the credential
+// of the service if the callers are not configured. The configuration looks like:
+//
+//	token_quota:
+//		daily: 1000000
+//		monthly: 20000000
+//		redis: redis://:password@localhost:6379/0 ## the budgets are shared by the zippers on the redis
+type TokenQuota struct {
+	Daily   int64  `yaml:"daily"`   // Daily is the tokens a credential can use in a day, it's not limited if it is 0
+	Monthly int64  `yaml:"monthly"` // Monthly is the tokens a credential can use in a month, it's not limited if it is 0
+	Redis   string `yaml:"redis"`   // Redis is the url of the redis storing the used tokens, they are kept in memory if not set
+}
+
+// ErrQuotaExceeded is returned when the token budget of the credential is exhausted.
+var ErrQuotaExceeded = errors.New("the token budget of the credential is exhausted")
+
+// QuotaStore stores the tokens used by the credentials in the periods, the default store keeps them in memory,
+// it can be replaced by SetQuotaStore, eg: by a Redis store to share the budgets among the zippers.
+type QuotaStore interface {
+	// AddTokens adds the tokens to the usage of the key in the period, the usage expires after the period ends.
+	AddTokens(key string, period string, tokens int64, expiresAt time.Time) error
+	// Tokens returns the tokens used by the key in the period, it's 0 if the key has not used any token.
+	Tokens(key string, period string) (int64, error)
+}
+
+var (
+	// tokenQuota is the token budgets of the credentials, the budgets are not enforced if it is nil.
+	tokenQuota atomic.Pointer[TokenQuota]
+
+	muQuotaStore      sync.Mutex
+	defaultQuotaStore = NewMemoryQuotaStore()
+)
+
+// ConfigureTokenQuota enforces the token budgets of the credentials by the config, the used tokens are stored
+// on the redis if it is set, see NewRedisQuotaStore.
+func ConfigureTokenQuota(conf TokenQuota) error {
+	if conf.Daily <= 0 && conf.Monthly <= 0 {
+		tokenQuota.Store(nil)
+		return nil
+	}
+	if conf.Redis != "" {
+		store, err := NewRedisQuotaStore(conf.Redis)
+		if err != nil {
+			return err
+		}
+		SetQuotaStore(store)
+	}
+	tokenQuota.Store(&conf)
+	return nil
+}
+
+// SetQuotaStore sets the default quota store
+func SetQuotaStore(store QuotaStore) {
+	muQuotaStore.Lock()
+	defer muQuotaStore.Unlock()
+	defaultQuotaStore = store
+}
+
+// GetQuotaStore gets the default quota store
+func GetQuotaStore() QuotaStore {
+	muQuotaStore.Lock()
+	defer muQuotaStore.Unlock()
+	return defaultQuotaStore
+}
+
+// quotaPeriod is a period of the token budget.
+type quotaPeriod struct {
+	name   string
+	budget int64
+	// key is the key of the period in the store, eg: daily:2024-01-02
+	key     string
+	resetAt time.Time
+}
+
+// periods returns the periods of the budgets at now.
+func (q TokenQuota) periods(now time.Time) []quotaPeriod {
+	now = now.UTC()
+	var periods []quotaPeriod
+	if q.Daily > 0 {
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		periods = append(periods, quotaPeriod{
+			name:    "daily",
+			budget:  q.Daily,
+			key:     "daily:" + day.Format(time.DateOnly),
+			resetAt: day.AddDate(0, 0, 1),
+		})
+	}
+	if q.Monthly > 0 {
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		periods = append(periods, quotaPeriod{
+			name:    "monthly",
+			budget:  q.Monthly,
+			key:     "monthly:" + month.Format("2006-01"),
+			resetAt: month.AddDate(0, 1, 0),
+		})
+	}
+	return periods
+}
+
+// checkQuota returns ErrQuotaExceeded if a budget of the credential is exhausted. The request is allowed if the
+// store fails, the budgets are not the reason to stop serving.
+func checkQuota(credential string) error {
+	conf := tokenQuota.Load()
+	if conf == nil {
+		return nil
+	}
+	key := credentialHash(credential)
+	for _, period := range conf.periods(time.Now()) {
+		used, err := GetQuotaStore().Tokens(key, period.key)
+		if err != nil {
+			ylog.Error("get the used tokens of the credential", "period", period.key, "err", err.Error())
+			continue
+		}
+		if used >= period.budget {
+			return fmt.Errorf("%w: %d of the %d %s tokens are used, the budget resets at %s",
+				ErrQuotaExceeded, used, period.budget, period.name, period.resetAt.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// addQuotaUsage adds the used tokens to the budgets of the credential.
+func addQuotaUsage(credential string, tokens int) {
+	conf := tokenQuota.Load()
+	if conf == nil || tokens <= 0 {
+		return
+	}
+	key := credentialHash(credential)
+	for _, period := range conf.periods(time.Now()) {
+		if err := GetQuotaStore().AddTokens(key, period.key, int64(tokens), period.resetAt); err != nil {
+			ylog.Error("add the used tokens of the credential", "period", period.key, "err", err.Error())
+		}
+	}
+}
+
+// quotaProvider rejects the requests of the caller by ErrQuotaExceeded once its token budget is exhausted,
+// and counts the tokens used by the requests in the budgets and the usage records, see UsageRecord.
+type quotaProvider struct {
+	LLMProvider
+	// credential is the credential of the service, it's the budget of the requests if the callers are not configured.
+	credential string
+}
+
+// caller returns the credential whose budget the request uses, it's the name of the authenticated caller.
+func (p *quotaProvider) caller(ctx context.Context) string {
+	if caller := fromCallerContext(ctx); caller != nil {
+		return caller.Name
+	}
+	return p.credential
+}
+
+// GetChatCompletions implements LLMProvider.
+func (p *quotaProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	if err := checkQuota(p.caller(ctx)); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	resp, err := p.LLMProvider.GetChatCompletions(ctx, req, md)
+	if err == nil {
+		p.used(ctx, resp.Usage)
+	}
+	return resp, err
+}
+
+// GetChatCompletionsStream implements LLMProvider.
+func (p *quotaProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	if err := checkQuota(p.caller(ctx)); err != nil {
+		return nil, err
+	}
+	recver, err := p.LLMProvider.GetChatCompletionsStream(ctx, req, md)
+	if err != nil || (tokenQuota.Load() == nil && fromRequestUsageContext(ctx) == nil) {
+		return recver, err
+	}
+	r := &quotaRecver{ResponseRecver: recver, ctx: ctx, provider: p, req: req}
+	// the stream abandoned by the caller is counted when ctx is done
+	r.stop = context.AfterFunc(ctx, r.finish)
+	return r, nil
+}
+
+// GetEmbeddings implements LLMProvider.
+func (p *quotaProvider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, md metadata.M) (openai.EmbeddingResponse, error) {
+	if err := checkQuota(p.caller(ctx)); err != nil {
+		return openai.EmbeddingResponse{}, err
+	}
+	resp, err := p.LLMProvider.GetEmbeddings(ctx, req, md)
+	if err == nil {
+		addQuotaUsage(p.caller(ctx), resp.Usage.TotalTokens)
+	}
+	return resp, err
+}
+
+// used counts the tokens used by the chat completion.
+func (p *quotaProvider) used(ctx context.Context, usage openai.Usage) {
+	addQuotaUsage(p.caller(ctx), usage.TotalTokens)
+	addRequestUsage(ctx, usage)
+}
+
+// quotaRecver counts the tokens of the stream when it ends, fails or is abandoned when its ctx is done, so
+// the streams canceled halfway are counted too. The tokens are estimated if the stream doesn't carry the usage.
+type quotaRecver struct {
+	ResponseRecver
+	ctx      context.Context
+	provider *quotaProvider
+	req      openai.ChatCompletionRequest
+	stop     func() bool
+
+	mu      sync.Mutex
+	content strings.Builder
+	usage   *openai.Usage
+	done    bool
+}
+
+func (r *quotaRecver) Recv() (openai.ChatCompletionStreamResponse, error) {
+	resp, err := r.ResponseRecver.Recv()
+	if err != nil {
+		r.stop()
+		r.finish()
+		return resp, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if resp.Usage != nil {
+		r.usage = resp.Usage
+	}
+	for _, choice := range resp.Choices {
+		r.content.WriteString(choice.Delta.Content)
+		for _, call := range choice.Delta.ToolCalls {
+			r.content.WriteString(call.Function.Arguments)
+		}
+	}
+	return resp, nil
+}
+
+// finish counts the tokens of the stream once.
+func (r *quotaRecver) finish() {
+	r.mu.Lock()
+	if r.done {
+		r.mu.Unlock()
+		return
+	}
+	r.done = true
+	usage := r.tokens()
+	r.mu.Unlock()
+
+	r.provider.used(r.ctx, usage)
+}
+
+// tokens returns the usage of the stream, the caller must hold the lock.
+func (r *quotaRecver) tokens() openai.Usage {
+	if r.usage != nil {
+		return *r.usage
+	}
+	// the prompt is estimated without the max tokens, the completion is estimated by its content.
+	prompt := r.req
+	prompt.MaxTokens = 0
+	usage := openai.Usage{
+		PromptTokens:     int(estimateTokens(prompt)),
+		CompletionTokens: estimateTextTokens(r.content.String()),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// memoryQuotaStore keeps the used tokens in memory, they are lost when the zipper restarts.
+type memoryQuotaStore struct {
+	mu     sync.Mutex
+	usages map[string]memoryQuotaUsage
+}
+
+type memoryQuotaUsage struct {
+	tokens    int64
+	expiresAt time.Time
+}
+
+// NewMemoryQuotaStore returns the QuotaStore which keeps the used tokens in memory.
+func NewMemoryQuotaStore() QuotaStore {
+	return &memoryQuotaStore{usages: make(map[string]memoryQuotaUsage)}
+}
+
+func (s *memoryQuotaStore) AddTokens(key string, period string, tokens int64, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, usage := range s.usages {
+		if !now.Before(usage.expiresAt) {
+			delete(s.usages, k)
+		}
+	}
+	k := key + "/" + period
+	usage := s.usages[k]
+	usage.tokens += tokens
+	usage.expiresAt = expiresAt
+	s.usages[k] = usage
+	return nil
+}
+
+func (s *memoryQuotaStore) Tokens(key string, period string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage, ok := s.usages[key+"/"+period]
+	if !ok || !time.Now().Before(usage.expiresAt) {
+		return 0, nil
+	}
+	return usage.tokens, nil
+}
+
+// RedisQuotaKeyPrefix is the prefix of the redis keys of the used tokens, the key of the tokens used by a
+// credential in a period is RedisQuotaKeyPrefix, the period and the hash of the credential.
+const RedisQuotaKeyPrefix = "yomo:quota:"
+
+// redisQuotaStore keeps the used tokens on the redis, so the zippers share the budgets.
+type redisQuotaStore struct {
+	client *state.RedisClient
+}
+
+// NewRedisQuotaStore returns the QuotaStore which keeps the used tokens on the redis of the url, the url looks
+// like redis://[[username]:password@]host[:port][/db].
+func NewRedisQuotaStore(rawURL string) (QuotaStore, error) {
+	client, err := state.NewRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &redisQuotaStore{client: client}, nil
+}
+
+func (s *redisQuotaStore) AddTokens(key string, period string, tokens int64, expiresAt time.Time) error {
+	k := RedisQuotaKeyPrefix + period + ":" + key
+	if _, err := s.client.Do("INCRBY", k, strconv.FormatInt(tokens, 10)); err != nil {
+		return err
+	}
+	_, err := s.client.Do("EXPIREAT", k, strconv.FormatInt(expiresAt.Unix(), 10))
+	return err
+}
+
+func (s *redisQuotaStore) Tokens(key string, period string) (int64, error) {
+	reply, err := s.client.Do("GET", RedisQuotaKeyPrefix+period+":"+key)
+	if err != nil || reply == nil {
+		return 0, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return 0, fmt.Errorf("unexpected redis reply %v", reply)
+	}
+	return strconv.ParseInt(string(value), 10, 64)
+}
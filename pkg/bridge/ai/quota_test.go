@@ -0,0 +1,210 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenQuota(t *testing.T) {
+	t.Cleanup(func() {
+		ConfigureTokenQuota(TokenQuota{})
+		SetQuotaStore(NewMemoryQuotaStore())
+	})
+	ConfigureTokenQuota(TokenQuota{Daily: 3, Monthly: 100})
+	SetQuotaStore(NewMemoryQuotaStore())
+
+	provider := &quotaProvider{LLMProvider: &completionsProvider{}, credential: "token-a"}
+	ctx := context.Background()
+
+	// every completion uses 2 tokens, the daily budget is exhausted after 2 completions.
+	for i := 0; i < 2; i++ {
+		_, err := provider.GetChatCompletions(ctx, openai.ChatCompletionRequest{}, nil)
+		assert.NoError(t, err)
+	}
+	_, err := provider.GetChatCompletions(ctx, openai.ChatCompletionRequest{}, nil)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Contains(t, err.Error(), "4 of the 3 daily tokens are used, the budget resets at ")
+
+	_, err = provider.GetChatCompletionsStream(ctx, openai.ChatCompletionRequest{}, nil)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	t.Run("the budgets are per credential", func(t *testing.T) {
+		provider := &quotaProvider{LLMProvider: &completionsProvider{}, credential: "token-b"}
+		recver, err := provider.GetChatCompletionsStream(ctx, openai.ChatCompletionRequest{
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+		}, nil)
+		assert.NoError(t, err)
+		for {
+			if _, err := recver.Recv(); err == io.EOF {
+				break
+			}
+		}
+		// the stream has no usage, its tokens are estimated.
+		used, err := GetQuotaStore().Tokens(credentialHash("token-b"), TokenQuota{Monthly: 1}.periods(time.Now())[0].key)
+		assert.NoError(t, err)
+		assert.Greater(t, used, int64(0))
+	})
+
+	t.Run("the budgets are per caller", func(t *testing.T) {
+		// the callers of the same service have their own budgets.
+		callerCtx := withCallerContext(ctx, &Caller{Name: "caller-1", Token: "token-1"})
+		_, err := provider.GetChatCompletions(callerCtx, openai.ChatCompletionRequest{}, nil)
+		assert.NoError(t, err)
+
+		used, err := GetQuotaStore().Tokens(credentialHash("caller-1"), TokenQuota{Daily: 1}.periods(time.Now())[0].key)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), used)
+	})
+
+	t.Run("the canceled stream is counted", func(t *testing.T) {
+		provider := &quotaProvider{LLMProvider: &completionsProvider{}, credential: "token-c"}
+		streamCtx, cancel := context.WithCancel(ctx)
+		recver, err := provider.GetChatCompletionsStream(streamCtx, openai.ChatCompletionRequest{
+			Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+		}, nil)
+		assert.NoError(t, err)
+		// the caller goes away after the first chunk.
+		_, err = recver.Recv()
+		assert.NoError(t, err)
+		cancel()
+
+		key := TokenQuota{Daily: 1}.periods(time.Now())[0].key
+		assert.Eventually(t, func() bool {
+			used, err := GetQuotaStore().Tokens(credentialHash("token-c"), key)
+			return err == nil && used > 0
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ConfigureTokenQuota(TokenQuota{})
+		_, err := provider.GetChatCompletions(ctx, openai.ChatCompletionRequest{}, nil)
+		assert.NoError(t, err)
+	})
+}
+
+func TestTokenQuotaPeriods(t *testing.T) {
+	conf := TokenQuota{Daily: 10, Monthly: 100}
+	periods := conf.periods(time.Date(2024, 12, 31, 23, 0, 0, 0, time.FixedZone("", -3600)))
+
+	assert.Len(t, periods, 2)
+	assert.Equal(t, "daily:2025-01-01", periods[0].key)
+	assert.Equal(t, time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), periods[0].resetAt)
+	assert.Equal(t, "monthly:2025-01", periods[1].key)
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), periods[1].resetAt)
+}
+
+func TestMemoryQuotaStore(t *testing.T) {
+	store := NewMemoryQuotaStore()
+
+	assert.NoError(t, store.AddTokens("a", "daily:2024-01-01", 5, time.Now().Add(time.Hour)))
+	assert.NoError(t, store.AddTokens("a", "daily:2024-01-01", 7, time.Now().Add(time.Hour)))
+	assert.NoError(t, store.AddTokens("b", "daily:2024-01-01", 1, time.Now().Add(-time.Second)))
+
+	used, err := store.Tokens("a", "daily:2024-01-01")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), used)
+
+	used, err = store.Tokens("b", "daily:2024-01-01")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), used)
+}
+
+func TestRedisQuotaStore(t *testing.T) {
+	addr := serveFakeRedisCounters(t)
+
+	store, err := NewRedisQuotaStore("redis://" + addr)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.AddTokens("a", "daily:2024-01-01", 5, time.Now().Add(time.Hour)))
+	assert.NoError(t, store.AddTokens("a", "daily:2024-01-01", 7, time.Now().Add(time.Hour)))
+
+	// the zippers share the used tokens.
+	other, err := NewRedisQuotaStore("redis://" + addr)
+	assert.NoError(t, err)
+	used, err := other.Tokens("a", "daily:2024-01-01")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(12), used)
+
+	used, err = other.Tokens("b", "daily:2024-01-01")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), used)
+
+	_, err = NewRedisQuotaStore("rediss://" + addr)
+	assert.Error(t, err)
+}
+
+// serveFakeRedisCounters serves INCRBY, EXPIREAT and GET of the redis in memory.
+func serveFakeRedisCounters(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+
+	var (
+		mu       sync.Mutex
+		counters = make(map[string]int64)
+	)
+	exec := func(args []string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.ToUpper(args[0]) {
+		case "INCRBY":
+			n, _ := strconv.ParseInt(args[2], 10, 64)
+			counters[args[1]] += n
+			return fmt.Sprintf(":%d\r\n", counters[args[1]])
+		case "EXPIREAT":
+			return ":1\r\n"
+		case "GET":
+			n, ok := counters[args[1]]
+			if !ok {
+				return "$-1\r\n"
+			}
+			v := strconv.FormatInt(n, 10)
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+		}
+		return "-ERR unknown command\r\n"
+	}
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					// the commands are the arrays of the bulk strings.
+					line, err := rd.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					args := make([]string, 0, n)
+					for i := 0; i < n; i++ {
+						if _, err := rd.ReadString('\n'); err != nil {
+							return
+						}
+						arg, err := rd.ReadString('\n')
+						if err != nil {
+							return
+						}
+						args = append(args, strings.TrimSuffix(arg, "\r\n"))
+					}
+					fmt.Fprint(conn, exec(args))
+				}
+			}()
+		}
+	}()
+	return lis.Addr().String()
+}
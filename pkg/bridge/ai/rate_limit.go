@@ -0,0 +1,424 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// RateLimit is the configuration of the rate limit of the llm provider, the requests are queued instead of failing
+// when the provider returns 429 or the local TPM budget is exhausted. The queued requests are scheduled by the
+// priorities of their callers, and the callers of the same priority take turns. The callers are the callers
+// authenticated by the server, see Caller, or the credentials, see ai.PriorityKey.
+type RateLimit struct {
+	TPM     int           `yaml:"tpm"`      // TPM is the local budget of the tokens per minute, it is not limited if it is 0
+	MaxWait time.Duration `yaml:"max_wait"` // MaxWait is the max time a request waits in the queue, default is 30s
+}
+
+const (
+	// defaultRateLimitMaxWait is the default max time a request waits in the queue.
+	defaultRateLimitMaxWait = 30 * time.Second
+	// rateLimitMinBackoff and rateLimitMaxBackoff bound the pause of the queue after the provider returns 429,
+	// the pause is doubled by every 429 in a row.
+	rateLimitMinBackoff = time.Second
+	rateLimitMaxBackoff = time.Minute
+)
+
+// ErrRateLimited is returned when the request waits longer than the max wait in the queue.
+var ErrRateLimited = errors.New("the llm provider is rate limited, the request waits too long in the queue")
+
+// rateLimiter is the limiter shared by the services, it is nil if the rate limit is not configured.
+var rateLimiter atomic.Pointer[providerLimiter]
+
+// ConfigureRateLimit queues the requests of the llm provider by the config.
+func ConfigureRateLimit(conf RateLimit) {
+	rateLimiter.Store(newProviderLimiter(conf))
+}
+
+// providerLimiter grants the requests the tokens of the TPM budget, the requests which can't be granted
+// are queued, they are granted in order when the budget is refilled or the pause after 429 ends.
+type providerLimiter struct {
+	mu          sync.Mutex
+	tpm         float64
+	tokens      float64
+	refilledAt  time.Time
+	pausedUntil time.Time
+	backoff     time.Duration
+	maxWait     time.Duration
+	queue       limiterQueue
+	timer       *time.Timer
+}
+
+func newProviderLimiter(conf RateLimit) *providerLimiter {
+	if conf.MaxWait <= 0 {
+		conf.MaxWait = defaultRateLimitMaxWait
+	}
+	return &providerLimiter{
+		tpm:        float64(conf.TPM),
+		tokens:     float64(conf.TPM),
+		refilledAt: time.Now(),
+		maxWait:    conf.MaxWait,
+	}
+}
+
+// limiterWaiter is a request waiting for the tokens.
+type limiterWaiter struct {
+	credential string
+	priority   int
+	cost       float64
+	granted    bool // granted is guarded by the mutex of the limiter
+	ready      chan struct{}
+}
+
+// acquire waits until the request of the cost is granted, it returns ErrRateLimited if it's not granted before
+// the deadline, or the error of ctx if ctx is done first.
+func (l *providerLimiter) acquire(ctx context.Context, credential string, priority int, cost float64, deadline time.Time) error {
+	if l.tpm > 0 {
+		// the request larger than the budget is granted when the budget is full.
+		cost = min(cost, l.tpm)
+	}
+	w := &limiterWaiter{credential: credential, priority: priority, cost: cost, ready: make(chan struct{})}
+
+	l.mu.Lock()
+	l.queue.push(w)
+	l.dispatch(time.Now())
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timer.C:
+		err = ErrRateLimited
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if w.granted {
+		return nil
+	}
+	l.queue.remove(w)
+	// the waiters behind it may be granted now.
+	l.dispatch(time.Now())
+	return err
+}
+
+// settle settles the tokens of the granted request by the used tokens, the cost is kept if used is 0.
+func (l *providerLimiter) settle(cost float64, used int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.backoff = 0
+	if l.tpm > 0 && used > 0 {
+		l.tokens += min(cost, l.tpm) - float64(used)
+	}
+	l.dispatch(time.Now())
+}
+
+// throttle pauses the queue after the provider returns 429, the tokens of the request are refunded.
+func (l *providerLimiter) throttle(cost float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tpm > 0 {
+		l.tokens = min(l.tokens+min(cost, l.tpm), l.tpm)
+	}
+	l.backoff = min(max(l.backoff*2, rateLimitMinBackoff), rateLimitMaxBackoff)
+	now := time.Now()
+	l.pausedUntil = now.Add(l.backoff)
+	l.dispatch(now)
+}
+
+// dispatch grants the waiters in order until the budget is exhausted, then it's called again when the budget
+// is refilled for the next waiter. l.mu must be held.
+func (l *providerLimiter) dispatch(now time.Time) {
+	if l.tpm > 0 {
+		l.tokens = min(l.tokens+now.Sub(l.refilledAt).Minutes()*l.tpm, l.tpm)
+		l.refilledAt = now
+	}
+	for w := l.queue.peek(); w != nil; w = l.queue.peek() {
+		if now.Before(l.pausedUntil) {
+			l.wakeUpAfter(l.pausedUntil.Sub(now))
+			return
+		}
+		if l.tpm > 0 && l.tokens < w.cost {
+			l.wakeUpAfter(time.Duration((w.cost - l.tokens) / l.tpm * float64(time.Minute)))
+			return
+		}
+		l.queue.pop()
+		if l.tpm > 0 {
+			l.tokens -= w.cost
+		}
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+func (l *providerLimiter) wakeUpAfter(d time.Duration) {
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+	l.timer = time.AfterFunc(d, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.dispatch(time.Now())
+	})
+}
+
+// limiterQueue queues the waiters by the priorities, the higher priority is granted first, and the credentials
+// of the same priority take turns, so a busy credential can't starve the others.
+type limiterQueue struct {
+	levels []*priorityLevel // the levels are sorted by the priority in descending order
+}
+
+type priorityLevel struct {
+	priority    int
+	credentials []string // the credentials take turns in the order
+	waiters     map[string][]*limiterWaiter
+}
+
+func (q *limiterQueue) push(w *limiterWaiter) {
+	i := 0
+	for ; i < len(q.levels) && q.levels[i].priority > w.priority; i++ {
+	}
+	if i == len(q.levels) || q.levels[i].priority != w.priority {
+		level := &priorityLevel{priority: w.priority, waiters: make(map[string][]*limiterWaiter)}
+		q.levels = append(q.levels[:i], append([]*priorityLevel{level}, q.levels[i:]...)...)
+	}
+	level := q.levels[i]
+	if len(level.waiters[w.credential]) == 0 {
+		level.credentials = append(level.credentials, w.credential)
+	}
+	level.waiters[w.credential] = append(level.waiters[w.credential], w)
+}
+
+// peek returns the next waiter to be granted, or nil if the queue is empty.
+func (q *limiterQueue) peek() *limiterWaiter {
+	if len(q.levels) == 0 {
+		return nil
+	}
+	level := q.levels[0]
+	return level.waiters[level.credentials[0]][0]
+}
+
+// pop removes the next waiter, the credential of it takes its next turn after the other credentials.
+func (q *limiterQueue) pop() {
+	level := q.levels[0]
+	credential := level.credentials[0]
+	level.credentials = level.credentials[1:]
+	level.waiters[credential] = level.waiters[credential][1:]
+	if len(level.waiters[credential]) > 0 {
+		level.credentials = append(level.credentials, credential)
+	} else {
+		delete(level.waiters, credential)
+	}
+	if len(level.credentials) == 0 {
+		q.levels = q.levels[1:]
+	}
+}
+
+// remove removes the waiter which gives up waiting.
+func (q *limiterQueue) remove(w *limiterWaiter) {
+	for i, level := range q.levels {
+		if level.priority != w.priority {
+			continue
+		}
+		waiters := level.waiters[w.credential]
+		for j, v := range waiters {
+			if v != w {
+				continue
+			}
+			waiters = append(waiters[:j], waiters[j+1:]...)
+			if len(waiters) > 0 {
+				level.waiters[w.credential] = waiters
+				return
+			}
+			delete(level.waiters, w.credential)
+			for k, c := range level.credentials {
+				if c == w.credential {
+					level.credentials = append(level.credentials[:k], level.credentials[k+1:]...)
+					break
+				}
+			}
+			if len(level.credentials) == 0 {
+				q.levels = append(q.levels[:i], q.levels[i+1:]...)
+			}
+			return
+		}
+	}
+}
+
+// GetEmbeddings queues the embeddings like the chat completions, the cost is estimated by the input.
+func (p *rateLimitedProvider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, md metadata.M) (openai.EmbeddingResponse, error) {
+	limiter := rateLimiter.Load()
+	if limiter == nil {
+		return p.LLMProvider.GetEmbeddings(ctx, req, md)
+	}
+	var (
+		cost     = estimateEmbeddingTokens(req.Input)
+		deadline = time.Now().Add(limiter.maxWait)
+	)
+	lane, priority := p.rateLimitLane(ctx, md)
+	for {
+		if err := limiter.acquire(ctx, lane, priority, cost, deadline); err != nil {
+			return openai.EmbeddingResponse{}, err
+		}
+		resp, err := p.LLMProvider.GetEmbeddings(ctx, req, md)
+		if isRateLimited(err) {
+			limiter.throttle(cost)
+			ylog.Warn("llm provider is rate limited, queue the request", "provider", p.Name(), "transID", FromTransIDContext(ctx))
+			continue
+		}
+		limiter.settle(cost, resp.Usage.TotalTokens)
+		return resp, err
+	}
+}
+
+// estimateTokens estimates the tokens of the request before it's sent, a token is about 4 characters,
+// the completion is estimated by the max tokens of the request.
+func estimateTokens(req openai.ChatCompletionRequest) float64 {
+	chars := 0
+	for _, msg := range req.Messages {
+		chars += len(msg.Content)
+		for _, part := range msg.MultiContent {
+			chars += len(part.Text)
+		}
+		for _, tc := range msg.ToolCalls {
+			chars += len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+	}
+	for _, tool := range req.Tools {
+		if tool.Function != nil {
+			chars += len(tool.Function.Name) + len(tool.Function.Description)
+		}
+	}
+	return float64(chars/4 + req.MaxTokens + 1)
+}
+
+// estimateEmbeddingTokens estimates the tokens of the embedding input, which is a string, an array of
+// strings, an array of tokens or an array of the arrays of tokens.
+func estimateEmbeddingTokens(input any) float64 {
+	tokens := 0
+	switch v := input.(type) {
+	case string:
+		tokens = len(v) / 4
+	case []string:
+		for _, s := range v {
+			tokens += len(s) / 4
+		}
+	case []any:
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				tokens += len(item) / 4
+			case []any:
+				tokens += len(item)
+			default:
+				tokens++
+			}
+		}
+	case []int:
+		tokens = len(v)
+	case [][]int:
+		for _, t := range v {
+			tokens += len(t)
+		}
+	}
+	return float64(tokens + 1)
+}
+
+// isRateLimited returns true if the provider returns 429.
+func isRateLimited(err error) bool {
+	return providerStatusCode(err) == http.StatusTooManyRequests
+}
+
+// rateLimitLane returns the lane of the request in the queue, it's the authenticated caller with its priority,
+// or the credential with the priority in the metadata if the callers are not configured.
+func (p *rateLimitedProvider) rateLimitLane(ctx context.Context, md metadata.M) (string, int) {
+	if caller := fromCallerContext(ctx); caller != nil {
+		return caller.Name, caller.Priority
+	}
+	return p.credential, credentialPriority(md)
+}
+
+// credentialPriority returns the priority of the credential in the metadata, default is 0.
+func credentialPriority(md metadata.M) int {
+	v, ok := md.Get(ai.PriorityKey)
+	if !ok {
+		return 0
+	}
+	priority, _ := strconv.Atoi(v)
+	return priority
+}
+
+// rateLimitedProvider queues the chat completions of the callers when the llm provider is rate limited,
+// the requests got 429 are queued again until the max wait.
+type rateLimitedProvider struct {
+	LLMProvider
+	credential string
+}
+
+func (p *rateLimitedProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	limiter := rateLimiter.Load()
+	if limiter == nil {
+		return p.LLMProvider.GetChatCompletions(ctx, req, md)
+	}
+	var (
+		cost     = estimateTokens(req)
+		deadline = time.Now().Add(limiter.maxWait)
+	)
+	lane, priority := p.rateLimitLane(ctx, md)
+	for {
+		if err := limiter.acquire(ctx, lane, priority, cost, deadline); err != nil {
+			return openai.ChatCompletionResponse{}, err
+		}
+		resp, err := p.LLMProvider.GetChatCompletions(ctx, req, md)
+		if isRateLimited(err) {
+			limiter.throttle(cost)
+			ylog.Warn("llm provider is rate limited, queue the request", "provider", p.Name(), "transID", FromTransIDContext(ctx))
+			continue
+		}
+		limiter.settle(cost, resp.Usage.TotalTokens)
+		return resp, err
+	}
+}
+
+func (p *rateLimitedProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	limiter := rateLimiter.Load()
+	if limiter == nil {
+		return p.LLMProvider.GetChatCompletionsStream(ctx, req, md)
+	}
+	var (
+		cost     = estimateTokens(req)
+		deadline = time.Now().Add(limiter.maxWait)
+	)
+	lane, priority := p.rateLimitLane(ctx, md)
+	for {
+		if err := limiter.acquire(ctx, lane, priority, cost, deadline); err != nil {
+			return nil, err
+		}
+		recver, err := p.LLMProvider.GetChatCompletionsStream(ctx, req, md)
+		if isRateLimited(err) {
+			limiter.throttle(cost)
+			ylog.Warn("llm provider is rate limited, queue the request", "provider", p.Name(), "transID", FromTransIDContext(ctx))
+			continue
+		}
+		// the usage of the stream is unknown until it ends, the estimated cost is kept.
+		limiter.settle(cost, 0)
+		return recver, err
+	}
+}
@@ -0,0 +1,185 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func TestLimiterQueue(t *testing.T) {
+	var q limiterQueue
+
+	waiters := []*limiterWaiter{
+		{credential: "a", priority: 0},
+		{credential: "a", priority: 0},
+		{credential: "a", priority: 0},
+		{credential: "b", priority: 0},
+		{credential: "c", priority: 10},
+		{credential: "b", priority: 0},
+	}
+	for _, w := range waiters {
+		q.push(w)
+	}
+	q.remove(waiters[1])
+
+	// the higher priority is granted first, then the credentials of the same priority take turns.
+	want := []*limiterWaiter{waiters[4], waiters[0], waiters[3], waiters[2], waiters[5]}
+	for _, w := range want {
+		assert.Same(t, w, q.peek())
+		q.pop()
+	}
+	assert.Nil(t, q.peek())
+}
+
+func TestProviderLimiterTPM(t *testing.T) {
+	// 6000 tokens per minute are refilled 10 tokens per 100ms.
+	l := newProviderLimiter(RateLimit{TPM: 6000, MaxWait: time.Second})
+	deadline := time.Now().Add(time.Second)
+
+	assert.NoError(t, l.acquire(context.Background(), "a", 0, 6000, deadline))
+
+	start := time.Now()
+	assert.NoError(t, l.acquire(context.Background(), "a", 0, 10, deadline))
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+
+	// the request waiting longer than the max wait fails.
+	err := l.acquire(context.Background(), "a", 0, 6000, time.Now().Add(50*time.Millisecond))
+	assert.ErrorIs(t, err, ErrRateLimited)
+
+	// the unused tokens are refunded.
+	l.settle(6000, 0)
+	l.settle(10, 1)
+	assert.NoError(t, l.acquire(context.Background(), "a", 0, 5, deadline))
+}
+
+type rateLimitedMockProvider struct {
+	MockLLMProvider
+	limited int
+	calls   int
+}
+
+func (m *rateLimitedMockProvider) GetChatCompletions(_ context.Context, _ openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	m.calls++
+	if m.calls <= m.limited {
+		return openai.ChatCompletionResponse{}, &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "rate limited"}
+	}
+	return openai.ChatCompletionResponse{Usage: openai.Usage{TotalTokens: 10}}, nil
+}
+
+func TestRateLimitedProvider(t *testing.T) {
+	t.Cleanup(func() { rateLimiter.Store(nil) })
+
+	mock := &rateLimitedMockProvider{limited: 1}
+	p := &rateLimitedProvider{LLMProvider: mock, credential: "a"}
+
+	// it's not limited if the rate limit is not configured.
+	_, err := p.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, metadata.M{})
+	assert.True(t, isRateLimited(err))
+
+	ConfigureRateLimit(RateLimit{MaxWait: 3 * time.Second})
+	mock.calls = 0
+
+	// the request got 429 is queued again after the backoff.
+	start := time.Now()
+	resp, err := p.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, metadata.M{ai.PriorityKey: "1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, resp.Usage.TotalTokens)
+	assert.Equal(t, 2, mock.calls)
+	assert.GreaterOrEqual(t, time.Since(start), rateLimitMinBackoff)
+
+	// the request fails if it's still rate limited after the max wait.
+	ConfigureRateLimit(RateLimit{MaxWait: 1500 * time.Millisecond})
+	mock.calls, mock.limited = 0, 100
+	_, err = p.GetChatCompletions(context.Background(), openai.ChatCompletionRequest{}, metadata.M{})
+	assert.ErrorIs(t, err, ErrRateLimited)
+}
+
+func TestCredentialPriority(t *testing.T) {
+	assert.Equal(t, 0, credentialPriority(metadata.M{}))
+	assert.Equal(t, 10, credentialPriority(metadata.M{ai.PriorityKey: "10"}))
+	assert.Equal(t, 0, credentialPriority(metadata.M{ai.PriorityKey: "high"}))
+}
+
+// callerRecorderProvider records the callers of the chat completions in the order they are sent.
+type callerRecorderProvider struct {
+	completionsProvider
+	mu      sync.Mutex
+	callers []string
+}
+
+func (p *callerRecorderProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	p.mu.Lock()
+	p.callers = append(p.callers, fromCallerContext(ctx).Name)
+	p.mu.Unlock()
+	return openai.ChatCompletionResponse{ID: "chatcmpl-1", Model: "gpt-4o"}, nil
+}
+
+func TestRateLimitCallerLanes(t *testing.T) {
+	assert.NoError(t, ConfigureCallers([]Caller{
+		{Name: "team-a", Token: "token-a"},
+		{Name: "team-b", Token: "token-b"},
+		{Name: "team-c", Token: "token-c", Priority: 10},
+	}))
+	// 60000 tokens per minute are refilled 100 tokens per 100ms, every request costs 100 tokens.
+	ConfigureRateLimit(RateLimit{TPM: 60000, MaxWait: 5 * time.Second})
+	t.Cleanup(func() {
+		ConfigureCallers(nil)
+		rateLimiter.Store(nil)
+	})
+	limiter := rateLimiter.Load()
+	limiter.mu.Lock()
+	limiter.tokens = 0
+	limiter.mu.Unlock()
+
+	// all the callers share the service of the server credential.
+	provider := &callerRecorderProvider{}
+	service := &Service{LLMProvider: &rateLimitedProvider{LLMProvider: provider, credential: "token"}, Metadata: metadata.M{}, credential: "token"}
+	service.SetSystemPrompt("")
+	server := httptest.NewServer(WithCallerAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleChatCompletions(w, r.WithContext(WithServiceContext(r.Context(), service)))
+	})))
+	defer server.Close()
+
+	queued := func() int {
+		limiter.mu.Lock()
+		defer limiter.mu.Unlock()
+		n := 0
+		for _, level := range limiter.queue.levels {
+			for _, waiters := range level.waiters {
+				n += len(waiters)
+			}
+		}
+		return n
+	}
+
+	var wg sync.WaitGroup
+	for i, token := range []string{"token-a", "token-a", "token-a", "token-b", "token-c"} {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			body := `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"max_tokens":99}`
+			req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := http.DefaultClient.Do(req)
+			if assert.NoError(t, err) {
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+				resp.Body.Close()
+			}
+		}(token)
+		// the requests are queued in order
+		assert.Eventually(t, func() bool { return queued() == i+1 }, time.Second, time.Millisecond)
+	}
+	wg.Wait()
+
+	// the caller of the higher priority is sent first, then the callers of the same priority take turns.
+	assert.Equal(t, []string{"team-c", "team-a", "team-b", "team-a", "team-a"}, provider.callers)
+}
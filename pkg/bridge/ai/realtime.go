@@ -0,0 +1,286 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+	"github.com/yomorun/yomo/pkg/id"
+	"golang.org/x/net/websocket"
+)
+
+// RealtimeProvider is implemented by the llm providers which serve the Realtime API over websocket.
+type RealtimeProvider interface {
+	// Realtime returns the websocket url and the headers of the Realtime API of the model.
+	Realtime(model string) (url string, header http.Header)
+}
+
+// GetProviderRealtime returns the Realtime API of the llm provider, ok is false if the provider doesn't serve it.
+func GetProviderRealtime(provider LLMProvider) (realtime RealtimeProvider, ok bool) {
+	provider = unwrapProvider(provider)
+	realtime, ok = provider.(RealtimeProvider)
+	return realtime, ok
+}
+
+var (
+	errRealtimeNotSupported = errors.New("the llm provider doesn't serve the Realtime API")
+	errRealtimeModel        = errors.New("model is required")
+)
+
+// realtimeDialTimeout is the timeout of dialing the Realtime API of the llm provider.
+const realtimeDialTimeout = 10 * time.Second
+
+// realtimeEvent is the type of the events of the Realtime API, the events are relayed as they are.
+type realtimeEvent struct {
+	Type      string `json:"type"`
+	CallID    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+}
+
+// HandleRealtime is the handler for the websocket /v1/realtime?model=xxx, the events are relayed between the
+// client and the Realtime API of the llm provider. The sfns are added to the tools of the session, and their
+// function calls are answered by the sfns, so the voice agents call the sfns as the tools without a round
+// trip to the client.
+func HandleRealtime(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		service = FromServiceContext(ctx)
+		transID = FromTransIDContext(ctx)
+	)
+	provider := GetProvider(service.LLMProvider.Name())
+	if provider == nil {
+		provider = service.LLMProvider
+	}
+	realtime, ok := GetProviderRealtime(provider)
+	if !ok {
+		RespondWithError(w, http.StatusBadRequest, errRealtimeNotSupported)
+		return
+	}
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		RespondWithError(w, http.StatusBadRequest, errRealtimeModel)
+		return
+	}
+	tagTools, err := register.ListToolCalls(service.requestMetadata(ctx))
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the llm provider is dialed before the upgrade, so its errors are responded as usual.
+	url, header := realtime.Realtime(model)
+	config, err := websocket.NewConfig(url, url)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	config.Header = header
+	config.Dialer = &net.Dialer{Timeout: realtimeDialTimeout}
+	upstream, err := websocket.DialConfig(config)
+	if err != nil {
+		ylog.Error("dial realtime api", "err", err.Error())
+		RespondWithError(w, http.StatusBadGateway, err)
+		return
+	}
+	defer upstream.Close()
+
+	server := websocket.Server{
+		// the clients on the edge devices don't send the origin, the browsers send the subprotocols.
+		Handshake: func(config *websocket.Config, _ *http.Request) error {
+			if slices.Contains(config.Protocol, "realtime") {
+				config.Protocol = []string{"realtime"}
+			} else {
+				config.Protocol = nil
+			}
+			return nil
+		},
+		Handler: func(client *websocket.Conn) {
+			session := &realtimeSession{
+				client:   client,
+				upstream: upstream,
+				service:  service,
+				transID:  transID,
+				tagTools: tagTools,
+			}
+			session.relay(context.WithoutCancel(ctx))
+		},
+	}
+	server.ServeHTTP(hijackableWriter{w}, r)
+}
+
+// hijackableWriter hijacks the connection through the wrapped writers, eg: the access log writer.
+type hijackableWriter struct {
+	http.ResponseWriter
+}
+
+func (w hijackableWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// realtimeSession relays the events between the client and the Realtime API of the llm provider.
+type realtimeSession struct {
+	client   *websocket.Conn
+	upstream *websocket.Conn
+	service  *Service
+	transID  string
+	tagTools map[uint32]openai.Tool
+
+	// mu serializes the writes to the upstream, the function call outputs are written by the goroutines of the calls.
+	mu sync.Mutex
+}
+
+func (s *realtimeSession) sendUpstream(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return websocket.Message.Send(s.upstream, msg)
+}
+
+// relay relays the events until one side is closed.
+func (s *realtimeSession) relay(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(s.tagTools) > 0 {
+		update, _ := json.Marshal(map[string]any{
+			"type":    "session.update",
+			"session": map[string]any{"tools": s.sfnTools(nil)},
+		})
+		if err := s.sendUpstream(string(update)); err != nil {
+			ylog.Error("update realtime session", "err", err.Error())
+			return
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the upstream is closed to stop relaying its events if the client goes away.
+		defer s.upstream.Close()
+		for {
+			var msg string
+			if err := websocket.Message.Receive(s.client, &msg); err != nil {
+				return
+			}
+			if err := s.sendUpstream(s.withSfnTools(msg)); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg string
+		if err := websocket.Message.Receive(s.upstream, &msg); err != nil {
+			break
+		}
+		if err := websocket.Message.Send(s.client, msg); err != nil {
+			break
+		}
+		var event realtimeEvent
+		if err := json.Unmarshal([]byte(msg), &event); err == nil && event.Type == "response.function_call_arguments.done" {
+			if tag, ok := s.sfnTag(event.Name); ok {
+				go s.callSfn(ctx, tag, event)
+			}
+		}
+	}
+	s.client.Close()
+	<-done
+}
+
+// withSfnTools adds the sfns to the tools of the session.update event of the client, the other events are
+// relayed as they are.
+func (s *realtimeSession) withSfnTools(msg string) string {
+	if len(s.tagTools) == 0 {
+		return msg
+	}
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(msg), &event); err != nil || string(event["type"]) != `"session.update"` {
+		return msg
+	}
+	var session map[string]json.RawMessage
+	if err := json.Unmarshal(event["session"], &session); err != nil {
+		return msg
+	}
+	var tools []json.RawMessage
+	_ = json.Unmarshal(session["tools"], &tools)
+
+	buf, _ := json.Marshal(s.sfnTools(tools))
+	session["tools"] = buf
+	event["session"], _ = json.Marshal(session)
+	merged, _ := json.Marshal(event)
+	return string(merged)
+}
+
+// sfnTools returns the tools of the client and the sfns in the format of the Realtime API, the tools of the
+// client win if their names collide.
+func (s *realtimeSession) sfnTools(tools []json.RawMessage) []json.RawMessage {
+	names := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		var tool responsesTool
+		_ = json.Unmarshal(t, &tool)
+		names[tool.Name] = true
+	}
+	for _, t := range s.tagTools {
+		if t.Function == nil || names[t.Function.Name] {
+			continue
+		}
+		tool := responsesTool{Type: string(openai.ToolTypeFunction), Name: t.Function.Name, Description: t.Function.Description}
+		if t.Function.Parameters != nil {
+			tool.Parameters, _ = json.Marshal(t.Function.Parameters)
+		}
+		buf, _ := json.Marshal(tool)
+		tools = append(tools, buf)
+	}
+	return tools
+}
+
+func (s *realtimeSession) sfnTag(name string) (uint32, bool) {
+	for tag, t := range s.tagTools {
+		if t.Function != nil && t.Function.Name == name {
+			return tag, true
+		}
+	}
+	return 0, false
+}
+
+// callSfn answers the function call by the sfn, the output is added to the conversation and a response is
+// requested, as the clients do for their own functions.
+func (s *realtimeSession) callSfn(ctx context.Context, tag uint32, event realtimeEvent) {
+	call := &openai.ToolCall{
+		ID:       event.CallID,
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: event.Name, Arguments: event.Arguments},
+	}
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+
+	base := &ai.FunctionCall{TransID: s.transID, ReqID: id.New(16)}
+	output := ""
+	results, err := s.service.runFunctionCalls(ctx, map[uint32][]*openai.ToolCall{tag: {call}}, base, nil)
+	if err != nil {
+		ylog.Error("call sfn of realtime session", "function", event.Name, "err", err.Error())
+		output = err.Error()
+	} else if len(results) > 0 {
+		output = results[0].Content
+	}
+
+	item, _ := json.Marshal(map[string]any{
+		"type": "conversation.item.create",
+		"item": map[string]any{"type": "function_call_output", "call_id": event.CallID, "output": output},
+	})
+	if err := s.sendUpstream(string(item)); err != nil {
+		return
+	}
+	_ = s.sendUpstream(`{"type":"response.create"}`)
+}
@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+	"golang.org/x/net/websocket"
+)
+
+type realtimeMockProvider struct {
+	MockLLMProvider
+	url string
+}
+
+func (p *realtimeMockProvider) Realtime(model string) (string, http.Header) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer sk-test")
+	return p.url + "?model=" + model, header
+}
+
+// realtimeToolNames returns the names of the tools of the session.update event.
+func realtimeToolNames(t *testing.T, msg string) []string {
+	var event struct {
+		Type    string `json:"type"`
+		Session struct {
+			Tools []responsesTool `json:"tools"`
+		} `json:"session"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(msg), &event))
+	assert.Equal(t, "session.update", event.Type)
+	names := make([]string, 0, len(event.Session.Tools))
+	for _, tool := range event.Session.Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestHandleRealtime(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0x71, &openai.FunctionDefinition{Name: "get-weather"}, 1071, md))
+	defer register.UnregisterFunction(1071, md)
+
+	received := make(chan string, 10)
+	authorization := make(chan string, 1)
+	upstream := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		authorization <- conn.Request().Header.Get("Authorization")
+		_ = websocket.Message.Send(conn, `{"type":"session.created"}`)
+		for {
+			var msg string
+			if err := websocket.Message.Receive(conn, &msg); err != nil {
+				return
+			}
+			received <- msg
+		}
+	}))
+	defer upstream.Close()
+
+	provider := &realtimeMockProvider{url: "ws" + strings.TrimPrefix(upstream.URL, "http")}
+	service := &Service{LLMProvider: provider, Metadata: md}
+	bridge := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		HandleRealtime(w, r.WithContext(WithServiceContext(r.Context(), service)))
+	}))
+	defer bridge.Close()
+
+	t.Run("model is required", func(t *testing.T) {
+		resp, err := http.Get(bridge.URL + "/v1/realtime")
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	client, err := websocket.Dial("ws"+strings.TrimPrefix(bridge.URL, "http")+"/v1/realtime?model=gpt-4o-realtime-preview", "", "http://localhost")
+	assert.NoError(t, err)
+	defer client.Close()
+
+	assert.Equal(t, "Bearer sk-test", <-authorization)
+
+	// the sfns are added to the session when it starts.
+	select {
+	case msg := <-received:
+		assert.Contains(t, realtimeToolNames(t, msg), "get-weather")
+	case <-time.After(time.Second):
+		t.Fatal("the session is not updated")
+	}
+
+	// the events of the llm provider are relayed to the client.
+	var msg string
+	assert.NoError(t, websocket.Message.Receive(client, &msg))
+	assert.JSONEq(t, `{"type":"session.created"}`, msg)
+
+	// the sfns are added to the tools of the client.
+	assert.NoError(t, websocket.Message.Send(client, `{"type":"session.update","session":{"voice":"alloy","tools":[{"type":"function","name":"local"}]}}`))
+	select {
+	case msg := <-received:
+		names := realtimeToolNames(t, msg)
+		assert.Equal(t, "local", names[0])
+		assert.Contains(t, names, "get-weather")
+		assert.Contains(t, msg, `"voice":"alloy"`)
+	case <-time.After(time.Second):
+		t.Fatal("the session.update is not relayed")
+	}
+
+	// the other events are relayed as they are.
+	assert.NoError(t, websocket.Message.Send(client, `{"type":"response.create"}`))
+	select {
+	case msg := <-received:
+		assert.Equal(t, `{"type":"response.create"}`, msg)
+	case <-time.After(time.Second):
+		t.Fatal("the event is not relayed")
+	}
+}
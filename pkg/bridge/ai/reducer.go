@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"sync/atomic"
+
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/serverless"
+)
+
+// ReduceFunc reduces the result of a tool call into the pending chat completion of the service. The results
+// are the envelopes written by the llm-sfns to ai.ReducerTag, see ai.FunctionCallVersion, the progress chunks
+// have IsPartial set, and the final result of the tool call is delivered to the attempt of ai.FunctionCall.Attempt.
+// It is safe for concurrent use.
+type ReduceFunc func(result *ai.FunctionCall)
+
+// ReducerBuilder builds the reducer StreamFunction of the service created for the credential, the service
+// connects it. The reducer observes ai.ReducerTag with the credential, decodes the results of the tool calls
+// and passes them to reduce, eg: a reducer which post-processes or persists the tool results before reducing
+// them. ReducerHandler decodes the results for the custom reducers.
+type ReducerBuilder func(zipperAddr, credential string, reduce ReduceFunc) (yomo.StreamFunction, error)
+
+// ServiceOptions are the options of the services created for the credentials.
+type ServiceOptions struct {
+	// ReducerBuilder builds the reducer of the services, DefaultReducerBuilder is used if it is nil.
+	ReducerBuilder ReducerBuilder
+	// MaxToolRounds is the max rounds of the tool calls of a chat completion, the model is called with the
+	// results of the tool calls until it answers without calling the tools, and the call after the last round
+	// is made without the tools. DefaultMaxToolRounds is used if it is 0.
+	MaxToolRounds int
+	// RequestGuards check the chat completion requests in order before they reach the llm provider.
+	RequestGuards []RequestGuard
+	// ResponseGuards check the answers of the llm provider in order before they are written to the clients.
+	ResponseGuards []ResponseGuard
+}
+
+var serviceOptions atomic.Pointer[ServiceOptions]
+
+// ConfigureServiceOptions sets the options of the services, the services created later apply them.
+func ConfigureServiceOptions(opts ServiceOptions) {
+	serviceOptions.Store(&opts)
+}
+
+func getServiceOptions() ServiceOptions {
+	if opts := serviceOptions.Load(); opts != nil {
+		return *opts
+	}
+	return ServiceOptions{}
+}
+
+// DefaultReducerBuilder builds the default reducer, it reduces the results of the tool calls as they are.
+func DefaultReducerBuilder(zipperAddr, credential string, reduce ReduceFunc) (yomo.StreamFunction, error) {
+	sfn := yomo.NewStreamFunction(
+		"ai-reducer",
+		zipperAddr,
+		yomo.WithSfnReConnect(),
+		yomo.WithSfnCredential(credential),
+	)
+	sfn.SetObserveDataTags(ai.ReducerTag)
+	if err := sfn.SetHandler(ReducerHandler(reduce)); err != nil {
+		return nil, err
+	}
+	return sfn, nil
+}
+
+// ReducerHandler returns the handler of the reducer StreamFunction, it decodes the results of the tool calls
+// and passes them to reduce, the results which can't be decoded are dropped.
+func ReducerHandler(reduce ReduceFunc) func(ctx serverless.Context) {
+	return func(ctx serverless.Context) {
+		ylog.Debug("[sfn-reducer]", "tag", ai.ReducerTag, "data", string(ctx.Data()))
+		invoke := &ai.FunctionCall{}
+		if err := ctx.ReadLLMFunctionCall(invoke); err != nil {
+			ylog.Error("[sfn-reducer] parse function calling invoke", "err", err.Error())
+			return
+		}
+		reduce(invoke)
+	}
+}
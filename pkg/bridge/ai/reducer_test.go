@@ -0,0 +1,72 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/serverless"
+)
+
+// resultContext is the context of the reducer carrying the result of the tool call.
+type resultContext struct {
+	serverless.Context
+	data []byte
+}
+
+func (c *resultContext) Data() []byte { return c.data }
+
+func (c *resultContext) ReadLLMFunctionCall(fnCall any) error {
+	return fnCall.(*ai.FunctionCall).FromBytes(c.data)
+}
+
+func TestReducerHandler(t *testing.T) {
+	var reduced []*ai.FunctionCall
+	handler := ReducerHandler(func(result *ai.FunctionCall) {
+		reduced = append(reduced, result)
+	})
+
+	handler(&resultContext{data: []byte(`{"v":1,"req_id":"req-1","tool_call_id":"call-1","is_ok":true,"result":"sunny"}`)})
+	handler(&resultContext{data: []byte(`{"v":2,"req_id":"req-1"}`)})
+	handler(&resultContext{data: []byte(`{a}`)})
+
+	assert.Len(t, reduced, 1)
+	assert.Equal(t, "sunny", reduced[0].Result)
+}
+
+func TestServiceReduce(t *testing.T) {
+	var progress []ai.ToolProgress
+	c := newTestAsyncCall()
+	c.onProgress = func(p ai.ToolProgress) { progress = append(progress, p) }
+	a := c.begin("call-1", 1, 1)
+
+	s := &Service{sfnCallCache: map[string]*sfnAsyncCall{"req-1": c}}
+
+	// the unknown request is dropped
+	s.reduce(&ai.FunctionCall{ReqID: "req-2", ToolCallID: "call-1", IsOK: true})
+
+	s.reduce(&ai.FunctionCall{ReqID: "req-1", ToolCallID: "call-1", IsPartial: true, Result: "1 row found"})
+	s.reduce(&ai.FunctionCall{ReqID: "req-1", ToolCallID: "call-1", Attempt: 1, IsOK: true, Result: "2 rows found"})
+
+	<-a.done
+	assert.Equal(t, []ai.ToolProgress{{ToolCallID: "call-1", Content: "1 row found"}}, progress)
+	assert.Equal(t, "2 rows found", a.result.Result)
+}
+
+func TestConfigureServiceOptions(t *testing.T) {
+	t.Cleanup(func() { serviceOptions.Store(nil) })
+	assert.Nil(t, getServiceOptions().ReducerBuilder)
+
+	var built bool
+	ConfigureServiceOptions(ServiceOptions{
+		ReducerBuilder: func(zipperAddr, credential string, reduce ReduceFunc) (yomo.StreamFunction, error) {
+			built = true
+			return DefaultReducerBuilder(zipperAddr, credential, reduce)
+		},
+	})
+	sfn, err := getServiceOptions().ReducerBuilder("localhost:9000", "token", func(*ai.FunctionCall) {})
+	assert.NoError(t, err)
+	assert.NotNil(t, sfn)
+	assert.True(t, built)
+}
@@ -2,11 +2,17 @@
 package register
 
 import (
+	"encoding/json"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/sashabaranov/go-openai"
 	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core/metadata"
+	"golang.org/x/mod/semver"
+	"golang.org/x/text/language"
 )
 
 var (
@@ -15,6 +21,11 @@ var (
 	defaultRegister Register
 )
 
+// DenyUnscoped makes the function visibility deny by default, it is for the multi-tenant zippers.
+// By default, the functions without scopes are visible to all the credentials, if DenyUnscoped is true,
+// a function is visible only if the scopes of the function and the credential overlap.
+var DenyUnscoped atomic.Bool
+
 func init() {
 	SetRegister(&register{})
 }
@@ -43,6 +54,11 @@ func RegisterFunction(tag uint32, functionDefinition *openai.FunctionDefinition,
 	return defaultRegister.RegisterFunction(tag, functionDefinition, connID, md)
 }
 
+// ResolveFunction returns the tag and the tool of the function by its name or alias
+func ResolveFunction(name string, md metadata.M) (uint32, openai.Tool, bool) {
+	return defaultRegister.ResolveFunction(name, md)
+}
+
 // UnregisterFunction unregisters a function calling function
 func UnregisterFunction(connID uint64, md metadata.M) {
 	defaultRegister.UnregisterFunction(connID, md)
@@ -53,10 +69,22 @@ func SfnFactor(tag uint32, md metadata.M) int {
 	return defaultRegister.SfnFactor(tag, md)
 }
 
+// CallPolicy returns the call policy of the function
+func CallPolicy(tag uint32, md metadata.M) ai.CallPolicy {
+	return defaultRegister.CallPolicy(tag, md)
+}
+
 type connectedFn struct {
-	connID uint64
-	tag    uint32
-	tools  openai.Tool
+	connID  uint64
+	tag     uint32
+	tools   openai.Tool
+	version string
+	aliases []string
+	// locales are the languages of the localized descriptions, the first one is the default description.
+	locales      []language.Tag
+	descriptions []string
+	policy       ai.CallPolicy
+	scopes       []string
 }
 
 // Register provides an stateful register for registering and unregistering functions
@@ -65,10 +93,14 @@ type Register interface {
 	ListToolCalls(md metadata.M) (map[uint32]openai.Tool, error)
 	// RegisterFunction registers a function calling function
 	RegisterFunction(tag uint32, functionDefinition *openai.FunctionDefinition, connID uint64, md metadata.M) error
+	// ResolveFunction returns the tag and the tool of the function by its name or alias
+	ResolveFunction(name string, md metadata.M) (uint32, openai.Tool, bool)
 	// UnregisterFunction unregisters a function calling function
 	UnregisterFunction(connID uint64, md metadata.M)
 	// SfnFactor returns the sfn factor
 	SfnFactor(tag uint32, md metadata.M) int
+	// CallPolicy returns the call policy of the function
+	CallPolicy(tag uint32, md metadata.M) ai.CallPolicy
 }
 
 type register struct {
@@ -78,24 +110,144 @@ type register struct {
 func (r *register) ListToolCalls(md metadata.M) (map[uint32]openai.Tool, error) {
 	result := make(map[uint32]openai.Tool)
 
+	acceptLanguage, _ := md.Get(ai.AcceptLanguageKey)
+	for _, fn := range r.exposedFunctions(md) {
+		result[fn.tag] = fn.localize(acceptLanguage)
+	}
+
+	return result, nil
+}
+
+func (r *register) ResolveFunction(name string, md metadata.M) (uint32, openai.Tool, bool) {
+	for _, fn := range r.exposedFunctions(md) {
+		if fn.tools.Function.Name == name || slices.Contains(fn.aliases, name) {
+			return fn.tag, fn.tools, true
+		}
+	}
+	return 0, openai.Tool{}, false
+}
+
+// exposedFunctions returns one version of every function, it is the version pinned by the metadata
+// if it is registered, otherwise the latest version.
+func (r *register) exposedFunctions(md metadata.M) []*connectedFn {
+	versions := make(map[string][]*connectedFn)
+	scopes := parseScopes(md)
 	r.underlying.Range(func(_, value any) bool {
 		fn := value.(*connectedFn)
-		result[fn.tag] = fn.tools
+		if !fn.visibleTo(scopes) {
+			return true
+		}
+		name := fn.tools.Function.Name
+		versions[name] = append(versions[name], fn)
 		return true
 	})
 
-	return result, nil
+	var result []*connectedFn
+	for name, fns := range versions {
+		version := fns[0].version
+		for _, fn := range fns[1:] {
+			if compareVersion(fn.version, version) > 0 {
+				version = fn.version
+			}
+		}
+		if pinned, ok := md.Get(ai.FunctionVersionPinKey(name)); ok {
+			if slices.ContainsFunc(fns, func(fn *connectedFn) bool { return fn.version == pinned }) {
+				version = pinned
+			}
+		}
+		for _, fn := range fns {
+			if fn.version == version {
+				result = append(result, fn)
+			}
+		}
+	}
+	return result
+}
+
+// visibleTo reports whether the function is visible to the credential of the scopes.
+func (fn *connectedFn) visibleTo(scopes []string) bool {
+	if len(fn.scopes) == 0 && !DenyUnscoped.Load() {
+		return true
+	}
+	for _, scope := range scopes {
+		if scope == "*" || slices.Contains(fn.scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseScopes returns the scopes in the metadata.
+func parseScopes(md metadata.M) []string {
+	v, _ := md.Get(ai.ScopeKey)
+	return metadata.ParseScopes(v)
+}
+
+// localize returns the tool with the description in the best matched language of the acceptLanguage,
+// which is in the format of the Accept-Language header, the default description is used if none matches.
+func (fn *connectedFn) localize(acceptLanguage string) openai.Tool {
+	if acceptLanguage == "" || len(fn.locales) == 1 {
+		return fn.tools
+	}
+	prefs, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(prefs) == 0 {
+		return fn.tools
+	}
+	_, i, confidence := language.NewMatcher(fn.locales).Match(prefs...)
+	if i == 0 || confidence == language.No {
+		return fn.tools
+	}
+	// the definition is shared, so it is copied before being localized
+	definition := *fn.tools.Function
+	definition.Description = fn.descriptions[i]
+	return openai.Tool{Type: fn.tools.Type, Function: &definition}
+}
+
+// compareVersion compares the versions in semantic versioning, the "v" prefix is optional,
+// and the invalid versions are considered older than the valid ones.
+func compareVersion(v, w string) int {
+	if v != "" && !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if w != "" && !strings.HasPrefix(w, "v") {
+		w = "v" + w
+	}
+	return semver.Compare(v, w)
 }
 
 func (r *register) RegisterFunction(tag uint32, functionDefinition *ai.FunctionDefinition, connID uint64, md metadata.M) error {
-	r.underlying.Store(connID, &connectedFn{
+	fn := &connectedFn{
 		connID: connID,
 		tag:    tag,
 		tools: openai.Tool{
 			Type:     openai.ToolTypeFunction,
 			Function: functionDefinition,
 		},
-	})
+	}
+	fn.version, _ = md.Get(ai.FunctionVersionKey)
+	fn.scopes = parseScopes(md)
+	if aliases, ok := md.Get(ai.FunctionAliasesKey); ok && aliases != "" {
+		fn.aliases = strings.Split(aliases, ",")
+	}
+	if policy, ok := md.Get(ai.FunctionPolicyKey); ok {
+		if err := json.Unmarshal([]byte(policy), &fn.policy); err != nil {
+			return err
+		}
+	}
+	fn.locales = []language.Tag{language.Und}
+	fn.descriptions = []string{functionDefinition.Description}
+	prefix := ai.FunctionDescriptionKey("")
+	for k, v := range md {
+		if lang, ok := strings.CutPrefix(k, prefix); ok {
+			tag, err := language.Parse(lang)
+			if err != nil {
+				continue
+			}
+			fn.locales = append(fn.locales, tag)
+			fn.descriptions = append(fn.descriptions, v)
+		}
+	}
+	r.underlying.Store(connID, fn)
 
 	return nil
 }
@@ -107,12 +259,28 @@ func (r *register) UnregisterFunction(connID uint64, _ metadata.M) {
 // SfnFactor returns the sfn factor
 func (r *register) SfnFactor(tag uint32, md metadata.M) int {
 	factor := 0
+	scopes := parseScopes(md)
 	r.underlying.Range(func(key, value any) bool {
 		fn := value.(*connectedFn)
-		if fn.tag == tag {
+		if fn.tag == tag && fn.visibleTo(scopes) {
 			factor++
 		}
 		return true
 	})
 	return factor
 }
+
+// CallPolicy returns the call policy of the function
+func (r *register) CallPolicy(tag uint32, md metadata.M) ai.CallPolicy {
+	var policy ai.CallPolicy
+	scopes := parseScopes(md)
+	r.underlying.Range(func(key, value any) bool {
+		fn := value.(*connectedFn)
+		if fn.tag == tag && fn.visibleTo(scopes) {
+			policy = fn.policy
+			return false
+		}
+		return true
+	})
+	return policy
+}
@@ -1,6 +1,8 @@
 package register
 
 import (
+	"fmt"
+	"slices"
 	"testing"
 
 	"github.com/sashabaranov/go-openai"
@@ -79,3 +81,138 @@ func TestSfnFactor(t *testing.T) {
 	UnregisterFunction(2, metadata.M{})
 	assert.Equal(t, 0, SfnFactor(1, metadata.M{}))
 }
+
+func TestRegisterVersion(t *testing.T) {
+	r := &register{}
+
+	v1 := &ai.FunctionDefinition{Name: "get-weather", Description: "v1"}
+	v2 := &ai.FunctionDefinition{Name: "get-weather", Description: "v2"}
+	v10 := &ai.FunctionDefinition{Name: "get-weather", Description: "v10"}
+
+	r.RegisterFunction(1, v1, 1, metadata.M{ai.FunctionVersionKey: "1.0.0"})
+	r.RegisterFunction(2, v2, 2, metadata.M{ai.FunctionVersionKey: "2.0.0", ai.FunctionAliasesKey: "weather,forecast"})
+	r.RegisterFunction(3, v10, 3, metadata.M{ai.FunctionVersionKey: "10.0.0-beta"})
+
+	t.Run("latest", func(t *testing.T) {
+		r.UnregisterFunction(3, nil)
+		defer r.RegisterFunction(3, v10, 3, metadata.M{ai.FunctionVersionKey: "10.0.0-beta"})
+
+		toolCalls, err := r.ListToolCalls(nil)
+		assert.NoError(t, err)
+		assertToolCalls(t, 2, v2, toolCalls)
+	})
+
+	t.Run("prerelease is newer", func(t *testing.T) {
+		toolCalls, err := r.ListToolCalls(metadata.M{})
+		assert.NoError(t, err)
+		assertToolCalls(t, 3, v10, toolCalls)
+	})
+
+	t.Run("pinned", func(t *testing.T) {
+		toolCalls, err := r.ListToolCalls(metadata.M{ai.FunctionVersionPinKey("get-weather"): "1.0.0"})
+		assert.NoError(t, err)
+		assertToolCalls(t, 1, v1, toolCalls)
+	})
+
+	t.Run("pinned version is not registered", func(t *testing.T) {
+		toolCalls, err := r.ListToolCalls(metadata.M{ai.FunctionVersionPinKey("get-weather"): "3.0.0"})
+		assert.NoError(t, err)
+		assertToolCalls(t, 3, v10, toolCalls)
+	})
+
+	t.Run("alias", func(t *testing.T) {
+		md := metadata.M{ai.FunctionVersionPinKey("get-weather"): "2.0.0"}
+
+		tag, tool, ok := r.ResolveFunction("forecast", md)
+		assert.True(t, ok)
+		assert.Equal(t, uint32(2), tag)
+		assert.Equal(t, v2, tool.Function)
+
+		tag, _, ok = r.ResolveFunction("get-weather", md)
+		assert.True(t, ok)
+		assert.Equal(t, uint32(2), tag)
+
+		_, _, ok = r.ResolveFunction("forecast", nil)
+		assert.False(t, ok, "the alias is only available in the version which declares it")
+	})
+}
+
+func TestRegisterLocalizedDescription(t *testing.T) {
+	r := &register{}
+
+	definition := &ai.FunctionDefinition{Name: "get-weather", Description: "get the weather"}
+	r.RegisterFunction(1, definition, 1, metadata.M{
+		ai.FunctionDescriptionKey("zh-CN"): "获取天气",
+		ai.FunctionDescriptionKey("fr"):    "obtenir la météo",
+	})
+
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{acceptLanguage: "", want: "get the weather"},
+		{acceptLanguage: "zh-CN,zh;q=0.9,en;q=0.8", want: "获取天气"},
+		{acceptLanguage: "zh", want: "获取天气"},
+		{acceptLanguage: "fr-CA", want: "obtenir la météo"},
+		{acceptLanguage: "de-DE", want: "get the weather"},
+		{acceptLanguage: "invalid;;", want: "get the weather"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			toolCalls, err := r.ListToolCalls(metadata.M{ai.AcceptLanguageKey: tt.acceptLanguage})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, toolCalls[1].Function.Description)
+		})
+	}
+	assert.Equal(t, "get the weather", definition.Description, "the registered definition is not changed")
+}
+
+func TestRegisterScope(t *testing.T) {
+	r := &register{}
+	for i, scope := range []string{"", "tenant-a", "tenant-b,tenant-c"} {
+		md := metadata.M{}
+		if scope != "" {
+			md.Set(ai.ScopeKey, scope)
+		}
+		fd := &ai.FunctionDefinition{Name: fmt.Sprintf("function%d", i)}
+		assert.NoError(t, r.RegisterFunction(uint32(i), fd, uint64(i), md))
+	}
+
+	tests := []struct {
+		name         string
+		scope        string
+		denyUnscoped bool
+		want         []uint32
+	}{
+		{name: "no scope", want: []uint32{0}},
+		{name: "tenant-a", scope: "tenant-a", want: []uint32{0, 1}},
+		{name: "tenant-c", scope: "tenant-x, tenant-c", want: []uint32{0, 2}},
+		{name: "wildcard", scope: "*", want: []uint32{0, 1, 2}},
+		{name: "deny no scope", denyUnscoped: true, want: []uint32{}},
+		{name: "deny tenant-a", scope: "tenant-a", denyUnscoped: true, want: []uint32{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			DenyUnscoped.Store(tt.denyUnscoped)
+			defer DenyUnscoped.Store(false)
+
+			md := metadata.M{}
+			if tt.scope != "" {
+				md.Set(ai.ScopeKey, tt.scope)
+			}
+			toolCalls, err := r.ListToolCalls(md)
+			assert.NoError(t, err)
+
+			tags := []uint32{}
+			for tag := range toolCalls {
+				tags = append(tags, tag)
+			}
+			assert.ElementsMatch(t, tt.want, tags)
+
+			// the invisible functions can not be invoked
+			_, _, ok := r.ResolveFunction("function1", md)
+			assert.Equal(t, slices.Contains(tt.want, 1), ok)
+			assert.Equal(t, slices.Contains(tt.want, 1), r.SfnFactor(1, md) == 1)
+		})
+	}
+}
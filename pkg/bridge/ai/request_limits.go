@@ -0,0 +1,60 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// RequestLimits is the configuration of the limits of the requests, the requests exceeding them are rejected
+// before they are read into memory or sent to the llm provider.
+type RequestLimits struct {
+	MaxBodyBytes int64 `yaml:"max_body_bytes"` // MaxBodyBytes is the max size of the request body, default is 10MB, it responds 413 if exceeded
+	MaxMessages  int   `yaml:"max_messages"`   // MaxMessages is the max number of the messages of a chat completion request, it's not limited if it is 0
+	MaxTools     int   `yaml:"max_tools"`      // MaxTools is the max number of the tools of a chat completion request, it's not limited if it is 0
+}
+
+// defaultMaxBodyBytes is the default max size of the request body.
+const defaultMaxBodyBytes = 10 << 20
+
+var requestLimits atomic.Pointer[RequestLimits]
+
+func init() {
+	ConfigureRequestLimits(RequestLimits{})
+}
+
+// ConfigureRequestLimits limits the requests by the config.
+func ConfigureRequestLimits(conf RequestLimits) {
+	if conf.MaxBodyBytes <= 0 {
+		conf.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	requestLimits.Store(&conf)
+}
+
+// limitRequestBody limits the size of the request body, reading more than the limit fails with *http.MaxBytesError.
+func limitRequestBody(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, requestLimits.Load().MaxBodyBytes)
+}
+
+// readBodyErrorCode returns the status code of the error of reading the request body.
+func readBodyErrorCode(err error) int {
+	if maxBytesErr := new(http.MaxBytesError); errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// validateChatCompletionRequest validates the number of the messages and the tools of the request.
+func validateChatCompletionRequest(req openai.ChatCompletionRequest) error {
+	limits := requestLimits.Load()
+	if limits.MaxMessages > 0 && len(req.Messages) > limits.MaxMessages {
+		return fmt.Errorf("too many messages: %d, the max is %d", len(req.Messages), limits.MaxMessages)
+	}
+	if limits.MaxTools > 0 && len(req.Tools) > limits.MaxTools {
+		return fmt.Errorf("too many tools: %d, the max is %d", len(req.Tools), limits.MaxTools)
+	}
+	return nil
+}
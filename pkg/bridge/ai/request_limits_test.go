@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestLimits(t *testing.T) {
+	t.Cleanup(func() { ConfigureRequestLimits(RequestLimits{}) })
+	ConfigureRequestLimits(RequestLimits{MaxBodyBytes: 256, MaxMessages: 2, MaxTools: 1})
+
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "body too large",
+			body:         `{"messages":[{"role":"user","content":"` + strings.Repeat("a", 256) + `"}]}`,
+			expectedCode: http.StatusRequestEntityTooLarge,
+			expectedBody: `{"error":{"code":"413","message":"http: request body too large"}}`,
+		},
+		{
+			name:         "too many messages",
+			body:         `{"messages":[{"role":"user","content":"a"},{"role":"assistant","content":"b"},{"role":"user","content":"c"}]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":{"code":"400","message":"too many messages: 3, the max is 2"}}`,
+		},
+		{
+			name:         "too many tools",
+			body:         `{"messages":[{"role":"user","content":"a"}],"tools":[{"type":"function"},{"type":"function"}]}`,
+			expectedCode: http.StatusBadRequest,
+			expectedBody: `{"error":{"code":"400","message":"too many tools: 2, the max is 1"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(tt.body))
+
+			HandleChatCompletions(w, r)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package ai
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+// ResponseCache is the configuration of the cache of the non-streaming chat completions, the responses are
+// cached by the exact match of the normalized requests of every credential.
+type ResponseCache struct {
+	TTL        time.Duration `yaml:"ttl"`         // TTL is the time the responses are cached, default is 5m
+	MaxEntries int           `yaml:"max_entries"` // MaxEntries is the max number of the cached responses, the oldest ones are evicted, default is 1000
+}
+
+const (
+	// ResponseCacheHeader is the response header which tells whether the response is served by the cache, it's
+	// hit or miss.
+	ResponseCacheHeader = "X-YoMo-Cache"
+
+	defaultResponseCacheTTL        = 5 * time.Minute
+	defaultResponseCacheMaxEntries = 1000
+)
+
+// responseCache is the cache of the chat completions, it is disabled if it is nil.
+var responseCache atomic.Pointer[completionCache]
+
+// ConfigureResponseCache caches the non-streaming chat completions by the config.
+func ConfigureResponseCache(conf ResponseCache) {
+	if conf.TTL <= 0 {
+		conf.TTL = defaultResponseCacheTTL
+	}
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = defaultResponseCacheMaxEntries
+	}
+	responseCache.Store(newCompletionCache(conf))
+}
+
+// completionCache stores the chat completions by the keys of the requests, the responses expire in the order
+// of creation.
+type completionCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	order      *list.List // the front is the oldest
+	ttl        time.Duration
+	maxEntries int
+}
+
+type cachedCompletion struct {
+	key       string
+	resp      openai.ChatCompletionResponse
+	createdAt time.Time
+}
+
+func newCompletionCache(conf ResponseCache) *completionCache {
+	return &completionCache{
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		ttl:        conf.TTL,
+		maxEntries: conf.MaxEntries,
+	}
+}
+
+// get returns the cached response of the key, the expired responses are missed.
+func (c *completionCache) get(key string) (openai.ChatCompletionResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.evictExpired(time.Now())
+	elem, ok := c.entries[key]
+	if !ok {
+		return openai.ChatCompletionResponse{}, false
+	}
+	resp := elem.Value.(*cachedCompletion).resp
+	resp.Choices = slices.Clone(resp.Choices)
+	return resp, true
+}
+
+// put caches the response of the key, the oldest responses are evicted if there are more than max entries.
+func (c *completionCache) put(key string, resp openai.ChatCompletionResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	resp.Choices = slices.Clone(resp.Choices)
+	c.entries[key] = c.order.PushBack(&cachedCompletion{key: key, resp: resp, createdAt: time.Now()})
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Front())
+	}
+}
+
+// evictExpired evicts the responses cached before the ttl, the caller must hold the lock.
+func (c *completionCache) evictExpired(now time.Time) {
+	for elem := c.order.Front(); elem != nil; elem = c.order.Front() {
+		if now.Sub(elem.Value.(*cachedCompletion).createdAt) <= c.ttl {
+			return
+		}
+		c.remove(elem)
+	}
+}
+
+func (c *completionCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*cachedCompletion)
+	delete(c.entries, entry.key)
+}
+
+// responseCacheKey returns the key of the request of the credential. The request is normalized, so the requests
+// differ in the stream options, the user, the order of the tools or the spaces around the messages share the key.
+func responseCacheKey(credential string, req openai.ChatCompletionRequest) (string, error) {
+	req.Stream, req.StreamOptions, req.User = false, nil, ""
+
+	req.Messages = slices.Clone(req.Messages)
+	for i := range req.Messages {
+		req.Messages[i].Content = strings.TrimSpace(req.Messages[i].Content)
+	}
+	req.Tools = slices.Clone(req.Tools)
+	slices.SortStableFunc(req.Tools, func(a, b openai.Tool) int {
+		return strings.Compare(toolName(a), toolName(b))
+	})
+
+	b, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(credentialHash(credential)+"\n"), b...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func toolName(tool openai.Tool) string {
+	if tool.Function == nil {
+		return ""
+	}
+	return tool.Function.Name
+}
+
+// cachedProvider serves the non-streaming chat completions of the credential by the response cache. The requests
+// with `Cache-Control: no-cache` are not served by the cache, and the responses of the requests with
+// `Cache-Control: no-store` are not cached either.
+type cachedProvider struct {
+	LLMProvider
+	credential string
+}
+
+// GetChatCompletions implements LLMProvider.
+func (p *cachedProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	cache := responseCache.Load()
+	noCache, noStore := fromCacheControlContext(ctx)
+	if cache == nil || noStore {
+		return p.LLMProvider.GetChatCompletions(ctx, req, md)
+	}
+	key, err := responseCacheKey(p.credential, req)
+	if err != nil {
+		return p.LLMProvider.GetChatCompletions(ctx, req, md)
+	}
+
+	header := fromResponseHeaderContext(ctx)
+	if !noCache {
+		if resp, ok := cache.get(key); ok {
+			if header != nil {
+				header.Set(ResponseCacheHeader, "hit")
+			}
+			return resp, nil
+		}
+	}
+	resp, err := p.LLMProvider.GetChatCompletions(ctx, req, md)
+	if err != nil {
+		return resp, err
+	}
+	cache.put(key, resp)
+	if header != nil {
+		header.Set(ResponseCacheHeader, "miss")
+	}
+	return resp, nil
+}
+
+type cacheControlContextKey struct{}
+
+// withCacheControlContext adds the Cache-Control header of the request to the context.
+func withCacheControlContext(ctx context.Context, cacheControl string) context.Context {
+	if cacheControl == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, cacheControlContextKey{}, cacheControl)
+}
+
+// fromCacheControlContext returns the no-cache and no-store directives of the Cache-Control header of the request.
+func fromCacheControlContext(ctx context.Context) (noCache bool, noStore bool) {
+	cacheControl, _ := ctx.Value(cacheControlContextKey{}).(string)
+	for _, directive := range strings.Split(cacheControl, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noStore = true
+		}
+	}
+	return noCache, noStore
+}
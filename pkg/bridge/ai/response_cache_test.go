@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+// countingProvider counts the chat completions answered by the completionsProvider.
+type countingProvider struct {
+	completionsProvider
+	calls int
+}
+
+func (p *countingProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	p.calls++
+	return p.completionsProvider.GetChatCompletions(ctx, req, md)
+}
+
+func TestResponseCache(t *testing.T) {
+	t.Cleanup(func() { responseCache.Store(nil) })
+	ConfigureResponseCache(ResponseCache{MaxEntries: 2})
+
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+		Tools: []openai.Tool{
+			{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "a"}},
+			{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "b"}},
+		},
+	}
+	// the same request but the spaces, the order of the tools and the user.
+	same := req
+	same.Messages = []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: " hello\n"}}
+	same.Tools = []openai.Tool{req.Tools[1], req.Tools[0]}
+	same.User = "user-1"
+
+	other := req
+	other.Model = "gpt-4o-mini"
+
+	tests := []struct {
+		name           string
+		credential     string
+		req            openai.ChatCompletionRequest
+		cacheControl   string
+		expectedCalls  int
+		expectedHeader string
+	}{
+		{name: "miss", credential: "token", req: req, expectedCalls: 1, expectedHeader: "miss"},
+		{name: "hit", credential: "token", req: req, expectedCalls: 1, expectedHeader: "hit"},
+		{name: "normalized", credential: "token", req: same, expectedCalls: 1, expectedHeader: "hit"},
+		{name: "another model", credential: "token", req: other, expectedCalls: 2, expectedHeader: "miss"},
+		{name: "another credential", credential: "other", req: req, expectedCalls: 3, expectedHeader: "miss"},
+		{name: "no-cache", credential: "token", req: req, cacheControl: "no-cache", expectedCalls: 4, expectedHeader: "miss"},
+		{name: "no-store", credential: "token", req: req, cacheControl: "max-age=0, No-Store", expectedCalls: 5},
+	}
+	provider := &countingProvider{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			ctx := withResponseHeaderContext(context.Background(), header)
+			ctx = withCacheControlContext(ctx, tt.cacheControl)
+
+			cached := &cachedProvider{LLMProvider: provider, credential: tt.credential}
+			resp, err := cached.GetChatCompletions(ctx, tt.req, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "chatcmpl-1", resp.ID)
+			assert.Equal(t, tt.expectedCalls, provider.calls)
+			assert.Equal(t, tt.expectedHeader, header.Get(ResponseCacheHeader))
+		})
+	}
+
+	t.Run("the oldest is evicted", func(t *testing.T) {
+		ConfigureResponseCache(ResponseCache{MaxEntries: 2})
+		cached := &cachedProvider{LLMProvider: provider, credential: "token"}
+		for _, r := range []openai.ChatCompletionRequest{req, other, req} {
+			_, err := cached.GetChatCompletions(context.Background(), r, nil)
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, 7, provider.calls)
+
+		third := req
+		third.Model = "o1"
+		// the first cached request is evicted by the third one.
+		_, _ = cached.GetChatCompletions(context.Background(), third, nil)
+		_, _ = cached.GetChatCompletions(context.Background(), req, nil)
+		assert.Equal(t, 9, provider.calls)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ConfigureResponseCache(ResponseCache{TTL: time.Millisecond})
+		cached := &cachedProvider{LLMProvider: provider, credential: "token"}
+		_, _ = cached.GetChatCompletions(context.Background(), req, nil)
+		time.Sleep(5 * time.Millisecond)
+		_, _ = cached.GetChatCompletions(context.Background(), req, nil)
+		assert.Equal(t, 11, provider.calls)
+	})
+}
@@ -0,0 +1,556 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// responsesRequest is the request of the Responses API, the input can be a string or an array of the input
+// items, so it is decoded by itself.
+type responsesRequest struct {
+	Model              string            `json:"model"`
+	Input              json.RawMessage   `json:"input"`
+	Instructions       string            `json:"instructions,omitempty"`
+	Tools              []responsesTool   `json:"tools,omitempty"`
+	Stream             bool              `json:"stream,omitempty"`
+	Temperature        float32           `json:"temperature,omitempty"`
+	TopP               float32           `json:"top_p,omitempty"`
+	MaxOutputTokens    int               `json:"max_output_tokens,omitempty"`
+	PreviousResponseID string            `json:"previous_response_id,omitempty"`
+	User               string            `json:"user,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// responsesTool is the tool of the Responses API, the function is flattened into the tool.
+type responsesTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+// responsesInputItem is the input item of the Responses API, it's a message, a function call of the model
+// or the output of a function call.
+type responsesInputItem struct {
+	Type      string          `json:"type,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	CallID    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    string          `json:"output,omitempty"`
+}
+
+var (
+	errInvalidInput       = errors.New("input must be a string or an array of input items")
+	errPreviousResponseID = errors.New("previous_response_id is not supported, the responses are not stored")
+)
+
+// toChatCompletionRequest translates the Responses API request onto the chat completion request, the
+// instructions are the system message.
+func (req responsesRequest) toChatCompletionRequest() (openai.ChatCompletionRequest, error) {
+	if req.PreviousResponseID != "" {
+		return openai.ChatCompletionRequest{}, errPreviousResponseID
+	}
+	messages, err := responsesInputMessages(req.Input)
+	if err != nil {
+		return openai.ChatCompletionRequest{}, err
+	}
+	if req.Instructions != "" {
+		messages = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: req.Instructions}}, messages...)
+	}
+	tools := make([]openai.Tool, 0, len(req.Tools))
+	for _, t := range req.Tools {
+		if t.Type != string(openai.ToolTypeFunction) {
+			return openai.ChatCompletionRequest{}, fmt.Errorf("unsupported tool type: %s", t.Type)
+		}
+		fn := &openai.FunctionDefinition{Name: t.Name, Description: t.Description}
+		if len(t.Parameters) > 0 {
+			fn.Parameters = t.Parameters
+		}
+		tools = append(tools, openai.Tool{Type: openai.ToolTypeFunction, Function: fn})
+	}
+	chatReq := openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		MaxTokens:   req.MaxOutputTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+		User:        req.User,
+	}
+	if len(tools) > 0 {
+		chatReq.Tools = tools
+	}
+	if req.Stream {
+		// the usage of the response is reported by the last chunk.
+		chatReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	return chatReq, nil
+}
+
+// responsesInputMessages translates the input onto the chat messages, the consecutive function calls are
+// the tool calls of one assistant message.
+func responsesInputMessages(input json.RawMessage) ([]openai.ChatCompletionMessage, error) {
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		return []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: text}}, nil
+	}
+	var items []responsesInputItem
+	if err := json.Unmarshal(input, &items); err != nil || len(items) == 0 {
+		return nil, errInvalidInput
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(items))
+	for _, item := range items {
+		switch item.Type {
+		case "", "message":
+			parts, err := responsesInputParts(item.Content)
+			if err != nil {
+				return nil, err
+			}
+			role := item.Role
+			// the developer messages are the system messages of the chat completions.
+			if role == "developer" {
+				role = openai.ChatMessageRoleSystem
+			}
+			messages = append(messages, contentMessage(role, parts))
+		case "function_call":
+			call := openai.ToolCall{
+				ID:       item.CallID,
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			if n := len(messages); n > 0 && messages[n-1].Role == openai.ChatMessageRoleAssistant && len(messages[n-1].ToolCalls) > 0 {
+				messages[n-1].ToolCalls = append(messages[n-1].ToolCalls, call)
+				continue
+			}
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				ToolCalls: []openai.ToolCall{call},
+			})
+		case "function_call_output":
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    item.Output,
+				ToolCallID: item.CallID,
+			})
+		default:
+			return nil, fmt.Errorf("unsupported input item type: %s", item.Type)
+		}
+	}
+	return messages, nil
+}
+
+// responsesInputParts returns the parts of the message content, which is a string or an array of the text
+// and image parts.
+func responsesInputParts(content json.RawMessage) ([]openai.ChatMessagePart, error) {
+	parts, err := parseContentParts(content)
+	if errors.Is(err, errInvalidContent) {
+		return nil, errInvalidInput
+	}
+	return parts, err
+}
+
+// responsesResponse is the response object of the Responses API.
+type responsesResponse struct {
+	ID                string                      `json:"id"`
+	Object            string                      `json:"object"`
+	CreatedAt         int64                       `json:"created_at"`
+	Status            string                      `json:"status"`
+	Model             string                      `json:"model"`
+	Output            []responsesOutputItem       `json:"output"`
+	Usage             *responsesUsage             `json:"usage,omitempty"`
+	IncompleteDetails *responsesIncompleteDetails `json:"incomplete_details,omitempty"`
+	Error             *responsesError             `json:"error,omitempty"`
+	Metadata          map[string]string           `json:"metadata,omitempty"`
+}
+
+// responsesOutputItem is the output item, it's the message of the assistant or a function call of the model
+// which is not hosted by the sfns.
+type responsesOutputItem struct {
+	Type      string                `json:"type"`
+	ID        string                `json:"id"`
+	Status    string                `json:"status"`
+	Role      string                `json:"role,omitempty"`
+	Content   []responsesOutputText `json:"content,omitempty"`
+	CallID    string                `json:"call_id,omitempty"`
+	Name      string                `json:"name,omitempty"`
+	Arguments string                `json:"arguments,omitempty"`
+}
+
+// responsesOutputText is the text content of the output message.
+type responsesOutputText struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+type responsesUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+type responsesIncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type responsesError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newResponsesUsage(u openai.Usage) *responsesUsage {
+	return &responsesUsage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+}
+
+func newResponsesMessage(id, status, text string) responsesOutputItem {
+	return responsesOutputItem{
+		Type:    "message",
+		ID:      id,
+		Status:  status,
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: []responsesOutputText{{Type: "output_text", Text: text, Annotations: []any{}}},
+	}
+}
+
+// setFinishReason sets the status of the response by the finish reason of the chat completion.
+func (resp *responsesResponse) setFinishReason(reason openai.FinishReason) {
+	resp.Status = "completed"
+	switch reason {
+	case openai.FinishReasonLength:
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &responsesIncompleteDetails{Reason: "max_output_tokens"}
+	case openai.FinishReasonContentFilter:
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &responsesIncompleteDetails{Reason: "content_filter"}
+	}
+}
+
+// toResponsesResponse translates the chat completion response onto the Responses API response.
+func toResponsesResponse(resp openai.ChatCompletionResponse, md map[string]string) responsesResponse {
+	res := responsesResponse{
+		ID:        "resp_" + resp.ID,
+		Object:    "response",
+		CreatedAt: resp.Created,
+		Model:     resp.Model,
+		Output:    []responsesOutputItem{},
+		Usage:     newResponsesUsage(resp.Usage),
+		Metadata:  md,
+	}
+	if len(resp.Choices) == 0 {
+		res.Status = "completed"
+		return res
+	}
+	choice := resp.Choices[0]
+	if choice.Message.Content != "" || len(choice.Message.ToolCalls) == 0 {
+		res.Output = append(res.Output, newResponsesMessage("msg_"+resp.ID, "completed", choice.Message.Content))
+	}
+	for _, tc := range choice.Message.ToolCalls {
+		res.Output = append(res.Output, responsesOutputItem{
+			Type:      "function_call",
+			ID:        "fc_" + tc.ID,
+			Status:    "completed",
+			CallID:    tc.ID,
+			Name:      tc.Function.Name,
+			Arguments: tc.Function.Arguments,
+		})
+	}
+	res.setFinishReason(choice.FinishReason)
+	return res
+}
+
+// responsesRecorder records the chat completion response of the non-streamed request, it's translated after
+// the tools are called.
+type responsesRecorder struct {
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (r *responsesRecorder) Header() http.Header         { return r.header }
+func (r *responsesRecorder) Write(p []byte) (int, error) { return r.body.Write(p) }
+func (r *responsesRecorder) WriteHeader(int)             {}
+
+// responsesStreamWriter translates the server-sent events of the streamed chat completion onto the events of
+// the Responses API as they are written, the named events of the call stack and the tool progress are dropped.
+type responsesStreamWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	md      map[string]string
+
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	seq     int
+	started bool
+	ended   bool
+	resp    responsesResponse
+	text    strings.Builder
+	reason  openai.FinishReason
+}
+
+func newResponsesStreamWriter(w http.ResponseWriter, md map[string]string) *responsesStreamWriter {
+	return &responsesStreamWriter{w: w, flusher: eventFlusher(w), md: md}
+}
+
+func (sw *responsesStreamWriter) Header() http.Header  { return sw.w.Header() }
+func (sw *responsesStreamWriter) WriteHeader(code int) { sw.w.WriteHeader(code) }
+func (sw *responsesStreamWriter) Flush()               {}
+
+// Write parses the events of the chat completion.
+func (sw *responsesStreamWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	sw.buf.Write(p)
+	parseChunkEvents(&sw.buf, sw.chunkLocked, sw.completeLocked)
+	return len(p), nil
+}
+
+// parseChunkEvents parses the complete server-sent events of the streamed chat completion in buf, the events
+// are separated by a blank line, and the stream ends with `data: [DONE]`. The named events are dropped, and
+// the incomplete event is left in buf.
+func parseChunkEvents(buf *bytes.Buffer, onChunk func(openai.ChatCompletionStreamResponse), onDone func()) {
+	for {
+		b := buf.Bytes()
+		if bytes.HasPrefix(b, []byte("data: [DONE]")) {
+			buf.Reset()
+			onDone()
+			return
+		}
+		i := bytes.Index(b, []byte("\n\n"))
+		if i < 0 {
+			return
+		}
+		event := string(b[:i])
+		buf.Next(i + 2)
+
+		data, ok := strings.CutPrefix(event, "data: ")
+		if !ok {
+			continue
+		}
+		var chunk openai.ChatCompletionStreamResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			ylog.Warn("decode chat completion chunk", "err", err.Error())
+			continue
+		}
+		onChunk(chunk)
+	}
+}
+
+func (sw *responsesStreamWriter) writeEventLocked(data map[string]any) {
+	data["sequence_number"] = sw.seq
+	sw.seq++
+	_, _ = io.WriteString(sw.w, "event: "+data["type"].(string)+"\ndata: ")
+	_ = json.NewEncoder(sw.w).Encode(data)
+	_, _ = io.WriteString(sw.w, "\n")
+	sw.flusher.Flush()
+}
+
+// startLocked writes the events which open the response and its message.
+func (sw *responsesStreamWriter) startLocked(chunk openai.ChatCompletionStreamResponse) {
+	sw.started = true
+	sw.resp = responsesResponse{
+		ID:        "resp_" + chunk.ID,
+		Object:    "response",
+		CreatedAt: chunk.Created,
+		Status:    "in_progress",
+		Model:     chunk.Model,
+		Output:    []responsesOutputItem{},
+		Metadata:  sw.md,
+	}
+	sw.writeEventLocked(map[string]any{"type": "response.created", "response": sw.resp})
+	sw.writeEventLocked(map[string]any{"type": "response.in_progress", "response": sw.resp})
+
+	item := newResponsesMessage("msg_"+chunk.ID, "in_progress", "")
+	item.Content = []responsesOutputText{}
+	sw.writeEventLocked(map[string]any{"type": "response.output_item.added", "output_index": 0, "item": item})
+	sw.writeEventLocked(map[string]any{
+		"type":          "response.content_part.added",
+		"item_id":       item.ID,
+		"output_index":  0,
+		"content_index": 0,
+		"part":          responsesOutputText{Type: "output_text", Annotations: []any{}},
+	})
+}
+
+func (sw *responsesStreamWriter) chunkLocked(chunk openai.ChatCompletionStreamResponse) {
+	if !sw.started {
+		sw.startLocked(chunk)
+	}
+	if chunk.Usage != nil {
+		if sw.resp.Usage == nil {
+			sw.resp.Usage = &responsesUsage{}
+		}
+		sw.resp.Usage.InputTokens += chunk.Usage.PromptTokens
+		sw.resp.Usage.OutputTokens += chunk.Usage.CompletionTokens
+		sw.resp.Usage.TotalTokens += chunk.Usage.TotalTokens
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+	if reason := chunk.Choices[0].FinishReason; reason != "" {
+		sw.reason = reason
+	}
+	if delta := chunk.Choices[0].Delta.Content; delta != "" {
+		sw.text.WriteString(delta)
+		sw.writeEventLocked(map[string]any{
+			"type":          "response.output_text.delta",
+			"item_id":       "msg_" + strings.TrimPrefix(sw.resp.ID, "resp_"),
+			"output_index":  0,
+			"content_index": 0,
+			"delta":         delta,
+		})
+	}
+}
+
+// completeLocked writes the events which close the message and the response.
+func (sw *responsesStreamWriter) completeLocked() {
+	if sw.ended {
+		return
+	}
+	if !sw.started {
+		sw.startLocked(openai.ChatCompletionStreamResponse{})
+	}
+	sw.ended = true
+
+	text := sw.text.String()
+	item := newResponsesMessage("msg_"+strings.TrimPrefix(sw.resp.ID, "resp_"), "completed", text)
+	sw.writeEventLocked(map[string]any{
+		"type":          "response.output_text.done",
+		"item_id":       item.ID,
+		"output_index":  0,
+		"content_index": 0,
+		"text":          text,
+	})
+	sw.writeEventLocked(map[string]any{
+		"type":          "response.content_part.done",
+		"item_id":       item.ID,
+		"output_index":  0,
+		"content_index": 0,
+		"part":          item.Content[0],
+	})
+	sw.writeEventLocked(map[string]any{"type": "response.output_item.done", "output_index": 0, "item": item})
+
+	sw.resp.Output = []responsesOutputItem{item}
+	sw.resp.setFinishReason(sw.reason)
+	typ := "response.completed"
+	if sw.resp.Status == "incomplete" {
+		typ = "response.incomplete"
+	}
+	sw.writeEventLocked(map[string]any{"type": typ, "response": sw.resp})
+}
+
+// fail writes the `response.failed` event, it returns false if the stream has not started, then the error
+// is responded as usual.
+func (sw *responsesStreamWriter) fail(err error) bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if !sw.started || sw.ended {
+		return sw.started
+	}
+	sw.ended = true
+	sw.resp.Status = "failed"
+	sw.resp.Error = &responsesError{Code: "server_error", Message: err.Error()}
+	sw.writeEventLocked(map[string]any{"type": "response.failed", "response": sw.resp})
+	return true
+}
+
+// HandleResponses is the handler for POST /v1/responses, the Responses API requests are translated onto the
+// chat completions, so the sfns are called as the tools, and the responses are translated back, the streamed
+// responses are the events of the Responses API. The responses are not stored.
+func HandleResponses(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		service = FromServiceContext(ctx)
+		transID = FromTransIDContext(ctx)
+	)
+	defer r.Body.Close()
+	limitRequestBody(w, r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ylog.Error("read request", "err", err.Error())
+		RespondWithError(w, readBodyErrorCode(err), err)
+		return
+	}
+	var req responsesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		ylog.Error("decode request", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	chatReq, err := req.toChatCompletionRequest()
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateChatCompletionRequest(chatReq); err != nil {
+		ylog.Error("validate request", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if extraBody, err := parseExtraBody(body); err == nil && len(extraBody) > 0 {
+		ctx = WithExtraBodyContext(ctx, extraBody)
+	}
+	parallelToolCalls, err := parseParallelToolCalls(body)
+	if err != nil {
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !parallelToolCalls {
+		ctx = withSequentialToolCalls(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 90*time.Second)
+	defer cancel()
+
+	if err := responses(ctx, service, chatReq, transID, req.Metadata, w); err != nil {
+		ylog.Error("invoke responses", "err", err.Error())
+		code := http.StatusBadRequest
+		var toolErr *ToolCallError
+		if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrQuotaExceeded) {
+			code = http.StatusTooManyRequests
+		} else if errors.Is(err, ErrCircuitOpen) {
+			code = http.StatusServiceUnavailable
+		} else if errors.As(err, &toolErr) {
+			code = http.StatusBadGateway
+		}
+		RespondWithError(w, code, err)
+	}
+}
+
+func responses(ctx context.Context, service *Service, req openai.ChatCompletionRequest, transID string, md map[string]string, w http.ResponseWriter) error {
+	if req.Stream {
+		sw := newResponsesStreamWriter(w, md)
+		err := service.GetChatCompletions(ctx, req, transID, sw, false)
+		if err != nil && sw.fail(err) {
+			ylog.Error("invoke responses stream", "err", err.Error())
+			return nil
+		}
+		return err
+	}
+
+	rec := &responsesRecorder{header: make(http.Header)}
+	if err := service.GetChatCompletions(ctx, req, transID, rec, false); err != nil {
+		return err
+	}
+	var resp openai.ChatCompletionResponse
+	if err := json.Unmarshal(rec.body.Bytes(), &resp); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(toResponsesResponse(resp, md))
+}
@@ -0,0 +1,165 @@
+package ai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func TestResponsesRequest(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		expectedMessages []openai.ChatCompletionMessage
+		expectedErr      string
+	}{
+		{
+			name: "string input",
+			body: `{"model":"gpt-4o","instructions":"be brief","input":"hello"}`,
+			expectedMessages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+				{Role: openai.ChatMessageRoleUser, Content: "hello"},
+			},
+		},
+		{
+			name: "input items",
+			body: `{"model":"gpt-4o","input":[
+				{"role":"developer","content":"be brief"},
+				{"type":"message","role":"user","content":[{"type":"input_text","text":"weather of "},{"type":"input_text","text":"Paris"}]},
+				{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{}"},
+				{"type":"function_call","call_id":"call_2","name":"get_time","arguments":"{}"},
+				{"type":"function_call_output","call_id":"call_1","output":"sunny"}
+			]}`,
+			expectedMessages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleSystem, Content: "be brief"},
+				{Role: openai.ChatMessageRoleUser, Content: "weather of Paris"},
+				{Role: openai.ChatMessageRoleAssistant, ToolCalls: []openai.ToolCall{
+					{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: "{}"}},
+					{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_time", Arguments: "{}"}},
+				}},
+				{Role: openai.ChatMessageRoleTool, Content: "sunny", ToolCallID: "call_1"},
+			},
+		},
+		{
+			name:        "empty input",
+			body:        `{"model":"gpt-4o","input":[]}`,
+			expectedErr: "input must be a string or an array of input items",
+		},
+		{
+			name: "image input",
+			body: `{"model":"gpt-4o","input":[{"role":"user","content":[{"type":"input_text","text":"what is it?"},{"type":"input_image","image_url":"https://example.com/a.png","detail":"low"}]}]}`,
+			expectedMessages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, MultiContent: []openai.ChatMessagePart{
+					{Type: openai.ChatMessagePartTypeText, Text: "what is it?"},
+					{Type: openai.ChatMessagePartTypeImageURL, ImageURL: &openai.ChatMessageImageURL{URL: "https://example.com/a.png", Detail: openai.ImageURLDetailLow}},
+				}},
+			},
+		},
+		{
+			name:        "invalid image url",
+			body:        `{"model":"gpt-4o","input":[{"role":"user","content":[{"type":"input_image","image_url":"file:///etc/passwd"}]}]}`,
+			expectedErr: "image url must be an http(s) url or a base64 data url of an image: file:///etc/passwd",
+		},
+		{
+			name:        "file input",
+			body:        `{"model":"gpt-4o","input":[{"role":"user","content":[{"type":"input_file","file_id":"file_1"}]}]}`,
+			expectedErr: "unsupported content type: input_file",
+		},
+		{
+			name:        "builtin tool",
+			body:        `{"model":"gpt-4o","input":"hello","tools":[{"type":"web_search"}]}`,
+			expectedErr: "unsupported tool type: web_search",
+		},
+		{
+			name:        "previous response",
+			body:        `{"model":"gpt-4o","input":"hello","previous_response_id":"resp_1"}`,
+			expectedErr: "previous_response_id is not supported, the responses are not stored",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			service := &Service{LLMProvider: &completionsProvider{}, Metadata: metadata.M{}}
+			service.SetSystemPrompt("")
+			r = r.WithContext(WithServiceContext(r.Context(), service))
+
+			HandleResponses(w, r)
+
+			if tt.expectedErr != "" {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				assert.JSONEq(t, `{"error":{"code":"400","message":"`+tt.expectedErr+`"}}`, w.Body.String())
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedMessages, service.LLMProvider.(*completionsProvider).req.Messages)
+		})
+	}
+}
+
+func TestHandleResponses(t *testing.T) {
+	t.Run("response", func(t *testing.T) {
+		provider := &completionsProvider{}
+		service := &Service{LLMProvider: provider, Metadata: metadata.M{}}
+		service.SetSystemPrompt("")
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model":"gpt-4o","input":"hello","max_output_tokens":16,"metadata":{"k":"v"}}`))
+		r = r.WithContext(WithServiceContext(r.Context(), service))
+
+		HandleResponses(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		assert.Equal(t, 16, provider.req.MaxTokens)
+		assert.JSONEq(t, `{
+			"id":"resp_chatcmpl-1","object":"response","created_at":0,"status":"completed","model":"gpt-4o",
+			"output":[{"type":"message","id":"msg_chatcmpl-1","status":"completed","role":"assistant","content":[{"type":"output_text","text":" world","annotations":[]}]}],
+			"usage":{"input_tokens":1,"output_tokens":1,"total_tokens":2},
+			"metadata":{"k":"v"}
+		}`, w.Body.String())
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		provider := &completionsProvider{}
+		service := &Service{LLMProvider: provider, Metadata: metadata.M{}}
+		service.SetSystemPrompt("")
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/responses", strings.NewReader(`{"model":"gpt-4o","input":"hello","stream":true}`))
+		r = r.WithContext(WithServiceContext(r.Context(), service))
+
+		HandleResponses(w, r)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, &openai.StreamOptions{IncludeUsage: true}, provider.req.StreamOptions)
+
+		var types []string
+		for _, line := range strings.Split(w.Body.String(), "\n") {
+			if typ, ok := strings.CutPrefix(line, "event: "); ok {
+				types = append(types, typ)
+			}
+		}
+		assert.Equal(t, []string{
+			"response.created",
+			"response.in_progress",
+			"response.output_item.added",
+			"response.content_part.added",
+			"response.output_text.delta",
+			"response.output_text.delta",
+			"response.output_text.done",
+			"response.content_part.done",
+			"response.output_item.done",
+			"response.completed",
+		}, types)
+		assert.Contains(t, w.Body.String(), `"delta":" wor"`)
+		assert.Contains(t, w.Body.String(), `"text":" world"`)
+		assert.NotContains(t, w.Body.String(), "[DONE]")
+	})
+}
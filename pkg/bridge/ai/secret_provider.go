@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/secret"
+)
+
+// DefaultSecretRefreshInterval is the default interval of refreshing the secrets of the llm providers.
+const DefaultSecretRefreshInterval = 10 * time.Minute
+
+// secretProvider is the llm provider whose config references the secrets, the secrets are resolved when it
+// is created, and refreshed periodically, the llm provider is rebuilt when the secrets are rotated.
+type secretProvider struct {
+	conf  Provider
+	build func(Provider) LLMProvider
+
+	mu       sync.RWMutex
+	resolved Provider
+	provider LLMProvider
+}
+
+// NewSecretProvider returns the llm provider built from the provider config, the values of the config can be
+// the secret references, see the secret package. The secrets are refreshed every interval until the ctx is done.
+// The build returns nil if the provider is unknown.
+func NewSecretProvider(ctx context.Context, conf Provider, interval time.Duration, build func(Provider) LLMProvider) (LLMProvider, error) {
+	hasRef := false
+	for _, v := range conf {
+		if secret.IsRef(v) {
+			hasRef = true
+			break
+		}
+	}
+	if !hasRef {
+		return build(conf), nil
+	}
+
+	resolved, err := secret.ResolveMap(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+	provider := build(resolved)
+	if provider == nil {
+		return nil, nil
+	}
+
+	p := &secretProvider{conf: conf, build: build, resolved: resolved, provider: provider}
+	if interval <= 0 {
+		interval = DefaultSecretRefreshInterval
+	}
+	go p.refreshEvery(ctx, interval)
+
+	return p, nil
+}
+
+func (p *secretProvider) refreshEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.refresh(ctx)
+		}
+	}
+}
+
+// refresh resolves the secrets again, and rebuilds the llm provider if the secrets are rotated.
+func (p *secretProvider) refresh(ctx context.Context) {
+	resolved, err := secret.ResolveMap(ctx, p.conf)
+	if err != nil {
+		// keep using the current secrets.
+		ylog.Error("refresh the secrets of llm provider", "provider", p.Name(), "err", err.Error())
+		return
+	}
+
+	p.mu.RLock()
+	rotated := !maps.Equal(resolved, p.resolved)
+	p.mu.RUnlock()
+	if !rotated {
+		return
+	}
+
+	provider := p.build(resolved)
+	if provider == nil {
+		return
+	}
+	p.mu.Lock()
+	p.resolved, p.provider = resolved, provider
+	p.mu.Unlock()
+
+	ylog.Info("the secrets of llm provider are rotated", "provider", provider.Name())
+}
+
+func (p *secretProvider) current() LLMProvider {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.provider
+}
+
+// Name returns the name of the llm provider.
+func (p *secretProvider) Name() string { return p.current().Name() }
+
+// GetChatCompletions implements LLMProvider.
+func (p *secretProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	return p.current().GetChatCompletions(ctx, req, md)
+}
+
+// GetChatCompletionsStream implements LLMProvider.
+func (p *secretProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	return p.current().GetChatCompletionsStream(ctx, req, md)
+}
+
+// GetEmbeddings implements LLMProvider.
+func (p *secretProvider) GetEmbeddings(ctx context.Context, req openai.EmbeddingRequest, md metadata.M) (openai.EmbeddingResponse, error) {
+	return p.current().GetEmbeddings(ctx, req, md)
+}
@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/pkg/secret"
+)
+
+type rotatingResolver struct {
+	version atomic.Int32
+}
+
+func (r *rotatingResolver) Resolve(_ context.Context, ref secret.Ref) (string, error) {
+	if r.version.Load() == 0 {
+		return "sk-1", nil
+	}
+	return "sk-2", nil
+}
+
+func TestSecretProvider(t *testing.T) {
+	resolver := &rotatingResolver{}
+	secret.RegisterResolver("rotating", resolver)
+
+	build := func(conf Provider) LLMProvider {
+		return &MockLLMProvider{name: "openai:" + conf["api_key"]}
+	}
+
+	t.Run("plaintext", func(t *testing.T) {
+		p, err := NewSecretProvider(context.Background(), Provider{"api_key": "sk-plaintext"}, 0, build)
+		assert.NoError(t, err)
+		assert.Equal(t, "openai:sk-plaintext", p.Name())
+		assert.IsType(t, &MockLLMProvider{}, p)
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		p, err := NewSecretProvider(ctx, Provider{"api_key": "rotating://openai"}, 0, build)
+		assert.NoError(t, err)
+		assert.Equal(t, "openai:sk-1", p.Name())
+
+		resolver.version.Store(1)
+		p.(*secretProvider).refresh(ctx)
+		assert.Equal(t, "openai:sk-2", p.Name())
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		p, err := NewSecretProvider(context.Background(), Provider{"api_key": "rotating://openai"}, 0, func(Provider) LLMProvider { return nil })
+		assert.NoError(t, err)
+		assert.Nil(t, p)
+	})
+}
@@ -2,16 +2,14 @@ package ai
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	"github.com/sashabaranov/go-openai"
 	"github.com/yomorun/yomo"
 	"github.com/yomorun/yomo/ai"
@@ -23,14 +21,21 @@ import (
 )
 
 var (
-	// ServiceCacheSize is the size of the service cache
+	// ServiceCacheSize is the default max number of the services in the service cache
 	ServiceCacheSize = 1024
-	// ServiceCacheTTL is the time to live of the service cache
+	// ServiceCacheTTL is the default idle time to live of the services in the service cache
 	ServiceCacheTTL = time.Minute * 0 // 30
 	// services is the cache of Service
-	services *expirable.LRU[string, *Service]
+	services *shardedCache[*Service]
+	// NearestInstance routes the tool calls to the nearest llm-sfn instance of the function, so the function
+	// registered from multiple regions is executed once by the instance closest to the zipper
+	NearestInstance bool
 )
 
+// ErrStreamChoices is returned when the streamed chat completion with the sfn tools asks for more than one
+// choice, the choices of the stream can't call their tools separately.
+var ErrStreamChoices = errors.New("n > 1 is not supported by the streamed chat completions with the sfn tools, set n to 1 or disable stream")
+
 // Service is used to invoke LLM Provider to get the functions to be executed,
 // then, use source to send arguments which returned by llm provider to target
 // function. Finally, use reducer to aggregate all the results, and write the
@@ -38,12 +43,17 @@ var (
 type Service struct {
 	credential   string
 	zipperAddr   string
+	aiProvider   LLMProvider
+	exFn         ExchangeMetadataFunc
 	Metadata     metadata.M
 	systemPrompt atomic.Value
+	promptOp     atomic.Value // the SystemPromptOp of the caller
 	source       yomo.Source
 	reducer      yomo.StreamFunction
+	invoker      yomo.StreamFunction
 	sfnCallCache map[string]*sfnAsyncCall
 	muCallCache  sync.Mutex
+	metrics      *llmMetrics
 	LLMProvider
 }
 
@@ -57,8 +67,30 @@ func LoadOrCreateService(credential string, zipperAddr string, aiProvider LLMPro
 	if err != nil {
 		return nil, err
 	}
-	services.Add(credential, s)
-	return s, nil
+	// the service may be created concurrently for the same credential, only one of them is kept.
+	actual, loaded := services.LoadOrStore(credential, s)
+	if loaded {
+		s.Release()
+	}
+	return actual, nil
+}
+
+// ConfigureServiceCache replaces the service cache with a new one of the config,
+// the services in the old cache are released.
+func ConfigureServiceCache(conf ServiceCache) {
+	if conf.TTL == 0 {
+		conf.TTL = ServiceCacheTTL
+	}
+	old := services
+	services = newServiceCache(conf)
+	old.close()
+}
+
+func newServiceCache(conf ServiceCache) *shardedCache[*Service] {
+	onEvicted := func(_ string, v *Service) {
+		v.Release()
+	}
+	return newShardedCache(conf, (*Service).size, onEvicted)
 }
 
 // ExchangeMetadataFunc is used to exchange metadata
@@ -70,11 +102,35 @@ func DefaultExchangeMetadataFunc(credential string) (metadata.M, error) {
 }
 
 func newService(credential string, zipperAddr string, aiProvider LLMProvider, exFn ExchangeMetadataFunc) (*Service, error) {
+	metrics := newLLMMetrics()
+	provider := aiProvider
+	if modelRoutes.Load() != nil {
+		provider = &modelRoutedProvider{LLMProvider: provider}
+	}
+	if providerRetry.Load() != nil {
+		provider = &retryProvider{LLMProvider: provider}
+	}
+	provider = withCircuitBreaker(provider)
+	if failover.Load() != nil {
+		provider = &failoverProvider{LLMProvider: provider}
+	}
 	s := &Service{
-		credential:   credential,
-		zipperAddr:   zipperAddr,
-		LLMProvider:  aiProvider,
+		credential: credential,
+		zipperAddr: zipperAddr,
+		aiProvider: aiProvider,
+		exFn:       exFn,
+		LLMProvider: &cachedProvider{
+			LLMProvider: &quotaProvider{
+				LLMProvider: &rateLimitedProvider{
+					LLMProvider: &meteredProvider{LLMProvider: provider, metrics: metrics, credential: credential},
+					credential:  credential,
+				},
+				credential: credential,
+			},
+			credential: credential,
+		},
 		sfnCallCache: make(map[string]*sfnAsyncCall),
+		metrics:      metrics,
 	}
 
 	s.SetSystemPrompt("")
@@ -105,6 +161,13 @@ func newService(credential string, zipperAddr string, aiProvider LLMProvider, ex
 		return nil, err
 	}
 	s.reducer = reducer
+	// invoker
+	invoker, err := s.createInvoker()
+	if err != nil {
+		ylog.Error("create fc-service invoker failed", "err", err)
+		return nil, err
+	}
+	s.invoker = invoker
 	return s, nil
 }
 
@@ -122,16 +185,21 @@ func (s *Service) Release() {
 	if s.reducer != nil {
 		s.reducer.Close()
 	}
+	if s.invoker != nil {
+		s.invoker.Close()
+	}
 }
 
 func (s *Service) createSource() (yomo.Source, error) {
 	ylog.Debug("create fc-service source", "zipperAddr", s.zipperAddr, "credential", s.credential)
-	source := yomo.NewSource(
-		"fc-source",
-		s.zipperAddr,
+	opts := []yomo.SourceOption{
 		yomo.WithSourceReConnect(),
 		yomo.WithCredential(s.credential),
-	)
+	}
+	if NearestInstance {
+		opts = append(opts, yomo.WithSourceNearestRouting())
+	}
+	source := yomo.NewSource("fc-source", s.zipperAddr, opts...)
 	// create ai source
 	err := source.Connect()
 	if err != nil {
@@ -140,47 +208,84 @@ func (s *Service) createSource() (yomo.Source, error) {
 	return source, nil
 }
 
-// createReducer creates the reducer-sfn. reducer-sfn used to aggregate all the llm-sfn execute results.
+// createReducer creates the reducer-sfn by the ReducerBuilder of the service options. reducer-sfn used to
+// aggregate all the llm-sfn execute results.
 func (s *Service) createReducer() (yomo.StreamFunction, error) {
+	build := getServiceOptions().ReducerBuilder
+	if build == nil {
+		build = DefaultReducerBuilder
+	}
+	sfn, err := build(s.zipperAddr, s.credential, s.reduce)
+	if err != nil {
+		return nil, err
+	}
+	if err := sfn.Connect(); err != nil {
+		return nil, err
+	}
+	return sfn, nil
+}
+
+// reduce reduces the result of the llm-sfn into the pending tool call, see ReduceFunc.
+func (s *Service) reduce(invoke *ai.FunctionCall) {
+	reqID := invoke.ReqID
+
+	// write parallel function calling results to cache, after all the results are written, the reducer will be done
+	s.muCallCache.Lock()
+	c, ok := s.sfnCallCache[reqID]
+	s.muCallCache.Unlock()
+	if !ok {
+		ylog.Error("[sfn-reducer] req_id not found", "trans_id", invoke.TransID, "req_id", reqID)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the progress chunk is emitted to the caller, and the tool call is not done until the final result,
+	// the late progress chunks are dropped, the response is written by the second call from then on
+	if invoke.IsPartial {
+		if c.onProgress != nil && c.inFlight(invoke.ToolCallID) {
+			c.onProgress(ai.ToolProgress{
+				ToolCallID:   invoke.ToolCallID,
+				FunctionName: invoke.FunctionName,
+				Content:      invoke.Result,
+			})
+		}
+		return
+	}
+
+	// need lock c.calls as multiple handler channel will write to it
+	if !c.deliver(invoke) {
+		ylog.Debug("[sfn-reducer] drop the result of the finished attempt", "toolCallID", invoke.ToolCallID, "attempt", invoke.Attempt)
+	}
+}
+
+// createInvoker creates the invoker-sfn. invoker-sfn serves the functions invoked by the llm-sfn by name,
+// the results are written back to the llm-sfn, so the composite tools don't route back through the llm.
+func (s *Service) createInvoker() (yomo.StreamFunction, error) {
 	sfn := yomo.NewStreamFunction(
-		"ai-reducer",
+		"ai-invoker",
 		s.zipperAddr,
 		yomo.WithSfnReConnect(),
 		yomo.WithSfnCredential(s.credential),
 	)
-	sfn.SetObserveDataTags(ai.ReducerTag)
+	sfn.SetObserveDataTags(ai.FunctionInvokeTag)
 	sfn.SetHandler(func(ctx serverless.Context) {
-		buf := ctx.Data()
-		ylog.Debug("[sfn-reducer]", "tag", ai.ReducerTag, "data", string(buf))
 		invoke := &ai.FunctionCall{}
 		err := ctx.ReadLLMFunctionCall(invoke)
 		if err != nil {
-			ylog.Error("[sfn-reducer] parse function calling invoke", "err", err.Error())
+			ylog.Error("[sfn-invoker] parse function invoking", "err", err.Error())
 			return
 		}
-
-		reqID := invoke.ReqID
-
-		// write parallel function calling results to cache, after all the results are written, the reducer will be done
-		s.muCallCache.Lock()
-		c, ok := s.sfnCallCache[reqID]
-		s.muCallCache.Unlock()
-		if !ok {
-			ylog.Error("[sfn-reducer] req_id not found", "trans_id", invoke.TransID, "req_id", reqID)
+		result := s.invokeFunction(invoke)
+		buf, err := result.Bytes()
+		if err != nil {
+			ylog.Error("[sfn-invoker] marshal result", "err", err.Error())
 			return
 		}
-
-		c.mu.Lock()
-		defer c.mu.Unlock()
-
-		// need lock c.val as multiple handler channel will write to it
-		c.val[invoke.ToolCallID] = ai.ToolMessage{
-			Content:    invoke.Result,
-			ToolCallId: invoke.ToolCallID,
+		if err := s.source.Write(ai.FunctionInvokeResultTag, buf); err != nil {
+			ylog.Error("[sfn-invoker] write result", "err", err.Error())
 		}
-		ylog.Debug("[sfn-reducer] generate", "ToolMessage", fmt.Sprintf("%+v", c.val))
-
-		c.wg.Done()
 	})
 
 	err := sfn.Connect()
@@ -190,9 +295,88 @@ func (s *Service) createReducer() (yomo.StreamFunction, error) {
 	return sfn, nil
 }
 
-// GetOverview returns the overview of the AI functions, key is the tag, value is the function definition
-func (s *Service) GetOverview() (*ai.OverviewResponse, error) {
-	tcs, err := register.ListToolCalls(s.Metadata)
+// invokeFunction invokes the function by name for the llm-sfn, the result is returned with the reqID of the invoking.
+func (s *Service) invokeFunction(invoke *ai.FunctionCall) *ai.FunctionCall {
+	result := &ai.FunctionCall{
+		TransID:      invoke.TransID,
+		ReqID:        invoke.ReqID,
+		FunctionName: invoke.FunctionName,
+	}
+	ylog.Debug("[sfn-invoker] invoke", "function", invoke.FunctionName, "callChain", invoke.CallChain, "reqID", invoke.ReqID)
+
+	// the function can be invoked by its alias
+	tag, tc, ok := register.ResolveFunction(invoke.FunctionName, s.Metadata)
+	if !ok {
+		result.Error = fmt.Sprintf("function %s is not registered", invoke.FunctionName)
+		return result
+	}
+	// the call chain ends with the invoking llm-sfn
+	if len(invoke.CallChain) > 0 {
+		if err := ai.CheckCallChain(invoke.CallChain, tc.Function.Name); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+	fns := map[uint32][]*openai.ToolCall{
+		tag: {{
+			ID:   id.New(16),
+			Type: openai.ToolTypeFunction,
+			Function: openai.FunctionCall{
+				Name:      tc.Function.Name,
+				Arguments: invoke.Arguments,
+			},
+		}},
+	}
+
+	base := &ai.FunctionCall{
+		TransID:   invoke.TransID,
+		ReqID:     id.New(16),
+		UserQuery: invoke.UserQuery,
+		CallChain: invoke.CallChain,
+	}
+	llmCalls, err := s.runFunctionCalls(context.Background(), fns, base, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if len(llmCalls) == 0 {
+		result.Error = fmt.Sprintf("function %s returns no result", invoke.FunctionName)
+		return result
+	}
+	if toolErr := llmCalls[0].Error; toolErr != nil {
+		result.Error, result.ErrorCode = toolErr.Message, toolErr.Code
+		return result
+	}
+	result.IsOK = true
+	result.Result = llmCalls[0].Content
+	return result
+}
+
+// requestMetadata returns the metadata of the service with the hints of the request, eg: the preferred languages,
+// and the scopes of the authenticated caller.
+func (s *Service) requestMetadata(ctx context.Context) metadata.M {
+	acceptLanguage := FromAcceptLanguageContext(ctx)
+	caller := fromCallerContext(ctx)
+	if acceptLanguage == "" && caller == nil {
+		return s.Metadata
+	}
+	md := s.Metadata.Clone()
+	if md == nil {
+		md = metadata.M{}
+	}
+	if acceptLanguage != "" {
+		md.Set(ai.AcceptLanguageKey, acceptLanguage)
+	}
+	// the functions are visible to the authenticated caller by its own scopes
+	if caller != nil {
+		md.Set(ai.ScopeKey, strings.Join(caller.Scopes, ","))
+	}
+	return md
+}
+
+// GetOverview returns the overview of the AI functions visible to the request, key is the tag, value is the function definition
+func (s *Service) GetOverview(ctx context.Context) (*ai.OverviewResponse, error) {
+	tcs, err := register.ListToolCalls(s.requestMetadata(ctx))
 	if err != nil {
 		return &ai.OverviewResponse{}, err
 	}
@@ -208,7 +392,7 @@ func (s *Service) GetOverview() (*ai.OverviewResponse, error) {
 // GetInvoke returns the invoke response
 func (s *Service) GetInvoke(ctx context.Context, userInstruction string, baseSystemMessage string, transID string, includeCallStack bool) (*ai.InvokeResponse, error) {
 	// read tools attached to the metadata
-	tcs, err := register.ListToolCalls(s.Metadata)
+	tcs, err := register.ListToolCalls(s.requestMetadata(ctx))
 	if err != nil {
 		return &ai.InvokeResponse{}, err
 	}
@@ -246,10 +430,20 @@ func (s *Service) GetInvoke(ctx context.Context, userInstruction string, baseSys
 		"res_assistant_msgs", fmt.Sprintf("%+v", res.AssistantMessage))
 
 	ylog.Debug(">> run function calls", "transID", transID, "res.ToolCalls", fmt.Sprintf("%+v", res.ToolCalls))
-	llmCalls, err := s.runFunctionCalls(res.ToolCalls, transID, id.New(16))
+	base := &ai.FunctionCall{TransID: transID, ReqID: id.New(16), UserQuery: userInstruction}
+	llmCalls, err := s.runFunctionCalls(ctx, res.ToolCalls, base, nil)
 	if err != nil {
 		return nil, err
 	}
+	toolCalls := []openai.ToolCall{}
+	for _, tcs := range res.ToolCalls {
+		for _, tc := range tcs {
+			toolCalls = append(toolCalls, *tc)
+		}
+	}
+	if err := checkToolFailures(toolCalls, llmCalls); err != nil {
+		return nil, err
+	}
 
 	ylog.Debug(">>>> start 2nd call with", "calls", fmt.Sprintf("%+v", llmCalls), "preceeding_assistant_message", fmt.Sprintf("%+v", res.AssistantMessage))
 	chainMessage.PreceedingAssistantMessage = res.AssistantMessage
@@ -323,110 +517,118 @@ func overWriteSystemPrompt(req openai.ChatCompletionRequest, sysPrompt string) o
 	return req
 }
 
-// GetChatCompletions returns the llm api response
-func (s *Service) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, transID string, w http.ResponseWriter, includeCallStack bool) error {
+// GetChatCompletions returns the llm api response, the tool calls of the model are run by the sfns round by
+// round until the model answers without calling the tools, see ServiceOptions.MaxToolRounds.
+func (s *Service) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, transID string, w http.ResponseWriter, includeCallStack bool) (err error) {
+	ctx, usage := withRequestUsageContext(ctx)
+	defer func(start time.Time) { s.recordUsage(usage, req, transID, start, err) }(time.Now())
+
+	// 0. moderate the messages of the users before they reach the llm provider
+	req, err = s.moderate(ctx, req)
+	if err != nil {
+		return err
+	}
 	// 1. find all hosting tool sfn
-	tagTools, err := register.ListToolCalls(s.Metadata)
+	tagTools, err := register.ListToolCalls(s.requestMetadata(ctx))
 	if err != nil {
 		return err
 	}
+	if req.Stream && req.N > 1 && len(tagTools) > 0 {
+		return ErrStreamChoices
+	}
 	// 2. add those tools to request
 	req, err = addToolsToRequest(req, tagTools)
 	if err != nil {
 		return err
 	}
-	// 3. over write system prompt to request
-	req = overWriteSystemPrompt(req, s.systemPrompt.Load().(string))
+	req, err = applyToolChoice(req)
+	if err != nil {
+		return err
+	}
+	// 3. apply the system prompt to request
+	req, err = s.OpSystemPrompt(ctx, req)
+	if err != nil {
+		return err
+	}
+	// 4. check the request by the guards
+	req, err = guardRequest(ctx, req)
+	if err != nil {
+		return err
+	}
 
-	var (
-		reqMessages      = req.Messages
-		toolCallsMap     = make(map[int]openai.ToolCall)
-		toolCalls        = []openai.ToolCall{}
-		assistantMessage = openai.ChatCompletionMessage{}
-	)
-	// 4. request first chat for getting tools
+	// 5. request the llm provider, and run the tool calls until the model answers
+	audio := fromAudioContext(ctx)
 	if req.Stream {
-		var (
-			flusher        = eventFlusher(w)
-			isFunctionCall = false
-		)
-		resStream, err := s.LLMProvider.GetChatCompletionsStream(ctx, req, s.Metadata)
-		if err != nil {
-			return err
-		}
-		for {
-			streamRes, err := resStream.Recv()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return err
-			}
-			if len(streamRes.Choices) == 0 {
-				continue
-			}
-			if tc := streamRes.Choices[0].Delta.ToolCalls; len(tc) > 0 {
-				for _, t := range tc {
-					// this index should be toolCalls slice's index, the index field only appares in stream response
-					index := *t.Index
-					item, ok := toolCallsMap[index]
-					if !ok {
-						toolCallsMap[index] = openai.ToolCall{
-							Index:    &index,
-							ID:       t.ID,
-							Type:     t.Type,
-							Function: openai.FunctionCall{},
-						}
-						item = toolCallsMap[index]
-					}
-					if t.Function.Arguments != "" {
-						item.Function.Arguments += t.Function.Arguments
-					}
-					if t.Function.Name != "" {
-						item.Function.Name = t.Function.Name
-					}
-					toolCallsMap[index] = item
-				}
-				isFunctionCall = true
-			} else if streamRes.Choices[0].FinishReason != openai.FinishReasonToolCalls {
-				_, _ = io.WriteString(w, "data: ")
-				_ = json.NewEncoder(w).Encode(streamRes)
-				_, _ = io.WriteString(w, "\n")
-				flusher.Flush()
-			}
-		}
-		if !isFunctionCall {
-			io.WriteString(w, "data: [DONE]")
-			flusher.Flush()
-			return nil
-		} else {
-			toolCalls = mapToSliceTools(toolCallsMap)
-
-			assistantMessage = openai.ChatCompletionMessage{
-				ToolCalls: toolCalls,
-				Role:      openai.ChatMessageRoleAssistant,
-			}
-			flusher.Flush()
-		}
-	} else {
-		resp, err := s.LLMProvider.GetChatCompletions(ctx, req, s.Metadata)
-		if err != nil {
-			return err
+		if conf := streamCoalesce.Load(); conf != nil {
+			cw := newCoalescingWriter(w, *conf)
+			defer cw.Close()
+			w = cw
 		}
+		events := NewEventResponseWriter(w)
+		events.audio = audio
+		return s.streamToolRounds(ctx, req, tagTools, transID, events, includeCallStack)
+	}
 
-		ylog.Debug(" #1 first call", "response", fmt.Sprintf("%+v", resp))
-		// it is a function call
-		if resp.Choices[0].FinishReason == openai.FinishReasonToolCalls {
-			toolCalls = append(toolCalls, resp.Choices[0].Message.ToolCalls...)
-			assistantMessage = resp.Choices[0].Message
-		} else {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(resp)
-			return nil
-		}
+	resp, err := s.completeRound(ctx, req, 1)
+	if err != nil {
+		return err
 	}
+	ylog.Debug(" #1 first call", "response", fmt.Sprintf("%+v", resp))
+
+	var (
+		toolCalls []openai.ToolCall
+		llmCalls  []ai.ToolMessage
+	)
+	if len(resp.Choices) > 1 {
+		// every choice calls its own tools
+		resp, toolCalls, llmCalls, err = s.completeChoices(ctx, req, resp, tagTools, transID)
+	} else if len(resp.Choices) == 1 && resp.Choices[0].FinishReason == openai.FinishReasonToolCalls {
+		usage := resp.Usage
+		resp, toolCalls, llmCalls, err = s.runToolRounds(ctx, req, resp.Choices[0], tagTools, transID)
+		resp.Usage = addUsage(resp.Usage, usage)
+	}
+	if err != nil {
+		return err
+	}
+	resp, err = guardResponse(ctx, req, resp)
+	if err != nil {
+		return err
+	}
+	return writeCompletion(w, audio, withCallStack(resp, toolCalls, llmCalls, includeCallStack))
+}
 
-	// 5. find sfns that hit the function call
+// callTools repairs the malformed arguments of the tool calls, and runs them by the sfns which host them. The
+// tool calls and their results are written as the call stack events if callStack is not nil.
+func (s *Service) callTools(ctx context.Context, toolCalls []openai.ToolCall, tagTools map[uint32]openai.Tool, base *ai.FunctionCall, callStack *EventResponseWriter, onProgress func(ai.ToolProgress)) ([]ai.ToolMessage, error) {
+	s.repairToolCalls(ctx, toolCalls, tagTools)
+	addRequestToolCalls(ctx, len(toolCalls))
+	if callStack != nil {
+		callStack.WriteToolCalls(toolCalls)
+	}
+	var (
+		llmCalls []ai.ToolMessage
+		err      error
+	)
+	if sequentialToolCalls(ctx) {
+		llmCalls, err = s.runSequentialFunctionCalls(ctx, toolCalls, tagTools, base, onProgress)
+	} else {
+		llmCalls, err = s.runFunctionCalls(ctx, matchToolCalls(toolCalls, tagTools), base, onProgress)
+	}
+	if err != nil {
+		return nil, err
+	}
+	llmCalls = answerToolCalls(toolCalls, llmCalls)
+	if err := checkToolFailures(toolCalls, llmCalls); err != nil {
+		return nil, err
+	}
+	if callStack != nil {
+		callStack.WriteToolResults(toolCalls, llmCalls)
+	}
+	return llmCalls, nil
+}
+
+// matchToolCalls groups the tool calls by the tags of the sfns which host their functions.
+func matchToolCalls(toolCalls []openai.ToolCall, tagTools map[uint32]openai.Tool) map[uint32][]*openai.ToolCall {
 	fnCalls := make(map[uint32][]*openai.ToolCall)
 	// functions may be more than one
 	for _, call := range toolCalls {
@@ -437,125 +639,263 @@ func (s *Service) GetChatCompletions(ctx context.Context, req openai.ChatComplet
 			}
 		}
 	}
-	// 6. run llm function calls
-	reqID := id.New(16)
-	llmCalls, err := s.runFunctionCalls(fnCalls, transID, reqID)
-	if err != nil {
-		return err
-	}
-	// 7. do the second call (the second call messages are from user input, first call resopnse and sfn calls result)
-	req.Messages = append(reqMessages, assistantMessage)
+	return fnCalls
+}
+
+// secondCallMessages returns the messages of the second call, they are the messages of the request, the
+// assistant message which calls the tools and the results of the tool calls.
+func secondCallMessages(reqMessages []openai.ChatCompletionMessage, assistantMessage openai.ChatCompletionMessage, llmCalls []ai.ToolMessage) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0, len(reqMessages)+1+len(llmCalls))
+	messages = append(messages, reqMessages...)
+	messages = append(messages, assistantMessage)
 	for _, tool := range llmCalls {
-		tm := openai.ChatCompletionMessage{
-			Role:       "tool",
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
 			Content:    tool.Content,
 			ToolCallID: tool.ToolCallId,
-		}
-		req.Messages = append(req.Messages, tm)
+		})
 	}
-	// reset tools field
-	req.Tools = nil
-
-	ylog.Debug(" #2 second call", "request", fmt.Sprintf("%+v", req))
+	return messages
+}
 
-	if req.Stream {
-		flusher := w.(http.Flusher)
-		resStream, err := s.LLMProvider.GetChatCompletionsStream(ctx, req, s.Metadata)
-		if err != nil {
-			return err
-		}
-		for {
-			streamRes, err := resStream.Recv()
-			if err == io.EOF {
-				io.WriteString(w, "data: [DONE]")
-				flusher.Flush()
-				return nil
-			}
-			if err != nil {
-				return err
-			}
-			_, _ = io.WriteString(w, "data: ")
-			_ = json.NewEncoder(w).Encode(streamRes)
-			_, _ = io.WriteString(w, "\n")
-			flusher.Flush()
+// completeChoices completes the choices of the response which call the tools when the request asks for more
+// than one choice. Every choice runs its own rounds of the tool calls, the other choices are kept. The usage
+// of the response is the sum of all the calls.
+func (s *Service) completeChoices(ctx context.Context, req openai.ChatCompletionRequest, resp openai.ChatCompletionResponse, tagTools map[uint32]openai.Tool, transID string) (openai.ChatCompletionResponse, []openai.ToolCall, []ai.ToolMessage, error) {
+	var (
+		toolCalls []openai.ToolCall
+		llmCalls  []ai.ToolMessage
+	)
+	for i, choice := range resp.Choices {
+		if choice.FinishReason != openai.FinishReasonToolCalls {
+			continue
 		}
-	} else {
-		resp, err := s.LLMProvider.GetChatCompletions(ctx, req, s.Metadata)
+		res, calls, results, err := s.runToolRounds(ctx, req, choice, tagTools, transID)
 		if err != nil {
-			return err
+			return resp, nil, nil, err
 		}
+		completed := res.Choices[0]
+		completed.Index = choice.Index
+		resp.Choices[i] = completed
+		resp.Usage = addUsage(resp.Usage, res.Usage)
 
-		w.Header().Set("Content-Type", "application/json")
-		return json.NewEncoder(w).Encode(resp)
+		toolCalls = append(toolCalls, calls...)
+		llmCalls = append(llmCalls, results...)
 	}
+	return resp, toolCalls, llmCalls, nil
 }
 
-// run llm-sfn function calls
-func (s *Service) runFunctionCalls(fns map[uint32][]*openai.ToolCall, transID, reqID string) ([]ai.ToolMessage, error) {
+// writeCompletion writes the chat completion response which is not streamed, with the audio of it.
+func writeCompletion(w http.ResponseWriter, audio *audioOutput, resp any) error {
+	data, err := audio.marshalResponse(resp)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// withCallStack attaches the executed tool calls and their results to the response if includeCallStack is true.
+func withCallStack(resp openai.ChatCompletionResponse, toolCalls []openai.ToolCall, toolMessages []ai.ToolMessage, includeCallStack bool) any {
+	if !includeCallStack {
+		return resp
+	}
+	if toolCalls == nil {
+		toolCalls = []openai.ToolCall{}
+	}
+	if toolMessages == nil {
+		toolMessages = []ai.ToolMessage{}
+	}
+	return ai.ChatCompletionResponse{
+		ChatCompletionResponse: resp,
+		CallStack:              ai.CallStack{ToolCalls: toolCalls, ToolMessages: toolMessages},
+	}
+}
+
+// CallAsync starts the llm-sfn function calls without blocking, and returns a future per tool call, so the
+// caller can overlap the tool execution with other work. The base carries the transID, reqID, user query
+// and call chain delivered to the llm-sfn, onProgress is called with the progress chunks written by the
+// llm-sfn until the tool call is resolved, it can be nil. The tool calls are canceled when ctx is done.
+func (s *Service) CallAsync(ctx context.Context, fns map[uint32][]*openai.ToolCall, base *ai.FunctionCall, onProgress func(ai.ToolProgress)) []*ToolCallFuture {
+	futures, _ := s.callAsync(ctx, fns, base, onProgress)
+	return futures
+}
+
+// callAsync starts the tool calls like CallAsync, the returned wait group is done after all the tool calls return.
+func (s *Service) callAsync(ctx context.Context, fns map[uint32][]*openai.ToolCall, base *ai.FunctionCall, onProgress func(ai.ToolProgress)) ([]*ToolCallFuture, *sync.WaitGroup) {
 	if len(fns) == 0 {
 		return nil, nil
 	}
+	transID, reqID := base.TransID, base.ReqID
 
+	md := s.requestMetadata(ctx)
 	asyncCall := &sfnAsyncCall{
-		val: make(map[string]ai.ToolMessage),
+		val:        make(map[string]ai.ToolMessage),
+		calls:      make(map[string]*toolCallAttempt),
+		onProgress: onProgress,
+		md:         md,
 	}
 
 	s.muCallCache.Lock()
 	s.sfnCallCache[reqID] = asyncCall
 	s.muCallCache.Unlock()
 
+	// the first attempts of the tool calls are pipelined in one write, then every tool call awaits its
+	// results, which are correlated by the tool call id, and retries by itself.
+	type dispatched struct {
+		ctx    context.Context
+		tag    uint32
+		fn     *openai.ToolCall
+		future *ToolCallFuture
+		fired  *firedAttempt
+	}
+	var (
+		calls = []dispatched{}
+		batch = []yomo.TaggedData{}
+		fired = []*firedAttempt{}
+	)
 	for tag, tcs := range fns {
 		ylog.Debug("+++invoke toolCalls", "tag", tag, "len(toolCalls)", len(tcs), "transID", transID, "reqID", reqID)
 		for _, fn := range tcs {
-			err := s.fireLlmSfn(tag, fn, transID, reqID)
-			if err != nil {
-				ylog.Error("send data to zipper", "err", err.Error())
-				continue
+			future, callCtx := newToolCallFuture(ctx, fn)
+			call := dispatched{ctx: callCtx, tag: tag, fn: fn, future: future}
+			// the tool calls without llm-sfn are resolved by callLlmSfn.
+			if factor := s.sfnFactor(tag, md); factor > 0 {
+				call.fired = &firedAttempt{attempt: asyncCall.begin(fn.ID, 1, factor)}
+				batch = append(batch, yomo.TaggedData{Tag: tag, Data: s.llmSfnData(tag, fn, base, 1), CallerScopes: callerScopes(md)})
+				fired = append(fired, call.fired)
 			}
-			// wait for this request to be done
-			asyncCall.wg.Add(1 * register.SfnFactor(tag, s.Metadata))
+			calls = append(calls, call)
 		}
 	}
+	if len(batch) > 0 {
+		if err := s.source.WriteBatch(batch); err != nil {
+			for _, f := range fired {
+				f.err = err
+			}
+		}
+	}
+
+	futures := make([]*ToolCallFuture, 0, len(calls))
+	for _, call := range calls {
+		futures = append(futures, call.future)
+
+		asyncCall.wg.Add(1)
+		go s.callLlmSfn(call.ctx, call.tag, call.fn, base, asyncCall, call.future, call.fired)
+	}
 
-	// wait for reducer to finish, the aggregation results
-	asyncCall.wg.Wait()
+	// the results delivered after all the tool calls are resolved are dropped
+	go func() {
+		asyncCall.wg.Wait()
+		s.muCallCache.Lock()
+		delete(s.sfnCallCache, reqID)
+		s.muCallCache.Unlock()
+	}()
+
+	return futures, &asyncCall.wg
+}
 
-	arr := make([]ai.ToolMessage, 0)
+// run llm-sfn function calls and wait for the results, the tool calls which can not be called are answered by
+// the error tool messages.
+func (s *Service) runFunctionCalls(ctx context.Context, fns map[uint32][]*openai.ToolCall, base *ai.FunctionCall, onProgress func(ai.ToolProgress)) ([]ai.ToolMessage, error) {
+	futures, wg := s.callAsync(ctx, fns, base, onProgress)
+	if len(futures) == 0 {
+		return nil, nil
+	}
+	// the tool calls are joined, so none of them outlives the call
+	defer wg.Wait()
 
-	asyncCall.mu.RLock()
-	for _, call := range asyncCall.val {
+	arr := make([]ai.ToolMessage, 0, len(futures))
+	for _, future := range futures {
+		call, err := future.Result()
+		if err != nil {
+			call = toolErrorMessage(future.ToolCallID, ai.ErrorCodeUnavailable, err.Error())
+		}
 		ylog.Debug("---invoke done", "id", call.ToolCallId, "content", call.Content)
-		call.Role = "tool"
 		arr = append(arr, call)
 	}
-	asyncCall.mu.RUnlock()
 
 	return arr, nil
 }
 
-// fireLlmSfn fires the llm-sfn function call by s.source.Write()
-func (s *Service) fireLlmSfn(tag uint32, fn *openai.ToolCall, transID, reqID string) error {
+// sfnFactor returns the number of the llm-sfns visible to the request metadata md replying the tool calls
+// of the tag, only the nearest one replies if the tool calls are routed to the nearest instance.
+func (s *Service) sfnFactor(tag uint32, md metadata.M) int {
+	factor := register.SfnFactor(tag, md)
+	if NearestInstance {
+		return min(factor, 1)
+	}
+	return factor
+}
+
+// fireLlmSfn fires the llm-sfn function call, it is only routed to the llm-sfns visible to the request metadata md.
+func (s *Service) fireLlmSfn(tag uint32, fn *openai.ToolCall, base *ai.FunctionCall, attempt int, md metadata.M) error {
+	return s.source.WriteBatch([]yomo.TaggedData{{Tag: tag, Data: s.llmSfnData(tag, fn, base, attempt), CallerScopes: callerScopes(md)}})
+}
+
+// callerScopes returns the scopes of the request metadata md which the tool calls are routed by, it's nil
+// if md carries no scopes, so the tool calls are routed to all the llm-sfns.
+func callerScopes(md metadata.M) []string {
+	v, ok := md.Get(ai.ScopeKey)
+	if !ok {
+		return nil
+	}
+	scopes := metadata.ParseScopes(v)
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return scopes
+}
+
+// llmSfnData returns the data of the llm-sfn function call.
+func (s *Service) llmSfnData(tag uint32, fn *openai.ToolCall, base *ai.FunctionCall, attempt int) []byte {
 	ylog.Info(
 		"+invoke func",
 		"tag", tag,
-		"transID", transID,
-		"reqID", reqID,
+		"attempt", attempt,
+		"transID", base.TransID,
+		"reqID", base.ReqID,
 		"toolCallID", fn.ID,
 		"function", fn.Function.Name,
 		"arguments", fn.Function.Arguments,
 	)
 	data := &ai.FunctionCall{
-		TransID:      transID,
-		ReqID:        reqID,
+		TransID:      base.TransID,
+		ReqID:        base.ReqID,
 		ToolCallID:   fn.ID,
 		FunctionName: fn.Function.Name,
 		Arguments:    fn.Function.Arguments,
+		UserQuery:    base.UserQuery,
+		CallChain:    base.CallChain,
+		Attempt:      attempt,
 	}
 	buf, err := data.Bytes()
 	if err != nil {
 		ylog.Error("marshal data", "err", err.Error())
 	}
-	return s.source.Write(tag, buf)
+	return buf
+}
+
+// lastUserQuery returns the text of the last user message, it is the user query which fires the function calls.
+func lastUserQuery(messages []openai.ChatCompletionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		if msg.Content != "" || len(msg.MultiContent) == 0 {
+			return msg.Content
+		}
+		texts := make([]string, 0, len(msg.MultiContent))
+		for _, part := range msg.MultiContent {
+			if part.Type == openai.ChatMessagePartTypeText {
+				texts = append(texts, part.Text)
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
 }
 
 // Write writes the data to zipper
@@ -564,16 +904,7 @@ func (s *Service) Write(tag uint32, data []byte) error {
 }
 
 func init() {
-	onEvicted := func(_ string, v *Service) {
-		v.Release()
-	}
-	services = expirable.NewLRU(ServiceCacheSize, onEvicted, ServiceCacheTTL)
-}
-
-type sfnAsyncCall struct {
-	wg  sync.WaitGroup
-	mu  sync.RWMutex
-	val map[string]ai.ToolMessage
+	services = newServiceCache(ServiceCache{TTL: ServiceCacheTTL})
 }
 
 func prepareToolCalls(tcs map[uint32]openai.Tool) ([]openai.Tool, error) {
@@ -0,0 +1,436 @@
+package ai
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/maphash"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ServiceCache is the configuration of the cache of the services, a service is created for every credential.
+// The cache is split into shards, so thousands of credentials don't contend for one lock, every shard evicts
+// its least recently used services when it exceeds its share of MaxBytes or MaxEntries.
+type ServiceCache struct {
+	Shards     int           `yaml:"shards"`      // Shards is the number of the shards, default is 16
+	MaxEntries int           `yaml:"max_entries"` // MaxEntries is the max number of the services, default is ServiceCacheSize
+	MaxBytes   int64         `yaml:"max_bytes"`   // MaxBytes is the estimated memory of the services, default is 256MB
+	TTL        time.Duration `yaml:"ttl"`         // TTL evicts the services idle for it in background, they never expire if it is 0
+}
+
+const (
+	// defaultServiceCacheShards is the default number of the shards.
+	defaultServiceCacheShards = 16
+	// defaultServiceCacheMaxBytes is the default estimated memory of the services.
+	defaultServiceCacheMaxBytes = 256 << 20
+)
+
+// serviceBaseSize is the estimated memory of a service without its metadata, it's dominated by the source,
+// the reducer and the invoker, each of them holds a connection and the write buffers to the zipper.
+const serviceBaseSize = 192 << 10
+
+// size returns the estimated memory of the service.
+func (s *Service) size() int64 {
+	size := serviceBaseSize + len(s.credential)
+	for k, v := range s.Metadata {
+		size += len(k) + len(v)
+	}
+	return int64(size)
+}
+
+// shardedCache is a LRU cache split into shards by the hash of the keys, the entries are weighed by sizeOf.
+// The evicted entries are passed to onEvicted out of the locks.
+type shardedCache[V any] struct {
+	seed      maphash.Seed
+	conf      ServiceCache
+	shards    []*cacheShard[V]
+	ttl       time.Duration
+	sizeOf    func(V) int64
+	onEvicted func(string, V)
+	metrics   *cacheMetrics
+	stats     cacheStats
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// cacheStats are the counters of the cache since it is created, they are reported by the introspection
+// besides the metrics, so the cache can be tuned without a metrics backend.
+type cacheStats struct {
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+type cacheShard[V any] struct {
+	mu         sync.Mutex
+	items      map[string]*list.Element
+	lru        *list.List // the front is the most recently used
+	bytes      int64
+	maxBytes   int64
+	maxEntries int
+}
+
+type cacheEntry[V any] struct {
+	key        string
+	value      V
+	size       int64
+	created    time.Time
+	lastAccess time.Time
+}
+
+// newShardedCache returns a new shardedCache, the max entries and the max bytes are shared evenly by the shards.
+// It starts the background eviction if ttl is greater than 0, call close to stop it.
+func newShardedCache[V any](conf ServiceCache, sizeOf func(V) int64, onEvicted func(string, V)) *shardedCache[V] {
+	if conf.Shards <= 0 {
+		conf.Shards = defaultServiceCacheShards
+	}
+	if conf.MaxEntries <= 0 {
+		conf.MaxEntries = ServiceCacheSize
+	}
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = defaultServiceCacheMaxBytes
+	}
+	c := &shardedCache[V]{
+		seed:      maphash.MakeSeed(),
+		conf:      conf,
+		shards:    make([]*cacheShard[V], conf.Shards),
+		ttl:       conf.TTL,
+		sizeOf:    sizeOf,
+		onEvicted: onEvicted,
+		metrics:   newCacheMetrics(),
+		stop:      make(chan struct{}),
+	}
+	for i := range c.shards {
+		c.shards[i] = &cacheShard[V]{
+			items:      make(map[string]*list.Element),
+			lru:        list.New(),
+			maxBytes:   max(conf.MaxBytes/int64(conf.Shards), 1),
+			maxEntries: max(conf.MaxEntries/conf.Shards, 1),
+		}
+	}
+	if c.ttl > 0 {
+		go c.evictExpiredLoop(max(c.ttl/2, time.Second))
+	}
+	return c
+}
+
+func (c *shardedCache[V]) shard(key string) *cacheShard[V] {
+	return c.shards[maphash.String(c.seed, key)%uint64(len(c.shards))]
+}
+
+// Get returns the value of the key, the expired entries are missed.
+func (c *shardedCache[V]) Get(key string) (V, bool) {
+	s := c.shard(key)
+	now := time.Now()
+
+	s.mu.Lock()
+	elem, ok := s.items[key]
+	if !ok || c.expired(elem.Value.(*cacheEntry[V]), now) {
+		s.mu.Unlock()
+		c.stats.misses.Add(1)
+		c.metrics.lookups.Add(context.Background(), 1, c.metrics.miss)
+		var zero V
+		return zero, false
+	}
+	entry := elem.Value.(*cacheEntry[V])
+	entry.lastAccess = now
+	s.lru.MoveToFront(elem)
+	s.mu.Unlock()
+
+	c.stats.hits.Add(1)
+	c.metrics.lookups.Add(context.Background(), 1, c.metrics.hit)
+	return entry.value, true
+}
+
+// LoadOrStore returns the existing value of the key if it's present, otherwise it stores the value.
+// The loaded result is true if the value is loaded, the caller should release the value not stored.
+func (c *shardedCache[V]) LoadOrStore(key string, value V) (actual V, loaded bool) {
+	s := c.shard(key)
+	now := time.Now()
+
+	s.mu.Lock()
+	var evicted []*cacheEntry[V]
+	if elem, ok := s.items[key]; ok {
+		entry := elem.Value.(*cacheEntry[V])
+		if !c.expired(entry, now) {
+			entry.lastAccess = now
+			s.lru.MoveToFront(elem)
+			s.mu.Unlock()
+			return entry.value, true
+		}
+		evicted = append(evicted, s.remove(elem))
+	}
+	entry := &cacheEntry[V]{key: key, value: value, size: c.sizeOf(value), created: now, lastAccess: now}
+	s.items[key] = s.lru.PushFront(entry)
+	s.bytes += entry.size
+	c.metrics.entries.Add(context.Background(), 1)
+	c.metrics.bytes.Add(context.Background(), entry.size)
+	expired := len(evicted)
+
+	// the newest entry is kept even if it exceeds the max bytes alone.
+	for s.lru.Len() > 1 && (s.bytes > s.maxBytes || s.lru.Len() > s.maxEntries) {
+		evicted = append(evicted, s.remove(s.lru.Back()))
+	}
+	s.mu.Unlock()
+
+	c.evict(evicted[:expired], "ttl")
+	c.evict(evicted[expired:], "size")
+	return value, false
+}
+
+// Remove evicts the entry of the key, it returns false if the key is not present.
+func (c *shardedCache[V]) Remove(key string) bool {
+	s := c.shard(key)
+
+	s.mu.Lock()
+	elem, ok := s.items[key]
+	if !ok {
+		s.mu.Unlock()
+		return false
+	}
+	entry := s.remove(elem)
+	s.mu.Unlock()
+
+	c.evict([]*cacheEntry[V]{entry}, "admin")
+	return true
+}
+
+// Len returns the number of the entries, including the expired ones not evicted yet.
+func (c *shardedCache[V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += s.lru.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// snapshot returns the copies of the entries, the most recently used ones of every shard come first.
+func (c *shardedCache[V]) snapshot() []cacheEntry[V] {
+	var entries []cacheEntry[V]
+	for _, s := range c.shards {
+		s.mu.Lock()
+		for elem := s.lru.Front(); elem != nil; elem = elem.Next() {
+			entries = append(entries, *elem.Value.(*cacheEntry[V]))
+		}
+		s.mu.Unlock()
+	}
+	return entries
+}
+
+// close stops the background eviction and evicts all the entries.
+func (c *shardedCache[V]) close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	for _, s := range c.shards {
+		s.mu.Lock()
+		evicted := make([]*cacheEntry[V], 0, s.lru.Len())
+		for s.lru.Len() > 0 {
+			evicted = append(evicted, s.remove(s.lru.Back()))
+		}
+		s.mu.Unlock()
+		c.evict(evicted, "close")
+	}
+}
+
+func (c *shardedCache[V]) evictExpiredLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.evictExpired(now)
+		}
+	}
+}
+
+// evictExpired evicts the expired entries, the entries idle the longest are at the back of the lru list.
+func (c *shardedCache[V]) evictExpired(now time.Time) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		var evicted []*cacheEntry[V]
+		for elem := s.lru.Back(); elem != nil && c.expired(elem.Value.(*cacheEntry[V]), now); elem = s.lru.Back() {
+			evicted = append(evicted, s.remove(elem))
+		}
+		s.mu.Unlock()
+		c.evict(evicted, "ttl")
+	}
+}
+
+func (c *shardedCache[V]) expired(entry *cacheEntry[V], now time.Time) bool {
+	return c.ttl > 0 && now.Sub(entry.lastAccess) > c.ttl
+}
+
+func (c *shardedCache[V]) evict(entries []*cacheEntry[V], reason string) {
+	for _, entry := range entries {
+		c.metrics.entries.Add(context.Background(), -1)
+		c.metrics.bytes.Add(context.Background(), -entry.size)
+		c.stats.evictions.Add(1)
+		c.metrics.evictions.Add(context.Background(), 1, metric.WithAttributes(attribute.String("reason", reason)))
+		if c.onEvicted != nil {
+			c.onEvicted(entry.key, entry.value)
+		}
+	}
+}
+
+// remove removes the element from the shard, the caller must hold the lock.
+func (s *cacheShard[V]) remove(elem *list.Element) *cacheEntry[V] {
+	entry := s.lru.Remove(elem).(*cacheEntry[V])
+	delete(s.items, entry.key)
+	s.bytes -= entry.size
+	return entry
+}
+
+// cacheMetrics are the OpenTelemetry instruments of the service cache.
+type cacheMetrics struct {
+	// lookups is the number of the lookups, the result attribute is hit or miss.
+	lookups metric.Int64Counter
+	// evictions is the number of the evicted services, the reason attribute is size, ttl, close or admin.
+	evictions metric.Int64Counter
+	// entries is the number of the cached services.
+	entries metric.Int64UpDownCounter
+	// bytes is the estimated memory of the cached services.
+	bytes metric.Int64UpDownCounter
+
+	hit  metric.AddOption
+	miss metric.AddOption
+}
+
+func newCacheMetrics() *cacheMetrics {
+	meter := otel.Meter("github.com/yomorun/yomo/pkg/bridge/ai")
+
+	lookups, err := meter.Int64Counter(
+		"yomo.llm.service_cache.lookups",
+		metric.WithDescription("The number of the lookups of the service cache."),
+		metric.WithUnit("{lookup}"),
+	)
+	otel.Handle(err)
+	evictions, err := meter.Int64Counter(
+		"yomo.llm.service_cache.evictions",
+		metric.WithDescription("The number of the services evicted from the service cache."),
+		metric.WithUnit("{service}"),
+	)
+	otel.Handle(err)
+	entries, err := meter.Int64UpDownCounter(
+		"yomo.llm.service_cache.entries",
+		metric.WithDescription("The number of the services in the service cache."),
+		metric.WithUnit("{service}"),
+	)
+	otel.Handle(err)
+	bytes, err := meter.Int64UpDownCounter(
+		"yomo.llm.service_cache.size",
+		metric.WithDescription("The estimated memory of the services in the service cache."),
+		metric.WithUnit("By"),
+	)
+	otel.Handle(err)
+
+	return &cacheMetrics{
+		lookups:   lookups,
+		evictions: evictions,
+		entries:   entries,
+		bytes:     bytes,
+		hit:       metric.WithAttributes(attribute.String("result", "hit")),
+		miss:      metric.WithAttributes(attribute.String("result", "miss")),
+	}
+}
+
+// ServiceCacheStatus is the introspection of the service cache, it is returned by GET /admin/cache.
+type ServiceCacheStatus struct {
+	Shards     int             `json:"shards"`
+	MaxEntries int             `json:"max_entries"`
+	MaxBytes   int64           `json:"max_bytes"`
+	TTL        string          `json:"ttl"`
+	Hits       int64           `json:"hits"`
+	Misses     int64           `json:"misses"`
+	Evictions  int64           `json:"evictions"`
+	Bytes      int64           `json:"bytes"`
+	Services   []ServiceStatus `json:"services"`
+}
+
+// ServiceStatus is the status of a cached service, the credential is identified by its hash only.
+type ServiceStatus struct {
+	CredentialHash string `json:"credential_hash"`
+	Age            string `json:"age"`
+	Idle           string `json:"idle"`
+	Bytes          int64  `json:"bytes"`
+	// Source is the state of the connection of the source to zipper: connected, disconnected or unknown.
+	Source string `json:"source"`
+}
+
+// connectedSource is the source which reports its connection state.
+type connectedSource interface {
+	Connected() bool
+}
+
+// GetServiceCacheStatus returns the introspection of the service cache.
+func GetServiceCacheStatus() ServiceCacheStatus {
+	c := services
+	now := time.Now()
+
+	status := ServiceCacheStatus{
+		Shards:     len(c.shards),
+		MaxEntries: c.conf.MaxEntries,
+		MaxBytes:   c.conf.MaxBytes,
+		TTL:        c.ttl.String(),
+		Hits:       c.stats.hits.Load(),
+		Misses:     c.stats.misses.Load(),
+		Evictions:  c.stats.evictions.Load(),
+		Services:   []ServiceStatus{},
+	}
+	for _, entry := range c.snapshot() {
+		status.Bytes += entry.size
+		status.Services = append(status.Services, ServiceStatus{
+			CredentialHash: credentialHash(entry.key),
+			Age:            now.Sub(entry.created).Round(time.Second).String(),
+			Idle:           now.Sub(entry.lastAccess).Round(time.Second).String(),
+			Bytes:          entry.size,
+			Source:         sourceState(entry.value),
+		})
+	}
+	return status
+}
+
+// credentialHash returns the prefix of the sha256 of the credential, it tells the services apart without
+// revealing the credentials.
+func credentialHash(credential string) string {
+	sum := sha256.Sum256([]byte(credential))
+	return hex.EncodeToString(sum[:8])
+}
+
+func sourceState(s *Service) string {
+	source, ok := s.source.(connectedSource)
+	if !ok {
+		return "unknown"
+	}
+	if source.Connected() {
+		return "connected"
+	}
+	return "disconnected"
+}
+
+// HandleAdminCache is the handler for GET /admin/cache, it returns the counters of the service cache and the
+// cached services, so the size and the ttl of the cache can be tuned. The requests are authenticated by the
+// bearer token AdminToken.
+func HandleAdminCache(w http.ResponseWriter, r *http.Request) {
+	if code, err := authorizeAdmin(r); err != nil {
+		RespondWithError(w, code, err)
+		return
+	}
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	respondJSON(w, GetServiceCacheStatus())
+}
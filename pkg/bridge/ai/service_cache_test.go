@@ -0,0 +1,163 @@
+package ai
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type evictedRecorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *evictedRecorder) onEvicted(key string, _ string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, key)
+}
+
+func (r *evictedRecorder) evicted() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.keys...)
+}
+
+func stringSize(v string) int64 { return int64(len(v)) }
+
+func TestShardedCache(t *testing.T) {
+	t.Run("load or store", func(t *testing.T) {
+		r := &evictedRecorder{}
+		c := newShardedCache(ServiceCache{Shards: 4}, stringSize, r.onEvicted)
+		defer c.close()
+
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+
+		actual, loaded := c.LoadOrStore("a", "1")
+		assert.False(t, loaded)
+		assert.Equal(t, "1", actual)
+
+		actual, loaded = c.LoadOrStore("a", "2")
+		assert.True(t, loaded)
+		assert.Equal(t, "1", actual)
+
+		v, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, "1", v)
+		assert.Empty(t, r.evicted())
+	})
+
+	t.Run("evict by bytes", func(t *testing.T) {
+		r := &evictedRecorder{}
+		c := newShardedCache(ServiceCache{Shards: 1, MaxBytes: 10}, stringSize, r.onEvicted)
+		defer c.close()
+
+		c.LoadOrStore("a", "aaaa")
+		c.LoadOrStore("b", "bbbb")
+		c.Get("a") // b is the least recently used
+		c.LoadOrStore("c", "cccc")
+
+		assert.Equal(t, []string{"b"}, r.evicted())
+		assert.Equal(t, 2, c.Len())
+
+		// the entry larger than the max bytes is kept alone.
+		c.LoadOrStore("d", "dddddddddddd")
+		assert.Equal(t, []string{"b", "a", "c"}, r.evicted())
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("evict by entries", func(t *testing.T) {
+		r := &evictedRecorder{}
+		c := newShardedCache(ServiceCache{Shards: 1, MaxEntries: 2}, stringSize, r.onEvicted)
+		defer c.close()
+
+		c.LoadOrStore("a", "1")
+		c.LoadOrStore("b", "2")
+		c.LoadOrStore("c", "3")
+		assert.Equal(t, []string{"a"}, r.evicted())
+	})
+
+	t.Run("evict expired", func(t *testing.T) {
+		r := &evictedRecorder{}
+		c := newShardedCache(ServiceCache{Shards: 2, TTL: time.Hour}, stringSize, r.onEvicted)
+		defer c.close()
+
+		c.LoadOrStore("a", "1")
+		c.LoadOrStore("b", "2")
+		c.shard("a").items["a"].Value.(*cacheEntry[string]).lastAccess = time.Now().Add(-2 * time.Hour)
+
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+
+		c.evictExpired(time.Now())
+		assert.Equal(t, []string{"a"}, r.evicted())
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("close", func(t *testing.T) {
+		r := &evictedRecorder{}
+		c := newShardedCache(ServiceCache{}, stringSize, r.onEvicted)
+
+		c.LoadOrStore("a", "1")
+		c.LoadOrStore("b", "2")
+		c.close()
+		assert.ElementsMatch(t, []string{"a", "b"}, r.evicted())
+		assert.Equal(t, 0, c.Len())
+	})
+}
+
+func TestGetServiceCacheStatus(t *testing.T) {
+	old := services
+	services = newShardedCache(ServiceCache{Shards: 2, MaxEntries: 10, TTL: time.Minute}, (*Service).size, nil)
+	t.Cleanup(func() {
+		services.close()
+		services = old
+	})
+
+	services.LoadOrStore("token-a", &Service{credential: "token-a", source: &batchRecorderSource{}})
+	services.Get("token-a")
+	services.Get("token-b")
+
+	status := GetServiceCacheStatus()
+	assert.Equal(t, 2, status.Shards)
+	assert.Equal(t, 10, status.MaxEntries)
+	assert.Equal(t, "1m0s", status.TTL)
+	assert.Equal(t, int64(1), status.Hits)
+	assert.Equal(t, int64(1), status.Misses)
+	assert.Equal(t, int64(0), status.Evictions)
+	assert.Len(t, status.Services, 1)
+	assert.Equal(t, credentialHash("token-a"), status.Services[0].CredentialHash)
+	assert.NotContains(t, status.Services[0].CredentialHash, "token-a")
+	assert.Equal(t, "unknown", status.Services[0].Source)
+	assert.Equal(t, status.Bytes, status.Services[0].Bytes)
+}
+
+func TestHandleAdminCache(t *testing.T) {
+	t.Cleanup(func() { AdminToken = "" })
+	AdminToken = "admin"
+
+	tests := []struct {
+		name         string
+		method       string
+		token        string
+		expectedCode int
+	}{
+		{name: "unauthorized", method: http.MethodGet, expectedCode: http.StatusUnauthorized},
+		{name: "method", method: http.MethodPost, token: "admin", expectedCode: http.StatusMethodNotAllowed},
+		{name: "ok", method: http.MethodGet, token: "admin", expectedCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/admin/cache", nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			HandleAdminCache(w, r)
+			assert.Equal(t, tt.expectedCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+func TestWithCallStack(t *testing.T) {
+	resp := openai.ChatCompletionResponse{
+		ID:      "chatcmpl-1",
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "It's sunny"}}},
+	}
+	toolCalls := []openai.ToolCall{
+		{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}},
+	}
+	toolMessages := []ai.ToolMessage{{Role: "tool", Content: "sunny", ToolCallId: "call_1"}}
+
+	t.Run("exclude call stack", func(t *testing.T) {
+		assert.Equal(t, resp, withCallStack(resp, toolCalls, toolMessages, false))
+	})
+
+	t.Run("include call stack", func(t *testing.T) {
+		buf, err := json.Marshal(withCallStack(resp, toolCalls, toolMessages, true))
+		assert.NoError(t, err)
+
+		var got map[string]json.RawMessage
+		assert.NoError(t, json.Unmarshal(buf, &got))
+		assert.JSONEq(t, `"chatcmpl-1"`, string(got["id"]))
+		assert.JSONEq(t, `{
+			"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{\"city\":\"Paris\"}"}}],
+			"tool_messages":[{"role":"tool","content":"sunny","tool_call_id":"call_1"}]
+		}`, string(got["call_stack"]))
+	})
+
+	t.Run("include empty call stack", func(t *testing.T) {
+		buf, err := json.Marshal(withCallStack(resp, nil, nil, true))
+		assert.NoError(t, err)
+
+		var got map[string]json.RawMessage
+		assert.NoError(t, json.Unmarshal(buf, &got))
+		assert.JSONEq(t, `{"tool_calls":[],"tool_messages":[]}`, string(got["call_stack"]))
+	})
+}
+
+// toolResultSource answers the tool calls written to the llm-sfns by the result.
+type toolResultSource struct {
+	yomo.Source
+	service *Service
+	result  string
+}
+
+func (s *toolResultSource) Write(_ uint32, data []byte) error {
+	return s.WriteBatch([]yomo.TaggedData{{Data: data}})
+}
+
+func (s *toolResultSource) WriteBatch(batch []yomo.TaggedData) error {
+	for _, d := range batch {
+		var invoke ai.FunctionCall
+		if err := invoke.FromBytes(d.Data); err != nil {
+			return err
+		}
+		invoke.IsOK, invoke.Result = true, s.result
+		go s.service.reduce(&invoke)
+	}
+	return nil
+}
+
+// choicesProvider returns two choices for the first call, the first one calls get-weather.
+type choicesProvider struct {
+	MockLLMProvider
+	mu   sync.Mutex
+	reqs []openai.ChatCompletionRequest
+}
+
+func (p *choicesProvider) GetChatCompletions(_ context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reqs = append(p.reqs, req)
+
+	if len(req.Tools) == 0 {
+		return openai.ChatCompletionResponse{
+			ID:      "chatcmpl-2",
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: "It's sunny"}, FinishReason: openai.FinishReasonStop}},
+			Usage:   openai.Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25},
+		}, nil
+	}
+	return openai.ChatCompletionResponse{
+		ID: "chatcmpl-1",
+		Choices: []openai.ChatCompletionChoice{
+			{Index: 0, FinishReason: openai.FinishReasonToolCalls, Message: openai.ChatCompletionMessage{Role: "assistant", ToolCalls: []openai.ToolCall{
+				{ID: "call_1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "get-weather", Arguments: `{"city":"Paris"}`}},
+			}}},
+			{Index: 1, FinishReason: openai.FinishReasonStop, Message: openai.ChatCompletionMessage{Role: "assistant", Content: "Which city?"}},
+		},
+		Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12},
+	}, nil
+}
+
+func TestGetChatCompletionsChoices(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0xA1, &openai.FunctionDefinition{Name: "get-weather"}, 2101, md))
+	defer register.UnregisterFunction(2101, md)
+
+	provider := &choicesProvider{MockLLMProvider: MockLLMProvider{name: "choices"}}
+	service := &Service{
+		LLMProvider:  provider,
+		Metadata:     md,
+		credential:   "token",
+		sfnCallCache: make(map[string]*sfnAsyncCall),
+		metrics:      newLLMMetrics(),
+	}
+	service.SetSystemPrompt("")
+	service.source = &toolResultSource{service: service, result: "sunny"}
+
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		N:        2,
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "How is the weather?"}},
+	}
+
+	t.Run("every choice calls its tools", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		assert.NoError(t, service.GetChatCompletions(context.Background(), req, "trans-1", w, true))
+
+		var resp ai.ChatCompletionResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Len(t, resp.Choices, 2)
+		assert.Equal(t, "It's sunny", resp.Choices[0].Message.Content)
+		assert.Equal(t, 0, resp.Choices[0].Index)
+		assert.Equal(t, "Which city?", resp.Choices[1].Message.Content)
+		assert.Equal(t, openai.Usage{PromptTokens: 30, CompletionTokens: 7, TotalTokens: 37}, resp.Usage)
+		assert.Equal(t, []ai.ToolMessage{{Role: "tool", Content: "sunny", ToolCallId: "call_1"}}, resp.CallStack.ToolMessages)
+
+		// the second call completes one choice with the results of its tool calls.
+		assert.Len(t, provider.reqs, 2)
+		second := provider.reqs[1]
+		assert.Equal(t, 1, second.N)
+		assert.Len(t, second.Messages, 3)
+		assert.Equal(t, "call_1", second.Messages[2].ToolCallID)
+		assert.Equal(t, "sunny", second.Messages[2].Content)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		req := req
+		req.Stream = true
+		err := service.GetChatCompletions(context.Background(), req, "trans-2", httptest.NewRecorder(), false)
+		assert.ErrorIs(t, err, ErrStreamChoices)
+	})
+}
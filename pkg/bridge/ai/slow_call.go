@@ -0,0 +1,33 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// SlowCallThreshold is the threshold of the slow tool calls and llm provider calls, the calls which
+// exceed it are logged as warnings with the full context. Zero disables the slow call logging.
+var SlowCallThreshold time.Duration
+
+// logSlowCall logs the call if it exceeds the SlowCallThreshold, it returns true if the call is logged.
+func logSlowCall(msg string, duration time.Duration, credential string, keyvals ...any) bool {
+	if SlowCallThreshold <= 0 || duration < SlowCallThreshold {
+		return false
+	}
+	keyvals = append(keyvals,
+		"duration", duration,
+		"threshold", SlowCallThreshold,
+		"credential_hash", credentialHash(credential),
+	)
+	ylog.Warn(msg, keyvals...)
+	return true
+}
+
+// argsHash returns the sha256 of the arguments, the arguments may carry the sensitive user data.
+func argsHash(args string) string {
+	sum := sha256.Sum256([]byte(args))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,19 @@
+package ai
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogSlowCall(t *testing.T) {
+	defer func(threshold time.Duration) { SlowCallThreshold = threshold }(SlowCallThreshold)
+
+	SlowCallThreshold = 0
+	assert.False(t, logSlowCall("slow tool call", time.Minute, "token:secret"), "disabled")
+
+	SlowCallThreshold = time.Second
+	assert.False(t, logSlowCall("slow tool call", time.Millisecond, "token:secret"))
+	assert.True(t, logSlowCall("slow tool call", 2*time.Second, "token:secret", "function", "get-weather"))
+}
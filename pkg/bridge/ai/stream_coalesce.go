@@ -0,0 +1,117 @@
+package ai
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamCoalesce is the configuration of coalescing the chunks of the stream responses. The chatty providers
+// send a chunk per token, flushing every chunk costs a syscall and a proxy write, so the chunks are flushed
+// together at most every Interval, and the pending chunks are never delayed longer than Interval.
+type StreamCoalesce struct {
+	Interval  time.Duration `yaml:"interval"`   // Interval is the min interval of the flushes, the chunks are not coalesced if it is 0, eg: 50ms
+	MaxChunks int           `yaml:"max_chunks"` // MaxChunks flushes the pending chunks once their number reaches it regardless of the interval, it's not limited if it is 0
+}
+
+// streamCoalesce is the coalescing of the stream responses, it is disabled if it is nil.
+var streamCoalesce atomic.Pointer[StreamCoalesce]
+
+// ConfigureStreamCoalesce coalesces the chunks of the stream responses by the config.
+func ConfigureStreamCoalesce(conf StreamCoalesce) {
+	if conf.Interval <= 0 {
+		streamCoalesce.Store(nil)
+		return
+	}
+	streamCoalesce.Store(&conf)
+}
+
+// coalescingWriter defers the flushes of the stream response, the chunks written between two flushes are
+// flushed together. Close must be called before the handler returns, it flushes the pending chunks.
+type coalescingWriter struct {
+	http.ResponseWriter
+	flusher http.Flusher
+	conf    StreamCoalesce
+
+	mu        sync.Mutex // mu guards the writes, the deferred flush runs in the timer goroutine
+	pending   int
+	flushedAt time.Time
+	timer     *time.Timer
+	closed    bool
+}
+
+func newCoalescingWriter(w http.ResponseWriter, conf StreamCoalesce) *coalescingWriter {
+	flusher, _ := w.(http.Flusher)
+	return &coalescingWriter{
+		ResponseWriter: w,
+		flusher:        flusher,
+		conf:           conf,
+		flushedAt:      time.Now(),
+	}
+}
+
+func (w *coalescingWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the pending chunks if the interval has passed since the last flush or MaxChunks is reached,
+// otherwise the flush is deferred to the end of the interval.
+func (w *coalescingWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending++
+	wait := w.conf.Interval - time.Since(w.flushedAt)
+	if wait <= 0 || (w.conf.MaxChunks > 0 && w.pending >= w.conf.MaxChunks) {
+		w.flushLocked()
+		return
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(wait, w.deferredFlush)
+	}
+}
+
+func (w *coalescingWriter) deferredFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timer = nil
+	if !w.closed && w.pending > 0 {
+		w.flushLocked()
+	}
+}
+
+func (w *coalescingWriter) flushLocked() {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+	w.pending = 0
+	w.flushedAt = time.Now()
+}
+
+// Close flushes the pending chunks, the writer must not be flushed after the handler returns.
+func (w *coalescingWriter) Close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pending > 0 {
+		w.flushLocked()
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.closed = true
+}
+
+// Unwrap returns the underlying http.ResponseWriter for http.ResponseController.
+func (w *coalescingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
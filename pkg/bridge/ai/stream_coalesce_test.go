@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"io"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingRecorder struct {
+	*httptest.ResponseRecorder
+	flushes atomic.Int32
+}
+
+func (r *countingRecorder) Flush() {
+	r.flushes.Add(1)
+}
+
+func TestCoalescingWriter(t *testing.T) {
+	t.Run("flush at the interval", func(t *testing.T) {
+		rec := &countingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		w := newCoalescingWriter(rec, StreamCoalesce{Interval: 50 * time.Millisecond})
+
+		for i := 0; i < 10; i++ {
+			_, _ = io.WriteString(w, "data: chunk\n\n")
+			w.Flush()
+		}
+		assert.Equal(t, int32(0), rec.flushes.Load())
+		// the pending chunks are flushed at the end of the interval.
+		assert.Eventually(t, func() bool { return rec.flushes.Load() == 1 }, time.Second, 5*time.Millisecond)
+
+		w.Close()
+		assert.Equal(t, int32(1), rec.flushes.Load())
+		assert.Equal(t, 10*len("data: chunk\n\n"), rec.Body.Len())
+	})
+
+	t.Run("flush at max chunks", func(t *testing.T) {
+		rec := &countingRecorder{ResponseRecorder: httptest.NewRecorder()}
+		w := newCoalescingWriter(rec, StreamCoalesce{Interval: time.Hour, MaxChunks: 4})
+
+		for i := 0; i < 10; i++ {
+			_, _ = io.WriteString(w, "data: chunk\n\n")
+			w.Flush()
+		}
+		assert.Equal(t, int32(2), rec.flushes.Load())
+
+		// the pending chunks are flushed when it's closed.
+		w.Close()
+		assert.Equal(t, int32(3), rec.flushes.Load())
+	})
+}
+
+func TestConfigureStreamCoalesce(t *testing.T) {
+	t.Cleanup(func() { streamCoalesce.Store(nil) })
+
+	ConfigureStreamCoalesce(StreamCoalesce{Interval: 50 * time.Millisecond, MaxChunks: 16})
+	assert.Equal(t, &StreamCoalesce{Interval: 50 * time.Millisecond, MaxChunks: 16}, streamCoalesce.Load())
+
+	ConfigureStreamCoalesce(StreamCoalesce{MaxChunks: 16})
+	assert.Nil(t, streamCoalesce.Load())
+}
@@ -0,0 +1,121 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// SystemPromptOp is how the system prompt of the service is applied to the messages of the request.
+type SystemPromptOp string
+
+const (
+	// SystemPromptOpOverwrite overwrites the system messages of the request by the system prompt, the system
+	// prompt is appended if the request has no system message. It's the default.
+	SystemPromptOpOverwrite SystemPromptOp = "overwrite"
+	// SystemPromptOpPrefix prefixes the system prompt to the first system message of the request, the system
+	// prompt is the first message if the request has no system message.
+	SystemPromptOpPrefix SystemPromptOp = "prefix"
+	// SystemPromptOpDisabled leaves the messages of the request untouched.
+	SystemPromptOpDisabled SystemPromptOp = "disabled"
+)
+
+const (
+	// SystemPromptOpHeader is the header of the request which overrides the system prompt operation of the
+	// caller, it's one of disabled, prefix and overwrite.
+	SystemPromptOpHeader = "X-YoMo-System-Prompt-Op"
+	// SystemPromptHeader is the header of the request which carries the inline system prompt, it's applied
+	// instead of the system prompt of the caller.
+	SystemPromptHeader = "X-YoMo-System-Prompt"
+)
+
+// ErrSystemPromptOp is returned when the system prompt operation of the request is unknown.
+var ErrSystemPromptOp = errors.New("invalid system prompt operation")
+
+// SetSystemPromptOp sets the system prompt operation of the caller.
+func (s *Service) SetSystemPromptOp(op SystemPromptOp) {
+	s.promptOp.Store(op)
+}
+
+// OpSystemPrompt applies the system prompt to the messages of the request by the system prompt operation.
+// The operation and the system prompt of the caller are overridden by the headers of the request, see
+// SystemPromptOpHeader and SystemPromptHeader.
+func (s *Service) OpSystemPrompt(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error) {
+	op, _ := s.promptOp.Load().(SystemPromptOp)
+	prompt, _ := s.systemPrompt.Load().(string)
+
+	override := fromSystemPromptContext(ctx)
+	if override.op != "" {
+		op = SystemPromptOp(override.op)
+	}
+	if override.prompt != "" {
+		prompt = override.prompt
+	}
+	if op == "" {
+		op = SystemPromptOpOverwrite
+	}
+
+	switch op {
+	case SystemPromptOpOverwrite:
+		req = overWriteSystemPrompt(req, prompt)
+	case SystemPromptOpPrefix:
+		req = prefixSystemPrompt(req, prompt)
+	case SystemPromptOpDisabled:
+	default:
+		return req, fmt.Errorf("%w: %q, it must be one of disabled, prefix and overwrite", ErrSystemPromptOp, op)
+	}
+	if override.op != "" || override.prompt != "" {
+		ylog.Debug("system prompt of the request", "transID", FromTransIDContext(ctx), "op", op, "inline_prompt", override.prompt != "")
+	}
+	return req, nil
+}
+
+// prefixSystemPrompt prefixes the system prompt to the first system message of the request.
+func prefixSystemPrompt(req openai.ChatCompletionRequest, sysPrompt string) openai.ChatCompletionRequest {
+	if sysPrompt == "" {
+		return req
+	}
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages)+1)
+	prefixed := false
+	for _, msg := range req.Messages {
+		if msg.Role == openai.ChatMessageRoleSystem && !prefixed {
+			if len(msg.MultiContent) > 0 {
+				msg.MultiContent = append([]openai.ChatMessagePart{{Type: openai.ChatMessagePartTypeText, Text: sysPrompt + "\n\n"}}, msg.MultiContent...)
+			} else {
+				msg.Content = sysPrompt + "\n\n" + msg.Content
+			}
+			prefixed = true
+		}
+		messages = append(messages, msg)
+	}
+	if !prefixed {
+		messages = append([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: sysPrompt}}, messages...)
+	}
+	req.Messages = messages
+	return req
+}
+
+// systemPromptOverride is the system prompt operation and the inline system prompt of the request.
+type systemPromptOverride struct {
+	op     string
+	prompt string
+}
+
+type systemPromptContextKey struct{}
+
+// WithSystemPromptContext adds the system prompt operation and the inline system prompt of the request to the
+// request context, they are validated by Service.OpSystemPrompt.
+func WithSystemPromptContext(ctx context.Context, op string, prompt string) context.Context {
+	if op == "" && prompt == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, systemPromptContextKey{}, systemPromptOverride{op: op, prompt: prompt})
+}
+
+func fromSystemPromptContext(ctx context.Context) systemPromptOverride {
+	override, _ := ctx.Value(systemPromptContextKey{}).(systemPromptOverride)
+	return override
+}
@@ -0,0 +1,84 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpSystemPrompt(t *testing.T) {
+	var (
+		system = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: "Answer in French."}
+		user   = openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "How is the weather?"}
+	)
+
+	tests := []struct {
+		name        string
+		callerOp    SystemPromptOp
+		headerOp    string
+		inline      string
+		messages    []openai.ChatCompletionMessage
+		expected    []openai.ChatCompletionMessage
+		expectedErr string
+	}{
+		{
+			name:     "overwrite by default",
+			messages: []openai.ChatCompletionMessage{system, user},
+			expected: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "You are a weather bot."}, user},
+		},
+		{
+			name:     "prefix of the caller",
+			callerOp: SystemPromptOpPrefix,
+			messages: []openai.ChatCompletionMessage{system, user},
+			expected: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "You are a weather bot.\n\nAnswer in French."}, user},
+		},
+		{
+			name:     "prefix without system message",
+			headerOp: "prefix",
+			messages: []openai.ChatCompletionMessage{user},
+			expected: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "You are a weather bot."}, user},
+		},
+		{
+			name:     "disabled by the header",
+			callerOp: SystemPromptOpPrefix,
+			headerOp: "disabled",
+			messages: []openai.ChatCompletionMessage{system, user},
+			expected: []openai.ChatCompletionMessage{system, user},
+		},
+		{
+			name:     "inline prompt",
+			headerOp: "overwrite",
+			inline:   "You are a travel agent.",
+			messages: []openai.ChatCompletionMessage{system, user},
+			expected: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "You are a travel agent."}, user},
+		},
+		{
+			name:        "unknown op",
+			headerOp:    "append",
+			messages:    []openai.ChatCompletionMessage{system, user},
+			expectedErr: `invalid system prompt operation: "append", it must be one of disabled, prefix and overwrite`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &Service{}
+			service.SetSystemPrompt("You are a weather bot.")
+			if tt.callerOp != "" {
+				service.SetSystemPromptOp(tt.callerOp)
+			}
+			ctx := WithSystemPromptContext(context.Background(), tt.headerOp, tt.inline)
+			messages := append([]openai.ChatCompletionMessage{}, tt.messages...)
+
+			req, err := service.OpSystemPrompt(ctx, openai.ChatCompletionRequest{Messages: messages})
+			if tt.expectedErr != "" {
+				assert.ErrorIs(t, err, ErrSystemPromptOp)
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, req.Messages)
+		})
+	}
+}
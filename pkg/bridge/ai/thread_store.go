@@ -0,0 +1,258 @@
+package ai
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+var (
+	// ErrThreadNotFound is the error when the thread does not exist
+	ErrThreadNotFound = errors.New("thread does not exist")
+	// ErrRunNotFound is the error when the run does not exist
+	ErrRunNotFound = errors.New("run does not exist")
+)
+
+// Thread is the thread of the Assistants API, it's the conversation the runs answer.
+type Thread struct {
+	// ID is the id of the thread, eg: thread_xxx
+	ID string `json:"id"`
+	// Object is always "thread"
+	Object string `json:"object"`
+	// CreatedAt is the unix time the thread was created
+	CreatedAt int64 `json:"created_at"`
+	// Metadata is the metadata attached by the client
+	Metadata map[string]string `json:"metadata"`
+	// Owner is the hash of the credential which created the thread, the thread is visible to that credential
+	// only, it's not responded but it must be kept by the stores.
+	Owner string `json:"-"`
+}
+
+// ThreadMessage is the message of a thread.
+type ThreadMessage struct {
+	// ID is the id of the message, eg: msg_xxx
+	ID string `json:"id"`
+	// Object is always "thread.message"
+	Object string `json:"object"`
+	// CreatedAt is the unix time the message was created
+	CreatedAt int64 `json:"created_at"`
+	// ThreadID is the id of the thread
+	ThreadID string `json:"thread_id"`
+	// Role is user or assistant
+	Role string `json:"role"`
+	// Content is the text and image content of the message
+	Content []ThreadMessageContent `json:"content"`
+	// AssistantID is the assistant of the run which created the message
+	AssistantID string `json:"assistant_id,omitempty"`
+	// RunID is the run which created the message, it's empty for the messages of the client
+	RunID string `json:"run_id,omitempty"`
+	// Metadata is the metadata attached by the client
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ThreadMessageContent is a content part of a message, it's a text or an image url.
+type ThreadMessageContent struct {
+	// Type is "text" or "image_url"
+	Type string `json:"type"`
+	// Text is the text of the content if the type is "text"
+	Text *ThreadMessageText `json:"text,omitempty"`
+	// ImageURL is the image of the content if the type is "image_url"
+	ImageURL *ThreadMessageImageURL `json:"image_url,omitempty"`
+}
+
+// ThreadMessageText is the text of a message content.
+type ThreadMessageText struct {
+	// Value is the text
+	Value string `json:"value"`
+	// Annotations is always empty
+	Annotations []any `json:"annotations"`
+}
+
+// ThreadMessageImageURL is the image of a message content.
+type ThreadMessageImageURL struct {
+	// URL is the http(s) url or the base64 data url of the image
+	URL string `json:"url"`
+	// Detail is the detail level of the image: auto, low or high
+	Detail string `json:"detail,omitempty"`
+}
+
+// ThreadRun is the run of a thread, it answers the messages of the thread with the llm provider, and the sfns
+// are called as the tools.
+type ThreadRun struct {
+	// ID is the id of the run, eg: run_xxx
+	ID string `json:"id"`
+	// Object is always "thread.run"
+	Object string `json:"object"`
+	// CreatedAt is the unix time the run was created
+	CreatedAt int64 `json:"created_at"`
+	// ThreadID is the id of the thread
+	ThreadID string `json:"thread_id"`
+	// AssistantID is the assistant requested by the client, it's informational
+	AssistantID string `json:"assistant_id"`
+	// Status is queued, in_progress, completed or failed
+	Status string `json:"status"`
+	// Model is the model requested by the client
+	Model string `json:"model"`
+	// Instructions are the system message of the run
+	Instructions string `json:"instructions"`
+	// StartedAt is the unix time the run was started
+	StartedAt *int64 `json:"started_at"`
+	// CompletedAt is the unix time the run was completed
+	CompletedAt *int64 `json:"completed_at"`
+	// FailedAt is the unix time the run failed
+	FailedAt *int64 `json:"failed_at"`
+	// LastError is the error of the failed run
+	LastError *ThreadRunError `json:"last_error"`
+	// Usage is the token usage of the completed run
+	Usage *ThreadRunUsage `json:"usage"`
+	// Metadata is the metadata attached by the client
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ThreadRunError is the error of a failed run.
+type ThreadRunError struct {
+	// Code is server_error, rate_limit_exceeded or insufficient_quota
+	Code string `json:"code"`
+	// Message is the message of the error
+	Message string `json:"message"`
+}
+
+// ThreadRunUsage is the token usage of a run.
+type ThreadRunUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ThreadStore stores the threads, their messages and runs of the Assistants API, the default store keeps them
+// in memory, it can be replaced by SetThreadStore, eg: to share the threads among the zippers.
+type ThreadStore interface {
+	// CreateThread stores the thread.
+	CreateThread(thread Thread) error
+	// GetThread returns the thread, the error is ErrThreadNotFound if it does not exist.
+	GetThread(threadID string) (Thread, error)
+	// DeleteThread deletes the thread with its messages and runs.
+	DeleteThread(threadID string) error
+	// AddMessage appends the message to its thread.
+	AddMessage(msg ThreadMessage) error
+	// ListMessages returns the messages of the thread in the order they were added.
+	ListMessages(threadID string) ([]ThreadMessage, error)
+	// SaveRun creates or updates the run.
+	SaveRun(run ThreadRun) error
+	// GetRun returns the run of the thread, the error is ErrRunNotFound if it does not exist.
+	GetRun(threadID, runID string) (ThreadRun, error)
+}
+
+var (
+	// muThreadStore protects defaultThreadStore
+	muThreadStore      sync.Mutex
+	defaultThreadStore ThreadStore = NewMemoryThreadStore()
+)
+
+// SetThreadStore sets the default thread store
+func SetThreadStore(store ThreadStore) {
+	muThreadStore.Lock()
+	defer muThreadStore.Unlock()
+	defaultThreadStore = store
+}
+
+// GetThreadStore gets the default thread store
+func GetThreadStore() ThreadStore {
+	muThreadStore.Lock()
+	defer muThreadStore.Unlock()
+	return defaultThreadStore
+}
+
+// memoryThreadStore keeps the threads in memory, they are lost when the zipper restarts.
+type memoryThreadStore struct {
+	mu       sync.Mutex
+	threads  map[string]Thread
+	messages map[string][]ThreadMessage
+	runs     map[string]map[string]ThreadRun
+}
+
+// NewMemoryThreadStore returns the ThreadStore which keeps the threads in memory.
+func NewMemoryThreadStore() ThreadStore {
+	return &memoryThreadStore{
+		threads:  make(map[string]Thread),
+		messages: make(map[string][]ThreadMessage),
+		runs:     make(map[string]map[string]ThreadRun),
+	}
+}
+
+func (s *memoryThreadStore) CreateThread(thread Thread) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.threads[thread.ID] = thread
+	s.runs[thread.ID] = make(map[string]ThreadRun)
+	return nil
+}
+
+func (s *memoryThreadStore) GetThread(threadID string) (Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	thread, ok := s.threads[threadID]
+	if !ok {
+		return Thread{}, ErrThreadNotFound
+	}
+	return thread, nil
+}
+
+func (s *memoryThreadStore) DeleteThread(threadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.threads[threadID]; !ok {
+		return ErrThreadNotFound
+	}
+	delete(s.threads, threadID)
+	delete(s.messages, threadID)
+	delete(s.runs, threadID)
+	return nil
+}
+
+func (s *memoryThreadStore) AddMessage(msg ThreadMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.threads[msg.ThreadID]; !ok {
+		return ErrThreadNotFound
+	}
+	s.messages[msg.ThreadID] = append(s.messages[msg.ThreadID], msg)
+	return nil
+}
+
+func (s *memoryThreadStore) ListMessages(threadID string) ([]ThreadMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.threads[threadID]; !ok {
+		return nil, ErrThreadNotFound
+	}
+	return slices.Clone(s.messages[threadID]), nil
+}
+
+func (s *memoryThreadStore) SaveRun(run ThreadRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs, ok := s.runs[run.ThreadID]
+	if !ok {
+		return ErrThreadNotFound
+	}
+	runs[run.ID] = run
+	return nil
+}
+
+func (s *memoryThreadStore) GetRun(threadID, runID string) (ThreadRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[threadID][runID]
+	if !ok {
+		return ThreadRun{}, ErrRunNotFound
+	}
+	return run, nil
+}
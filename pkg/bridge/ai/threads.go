@@ -0,0 +1,515 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/id"
+)
+
+// threadMessageRequest is the message created by the client, the content can be a string or an array of
+// the text and image_url parts.
+type threadMessageRequest struct {
+	Role     string            `json:"role"`
+	Content  json.RawMessage   `json:"content"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// threadRequest is the request to create a thread.
+type threadRequest struct {
+	Messages []threadMessageRequest `json:"messages,omitempty"`
+	Metadata map[string]string      `json:"metadata,omitempty"`
+}
+
+// threadRunRequest is the request to create a run, the thread is created with the run by POST /v1/threads/runs.
+type threadRunRequest struct {
+	AssistantID            string                 `json:"assistant_id"`
+	Model                  string                 `json:"model,omitempty"`
+	Instructions           string                 `json:"instructions,omitempty"`
+	AdditionalInstructions string                 `json:"additional_instructions,omitempty"`
+	AdditionalMessages     []threadMessageRequest `json:"additional_messages,omitempty"`
+	Temperature            float32                `json:"temperature,omitempty"`
+	TopP                   float32                `json:"top_p,omitempty"`
+	Stream                 bool                   `json:"stream,omitempty"`
+	Metadata               map[string]string      `json:"metadata,omitempty"`
+	Thread                 *threadRequest         `json:"thread,omitempty"`
+}
+
+var (
+	errInvalidThreadContent = errors.New("content must be a string or an array of text and image_url parts")
+	errInvalidThreadRole    = errors.New("role must be user or assistant")
+	errThreadRunStream      = errors.New("stream is not supported, poll the run instead")
+)
+
+// threadMessageList is the list of the messages of a thread.
+type threadMessageList struct {
+	Object  string          `json:"object"`
+	Data    []ThreadMessage `json:"data"`
+	FirstID string          `json:"first_id,omitempty"`
+	LastID  string          `json:"last_id,omitempty"`
+	HasMore bool            `json:"has_more"`
+}
+
+// HandleThreads is the handler of the Assistants API threads and runs, the runs are answered by the chat
+// completions, so the sfns are called as the tools of the assistants. The assistants are not stored, the model
+// and the instructions are of the run. The routes are:
+//
+//	POST   /v1/threads
+//	POST   /v1/threads/runs
+//	GET    /v1/threads/{thread_id}
+//	DELETE /v1/threads/{thread_id}
+//	POST   /v1/threads/{thread_id}/messages
+//	GET    /v1/threads/{thread_id}/messages
+//	POST   /v1/threads/{thread_id}/runs
+//	GET    /v1/threads/{thread_id}/runs/{run_id}
+func HandleThreads(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	limitRequestBody(w, r)
+
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/threads"), "/")
+	var segments []string
+	if path != "" {
+		segments = strings.Split(path, "/")
+	}
+
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodPost:
+		createThread(w, r)
+	case len(segments) == 1 && segments[0] == "runs" && r.Method == http.MethodPost:
+		createThreadAndRun(w, r)
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		getThread(w, r, segments[0])
+	case len(segments) == 1 && r.Method == http.MethodDelete:
+		deleteThread(w, r, segments[0])
+	case len(segments) == 2 && segments[1] == "messages" && r.Method == http.MethodPost:
+		createThreadMessage(w, r, segments[0])
+	case len(segments) == 2 && segments[1] == "messages" && r.Method == http.MethodGet:
+		listThreadMessages(w, r, segments[0])
+	case len(segments) == 2 && segments[1] == "runs" && r.Method == http.MethodPost:
+		createThreadRun(w, r, segments[0])
+	case len(segments) == 3 && segments[1] == "runs" && r.Method == http.MethodGet:
+		getThreadRun(w, r, segments[0], segments[2])
+	case len(segments) <= 3:
+		RespondWithError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+	default:
+		RespondWithError(w, http.StatusNotFound, fmt.Errorf("%s is not found", r.URL.Path))
+	}
+}
+
+func createThread(w http.ResponseWriter, r *http.Request) {
+	var req threadRequest
+	if !decodeThreadRequest(w, r, &req) {
+		return
+	}
+	thread, err := newThread(FromServiceContext(r.Context()), req)
+	if err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	respondJSON(w, thread)
+}
+
+func createThreadAndRun(w http.ResponseWriter, r *http.Request) {
+	var req threadRunRequest
+	if !decodeThreadRequest(w, r, &req) {
+		return
+	}
+	if req.Stream {
+		RespondWithError(w, http.StatusBadRequest, errThreadRunStream)
+		return
+	}
+	if req.Thread == nil {
+		req.Thread = &threadRequest{}
+	}
+	thread, err := newThread(FromServiceContext(r.Context()), *req.Thread)
+	if err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	startThreadRun(w, r, thread, req)
+}
+
+func getThread(w http.ResponseWriter, r *http.Request, threadID string) {
+	thread, err := ownThread(r.Context(), threadID)
+	if err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	respondJSON(w, thread)
+}
+
+func deleteThread(w http.ResponseWriter, r *http.Request, threadID string) {
+	if _, err := ownThread(r.Context(), threadID); err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	if err := GetThreadStore().DeleteThread(threadID); err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	respondJSON(w, map[string]any{"id": threadID, "object": "thread.deleted", "deleted": true})
+}
+
+func createThreadMessage(w http.ResponseWriter, r *http.Request, threadID string) {
+	if _, err := ownThread(r.Context(), threadID); err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	var req threadMessageRequest
+	if !decodeThreadRequest(w, r, &req) {
+		return
+	}
+	msg, err := newThreadMessage(threadID, req)
+	if err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	if err := GetThreadStore().AddMessage(msg); err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	respondJSON(w, msg)
+}
+
+// listThreadMessages lists the messages of the thread, the query `order` is desc by default or asc, and the
+// query `limit` is 20 by default, 100 at most.
+func listThreadMessages(w http.ResponseWriter, r *http.Request, threadID string) {
+	if _, err := ownThread(r.Context(), threadID); err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	messages, err := GetThreadStore().ListMessages(threadID)
+	if err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	if r.URL.Query().Get("order") != "asc" {
+		slices.Reverse(messages)
+	}
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	limit = min(limit, 100)
+
+	list := threadMessageList{Object: "list", Data: messages}
+	if len(messages) > limit {
+		list.Data, list.HasMore = messages[:limit], true
+	}
+	if len(list.Data) > 0 {
+		list.FirstID, list.LastID = list.Data[0].ID, list.Data[len(list.Data)-1].ID
+	} else {
+		list.Data = []ThreadMessage{}
+	}
+	respondJSON(w, list)
+}
+
+func createThreadRun(w http.ResponseWriter, r *http.Request, threadID string) {
+	thread, err := ownThread(r.Context(), threadID)
+	if err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	var req threadRunRequest
+	if !decodeThreadRequest(w, r, &req) {
+		return
+	}
+	if req.Stream {
+		RespondWithError(w, http.StatusBadRequest, errThreadRunStream)
+		return
+	}
+	startThreadRun(w, r, thread, req)
+}
+
+func getThreadRun(w http.ResponseWriter, r *http.Request, threadID, runID string) {
+	if _, err := ownThread(r.Context(), threadID); err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	run, err := GetThreadStore().GetRun(threadID, runID)
+	if err != nil {
+		respondThreadError(w, err)
+		return
+	}
+	respondJSON(w, run)
+}
+
+// startThreadRun queues the run and answers the thread in the background, the client polls the run until
+// it's completed or failed.
+func startThreadRun(w http.ResponseWriter, r *http.Request, thread Thread, req threadRunRequest) {
+	store := GetThreadStore()
+	for _, m := range req.AdditionalMessages {
+		msg, err := newThreadMessage(thread.ID, m)
+		if err != nil {
+			respondThreadError(w, err)
+			return
+		}
+		if err := store.AddMessage(msg); err != nil {
+			respondThreadError(w, err)
+			return
+		}
+	}
+	instructions := req.Instructions
+	if req.AdditionalInstructions != "" {
+		instructions = strings.TrimSpace(instructions + "\n" + req.AdditionalInstructions)
+	}
+	run := ThreadRun{
+		ID:           "run_" + id.New(24),
+		Object:       "thread.run",
+		CreatedAt:    time.Now().Unix(),
+		ThreadID:     thread.ID,
+		AssistantID:  req.AssistantID,
+		Status:       "queued",
+		Model:        req.Model,
+		Instructions: instructions,
+		Metadata:     nonNilMetadata(req.Metadata),
+	}
+	if err := store.SaveRun(run); err != nil {
+		respondThreadError(w, err)
+		return
+	}
+
+	var (
+		ctx     = r.Context()
+		service = FromServiceContext(ctx)
+		transID = FromTransIDContext(ctx)
+	)
+	chatReq := openai.ChatCompletionRequest{Model: req.Model, Temperature: req.Temperature, TopP: req.TopP}
+	// the run outlives the request.
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 90*time.Second)
+	go func() {
+		defer cancel()
+		executeThreadRun(runCtx, service, store, run, chatReq, transID)
+	}()
+
+	respondJSON(w, run)
+}
+
+// executeThreadRun answers the messages of the thread, the answer is appended to the thread as the message
+// of the assistant.
+func executeThreadRun(ctx context.Context, service *Service, store ThreadStore, run ThreadRun, req openai.ChatCompletionRequest, transID string) {
+	startedAt := time.Now().Unix()
+	run.Status, run.StartedAt = "in_progress", &startedAt
+	if err := store.SaveRun(run); err != nil {
+		ylog.Error("save thread run", "run_id", run.ID, "err", err.Error())
+		return
+	}
+
+	resp, err := completeThreadRun(ctx, service, store, run, req, transID)
+	if err == nil {
+		text := ""
+		if len(resp.Choices) > 0 {
+			text = resp.Choices[0].Message.Content
+		}
+		msg := ThreadMessage{
+			ID:          "msg_" + id.New(24),
+			Object:      "thread.message",
+			CreatedAt:   time.Now().Unix(),
+			ThreadID:    run.ThreadID,
+			Role:        openai.ChatMessageRoleAssistant,
+			Content:     threadMessageContent(text),
+			AssistantID: run.AssistantID,
+			RunID:       run.ID,
+			Metadata:    map[string]string{},
+		}
+		err = store.AddMessage(msg)
+	}
+
+	now := time.Now().Unix()
+	if err != nil {
+		ylog.Error("thread run failed", "run_id", run.ID, "err", err.Error())
+		code := "server_error"
+		if errors.Is(err, ErrRateLimited) {
+			code = "rate_limit_exceeded"
+		} else if errors.Is(err, ErrQuotaExceeded) {
+			code = "insufficient_quota"
+		}
+		run.Status, run.FailedAt = "failed", &now
+		run.LastError = &ThreadRunError{Code: code, Message: err.Error()}
+	} else {
+		run.Status, run.CompletedAt = "completed", &now
+		run.Usage = &ThreadRunUsage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+		}
+	}
+	if err := store.SaveRun(run); err != nil {
+		ylog.Error("save thread run", "run_id", run.ID, "err", err.Error())
+	}
+}
+
+func completeThreadRun(ctx context.Context, service *Service, store ThreadStore, run ThreadRun, req openai.ChatCompletionRequest, transID string) (openai.ChatCompletionResponse, error) {
+	messages, err := store.ListMessages(run.ThreadID)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if run.Instructions != "" {
+		req.Messages = append(req.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: run.Instructions})
+	}
+	for _, msg := range messages {
+		req.Messages = append(req.Messages, contentMessage(msg.Role, threadChatParts(msg.Content)))
+	}
+
+	rec := &responsesRecorder{header: make(http.Header)}
+	if err := service.GetChatCompletions(ctx, req, transID, rec, false); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	var resp openai.ChatCompletionResponse
+	err = json.Unmarshal(rec.body.Bytes(), &resp)
+	return resp, err
+}
+
+func newThread(service *Service, req threadRequest) (Thread, error) {
+	thread := Thread{
+		ID:        "thread_" + id.New(24),
+		Object:    "thread",
+		CreatedAt: time.Now().Unix(),
+		Metadata:  nonNilMetadata(req.Metadata),
+		Owner:     credentialHash(service.credential),
+	}
+	messages := make([]ThreadMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		msg, err := newThreadMessage(thread.ID, m)
+		if err != nil {
+			return Thread{}, err
+		}
+		messages = append(messages, msg)
+	}
+
+	store := GetThreadStore()
+	if err := store.CreateThread(thread); err != nil {
+		return Thread{}, err
+	}
+	for _, msg := range messages {
+		if err := store.AddMessage(msg); err != nil {
+			return Thread{}, err
+		}
+	}
+	return thread, nil
+}
+
+func newThreadMessage(threadID string, req threadMessageRequest) (ThreadMessage, error) {
+	if req.Role != openai.ChatMessageRoleUser && req.Role != openai.ChatMessageRoleAssistant {
+		return ThreadMessage{}, errInvalidThreadRole
+	}
+	parts, err := parseContentParts(req.Content)
+	if errors.Is(err, errInvalidContent) {
+		return ThreadMessage{}, errInvalidThreadContent
+	}
+	if err != nil {
+		return ThreadMessage{}, fmt.Errorf("%w: %s", errInvalidThreadContent, err.Error())
+	}
+	return ThreadMessage{
+		ID:        "msg_" + id.New(24),
+		Object:    "thread.message",
+		CreatedAt: time.Now().Unix(),
+		ThreadID:  threadID,
+		Role:      req.Role,
+		Content:   threadMessageParts(parts),
+		Metadata:  nonNilMetadata(req.Metadata),
+	}, nil
+}
+
+func threadMessageContent(text string) []ThreadMessageContent {
+	return []ThreadMessageContent{{Type: "text", Text: &ThreadMessageText{Value: text, Annotations: []any{}}}}
+}
+
+// threadMessageParts returns the content of the message from the parts of the chat message.
+func threadMessageParts(parts []openai.ChatMessagePart) []ThreadMessageContent {
+	content := make([]ThreadMessageContent, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == openai.ChatMessagePartTypeImageURL {
+			content = append(content, ThreadMessageContent{
+				Type:     "image_url",
+				ImageURL: &ThreadMessageImageURL{URL: part.ImageURL.URL, Detail: string(part.ImageURL.Detail)},
+			})
+			continue
+		}
+		content = append(content, threadMessageContent(part.Text)...)
+	}
+	return content
+}
+
+// threadChatParts returns the parts of the chat message from the content of the message.
+func threadChatParts(content []ThreadMessageContent) []openai.ChatMessagePart {
+	parts := make([]openai.ChatMessagePart, 0, len(content))
+	for _, c := range content {
+		switch {
+		case c.ImageURL != nil:
+			parts = append(parts, openai.ChatMessagePart{
+				Type:     openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: c.ImageURL.URL, Detail: openai.ImageURLDetail(c.ImageURL.Detail)},
+			})
+		case c.Text != nil:
+			parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: c.Text.Value})
+		}
+	}
+	return parts
+}
+
+// ownThread returns the thread if it's created by the credential of the request, the threads of the other
+// credentials are not found.
+func ownThread(ctx context.Context, threadID string) (Thread, error) {
+	thread, err := GetThreadStore().GetThread(threadID)
+	if err != nil {
+		return Thread{}, err
+	}
+	if thread.Owner != credentialHash(FromServiceContext(ctx).credential) {
+		return Thread{}, ErrThreadNotFound
+	}
+	return thread, nil
+}
+
+func nonNilMetadata(md map[string]string) map[string]string {
+	if md == nil {
+		return map[string]string{}
+	}
+	return md
+}
+
+func decodeThreadRequest(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ylog.Error("read request", "err", err.Error())
+		RespondWithError(w, readBodyErrorCode(err), err)
+		return false
+	}
+	if len(body) == 0 {
+		return true
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		ylog.Error("decode request", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+func respondJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(v)
+}
+
+func respondThreadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrThreadNotFound), errors.Is(err, ErrRunNotFound):
+		RespondWithError(w, http.StatusNotFound, err)
+	case errors.Is(err, errInvalidThreadContent), errors.Is(err, errInvalidThreadRole):
+		RespondWithError(w, http.StatusBadRequest, err)
+	default:
+		ylog.Error("thread store", "err", err.Error())
+		RespondWithError(w, http.StatusInternalServerError, err)
+	}
+}
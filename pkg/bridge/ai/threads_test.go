@@ -0,0 +1,91 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func TestHandleThreads(t *testing.T) {
+	SetThreadStore(NewMemoryThreadStore())
+	t.Cleanup(func() { SetThreadStore(NewMemoryThreadStore()) })
+
+	provider := &completionsProvider{}
+	service := &Service{LLMProvider: provider, Metadata: metadata.M{}, credential: "token"}
+	service.SetSystemPrompt("")
+	other := &Service{LLMProvider: provider, Metadata: metadata.M{}, credential: "other"}
+
+	do := func(service *Service, method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r = r.WithContext(WithServiceContext(r.Context(), service))
+		HandleThreads(w, r)
+		return w
+	}
+
+	w := do(service, http.MethodPost, "/v1/threads", `{"messages":[{"role":"user","content":"hello"}],"metadata":{"k":"v"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var thread Thread
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &thread))
+	assert.True(t, strings.HasPrefix(thread.ID, "thread_"))
+	assert.Equal(t, map[string]string{"k": "v"}, thread.Metadata)
+	assert.NotContains(t, w.Body.String(), "owner")
+
+	t.Run("other credential", func(t *testing.T) {
+		w := do(other, http.MethodGet, "/v1/threads/"+thread.ID, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("invalid role", func(t *testing.T) {
+		w := do(service, http.MethodPost, "/v1/threads/"+thread.ID+"/messages", `{"role":"system","content":"hi"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":{"code":"400","message":"role must be user or assistant"}}`, w.Body.String())
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		w := do(service, http.MethodPut, "/v1/threads/"+thread.ID, "")
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		w := do(service, http.MethodPost, "/v1/threads/"+thread.ID+"/runs", `{"assistant_id":"asst_1","model":"gpt-4o","instructions":"be brief"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var run ThreadRun
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		assert.Equal(t, "queued", run.Status)
+
+		assert.Eventually(t, func() bool {
+			w := do(service, http.MethodGet, "/v1/threads/"+thread.ID+"/runs/"+run.ID, "")
+			_ = json.Unmarshal(w.Body.Bytes(), &run)
+			return run.Status == "completed"
+		}, time.Second, 10*time.Millisecond)
+		assert.Equal(t, &ThreadRunUsage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}, run.Usage)
+		assert.Equal(t, "be brief", provider.req.Messages[0].Content)
+		assert.Equal(t, "hello", provider.req.Messages[1].Content)
+
+		w = do(service, http.MethodGet, "/v1/threads/"+thread.ID+"/messages?order=asc", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var list threadMessageList
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		assert.Len(t, list.Data, 2)
+		assert.Equal(t, "assistant", list.Data[1].Role)
+		assert.Equal(t, " world", list.Data[1].Content[0].Text.Value)
+		assert.Equal(t, run.ID, list.Data[1].RunID)
+		assert.Equal(t, "asst_1", list.Data[1].AssistantID)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		w := do(service, http.MethodDelete, "/v1/threads/"+thread.ID, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"id":"`+thread.ID+`","object":"thread.deleted","deleted":true}`, w.Body.String())
+
+		w = do(service, http.MethodGet, "/v1/threads/"+thread.ID, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
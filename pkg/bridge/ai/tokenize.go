@@ -0,0 +1,167 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+// Tokenizer counts the tokens of the texts for a model, eg: the tiktoken encoders of the OpenAI models.
+type Tokenizer interface {
+	// CountTokens returns the number of the tokens of the text.
+	CountTokens(text string) int
+}
+
+// TokenizerFunc is the function adapter of Tokenizer.
+type TokenizerFunc func(text string) int
+
+// CountTokens implements Tokenizer.
+func (f TokenizerFunc) CountTokens(text string) int { return f(text) }
+
+var (
+	// muTokenizers protects tokenizers
+	muTokenizers sync.RWMutex
+	tokenizers   = map[string]Tokenizer{}
+)
+
+// RegisterTokenizer registers the tokenizer of the models by the prefix of their names, eg: "gpt-4o" for
+// gpt-4o and gpt-4o-mini, the tokenizer of the longest prefix is used. The tokens of the models without
+// a tokenizer are estimated.
+func RegisterTokenizer(modelPrefix string, tokenizer Tokenizer) {
+	muTokenizers.Lock()
+	defer muTokenizers.Unlock()
+	tokenizers[modelPrefix] = tokenizer
+}
+
+// getTokenizer returns the tokenizer of the model, estimated is true if no tokenizer is registered for it.
+func getTokenizer(model string) (tokenizer Tokenizer, estimated bool) {
+	muTokenizers.RLock()
+	defer muTokenizers.RUnlock()
+
+	prefix := ""
+	for p, t := range tokenizers {
+		if strings.HasPrefix(model, p) && len(p) >= len(prefix) {
+			prefix, tokenizer = p, t
+		}
+	}
+	if tokenizer == nil {
+		return TokenizerFunc(estimateTextTokens), true
+	}
+	return tokenizer, false
+}
+
+// estimateTextTokens estimates the tokens of the text, a token is about 4 characters of English, and about
+// a character of the CJK languages.
+func estimateTextTokens(text string) int {
+	ascii, others := 0, 0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			others++
+		}
+	}
+	return (ascii+3)/4 + others
+}
+
+const (
+	// tokensPerMessage is the tokens of the framing of every message of the chat models.
+	tokensPerMessage = 3
+	// tokensPerReply is the tokens priming the reply of the assistant.
+	tokensPerReply = 3
+)
+
+// TokenCount is the number of the tokens of a chat completion request.
+type TokenCount struct {
+	// Model is the model of the request
+	Model string `json:"model"`
+	// MessageTokens is the tokens of the messages, including the system prompt of the service
+	MessageTokens int `json:"message_tokens"`
+	// ToolTokens is the tokens of the tools, including the sfns added to the request
+	ToolTokens int `json:"tool_tokens"`
+	// TotalTokens is the tokens of the prompt, it's the sum of the above and the reply priming
+	TotalTokens int `json:"total_tokens"`
+	// Estimated is true if no tokenizer is registered for the model, then the tokens are estimated
+	Estimated bool `json:"estimated"`
+}
+
+// CountTokens counts the tokens of the prompt of the chat completion request as it is sent to the llm
+// provider, the sfns are added to the tools and the system prompt of the service is applied.
+func (s *Service) CountTokens(ctx context.Context, req openai.ChatCompletionRequest) (TokenCount, error) {
+	tagTools, err := register.ListToolCalls(s.requestMetadata(ctx))
+	if err != nil {
+		return TokenCount{}, err
+	}
+	req, err = addToolsToRequest(req, tagTools)
+	if err != nil {
+		return TokenCount{}, err
+	}
+	req, err = s.OpSystemPrompt(ctx, req)
+	if err != nil {
+		return TokenCount{}, err
+	}
+
+	tokenizer, estimated := getTokenizer(req.Model)
+	count := TokenCount{Model: req.Model, Estimated: estimated}
+	for _, msg := range req.Messages {
+		count.MessageTokens += tokensPerMessage + tokenizer.CountTokens(msg.Role) + tokenizer.CountTokens(msg.Content)
+		for _, part := range msg.MultiContent {
+			count.MessageTokens += tokenizer.CountTokens(part.Text)
+		}
+		if msg.Name != "" {
+			count.MessageTokens += 1 + tokenizer.CountTokens(msg.Name)
+		}
+		for _, tc := range msg.ToolCalls {
+			count.MessageTokens += tokenizer.CountTokens(tc.Function.Name) + tokenizer.CountTokens(tc.Function.Arguments)
+		}
+	}
+	for _, tool := range req.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		// the tools are counted by their definitions in JSON, it's close to how they are rendered in the prompt.
+		def, _ := json.Marshal(tool.Function)
+		count.ToolTokens += tokenizer.CountTokens(string(def))
+	}
+	count.TotalTokens = count.MessageTokens + count.ToolTokens + tokensPerReply
+	return count, nil
+}
+
+// HandleTokenize is the handler for POST /v1/tokenize, the body is a chat completion request, it returns the
+// tokens of the prompt including the sfns added as the tools, so the clients can budget their prompts.
+func HandleTokenize(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		service = FromServiceContext(ctx)
+	)
+	defer r.Body.Close()
+	limitRequestBody(w, r)
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		ylog.Error("read request", "err", err.Error())
+		RespondWithError(w, readBodyErrorCode(err), err)
+		return
+	}
+	var req openai.ChatCompletionRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		ylog.Error("decode request", "err", err.Error())
+		RespondWithError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	count, err := service.CountTokens(ctx, req)
+	if err != nil {
+		RespondWithError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, count)
+}
@@ -0,0 +1,92 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+func TestEstimateTextTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{text: "", want: 0},
+		{text: "hi", want: 1},
+		{text: "hello world!", want: 3},
+		{text: "你好", want: 2},
+		{text: "hi 你好", want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			assert.Equal(t, tt.want, estimateTextTokens(tt.text))
+		})
+	}
+}
+
+func TestGetTokenizer(t *testing.T) {
+	t.Cleanup(func() { tokenizers = map[string]Tokenizer{} })
+
+	RegisterTokenizer("gpt-4", TokenizerFunc(func(string) int { return 4 }))
+	RegisterTokenizer("gpt-4o", TokenizerFunc(func(string) int { return 40 }))
+
+	tokenizer, estimated := getTokenizer("gpt-4o-mini")
+	assert.False(t, estimated)
+	assert.Equal(t, 40, tokenizer.CountTokens("hello"))
+
+	tokenizer, estimated = getTokenizer("gpt-4-turbo")
+	assert.False(t, estimated)
+	assert.Equal(t, 4, tokenizer.CountTokens("hello"))
+
+	tokenizer, estimated = getTokenizer("llama3")
+	assert.True(t, estimated)
+	assert.Equal(t, 2, tokenizer.CountTokens("hello"))
+}
+
+func TestHandleTokenize(t *testing.T) {
+	service := &Service{LLMProvider: &MockLLMProvider{name: "openai"}, Metadata: metadata.M{}, credential: "token"}
+	service.SetSystemPrompt("")
+
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "hello world!"}},
+	}
+	before, err := service.CountTokens(context.Background(), req)
+	assert.NoError(t, err)
+	// 3 for the framing, 1 for the role and 3 for the content.
+	assert.Equal(t, 7, before.MessageTokens)
+	assert.True(t, before.Estimated)
+
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0x81, &openai.FunctionDefinition{Name: "get-weather", Description: "Get the weather of a city"}, 2081, md))
+	defer register.UnregisterFunction(2081, md)
+
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/tokenize", strings.NewReader(string(body)))
+	HandleTokenize(w, r.WithContext(WithServiceContext(r.Context(), service)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var count TokenCount
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &count))
+	assert.Equal(t, "gpt-4o", count.Model)
+	assert.Equal(t, before.MessageTokens, count.MessageTokens)
+	// the sfn is added to the tools.
+	assert.Greater(t, count.ToolTokens, before.ToolTokens)
+	assert.Equal(t, count.MessageTokens+count.ToolTokens+tokensPerReply, count.TotalTokens)
+
+	t.Run("bad request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/tokenize", strings.NewReader("{"))
+		HandleTokenize(w, r.WithContext(WithServiceContext(r.Context(), service)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
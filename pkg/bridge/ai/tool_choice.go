@@ -0,0 +1,86 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrToolChoice is returned when the `tool_choice` of the chat completion request can not be honored, eg: the
+// chosen function is not a tool of the request.
+var ErrToolChoice = errors.New("invalid tool_choice")
+
+// The `tool_choice` of the chat completion request is one of:
+//
+//	"none", "auto"                                         the model chooses whether to call the tools
+//	"required"                                             the model must call one or more tools
+//	{"type": "function", "function": {"name": "my_func"}}  the model must call the function
+//
+// The tools of the request are filtered to the chosen function, so the model can only call it. The tool choice
+// is honored by the first call of the llm provider, the model chooses the tools of the later rounds by itself.
+
+// applyToolChoice validates the tool choice of the request against its tools, the tools are filtered to the
+// chosen function if a function is chosen.
+func applyToolChoice(req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error) {
+	choice, name, err := parseToolChoice(req.ToolChoice)
+	if err != nil {
+		return req, err
+	}
+	switch {
+	case choice == "required":
+		if len(req.Tools) == 0 {
+			return req, fmt.Errorf("%w: a tool call is required, but there is no tool", ErrToolChoice)
+		}
+	case name != "":
+		var tools []openai.Tool
+		for _, tool := range req.Tools {
+			if tool.Type == openai.ToolTypeFunction && tool.Function != nil && tool.Function.Name == name {
+				tools = append(tools, tool)
+			}
+		}
+		if len(tools) == 0 {
+			return req, fmt.Errorf("%w: function %s is not a tool of the request", ErrToolChoice, name)
+		}
+		req.Tools = tools[:1]
+		req.ToolChoice = openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: name}}
+	}
+	return req, nil
+}
+
+// parseToolChoice returns the tool choice, it's one of "", "none", "auto" and "required", or the name of the
+// chosen function.
+func parseToolChoice(toolChoice any) (choice string, name string, err error) {
+	var tc openai.ToolChoice
+	switch v := toolChoice.(type) {
+	case nil:
+		return "", "", nil
+	case string:
+		switch v {
+		case "none", "auto", "required":
+			return v, "", nil
+		}
+		return "", "", fmt.Errorf(`%w: %q, it must be one of "none", "auto", "required" or a function`, ErrToolChoice, v)
+	case openai.ToolChoice:
+		tc = v
+	case *openai.ToolChoice:
+		if v == nil {
+			return "", "", nil
+		}
+		tc = *v
+	default:
+		// the tool choice decoded from the request body
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: %v", ErrToolChoice, err)
+		}
+		if err := json.Unmarshal(data, &tc); err != nil {
+			return "", "", fmt.Errorf("%w: it must be a string or a function", ErrToolChoice)
+		}
+	}
+	if tc.Type != openai.ToolTypeFunction || tc.Function.Name == "" {
+		return "", "", fmt.Errorf(`%w: the type must be "function" and the function name is required`, ErrToolChoice)
+	}
+	return "", tc.Function.Name, nil
+}
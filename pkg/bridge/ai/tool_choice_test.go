@@ -0,0 +1,129 @@
+package ai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+func TestApplyToolChoice(t *testing.T) {
+	tools := []openai.Tool{
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get-weather"}},
+		{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "get-time"}},
+	}
+	named := openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: "get-time"}}
+
+	tests := []struct {
+		name               string
+		toolChoice         string
+		tools              []openai.Tool
+		expectedTools      []openai.Tool
+		expectedToolChoice any
+		expectedErr        string
+	}{
+		{
+			name:          "no tool choice",
+			tools:         tools,
+			expectedTools: tools,
+		},
+		{
+			name:               "auto",
+			toolChoice:         `"auto"`,
+			tools:              tools,
+			expectedTools:      tools,
+			expectedToolChoice: "auto",
+		},
+		{
+			name:               "required",
+			toolChoice:         `"required"`,
+			tools:              tools,
+			expectedTools:      tools,
+			expectedToolChoice: "required",
+		},
+		{
+			name:        "required without tools",
+			toolChoice:  `"required"`,
+			expectedErr: "invalid tool_choice: a tool call is required, but there is no tool",
+		},
+		{
+			name:               "named",
+			toolChoice:         `{"type":"function","function":{"name":"get-time"}}`,
+			tools:              tools,
+			expectedTools:      tools[1:],
+			expectedToolChoice: named,
+		},
+		{
+			name:        "named function not found",
+			toolChoice:  `{"type":"function","function":{"name":"get-stock"}}`,
+			tools:       tools,
+			expectedErr: "invalid tool_choice: function get-stock is not a tool of the request",
+		},
+		{
+			name:        "named without name",
+			toolChoice:  `{"type":"function"}`,
+			tools:       tools,
+			expectedErr: `invalid tool_choice: the type must be "function" and the function name is required`,
+		},
+		{
+			name:        "unknown",
+			toolChoice:  `"always"`,
+			tools:       tools,
+			expectedErr: `invalid tool_choice: "always", it must be one of "none", "auto", "required" or a function`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := openai.ChatCompletionRequest{Tools: tt.tools}
+			if tt.toolChoice != "" {
+				assert.NoError(t, json.Unmarshal([]byte(tt.toolChoice), &req.ToolChoice))
+			}
+
+			req, err := applyToolChoice(req)
+			if tt.expectedErr != "" {
+				assert.ErrorIs(t, err, ErrToolChoice)
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTools, req.Tools)
+			assert.Equal(t, tt.expectedToolChoice, req.ToolChoice)
+		})
+	}
+}
+
+func TestChatCompletionsToolChoice(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0xB4, &openai.FunctionDefinition{Name: "get-weather"}, 2114, md))
+	defer register.UnregisterFunction(2114, md)
+
+	provider := &completionsProvider{}
+	service := &Service{LLMProvider: provider, Metadata: md, credential: "token"}
+	service.SetSystemPrompt("")
+
+	do := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		HandleChatCompletions(w, r.WithContext(WithServiceContext(r.Context(), service)))
+		return w
+	}
+
+	t.Run("the sfn tool is chosen", func(t *testing.T) {
+		w := do(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"tool_choice":{"type":"function","function":{"name":"get-weather"}}}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, provider.req.Tools, 1)
+		assert.Equal(t, openai.ToolChoice{Type: openai.ToolTypeFunction, Function: openai.ToolFunction{Name: "get-weather"}}, provider.req.ToolChoice)
+	})
+
+	t.Run("the chosen tool is not found", func(t *testing.T) {
+		w := do(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"tool_choice":{"type":"function","function":{"name":"get-stock"}}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":{"code":"400","message":"invalid tool_choice: function get-stock is not a tool of the request"}}`, w.Body.String())
+	})
+}
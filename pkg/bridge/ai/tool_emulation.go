@@ -0,0 +1,262 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/id"
+)
+
+// The `tool_emulation` of the provider config emulates the tool calls by the prompt for the models of the provider
+// without the native function calling, the tool schemas are injected into the prompt, and the JSON answer of the
+// model is parsed into the tool calls, so the ai functions work with any model. It's true for all the models of the
+// provider, or the patterns of the models separated by commas:
+//
+//	compat:
+//	  base_url: http://127.0.0.1:11434/v1
+//	  tool_emulation: llama2*,gemma* ## or true
+
+// toolEmulationPrompt instructs the model to answer in the constrained JSON, %s is the JSON of the tool schemas.
+const toolEmulationPrompt = `You can call the following tools, they are described in JSON schema:
+
+%s
+
+If a tool is needed to answer, respond with only a JSON object in the format:
+{"tool_calls": [{"name": "<tool name>", "arguments": {<the arguments of the tool>}}]}
+Otherwise, respond with only a JSON object in the format:
+{"answer": "<your answer>"}`
+
+// emulatedAnswer is the constrained JSON answer of the model.
+type emulatedAnswer struct {
+	ToolCalls []struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"tool_calls"`
+	Answer *string `json:"answer"`
+}
+
+// toolEmulationProvider emulates the tool calls for the models of the underlying llm provider matching the
+// patterns, the tool calls of all the models are emulated if there is no pattern.
+type toolEmulationProvider struct {
+	LLMProvider
+	patterns []string
+}
+
+// NewToolEmulationProvider returns the llm provider emulating the tool calls by the `tool_emulation` of the provider
+// config, the provider is returned as it is if the config doesn't emulate them.
+func NewToolEmulationProvider(conf Provider, provider LLMProvider) LLMProvider {
+	emulation := strings.TrimSpace(conf["tool_emulation"])
+	if provider == nil || emulation == "" || emulation == "false" {
+		return provider
+	}
+	p := &toolEmulationProvider{LLMProvider: provider}
+	if emulation != "true" {
+		for _, pattern := range strings.Split(emulation, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				ylog.Warn("invalid tool_emulation pattern of the provider, ignore it", "provider", provider.Name(), "pattern", pattern)
+				continue
+			}
+			p.patterns = append(p.patterns, pattern)
+		}
+		if len(p.patterns) == 0 {
+			return provider
+		}
+	}
+	ylog.Debug("emulate the tool calls of llm provider", "provider", provider.Name(), "models", p.patterns)
+	return p
+}
+
+// emulated reports whether the tool calls of the model are emulated, the requests without the model are emulated
+// only if all the models are.
+func (p *toolEmulationProvider) emulated(model string) bool {
+	if len(p.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if matched, _ := path.Match(pattern, model); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *toolEmulationProvider) GetChatCompletions(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (openai.ChatCompletionResponse, error) {
+	if !p.emulated(req.Model) {
+		return p.LLMProvider.GetChatCompletions(ctx, req, md)
+	}
+	tools := req.Tools
+	req, err := emulateToolsRequest(req)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	resp, err := p.LLMProvider.GetChatCompletions(ctx, req, md)
+	if err != nil || len(tools) == 0 || len(resp.Choices) == 0 {
+		return resp, err
+	}
+	resp.Choices[0].Message, resp.Choices[0].FinishReason = parseEmulatedAnswer(resp.Choices[0].Message.Content, tools)
+	return resp, nil
+}
+
+func (p *toolEmulationProvider) GetChatCompletionsStream(ctx context.Context, req openai.ChatCompletionRequest, md metadata.M) (ResponseRecver, error) {
+	if !p.emulated(req.Model) {
+		return p.LLMProvider.GetChatCompletionsStream(ctx, req, md)
+	}
+	if len(req.Tools) == 0 {
+		req, err := emulateToolsRequest(req)
+		if err != nil {
+			return nil, err
+		}
+		return p.LLMProvider.GetChatCompletionsStream(ctx, req, md)
+	}
+	// the answer must be parsed as a whole, so it's requested without stream and replayed as the chunks.
+	req.Stream = false
+	resp, err := p.GetChatCompletions(ctx, req, md)
+	if err != nil {
+		return nil, err
+	}
+	return newEmulatedStream(resp), nil
+}
+
+// emulateToolsRequest injects the tool schemas into the system prompt, and rewrites the tool calls and the tool
+// results of the previous rounds into the plain messages, the models without function calling reject them.
+func emulateToolsRequest(req openai.ChatCompletionRequest) (openai.ChatCompletionRequest, error) {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages)+1)
+	if len(req.Tools) > 0 {
+		schemas, err := json.Marshal(req.Tools)
+		if err != nil {
+			return req, err
+		}
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: fmt.Sprintf(toolEmulationPrompt, schemas),
+		})
+	}
+	for _, msg := range req.Messages {
+		switch {
+		case msg.Role == openai.ChatMessageRoleAssistant && len(msg.ToolCalls) > 0:
+			calls := make([]map[string]any, 0, len(msg.ToolCalls))
+			for _, tc := range msg.ToolCalls {
+				calls = append(calls, map[string]any{"name": tc.Function.Name, "arguments": json.RawMessage(argumentsOrEmpty(tc.Function.Arguments))})
+			}
+			content, _ := json.Marshal(map[string]any{"tool_calls": calls})
+			messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: string(content)})
+		case msg.Role == openai.ChatMessageRoleTool:
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf("The result of the tool call %s: %s", msg.ToolCallID, msg.Content),
+			})
+		default:
+			messages = append(messages, msg)
+		}
+	}
+	req.Messages = messages
+	req.Tools = nil
+	req.ToolChoice = nil
+	return req, nil
+}
+
+func argumentsOrEmpty(args string) string {
+	if !json.Valid([]byte(args)) {
+		return "{}"
+	}
+	return args
+}
+
+// parseEmulatedAnswer parses the answer of the model into the tool calls, the answer which is not the
+// constrained JSON or calls the unknown tools is returned as the content.
+func parseEmulatedAnswer(content string, tools []openai.Tool) (openai.ChatCompletionMessage, openai.FinishReason) {
+	message := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}
+
+	var answer emulatedAnswer
+	if err := json.Unmarshal([]byte(extractJSONObject(content)), &answer); err != nil {
+		return message, openai.FinishReasonStop
+	}
+	if len(answer.ToolCalls) == 0 {
+		if answer.Answer != nil {
+			message.Content = *answer.Answer
+		}
+		return message, openai.FinishReasonStop
+	}
+
+	known := make(map[string]bool, len(tools))
+	for _, tool := range tools {
+		if tool.Function != nil {
+			known[tool.Function.Name] = true
+		}
+	}
+	toolCalls := make([]openai.ToolCall, 0, len(answer.ToolCalls))
+	for _, call := range answer.ToolCalls {
+		if !known[call.Name] {
+			return message, openai.FinishReasonStop
+		}
+		args := string(call.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		toolCalls = append(toolCalls, openai.ToolCall{
+			ID:       "call_" + id.New(24),
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: call.Name, Arguments: args},
+		})
+	}
+	return openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: toolCalls}, openai.FinishReasonToolCalls
+}
+
+// extractJSONObject returns the outermost JSON object in the content, the models often wrap it in the
+// markdown code fences or the explanations.
+func extractJSONObject(content string) string {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return content
+	}
+	return content[start : end+1]
+}
+
+// emulatedStream replays the response as the chunks of the stream.
+type emulatedStream struct {
+	chunks []openai.ChatCompletionStreamResponse
+}
+
+func newEmulatedStream(resp openai.ChatCompletionResponse) *emulatedStream {
+	s := &emulatedStream{}
+	for _, choice := range resp.Choices {
+		delta := openai.ChatCompletionStreamChoiceDelta{Role: choice.Message.Role, Content: choice.Message.Content}
+		for i, tc := range choice.Message.ToolCalls {
+			index := i
+			tc.Index = &index
+			delta.ToolCalls = append(delta.ToolCalls, tc)
+		}
+		s.chunks = append(s.chunks, openai.ChatCompletionStreamResponse{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Created: resp.Created,
+			Model:   resp.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{Index: choice.Index, Delta: delta}},
+		}, openai.ChatCompletionStreamResponse{
+			ID:      resp.ID,
+			Object:  "chat.completion.chunk",
+			Created: resp.Created,
+			Model:   resp.Model,
+			Choices: []openai.ChatCompletionStreamChoice{{Index: choice.Index, FinishReason: choice.FinishReason}},
+		})
+	}
+	return s
+}
+
+func (s *emulatedStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if len(s.chunks) == 0 {
+		return openai.ChatCompletionStreamResponse{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
@@ -0,0 +1,170 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+var weatherTools = []openai.Tool{{
+	Type: openai.ToolTypeFunction,
+	Function: &openai.FunctionDefinition{
+		Name:        "get_weather",
+		Description: "get the weather of the city",
+		Parameters:  map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+	},
+}}
+
+type answerProvider struct {
+	MockLLMProvider
+	answer string
+	req    openai.ChatCompletionRequest
+}
+
+func (p *answerProvider) GetChatCompletions(_ context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	p.req = req
+	return openai.ChatCompletionResponse{
+		ID:      "chatcmpl-1",
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: p.answer}, FinishReason: openai.FinishReasonStop}},
+	}, nil
+}
+
+func TestParseEmulatedAnswer(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		expectedCalls  []string
+		expectedText   string
+		expectedReason openai.FinishReason
+	}{
+		{
+			name:           "tool calls in code fences",
+			content:        "```json\n{\"tool_calls\": [{\"name\": \"get_weather\", \"arguments\": {\"city\": \"Paris\"}}]}\n```",
+			expectedCalls:  []string{`get_weather {"city": "Paris"}`},
+			expectedReason: openai.FinishReasonToolCalls,
+		},
+		{
+			name:           "answer",
+			content:        `{"answer": "It's sunny"}`,
+			expectedText:   "It's sunny",
+			expectedReason: openai.FinishReasonStop,
+		},
+		{
+			name:           "plain text",
+			content:        "It's sunny",
+			expectedText:   "It's sunny",
+			expectedReason: openai.FinishReasonStop,
+		},
+		{
+			name:           "unknown tool",
+			content:        `{"tool_calls": [{"name": "rm_rf", "arguments": {}}]}`,
+			expectedText:   `{"tool_calls": [{"name": "rm_rf", "arguments": {}}]}`,
+			expectedReason: openai.FinishReasonStop,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, reason := parseEmulatedAnswer(tt.content, weatherTools)
+
+			assert.Equal(t, tt.expectedReason, reason)
+			assert.Equal(t, tt.expectedText, message.Content)
+			var calls []string
+			for _, tc := range message.ToolCalls {
+				assert.True(t, strings.HasPrefix(tc.ID, "call_"))
+				calls = append(calls, tc.Function.Name+" "+tc.Function.Arguments)
+			}
+			assert.Equal(t, tt.expectedCalls, calls)
+		})
+	}
+}
+
+func TestEmulateToolsRequest(t *testing.T) {
+	req, err := emulateToolsRequest(openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: "user", Content: "How is the weather in Paris?"},
+			{Role: "assistant", ToolCalls: []openai.ToolCall{{ID: "call_1", Function: openai.FunctionCall{Name: "get_weather", Arguments: `{"city":"Paris"}`}}}},
+			{Role: "tool", ToolCallID: "call_1", Content: "sunny"},
+		},
+		Tools: weatherTools,
+	})
+	assert.NoError(t, err)
+
+	assert.Nil(t, req.Tools)
+	assert.Len(t, req.Messages, 4)
+	assert.Equal(t, "system", req.Messages[0].Role)
+	assert.Contains(t, req.Messages[0].Content, `"name":"get_weather"`)
+	assert.Equal(t, openai.ChatCompletionMessage{Role: "user", Content: "How is the weather in Paris?"}, req.Messages[1])
+	assert.Equal(t, openai.ChatCompletionMessage{Role: "assistant", Content: `{"tool_calls":[{"arguments":{"city":"Paris"},"name":"get_weather"}]}`}, req.Messages[2])
+	assert.Equal(t, openai.ChatCompletionMessage{Role: "user", Content: "The result of the tool call call_1: sunny"}, req.Messages[3])
+}
+
+func TestToolEmulationProvider(t *testing.T) {
+	underlying := &answerProvider{answer: `{"tool_calls": [{"name": "get_weather", "arguments": {"city": "Paris"}}]}`}
+	provider := NewToolEmulationProvider(Provider{"tool_emulation": "true"}, underlying)
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "How is the weather in Paris?"}},
+		Tools:    weatherTools,
+		Stream:   true,
+	}
+
+	recver, err := provider.GetChatCompletionsStream(context.Background(), req, nil)
+	assert.NoError(t, err)
+	assert.False(t, underlying.req.Stream)
+	assert.Nil(t, underlying.req.Tools)
+
+	chunk, err := recver.Recv()
+	assert.NoError(t, err)
+	assert.Len(t, chunk.Choices[0].Delta.ToolCalls, 1)
+	assert.Equal(t, 0, *chunk.Choices[0].Delta.ToolCalls[0].Index)
+	assert.Equal(t, `{"city": "Paris"}`, chunk.Choices[0].Delta.ToolCalls[0].Function.Arguments)
+
+	chunk, err = recver.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, openai.FinishReasonToolCalls, chunk.Choices[0].FinishReason)
+
+	_, err = recver.Recv()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNewToolEmulationProvider(t *testing.T) {
+	tests := []struct {
+		name      string
+		emulation string
+		model     string
+		emulated  bool
+	}{
+		{name: "not set", emulation: "", model: "llama2", emulated: false},
+		{name: "false", emulation: "false", model: "llama2", emulated: false},
+		{name: "all the models", emulation: "true", model: "gpt-4o", emulated: true},
+		{name: "the model matches", emulation: "llama2*, gemma*", model: "gemma-7b", emulated: true},
+		{name: "the model doesn't match", emulation: "llama2*, gemma*", model: "gpt-4o", emulated: false},
+		{name: "no model", emulation: "llama2*", model: "", emulated: false},
+		{name: "invalid patterns", emulation: "[", model: "llama2", emulated: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			underlying := &answerProvider{answer: `{"answer": "sunny"}`}
+			provider := NewToolEmulationProvider(Provider{"tool_emulation": tt.emulation}, underlying)
+
+			req := openai.ChatCompletionRequest{
+				Model:    tt.model,
+				Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "How is the weather in Paris?"}},
+				Tools:    weatherTools,
+			}
+			resp, err := provider.GetChatCompletions(context.Background(), req, nil)
+			assert.NoError(t, err)
+			if tt.emulated {
+				assert.Nil(t, underlying.req.Tools)
+				assert.Equal(t, "sunny", resp.Choices[0].Message.Content)
+			} else {
+				assert.Equal(t, weatherTools, underlying.req.Tools)
+				assert.Equal(t, `{"answer": "sunny"}`, resp.Choices[0].Message.Content)
+			}
+		})
+	}
+}
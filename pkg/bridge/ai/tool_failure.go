@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/ai"
+)
+
+const (
+	// ToolFailureContinue continues the chat completion when some of the tool calls fail, the failed tool
+	// calls are answered by the error tool messages, so the llm can answer with the successful results.
+	ToolFailureContinue = "continue"
+	// ToolFailureFail fails the whole chat completion when any of the tool calls fails.
+	ToolFailureFail = "fail"
+)
+
+// ToolFailure is how the chat completion goes on when some of the parallel tool calls fail.
+var ToolFailure = ToolFailureContinue
+
+// ToolCallError is the error of the chat completion failed by the failed tool call, see ToolFailureFail.
+type ToolCallError struct {
+	ToolCallID   string
+	FunctionName string
+	ai.ToolError
+}
+
+func (e *ToolCallError) Error() string {
+	return fmt.Sprintf("tool call %s of function %s failed: %s", e.ToolCallID, e.FunctionName, e.Message)
+}
+
+// toolErrorMessage returns the tool message of the failed tool call, its content is the JSON of the error.
+func toolErrorMessage(toolCallID, code, message string) ai.ToolMessage {
+	toolErr := &ai.ToolError{Code: code, Message: message}
+	content, _ := json.Marshal(struct {
+		Error *ai.ToolError `json:"error"`
+	}{toolErr})
+
+	return ai.ToolMessage{
+		Role:       "tool",
+		Content:    string(content),
+		ToolCallId: toolCallID,
+		Error:      toolErr,
+	}
+}
+
+// checkToolFailures returns the ToolCallError of the first failed tool call if the failures fail the
+// chat completion, the tool messages are in the order of the tool calls.
+func checkToolFailures(toolCalls []openai.ToolCall, toolMessages []ai.ToolMessage) error {
+	if ToolFailure != ToolFailureFail {
+		return nil
+	}
+	names := make(map[string]string, len(toolCalls))
+	for _, tc := range toolCalls {
+		names[tc.ID] = tc.Function.Name
+	}
+	for _, msg := range toolMessages {
+		if msg.Error != nil {
+			return &ToolCallError{ToolCallID: msg.ToolCallId, FunctionName: names[msg.ToolCallId], ToolError: *msg.Error}
+		}
+	}
+	return nil
+}
+
+// answerToolCalls returns the tool messages answering all the tool calls in their order, the tool calls
+// without the results, eg: the functions which are not registered, are answered by the error tool messages.
+func answerToolCalls(toolCalls []openai.ToolCall, toolMessages []ai.ToolMessage) []ai.ToolMessage {
+	results := make(map[string]ai.ToolMessage, len(toolMessages))
+	for _, msg := range toolMessages {
+		results[msg.ToolCallId] = msg
+	}
+	answers := make([]ai.ToolMessage, 0, len(toolCalls))
+	for _, tc := range toolCalls {
+		msg, ok := results[tc.ID]
+		if !ok {
+			msg = toolErrorMessage(tc.ID, ai.ErrorCodeNotFound, fmt.Sprintf("function %s is not found", tc.Function.Name))
+		}
+		answers = append(answers, msg)
+	}
+	return answers
+}
@@ -0,0 +1,64 @@
+package ai
+
+import (
+	"errors"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/ai"
+)
+
+func TestAnswerToolCalls(t *testing.T) {
+	toolCalls := []openai.ToolCall{
+		{ID: "call-1", Function: openai.FunctionCall{Name: "get-weather"}},
+		{ID: "call-2", Function: openai.FunctionCall{Name: "get-unknown"}},
+		{ID: "call-3", Function: openai.FunctionCall{Name: "get-time"}},
+	}
+	toolMessages := []ai.ToolMessage{
+		{Role: "tool", ToolCallId: "call-3", Content: "12:00"},
+		toolErrorMessage("call-1", ai.ErrorCodeTimeout, "function get-weather timed out after 1s"),
+	}
+
+	answers := answerToolCalls(toolCalls, toolMessages)
+	assert.Equal(t, []ai.ToolMessage{
+		{
+			Role:       "tool",
+			ToolCallId: "call-1",
+			Content:    `{"error":{"code":"timeout","message":"function get-weather timed out after 1s"}}`,
+			Error:      &ai.ToolError{Code: ai.ErrorCodeTimeout, Message: "function get-weather timed out after 1s"},
+		},
+		{
+			Role:       "tool",
+			ToolCallId: "call-2",
+			Content:    `{"error":{"code":"not_found","message":"function get-unknown is not found"}}`,
+			Error:      &ai.ToolError{Code: ai.ErrorCodeNotFound, Message: "function get-unknown is not found"},
+		},
+		{Role: "tool", ToolCallId: "call-3", Content: "12:00"},
+	}, answers)
+}
+
+func TestCheckToolFailures(t *testing.T) {
+	t.Cleanup(func() { ToolFailure = ToolFailureContinue })
+
+	toolCalls := []openai.ToolCall{
+		{ID: "call-1", Function: openai.FunctionCall{Name: "get-time"}},
+		{ID: "call-2", Function: openai.FunctionCall{Name: "get-weather"}},
+	}
+	toolMessages := []ai.ToolMessage{
+		{Role: "tool", ToolCallId: "call-1", Content: "12:00"},
+		toolErrorMessage("call-2", ai.ErrorCodeUnavailable, "no llm-sfn to call function get-weather"),
+	}
+
+	assert.NoError(t, checkToolFailures(toolCalls, toolMessages))
+
+	ToolFailure = ToolFailureFail
+	err := checkToolFailures(toolCalls, toolMessages)
+	var toolErr *ToolCallError
+	assert.True(t, errors.As(err, &toolErr))
+	assert.Equal(t, "get-weather", toolErr.FunctionName)
+	assert.Equal(t, ai.ErrorCodeUnavailable, toolErr.Code)
+	assert.EqualError(t, err, "tool call call-2 of function get-weather failed: no llm-sfn to call function get-weather")
+
+	assert.NoError(t, checkToolFailures(toolCalls, toolMessages[:1]))
+}
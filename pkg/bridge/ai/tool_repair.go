@@ -0,0 +1,225 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+const (
+	// ArgumentRepairOff passes the malformed arguments of the tool calls to the functions as they are.
+	ArgumentRepairOff = "off"
+	// ArgumentRepairLocal repairs the malformed arguments by the local fix-ups, eg: the trailing commas,
+	// the markdown code fences and the truncated brackets.
+	ArgumentRepairLocal = "local"
+	// ArgumentRepairProvider asks the llm provider to correct the arguments once if the local fix-ups fail.
+	ArgumentRepairProvider = "provider"
+)
+
+// ArgumentRepair is the repair of the malformed JSON arguments of the tool calls, the arguments are repaired
+// before the functions are called, the functions get the original arguments if the repair fails.
+var ArgumentRepair = ArgumentRepairLocal
+
+// argumentRepairPrompt asks the llm provider to correct the arguments.
+const argumentRepairPrompt = `The arguments of the function %q are not valid JSON:
+
+%s
+
+The JSON schema of the arguments is:
+
+%s
+
+Respond with only the corrected JSON object of the arguments.`
+
+// repairToolCalls repairs the malformed arguments of the tool calls in place.
+func (s *Service) repairToolCalls(ctx context.Context, toolCalls []openai.ToolCall, tools map[uint32]openai.Tool) {
+	if ArgumentRepair == ArgumentRepairOff {
+		return
+	}
+	for i := range toolCalls {
+		fn := &toolCalls[i].Function
+		if isJSONObject(fn.Arguments) {
+			continue
+		}
+		schema := parametersOf(tools, fn.Name)
+
+		result := "local"
+		args, ok := repairArguments(fn.Arguments, schema)
+		if !ok && ArgumentRepair == ArgumentRepairProvider {
+			result = "provider"
+			args, ok = s.correctArguments(ctx, fn.Name, fn.Arguments, schema)
+		}
+		if !ok {
+			result = "failed"
+		} else {
+			fn.Arguments = args
+		}
+		s.metrics.recordArgumentRepair(ctx, fn.Name, result)
+		ylog.Warn("repair the malformed tool call arguments", "function", fn.Name, "result", result, "transID", FromTransIDContext(ctx))
+	}
+}
+
+// correctArguments asks the llm provider to correct the arguments.
+func (s *Service) correctArguments(ctx context.Context, name, args string, schema any) (string, bool) {
+	schemaJSON, _ := json.Marshal(schema)
+	resp, err := s.LLMProvider.GetChatCompletions(ctx, openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{{
+			Role:    openai.ChatMessageRoleUser,
+			Content: fmt.Sprintf(argumentRepairPrompt, name, args, schemaJSON),
+		}},
+	}, s.Metadata)
+	if err != nil || len(resp.Choices) == 0 {
+		return "", false
+	}
+	corrected := extractJSONObject(resp.Choices[0].Message.Content)
+	return corrected, isJSONObject(corrected)
+}
+
+func parametersOf(tools map[uint32]openai.Tool, name string) any {
+	for _, tool := range tools {
+		if tool.Function != nil && tool.Function.Name == name {
+			return tool.Function.Parameters
+		}
+	}
+	return nil
+}
+
+func isJSONObject(s string) bool {
+	var v map[string]json.RawMessage
+	return json.Unmarshal([]byte(s), &v) == nil && v != nil
+}
+
+// repairArguments repairs the arguments by the local fix-ups, ok is false if they can't be repaired.
+func repairArguments(args string, schema any) (string, bool) {
+	s := strings.TrimSpace(args)
+	if s == "" {
+		return "{}", true
+	}
+	// the markdown code fences
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```json")
+		s = strings.TrimPrefix(s, "```")
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+	}
+	if isJSONObject(s) {
+		return s, true
+	}
+	// the single quotes instead of the double quotes
+	if !strings.Contains(s, `"`) && strings.Contains(s, `'`) {
+		if q := strings.ReplaceAll(s, `'`, `"`); isJSONObject(q) {
+			return q, true
+		}
+	}
+	s = closeBrackets(removeTrailingCommas(s))
+	if isJSONObject(s) {
+		return s, true
+	}
+	// the bare value of the only property of the schema
+	if prop, ok := onlyProperty(schema); ok && json.Valid([]byte(s)) {
+		wrapped, _ := json.Marshal(map[string]json.RawMessage{prop: json.RawMessage(s)})
+		return string(wrapped), true
+	}
+	return "", false
+}
+
+// removeTrailingCommas removes the commas before the closing brackets, the strings are kept.
+func removeTrailingCommas(s string) string {
+	var (
+		b        strings.Builder
+		inString bool
+		escaped  bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			b.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			j := i + 1
+			for j < len(s) && strings.IndexByte(" \t\r\n", s[j]) >= 0 {
+				j++
+			}
+			if j < len(s) && (s[j] == '}' || s[j] == ']') {
+				continue
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// closeBrackets closes the string and the brackets left open by the truncated output.
+func closeBrackets(s string) string {
+	var (
+		stack    []byte
+		inString bool
+		escaped  bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) > 0 && stack[len(stack)-1] == c {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if inString {
+		s += `"`
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		s += string(stack[i])
+	}
+	return s
+}
+
+// onlyProperty returns the name of the only property of the object schema.
+func onlyProperty(schema any) (string, bool) {
+	buf, err := json.Marshal(schema)
+	if err != nil {
+		return "", false
+	}
+	var object struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(buf, &object); err != nil || len(object.Properties) != 1 {
+		return "", false
+	}
+	for name := range object.Properties {
+		return name, true
+	}
+	return "", false
+}
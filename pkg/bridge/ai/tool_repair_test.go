@@ -0,0 +1,89 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func TestRepairArguments(t *testing.T) {
+	citySchema := map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}}
+
+	tests := []struct {
+		name   string
+		args   string
+		schema any
+		want   string
+		wantOK bool
+	}{
+		{name: "empty", args: " ", want: "{}", wantOK: true},
+		{name: "code fences", args: "```json\n{\"city\": \"Paris\"}\n```", want: `{"city": "Paris"}`, wantOK: true},
+		{name: "single quotes", args: `{'city': 'Paris'}`, want: `{"city": "Paris"}`, wantOK: true},
+		{name: "trailing commas", args: `{"city": "Paris", "days": [1, 2,],}`, want: `{"city": "Paris", "days": [1, 2]}`, wantOK: true},
+		{name: "commas in string", args: `{"city": "a,}", }`, want: `{"city": "a,}" }`, wantOK: true},
+		{name: "truncated", args: `{"city": "Par`, want: `{"city": "Par"}`, wantOK: true},
+		{name: "truncated array", args: `{"days": [1, 2`, want: `{"days": [1, 2]}`, wantOK: true},
+		{name: "bare value of the only property", args: `"Paris"`, schema: citySchema, want: `{"city":"Paris"}`, wantOK: true},
+		{name: "bare value without schema", args: `"Paris"`, wantOK: false},
+		{name: "garbage", args: `city is Paris`, schema: citySchema, wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := repairArguments(tt.args, tt.schema)
+			assert.Equal(t, tt.wantOK, ok)
+			if tt.wantOK {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+type correctingProvider struct {
+	MockLLMProvider
+	answer string
+	calls  int
+}
+
+func (p *correctingProvider) GetChatCompletions(_ context.Context, _ openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	p.calls++
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: "assistant", Content: p.answer}}},
+	}, nil
+}
+
+func TestRepairToolCalls(t *testing.T) {
+	tools := map[uint32]openai.Tool{1: weatherTools[0]}
+	t.Cleanup(func() { ArgumentRepair = ArgumentRepairLocal })
+
+	tests := []struct {
+		name      string
+		mode      string
+		args      string
+		answer    string
+		want      string
+		wantCalls int
+	}{
+		{name: "valid", mode: ArgumentRepairProvider, args: `{"city": "Paris"}`, want: `{"city": "Paris"}`},
+		{name: "off", mode: ArgumentRepairOff, args: `{"city": "Paris",}`, want: `{"city": "Paris",}`},
+		{name: "local", mode: ArgumentRepairLocal, args: `{"city": "Paris",}`, want: `{"city": "Paris"}`},
+		{name: "local failed", mode: ArgumentRepairLocal, args: `city=Paris`, want: `city=Paris`},
+		{name: "provider", mode: ArgumentRepairProvider, args: `city=Paris`, answer: "```json\n{\"city\": \"Paris\"}\n```", want: `{"city": "Paris"}`, wantCalls: 1},
+		{name: "provider failed", mode: ArgumentRepairProvider, args: `city=Paris`, answer: "sorry", want: `city=Paris`, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ArgumentRepair = tt.mode
+			provider := &correctingProvider{answer: tt.answer}
+			s := &Service{LLMProvider: provider, Metadata: metadata.M{}, metrics: newLLMMetrics()}
+
+			toolCalls := []openai.ToolCall{{ID: "call_1", Function: openai.FunctionCall{Name: "get_weather", Arguments: tt.args}}}
+			s.repairToolCalls(context.Background(), toolCalls, tools)
+
+			assert.Equal(t, tt.want, toolCalls[0].Function.Arguments)
+			assert.Equal(t, tt.wantCalls, provider.calls)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package ai
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+// DefaultToolRetryKey is the key of the retry policy applied to the functions which are not configured
+// and don't declare their own policies.
+const DefaultToolRetryKey = "*"
+
+// ToolRetry is the retry policy of the tool calls configured by the bridge, it replaces the call policy
+// declared by the sfn, so the flaky functions are retried before the error is the tool message for the llm.
+type ToolRetry struct {
+	Timeout         time.Duration `yaml:"timeout"`          // Timeout is the timeout of each attempt, it is not timed out if it is 0
+	MaxAttempts     int           `yaml:"max_attempts"`     // MaxAttempts is the maximum number of attempts including the first one
+	RetryableErrors []string      `yaml:"retryable_errors"` // RetryableErrors are the error codes which can be retried, all the errors are retryable if it is empty
+	Backoff         time.Duration `yaml:"backoff"`          // Backoff is the delay before the first retry, it is doubled for every next retry
+	MaxBackoff      time.Duration `yaml:"max_backoff"`      // MaxBackoff caps the delay before the retries
+	Alternate       bool          `yaml:"alternate"`        // Alternate retries on all the instances instead of the nearest one, see NearestInstance
+}
+
+// toolRetries are the configured call policies, the key is the function name or DefaultToolRetryKey.
+var toolRetries atomic.Pointer[map[string]ai.CallPolicy]
+
+// ConfigureToolRetry configures the retry policies of the tool calls, the key is the function name,
+// the policy of DefaultToolRetryKey applies to the functions without their own policies.
+func ConfigureToolRetry(conf map[string]ToolRetry) {
+	policies := make(map[string]ai.CallPolicy, len(conf))
+	for name, r := range conf {
+		policies[name] = ai.CallPolicy{
+			Timeout:         r.Timeout,
+			MaxAttempts:     r.MaxAttempts,
+			RetryableErrors: r.RetryableErrors,
+			Backoff:         r.Backoff,
+			MaxBackoff:      r.MaxBackoff,
+			Alternate:       r.Alternate,
+		}
+	}
+	toolRetries.Store(&policies)
+}
+
+// callPolicy returns the call policy of the function, the configured policy of the function takes
+// precedence over the policy declared by the sfn, which takes precedence over the default one.
+// The sfn is resolved by the scopes of the request metadata md.
+func (s *Service) callPolicy(tag uint32, name string, md metadata.M) ai.CallPolicy {
+	var configured map[string]ai.CallPolicy
+	if p := toolRetries.Load(); p != nil {
+		configured = *p
+	}
+	if policy, ok := configured[name]; ok {
+		return policy
+	}
+	policy := register.CallPolicy(tag, md)
+	if policy.MaxAttempts == 0 && policy.Timeout == 0 {
+		if def, ok := configured[DefaultToolRetryKey]; ok {
+			return def
+		}
+	}
+	return policy
+}
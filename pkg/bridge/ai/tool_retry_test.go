@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+)
+
+func TestServiceCallPolicy(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0x71, &openai.FunctionDefinition{Name: "declared"}, 2001, md))
+	assert.NoError(t, register.RegisterFunction(0x72, &openai.FunctionDefinition{Name: "undeclared"}, 2002, md))
+	defer register.UnregisterFunction(2001, md)
+	defer register.UnregisterFunction(2002, md)
+	t.Cleanup(func() { toolRetries.Store(nil) })
+
+	s := &Service{Metadata: md}
+	assert.Equal(t, ai.CallPolicy{}, s.callPolicy(0x72, "undeclared", md))
+
+	ConfigureToolRetry(map[string]ToolRetry{
+		DefaultToolRetryKey: {MaxAttempts: 3, Backoff: time.Second},
+		"declared":          {MaxAttempts: 2, Alternate: true},
+	})
+	assert.Equal(t, ai.CallPolicy{MaxAttempts: 2, Alternate: true}, s.callPolicy(0x71, "declared", md))
+	assert.Equal(t, ai.CallPolicy{MaxAttempts: 3, Backoff: time.Second}, s.callPolicy(0x72, "undeclared", md))
+}
+
+func TestCallAsyncRetry(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0x73, &openai.FunctionDefinition{Name: "flaky"}, 2003, md))
+	defer register.UnregisterFunction(2003, md)
+	ConfigureToolRetry(map[string]ToolRetry{"flaky": {Timeout: 20 * time.Millisecond, MaxAttempts: 2, Backoff: 10 * time.Millisecond, Alternate: true}})
+	NearestInstance = true
+	t.Cleanup(func() {
+		toolRetries.Store(nil)
+		NearestInstance = false
+	})
+
+	source := &batchRecorderSource{}
+	s := &Service{
+		Metadata:     md,
+		source:       source,
+		sfnCallCache: make(map[string]*sfnAsyncCall),
+		metrics:      newLLMMetrics(),
+	}
+	fns := map[uint32][]*openai.ToolCall{0x73: {{ID: "call-1", Function: openai.FunctionCall{Name: "flaky"}}}}
+	futures := s.CallAsync(context.Background(), fns, &ai.FunctionCall{ReqID: "req-retry"}, nil)
+
+	s.muCallCache.Lock()
+	c := s.sfnCallCache["req-retry"]
+	s.muCallCache.Unlock()
+
+	// the first attempt times out, the retry is delivered to all the instances.
+	assert.Eventually(t, func() bool {
+		return deliver(c, &ai.FunctionCall{ToolCallID: "call-1", Attempt: 2, IsOK: true, Result: "ok"})
+	}, time.Second, 5*time.Millisecond)
+
+	msg, err := futures[0].Result()
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", msg.Content)
+
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	assert.Len(t, source.batches, 2)
+	assert.False(t, source.batches[0][0].AllInstances)
+	assert.True(t, source.batches[1][0].AllInstances)
+}
+
+type failingSource struct {
+	yomo.Source
+	writes int
+}
+
+func (s *failingSource) Write(tag uint32, data []byte) error {
+	s.writes++
+	return errors.New("broken pipe")
+}
+
+func (s *failingSource) WriteBatch(batch []yomo.TaggedData) error {
+	s.writes++
+	return errors.New("broken pipe")
+}
+
+func TestCallAsyncUnavailable(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0x74, &openai.FunctionDefinition{Name: "unreachable"}, 2004, md))
+	defer register.UnregisterFunction(2004, md)
+	ConfigureToolRetry(map[string]ToolRetry{"unreachable": {MaxAttempts: 3}})
+	t.Cleanup(func() { toolRetries.Store(nil) })
+
+	source := &failingSource{}
+	s := &Service{
+		Metadata:     md,
+		source:       source,
+		sfnCallCache: make(map[string]*sfnAsyncCall),
+		metrics:      newLLMMetrics(),
+	}
+	fns := map[uint32][]*openai.ToolCall{0x74: {{ID: "call-1", Function: openai.FunctionCall{Name: "unreachable"}}}}
+	futures := s.CallAsync(context.Background(), fns, &ai.FunctionCall{ReqID: "req-unavailable"}, nil)
+
+	// the error of the last attempt is the tool message.
+	msg, err := futures[0].Result()
+	assert.NoError(t, err)
+	assert.Equal(t, &ai.ToolError{Code: ai.ErrorCodeUnavailable, Message: "function unreachable is unavailable: broken pipe"}, msg.Error)
+	assert.Equal(t, 3, source.writes)
+}
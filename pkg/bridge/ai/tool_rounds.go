@@ -0,0 +1,237 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/ylog"
+	"github.com/yomorun/yomo/pkg/id"
+	"github.com/yomorun/yomo/pkg/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// DefaultMaxToolRounds is the default max rounds of the tool calls of a chat completion, the model answers
+// with the results of one round of the tool calls.
+const DefaultMaxToolRounds = 1
+
+const tracerName = "github.com/yomorun/yomo/pkg/bridge/ai"
+
+// maxToolRounds returns the max rounds of the tool calls of the services.
+func maxToolRounds() int {
+	if n := getServiceOptions().MaxToolRounds; n > 0 {
+		return n
+	}
+	return DefaultMaxToolRounds
+}
+
+// runToolRounds runs the tool calls of the choice by the sfns, and calls the llm provider with their results
+// round by round until the model answers without calling the tools. The call after the last round is made
+// without the tools, so the model answers. It returns the response of the last call with the usage of all
+// the calls after the first one, and the tool calls of all the rounds with their results.
+func (s *Service) runToolRounds(ctx context.Context, req openai.ChatCompletionRequest, choice openai.ChatCompletionChoice, tagTools map[uint32]openai.Tool, transID string) (openai.ChatCompletionResponse, []openai.ToolCall, []ai.ToolMessage, error) {
+	var (
+		maxRounds = maxToolRounds()
+		toolCalls []openai.ToolCall
+		llmCalls  []ai.ToolMessage
+		usage     openai.Usage
+	)
+	if req.N > 1 {
+		req.N = 1
+	}
+	for round := 1; ; round++ {
+		calls := choice.Message.ToolCalls
+		base := &ai.FunctionCall{TransID: transID, ReqID: id.New(16), UserQuery: lastUserQuery(req.Messages)}
+		results, err := s.callTools(ctx, calls, tagTools, base, nil, nil)
+		if err != nil {
+			return openai.ChatCompletionResponse{}, nil, nil, err
+		}
+		choice.Message.ToolCalls = calls
+		toolCalls = append(toolCalls, calls...)
+		llmCalls = append(llmCalls, results...)
+
+		req.Messages = secondCallMessages(req.Messages, choice.Message, results)
+		// the tool choice is honored by the first call only
+		req.ToolChoice = nil
+		if round >= maxRounds {
+			// reset tools field
+			req.Tools = nil
+		}
+		ylog.Debug(" #2 next call", "round", round+1, "request", fmt.Sprintf("%+v", req))
+
+		resp, err := s.completeRound(ctx, req, round+1)
+		if err != nil {
+			return openai.ChatCompletionResponse{}, nil, nil, err
+		}
+		usage = addUsage(usage, resp.Usage)
+		if len(resp.Choices) == 0 {
+			return openai.ChatCompletionResponse{}, nil, nil, errors.New("no choice is returned by the llm provider")
+		}
+		choice = resp.Choices[0]
+		if req.Tools == nil || choice.FinishReason != openai.FinishReasonToolCalls {
+			resp.Usage = usage
+			return resp, toolCalls, llmCalls, nil
+		}
+	}
+}
+
+// streamToolRounds streams the chat completion, the tool calls of the model are run by the sfns round by round
+// until the model answers without calling them, the chunks of the answer are written to the events.
+func (s *Service) streamToolRounds(ctx context.Context, req openai.ChatCompletionRequest, tagTools map[uint32]openai.Tool, transID string, events *EventResponseWriter, includeCallStack bool) error {
+	var callStack *EventResponseWriter
+	if includeCallStack {
+		callStack = events
+	}
+	// emit the progress of the tool calls as the `progress` events
+	onProgress := func(progress ai.ToolProgress) {
+		events.WriteEvent(ai.EventProgress, progress)
+	}
+
+	maxRounds := maxToolRounds()
+	for round := 1; ; round++ {
+		toolCalls, err := s.streamRound(ctx, req, round, events)
+		if err != nil {
+			return err
+		}
+		if len(toolCalls) == 0 {
+			events.WriteDone(transID, includeCallStack)
+			return nil
+		}
+
+		base := &ai.FunctionCall{TransID: transID, ReqID: id.New(16), UserQuery: lastUserQuery(req.Messages)}
+		llmCalls, err := s.callTools(ctx, toolCalls, tagTools, base, callStack, onProgress)
+		if err != nil {
+			return err
+		}
+		assistantMessage := openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, ToolCalls: toolCalls}
+		req.Messages = secondCallMessages(req.Messages, assistantMessage, llmCalls)
+		// the tool choice is honored by the first call only
+		req.ToolChoice = nil
+		if round >= maxRounds {
+			// reset tools field
+			req.Tools = nil
+		}
+		ylog.Debug(" #2 next call", "round", round+1, "request", fmt.Sprintf("%+v", req))
+	}
+}
+
+// streamRound streams a call of the llm provider, the chunks of the answer are written to the events and the
+// chunks of the tool calls are recorded, it returns the tool calls of the model. The chunks of the call after
+// the last round, which has no tools, are written as they are.
+func (s *Service) streamRound(ctx context.Context, req openai.ChatCompletionRequest, round int, events *EventResponseWriter) (toolCalls []openai.ToolCall, err error) {
+	ctx, span := startRoundSpan(ctx, req, round)
+	var usage openai.Usage
+	defer func() { endRoundSpan(span, usage, len(toolCalls), err) }()
+
+	resStream, err := s.LLMProvider.GetChatCompletionsStream(s.parallelToolCallsContext(ctx, req), req, s.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	resStream = events.audio.recver(guardRecver(ctx, req, resStream))
+
+	toolCallsMap := make(map[int]openai.ToolCall)
+	isFunctionCall := false
+	for {
+		streamRes, err := resStream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if u := streamRes.Usage; u != nil {
+			usage = addUsage(usage, *u)
+		}
+		if round > 1 && req.Tools == nil {
+			events.WriteChunk(streamRes)
+			continue
+		}
+		if len(streamRes.Choices) == 0 {
+			if ContentFilterPassthrough && isContentFilterChunk(streamRes) {
+				events.WriteChunk(streamRes)
+			} else {
+				events.Record(streamRes)
+			}
+			continue
+		}
+		if tc := streamRes.Choices[0].Delta.ToolCalls; len(tc) > 0 {
+			for _, t := range tc {
+				// this index should be toolCalls slice's index, the index field only appares in stream response
+				index := *t.Index
+				item, ok := toolCallsMap[index]
+				if !ok {
+					toolCallsMap[index] = openai.ToolCall{
+						Index:    &index,
+						ID:       t.ID,
+						Type:     t.Type,
+						Function: openai.FunctionCall{},
+					}
+					item = toolCallsMap[index]
+				}
+				if t.Function.Arguments != "" {
+					item.Function.Arguments += t.Function.Arguments
+				}
+				if t.Function.Name != "" {
+					item.Function.Name = t.Function.Name
+				}
+				toolCallsMap[index] = item
+			}
+			isFunctionCall = true
+			events.Record(streamRes)
+		} else if streamRes.Choices[0].FinishReason != openai.FinishReasonToolCalls {
+			events.WriteChunk(streamRes)
+		} else {
+			events.Record(streamRes)
+		}
+	}
+	if !isFunctionCall {
+		return nil, nil
+	}
+	return mapToSliceTools(toolCallsMap), nil
+}
+
+// completeRound makes a call of the llm provider in the span of the round.
+func (s *Service) completeRound(ctx context.Context, req openai.ChatCompletionRequest, round int) (openai.ChatCompletionResponse, error) {
+	ctx, span := startRoundSpan(ctx, req, round)
+	resp, err := s.LLMProvider.GetChatCompletions(s.parallelToolCallsContext(ctx, req), req, s.Metadata)
+
+	toolCalls := 0
+	for _, choice := range resp.Choices {
+		toolCalls += len(choice.Message.ToolCalls)
+	}
+	endRoundSpan(span, resp.Usage, toolCalls, err)
+	return resp, err
+}
+
+// startRoundSpan starts the span of a call of the llm provider, the round is 1 for the first call.
+func startRoundSpan(ctx context.Context, req openai.ChatCompletionRequest, round int) (context.Context, oteltrace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "llm round", oteltrace.WithAttributes(
+		attribute.Int("llm.round", round),
+		attribute.String("llm.model", req.Model),
+		attribute.Bool("llm.tools", len(req.Tools) > 0),
+	))
+}
+
+// endRoundSpan ends the span of a call of the llm provider with its usage and the number of its tool calls.
+func endRoundSpan(span oteltrace.Span, usage openai.Usage, toolCalls int, err error) {
+	span.SetAttributes(
+		attribute.Int("llm.tool_calls", toolCalls),
+		attribute.Int("llm.usage.prompt_tokens", usage.PromptTokens),
+		attribute.Int("llm.usage.completion_tokens", usage.CompletionTokens),
+		attribute.Int("llm.usage.total_tokens", usage.TotalTokens),
+	)
+	trace.RecordError(span, err)
+	span.End()
+}
+
+func addUsage(a, b openai.Usage) openai.Usage {
+	a.PromptTokens += b.PromptTokens
+	a.CompletionTokens += b.CompletionTokens
+	a.TotalTokens += b.TotalTokens
+	return a
+}
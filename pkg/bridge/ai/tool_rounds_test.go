@@ -0,0 +1,157 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/ai"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/pkg/bridge/ai/register"
+	"go.opentelemetry.io/otel"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// roundsProvider calls get-weather while the request has the tools, until it has called it toolRounds times.
+type roundsProvider struct {
+	MockLLMProvider
+	toolRounds int
+	mu         sync.Mutex
+	reqs       []openai.ChatCompletionRequest
+}
+
+func (p *roundsProvider) next(req openai.ChatCompletionRequest) (call *openai.ToolCall) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reqs = append(p.reqs, req)
+	if len(req.Tools) == 0 || len(p.reqs) > p.toolRounds {
+		return nil
+	}
+	index := 0
+	return &openai.ToolCall{
+		Index:    &index,
+		ID:       fmt.Sprintf("call_%d", len(p.reqs)),
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: "get-weather", Arguments: `{"city":"Paris"}`},
+	}
+}
+
+func (p *roundsProvider) GetChatCompletions(_ context.Context, req openai.ChatCompletionRequest, _ metadata.M) (openai.ChatCompletionResponse, error) {
+	resp := openai.ChatCompletionResponse{ID: "chatcmpl-1", Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 1, TotalTokens: 11}}
+	if call := p.next(req); call != nil {
+		resp.Choices = []openai.ChatCompletionChoice{{
+			FinishReason: openai.FinishReasonToolCalls,
+			Message:      openai.ChatCompletionMessage{Role: "assistant", ToolCalls: []openai.ToolCall{*call}},
+		}}
+		return resp, nil
+	}
+	resp.Choices = []openai.ChatCompletionChoice{{FinishReason: openai.FinishReasonStop, Message: openai.ChatCompletionMessage{Role: "assistant", Content: "It's sunny"}}}
+	return resp, nil
+}
+
+func (p *roundsProvider) GetChatCompletionsStream(_ context.Context, req openai.ChatCompletionRequest, _ metadata.M) (ResponseRecver, error) {
+	if call := p.next(req); call != nil {
+		return &sliceRecver{chunks: []openai.ChatCompletionStreamResponse{
+			{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{ToolCalls: []openai.ToolCall{*call}}}}},
+			{Choices: []openai.ChatCompletionStreamChoice{{FinishReason: openai.FinishReasonToolCalls}}},
+		}}, nil
+	}
+	return &sliceRecver{chunks: []openai.ChatCompletionStreamResponse{
+		{Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "It's sunny"}}}},
+		{Choices: []openai.ChatCompletionStreamChoice{{FinishReason: openai.FinishReasonStop}}},
+	}}, nil
+}
+
+func TestToolRounds(t *testing.T) {
+	md := metadata.M{}
+	assert.NoError(t, register.RegisterFunction(0xB1, &openai.FunctionDefinition{Name: "get-weather"}, 2111, md))
+	defer register.UnregisterFunction(2111, md)
+
+	exporter := tracetest.NewInMemoryExporter()
+	old := otel.GetTracerProvider()
+	otel.SetTracerProvider(tracesdk.NewTracerProvider(tracesdk.WithSyncer(exporter)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(old)
+		ConfigureServiceOptions(ServiceOptions{})
+	})
+
+	newService := func(provider LLMProvider) *Service {
+		service := &Service{
+			LLMProvider:  provider,
+			Metadata:     md,
+			credential:   "token",
+			sfnCallCache: make(map[string]*sfnAsyncCall),
+			metrics:      newLLMMetrics(),
+		}
+		service.SetSystemPrompt("")
+		service.source = &toolResultSource{service: service, result: "sunny"}
+		return service
+	}
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "How is the weather?"}},
+	}
+
+	tests := []struct {
+		name          string
+		maxToolRounds int
+		toolRounds    int
+		calls         int
+		toolMessages  int
+	}{
+		{name: "default", maxToolRounds: 0, toolRounds: 3, calls: 2, toolMessages: 1},
+		{name: "answered before the max rounds", maxToolRounds: 5, toolRounds: 2, calls: 3, toolMessages: 2},
+		{name: "the last call has no tools", maxToolRounds: 3, toolRounds: 10, calls: 4, toolMessages: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConfigureServiceOptions(ServiceOptions{MaxToolRounds: tt.maxToolRounds})
+			exporter.Reset()
+
+			provider := &roundsProvider{MockLLMProvider: MockLLMProvider{name: "rounds"}, toolRounds: tt.toolRounds}
+			w := httptest.NewRecorder()
+			assert.NoError(t, newService(provider).GetChatCompletions(context.Background(), req, "trans-1", w, true))
+
+			var resp ai.ChatCompletionResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "It's sunny", resp.Choices[0].Message.Content)
+			assert.Len(t, resp.CallStack.ToolMessages, tt.toolMessages)
+			assert.Equal(t, openai.Usage{PromptTokens: 10 * tt.calls, CompletionTokens: tt.calls, TotalTokens: 11 * tt.calls}, resp.Usage)
+
+			assert.Len(t, provider.reqs, tt.calls)
+			last := provider.reqs[tt.calls-1]
+			// the tools are removed from the call after the last round.
+			assert.Equal(t, tt.toolMessages < maxToolRounds(), last.Tools != nil)
+			// the messages are the request, and every round appends the assistant message and the tool message.
+			assert.Len(t, last.Messages, 1+2*tt.toolMessages)
+
+			spans := exporter.GetSpans()
+			assert.Len(t, spans, tt.calls)
+			for _, span := range spans {
+				assert.Equal(t, "llm round", span.Name)
+			}
+		})
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		ConfigureServiceOptions(ServiceOptions{MaxToolRounds: 3})
+
+		provider := &roundsProvider{MockLLMProvider: MockLLMProvider{name: "rounds"}, toolRounds: 2}
+		w := httptest.NewRecorder()
+		req := req
+		req.Stream = true
+		assert.NoError(t, newService(provider).GetChatCompletions(context.Background(), req, "trans-2", w, true))
+
+		assert.Len(t, provider.reqs, 3)
+		assert.Equal(t, 2, strings.Count(w.Body.String(), "event: "+ai.EventToolResult))
+		assert.Contains(t, w.Body.String(), "It's sunny")
+		assert.True(t, strings.HasSuffix(w.Body.String(), "data: [DONE]"))
+	})
+}
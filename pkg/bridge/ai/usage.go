@@ -0,0 +1,303 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// UsageRecord is the usage of a chat completion request, the operators of a shared zipper bill the tenants by it.
+type UsageRecord struct {
+	// Time is the time the request started
+	Time time.Time `json:"time"`
+	// TransID is the transaction id of the request
+	TransID string `json:"trans_id"`
+	// CredentialHash is the hash of the credential of the caller, see GET /admin/services
+	CredentialHash string `json:"credential_hash"`
+	// Model is the model requested by the caller
+	Model string `json:"model"`
+	// Provider is the llm provider of the model
+	Provider string `json:"provider"`
+	// PromptTokens is the prompt tokens of all the rounds of the request
+	PromptTokens int `json:"prompt_tokens"`
+	// CompletionTokens is the completion tokens of all the rounds of the request
+	CompletionTokens int `json:"completion_tokens"`
+	// TotalTokens is the sum of the prompt and completion tokens
+	TotalTokens int `json:"total_tokens"`
+	// ToolCalls is the number of the tool calls run by the sfns
+	ToolCalls int `json:"tool_calls"`
+	// LatencyMs is the latency of the request in milliseconds
+	LatencyMs int64 `json:"latency_ms"`
+	// Status is ok or error
+	Status string `json:"status"`
+	// Error is the error of the failed request
+	Error string `json:"error,omitempty"`
+}
+
+// Usage is the configuration of the usage accounting of the chat completions.
+// The configuration looks like:
+//
+//	usage:
+//		size: 10000
+//		file: /var/log/yomo/usage.jsonl
+type Usage struct {
+	// Size is the number of the recent records kept for GET /admin/usage, the default is 1000.
+	Size int `yaml:"size"`
+	// File is the file the records are appended to as the JSON lines, it is optional.
+	File string `yaml:"file"`
+}
+
+// UsageSink receives the usage records, eg: to store them in a database or to export them as the OTLP logs.
+type UsageSink interface {
+	// Write writes the record, it's called in the order of the records by one goroutine.
+	Write(record UsageRecord) error
+}
+
+// UsageRecorder keeps the recent usage records, and writes them to the sinks in order.
+type UsageRecorder struct {
+	mu      sync.Mutex
+	size    int
+	records []UsageRecord
+	sinks   []UsageSink
+	queue   chan UsageRecord
+}
+
+// usageSinkBuffer is the number of the records waiting for the sinks, the records are dropped if it is full.
+const usageSinkBuffer = 1024
+
+var (
+	muUsageRecorder      sync.Mutex
+	defaultUsageRecorder = NewUsageRecorder(1000)
+)
+
+// SetUsageRecorder sets the default usage recorder
+func SetUsageRecorder(r *UsageRecorder) {
+	muUsageRecorder.Lock()
+	defer muUsageRecorder.Unlock()
+	defaultUsageRecorder = r
+}
+
+// GetUsageRecorder gets the default usage recorder
+func GetUsageRecorder() *UsageRecorder {
+	muUsageRecorder.Lock()
+	defer muUsageRecorder.Unlock()
+	return defaultUsageRecorder
+}
+
+// ConfigureUsage sets the default usage recorder by the config, the records are appended to the file if it's set.
+func ConfigureUsage(conf Usage) error {
+	r := NewUsageRecorder(conf.Size)
+	if conf.File != "" {
+		sink, err := NewFileUsageSink(conf.File)
+		if err != nil {
+			return err
+		}
+		r.AddSink(sink)
+	}
+	SetUsageRecorder(r)
+	return nil
+}
+
+// NewUsageRecorder returns the usage recorder which keeps the recent size records, the default size is 1000.
+func NewUsageRecorder(size int) *UsageRecorder {
+	if size <= 0 {
+		size = 1000
+	}
+	return &UsageRecorder{size: size}
+}
+
+// AddSink adds the sink the records are written to.
+func (r *UsageRecorder) AddSink(sink UsageSink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sinks = append(r.sinks, sink)
+	if r.queue == nil {
+		r.queue = make(chan UsageRecord, usageSinkBuffer)
+		go r.deliver()
+	}
+}
+
+// Record records the usage, the oldest record is dropped if there are more than size records.
+func (r *UsageRecorder) Record(record UsageRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = append(r.records, record)
+	if len(r.records) > r.size {
+		r.records = r.records[len(r.records)-r.size:]
+	}
+	if r.queue == nil {
+		return
+	}
+	select {
+	case r.queue <- record:
+	default:
+		ylog.Warn("usage sinks are congested, drop the record", "trans_id", record.TransID)
+	}
+}
+
+// Records returns the recent records of the credential since the time, the latest limit records are returned
+// if limit is positive. The records of all the credentials are returned if the credential hash is empty.
+func (r *UsageRecorder) Records(credentialHash string, since time.Time, limit int) []UsageRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records := []UsageRecord{}
+	for _, record := range r.records {
+		if credentialHash != "" && record.CredentialHash != credentialHash {
+			continue
+		}
+		if record.Time.Before(since) {
+			continue
+		}
+		records = append(records, record)
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	return records
+}
+
+func (r *UsageRecorder) deliver() {
+	for record := range r.queue {
+		r.mu.Lock()
+		sinks := r.sinks
+		r.mu.Unlock()
+
+		for _, sink := range sinks {
+			if err := sink.Write(record); err != nil {
+				ylog.Error("write usage record", "trans_id", record.TransID, "err", err.Error())
+			}
+		}
+	}
+}
+
+// fileUsageSink appends the records to the file as the JSON lines.
+type fileUsageSink struct {
+	enc *json.Encoder
+}
+
+// NewFileUsageSink returns the UsageSink which appends the records to the file as the JSON lines.
+func NewFileUsageSink(path string) (UsageSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open usage file: %w", err)
+	}
+	return &fileUsageSink{enc: json.NewEncoder(f)}, nil
+}
+
+func (s *fileUsageSink) Write(record UsageRecord) error {
+	return s.enc.Encode(record)
+}
+
+// requestUsage accumulates the usage of the rounds and the tool calls of a request.
+type requestUsage struct {
+	mu        sync.Mutex
+	usage     openai.Usage
+	toolCalls int
+}
+
+type requestUsageContextKey struct{}
+
+// withRequestUsageContext adds the usage of the request to the context, the llm provider calls and the tool
+// calls with the context are counted in it.
+func withRequestUsageContext(ctx context.Context) (context.Context, *requestUsage) {
+	usage := &requestUsage{}
+	return context.WithValue(ctx, requestUsageContextKey{}, usage), usage
+}
+
+func fromRequestUsageContext(ctx context.Context) *requestUsage {
+	usage, _ := ctx.Value(requestUsageContextKey{}).(*requestUsage)
+	return usage
+}
+
+// addRequestUsage adds the tokens used by the llm provider call to the usage of the request.
+func addRequestUsage(ctx context.Context, usage openai.Usage) {
+	if u := fromRequestUsageContext(ctx); u != nil {
+		u.mu.Lock()
+		u.usage = addUsage(u.usage, usage)
+		u.mu.Unlock()
+	}
+}
+
+// addRequestToolCalls adds the tool calls to the usage of the request.
+func addRequestToolCalls(ctx context.Context, n int) {
+	if u := fromRequestUsageContext(ctx); u != nil {
+		u.mu.Lock()
+		u.toolCalls += n
+		u.mu.Unlock()
+	}
+}
+
+// recordUsage records the usage of the chat completion request of the service started at start.
+func (s *Service) recordUsage(u *requestUsage, req openai.ChatCompletionRequest, transID string, start time.Time, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	record := UsageRecord{
+		Time:             start,
+		TransID:          transID,
+		CredentialHash:   credentialHash(s.credential),
+		Model:            req.Model,
+		Provider:         modelProviderName(s.LLMProvider.Name(), req.Model),
+		PromptTokens:     u.usage.PromptTokens,
+		CompletionTokens: u.usage.CompletionTokens,
+		TotalTokens:      u.usage.TotalTokens,
+		ToolCalls:        u.toolCalls,
+		LatencyMs:        time.Since(start).Milliseconds(),
+		Status:           "ok",
+	}
+	if err != nil {
+		record.Status, record.Error = "error", err.Error()
+	}
+	GetUsageRecorder().Record(record)
+}
+
+// HandleAdminUsage is the handler for GET /admin/usage, it returns the recent usage records, the requests are
+// authenticated by the bearer token AdminToken. The query parameters are:
+//
+//	credential_hash the records of the credential only
+//	since           the records since the RFC3339 time only
+//	limit           the latest records of the limit only
+func HandleAdminUsage(w http.ResponseWriter, r *http.Request) {
+	if code, err := authorizeAdmin(r); err != nil {
+		RespondWithError(w, code, err)
+		return
+	}
+	if r.Method != http.MethodGet {
+		RespondWithError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+
+	query := r.URL.Query()
+	var since time.Time
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			RespondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid since: %w", err))
+			return
+		}
+		since = t
+	}
+	limit := 0
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			RespondWithError(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %s", v))
+			return
+		}
+		limit = n
+	}
+	respondJSON(w, map[string][]UsageRecord{
+		"records": GetUsageRecorder().Records(query.Get("credential_hash"), since, limit),
+	})
+}
@@ -0,0 +1,151 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func TestUsageRecord(t *testing.T) {
+	t.Cleanup(func() { SetUsageRecorder(NewUsageRecorder(0)) })
+	recorder := NewUsageRecorder(0)
+	SetUsageRecorder(recorder)
+
+	service := &Service{
+		LLMProvider: &quotaProvider{LLMProvider: &completionsProvider{MockLLMProvider: MockLLMProvider{name: "openai"}}, credential: "token"},
+		Metadata:    metadata.M{},
+		credential:  "token",
+	}
+	service.SetSystemPrompt("")
+
+	req := openai.ChatCompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "hello"}},
+	}
+	assert.NoError(t, service.GetChatCompletions(context.Background(), req, "trans-1", httptest.NewRecorder(), false))
+
+	req.Stream = true
+	assert.NoError(t, service.GetChatCompletions(context.Background(), req, "trans-2", httptest.NewRecorder(), false))
+
+	records := recorder.Records("", time.Time{}, 0)
+	assert.Len(t, records, 2)
+
+	record := records[0]
+	assert.Equal(t, "trans-1", record.TransID)
+	assert.Equal(t, credentialHash("token"), record.CredentialHash)
+	assert.Equal(t, "gpt-4o", record.Model)
+	assert.Equal(t, "openai", record.Provider)
+	assert.Equal(t, 2, record.TotalTokens)
+	assert.Equal(t, "ok", record.Status)
+
+	// the stream carries no usage, its tokens are estimated.
+	record = records[1]
+	assert.Equal(t, "trans-2", record.TransID)
+	assert.Greater(t, record.PromptTokens, 0)
+	assert.Greater(t, record.CompletionTokens, 0)
+	assert.Equal(t, record.PromptTokens+record.CompletionTokens, record.TotalTokens)
+}
+
+func TestUsageRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	sink, err := NewFileUsageSink(path)
+	assert.NoError(t, err)
+
+	recorder := NewUsageRecorder(3)
+	recorder.AddSink(sink)
+
+	now := time.Now()
+	for i, hash := range []string{"a", "b", "a", "a"} {
+		recorder.Record(UsageRecord{Time: now.Add(time.Duration(i) * time.Minute), TransID: string(rune('1' + i)), CredentialHash: hash})
+	}
+
+	ids := func(records []UsageRecord) []string {
+		var ids []string
+		for _, r := range records {
+			ids = append(ids, r.TransID)
+		}
+		return ids
+	}
+	// the oldest record is dropped.
+	assert.Equal(t, []string{"2", "3", "4"}, ids(recorder.Records("", time.Time{}, 0)))
+	assert.Equal(t, []string{"3", "4"}, ids(recorder.Records("a", time.Time{}, 0)))
+	assert.Equal(t, []string{"4"}, ids(recorder.Records("a", time.Time{}, 1)))
+	assert.Equal(t, []string{"4"}, ids(recorder.Records("", now.Add(3*time.Minute), 0)))
+
+	// all the records are written to the file.
+	assert.Eventually(t, func() bool {
+		f, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+
+		lines := 0
+		for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+			var record UsageRecord
+			if json.Unmarshal(scanner.Bytes(), &record) != nil {
+				return false
+			}
+		}
+		return lines == 4
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestHandleAdminUsage(t *testing.T) {
+	t.Cleanup(func() {
+		AdminToken = ""
+		SetUsageRecorder(NewUsageRecorder(0))
+	})
+	AdminToken = "admin"
+	recorder := NewUsageRecorder(0)
+	recorder.Record(UsageRecord{TransID: "1", CredentialHash: "a", Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	recorder.Record(UsageRecord{TransID: "2", CredentialHash: "b", Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)})
+	SetUsageRecorder(recorder)
+
+	tests := []struct {
+		name         string
+		method       string
+		query        string
+		token        string
+		expectedCode int
+		expectedIDs  []string
+	}{
+		{name: "unauthorized", method: http.MethodGet, token: "guess", expectedCode: http.StatusUnauthorized},
+		{name: "method", method: http.MethodPost, token: "admin", expectedCode: http.StatusMethodNotAllowed},
+		{name: "all", method: http.MethodGet, token: "admin", expectedCode: http.StatusOK, expectedIDs: []string{"1", "2"}},
+		{name: "credential", method: http.MethodGet, query: "?credential_hash=a", token: "admin", expectedCode: http.StatusOK, expectedIDs: []string{"1"}},
+		{name: "since", method: http.MethodGet, query: "?since=2024-01-01T12:00:00Z", token: "admin", expectedCode: http.StatusOK, expectedIDs: []string{"2"}},
+		{name: "invalid since", method: http.MethodGet, query: "?since=yesterday", token: "admin", expectedCode: http.StatusBadRequest},
+		{name: "invalid limit", method: http.MethodGet, query: "?limit=-1", token: "admin", expectedCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/admin/usage"+tt.query, nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			HandleAdminUsage(w, r)
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedCode != http.StatusOK {
+				return
+			}
+			var body map[string][]UsageRecord
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			var ids []string
+			for _, r := range body["records"] {
+				ids = append(ids, r.TransID)
+			}
+			assert.Equal(t, tt.expectedIDs, ids)
+		})
+	}
+}
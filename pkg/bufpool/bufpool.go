@@ -0,0 +1,64 @@
+// Package bufpool provides the pooled byte slices for the packets and the payloads of the frames,
+// it reduces the allocations and the GC pressure of the high-throughput deployments.
+//
+// The ownership rules:
+//
+//   - Get transfers the ownership of the returned slice to the caller.
+//   - Put transfers the ownership back to the pool, the caller must not use the slice, or any slice
+//     sharing its backing array, after calling Put.
+//   - A slice that is never Put is collected by the GC as usual, so forgetting to Put is safe, but
+//     putting a slice that is still in use corrupts the data of the next Get.
+package bufpool
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	// minSizeShift is the shift of the smallest size class, 512B.
+	minSizeShift = 9
+	// maxSizeShift is the shift of the largest size class, 4MB.
+	// The slices larger than it are allocated and collected by the GC directly.
+	maxSizeShift = 22
+)
+
+// pools holds the slices by the size classes, the capacity of the slices in pools[i] is 1<<(minSizeShift+i).
+var pools [maxSizeShift - minSizeShift + 1]sync.Pool
+
+// Get returns a slice of length n, its capacity may be larger than n.
+// The content of the slice is undefined, the caller should overwrite it before reading.
+func Get(n int) []byte {
+	i := class(n)
+	if i < 0 {
+		return make([]byte, n)
+	}
+	if v := pools[i].Get(); v != nil {
+		return (*v.(*[]byte))[:n]
+	}
+	return make([]byte, n, 1<<(minSizeShift+i))
+}
+
+// Put returns the slice to the pool, see the ownership rules in the package doc.
+// The slices which are not allocated by Get are accepted only if their capacity is a size class.
+func Put(b []byte) {
+	c := cap(b)
+	i := class(c)
+	if i < 0 || c != 1<<(minSizeShift+i) {
+		return
+	}
+	b = b[:0]
+	pools[i].Put(&b)
+}
+
+// class returns the index of the smallest size class fitting n, or -1 if n is too large.
+func class(n int) int {
+	if n <= 1<<minSizeShift {
+		return 0
+	}
+	shift := bits.Len(uint(n - 1))
+	if shift > maxSizeShift {
+		return -1
+	}
+	return shift - minSizeShift
+}
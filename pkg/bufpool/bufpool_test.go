@@ -0,0 +1,34 @@
+package bufpool
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPut(t *testing.T) {
+	tests := []struct {
+		n       int
+		wantCap int
+	}{
+		{n: 0, wantCap: 512},
+		{n: 512, wantCap: 512},
+		{n: 513, wantCap: 1024},
+		{n: 1 << 20, wantCap: 1 << 20},
+		{n: 4<<20 + 1, wantCap: 4<<20 + 1},
+	}
+	for _, tt := range tests {
+		b := Get(tt.n)
+		assert.Len(t, b, tt.n)
+		assert.Equal(t, tt.wantCap, cap(b))
+		Put(b)
+	}
+}
+
+func TestPutForeign(t *testing.T) {
+	// the slice is not a size class, it is left to the GC.
+	Put(make([]byte, 10, 600))
+
+	b := Get(600)
+	assert.Equal(t, 1024, cap(b))
+}
@@ -5,7 +5,14 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/yomorun/yomo/pkg/dedup"
+	"github.com/yomorun/yomo/pkg/redact"
+	"github.com/yomorun/yomo/pkg/signature"
+	pkgtls "github.com/yomorun/yomo/pkg/tls"
+	"github.com/yomorun/yomo/pkg/trace"
+	"github.com/yomorun/yomo/pkg/webhook"
 	"gopkg.in/yaml.v3"
 )
 
@@ -31,6 +38,46 @@ type Config struct {
 	Mesh map[string]Mesh `yaml:"mesh"`
 	// Bridge is the bridge config.
 	Bridge map[string]any `yaml:"bridge"`
+	// Tracing is the OTLP trace exporter config of the zipper, bridge and the sfns run by the cli.
+	Tracing *trace.Config `yaml:"tracing"`
+	// TLS is the certificate config of the zipper and the bridge.
+	TLS *TLS `yaml:"tls"`
+	// Signature is the keys of verifying the signed data frames.
+	Signature *signature.Config `yaml:"signature"`
+	// Redact is the additional patterns and keys of the secrets redacted from the logs and the traces.
+	Redact *redact.Config `yaml:"redact"`
+	// FrameWorkers is the worker pool which handles the data frames.
+	FrameWorkers *FrameWorkers `yaml:"frame_workers"`
+	// Dedup suppresses the duplicate data frames by their frame ids.
+	Dedup *dedup.Config `yaml:"dedup"`
+	// Drain asks the clients to reconnect once their connections are too old.
+	Drain *Drain `yaml:"drain"`
+	// Webhook is the webhooks notified of the connection and registration events.
+	Webhook *webhook.Config `yaml:"webhook"`
+}
+
+// FrameWorkers describes the worker pool which handles the data frames, the frames are handled by the
+// reading goroutine of each connection if the pool is not configured.
+type FrameWorkers struct {
+	// Workers is the number of the workers, the default is the number of CPUs.
+	Workers int `yaml:"workers"`
+	// QueueSize is the number of the frames queued by each worker, the default is 1024.
+	QueueSize int `yaml:"queue_size"`
+}
+
+// Drain describes how the zipper asks the clients to reconnect, so the clients are rebalanced across the
+// zippers and brought to the rotated certificates.
+type Drain struct {
+	// MaxConnectionAge is the max age of the connections, the connections never age if it is 0.
+	MaxConnectionAge time.Duration `yaml:"max_connection_age"`
+	// Grace is how long the clients have to reconnect before the connections are closed, the default is 30s.
+	Grace time.Duration `yaml:"grace"`
+}
+
+// TLS describes how the zipper gets its certificates.
+type TLS struct {
+	// ACME obtains and renews the certificates automatically from an ACME CA, such as Let's Encrypt.
+	ACME *pkgtls.ACMEConfig `yaml:"acme"`
 }
 
 // Mesh describes a cascading zipper config.
@@ -59,6 +106,16 @@ func ParseConfigFile(configPath string) (Config, error) {
 		return Config{}, err
 	}
 
+	return ParseConfig(buf)
+}
+
+// ParseConfig parses the config from the raw yaml config, the config is validated against the config schema,
+// a *ValidationError is returned if the config does not match the schema.
+func ParseConfig(buf []byte) (Config, error) {
+	if err := validateSchema(buf); err != nil {
+		return Config{}, err
+	}
+
 	var config Config
 	if err := yaml.Unmarshal(buf, &config); err != nil {
 		return config, err
@@ -71,6 +128,26 @@ func ParseConfigFile(configPath string) (Config, error) {
 	return config, nil
 }
 
+// ParseTracingConfig parses the tracing config from configPath, it returns nil if the tracing
+// is not configured. The other configs are not validated.
+func ParseTracingConfig(configPath string) (*trace.Config, error) {
+	if ext := filepath.Ext(configPath); ext != ".yaml" && ext != ".yml" {
+		return nil, ErrConfigExt
+	}
+
+	buf, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(buf, &config); err != nil {
+		return nil, err
+	}
+
+	return config.Tracing, nil
+}
+
 func validateConfig(conf *Config) error {
 	if conf.Name == "" {
 		return errors.New("config: the name is required")
@@ -24,9 +24,24 @@ func TestParseConfigFile(t *testing.T) {
 		assert.Equal(t, "0.0.0.0", conf.Host)
 
 		assert.Equal(t, 9000, conf.Port)
+		assert.Equal(t, "http://localhost:4318", conf.Tracing.Endpoint)
 	})
 }
 
+func TestParseTracingConfig(t *testing.T) {
+	conf, err := ParseTracingConfig("../../test/config.yaml")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "http://localhost:4318", conf.Endpoint)
+	assert.Equal(t, map[string]string{"authorization": "Bearer <TOKEN>"}, conf.Headers)
+	assert.Equal(t, "parentbased_traceidratio", conf.Sampler)
+	assert.Equal(t, 0.5, *conf.SamplerArg)
+	assert.Equal(t, 0.1, *conf.Sampling.Ratio)
+	assert.Equal(t, 100.0, conf.Sampling.RateLimit)
+	assert.True(t, conf.Sampling.AlwaysOnErrors)
+	assert.Equal(t, map[string]string{"deployment.environment": "test"}, conf.ResourceAttributes)
+}
+
 func TestValidateConfig(t *testing.T) {
 	type args struct {
 		conf *Config
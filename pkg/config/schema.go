@@ -0,0 +1,155 @@
+package config
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed schema.json
+var schemaJSON string
+
+var loadSchema = sync.OnceValues(func() (*gojsonschema.Schema, error) {
+	return gojsonschema.NewSchema(gojsonschema.NewStringLoader(schemaJSON))
+})
+
+// SchemaJSON returns the JSON Schema of the zipper config, it can be used by the editors to
+// validate and complete the config.
+func SchemaJSON() string { return schemaJSON }
+
+// FieldError is a violation of the config schema.
+type FieldError struct {
+	// Line is the line number of the field in the config, it is 0 if the line is unknown.
+	Line int
+	// Field is the path of the field, eg: bridge.ai.providers.openai.
+	Field string
+	// Message describes the violation.
+	Message string
+}
+
+func (e FieldError) String() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+}
+
+// ValidationError is returned when the config does not match the config schema,
+// it reports all the violations, such as the unknown keys, the type errors and the missing fields.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("config: invalid config")
+	for _, fe := range e.Errors {
+		b.WriteString("\n  ")
+		b.WriteString(fe.String())
+	}
+	return b.String()
+}
+
+// validateSchema validates the raw yaml config against the config schema.
+func validateSchema(buf []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(buf, &root); err != nil {
+		return err
+	}
+
+	lines := map[string]int{}
+	doc := nodeValue(&root, "", lines)
+	if doc == nil {
+		doc = map[string]any{}
+	}
+
+	schema, err := loadSchema()
+	if err != nil {
+		return err
+	}
+	result, err := schema.Validate(gojsonschema.NewGoLoader(doc))
+	if err != nil {
+		return err
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	verr := &ValidationError{}
+	for _, re := range result.Errors() {
+		field := re.Field()
+		if field == "(root)" {
+			field = ""
+		}
+		// locate the unknown or missing key itself.
+		if property, ok := re.Details()["property"].(string); ok && re.Type() != "required" {
+			field = joinPath(field, property)
+		}
+		fe := FieldError{Line: lines[field], Field: field, Message: re.Description()}
+		if field == "" {
+			fe.Field = "(root)"
+		}
+		verr.Errors = append(verr.Errors, fe)
+	}
+	sort.SliceStable(verr.Errors, func(i, j int) bool { return verr.Errors[i].Line < verr.Errors[j].Line })
+
+	return verr
+}
+
+// nodeValue converts the yaml node to the value which can be validated by the json schema,
+// and records the line of every field in lines, the key of lines is the dot separated path.
+func nodeValue(node *yaml.Node, path string, lines map[string]int) any {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return nodeValue(node.Content[0], path, lines)
+	case yaml.AliasNode:
+		return nodeValue(node.Alias, path, lines)
+	case yaml.MappingNode:
+		m := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				if merged, ok := nodeValue(value, path, lines).(map[string]any); ok {
+					for k, v := range merged {
+						m[k] = v
+					}
+				}
+				continue
+			}
+			keyPath := joinPath(path, key.Value)
+			lines[keyPath] = key.Line
+			m[key.Value] = nodeValue(value, keyPath, lines)
+		}
+		return m
+	case yaml.SequenceNode:
+		s := make([]any, len(node.Content))
+		for i, item := range node.Content {
+			itemPath := joinPath(path, strconv.Itoa(i))
+			lines[itemPath] = item.Line
+			s[i] = nodeValue(item, itemPath, lines)
+		}
+		return s
+	default:
+		var v any
+		if err := node.Decode(&v); err != nil {
+			return node.Value
+		}
+		return v
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSchema(t *testing.T) {
+	t.Run("invalid", func(t *testing.T) {
+		buf := []byte(`name: zipper
+port: "9000"
+mesh:
+  zipper-us:
+    host: 10.0.0.1
+    port: 9000
+    auth: "token:<CREDENTIAL>"
+bridge:
+  ai:
+    providers:
+      openai:
+        api_kye: <API_KEY>
+`)
+		_, err := ParseConfig(buf)
+
+		verr, ok := err.(*ValidationError)
+		if !assert.True(t, ok, err) {
+			return
+		}
+		assert.Equal(t, []FieldError{
+			{Line: 0, Field: "(root)", Message: "host is required"},
+			{Line: 2, Field: "port", Message: "Invalid type. Expected: integer, given: string"},
+			{Line: 7, Field: "mesh.zipper-us.auth", Message: "Additional property auth is not allowed"},
+			{Line: 12, Field: "bridge.ai.providers.openai.api_kye", Message: "Additional property api_kye is not allowed"},
+		}, verr.Errors)
+		assert.Contains(t, err.Error(), "line 12: bridge.ai.providers.openai.api_kye: Additional property api_kye is not allowed")
+	})
+
+	t.Run("examples", func(t *testing.T) {
+		files := []string{"../../test/config.yaml", "../../example/config.yaml", "../../example/10-ai/zipper.yaml"}
+		cascading, _ := filepath.Glob("../../example/4-cascading-zipper/*.yaml")
+		mesh, _ := filepath.Glob("../../example/6-mesh/*/*.yaml")
+		for _, file := range append(append(files, cascading...), mesh...) {
+			buf, err := os.ReadFile(file)
+			assert.NoError(t, err)
+			assert.NoError(t, validateSchema(buf), file)
+		}
+	})
+}
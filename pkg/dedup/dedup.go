@@ -0,0 +1,165 @@
+// Package dedup suppresses the duplicate DataFrames by their frame IDs, so the frames delivered more than
+// once, eg: the frames redelivered after a reconnection or written to all the instances by a retry, don't
+// cause double side effects in the stream functions.
+//
+// The frame ID is carried by the reserved metadata key `yomo-frame-id`, it's set by the sources on every
+// write, the frames without the frame ID are never suppressed.
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yomorun/yomo/core/metadata"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// DefaultSize is the default number of the frame IDs remembered by a window.
+	DefaultSize = 65536
+	// DefaultTTL is the default time the frame IDs are remembered by a window.
+	DefaultTTL = time.Minute
+)
+
+// Config is the config of the duplicate-suppression window, the config looks like:
+//
+//	dedup:
+//		size: 65536
+//		ttl: 1m
+type Config struct {
+	// Size is the max number of the frame IDs remembered, the oldest ones are forgotten if it is exceeded.
+	Size int `yaml:"size"`
+	// TTL is how long the frame IDs are remembered, the duplicates arriving later are not suppressed.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Window remembers the frame IDs seen recently, it is bounded by both the size and the ttl.
+type Window struct {
+	name       string
+	size       int
+	ttl        time.Duration
+	now        func() time.Time
+	suppressed metric.Int64Counter
+
+	mu    sync.Mutex
+	seen  map[string]*list.Element
+	order *list.List // the front is the oldest
+}
+
+type entry struct {
+	id     string
+	seenAt time.Time
+}
+
+// New returns the window of the config, the name is the attribute of the metric of the suppressed
+// frames, eg: the zipper or the sfn name. The zero size and ttl are DefaultSize and DefaultTTL.
+func New(name string, conf Config) *Window {
+	if conf.Size <= 0 {
+		conf.Size = DefaultSize
+	}
+	if conf.TTL <= 0 {
+		conf.TTL = DefaultTTL
+	}
+
+	meter := otel.Meter("github.com/yomorun/yomo/pkg/dedup")
+	suppressed, err := meter.Int64Counter(
+		"yomo.dedup.suppressed_frames",
+		metric.WithDescription("The number of the duplicate data frames suppressed."),
+		metric.WithUnit("{frame}"),
+	)
+	otel.Handle(err)
+
+	return &Window{
+		name:       name,
+		size:       conf.Size,
+		ttl:        conf.TTL,
+		now:        time.Now,
+		suppressed: suppressed,
+		seen:       make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// NewFromEnv returns the window configured by the environment variables YOMO_DEDUP_SIZE and YOMO_DEDUP_TTL,
+// eg: `YOMO_DEDUP_TTL=5m`, it returns nil if neither of them is set.
+func NewFromEnv(name string) (*Window, error) {
+	size, ttl := os.Getenv("YOMO_DEDUP_SIZE"), os.Getenv("YOMO_DEDUP_TTL")
+	if size == "" && ttl == "" {
+		return nil, nil
+	}
+	var (
+		conf Config
+		err  error
+	)
+	if size != "" {
+		if conf.Size, err = strconv.Atoi(size); err != nil {
+			return nil, fmt.Errorf("dedup: invalid YOMO_DEDUP_SIZE %q", size)
+		}
+	}
+	if ttl != "" {
+		if conf.TTL, err = time.ParseDuration(ttl); err != nil {
+			return nil, fmt.Errorf("dedup: invalid YOMO_DEDUP_TTL %q", ttl)
+		}
+	}
+	return New(name, conf), nil
+}
+
+// Duplicate records the frame ID of the metadata, it returns true if the frame ID has been seen
+// in the window, then the frame should be dropped. The tag is the attribute of the metric.
+func (w *Window) Duplicate(tag uint32, md metadata.M) bool {
+	id, ok := md.Get(metadata.FrameIDKey)
+	if !ok || id == "" {
+		return false
+	}
+	if !w.seenBefore(id) {
+		return false
+	}
+	w.suppressed.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("name", w.name),
+		attribute.Int("tag", int(tag)),
+	))
+	return true
+}
+
+func (w *Window) seenBefore(id string) bool {
+	now := w.now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// forget the expired ones, the front is the oldest.
+	for elem := w.order.Front(); elem != nil; elem = w.order.Front() {
+		e := elem.Value.(*entry)
+		if now.Sub(e.seenAt) < w.ttl {
+			break
+		}
+		w.order.Remove(elem)
+		delete(w.seen, e.id)
+	}
+	if _, ok := w.seen[id]; ok {
+		return true
+	}
+
+	w.seen[id] = w.order.PushBack(&entry{id: id, seenAt: now})
+	if w.order.Len() > w.size {
+		oldest := w.order.Front()
+		w.order.Remove(oldest)
+		delete(w.seen, oldest.Value.(*entry).id)
+	}
+	return false
+}
+
+// Len returns the number of the frame IDs remembered.
+func (w *Window) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.order.Len()
+}
@@ -0,0 +1,53 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func frameMetadata(frameID string) metadata.M {
+	return metadata.M{metadata.FrameIDKey: frameID}
+}
+
+func TestWindow(t *testing.T) {
+	now := time.Unix(0, 0)
+	w := New("test", Config{Size: 2, TTL: time.Minute})
+	w.now = func() time.Time { return now }
+
+	// the frames without the frame id are never suppressed.
+	assert.False(t, w.Duplicate(1, metadata.M{}))
+	assert.False(t, w.Duplicate(1, metadata.M{}))
+
+	assert.False(t, w.Duplicate(1, frameMetadata("a")))
+	assert.True(t, w.Duplicate(1, frameMetadata("a")))
+
+	// the oldest frame id is forgotten if the size is exceeded.
+	assert.False(t, w.Duplicate(1, frameMetadata("b")))
+	assert.False(t, w.Duplicate(1, frameMetadata("c")))
+	assert.Equal(t, 2, w.Len())
+	assert.False(t, w.Duplicate(1, frameMetadata("a")))
+
+	// the frame ids are forgotten after the ttl.
+	now = now.Add(time.Minute)
+	assert.False(t, w.Duplicate(1, frameMetadata("c")))
+	assert.Equal(t, 1, w.Len())
+}
+
+func TestNewFromEnv(t *testing.T) {
+	w, err := NewFromEnv("sfn")
+	assert.NoError(t, err)
+	assert.Nil(t, w)
+
+	t.Setenv("YOMO_DEDUP_TTL", "5m")
+	w, err = NewFromEnv("sfn")
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, w.ttl)
+	assert.Equal(t, DefaultSize, w.size)
+
+	t.Setenv("YOMO_DEDUP_SIZE", "many")
+	_, err = NewFromEnv("sfn")
+	assert.EqualError(t, err, `dedup: invalid YOMO_DEDUP_SIZE "many"`)
+}
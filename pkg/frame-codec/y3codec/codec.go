@@ -3,10 +3,13 @@ package y3codec
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/yomorun/y3"
+	"github.com/yomorun/y3/encoding"
 	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/pkg/bufpool"
 )
 
 // ErrUnknownFrame is returned when unknown frame is received.
@@ -19,9 +22,53 @@ func PacketReadWriter() frame.PacketReadWriter {
 	return &packetReadWriter{}
 }
 
+// maxHeaderSize is the max size of the tag and the length of a y3 packet, the length is a 32-bit varint.
+const maxHeaderSize = 1 + 5
+
+// ReadPacket reads a packet into a buffer from bufpool, the caller owns the returned packet.
+// The caller can put the packet back to bufpool once nothing refers to it, including the frame decoded from it.
 func (pr *packetReadWriter) ReadPacket(stream io.Reader) (frame.Type, []byte, error) {
-	buf, err := y3.ReadPacket(stream)
-	if err != nil {
+	buf := bufpool.Get(maxHeaderSize)
+
+	// the tag and the length.
+	pos := 0
+	for {
+		if pos == maxHeaderSize {
+			bufpool.Put(buf)
+			return 0, nil, y3.ErrMalformed
+		}
+		if _, err := io.ReadFull(stream, buf[pos:pos+1]); err != nil {
+			bufpool.Put(buf)
+			return 0, nil, err
+		}
+		pos++
+		// the bytes after the tag are the varint length, its last byte has no continuation bit.
+		if pos > 1 && buf[pos-1]&0x80 != 0x80 {
+			break
+		}
+	}
+	var length int32
+	codec := encoding.VarCodec{}
+	if err := codec.DecodePVarInt32(buf[1:pos], &length); err != nil {
+		bufpool.Put(buf)
+		return 0, nil, y3.ErrMalformed
+	}
+	if length < 0 {
+		bufpool.Put(buf)
+		return 0, nil, fmt.Errorf("y3codec: invalid packet length %d", length)
+	}
+
+	// the value.
+	size := pos + int(length)
+	if size > cap(buf) {
+		larger := bufpool.Get(size)
+		copy(larger, buf[:pos])
+		bufpool.Put(buf)
+		buf = larger
+	}
+	buf = buf[:size]
+	if _, err := io.ReadFull(stream, buf[pos:]); err != nil {
+		bufpool.Put(buf)
 		return 0, nil, err
 	}
 	return frame.Type(buf[0] & 0x7F), buf, nil
@@ -37,6 +84,8 @@ type y3codec struct{}
 // Codec returns the y3 implement of frame.Codec.
 func Codec() frame.Codec { return &y3codec{} }
 
+// Encode encodes the frame, the DataFrame is encoded into a buffer from bufpool and the caller owns it,
+// the caller can put it back to bufpool after writing it.
 func (c *y3codec) Encode(f frame.Frame) ([]byte, error) {
 	switch ff := f.(type) {
 	case *frame.RejectedFrame:
@@ -56,6 +105,8 @@ func (c *y3codec) Encode(f frame.Frame) ([]byte, error) {
 	}
 }
 
+// Decode decodes the data to the frame, the Metadata and the Payload of the DataFrame refer to the data
+// without copying, so the data must not be reused while the frame is in use.
 func (c *y3codec) Decode(data []byte, f frame.Frame) error {
 	switch ff := f.(type) {
 	case *frame.RejectedFrame:
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/y3"
 	frame "github.com/yomorun/yomo/core/frame"
 )
 
@@ -92,6 +93,19 @@ func TestCodec(t *testing.T) {
 					0x64, 0x2d, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74},
 			},
 		},
+		{
+			name: "HandshakeFrame with topics",
+			args: args{
+				newF: new(frame.HandshakeFrame),
+				dataF: &frame.HandshakeFrame{
+					Name:          "a",
+					ObserveTopics: []string{"a/+", "#"},
+				},
+				data: []byte{0xb1, 0x1b, 0x1, 0x1, 0x61, 0x3, 0x0, 0x2, 0x1, 0x0,
+					0x6, 0x0, 0x4, 0x0, 0x5, 0x0, 0x7, 0x0, 0x9, 0x0, 0x8, 0x0,
+					0xa, 0x5, 0x61, 0x2f, 0x2b, 0x0, 0x23},
+			},
+		},
 		{
 			name: "HandshakeAckFrame",
 			args: args{
@@ -126,6 +140,19 @@ func TestCodec(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "GoawayFrame reconnect",
+			args: args{
+				newF: new(frame.GoawayFrame),
+				dataF: &frame.GoawayFrame{
+					Message:   "drain",
+					Reconnect: true,
+				},
+				data: []byte{
+					0xae, 0xa, 0x1, 0x5, 0x64, 0x72, 0x61, 0x69, 0x6e, 0x2, 0x1, 0x1,
+				},
+			},
+		},
 		{
 			name: "ConnectToFrame",
 			args: args{
@@ -166,3 +193,53 @@ func TestCodec(t *testing.T) {
 		})
 	}
 }
+
+func TestDataFrameCompatibility(t *testing.T) {
+	for _, size := range []int{0, 1, 127, 128, 16383, 16384, 1 << 20} {
+		df := &frame.DataFrame{
+			Tag:      uint32(size),
+			Metadata: bytes.Repeat([]byte("m"), size%300),
+			Payload:  bytes.Repeat([]byte("p"), size),
+		}
+
+		// the same bytes as the y3 encoders.
+		b, err := Codec().Encode(df)
+		assert.NoError(t, err)
+		assert.Equal(t, encodeDataFrameByY3(df), b)
+
+		// read from the stream.
+		ft, packet, err := PacketReadWriter().ReadPacket(bytes.NewReader(b))
+		assert.NoError(t, err)
+		assert.Equal(t, frame.TypeDataFrame, ft)
+		assert.Equal(t, b, packet)
+
+		got := new(frame.DataFrame)
+		assert.NoError(t, Codec().Decode(packet, got))
+		assert.Equal(t, df.Tag, got.Tag)
+		assert.Equal(t, len(df.Metadata), len(got.Metadata))
+		assert.Equal(t, df.Payload, append([]byte{}, got.Payload...))
+	}
+}
+
+func TestReadMalformedPacket(t *testing.T) {
+	_, _, err := PacketReadWriter().ReadPacket(bytes.NewReader([]byte{0xbf, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}))
+	assert.Equal(t, y3.ErrMalformed, err)
+
+	_, _, err = PacketReadWriter().ReadPacket(bytes.NewReader([]byte{0xbf, 0x05, 0x01}))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func encodeDataFrameByY3(f *frame.DataFrame) []byte {
+	tagBlock := y3.NewPrimitivePacketEncoder(tagDataFrameTag)
+	tagBlock.SetUInt32Value(f.Tag)
+	metadataBlock := y3.NewPrimitivePacketEncoder(tagDataFrameMetadata)
+	metadataBlock.SetBytesValue(f.Metadata)
+	payloadBlock := y3.NewPrimitivePacketEncoder(tagDataFramePayload)
+	payloadBlock.SetBytesValue(f.Payload)
+
+	data := y3.NewNodePacketEncoder(byte(f.Type()))
+	data.AddPrimitivePacket(tagBlock)
+	data.AddPrimitivePacket(metadataBlock)
+	data.AddPrimitivePacket(payloadBlock)
+	return data.Encode()
+}
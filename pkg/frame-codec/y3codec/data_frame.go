@@ -1,63 +1,116 @@
 package y3codec
 
 import (
-	"github.com/yomorun/y3"
+	"errors"
+	"fmt"
+
+	"github.com/yomorun/y3/encoding"
 	frame "github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/pkg/bufpool"
 )
 
-// encodeDataFrame returns Y3 encoded bytes of DataFrame.
+// encodeDataFrame returns Y3 encoded bytes of DataFrame, the bytes are in a buffer from bufpool.
+// It writes the same bytes as the y3 encoders, but without the intermediate buffers of every block.
 func encodeDataFrame(f *frame.DataFrame) ([]byte, error) {
+	tagSize := encoding.SizeOfNVarUInt32(f.Tag)
+	valSize := primitiveSize(tagSize) + primitiveSize(len(f.Metadata)) + primitiveSize(len(f.Payload))
+
+	buf := bufpool.Get(1 + pvarintSize(valSize) + valSize)
+
+	// data frame
+	pos := putHeader(buf, byte(f.Type())|0x80, valSize)
+
 	// tag
-	tagBlock := y3.NewPrimitivePacketEncoder(tagDataFrameTag)
-	tagBlock.SetUInt32Value(f.Tag)
+	pos += putHeader(buf[pos:], tagDataFrameTag, tagSize)
+	codec := encoding.VarCodec{Size: tagSize}
+	if err := codec.EncodeNVarUInt32(buf[pos:pos+tagSize], f.Tag); err != nil {
+		bufpool.Put(buf)
+		return nil, err
+	}
+	pos += tagSize
 
 	// metadata
-	metadataBlock := y3.NewPrimitivePacketEncoder(tagDataFrameMetadata)
-	metadataBlock.SetBytesValue(f.Metadata)
+	pos += putHeader(buf[pos:], tagDataFrameMetadata, len(f.Metadata))
+	pos += copy(buf[pos:], f.Metadata)
 
 	// payload
-	payloadBlock := y3.NewPrimitivePacketEncoder(tagDataFramePayload)
-	payloadBlock.SetBytesValue(f.Payload)
+	pos += putHeader(buf[pos:], tagDataFramePayload, len(f.Payload))
+	copy(buf[pos:], f.Payload)
 
-	// data frame
-	data := y3.NewNodePacketEncoder(byte(f.Type()))
-	data.AddPrimitivePacket(tagBlock)
-	data.AddPrimitivePacket(metadataBlock)
-	data.AddPrimitivePacket(payloadBlock)
-
-	return data.Encode(), nil
+	return buf, nil
 }
 
-// decodeDataFrame decode Y3 encoded bytes to `DataFrame`
+// decodeDataFrame decode Y3 encoded bytes to `DataFrame`,
+// the Metadata and the Payload refer to the data without copying.
 func decodeDataFrame(data []byte, f *frame.DataFrame) error {
-	packet := y3.NodePacket{}
-	_, err := y3.DecodeToNodePacket(data, &packet)
+	_, val, _, err := readBlock(data)
 	if err != nil {
 		return err
 	}
 
-	// tag
-	if tagBlock, ok := packet.PrimitivePackets[byte(tagDataFrameTag)]; ok {
-		tag, err := tagBlock.ToUInt32()
+	for len(val) > 0 {
+		tag, block, rest, err := readBlock(val)
 		if err != nil {
 			return err
 		}
-		f.Tag = tag
-	}
+		val = rest
 
-	// metadata
-	if metadataBlock, ok := packet.PrimitivePackets[byte(tagDataFrameMetadata)]; ok {
-		metadata := metadataBlock.ToBytes()
-		f.Metadata = metadata
+		switch tag & 0x3F {
+		case tagDataFrameTag:
+			var t uint32
+			codec := encoding.VarCodec{Size: len(block)}
+			if err := codec.DecodeNVarUInt32(block, &t); err != nil {
+				return err
+			}
+			f.Tag = t
+		case tagDataFrameMetadata:
+			f.Metadata = block
+		case tagDataFramePayload:
+			f.Payload = block
+		}
 	}
 
-	// payload
-	if payloadBlock, ok := packet.PrimitivePackets[byte(tagDataFramePayload)]; ok {
-		payload := payloadBlock.ToBytes()
-		f.Payload = payload
+	return nil
+}
+
+// readBlock reads a y3 block from the data, it returns the tag, the value and the rest of the data.
+func readBlock(data []byte) (tag byte, val []byte, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("y3codec: invalid y3 packet minimal size")
+	}
+	var length int32
+	codec := encoding.VarCodec{}
+	if err := codec.DecodePVarInt32(data[1:], &length); err != nil {
+		return 0, nil, nil, err
+	}
+	pos := 1 + codec.Size
+	end := pos + int(length)
+	if length < 0 || end > len(data) {
+		return 0, nil, nil, fmt.Errorf("y3codec: beyond the boundary, pos=%v, endPos=%v", pos, end)
+	}
+	if length == 0 {
+		return data[0], nil, data[end:], nil
 	}
+	return data[0], data[pos:end:end], data[end:], nil
+}
 
-	return nil
+// primitiveSize returns the size of a y3 primitive block with the value of the size.
+func primitiveSize(size int) int {
+	return 1 + pvarintSize(size) + size
+}
+
+func pvarintSize(v int) int {
+	return encoding.SizeOfPVarInt32(int32(v))
+}
+
+// putHeader writes the tag and the length of a y3 block, it returns the size written.
+func putHeader(buf []byte, tag byte, length int) int {
+	buf[0] = tag
+	size := pvarintSize(length)
+	codec := encoding.VarCodec{Size: size}
+	// the buffer is sized by pvarintSize, so encoding never fails.
+	_ = codec.EncodePVarInt32(buf[1:1+size], int32(length))
+	return 1 + size
 }
 
 var (
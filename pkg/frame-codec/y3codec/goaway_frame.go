@@ -13,6 +13,12 @@ func encodeGoawayFrame(f *frame.GoawayFrame) ([]byte, error) {
 	// frame
 	ff := y3.NewNodePacketEncoder(byte(f.Type()))
 	ff.AddPrimitivePacket(messageBlock)
+	// reconnect, it's omitted if false, so the frame is the same as the one of the old zippers
+	if f.Reconnect {
+		reconnectBlock := y3.NewPrimitivePacketEncoder(byte(tagGoawayReconnect))
+		reconnectBlock.SetBoolValue(f.Reconnect)
+		ff.AddPrimitivePacket(reconnectBlock)
+	}
 
 	return ff.Encode(), nil
 }
@@ -33,10 +39,19 @@ func decodeGoawayFrame(data []byte, f *frame.GoawayFrame) error {
 		}
 		f.Message = message
 	}
+	// reconnect
+	if reconnectBlock, ok := node.PrimitivePackets[tagGoawayReconnect]; ok {
+		reconnect, err := reconnectBlock.ToBool()
+		if err != nil {
+			return err
+		}
+		f.Reconnect = reconnect
+	}
 
 	return nil
 }
 
 var (
-	tagGoawayMessage byte = 0x01
+	tagGoawayMessage   byte = 0x01
+	tagGoawayReconnect byte = 0x02
 )
@@ -2,6 +2,7 @@ package y3codec
 
 import (
 	"encoding/binary"
+	"strings"
 
 	"github.com/yomorun/y3"
 	frame "github.com/yomorun/yomo/core/frame"
@@ -52,6 +53,12 @@ func encodeHandshakeFrame(f *frame.HandshakeFrame) ([]byte, error) {
 	handshake.AddPrimitivePacket(versionBlock)
 	handshake.AddPrimitivePacket(fdBlock)
 	handshake.AddPrimitivePacket(wantTargetBlock)
+	// observe topics, it's omitted if it's empty, so the frame is compatible with the old zippers.
+	if len(f.ObserveTopics) > 0 {
+		observeTopicsBlock := y3.NewPrimitivePacketEncoder(tagHandshakeObserveTopics)
+		observeTopicsBlock.SetStringValue(strings.Join(f.ObserveTopics, "\x00"))
+		handshake.AddPrimitivePacket(observeTopicsBlock)
+	}
 
 	return handshake.Encode(), nil
 }
@@ -131,6 +138,16 @@ func decodeHandshakeFrame(data []byte, f *frame.HandshakeFrame) error {
 		}
 		f.WantedTarget = wantTarget
 	}
+	// observe topics
+	if observeTopicsBlock, ok := node.PrimitivePackets[tagHandshakeObserveTopics]; ok {
+		observeTopics, err := observeTopicsBlock.ToUTF8String()
+		if err != nil {
+			return err
+		}
+		if observeTopics != "" {
+			f.ObserveTopics = strings.Split(observeTopics, "\x00")
+		}
+	}
 
 	return nil
 }
@@ -145,4 +162,5 @@ const (
 	tagHandshakeVersion            byte = 0x07
 	tagHandshakeWantedTarget       byte = 0x08
 	tagHandshakeFunctionDefinition byte = 0x09
+	tagHandshakeObserveTopics      byte = 0x0A
 )
@@ -0,0 +1,101 @@
+package yquic
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go"
+	"github.com/yomorun/yomo/core/frame"
+)
+
+// sharedConn is a QUIC connection shared by the FrameConns, it counts the streams opened or accepted on it.
+// The connection is closed when the last stream is closed.
+type sharedConn struct {
+	quic.Connection
+
+	mu   sync.Mutex
+	refs int
+	rtt  *atomic.Int64
+}
+
+func (c *sharedConn) openStream(ctx context.Context) (quic.Stream, error) {
+	stream, err := c.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.refs++
+	c.mu.Unlock()
+	return stream, nil
+}
+
+func (c *sharedConn) acceptStream(ctx context.Context) (quic.Stream, error) {
+	stream, err := c.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.refs++
+	c.mu.Unlock()
+	return stream, nil
+}
+
+// release releases a stream, it returns true if the stream is the last one.
+func (c *sharedConn) release() (last bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.refs--
+	return c.refs <= 0
+}
+
+// Mux shares the QUIC connections among the FrameConns dialed to the same address, each FrameConn is
+// carried by its own stream of the connection, so the clients in one process, such as dozens of
+// StreamFunctions, cut the connection count and the handshakes to the zipper.
+// The tls config and the quic config of the first dial are used by the shared connection.
+type Mux struct {
+	mu    sync.Mutex
+	conns map[string]*sharedConn
+}
+
+// NewMux returns a new Mux.
+func NewMux() *Mux {
+	return &Mux{conns: make(map[string]*sharedConn)}
+}
+
+// DefaultMux is the Mux shared by the clients in the process.
+var DefaultMux = NewMux()
+
+// DialAddr returns a new FrameConn upon a new stream of the connection to the address, the connection is
+// dialed if there is no connection or the connection has been closed.
+func (m *Mux) DialAddr(
+	ctx context.Context,
+	addr string,
+	codec frame.Codec, prw frame.PacketReadWriter,
+	tlsConfig *tls.Config, quicConfig *quic.Config,
+) (*FrameConn, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sconn, ok := m.conns[addr]
+	if ok && sconn.Context().Err() == nil {
+		if stream, err := sconn.openStream(ctx); err == nil {
+			return newFrameConn(sconn, stream, codec, prw), nil
+		}
+	}
+
+	qconn, err := quic.DialAddr(ctx, addr, tlsConfig, trackRTT(quicConfig))
+	if err != nil {
+		return nil, err
+	}
+	sconn = newSharedConn(qconn)
+	stream, err := sconn.openStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m.conns[addr] = sconn
+
+	return newFrameConn(sconn, stream, codec, prw), nil
+}
@@ -0,0 +1,65 @@
+package yquic
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/pkg/frame-codec/y3codec"
+	pkgtls "github.com/yomorun/yomo/pkg/tls"
+)
+
+func TestMux(t *testing.T) {
+	const addr = "localhost:9009"
+
+	listener, err := ListenAddr(addr, y3codec.Codec(), y3codec.PacketReadWriter(), pkgtls.MustCreateServerTLSConfig(addr), nil)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	mux := NewMux()
+	dial := func(name string) (*FrameConn, frame.Conn) {
+		fconn, err := mux.DialAddr(context.TODO(), addr,
+			y3codec.Codec(), y3codec.PacketReadWriter(),
+			pkgtls.MustCreateClientTLSConfig(), nil,
+		)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		assert.NoError(t, fconn.WriteFrame(&frame.HandshakeFrame{Name: name}))
+
+		accepted, err := listener.Accept(context.TODO())
+		assert.NoError(t, err)
+		f, err := accepted.ReadFrame()
+		assert.NoError(t, err)
+		assert.Equal(t, name, f.(*frame.HandshakeFrame).Name)
+
+		return fconn, accepted
+	}
+
+	sfn1, accepted1 := dial("sfn-1")
+	sfn2, accepted2 := dial("sfn-2")
+	assert.Same(t, sfn1.conn, sfn2.conn, "the sfns share one connection")
+
+	// closing a stream does not affect the other streams.
+	assert.NoError(t, accepted1.CloseWithError("goaway"))
+	_, err = sfn1.ReadFrame()
+	assert.Equal(t, frame.NewErrConnClosed(true, "yomo: stream closed"), err)
+	assert.Equal(t, frame.NewErrConnClosed(false, "goaway"), accepted1.WriteFrame(&frame.HandshakeAckFrame{}))
+
+	assert.NoError(t, accepted2.WriteFrame(&frame.HandshakeAckFrame{}))
+	f, err := sfn2.ReadFrame()
+	assert.NoError(t, err)
+	assert.Equal(t, frame.TypeHandshakeAckFrame, f.Type())
+
+	// closing the last stream closes the connection.
+	assert.NoError(t, sfn1.CloseWithError("bye"))
+	assert.NoError(t, sfn2.CloseWithError("bye"))
+	<-accepted2.Context().Done()
+	_, err = accepted2.ReadFrame()
+	assert.Equal(t, frame.NewErrConnClosed(true, "bye"), err)
+
+	// a new connection is dialed after the connection is closed.
+	sfn3, _ := dial("sfn-3")
+	assert.NotSame(t, sfn1.conn, sfn3.conn)
+}
@@ -1,23 +1,32 @@
 package yquic
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"errors"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/pkg/bufpool"
 )
 
 // FrameConn is an implements of FrameConn,
-// It transmits frames upon the first stream from a QUIC connection.
+// It transmits frames upon a stream from a QUIC connection, the QUIC connection may be shared by
+// several FrameConns, each of them is carried by its own stream.
 type FrameConn struct {
 	frameCh chan frame.Frame
-	conn    quic.Connection
+	conn    *sharedConn
 	stream  quic.Stream
 	codec   frame.Codec
 	prw     frame.PacketReadWriter
+
+	ctx       context.Context
+	ctxCancel context.CancelCauseFunc
+	closeOnce sync.Once
 }
 
 // DialAddr dials the given address and returns a new FrameConn.
@@ -27,30 +36,34 @@ func DialAddr(
 	codec frame.Codec, prw frame.PacketReadWriter,
 	tlsConfig *tls.Config, quicConfig *quic.Config,
 ) (*FrameConn, error) {
-	qconn, err := quic.DialAddr(ctx, addr, tlsConfig, quicConfig)
+	qconn, err := quic.DialAddr(ctx, addr, tlsConfig, trackRTT(quicConfig))
 	if err != nil {
 		return nil, err
 	}
 
-	stream, err := qconn.OpenStream()
+	sconn := newSharedConn(qconn)
+	stream, err := sconn.openStream(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return newFrameConn(qconn, stream, codec, prw), nil
+	return newFrameConn(sconn, stream, codec, prw), nil
 }
 
 func newFrameConn(
-	qconn quic.Connection, stream quic.Stream,
+	sconn *sharedConn, stream quic.Stream,
 	codec frame.Codec, prw frame.PacketReadWriter,
 ) *FrameConn {
+	ctx, ctxCancel := context.WithCancelCause(sconn.Context())
 
 	conn := &FrameConn{
-		frameCh: make(chan frame.Frame),
-		conn:    qconn,
-		stream:  stream,
-		codec:   codec,
-		prw:     prw,
+		frameCh:   make(chan frame.Frame),
+		conn:      sconn,
+		stream:    stream,
+		codec:     codec,
+		prw:       prw,
+		ctx:       ctx,
+		ctxCancel: ctxCancel,
 	}
 
 	return conn
@@ -58,7 +71,7 @@ func newFrameConn(
 
 // Context returns the context of the connection.
 func (p *FrameConn) Context() context.Context {
-	return p.conn.Context()
+	return p.ctx
 }
 
 // RemoteAddr returns the remote address of connection.
@@ -71,15 +84,41 @@ func (p *FrameConn) LocalAddr() net.Addr {
 	return p.conn.LocalAddr()
 }
 
+// RTT returns the smoothed round-trip time of the QUIC connection, it is 0 if it has not been measured.
+func (p *FrameConn) RTT() time.Duration {
+	return p.conn.RTT()
+}
+
 // CloseWithError closes the connection.
 // After calling CloseWithError, ReadFrame and WriteFrame will return frame.ErrConnClosed error.
+// If the QUIC connection is shared by the other FrameConns, only the stream of the FrameConn is closed.
 func (p *FrameConn) CloseWithError(errString string) error {
-	// _ = p.stream.Close()
+	var err error
+	p.closeOnce.Do(func() {
+		p.ctxCancel(frame.NewErrConnClosed(false, errString))
 
-	// After closing the quic connection, the stream will receive
-	// an quic.ApplicationError which error code is 0x13 (YomoCloseErrorCode).
-	// If ReadFrame and WriteFrame encounter this error, that means the connection is closed.
-	return p.conn.CloseWithError(YomoCloseErrorCode, errString)
+		if last := p.conn.release(); last {
+			// After closing the quic connection, the stream will receive
+			// an quic.ApplicationError which error code is 0x13 (YomoCloseErrorCode).
+			// If ReadFrame and WriteFrame encounter this error, that means the connection is closed.
+			err = p.conn.CloseWithError(YomoCloseErrorCode, errString)
+			return
+		}
+		// the stream is canceled with the error code 0x13 (YomoCloseErrorCode) as well.
+		p.stream.CancelRead(YomoStreamCloseErrorCode)
+		p.stream.CancelWrite(YomoStreamCloseErrorCode)
+	})
+	return err
+}
+
+func (p *FrameConn) handleError(err error) error {
+	if se := new(quic.StreamError); errors.As(err, &se) && se.ErrorCode == YomoStreamCloseErrorCode {
+		if !se.Remote {
+			return context.Cause(p.ctx)
+		}
+		return frame.NewErrConnClosed(true, "yomo: stream closed")
+	}
+	return handleError(err)
 }
 
 func handleError(err error) error {
@@ -101,15 +140,21 @@ func handleError(err error) error {
 func (p *FrameConn) ReadFrame() (frame.Frame, error) {
 	fType, b, err := p.prw.ReadPacket(p.stream)
 	if err != nil {
-		return nil, handleError(err)
+		return nil, p.handleError(err)
 	}
 	f, err := frame.NewFrame(fType)
 	if err != nil {
 		return nil, err
 	}
 	if err := p.codec.Decode(b, f); err != nil {
+		bufpool.Put(b)
 		return nil, err
 	}
+	// the DataFrame refers to the packet, so it owns the packet until it is released.
+	// the other frames are rare, they leave the packet to the GC.
+	if df, ok := f.(*frame.DataFrame); ok {
+		df.OwnPacket(b)
+	}
 	return f, nil
 }
 
@@ -119,17 +164,52 @@ func (p *FrameConn) WriteFrame(f frame.Frame) error {
 	if err != nil {
 		return err
 	}
-	if err := p.prw.WritePacket(p.stream, f.Type(), b); err != nil {
-		return handleError(err)
+	err = p.prw.WritePacket(p.stream, f.Type(), b)
+	// the stream does not retain the written bytes, so the encoded packet is put back to bufpool.
+	bufpool.Put(b)
+	if err != nil {
+		return p.handleError(err)
+	}
+	return nil
+}
+
+// WriteFrames writes the frames to connection in one stream write.
+func (p *FrameConn) WriteFrames(fs ...frame.Frame) error {
+	var buf bytes.Buffer
+	for _, f := range fs {
+		b, err := p.codec.Encode(f)
+		if err != nil {
+			return err
+		}
+		err = p.prw.WritePacket(&buf, f.Type(), b)
+		bufpool.Put(b)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := p.stream.Write(buf.Bytes()); err != nil {
+		return p.handleError(err)
 	}
 	return nil
 }
 
 // Listener listens a net.PacketConn and accepts connections.
+// Every stream of the accepted QUIC connections is accepted as a FrameConn, so the clients can share a
+// QUIC connection among several FrameConns.
 type Listener struct {
 	underlying *quic.Listener
 	codec      frame.Codec
 	prw        frame.PacketReadWriter
+
+	connCh chan *FrameConn
+	// done is closed with err when the listener fails to accept the connections.
+	done chan struct{}
+	err  error
+
+	// ctx is canceled by Close, which waits the goroutines accepting the connections and the streams by wg.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 // Listen returns a quic Listener that can accept connections.
@@ -138,17 +218,25 @@ func Listen(
 	codec frame.Codec, prw frame.PacketReadWriter,
 	tlsConfig *tls.Config, quicConfig *quic.Config,
 ) (*Listener, error) {
-	ql, err := quic.Listen(conn, tlsConfig, quicConfig)
+	ql, err := quic.Listen(conn, tlsConfig, trackRTT(quicConfig))
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	listener := &Listener{
 		underlying: ql,
 		codec:      codec,
 		prw:        prw,
+		connCh:     make(chan *FrameConn),
+		done:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 
+	listener.wg.Add(1)
+	go listener.acceptConns()
+
 	return listener, err
 }
 
@@ -170,26 +258,70 @@ func ListenAddr(
 	return Listen(conn, codec, prw, tlsConfig, quicConfig)
 }
 
-// Accept accepts FrameConns.
-func (listener *Listener) Accept(ctx context.Context) (frame.Conn, error) {
-	qconn, err := listener.underlying.Accept(ctx)
-	if err != nil {
-		return nil, err
+func (listener *Listener) acceptConns() {
+	defer listener.wg.Done()
+
+	for {
+		qconn, err := listener.underlying.Accept(listener.ctx)
+		if err != nil {
+			listener.err = err
+			close(listener.done)
+			return
+		}
+		listener.wg.Add(1)
+		go listener.acceptStreams(newSharedConn(qconn))
 	}
-	stream, err := qconn.AcceptStream(ctx)
-	if err != nil {
-		return nil, err
+}
+
+// acceptStreams accepts the streams of the connection until the connection or the listener is closed.
+func (listener *Listener) acceptStreams(sconn *sharedConn) {
+	defer listener.wg.Done()
+
+	ctx, cancel := context.WithCancel(listener.ctx)
+	defer cancel()
+	stop := context.AfterFunc(sconn.Context(), cancel)
+	defer stop()
+
+	for {
+		stream, err := sconn.acceptStream(ctx)
+		if err != nil {
+			return
+		}
+		fconn := newFrameConn(sconn, stream, listener.codec, listener.prw)
+		select {
+		case listener.connCh <- fconn:
+		case <-ctx.Done():
+			fconn.CloseWithError("yomo: listener closed")
+			return
+		}
 	}
+}
 
-	return newFrameConn(qconn, stream, listener.codec, listener.prw), nil
+// Accept accepts FrameConns.
+func (listener *Listener) Accept(ctx context.Context) (frame.Conn, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case fconn := <-listener.connCh:
+		return fconn, nil
+	case <-listener.done:
+		return nil, listener.err
+	}
 }
 
 // Close closes listener.
 // If listener be closed, all connection receive quic application error that code=0, message="".
+// It returns after the goroutines accepting the connections and the streams exit.
 func (listener *Listener) Close() error {
-	return listener.underlying.Close()
+	listener.cancel()
+	err := listener.underlying.Close()
+	listener.wg.Wait()
+	return err
 }
 
 // YomoCloseErrorCode is the error code for close quic Connection for yomo.
 // If the Connection implemented by quic is closed, the quic ApplicationErrorCode is always 0x13.
 const YomoCloseErrorCode = quic.ApplicationErrorCode(0x13)
+
+// YomoStreamCloseErrorCode is the error code for close a stream of the shared quic Connection for yomo.
+const YomoStreamCloseErrorCode = quic.StreamErrorCode(0x13)
@@ -35,6 +35,8 @@ func TestFrameConnection(t *testing.T) {
 
 	err = fconn.WriteFrame(&frame.HandshakeAckFrame{})
 	assert.NoError(t, err)
+	// the RTT is measured by the quic handshake.
+	assert.Greater(t, fconn.RTT(), time.Duration(0))
 
 	for {
 		f, err := fconn.ReadFrame()
@@ -63,10 +65,18 @@ func runListener(t *testing.T) error {
 	f, err := fconn.ReadFrame()
 	assert.NoError(t, err)
 	assert.Equal(t, f.Type(), frame.TypeHandshakeAckFrame)
+	assert.Greater(t, fconn.(frame.RTTConn).RTT(), time.Duration(0))
 
 	if err := fconn.WriteFrame(&frame.HandshakeFrame{Name: handshakeName}); err != nil {
 		return err
 	}
+	// the frames written in one batch are read one by one.
+	if err := fconn.(frame.BatchWriter).WriteFrames(
+		&frame.HandshakeFrame{Name: handshakeName},
+		&frame.HandshakeFrame{Name: handshakeName},
+	); err != nil {
+		return err
+	}
 
 	time.AfterFunc(time.Second, func() {
 		err := fconn.CloseWithError(CloseMessage)
@@ -84,3 +94,27 @@ func runListener(t *testing.T) error {
 
 	return nil
 }
+
+func TestListenerClose(t *testing.T) {
+	const addr = "localhost:9010"
+	listener, err := ListenAddr(addr, y3codec.Codec(), y3codec.PacketReadWriter(), pkgtls.MustCreateServerTLSConfig(addr), nil)
+	assert.NoError(t, err)
+
+	fconn, err := DialAddr(context.TODO(), addr, y3codec.Codec(), y3codec.PacketReadWriter(), pkgtls.MustCreateClientTLSConfig(), nil)
+	assert.NoError(t, err)
+	// the stream is accepted but never taken by Accept.
+	assert.NoError(t, fconn.WriteFrame(&frame.HandshakeAckFrame{}))
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error)
+	go func() { closed <- listener.Close() }()
+	select {
+	case err := <-closed:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("the listener is not closed")
+	}
+
+	_, err = listener.Accept(context.TODO())
+	assert.Error(t, err)
+}
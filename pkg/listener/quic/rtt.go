@@ -0,0 +1,74 @@
+package yquic
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+)
+
+// rtts holds the smoothed RTT of the QUIC connections in nanoseconds, the key is quic.ConnectionTracingID.
+// The RTT is updated by the tracer installed by trackRTT, and it's deleted when the connection is closed.
+var rtts sync.Map
+
+// trackRTT returns a copy of the quic config whose tracer records the RTT of the connections,
+// the tracer of the config is kept.
+func trackRTT(conf *quic.Config) *quic.Config {
+	if conf == nil {
+		conf = &quic.Config{}
+	} else {
+		conf = conf.Clone()
+	}
+	tracer := conf.Tracer
+	conf.Tracer = func(ctx context.Context, p logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
+		rt := rttTracer(ctx)
+		if tracer == nil {
+			return rt
+		}
+		if t := tracer(ctx, p, connID); t != nil {
+			return logging.NewMultiplexedConnectionTracer(t, rt)
+		}
+		return rt
+	}
+	return conf
+}
+
+func rttTracer(ctx context.Context) *logging.ConnectionTracer {
+	id, ok := ctx.Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
+	if !ok {
+		return &logging.ConnectionTracer{}
+	}
+	rtt := new(atomic.Int64)
+	rtts.Store(id, rtt)
+
+	return &logging.ConnectionTracer{
+		UpdatedMetrics: func(stats *logging.RTTStats, _, _ logging.ByteCount, _ int) {
+			rtt.Store(int64(stats.SmoothedRTT()))
+		},
+		Close: func() {
+			rtts.Delete(id)
+		},
+	}
+}
+
+// newSharedConn returns a new sharedConn of the QUIC connection, it's bound to the RTT of the connection.
+func newSharedConn(qconn quic.Connection) *sharedConn {
+	c := &sharedConn{Connection: qconn}
+	if id, ok := qconn.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID); ok {
+		if v, ok := rtts.Load(id); ok {
+			c.rtt = v.(*atomic.Int64)
+		}
+	}
+	return c
+}
+
+// RTT returns the smoothed RTT of the QUIC connection, it is 0 if the RTT has not been measured.
+func (c *sharedConn) RTT() time.Duration {
+	if c.rtt == nil {
+		return 0
+	}
+	return time.Duration(c.rtt.Load())
+}
@@ -0,0 +1,181 @@
+// Package redact scrubs the secrets, such as the api keys and the bearer tokens, from the logs and the traces.
+//
+// The values of the sensitive keys are replaced entirely, eg: api_key, token and authorization, and the secrets
+// embedded in the strings are found by the patterns, eg: the debug dumps of the LLM requests.
+package redact
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Placeholder replaces the redacted secrets.
+const Placeholder = "[REDACTED]"
+
+// Config is the config of the redaction, the patterns and keys are added to the built-in ones.
+// The config looks like:
+//
+//	redact:
+//		patterns:
+//			- 'acct-[0-9]{8}'
+//		keys: [x_internal_token]
+type Config struct {
+	// Patterns are the regular expressions of the secrets, the matches are replaced by the placeholder.
+	Patterns []string `yaml:"patterns"`
+	// Keys are the sensitive keys of the log attributes and span attributes, their values are replaced.
+	Keys []string `yaml:"keys"`
+}
+
+type rule struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// builtinRules are the well-known formats of the secrets.
+var builtinRules = []rule{
+	// key=value and key: value pairs, eg: the %+v dumps of the structs and the query strings
+	{regexp.MustCompile(`(?i)\b(api[_-]?key|access[_-]?token|token|password|secret|credential)(["']?\s*[:=]\s*["']?)[^\s"'&,;}\]]+`), "${1}${2}" + Placeholder},
+	// the authorization header
+	{regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9\-._~+/]+=*`), "${1} " + Placeholder},
+	// the api keys of OpenAI and the compatible services
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_\-]{16,}`), Placeholder},
+	// the access key id of AWS
+	{regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`), Placeholder},
+	// the api keys of Google
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`), Placeholder},
+	// JWT
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+`), Placeholder},
+}
+
+// builtinKeys are the normalized sensitive keys, see normalizeKey.
+var builtinKeys = []string{
+	"apikey", "accesskey", "secretkey", "secretaccesskey", "privatekey",
+	"token", "accesstoken", "authtoken", "refreshtoken", "idtoken",
+	"password", "passwd", "secret", "clientsecret",
+	"authorization", "credential", "cookie",
+}
+
+// Redactor redacts the secrets.
+type Redactor struct {
+	rules []rule
+	keys  map[string]bool
+}
+
+// New returns the redactor with the built-in rules and the config.
+func New(conf Config) (*Redactor, error) {
+	r := &Redactor{
+		rules: append([]rule{}, builtinRules...),
+		keys:  make(map[string]bool, len(builtinKeys)+len(conf.Keys)),
+	}
+	for _, pattern := range conf.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact: invalid pattern %s: %w", pattern, err)
+		}
+		r.rules = append(r.rules, rule{re: re, repl: Placeholder})
+	}
+	for _, key := range append(builtinKeys, conf.Keys...) {
+		r.keys[normalizeKey(key)] = true
+	}
+	return r, nil
+}
+
+var defaultRedactor atomic.Pointer[Redactor]
+
+func init() {
+	r, _ := New(Config{})
+	defaultRedactor.Store(r)
+}
+
+// Default returns the redactor used by the logs and the traces.
+func Default() *Redactor { return defaultRedactor.Load() }
+
+// SetDefault sets the redactor used by the logs and the traces.
+func SetDefault(r *Redactor) { defaultRedactor.Store(r) }
+
+// String redacts the secrets in s.
+func (r *Redactor) String(s string) string {
+	for _, rule := range r.rules {
+		s = rule.re.ReplaceAllString(s, rule.repl)
+	}
+	return s
+}
+
+// IsSensitiveKey reports whether the value of the key should be redacted entirely,
+// the last segment of the dotted keys is checked as well, eg: http.request.header.authorization.
+func (r *Redactor) IsSensitiveKey(key string) bool {
+	if i := strings.LastIndexByte(key, '.'); i >= 0 && r.keys[normalizeKey(key[i+1:])] {
+		return true
+	}
+	return r.keys[normalizeKey(key)]
+}
+
+// Attr redacts the log attribute, it can be used as the ReplaceAttr of slog.HandlerOptions.
+// The values which are not strings are formatted only if they contain the secrets.
+func (r *Redactor) Attr(a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		if r.IsSensitiveKey(a.Key) {
+			return slog.String(a.Key, Placeholder)
+		}
+		if s := a.Value.String(); s != "" {
+			a.Value = slog.StringValue(r.String(s))
+		}
+	case slog.KindAny:
+		if r.IsSensitiveKey(a.Key) {
+			return slog.String(a.Key, Placeholder)
+		}
+		var s string
+		if err, ok := a.Value.Any().(error); ok {
+			s = err.Error()
+		} else {
+			s = fmt.Sprintf("%+v", a.Value.Any())
+		}
+		if redacted := r.String(s); redacted != s {
+			a.Value = slog.StringValue(redacted)
+		}
+	}
+	return a
+}
+
+// KeyValue redacts the span attribute.
+func (r *Redactor) KeyValue(kv attribute.KeyValue) attribute.KeyValue {
+	switch kv.Value.Type() {
+	case attribute.STRING:
+		if r.IsSensitiveKey(string(kv.Key)) {
+			return kv.Key.String(Placeholder)
+		}
+		return kv.Key.String(r.String(kv.Value.AsString()))
+	case attribute.STRINGSLICE:
+		values := kv.Value.AsStringSlice()
+		for i, v := range values {
+			if r.IsSensitiveKey(string(kv.Key)) {
+				values[i] = Placeholder
+			} else {
+				values[i] = r.String(v)
+			}
+		}
+		return kv.Key.StringSlice(values)
+	}
+	return kv
+}
+
+// KeyValues redacts the span attributes.
+func (r *Redactor) KeyValues(kvs []attribute.KeyValue) []attribute.KeyValue {
+	redacted := make([]attribute.KeyValue, len(kvs))
+	for i, kv := range kvs {
+		redacted[i] = r.KeyValue(kv)
+	}
+	return redacted
+}
+
+// normalizeKey lowercases the key and removes the separators, so api_key, api-key and apiKey are the same key.
+func normalizeKey(key string) string {
+	key = strings.ToLower(key)
+	return strings.NewReplacer("_", "", "-", "", " ", "").Replace(key)
+}
@@ -0,0 +1,166 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// AWSResolver resolves the secrets of AWS Secrets Manager, the path of the reference is the secret id or arn,
+// the region is read from the region query of the reference.
+type AWSResolver struct {
+	// Region is the default region.
+	Region string
+	// AccessKeyID is the aws access key id.
+	AccessKeyID string
+	// SecretAccessKey is the aws secret access key.
+	SecretAccessKey string
+	// SessionToken is the aws session token, it is optional.
+	SessionToken string
+	// Endpoint overrides the endpoint of Secrets Manager, eg: http://localhost:4566
+	Endpoint string
+
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewAWSResolver returns the aws resolver configured by the AWS_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN and AWS_ENDPOINT_URL_SECRETS_MANAGER env.
+func NewAWSResolver() (*AWSResolver, error) {
+	r := &AWSResolver{
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER"),
+		client:          &http.Client{Timeout: 10 * time.Second},
+		now:             time.Now,
+	}
+	if r.Region == "" {
+		r.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if r.AccessKeyID == "" || r.SecretAccessKey == "" {
+		return nil, errors.New("secret: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required by aws-sm")
+	}
+	return r, nil
+}
+
+// Resolve returns the SecretString of the secret.
+func (r *AWSResolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	region := ref.Query.Get("region")
+	if region == "" {
+		region = r.Region
+	}
+	if region == "" {
+		return "", errors.New("the region is required")
+	}
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+
+	body, _ := json.Marshal(map[string]string{"SecretId": ref.Path})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	r.sign(req, body, region, "secretsmanager")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("aws secrets manager responds %s", resp.Status)
+	}
+
+	var secret struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+	if secret.SecretString == nil {
+		return "", errors.New("the binary secret is not supported")
+	}
+	return *secret.SecretString, nil
+}
+
+// sign signs the request by the aws signature version 4,
+// see https://docs.aws.amazon.com/IAM/latest/UserGuide/create-signed-request.html
+func (r *AWSResolver) sign(req *http.Request, body []byte, region, service string) {
+	t := r.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if r.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", r.SessionToken)
+	}
+
+	names := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	if r.SessionToken != "" {
+		names = append(names, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+r.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		r.AccessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func canonicalURI(u *url.URL) string {
+	if p := u.EscapedPath(); p != "" {
+		return p
+	}
+	return "/"
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
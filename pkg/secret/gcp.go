@@ -0,0 +1,112 @@
+package secret
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// GCPResolver resolves the secrets of GCP Secret Manager, the path of the reference is the resource name
+// of the secret, eg: projects/my-project/secrets/openai-api-key, the latest version is used if the version
+// is not specified.
+type GCPResolver struct {
+	// AccessToken is the oauth2 access token, the token of the default service account is fetched from the
+	// metadata server if it is empty.
+	AccessToken string
+	// Endpoint is the endpoint of Secret Manager.
+	Endpoint string
+	// MetadataEndpoint is the endpoint of the metadata server.
+	MetadataEndpoint string
+
+	client *http.Client
+}
+
+// NewGCPResolver returns the gcp resolver, the access token is read from the GOOGLE_OAUTH_ACCESS_TOKEN env,
+// or fetched from the metadata server when running on GCP.
+func NewGCPResolver() (*GCPResolver, error) {
+	return &GCPResolver{
+		AccessToken:      os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+		Endpoint:         "https://secretmanager.googleapis.com",
+		MetadataEndpoint: "http://metadata.google.internal",
+		client:           &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Resolve returns the payload of the secret version.
+func (r *GCPResolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	name := strings.Trim(ref.Path, "/")
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	token, err := r.accessToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Endpoint+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gcp secret manager responds %s", resp.Status)
+	}
+
+	var body struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(body.Payload.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (r *GCPResolver) accessToken(ctx context.Context) (string, error) {
+	if r.AccessToken != "" {
+		return r.AccessToken, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		r.MetadataEndpoint+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetch the access token from the metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if body.AccessToken == "" {
+		return "", errors.New("the metadata server returns no access token")
+	}
+	return body.AccessToken, nil
+}
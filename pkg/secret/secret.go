@@ -0,0 +1,161 @@
+// Package secret resolves the secret references, so the secrets like the api keys of the llm providers
+// are kept in the secret backends instead of the plaintext config files.
+//
+// A secret reference looks like:
+//
+//	vault://secret/data/yomo/openai#api_key              HashiCorp Vault, the key api_key of the secret at /v1/secret/data/yomo/openai
+//	aws-sm://yomo/openai?region=us-east-1#api_key        AWS Secrets Manager, the key api_key of the json secret yomo/openai
+//	gcp-sm://projects/my-project/secrets/openai-api-key  GCP Secret Manager, the latest version of the secret
+//
+// The fragment is the key of the json secret, the whole secret is used if the fragment is empty.
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Resolver resolves the secret references of a secret backend.
+type Resolver interface {
+	// Resolve returns the secret of the reference.
+	Resolve(ctx context.Context, ref Ref) (string, error)
+}
+
+// Ref is a parsed secret reference.
+type Ref struct {
+	// Scheme is the secret backend, eg: vault, aws-sm, gcp-sm.
+	Scheme string
+	// Path is the path of the secret in the backend.
+	Path string
+	// Query is the options of the reference.
+	Query url.Values
+	// Key is the key of the json secret, it is empty if the whole secret is used.
+	Key string
+}
+
+func (r Ref) String() string {
+	s := r.Scheme + "://" + r.Path
+	if len(r.Query) > 0 {
+		s += "?" + r.Query.Encode()
+	}
+	if r.Key != "" {
+		s += "#" + r.Key
+	}
+	return s
+}
+
+var (
+	mu        sync.Mutex
+	resolvers = map[string]func() (Resolver, error){
+		"vault":  func() (Resolver, error) { return NewVaultResolver() },
+		"aws-sm": func() (Resolver, error) { return NewAWSResolver() },
+		"gcp-sm": func() (Resolver, error) { return NewGCPResolver() },
+	}
+	instances = map[string]Resolver{}
+)
+
+// RegisterResolver registers the resolver of the scheme, it replaces the builtin resolver of the scheme.
+func RegisterResolver(scheme string, resolver Resolver) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	resolvers[scheme] = func() (Resolver, error) { return resolver, nil }
+	delete(instances, scheme)
+}
+
+// ParseRef parses the secret reference, ok is false if the value is not a secret reference.
+func ParseRef(value string) (ref Ref, ok bool) {
+	scheme, rest, found := strings.Cut(value, "://")
+	if !found {
+		return Ref{}, false
+	}
+	mu.Lock()
+	_, ok = resolvers[scheme]
+	mu.Unlock()
+	if !ok {
+		return Ref{}, false
+	}
+
+	ref = Ref{Scheme: scheme}
+	rest, ref.Key, _ = strings.Cut(rest, "#")
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	ref.Path = rest
+	ref.Query, _ = url.ParseQuery(rawQuery)
+
+	return ref, true
+}
+
+// IsRef reports whether the value is a secret reference.
+func IsRef(value string) bool {
+	_, ok := ParseRef(value)
+	return ok
+}
+
+// Resolve resolves the value if it is a secret reference, otherwise the value is returned as it is.
+func Resolve(ctx context.Context, value string) (string, error) {
+	ref, ok := ParseRef(value)
+	if !ok {
+		return value, nil
+	}
+	resolver, err := getResolver(ref.Scheme)
+	if err != nil {
+		return "", err
+	}
+	secret, err := resolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("secret: resolve %s: %w", ref, err)
+	}
+	if ref.Key == "" {
+		return secret, nil
+	}
+	return jsonKey(secret, ref.Key)
+}
+
+// ResolveMap resolves all the secret references in the map, the map is not modified.
+func ResolveMap(ctx context.Context, m map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(m))
+	for k, v := range m {
+		secret, err := Resolve(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		resolved[k] = secret
+	}
+	return resolved, nil
+}
+
+func getResolver(scheme string) (Resolver, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if r, ok := instances[scheme]; ok {
+		return r, nil
+	}
+	r, err := resolvers[scheme]()
+	if err != nil {
+		return nil, err
+	}
+	instances[scheme] = r
+	return r, nil
+}
+
+func jsonKey(secret, key string) (string, error) {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(secret), &m); err != nil {
+		return "", errors.New("secret: the secret is not a json object")
+	}
+	v, ok := m[key]
+	if !ok {
+		return "", fmt.Errorf("secret: the key %s is not found in the secret", key)
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, _ := json.Marshal(v)
+	return string(b), nil
+}
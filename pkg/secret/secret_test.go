@@ -0,0 +1,156 @@
+package secret
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   Ref
+		wantOK bool
+	}{
+		{value: "sk-plaintext"},
+		{value: "https://api.openai.com/v1"},
+		{
+			value:  "vault://secret/data/yomo/openai#api_key",
+			want:   Ref{Scheme: "vault", Path: "secret/data/yomo/openai", Query: url.Values{}, Key: "api_key"},
+			wantOK: true,
+		},
+		{
+			value:  "aws-sm://arn:aws:secretsmanager:us-east-1:123456789012:secret:yomo?region=us-east-1",
+			want:   Ref{Scheme: "aws-sm", Path: "arn:aws:secretsmanager:us-east-1:123456789012:secret:yomo", Query: url.Values{"region": {"us-east-1"}}},
+			wantOK: true,
+		},
+		{
+			value:  "gcp-sm://projects/yomo/secrets/openai",
+			want:   Ref{Scheme: "gcp-sm", Path: "projects/yomo/secrets/openai", Query: url.Values{}},
+			wantOK: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := ParseRef(tt.value)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVaultResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "vault-token", r.Header.Get("X-Vault-Token"))
+		switch r.URL.Path {
+		case "/v1/secret/data/yomo/openai":
+			w.Write([]byte(`{"data":{"data":{"api_key":"sk-v2"},"metadata":{"version":3}}}`))
+		case "/v1/kv/yomo/openai":
+			w.Write([]byte(`{"data":{"api_key":"sk-v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	resolver, err := NewVaultResolver()
+	assert.NoError(t, err)
+	RegisterResolver("vault", resolver)
+
+	secret, err := Resolve(context.Background(), "vault://secret/data/yomo/openai#api_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-v2", secret)
+
+	secret, err = Resolve(context.Background(), "vault://kv/yomo/openai#api_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-v1", secret)
+
+	_, err = Resolve(context.Background(), "vault://secret/data/yomo/unknown#api_key")
+	assert.ErrorContains(t, err, "404")
+
+	_, err = Resolve(context.Background(), "vault://secret/data/yomo/openai#api_kye")
+	assert.ErrorContains(t, err, "the key api_kye is not found")
+}
+
+func TestAWSResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "20240102T030405Z", r.Header.Get("X-Amz-Date"))
+		assert.True(t, strings.HasPrefix(
+			r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKID/20240102/ap-east-1/secretsmanager/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature=",
+		))
+
+		var req map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "yomo/openai", req["SecretId"])
+		w.Write([]byte(`{"Name":"yomo/openai","SecretString":"{\"api_key\":\"sk-aws\"}"}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "SECRET")
+	t.Setenv("AWS_ENDPOINT_URL_SECRETS_MANAGER", server.URL)
+	resolver, err := NewAWSResolver()
+	assert.NoError(t, err)
+	resolver.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	RegisterResolver("aws-sm", resolver)
+
+	secret, err := Resolve(context.Background(), "aws-sm://yomo/openai?region=ap-east-1#api_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-aws", secret)
+
+	_, err = Resolve(context.Background(), "aws-sm://yomo/openai#api_key")
+	assert.ErrorContains(t, err, "the region is required")
+}
+
+func TestGCPResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/service-accounts/default/token":
+			assert.Equal(t, "Google", r.Header.Get("Metadata-Flavor"))
+			w.Write([]byte(`{"access_token":"gcp-token","expires_in":3599,"token_type":"Bearer"}`))
+		case "/v1/projects/yomo/secrets/openai/versions/latest:access":
+			assert.Equal(t, "Bearer gcp-token", r.Header.Get("Authorization"))
+			json.NewEncoder(w).Encode(map[string]any{
+				"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("sk-gcp"))},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	RegisterResolver("gcp-sm", &GCPResolver{Endpoint: server.URL, MetadataEndpoint: server.URL, client: server.Client()})
+
+	secret, err := Resolve(context.Background(), "gcp-sm://projects/yomo/secrets/openai")
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-gcp", secret)
+}
+
+func TestResolveMap(t *testing.T) {
+	RegisterResolver("test", resolverFunc(func(_ context.Context, ref Ref) (string, error) {
+		return "secret-of-" + ref.Path, nil
+	}))
+
+	conf := map[string]string{"api_key": "test://openai", "model": "gpt-4o"}
+	resolved, err := ResolveMap(context.Background(), conf)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"api_key": "secret-of-openai", "model": "gpt-4o"}, resolved)
+	assert.Equal(t, "test://openai", conf["api_key"], "the config is not modified")
+}
+
+type resolverFunc func(context.Context, Ref) (string, error)
+
+func (f resolverFunc) Resolve(ctx context.Context, ref Ref) (string, error) { return f(ctx, ref) }
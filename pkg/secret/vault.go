@@ -0,0 +1,77 @@
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultResolver resolves the secrets of HashiCorp Vault by the http api, the path of the reference is
+// the api path without /v1, eg: secret/data/yomo/openai for the kv v2 secret engine mounted at secret/.
+type VaultResolver struct {
+	// Addr is the address of vault, eg: https://vault:8200
+	Addr string
+	// Token is the vault token.
+	Token string
+	// Namespace is the vault enterprise namespace, it is optional.
+	Namespace string
+
+	client *http.Client
+}
+
+// NewVaultResolver returns the vault resolver configured by the VAULT_ADDR, VAULT_TOKEN and VAULT_NAMESPACE env.
+func NewVaultResolver() (*VaultResolver, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = "http://127.0.0.1:8200"
+	}
+	return &VaultResolver{
+		Addr:      strings.TrimSuffix(addr, "/"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Resolve returns the data of the secret as a json object.
+func (r *VaultResolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.Addr+"/v1/"+strings.TrimPrefix(ref.Path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.Token != "" {
+		req.Header.Set("X-Vault-Token", r.Token)
+	}
+	if r.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.Namespace)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault responds %s", resp.Status)
+	}
+
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	// the kv v2 secret engine wraps the secret in data.data.
+	if data, ok := body.Data["data"]; ok {
+		if _, ok := body.Data["metadata"]; ok {
+			return string(data), nil
+		}
+	}
+	b, err := json.Marshal(body.Data)
+	return string(b), err
+}
@@ -0,0 +1,224 @@
+// Package signature signs and verifies the payloads of the DataFrames with the per-client keys,
+// so the spoofed frames injected by a compromised network segment are rejected.
+//
+// The signature covers the tag, the tid, the target and the payload of the frame, it is carried by the
+// reserved metadata keys `yomo-signature` and `yomo-signature-key-id`. The other metadata is not signed,
+// because the zipper merges the connection metadata into the frame metadata when routing.
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+// The supported algorithms.
+const (
+	// HMACSHA256 signs with a secret shared by the client and the verifiers.
+	HMACSHA256 = "hmac-sha256"
+	// Ed25519 signs with the private key of the client, the verifiers only hold the public key.
+	Ed25519 = "ed25519"
+)
+
+var (
+	// ErrUnsigned is returned when the frame is not signed and the signature is required.
+	ErrUnsigned = errors.New("signature: the frame is not signed")
+	// ErrInvalidSignature is returned when the signature does not match the frame.
+	ErrInvalidSignature = errors.New("signature: invalid signature")
+)
+
+// Key is the key of a client, the key is base64 encoded. The HMAC key is the shared secret, the Ed25519 key
+// is the private key (or the seed) for signing and the public key for verifying.
+type Key struct {
+	// Algorithm is hmac-sha256 or ed25519, the default is hmac-sha256.
+	Algorithm string `yaml:"algorithm"`
+	// Key is the base64 encoded key.
+	Key string `yaml:"key"`
+}
+
+// Config is the config of verifying the frames at the zipper, the config looks like:
+//
+//	signature:
+//		required: true
+//		keys:
+//			source-a:
+//				algorithm: hmac-sha256
+//				key: c2VjcmV0LW9mLXNvdXJjZS1hLTMyLWJ5dGVzLWxvbmc=
+//			sfn-b:
+//				algorithm: ed25519
+//				key: <the public key of sfn-b>
+type Config struct {
+	// Required rejects the unsigned frames, otherwise only the signed frames are verified.
+	Required bool `yaml:"required"`
+	// Keys are the keys of the clients, the map key is the key id.
+	Keys map[string]Key `yaml:"keys"`
+}
+
+// Signer signs the DataFrames with the key of the client.
+type Signer struct {
+	id   string
+	sign func(msg []byte) []byte
+}
+
+// NewSigner returns the signer of the key, id is the key id known by the verifiers.
+func NewSigner(id string, key Key) (*Signer, error) {
+	if id == "" {
+		return nil, errors.New("signature: the key id is required")
+	}
+	raw, err := decodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Signer{id: id}
+	switch algorithm(key) {
+	case HMACSHA256:
+		if len(raw) < 16 {
+			return nil, errors.New("signature: the hmac key must be at least 16 bytes")
+		}
+		s.sign = func(msg []byte) []byte {
+			mac := hmac.New(sha256.New, raw)
+			mac.Write(msg)
+			return mac.Sum(nil)
+		}
+	case Ed25519:
+		var priv ed25519.PrivateKey
+		switch len(raw) {
+		case ed25519.SeedSize:
+			priv = ed25519.NewKeyFromSeed(raw)
+		case ed25519.PrivateKeySize:
+			priv = ed25519.PrivateKey(raw)
+		default:
+			return nil, fmt.Errorf("signature: invalid ed25519 private key size %d", len(raw))
+		}
+		s.sign = func(msg []byte) []byte { return ed25519.Sign(priv, msg) }
+	default:
+		return nil, fmt.Errorf("signature: unsupported algorithm %s", key.Algorithm)
+	}
+	return s, nil
+}
+
+// NewSignerFromEnv returns the signer configured by the environment variables YOMO_SIGNING_KEY_ID,
+// YOMO_SIGNING_KEY and YOMO_SIGNING_ALGORITHM, it returns nil if the key is not set.
+func NewSignerFromEnv() (*Signer, error) {
+	id, key := os.Getenv("YOMO_SIGNING_KEY_ID"), os.Getenv("YOMO_SIGNING_KEY")
+	if id == "" || key == "" {
+		return nil, nil
+	}
+	return NewSigner(id, Key{Algorithm: os.Getenv("YOMO_SIGNING_ALGORITHM"), Key: key})
+}
+
+// KeyID returns the key id of the signer.
+func (s *Signer) KeyID() string { return s.id }
+
+// Sign signs the frame, the signature replaces the one in the metadata if any.
+func (s *Signer) Sign(f *frame.DataFrame) error {
+	md, err := metadata.Decode(f.Metadata)
+	if err != nil {
+		return err
+	}
+	md.Set(metadata.SignatureKeyIDKey, s.id)
+	md.Set(metadata.SignatureKey, base64.StdEncoding.EncodeToString(s.sign(message(f.Tag, md, f.Payload))))
+
+	mdBytes, err := md.Encode()
+	if err != nil {
+		return err
+	}
+	f.Metadata = mdBytes
+	return nil
+}
+
+// Verifier verifies the DataFrames with the keys of the clients.
+type Verifier struct {
+	required bool
+	keys     map[string]func(msg, sig []byte) bool
+}
+
+// NewVerifier returns the verifier of the config.
+func NewVerifier(conf Config) (*Verifier, error) {
+	v := &Verifier{required: conf.Required, keys: make(map[string]func(msg, sig []byte) bool, len(conf.Keys))}
+
+	for id, key := range conf.Keys {
+		raw, err := decodeKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, id)
+		}
+		switch algorithm(key) {
+		case HMACSHA256:
+			v.keys[id] = func(msg, sig []byte) bool {
+				mac := hmac.New(sha256.New, raw)
+				mac.Write(msg)
+				return hmac.Equal(mac.Sum(nil), sig)
+			}
+		case Ed25519:
+			if len(raw) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("signature: invalid ed25519 public key size %d: %s", len(raw), id)
+			}
+			pub := ed25519.PublicKey(raw)
+			v.keys[id] = func(msg, sig []byte) bool { return ed25519.Verify(pub, msg, sig) }
+		default:
+			return nil, fmt.Errorf("signature: unsupported algorithm %s: %s", key.Algorithm, id)
+		}
+	}
+	return v, nil
+}
+
+// Verify verifies the frame by its decoded metadata. It returns ErrUnsigned if the frame is not signed
+// and the signature is required, and ErrInvalidSignature if the key is unknown or the signature does not match.
+func (v *Verifier) Verify(f *frame.DataFrame, md metadata.M) error {
+	id, _ := md.Get(metadata.SignatureKeyIDKey)
+	encoded, _ := md.Get(metadata.SignatureKey)
+	if id == "" && encoded == "" {
+		if v.required {
+			return ErrUnsigned
+		}
+		return nil
+	}
+
+	verify, ok := v.keys[id]
+	if !ok {
+		return fmt.Errorf("%w: unknown key id %s", ErrInvalidSignature, id)
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !verify(message(f.Tag, md, f.Payload), sig) {
+		return fmt.Errorf("%w: key id %s", ErrInvalidSignature, id)
+	}
+	return nil
+}
+
+// message returns the signed message, each field is prefixed with its length to avoid the ambiguity.
+func message(tag frame.Tag, md metadata.M, payload []byte) []byte {
+	tid, _ := md.Get(metadata.TIDKey)
+	target, _ := md.Get(metadata.TargetKey)
+
+	msg := make([]byte, 0, 4+4+len(tid)+4+len(target)+4+len(payload))
+	msg = binary.BigEndian.AppendUint32(msg, tag)
+	for _, field := range [][]byte{[]byte(tid), []byte(target), payload} {
+		msg = binary.BigEndian.AppendUint32(msg, uint32(len(field)))
+		msg = append(msg, field...)
+	}
+	return msg
+}
+
+func algorithm(key Key) string {
+	if key.Algorithm == "" {
+		return HMACSHA256
+	}
+	return key.Algorithm
+}
+
+func decodeKey(key Key) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(key.Key)
+	if err != nil {
+		return nil, fmt.Errorf("signature: the key is not base64 encoded: %w", err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,103 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/core/metadata"
+)
+
+func newFrame(t *testing.T, payload string) *frame.DataFrame {
+	md, err := metadata.M{metadata.TIDKey: "tid-1"}.Encode()
+	assert.NoError(t, err)
+	return &frame.DataFrame{Tag: 0x33, Metadata: md, Payload: []byte(payload)}
+}
+
+func verify(t *testing.T, v *Verifier, f *frame.DataFrame) error {
+	md, err := metadata.Decode(f.Metadata)
+	assert.NoError(t, err)
+	return v.Verify(f, md)
+}
+
+func TestSignature(t *testing.T) {
+	hmacKey := base64.StdEncoding.EncodeToString([]byte("secret-of-source-a-32-bytes-long"))
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	hmacSigner, err := NewSigner("source-a", Key{Key: hmacKey})
+	assert.NoError(t, err)
+	ed25519Signer, err := NewSigner("sfn-b", Key{Algorithm: Ed25519, Key: base64.StdEncoding.EncodeToString(priv.Seed())})
+	assert.NoError(t, err)
+	unknownSigner, err := NewSigner("source-c", Key{Key: hmacKey})
+	assert.NoError(t, err)
+
+	conf := Config{
+		Keys: map[string]Key{
+			"source-a": {Algorithm: HMACSHA256, Key: hmacKey},
+			"sfn-b":    {Algorithm: Ed25519, Key: base64.StdEncoding.EncodeToString(pub)},
+		},
+	}
+	optional, err := NewVerifier(conf)
+	assert.NoError(t, err)
+	conf.Required = true
+	required, err := NewVerifier(conf)
+	assert.NoError(t, err)
+
+	t.Run("hmac", func(t *testing.T) {
+		f := newFrame(t, "hello")
+		assert.NoError(t, hmacSigner.Sign(f))
+		assert.NoError(t, verify(t, required, f))
+
+		f.Payload = []byte("hellO")
+		assert.ErrorIs(t, verify(t, optional, f), ErrInvalidSignature)
+	})
+
+	t.Run("ed25519", func(t *testing.T) {
+		f := newFrame(t, "hello")
+		assert.NoError(t, ed25519Signer.Sign(f))
+		assert.NoError(t, verify(t, required, f))
+
+		f.Tag = 0x34
+		assert.ErrorIs(t, verify(t, optional, f), ErrInvalidSignature)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		f := newFrame(t, "hello")
+		assert.NoError(t, unknownSigner.Sign(f))
+		assert.ErrorIs(t, verify(t, optional, f), ErrInvalidSignature)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		f := newFrame(t, "hello")
+		assert.NoError(t, verify(t, optional, f))
+		assert.ErrorIs(t, verify(t, required, f), ErrUnsigned)
+	})
+
+	t.Run("resign", func(t *testing.T) {
+		f := newFrame(t, "hello")
+		assert.NoError(t, hmacSigner.Sign(f))
+		assert.NoError(t, ed25519Signer.Sign(f))
+
+		md, err := metadata.Decode(f.Metadata)
+		assert.NoError(t, err)
+		assert.Equal(t, "sfn-b", md[metadata.SignatureKeyIDKey])
+		assert.NoError(t, required.Verify(f, md))
+	})
+}
+
+func TestInvalidKey(t *testing.T) {
+	_, err := NewSigner("source-a", Key{Key: base64.StdEncoding.EncodeToString([]byte("short"))})
+	assert.ErrorContains(t, err, "at least 16 bytes")
+
+	_, err = NewSigner("source-a", Key{Algorithm: "rsa", Key: "c2VjcmV0"})
+	assert.ErrorContains(t, err, "unsupported algorithm rsa")
+
+	_, err = NewVerifier(Config{Keys: map[string]Key{"sfn-b": {Algorithm: Ed25519, Key: "c2VjcmV0"}}})
+	assert.ErrorContains(t, err, "invalid ed25519 public key size")
+
+	_, err = NewVerifier(Config{Keys: map[string]Key{"sfn-b": {Key: "not base64"}}})
+	assert.ErrorContains(t, err, "not base64 encoded")
+}
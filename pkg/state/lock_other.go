@@ -0,0 +1,32 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package state
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// staleLockAge is the age of the lock file which is considered left by a crashed process.
+const staleLockAge = 10 * time.Second
+
+// lockFile locks the file by creating it exclusively, it polls until the lock is acquired. The lock
+// is released by unlock, the lock file older than staleLockAge is removed.
+func lockFile(path string) (unlock func(), err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,240 @@
+package state
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yomorun/yomo/serverless"
+)
+
+var _ serverless.State = (*RedisStore)(nil)
+
+// RedisKeyPrefix is the prefix of the redis keys of the states, the state of a sfn is the hash
+// named by RedisKeyPrefix and the sfn name.
+const RedisKeyPrefix = "yomo:state:"
+
+// redisTimeout is the timeout of dialing and every command of the redis.
+const redisTimeout = 5 * time.Second
+
+// RedisStore persists the state of a sfn to a hash of the redis, the keys of the state are the fields
+// of the hash, so the instances of the sfn share the state.
+type RedisStore struct {
+	client *RedisClient
+	key    string
+}
+
+// NewRedisStore returns the redis store of the url for the sfn, the url looks like
+// redis://[[username]:password@]host[:port][/db]. The redis is dialed on the first access.
+func NewRedisStore(rawURL, name string) (*RedisStore, error) {
+	client, err := NewRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client, key: RedisKeyPrefix + name}, nil
+}
+
+// Get returns the value of the key, ok is false if the key does not exist.
+func (s *RedisStore) Get(key string) ([]byte, bool, error) {
+	reply, err := s.client.Do("HGET", s.key, key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("state: unexpected redis reply %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set sets the value of the key.
+func (s *RedisStore) Set(key string, value []byte) error {
+	if key == "" {
+		return errors.New("state: key is empty")
+	}
+	_, err := s.client.Do("HSET", s.key, key, string(value))
+	return err
+}
+
+// Delete deletes the key.
+func (s *RedisStore) Delete(key string) error {
+	_, err := s.client.Do("HDEL", s.key, key)
+	return err
+}
+
+// Close closes the connection of the redis.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// RedisClient speaks RESP to the redis over one connection, which is dialed again after it fails.
+// It's the client of the redis stores, eg: RedisStore.
+type RedisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedisClient returns the client of the redis of the url, the url looks like
+// redis://[[username]:password@]host[:port][/db]. The redis is dialed on the first command.
+func NewRedisClient(rawURL string) (*RedisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("state: redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("state: redis url: unsupported scheme %q", u.Scheme)
+	}
+	c := &RedisClient{addr: u.Host}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("state: redis url: invalid db %q", db)
+		}
+	}
+	return c, nil
+}
+
+// Close closes the connection of the redis.
+func (c *RedisClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.rd = nil, nil
+	return err
+}
+
+// Do sends the command and returns its reply, the bulk strings are []byte, the integers are int64, and
+// the nil bulk strings and arrays are nil. The connection is closed if it fails, so the next command
+// dials again.
+func (c *RedisClient) Do(args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.command(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		c.conn.Close()
+		c.conn, c.rd = nil, nil
+	}
+	return reply, err
+}
+
+func (c *RedisClient) dial() error {
+	conn, err := net.DialTimeout("tcp", c.addr, redisTimeout)
+	if err != nil {
+		return fmt.Errorf("state: dial redis: %w", err)
+	}
+	c.conn, c.rd = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	for _, args := range setup {
+		if _, err := c.command(args...); err != nil {
+			conn.Close()
+			c.conn, c.rd = nil, nil
+			return fmt.Errorf("state: %s: %w", strings.ToLower(args[0]), err)
+		}
+	}
+	return nil
+}
+
+// command writes the command as an array of the bulk strings and reads its reply.
+func (c *RedisClient) command(args ...string) (any, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.rd)
+}
+
+// redisError is the error reply of the redis.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// readReply reads a RESP reply, the bulk strings are []byte, the nil bulk strings and arrays are nil.
+func readReply(rd *bufio.Reader) (any, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("state: empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(rd); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("state: unexpected redis reply %q", line)
+}
@@ -0,0 +1,184 @@
+// Package state provides the durable key-value state stores of the sfn.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/yomorun/yomo/serverless"
+)
+
+var _ serverless.State = (*FileStore)(nil)
+
+// DefaultDir returns the default directory to persist the states, it can be changed by the
+// environment variable `YOMO_STATE_DIR`.
+func DefaultDir() string {
+	if dir := os.Getenv("YOMO_STATE_DIR"); dir != "" {
+		return dir
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "yomo", "state")
+}
+
+// Open returns the state store of the sfn. It's the redis store if the environment variable
+// `YOMO_STATE_REDIS` is the url of the redis, eg: redis://:password@localhost:6379/0, otherwise it's
+// the file store in DefaultDir. The store fails every access if the url is invalid.
+func Open(name string) serverless.State {
+	if url := os.Getenv("YOMO_STATE_REDIS"); url != "" {
+		store, err := NewRedisStore(url, name)
+		if err != nil {
+			return &failedStore{err: err}
+		}
+		return store
+	}
+	return NewFileStore(DefaultDir(), name)
+}
+
+// FileStore persists the state of a sfn to a json file named by the sfn name.
+// The file is read on every access and rewritten on every change under a file lock, so the instances
+// of the sfn sharing the directory, in the same process or not, never overwrite the keys of each other.
+type FileStore struct {
+	path string
+	// mu serializes the accesses of the process, the file lock serializes the processes.
+	mu sync.Mutex
+}
+
+// NewFileStore returns a file store in dir for the sfn.
+func NewFileStore(dir, name string) *FileStore {
+	return &FileStore{
+		path: filepath.Join(dir, fileName(name)+".json"),
+	}
+}
+
+// Get returns the value of the key, ok is false if the key does not exist.
+func (s *FileStore) Get(key string) ([]byte, bool, error) {
+	var (
+		value []byte
+		ok    bool
+	)
+	err := s.locked(func() error {
+		data, err := s.read()
+		if err != nil {
+			return err
+		}
+		value, ok = data[key]
+		return nil
+	})
+	return value, ok, err
+}
+
+// Set sets the value of the key.
+func (s *FileStore) Set(key string, value []byte) error {
+	if key == "" {
+		return errors.New("state: key is empty")
+	}
+	return s.update(func(data map[string][]byte) bool {
+		data[key] = value
+		return true
+	})
+}
+
+// Delete deletes the key.
+func (s *FileStore) Delete(key string) error {
+	return s.update(func(data map[string][]byte) bool {
+		if _, ok := data[key]; !ok {
+			return false
+		}
+		delete(data, key)
+		return true
+	})
+}
+
+// update reads the state, applies fn and writes the state if fn changes it.
+func (s *FileStore) update(fn func(data map[string][]byte) bool) error {
+	return s.locked(func() error {
+		data, err := s.read()
+		if err != nil {
+			return err
+		}
+		if !fn(data) {
+			return nil
+		}
+		return s.write(data)
+	})
+}
+
+// locked calls fn holding the lock of the state file.
+func (s *FileStore) locked(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	unlock, err := lockFile(s.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fn()
+}
+
+func (s *FileStore) read() (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	buf, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(buf) > 0 {
+		if err := json.Unmarshal(buf, &data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// write writes the state to a temporary file and renames it, so the state file is never half written.
+func (s *FileStore) write(data map[string][]byte) error {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// fileName makes the sfn name safe to be used as a file name.
+func fileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// failedStore fails every access with the error of opening the store.
+type failedStore struct {
+	err error
+}
+
+func (s *failedStore) Get(string) ([]byte, bool, error) { return nil, false, s.err }
+func (s *failedStore) Set(string, []byte) error         { return s.err }
+func (s *failedStore) Delete(string) error              { return s.err }
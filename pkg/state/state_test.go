@@ -0,0 +1,87 @@
+package state
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store := NewFileStore(dir, "sfn/name")
+
+	_, ok, err := store.Get("counter")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, store.Set("counter", []byte("1")))
+	assert.NoError(t, store.Set("name", []byte("yomo")))
+	assert.Error(t, store.Set("", []byte("empty")))
+
+	t.Run("survives restarts", func(t *testing.T) {
+		restarted := NewFileStore(dir, "sfn/name")
+
+		value, ok, err := restarted.Get("counter")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("1"), value)
+
+		assert.NoError(t, restarted.Delete("counter"))
+		assert.NoError(t, restarted.Delete("not-exist"))
+	})
+
+	t.Run("scoped by sfn name", func(t *testing.T) {
+		other := NewFileStore(dir, "other")
+
+		_, ok, err := other.Get("name")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	restarted := NewFileStore(dir, "sfn/name")
+	_, ok, err = restarted.Get("counter")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestFileStoreShared(t *testing.T) {
+	dir := t.TempDir()
+
+	// the instances of the sfn keep the keys of each other.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		store := NewFileStore(dir, "sfn")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, store.Set(fmt.Sprintf("%d-%d", i, j), []byte("v")))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	store := NewFileStore(dir, "sfn")
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 10; j++ {
+			_, ok, err := store.Get(fmt.Sprintf("%d-%d", i, j))
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	t.Setenv("YOMO_STATE_DIR", t.TempDir())
+	assert.IsType(t, &FileStore{}, Open("sfn"))
+
+	t.Setenv("YOMO_STATE_REDIS", "redis://localhost:6379/1")
+	assert.IsType(t, &RedisStore{}, Open("sfn"))
+
+	t.Setenv("YOMO_STATE_REDIS", "http://localhost")
+	_, _, err := Open("sfn").Get("key")
+	assert.EqualError(t, err, `state: redis url: unsupported scheme "http"`)
+}
@@ -0,0 +1,98 @@
+package tls
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ACMEConfig is the config of obtaining and renewing the certificates automatically from an ACME CA,
+// such as Let's Encrypt. The config looks like:
+//
+//	tls:
+//		acme:
+//			domains: [zipper.example.com]
+//			email: ops@example.com
+//			cache_dir: /var/lib/yomo/acme
+//			http_addr: :80
+type ACMEConfig struct {
+	// Domains are the domains the certificates are obtained for, it is required.
+	Domains []string `yaml:"domains"`
+	// Email is the contact email of the ACME account, it is optional.
+	Email string `yaml:"email"`
+	// CacheDir is the directory the account key and the certificates are stored in, the default is ./acme.
+	CacheDir string `yaml:"cache_dir"`
+	// HTTPAddr is the address of the HTTP-01 challenge server, the default is :80.
+	// The QUIC listener can not serve the TLS-ALPN-01 challenge, which is over TCP.
+	HTTPAddr string `yaml:"http_addr"`
+	// DirectoryURL is the directory of the ACME CA, the default is Let's Encrypt.
+	// eg: https://acme-staging-v02.api.letsencrypt.org/directory
+	DirectoryURL string `yaml:"directory_url"`
+	// RenewBefore is how early the certificates are renewed before they expire, the default is 30 days.
+	RenewBefore time.Duration `yaml:"renew_before"`
+}
+
+// NewACMEManager returns the ACME certificate manager by the config.
+func NewACMEManager(conf ACMEConfig) (*autocert.Manager, error) {
+	if len(conf.Domains) == 0 {
+		return nil, errors.New("tls: the domains of acme are required")
+	}
+	cacheDir := conf.CacheDir
+	if cacheDir == "" {
+		cacheDir = "acme"
+	}
+
+	m := &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       autocert.DirCache(cacheDir),
+		HostPolicy:  autocert.HostWhitelist(conf.Domains...),
+		Email:       conf.Email,
+		RenewBefore: conf.RenewBefore,
+	}
+	if conf.DirectoryURL != "" {
+		m.Client = &acme.Client{DirectoryURL: conf.DirectoryURL}
+	}
+	return m, nil
+}
+
+// ServeACMEChallenge serves the HTTP-01 challenge of the ACME manager at addr, the default addr is :80.
+func ServeACMEChallenge(m *autocert.Manager, addr string) error {
+	if addr == "" {
+		addr = ":80"
+	}
+	return http.ListenAndServe(addr, m.HTTPHandler(nil))
+}
+
+// CreateACMEServerTLSConfig creates the server tls config of the QUIC listener, the certificates are obtained and
+// renewed by the ACME manager. The self-signed certificate is used for the server names out of the domains,
+// such as the connections to the IP address or localhost.
+func CreateACMEServerTLSConfig(m *autocert.Manager, host string) (*tls.Config, error) {
+	pool, err := getCACertPool()
+	if err != nil {
+		return nil, err
+	}
+
+	clientAuth := tls.NoClientCert
+	if verifyPeer() {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	fallback := sync.OnceValues(func() (*tls.Certificate, error) { return generateCertificate(host) })
+
+	return &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if m.HostPolicy == nil || m.HostPolicy(hello.Context(), hello.ServerName) != nil {
+				return fallback()
+			}
+			return m.GetCertificate(hello)
+		},
+		ClientCAs:  pool,
+		ClientAuth: clientAuth,
+		NextProtos: []string{"yomo"},
+	}, nil
+}
@@ -0,0 +1,130 @@
+package tls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/yomorun/yomo/core/ylog"
+)
+
+// certReloader keeps the certificate and the CA cert loaded from the files, and reloads them when the files
+// are changed, so the short-lived certificates are rotated without restarting. The established connections
+// are not affected, the new handshakes use the new certificate.
+type certReloader struct {
+	certFile   string
+	keyFile    string
+	caCertFile string
+
+	cert atomic.Pointer[tls.Certificate]
+	pool atomic.Pointer[x509.CertPool]
+}
+
+var getCertReloader = sync.OnceValues(func() (*certReloader, error) {
+	certFile, keyFile := os.Getenv("YOMO_TLS_CERT_FILE"), os.Getenv("YOMO_TLS_KEY_FILE")
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		return nil, nil
+	}
+	r, err := newCertReloader(certFile, keyFile, os.Getenv("YOMO_TLS_CACERT_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.watch(); err != nil {
+		ylog.Warn("the tls certificate is not rotated", "err", err)
+	}
+	return r, nil
+})
+
+func newCertReloader(certFile, keyFile, caCertFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, caCertFile: caCertFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the files, the current certificate is kept if the files are invalid.
+func (r *certReloader) reload() error {
+	cert, err := loadCertAndKey(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	pool, err := loadCACertPool(r.caCertFile)
+	if err != nil {
+		return err
+	}
+	r.cert.Store(cert)
+	r.pool.Store(pool)
+	return nil
+}
+
+// watch watches the directories of the files, the files may be replaced by renaming,
+// eg: the kubernetes secret volumes.
+func (r *certReloader) watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	dirs := map[string]bool{}
+	for _, file := range []string{r.certFile, r.keyFile, r.caCertFile} {
+		if file != "" {
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+		for {
+			select {
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if err := r.reload(); err != nil {
+					// the cert and the key may be written one by one.
+					ylog.Debug("failed to reload the tls certificate", "err", err)
+					continue
+				}
+				if leaf, err := x509.ParseCertificate(r.certificate().Certificate[0]); err == nil {
+					ylog.Info("the tls certificate is rotated", "subject", leaf.Subject.String(), "not_after", leaf.NotAfter)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				ylog.Error("watch the tls certificate", "err", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (r *certReloader) certificate() *tls.Certificate { return r.cert.Load() }
+
+func (r *certReloader) caCertPool() *x509.CertPool { return r.pool.Load() }
+
+// serverTLSConfig returns the server tls config which uses the current certificate and CA cert in the handshakes.
+func (r *certReloader) serverTLSConfig(base *tls.Config) *tls.Config {
+	conf := base.Clone()
+	conf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.Certificates = []tls.Certificate{*r.certificate()}
+		c.ClientCAs = r.caCertPool()
+		return c, nil
+	}
+	// the certificate is required when the config is validated.
+	conf.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return r.certificate(), nil }
+	conf.ClientCAs = r.caCertPool()
+	return conf
+}
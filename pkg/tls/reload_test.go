@@ -0,0 +1,95 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCertificate(t *testing.T, certFile, keyFile, host string) *x509.Certificate {
+	cert, err := generateCertificate(host)
+	assert.NoError(t, err)
+
+	key, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0o600))
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return leaf
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	first := writeCertificate(t, certFile, keyFile, "zipper-1")
+
+	r, err := newCertReloader(certFile, keyFile, "")
+	assert.NoError(t, err)
+	assert.NoError(t, r.watch())
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", r.serverTLSConfig(&tls.Config{NextProtos: []string{"yomo"}}))
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn.(*tls.Conn).Handshake()
+				conn.Close()
+			}()
+		}
+	}()
+
+	peerCertificate := func() *x509.Certificate {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"yomo"}})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0]
+	}
+
+	assert.Equal(t, first.SerialNumber, peerCertificate().SerialNumber)
+
+	second := writeCertificate(t, certFile, keyFile, "zipper-2")
+
+	assert.Eventually(t, func() bool {
+		return peerCertificate().SerialNumber.Cmp(second.SerialNumber) == 0
+	}, 3*time.Second, 50*time.Millisecond, "the new handshakes use the rotated certificate")
+
+	// the invalid files are ignored.
+	assert.NoError(t, os.WriteFile(certFile, []byte("invalid"), 0o600))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, second.SerialNumber, peerCertificate().SerialNumber)
+}
+
+func TestLoadCACertPool(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+	writeCertificate(t, certFile, keyFile, "zipper-1")
+
+	pool, err := LoadCACertPool(certFile)
+	assert.NoError(t, err)
+	assert.NotNil(t, pool)
+
+	_, err = LoadCACertPool("")
+	assert.Error(t, err)
+
+	_, err = LoadCACertPool(filepath.Join(dir, "missing.crt"))
+	assert.Error(t, err)
+}
@@ -18,37 +18,48 @@ import (
 	"time"
 )
 
-// CreateServerTLSConfig creates server tls config.
+// CreateServerTLSConfig creates server tls config. The certificate and the CA cert of the files are
+// rotated without restarting when the files are changed.
 func CreateServerTLSConfig(host string) (*tls.Config, error) {
-	// ca pool
-	pool, err := getCACertPool()
-	if err != nil {
-		return nil, err
+	return createServerTLSConfig(host, []string{"yomo"})
+}
+
+// CreateHTTPServerTLSConfig creates the tls config of the https server, it uses the same certificate as the zipper.
+func CreateHTTPServerTLSConfig(host string) (*tls.Config, error) {
+	return createServerTLSConfig(host, []string{"h2", "http/1.1"})
+}
+
+func createServerTLSConfig(host string, nextProtos []string) (*tls.Config, error) {
+	clientAuth := tls.NoClientCert
+	if verifyPeer() {
+		clientAuth = tls.RequireAndVerifyClientCert
 	}
 
-	// server certificate
-	tlsCert, err := getCertAndKey()
+	reloader, err := getCertReloader()
 	if err != nil {
 		return nil, err
 	}
+	if reloader != nil {
+		return reloader.serverTLSConfig(&tls.Config{ClientAuth: clientAuth, NextProtos: nextProtos}), nil
+	}
 
-	if tlsCert == nil {
-		tlsCert, err = generateCertificate(host)
-		if err != nil {
-			return nil, err
-		}
+	// ca pool
+	pool, err := getCACertPool()
+	if err != nil {
+		return nil, err
 	}
 
-	clientAuth := tls.NoClientCert
-	if verifyPeer() {
-		clientAuth = tls.RequireAndVerifyClientCert
+	// self-signed server certificate
+	tlsCert, err := generateCertificate(host)
+	if err != nil {
+		return nil, err
 	}
 
 	return &tls.Config{
 		Certificates: []tls.Certificate{*tlsCert},
 		ClientCAs:    pool,
 		ClientAuth:   clientAuth,
-		NextProtos:   []string{"yomo"},
+		NextProtos:   nextProtos,
 	}, nil
 }
 
@@ -70,7 +81,8 @@ func MustCreateClientTLSConfig() *tls.Config {
 	return conf
 }
 
-// CreateClientTLSConfig creates client tls config.
+// CreateClientTLSConfig creates client tls config. The client certificate of the files is rotated without
+// reconnecting when the files are changed, the CA cert is loaded when the config is created.
 func CreateClientTLSConfig() (*tls.Config, error) {
 	// ca pool
 	pool, err := getCACertPool()
@@ -78,24 +90,26 @@ func CreateClientTLSConfig() (*tls.Config, error) {
 		return nil, err
 	}
 
+	conf := &tls.Config{
+		InsecureSkipVerify: !verifyPeer(),
+		RootCAs:            pool,
+		NextProtos:         []string{"yomo"},
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+
 	// client certificate
-	tlsCert, err := getCertAndKey()
+	reloader, err := getCertReloader()
 	if err != nil {
 		return nil, err
 	}
-
-	certificates := []tls.Certificate{}
-	if tlsCert != nil {
-		certificates = append(certificates, *tlsCert)
+	if reloader != nil {
+		conf.RootCAs = reloader.caCertPool()
+		conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.certificate(), nil
+		}
 	}
 
-	return &tls.Config{
-		InsecureSkipVerify: !verifyPeer(),
-		Certificates:       certificates,
-		RootCAs:            pool,
-		NextProtos:         []string{"yomo"},
-		ClientSessionCache: tls.NewLRUClientSessionCache(0),
-	}, nil
+	return conf, nil
 }
 
 func verifyPeer() bool {
@@ -103,15 +117,24 @@ func verifyPeer() bool {
 }
 
 func getCACertPool() (*x509.CertPool, error) {
-	var err error
-	var caCert []byte
+	return loadCACertPool(os.Getenv("YOMO_TLS_CACERT_FILE"))
+}
 
-	caCertPath := os.Getenv("YOMO_TLS_CACERT_FILE")
+// LoadCACertPool loads the CA cert pool of the PEM file, eg: the root CAs of a client connecting to the
+// zipper of another trust domain.
+func LoadCACertPool(caCertPath string) (*x509.CertPool, error) {
+	if caCertPath == "" {
+		return nil, errors.New("tls: the CA cert file is empty")
+	}
+	return loadCACertPool(caCertPath)
+}
+
+func loadCACertPool(caCertPath string) (*x509.CertPool, error) {
 	if len(caCertPath) == 0 {
 		return nil, nil
 	}
 
-	caCert, err = os.ReadFile(caCertPath)
+	caCert, err := os.ReadFile(caCertPath)
 	if err != nil {
 		return nil, err
 	}
@@ -128,23 +151,14 @@ func getCACertPool() (*x509.CertPool, error) {
 	return pool, nil
 }
 
-func getCertAndKey() (*tls.Certificate, error) {
-	var err error
-	var cert, key []byte
-
-	certPath := os.Getenv("YOMO_TLS_CERT_FILE")
-	keyPath := os.Getenv("YOMO_TLS_KEY_FILE")
-	if len(certPath) == 0 || len(keyPath) == 0 {
-		return nil, nil
-	}
-
+func loadCertAndKey(certPath, keyPath string) (*tls.Certificate, error) {
 	// certificate
-	cert, err = os.ReadFile(certPath)
+	cert, err := os.ReadFile(certPath)
 	if err != nil {
 		return nil, err
 	}
 	// private key
-	key, err = os.ReadFile(keyPath)
+	key, err := os.ReadFile(keyPath)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,208 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Config is the configuration of the OTLP trace exporter, the empty fields fall back to
+// the OTEL_* environment variables.
+// The configuration looks like:
+//
+//	tracing:
+//		endpoint: http://localhost:4318
+//		headers:
+//			authorization: Bearer <TOKEN>
+//		insecure: false
+//		sampler: parentbased_traceidratio
+//		sampler_arg: 0.1
+//		sampling:
+//			ratio: 0.1
+//			rate_limit: 100
+//			always_on_errors: true
+//		resource_attributes:
+//			deployment.environment: production
+//		prometheus: true
+type Config struct {
+	// Endpoint is the url or host:port of the OTLP/HTTP collector.
+	Endpoint string `yaml:"endpoint"`
+	// Headers are sent with each export request, eg: the authorization header.
+	Headers map[string]string `yaml:"headers"`
+	// Insecure disables the TLS of the connection to the collector.
+	Insecure bool `yaml:"insecure"`
+	// Sampler is the sampler name defined by the OTEL_TRACES_SAMPLER, eg: always_on, always_off,
+	// traceidratio, parentbased_always_on, parentbased_always_off and parentbased_traceidratio.
+	Sampler string `yaml:"sampler"`
+	// SamplerArg is the sampling ratio of the traceidratio samplers.
+	SamplerArg *float64 `yaml:"sampler_arg"`
+	// Sampling is the head-based sampling strategy, it takes precedence over the Sampler.
+	Sampling *SamplingConfig `yaml:"sampling"`
+	// ResourceAttributes are the attributes of the resource which produces the spans.
+	ResourceAttributes map[string]string `yaml:"resource_attributes"`
+	// Prometheus collects the metrics for the Prometheus endpoint /metrics of the llm bridge besides exporting
+	// them by OTLP, the metrics are collected even if the endpoint is not configured.
+	Prometheus bool `yaml:"prometheus"`
+}
+
+// NewTracerProvider returns the TracerProvider which exports the spans by OTLP/HTTP, it returns the noop
+// TracerProvider if the endpoint is neither configured nor set by OTEL_EXPORTER_OTLP_ENDPOINT.
+func NewTracerProvider(service string, conf Config) (trace.TracerProvider, error) {
+	if conf.Endpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return noop.NewTracerProvider(), nil
+	}
+
+	var opts []otlptracehttp.Option
+	if conf.Endpoint != "" {
+		if strings.Contains(conf.Endpoint, "://") {
+			opts = append(opts, otlptracehttp.WithEndpointURL(conf.Endpoint))
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(conf.Endpoint))
+		}
+	}
+	if len(conf.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(conf.Headers))
+	}
+	if conf.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exp, err := otlptrace.New(context.Background(), otlptracehttp.NewClient(opts...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	sampling := conf.Sampling
+	if sampling == nil {
+		if sampling, err = samplingFromEnv(); err != nil {
+			return nil, err
+		}
+	}
+	var (
+		sampler   tracesdk.Sampler
+		processor = tracesdk.NewBatchSpanProcessor(redactedExporter{exp})
+	)
+	if sampling != nil {
+		sampler = sampling.sampler()
+		if sampling.AlwaysOnErrors {
+			processor = errorSpanProcessor{processor}
+		}
+	} else if sampler, err = conf.sampler(); err != nil {
+		return nil, err
+	}
+
+	res, err := conf.resource(service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	tp := tracesdk.NewTracerProvider(
+		tracesdk.WithSpanProcessor(processor),
+		tracesdk.WithSampler(sampler),
+		tracesdk.WithResource(res),
+	)
+	return tp, nil
+}
+
+// resource returns the resource which produces the telemetry, it describes the service and the resource attributes.
+func (conf Config) resource(service string) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{semconv.ServiceNameKey.String(service)}
+	for k, v := range conf.ResourceAttributes {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	return resource.New(
+		context.Background(),
+		resource.WithFromEnv(),
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(attrs...),
+	)
+}
+
+// sampler returns the sampler by the config or the OTEL_TRACES_SAMPLER, the default sampler is always_on.
+func (conf Config) sampler() (tracesdk.Sampler, error) {
+	name := conf.Sampler
+	if name == "" {
+		name = os.Getenv("OTEL_TRACES_SAMPLER")
+	}
+	ratio := 1.0
+	if conf.SamplerArg != nil {
+		ratio = *conf.SamplerArg
+	} else if arg := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); arg != "" {
+		v, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampler arg: %s", arg)
+		}
+		ratio = v
+	}
+
+	switch name {
+	case "", "always_on":
+		return tracesdk.AlwaysSample(), nil
+	case "always_off":
+		return tracesdk.NeverSample(), nil
+	case "traceidratio":
+		return tracesdk.TraceIDRatioBased(ratio), nil
+	case "parentbased_always_on":
+		return tracesdk.ParentBased(tracesdk.AlwaysSample()), nil
+	case "parentbased_always_off":
+		return tracesdk.ParentBased(tracesdk.NeverSample()), nil
+	case "parentbased_traceidratio":
+		return tracesdk.ParentBased(tracesdk.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("unknown sampler: %s", name)
+	}
+}
+
+// Environ returns the OTEL_* and YOMO_TRACE_SAMPLING_* environment variables of the config, they pass the config to
+// the sfn processes started by the cli.
+func (conf Config) Environ() []string {
+	var env []string
+	if conf.Endpoint != "" {
+		env = append(env, "OTEL_EXPORTER_OTLP_ENDPOINT="+conf.Endpoint)
+	}
+	if len(conf.Headers) > 0 {
+		env = append(env, "OTEL_EXPORTER_OTLP_HEADERS="+joinPairs(conf.Headers))
+	}
+	if conf.Insecure {
+		env = append(env, "OTEL_EXPORTER_OTLP_INSECURE=true")
+	}
+	if conf.Sampler != "" {
+		env = append(env, "OTEL_TRACES_SAMPLER="+conf.Sampler)
+	}
+	if conf.SamplerArg != nil {
+		env = append(env, "OTEL_TRACES_SAMPLER_ARG="+strconv.FormatFloat(*conf.SamplerArg, 'f', -1, 64))
+	}
+	if len(conf.ResourceAttributes) > 0 {
+		env = append(env, "OTEL_RESOURCE_ATTRIBUTES="+joinPairs(conf.ResourceAttributes))
+	}
+	if conf.Sampling != nil {
+		env = append(env, conf.Sampling.Environ()...)
+	}
+	return env
+}
+
+// joinPairs joins the pairs in the format of k1=v1,k2=v2, the keys are sorted.
+func joinPairs(pairs map[string]string) string {
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+pairs[k])
+	}
+	return strings.Join(kvs, ",")
+}
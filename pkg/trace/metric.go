@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// NewMeterProvider returns the MeterProvider which exports the metrics by OTLP/HTTP to the same collector
+// as the spans, the metrics are not exported if the endpoint is neither configured nor set by
+// OTEL_EXPORTER_OTLP_ENDPOINT, or OTEL_METRICS_EXPORTER is none. The metrics are collected for
+// PrometheusHandler too if prometheus is enabled, it returns the noop MeterProvider if neither is enabled.
+// The export interval is set by OTEL_METRIC_EXPORT_INTERVAL, the default is 60s.
+func NewMeterProvider(service string, conf Config) (metric.MeterProvider, error) {
+	var (
+		opts   []metricsdk.Option
+		reader *metricsdk.ManualReader
+	)
+	if conf.Prometheus {
+		reader = metricsdk.NewManualReader()
+		opts = append(opts, metricsdk.WithReader(reader))
+	}
+	if exportOTLP(conf) {
+		exp, err := newMetricExporter(conf)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, metricsdk.WithReader(metricsdk.NewPeriodicReader(exp)))
+	}
+	if len(opts) == 0 {
+		prometheusReader.Store(nil)
+		return noop.NewMeterProvider(), nil
+	}
+
+	res, err := conf.resource(service)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric resource: %w", err)
+	}
+
+	mp := metricsdk.NewMeterProvider(append(opts, metricsdk.WithResource(res))...)
+	prometheusReader.Store(reader)
+	return mp, nil
+}
+
+// exportOTLP returns true if the metrics are exported by OTLP.
+func exportOTLP(conf Config) bool {
+	if conf.Endpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return false
+	}
+	return os.Getenv("OTEL_METRICS_EXPORTER") != "none"
+}
+
+func newMetricExporter(conf Config) (metricsdk.Exporter, error) {
+	var opts []otlpmetrichttp.Option
+	if conf.Endpoint != "" {
+		if strings.Contains(conf.Endpoint, "://") {
+			opts = append(opts, otlpmetrichttp.WithEndpointURL(conf.Endpoint))
+		} else {
+			opts = append(opts, otlpmetrichttp.WithEndpoint(conf.Endpoint))
+		}
+	}
+	if len(conf.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(conf.Headers))
+	}
+	if conf.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+	exp, err := otlpmetrichttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+	}
+	return exp, nil
+}
+
+// ShutdownMeterProvider flushes the metrics and shutdown the global MeterProvider.
+func ShutdownMeterProvider() {
+	if mp, ok := otel.GetMeterProvider().(*metricsdk.MeterProvider); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		mp.Shutdown(ctx)
+	}
+}
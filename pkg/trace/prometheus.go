@@ -0,0 +1,170 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// prometheusReader is the reader of the metrics rendered by PrometheusHandler, it's nil if the Prometheus
+// endpoint is not enabled by the config.
+var prometheusReader atomic.Pointer[metricsdk.ManualReader]
+
+// PrometheusHandler renders the metrics of the global MeterProvider in the Prometheus text exposition
+// format, it responds 404 if prometheus is not enabled by the tracing config.
+func PrometheusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader := prometheusReader.Load()
+		if reader == nil {
+			http.Error(w, "the prometheus metrics are not enabled", http.StatusNotFound)
+			return
+		}
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(r.Context(), &rm); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_ = writePrometheus(w, &rm)
+	})
+}
+
+// writePrometheus renders the metrics in the Prometheus text format, the dots of the names are replaced by
+// the underscores, the units are added as the suffixes and the monotonic sums are suffixed by _total,
+// eg: yomo.llm.completion.duration in seconds is yomo_llm_completion_duration_seconds.
+func writePrometheus(w io.Writer, rm *metricdata.ResourceMetrics) error {
+	bw := bufio.NewWriter(w)
+	seen := make(map[string]bool)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			name := prometheusName(m.Name, m.Unit)
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				writeSum(bw, seen, name, m.Description, data.IsMonotonic, data.DataPoints)
+			case metricdata.Sum[float64]:
+				writeSum(bw, seen, name, m.Description, data.IsMonotonic, data.DataPoints)
+			case metricdata.Gauge[int64]:
+				writeSum(bw, seen, name, m.Description, false, data.DataPoints)
+			case metricdata.Gauge[float64]:
+				writeSum(bw, seen, name, m.Description, false, data.DataPoints)
+			case metricdata.Histogram[int64]:
+				writeHistogram(bw, seen, name, m.Description, data.DataPoints)
+			case metricdata.Histogram[float64]:
+				writeHistogram(bw, seen, name, m.Description, data.DataPoints)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+func writeHeader(w *bufio.Writer, seen map[string]bool, name, description, typ string) {
+	if seen[name] {
+		return
+	}
+	seen[name] = true
+	if description != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(description))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+func writeSum[N int64 | float64](w *bufio.Writer, seen map[string]bool, name, description string, monotonic bool, points []metricdata.DataPoint[N]) {
+	typ := "gauge"
+	if monotonic {
+		name, typ = name+"_total", "counter"
+	}
+	writeHeader(w, seen, name, description, typ)
+	for _, p := range points {
+		fmt.Fprintf(w, "%s%s %s\n", name, prometheusLabels(p.Attributes.ToSlice(), ""), formatValue(float64(p.Value)))
+	}
+}
+
+func writeHistogram[N int64 | float64](w *bufio.Writer, seen map[string]bool, name, description string, points []metricdata.HistogramDataPoint[N]) {
+	writeHeader(w, seen, name, description, "histogram")
+	for _, p := range points {
+		attrs := p.Attributes.ToSlice()
+		cumulative := uint64(0)
+		for i, bound := range p.Bounds {
+			cumulative += p.BucketCounts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, prometheusLabels(attrs, formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, prometheusLabels(attrs, "+Inf"), p.Count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, prometheusLabels(attrs, ""), formatValue(float64(p.Sum)))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, prometheusLabels(attrs, ""), p.Count)
+	}
+}
+
+// prometheusUnits are the suffixes of the units of the instruments, the annotations in braces, eg: {request},
+// have no suffix.
+var prometheusUnits = map[string]string{
+	"s":  "seconds",
+	"ms": "milliseconds",
+	"By": "bytes",
+	"1":  "ratio",
+}
+
+func prometheusName(name, unit string) string {
+	name = sanitizePrometheusName(name)
+	if suffix, ok := prometheusUnits[unit]; ok && !strings.HasSuffix(name, "_"+suffix) {
+		name += "_" + suffix
+	}
+	return name
+}
+
+// sanitizePrometheusName replaces the characters not allowed in the names of Prometheus by the underscores.
+func sanitizePrometheusName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// prometheusLabels renders the attributes as the labels, le is added as the last label if it's not empty.
+func prometheusLabels(attrs []attribute.KeyValue, le string) string {
+	if len(attrs) == 0 && le == "" {
+		return ""
+	}
+	labels := make([]string, 0, len(attrs)+1)
+	for _, kv := range attrs {
+		labels = append(labels, sanitizePrometheusName(string(kv.Key))+`="`+escapeLabelValue(kv.Value.Emit())+`"`)
+	}
+	if le != "" {
+		labels = append(labels, `le="`+le+`"`)
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
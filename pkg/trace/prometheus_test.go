@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Cleanup(func() { prometheusReader.Store(nil) })
+
+	mp, err := NewMeterProvider("yomo-test", Config{})
+	assert.NoError(t, err)
+	_, ok := mp.(*metricsdk.MeterProvider)
+	assert.False(t, ok)
+
+	w := httptest.NewRecorder()
+	PrometheusHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mp, err = NewMeterProvider("yomo-test", Config{Prometheus: true})
+	assert.NoError(t, err)
+	meter := mp.Meter("test")
+
+	counter, _ := meter.Int64Counter("yomo.llm.completions", metric.WithDescription("The number of the completions."), metric.WithUnit("{completion}"))
+	counter.Add(context.Background(), 2, metric.WithAttributes(attribute.String("provider", "openai"), attribute.String("model", `gpt-"4o"`)))
+	histogram, _ := meter.Float64Histogram("yomo.llm.time_to_first_token", metric.WithUnit("s"), metric.WithExplicitBucketBoundaries(0.1, 1))
+	histogram.Record(context.Background(), 0.5, metric.WithAttributes(attribute.String("provider", "openai")))
+	gauge, _ := meter.Int64UpDownCounter("yomo.llm.service_cache.size", metric.WithUnit("By"))
+	gauge.Add(context.Background(), 1024)
+
+	w = httptest.NewRecorder()
+	PrometheusHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body, _ := io.ReadAll(w.Body)
+
+	for _, line := range []string{
+		"# HELP yomo_llm_completions_total The number of the completions.",
+		"# TYPE yomo_llm_completions_total counter",
+		`yomo_llm_completions_total{model="gpt-\"4o\"",provider="openai"} 2`,
+		"# TYPE yomo_llm_time_to_first_token_seconds histogram",
+		`yomo_llm_time_to_first_token_seconds_bucket{provider="openai",le="0.1"} 0`,
+		`yomo_llm_time_to_first_token_seconds_bucket{provider="openai",le="1"} 1`,
+		`yomo_llm_time_to_first_token_seconds_bucket{provider="openai",le="+Inf"} 1`,
+		`yomo_llm_time_to_first_token_seconds_sum{provider="openai"} 0.5`,
+		`yomo_llm_time_to_first_token_seconds_count{provider="openai"} 1`,
+		"# TYPE yomo_llm_service_cache_size_bytes gauge",
+		"yomo_llm_service_cache_size_bytes 1024",
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
+
+func TestSanitizePrometheusName(t *testing.T) {
+	assert.Equal(t, "yomo_llm_tool_call_duration", sanitizePrometheusName("yomo.llm.tool_call.duration"))
+	assert.Equal(t, "_1xx", sanitizePrometheusName("1xx"))
+	assert.Equal(t, "http_server_request_body_size", sanitizePrometheusName("http.server.request-body/size"))
+}
@@ -0,0 +1,47 @@
+package trace
+
+import (
+	"context"
+
+	"github.com/yomorun/yomo/pkg/redact"
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// redactedExporter redacts the secrets from the attributes, the events and the status of the spans before exporting.
+type redactedExporter struct {
+	tracesdk.SpanExporter
+}
+
+func (e redactedExporter) ExportSpans(ctx context.Context, spans []tracesdk.ReadOnlySpan) error {
+	redacted := make([]tracesdk.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		redacted[i] = redactedSpan{ReadOnlySpan: span, redactor: redact.Default()}
+	}
+	return e.SpanExporter.ExportSpans(ctx, redacted)
+}
+
+type redactedSpan struct {
+	tracesdk.ReadOnlySpan
+	redactor *redact.Redactor
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	return s.redactor.KeyValues(s.ReadOnlySpan.Attributes())
+}
+
+func (s redactedSpan) Events() []tracesdk.Event {
+	events := s.ReadOnlySpan.Events()
+	redacted := make([]tracesdk.Event, len(events))
+	for i, event := range events {
+		event.Attributes = s.redactor.KeyValues(event.Attributes)
+		redacted[i] = event
+	}
+	return redacted
+}
+
+func (s redactedSpan) Status() tracesdk.Status {
+	status := s.ReadOnlySpan.Status()
+	status.Description = s.redactor.String(status.Description)
+	return status
+}
@@ -0,0 +1,31 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRedactedExporter(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := tracesdk.NewTracerProvider(tracesdk.WithSyncer(redactedExporter{exp}))
+
+	_, span := tp.Tracer("test").Start(context.Background(), "llm call")
+	span.SetAttributes(attribute.String("api_key", "plain-key"), attribute.String("model", "gpt-4o"))
+	RecordError(span, errors.New("invalid api key sk-abcdefghijklmnopqrstuvwx"))
+	span.End()
+
+	spans := exp.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, []attribute.KeyValue{
+		attribute.String("api_key", "[REDACTED]"),
+		attribute.String("model", "gpt-4o"),
+	}, spans[0].Attributes)
+	assert.Equal(t, "invalid api key [REDACTED]", spans[0].Status.Description)
+	assert.Contains(t, spans[0].Events[0].Attributes, attribute.String("exception.message", "invalid api key [REDACTED]"))
+}
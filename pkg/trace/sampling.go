@@ -0,0 +1,201 @@
+package trace
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SamplingConfig is the head-based sampling strategy, the decision is made by the root span and
+// followed by the descendant spans, including the spans in the other processes.
+//
+//	sampling:
+//		ratio: 0.1
+//		rate_limit: 100
+//		always_on_errors: true
+type SamplingConfig struct {
+	// Ratio is the ratio of the sampled traces, eg: 0.1, all the traces are sampled if it is not set.
+	Ratio *float64 `yaml:"ratio"`
+	// RateLimit is the maximum number of the sampled traces per second, zero means no limit.
+	RateLimit float64 `yaml:"rate_limit"`
+	// AlwaysOnErrors exports the spans which end with the error status even if the trace is not sampled,
+	// the spans of the traces which are not sampled are recorded to detect the errors.
+	AlwaysOnErrors bool `yaml:"always_on_errors"`
+}
+
+// Environ returns the YOMO_TRACE_SAMPLING_* environment variables of the sampling strategy.
+func (conf SamplingConfig) Environ() []string {
+	var env []string
+	if conf.Ratio != nil {
+		env = append(env, "YOMO_TRACE_SAMPLING_RATIO="+strconv.FormatFloat(*conf.Ratio, 'f', -1, 64))
+	}
+	if conf.RateLimit > 0 {
+		env = append(env, "YOMO_TRACE_SAMPLING_RATE_LIMIT="+strconv.FormatFloat(conf.RateLimit, 'f', -1, 64))
+	}
+	if conf.AlwaysOnErrors {
+		env = append(env, "YOMO_TRACE_SAMPLING_ALWAYS_ON_ERRORS=true")
+	}
+	return env
+}
+
+// samplingFromEnv returns the sampling strategy by the YOMO_TRACE_SAMPLING_* environment variables,
+// it returns nil if none of them is set.
+func samplingFromEnv() (*SamplingConfig, error) {
+	var (
+		conf SamplingConfig
+		set  bool
+	)
+	if v := os.Getenv("YOMO_TRACE_SAMPLING_RATIO"); v != "" {
+		ratio, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling ratio: %s", v)
+		}
+		conf.Ratio, set = &ratio, true
+	}
+	if v := os.Getenv("YOMO_TRACE_SAMPLING_RATE_LIMIT"); v != "" {
+		limit, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling rate limit: %s", v)
+		}
+		conf.RateLimit, set = limit, true
+	}
+	if v := os.Getenv("YOMO_TRACE_SAMPLING_ALWAYS_ON_ERRORS"); v != "" {
+		alwaysOnErrors, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling always on errors: %s", v)
+		}
+		conf.AlwaysOnErrors, set = alwaysOnErrors, true
+	}
+	if !set {
+		return nil, nil
+	}
+	return &conf, nil
+}
+
+// sampler returns the sampler of the sampling strategy.
+func (conf SamplingConfig) sampler() tracesdk.Sampler {
+	root := tracesdk.AlwaysSample()
+	if conf.Ratio != nil {
+		root = tracesdk.TraceIDRatioBased(*conf.Ratio)
+	}
+	if conf.RateLimit > 0 {
+		root = newRateLimitSampler(root, conf.RateLimit)
+	}
+	sampler := tracesdk.ParentBased(root)
+	if conf.AlwaysOnErrors {
+		sampler = recordingSampler{sampler}
+	}
+	return sampler
+}
+
+// rateLimitSampler limits the traces sampled by the next sampler, the tokens are refilled
+// at the rate per second and the burst is the rate.
+type rateLimitSampler struct {
+	next tracesdk.Sampler
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newRateLimitSampler(next tracesdk.Sampler, rate float64) *rateLimitSampler {
+	return &rateLimitSampler{
+		next:   next,
+		rate:   rate,
+		tokens: rate,
+		last:   time.Now(),
+		now:    time.Now,
+	}
+}
+
+func (s *rateLimitSampler) ShouldSample(p tracesdk.SamplingParameters) tracesdk.SamplingResult {
+	result := s.next.ShouldSample(p)
+	if result.Decision != tracesdk.RecordAndSample || s.allow() {
+		return result
+	}
+	result.Decision = tracesdk.Drop
+	return result
+}
+
+func (s *rateLimitSampler) allow() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.tokens += now.Sub(s.last).Seconds() * s.rate
+	if s.tokens > s.rate {
+		s.tokens = s.rate
+	}
+	s.last = now
+
+	if s.tokens < 1 {
+		return false
+	}
+	s.tokens--
+	return true
+}
+
+func (s *rateLimitSampler) Description() string {
+	return "RateLimit{" + s.next.Description() + "}"
+}
+
+// recordingSampler records the spans which are dropped by the next sampler, so the errorSpanProcessor
+// can export them if they end with errors.
+type recordingSampler struct {
+	next tracesdk.Sampler
+}
+
+func (s recordingSampler) ShouldSample(p tracesdk.SamplingParameters) tracesdk.SamplingResult {
+	result := s.next.ShouldSample(p)
+	if result.Decision == tracesdk.Drop {
+		result.Decision = tracesdk.RecordOnly
+	}
+	return result
+}
+
+func (s recordingSampler) Description() string {
+	return "Recording{" + s.next.Description() + "}"
+}
+
+// errorSpanProcessor exports the sampled spans and the recorded spans which end with the error status.
+type errorSpanProcessor struct {
+	tracesdk.SpanProcessor
+}
+
+func (p errorSpanProcessor) OnEnd(s tracesdk.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+	if s.Status().Code == codes.Error {
+		p.SpanProcessor.OnEnd(sampledSpan{s})
+	}
+}
+
+// sampledSpan marks the recorded span as sampled, the span processors only export the sampled spans.
+type sampledSpan struct {
+	tracesdk.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
+
+// RecordError records the error to the span and sets the error status of the span,
+// it does nothing if err is nil.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/yomorun/yomo/core/metadata"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRateLimitSampler(t *testing.T) {
+	now := time.Now()
+	s := newRateLimitSampler(tracesdk.AlwaysSample(), 2)
+	s.now = func() time.Time { return now }
+	s.last = now
+
+	sample := func() tracesdk.SamplingDecision {
+		return s.ShouldSample(tracesdk.SamplingParameters{}).Decision
+	}
+
+	assert.Equal(t, tracesdk.RecordAndSample, sample())
+	assert.Equal(t, tracesdk.RecordAndSample, sample())
+	assert.Equal(t, tracesdk.Drop, sample(), "the burst is the rate")
+
+	now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, tracesdk.RecordAndSample, sample())
+	assert.Equal(t, tracesdk.Drop, sample())
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, tracesdk.RecordAndSample, sample())
+	assert.Equal(t, tracesdk.RecordAndSample, sample())
+	assert.Equal(t, tracesdk.Drop, sample(), "the tokens are not accumulated beyond the burst")
+}
+
+func TestSamplingFromEnv(t *testing.T) {
+	t.Setenv("YOMO_TRACE_SAMPLING_RATIO", "")
+	t.Setenv("YOMO_TRACE_SAMPLING_RATE_LIMIT", "")
+	t.Setenv("YOMO_TRACE_SAMPLING_ALWAYS_ON_ERRORS", "")
+
+	conf, err := samplingFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, conf)
+
+	ratio := 0.25
+	want := SamplingConfig{Ratio: &ratio, RateLimit: 10, AlwaysOnErrors: true}
+	for _, kv := range want.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		t.Setenv(k, v)
+	}
+	conf, err = samplingFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, &want, conf)
+
+	t.Setenv("YOMO_TRACE_SAMPLING_RATIO", "ten percent")
+	_, err = samplingFromEnv()
+	assert.Error(t, err)
+}
+
+func TestSampling(t *testing.T) {
+	never := 0.0
+
+	t.Run("ratio", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := tracesdk.NewTracerProvider(
+			tracesdk.WithSampler(SamplingConfig{Ratio: &never}.sampler()),
+			tracesdk.WithSyncer(exporter),
+		)
+		tracer := tp.Tracer("test")
+
+		_, span := tracer.Start(context.Background(), "root")
+		span.End()
+		assert.False(t, span.SpanContext().IsSampled())
+		assert.Empty(t, exporter.GetSpans())
+	})
+
+	t.Run("follow the remote parent", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := tracesdk.NewTracerProvider(
+			tracesdk.WithSampler(SamplingConfig{Ratio: &never}.sampler()),
+			tracesdk.WithSyncer(exporter),
+		)
+		tracer := &Tracer{tracer: tp.Tracer("test")}
+
+		md := metadata.M{
+			metadata.TraceIDKey:    "0102030405060708090a0b0c0d0e0f10",
+			metadata.SpanIDKey:     "0102030405060708",
+			metadata.TraceFlagsKey: "01",
+		}
+		span := tracer.Start(md, "child")
+		tracer.End(md, span)
+		assert.True(t, span.SpanContext().IsSampled())
+		assert.Len(t, exporter.GetSpans(), 1)
+
+		flags, _ := md.Get(metadata.TraceFlagsKey)
+		assert.Equal(t, "01", flags)
+	})
+
+	t.Run("always on errors", func(t *testing.T) {
+		exporter := tracetest.NewInMemoryExporter()
+		tp := tracesdk.NewTracerProvider(
+			tracesdk.WithSampler(SamplingConfig{Ratio: &never, AlwaysOnErrors: true}.sampler()),
+			tracesdk.WithSpanProcessor(errorSpanProcessor{tracesdk.NewSimpleSpanProcessor(exporter)}),
+		)
+		tracer := tp.Tracer("test")
+
+		_, span := tracer.Start(context.Background(), "ok")
+		span.End()
+		assert.Empty(t, exporter.GetSpans())
+
+		_, span = tracer.Start(context.Background(), "failed")
+		RecordError(span, errors.New("write frame error"))
+		span.End()
+		spans := exporter.GetSpans()
+		if assert.Len(t, spans, 1) {
+			assert.Equal(t, "failed", spans[0].Name)
+			assert.True(t, spans[0].SpanContext.IsSampled())
+		}
+	})
+}
+
+func TestNewContextWithMetadata(t *testing.T) {
+	md := metadata.M{
+		metadata.TraceIDKey: "0102030405060708090a0b0c0d0e0f10",
+		metadata.SpanIDKey:  "0102030405060708",
+	}
+	sc := trace.SpanContextFromContext(NewContextWithMetadata(md))
+	assert.True(t, sc.IsSampled(), "the peers which don't carry the flags sample all the traces")
+	assert.True(t, sc.IsRemote())
+
+	md.Set(metadata.TraceFlagsKey, "00")
+	sc = trace.SpanContextFromContext(NewContextWithMetadata(md))
+	assert.False(t, sc.IsSampled())
+}
@@ -2,18 +2,15 @@ package trace
 
 import (
 	"context"
+	"encoding/hex"
 	"os"
 
 	"github.com/yomorun/yomo/core/metadata"
 	"github.com/yomorun/yomo/core/ylog"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 	"go.opentelemetry.io/otel/trace/noop"
 )
@@ -23,32 +20,38 @@ func init() {
 }
 
 // SetTracerProvider sets an OpenTelemetry TracerProvider configured to use
-// the Jaeger exporter that will send spans to the provided url. The global
+// the OTLP exporter that will send spans to the OTEL_EXPORTER_OTLP_ENDPOINT. The global
 // TracerProvider will also use a Resource configured with all the information
 // about the application.
 func SetTracerProvider(service string) {
-	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if endpoint == "" {
-		otel.SetTracerProvider(noop.NewTracerProvider())
-		return
+	if err := SetTracerProviderWithConfig(service, Config{}); err != nil {
+		panic(err.Error())
 	}
-	ylog.Info("enable tracing", "endpoint", endpoint)
+}
 
-	client := otlptracehttp.NewClient()
-	exp, err := otlptrace.New(context.Background(), client)
+// SetTracerProviderWithConfig sets the global TracerProvider and MeterProvider by the config, the empty fields
+// of the config fall back to the OTEL_* environment variables.
+func SetTracerProviderWithConfig(service string, conf Config) error {
+	tp, err := NewTracerProvider(service, conf)
 	if err != nil {
-		panic("failed to create trace exporter: " + err.Error())
-	}
-	tp := tracesdk.NewTracerProvider(
-		tracesdk.WithBatcher(exp),
-		tracesdk.WithSampler(tracesdk.AlwaysSample()),
-		tracesdk.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(service),
-		)),
-	)
+		return err
+	}
+	mp, err := NewMeterProvider(service, conf)
+	if err != nil {
+		return err
+	}
 	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	if _, ok := tp.(*tracesdk.TracerProvider); !ok {
+		return nil
+	}
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	ylog.Info("enable tracing", "endpoint", endpoint)
 	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return nil
 }
 
 // ShutdownTracerProvider shutdown the global TracerProvider.
@@ -100,6 +103,11 @@ func propagateTrace(md metadata.M, span trace.Span) {
 	if span.SpanContext().SpanID().IsValid() {
 		md.Set(metadata.SpanIDKey, span.SpanContext().SpanID().String())
 	}
+
+	// the sampling decision is followed by the spans in the other processes
+	if span.SpanContext().IsValid() {
+		md.Set(metadata.TraceFlagsKey, span.SpanContext().TraceFlags().String())
+	}
 }
 
 // End finish tracing span.
@@ -112,7 +120,7 @@ func (t *Tracer) End(md metadata.M, span trace.Span, kv ...attribute.KeyValue) {
 
 // NewContextWithMetadata create new context with metadata for tracer starting.
 // In yomo, we use metadata from dataFrame as the trace Propagator. And yomo only
-// carries traceID and spanID in metadata.
+// carries traceID, spanID and the trace flags in metadata.
 func NewContextWithMetadata(md metadata.M) context.Context {
 	traceID, ok := md.Get(metadata.TraceIDKey)
 	if !ok {
@@ -133,8 +141,16 @@ func NewContextWithMetadata(md metadata.M) context.Context {
 	}
 
 	scc := trace.SpanContextConfig{
-		TraceID: tid,
-		SpanID:  sid,
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	}
+	// the peers which don't carry the flags sample all the traces
+	if flags, ok := md.Get(metadata.TraceFlagsKey); ok {
+		if b, err := hex.DecodeString(flags); err == nil && len(b) == 1 {
+			scc.TraceFlags = trace.TraceFlags(b[0])
+		}
 	}
 	spanContext := trace.NewSpanContext(scc)
 
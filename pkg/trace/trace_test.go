@@ -7,6 +7,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/yomorun/yomo/core/metadata"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	metricsdk "go.opentelemetry.io/otel/sdk/metric"
+	tracesdk "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func TestTraceProvider(t *testing.T) {
@@ -51,3 +55,63 @@ func assertMd(t *testing.T, md metadata.M) string {
 
 	return traceID
 }
+
+func TestNewTracerProvider(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+
+	tp, err := NewTracerProvider("yomo-test", Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, noop.NewTracerProvider(), tp)
+
+	ratio := 0.5
+	tp, err = NewTracerProvider("yomo-test", Config{
+		Endpoint:           "http://localhost:43118",
+		Headers:            map[string]string{"authorization": "Bearer token"},
+		Sampler:            "parentbased_traceidratio",
+		SamplerArg:         &ratio,
+		ResourceAttributes: map[string]string{"deployment.environment": "test"},
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &tracesdk.TracerProvider{}, tp)
+
+	_, err = NewTracerProvider("yomo-test", Config{Endpoint: "localhost:43118", Sampler: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestConfigEnviron(t *testing.T) {
+	ratio := 0.1
+	conf := Config{
+		Endpoint:           "http://localhost:4318",
+		Headers:            map[string]string{"b": "2", "a": "1"},
+		Insecure:           true,
+		Sampler:            "traceidratio",
+		SamplerArg:         &ratio,
+		ResourceAttributes: map[string]string{"deployment.environment": "test"},
+	}
+	assert.Equal(t, []string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT=http://localhost:4318",
+		"OTEL_EXPORTER_OTLP_HEADERS=a=1,b=2",
+		"OTEL_EXPORTER_OTLP_INSECURE=true",
+		"OTEL_TRACES_SAMPLER=traceidratio",
+		"OTEL_TRACES_SAMPLER_ARG=0.1",
+		"OTEL_RESOURCE_ATTRIBUTES=deployment.environment=test",
+	}, conf.Environ())
+}
+
+func TestNewMeterProvider(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_METRICS_EXPORTER", "")
+
+	mp, err := NewMeterProvider("yomo-test", Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, metricnoop.NewMeterProvider(), mp)
+
+	mp, err = NewMeterProvider("yomo-test", Config{Endpoint: "http://localhost:43118"})
+	assert.NoError(t, err)
+	assert.IsType(t, &metricsdk.MeterProvider{}, mp)
+
+	t.Setenv("OTEL_METRICS_EXPORTER", "none")
+	mp, err = NewMeterProvider("yomo-test", Config{Endpoint: "http://localhost:43118"})
+	assert.NoError(t, err)
+	assert.IsType(t, metricnoop.NewMeterProvider(), mp)
+}
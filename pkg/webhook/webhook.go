@@ -0,0 +1,176 @@
+// Package webhook notifies the events of the zipper to the webhooks, eg: the sfn is connected or
+// disconnected, the ai function is registered and the downstream zipper is unreachable.
+//
+// The events are POSTed as JSON, the body is signed by HMAC-SHA256 with the secret, the signature is
+// in the X-Yomo-Signature header in the format of sha256=<hex>, so the webhooks can verify the sender.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// EventSfnConnected is sent when the sfn is connected.
+	EventSfnConnected = "sfn.connected"
+	// EventSfnDisconnected is sent when the sfn is disconnected.
+	EventSfnDisconnected = "sfn.disconnected"
+	// EventFunctionRegistered is sent when the ai function is registered.
+	EventFunctionRegistered = "function.registered"
+	// EventDownstreamUnreachable is sent when the downstream zipper can not be connected.
+	EventDownstreamUnreachable = "downstream.unreachable"
+)
+
+const (
+	// SignatureHeader is the header of the signature of the body.
+	SignatureHeader = "X-Yomo-Signature"
+	// EventHeader is the header of the event type.
+	EventHeader = "X-Yomo-Event"
+)
+
+// Config is the config of the webhooks, the config looks like:
+//
+//	webhook:
+//		urls:
+//			- https://example.com/yomo/events
+//		secret: <SECRET>
+//		events: [sfn.connected, sfn.disconnected]
+type Config struct {
+	// URLs are the webhooks the events are POSTed to.
+	URLs []string `yaml:"urls"`
+	// Secret signs the body of the events, the events are not signed if it is empty.
+	Secret string `yaml:"secret"`
+	// Events are the types of the events to be sent, all the events are sent if it is empty.
+	Events []string `yaml:"events"`
+}
+
+// Event is an event of the zipper, the fields not related to the event are omitted.
+type Event struct {
+	// Type is the type of the event, eg: sfn.connected.
+	Type string `json:"type"`
+	// Time is the time when the event happens.
+	Time time.Time `json:"time"`
+	// Zipper is the name of the zipper.
+	Zipper string `json:"zipper,omitempty"`
+	// ConnID is the id of the connection.
+	ConnID uint64 `json:"conn_id,omitempty"`
+	// ClientID is the client id of the connection.
+	ClientID string `json:"client_id,omitempty"`
+	// Name is the name of the sfn or the downstream zipper.
+	Name string `json:"name,omitempty"`
+	// RemoteAddr is the address of the sfn or the downstream zipper.
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// Tags are the tags observed by the sfn.
+	Tags []uint32 `json:"tags,omitempty"`
+	// FunctionName is the name of the ai function.
+	FunctionName string `json:"function_name,omitempty"`
+	// Error is the error of the event, eg: the reason why the downstream is unreachable.
+	Error string `json:"error,omitempty"`
+}
+
+// webhookBuffer is the number of the events waiting for a webhook, the events are dropped if it is full.
+const webhookBuffer = 1024
+
+// Notifier sends the events to the webhooks, the events are delivered to every webhook in order.
+// The nil Notifier sends nothing.
+type Notifier struct {
+	secret []byte
+	events []string
+	queues []chan Event
+	client *http.Client
+	logger *slog.Logger
+}
+
+// New returns a new Notifier of the config, it returns nil if there is no webhook.
+func New(conf Config, logger *slog.Logger) *Notifier {
+	if len(conf.URLs) == 0 {
+		return nil
+	}
+	n := &Notifier{
+		secret: []byte(conf.Secret),
+		events: conf.Events,
+		queues: make([]chan Event, len(conf.URLs)),
+		client: &http.Client{Timeout: 5 * time.Second},
+		logger: logger,
+	}
+	for i, url := range conf.URLs {
+		n.queues[i] = make(chan Event, webhookBuffer)
+		go n.deliver(url, n.queues[i])
+	}
+	return n
+}
+
+var defaultNotifier atomic.Pointer[Notifier]
+
+// Default returns the Notifier used by the zipper and the llm bridge, it is nil if it has not been set.
+func Default() *Notifier { return defaultNotifier.Load() }
+
+// SetDefault sets the Notifier used by the zipper and the llm bridge.
+func SetDefault(n *Notifier) { defaultNotifier.Store(n) }
+
+// Notify sends the event to the webhooks, the time of the event is set if it is zero.
+// It never blocks, the event is dropped if the webhook is congested.
+func (n *Notifier) Notify(e Event) {
+	if n == nil || (len(n.events) > 0 && !slices.Contains(n.events, e.Type)) {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, queue := range n.queues {
+		select {
+		case queue <- e:
+		default:
+			n.logger.Warn("webhook is congested, drop the event", "type", e.Type, "name", e.Name)
+		}
+	}
+}
+
+// Sign returns the signature of the body by the secret, it is the value of the X-Yomo-Signature header.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature is the signature of the body by the secret.
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+func (n *Notifier) deliver(url string, queue chan Event) {
+	for e := range queue {
+		body, err := json.Marshal(e)
+		if err != nil {
+			n.logger.Error("marshal webhook event", "err", err)
+			continue
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			n.logger.Error("new webhook request", "webhook", url, "err", err)
+			continue
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventHeader, e.Type)
+		if len(n.secret) > 0 {
+			req.Header.Set(SignatureHeader, Sign(n.secret, body))
+		}
+		resp, err := n.client.Do(req)
+		if err != nil {
+			n.logger.Error("post webhook event", "webhook", url, "type", e.Type, "err", err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			n.logger.Error("post webhook event", "webhook", url, "type", e.Type, "status", resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier(t *testing.T) {
+	type received struct {
+		event     Event
+		eventType string
+		verified  bool
+	}
+	ch := make(chan received, 3)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		var e Event
+		assert.NoError(t, json.Unmarshal(body, &e))
+		ch <- received{
+			event:     e,
+			eventType: r.Header.Get(EventHeader),
+			verified:  Verify([]byte("secret"), body, r.Header.Get(SignatureHeader)),
+		}
+	}))
+	defer server.Close()
+
+	n := New(Config{
+		URLs:   []string{server.URL},
+		Secret: "secret",
+		Events: []string{EventSfnConnected, EventSfnDisconnected},
+	}, slog.Default())
+
+	n.Notify(Event{Type: EventSfnConnected, Name: "sfn-1", Tags: []uint32{0x10}})
+	n.Notify(Event{Type: EventFunctionRegistered, Name: "sfn-1"}) // filtered
+	n.Notify(Event{Type: EventSfnDisconnected, Name: "sfn-1"})
+
+	for _, typ := range []string{EventSfnConnected, EventSfnDisconnected} {
+		select {
+		case r := <-ch:
+			assert.Equal(t, typ, r.event.Type, "the events are delivered in order")
+			assert.Equal(t, typ, r.eventType)
+			assert.Equal(t, "sfn-1", r.event.Name)
+			assert.False(t, r.event.Time.IsZero())
+			assert.True(t, r.verified)
+		case <-time.After(time.Second):
+			t.Fatal("the event is not delivered to the webhook")
+		}
+	}
+	select {
+	case r := <-ch:
+		t.Fatalf("unexpected event: %s", r.event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNilNotifier(t *testing.T) {
+	n := New(Config{}, slog.Default())
+	assert.Nil(t, n)
+	n.Notify(Event{Type: EventSfnConnected})
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"sfn.connected"}`)
+	signature := Sign([]byte("secret"), body)
+	assert.Len(t, signature, len("sha256=")+64)
+	assert.True(t, Verify([]byte("secret"), body, signature))
+	assert.False(t, Verify([]byte("other"), body, signature))
+	assert.False(t, Verify([]byte("secret"), []byte(`{"type":"sfn.disconnected"}`), signature))
+}
@@ -1,32 +1,87 @@
 // Package serverless defines serverless handler context
 package serverless
 
+import (
+	"context"
+	"io"
+)
+
 // Context sfn handler context
 type Context interface {
 	// Data incoming data
 	Data() []byte
+	// DataReader returns a reader of the incoming data, it reads the data incrementally,
+	// so large payloads don't have to be materialized in memory at once
+	DataReader() io.Reader
 	// Tag incoming tag
 	Tag() uint32
 	// Metadata incoming metadata
 	Metadata(string) (string, bool)
+	// SetMetadata sets the metadata carried by the data written afterwards,
+	// the keys prefixed with `yomo-` are reserved and can't be set
+	SetMetadata(key, value string) error
 	// Write writes data
 	Write(tag uint32, data []byte) error
+	// WriteContext writes data like Write, the write blocked on a congested connection
+	// returns the cause of the ctx once the ctx is done, eg: the deadline is exceeded
+	WriteContext(ctx context.Context, tag uint32, data []byte) error
 	// HTTP http interface
 	HTTP() HTTP
 	// WriteWithTarget writes data to sfn instance with specified target
 	WriteWithTarget(tag uint32, data []byte, target string) error
+	// WriteWithMetadata writes data with additional metadata, the keys prefixed with `yomo-` are reserved
+	WriteWithMetadata(tag uint32, data []byte, md map[string]string) error
 	// ReadLLMArguments reads LLM function arguments
 	ReadLLMArguments(args any) error
 	// WriteLLMResult writes LLM function result
 	WriteLLMResult(result string) error
+	// WriteLLMPartialResult writes an incremental progress chunk of the LLM function result,
+	// the final result is written by WriteLLMResult or WriteLLMToolResult
+	WriteLLMPartialResult(chunk string) error
+	// WriteLLMToolResult writes the structured LLM function result, the result is *ai.ToolResult
+	WriteLLMToolResult(result any) error
 	// ReadLLMFunctionCall reads LLM function call
 	ReadLLMFunctionCall(fnCall any) error
+	// InvokeFunction invokes the LLM function registered in the zipper by name, the args is
+	// marshaled to the JSON arguments, it returns the result of the function
+	InvokeFunction(name string, args any) (string, error)
+}
+
+// State is a durable key-value store scoped by the sfn name, it is persisted by the host,
+// so the state survives restarts of the sfn.
+type State interface {
+	// Get returns the value of the key, ok is false if the key does not exist
+	Get(key string) (value []byte, ok bool, err error)
+	// Set sets the value of the key
+	Set(key string, value []byte) error
+	// Delete deletes the key
+	Delete(key string) error
+}
+
+// StateContext is implemented by the contexts which provide the durable state of the sfn, see GetState.
+type StateContext interface {
+	// State returns the durable key-value state of the sfn
+	State() State
+}
+
+// GetState returns the durable state of the sfn of the context, ok is false if the context
+// doesn't provide the state.
+func GetState(ctx Context) (state State, ok bool) {
+	sc, ok := ctx.(StateContext)
+	if !ok {
+		return nil, false
+	}
+	state = sc.State()
+	return state, state != nil
 }
 
 // CronContext sfn corn handler context
 type CronContext interface {
 	// Write writes data
 	Write(tag uint32, data []byte) error
+	// WriteContext writes data like Write, the write blocked on a congested connection
+	// returns the cause of the ctx once the ctx is done, eg: the deadline is exceeded
+	WriteContext(ctx context.Context, tag uint32, data []byte) error
 	// HTTP http interface
 	HTTP() HTTP
 	// WriteWithTarget writes data to sfn instance with specified target
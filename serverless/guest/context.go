@@ -2,6 +2,8 @@
 package guest
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	_ "unsafe"
 
@@ -17,6 +19,8 @@ var (
 	Handler func(ctx serverless.Context) = func(serverless.Context) {}
 	// Init is the init function for guest
 	Init func() error = func() error { return nil }
+	// Close is the close function for guest, it runs when the sfn is shutdown
+	Close func() error = func() error { return nil }
 )
 
 var _ serverless.Context = (*GuestContext)(nil)
@@ -34,11 +38,6 @@ func (c *GuestContext) Data() []byte {
 	return GetBytes(ContextData)
 }
 
-// Metadata returns the value of from metadata in key
-func (c *GuestContext) Metadata(key string) (string, bool) {
-	panic("not implemented")
-}
-
 // Write writes data to the context
 func (c *GuestContext) Write(tag uint32, data []byte) error {
 	if data == nil {
@@ -50,6 +49,15 @@ func (c *GuestContext) Write(tag uint32, data []byte) error {
 	return nil
 }
 
+// WriteContext writes data to the context like Write, the write of the guest is done by the host
+// synchronously, so it fails only if the ctx is done before writing
+func (c *GuestContext) WriteContext(ctx context.Context, tag uint32, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return context.Cause(ctx)
+	}
+	return c.Write(tag, data)
+}
+
 // WriteWithTarget writes data with target to the context
 func (c *GuestContext) WriteWithTarget(tag uint32, data []byte, target string) error {
 	if data == nil {
@@ -65,6 +73,24 @@ func (c *GuestContext) WriteWithTarget(tag uint32, data []byte, target string) e
 	return nil
 }
 
+// WriteWithMetadata writes data with additional metadata to the context
+func (c *GuestContext) WriteWithMetadata(tag uint32, data []byte, md map[string]string) error {
+	if data == nil {
+		return nil
+	}
+	if len(md) == 0 {
+		return c.Write(tag, data)
+	}
+	mdBytes, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	if yomoWriteWithMetadata(tag, &data[0], len(data), &mdBytes[0], len(mdBytes)) != 0 {
+		return errors.New("yomoWriteWithMetadata error")
+	}
+	return nil
+}
+
 //export yomo_observe_datatag
 //go:linkname yomoObserveDataTag
 func yomoObserveDataTag(tag uint32)
@@ -77,6 +103,10 @@ func yomoWrite(tag uint32, pointer *byte, length int) uint32
 //go:linkname yomoWriteWithTarget
 func yomoWriteWithTarget(tag uint32, pointer *byte, length int, targetPointer *byte, targetLength int) uint32
 
+//export yomo_write_with_metadata
+//go:linkname yomoWriteWithMetadata
+func yomoWriteWithMetadata(tag uint32, pointer *byte, length int, mdPointer *byte, mdLength int) uint32
+
 //export yomo_context_tag
 //go:linkname yomoContextTag
 func yomoContextTag() uint32
@@ -127,6 +157,17 @@ func yomoInit() uint32 {
 	return 0
 }
 
+//export yomo_close
+//go:linkname yomoClose
+func yomoClose() uint32 {
+	// close
+	if err := Close(); err != nil {
+		print("yomoClose error: ", err)
+		return 1
+	}
+	return 0
+}
+
 // ContextData returns the data of the context
 func ContextData(ptr uintptr, size uint32) uint32 {
 	return contextData(ptr, size)
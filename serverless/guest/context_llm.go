@@ -8,6 +8,18 @@ func (c *GuestContext) WriteLLMResult(result string) error {
 	panic("not implemented")
 }
 
+func (c *GuestContext) WriteLLMPartialResult(chunk string) error {
+	panic("not implemented")
+}
+
+func (c *GuestContext) WriteLLMToolResult(result any) error {
+	panic("not implemented")
+}
+
 func (c *GuestContext) ReadLLMFunctionCall(fnCall any) error {
 	panic("not implemented")
 }
+
+func (c *GuestContext) InvokeFunction(name string, args any) (string, error) {
+	panic("not implemented")
+}
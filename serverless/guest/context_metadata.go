@@ -0,0 +1,50 @@
+package guest
+
+import (
+	"errors"
+	"fmt"
+
+	_ "unsafe"
+)
+
+// Metadata returns the value of from metadata in key
+func (c *GuestContext) Metadata(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	keyPtr, keySize := bufferToPtrSize([]byte(key))
+	var valuePtr *uint32
+	var valueSize uint32
+	if contextMetadata(keyPtr, keySize, &valuePtr, &valueSize) != 0 {
+		return "", false
+	}
+	if valueSize == 0 {
+		return "", true
+	}
+	return string(readBufferFromMemory(valuePtr, valueSize)), true
+}
+
+// SetMetadata sets the metadata carried by the data written afterwards
+func (c *GuestContext) SetMetadata(key, value string) error {
+	if key == "" {
+		return errors.New("metadata key is empty")
+	}
+	keyPtr, keySize := bufferToPtrSize([]byte(key))
+	var valuePtr uintptr
+	var valueSize uint32
+	if len(value) > 0 {
+		valuePtr, valueSize = bufferToPtrSize([]byte(value))
+	}
+	if errCode := contextSetMetadata(keyPtr, keySize, valuePtr, valueSize); errCode != 0 {
+		return fmt.Errorf("set metadata error: %d", errCode)
+	}
+	return nil
+}
+
+//export yomo_context_metadata
+//go:linkname contextMetadata
+func contextMetadata(keyPtr uintptr, keySize uint32, valuePtr **uint32, valueSize *uint32) uint32
+
+//export yomo_context_set_metadata
+//go:linkname contextSetMetadata
+func contextSetMetadata(keyPtr uintptr, keySize uint32, valuePtr uintptr, valueSize uint32) uint32
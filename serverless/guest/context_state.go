@@ -0,0 +1,82 @@
+package guest
+
+import (
+	"errors"
+	"fmt"
+
+	_ "unsafe"
+
+	"github.com/yomorun/yomo/serverless"
+)
+
+var _ serverless.StateContext = (*GuestContext)(nil)
+
+// State returns the durable state of the sfn, the state is persisted by the host
+func (c *GuestContext) State() serverless.State {
+	return &GuestState{}
+}
+
+// GuestState is the durable state for guest
+type GuestState struct{}
+
+// Get returns the value of the key, ok is false if the key does not exist
+func (s *GuestState) Get(key string) ([]byte, bool, error) {
+	if key == "" {
+		return nil, false, errors.New("state key is empty")
+	}
+	keyPtr, keySize := bufferToPtrSize([]byte(key))
+	var valuePtr *uint32
+	var valueSize uint32
+	switch errCode := stateGet(keyPtr, keySize, &valuePtr, &valueSize); errCode {
+	case 0:
+	case 1:
+		return nil, false, nil
+	default:
+		return nil, false, fmt.Errorf("state get error: %d", errCode)
+	}
+	if valueSize == 0 {
+		return []byte{}, true, nil
+	}
+	return readBufferFromMemory(valuePtr, valueSize), true, nil
+}
+
+// Set sets the value of the key
+func (s *GuestState) Set(key string, value []byte) error {
+	if key == "" {
+		return errors.New("state key is empty")
+	}
+	keyPtr, keySize := bufferToPtrSize([]byte(key))
+	var valuePtr uintptr
+	var valueSize uint32
+	if len(value) > 0 {
+		valuePtr, valueSize = bufferToPtrSize(value)
+	}
+	if errCode := stateSet(keyPtr, keySize, valuePtr, valueSize); errCode != 0 {
+		return fmt.Errorf("state set error: %d", errCode)
+	}
+	return nil
+}
+
+// Delete deletes the key
+func (s *GuestState) Delete(key string) error {
+	if key == "" {
+		return errors.New("state key is empty")
+	}
+	keyPtr, keySize := bufferToPtrSize([]byte(key))
+	if errCode := stateDelete(keyPtr, keySize); errCode != 0 {
+		return fmt.Errorf("state delete error: %d", errCode)
+	}
+	return nil
+}
+
+//export yomo_state_get
+//go:linkname stateGet
+func stateGet(keyPtr uintptr, keySize uint32, valuePtr **uint32, valueSize *uint32) uint32
+
+//export yomo_state_set
+//go:linkname stateSet
+func stateSet(keyPtr uintptr, keySize uint32, valuePtr uintptr, valueSize uint32) uint32
+
+//export yomo_state_delete
+//go:linkname stateDelete
+func stateDelete(keyPtr uintptr, keySize uint32) uint32
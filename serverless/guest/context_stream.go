@@ -0,0 +1,60 @@
+package guest
+
+import (
+	"errors"
+	"io"
+	"unsafe"
+)
+
+// DataReader returns a reader which pulls the incoming data from the host chunk by chunk,
+// so large payloads are not materialized in the guest memory at once.
+func (c *GuestContext) DataReader() io.Reader {
+	return &dataReader{}
+}
+
+// dataReader reads the incoming data by the stream handle opened by the host.
+type dataReader struct {
+	handle uint32
+	err    error
+}
+
+// Read reads up to len(p) bytes of the incoming data into p
+func (r *dataReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.handle == 0 {
+		r.handle = contextDataOpen()
+		if r.handle == 0 {
+			r.err = errors.New("open context data stream error")
+			return 0, r.err
+		}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := contextDataRead(r.handle, uintptr(unsafe.Pointer(&p[0])), uint32(len(p)))
+	if n < 0 {
+		r.err = errors.New("read context data stream error")
+		contextDataClose(r.handle)
+		return 0, r.err
+	}
+	if n == 0 {
+		r.err = io.EOF
+		contextDataClose(r.handle)
+		return 0, r.err
+	}
+	return int(n), nil
+}
+
+//export yomo_context_data_open
+//go:linkname contextDataOpen
+func contextDataOpen() uint32
+
+//export yomo_context_data_read
+//go:linkname contextDataRead
+func contextDataRead(handle uint32, ptr uintptr, size uint32) int32
+
+//export yomo_context_data_close
+//go:linkname contextDataClose
+func contextDataClose(handle uint32) uint32
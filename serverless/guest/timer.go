@@ -0,0 +1,62 @@
+package guest
+
+import (
+	"errors"
+	"time"
+	_ "unsafe"
+)
+
+// Now returns the monotonic time of the host in nanoseconds.
+func Now() int64 {
+	return yomoNow()
+}
+
+// EmitAfter writes data with tag after the given duration. The timer is owned by the host,
+// it will be cancelled if the sfn disconnects. It returns the timer id.
+func EmitAfter(d time.Duration, tag uint32, data []byte) (uint32, error) {
+	if len(data) == 0 {
+		return 0, errors.New("yomoEmitAfter: data is empty")
+	}
+	id := yomoEmitAfter(uint32(d.Milliseconds()), tag, &data[0], len(data))
+	if id == 0 {
+		return 0, errors.New("yomoEmitAfter error")
+	}
+	return id, nil
+}
+
+// EmitEvery writes data with tag periodically with the given interval. The timer is owned by
+// the host, it will be cancelled if the sfn disconnects. It returns the timer id.
+func EmitEvery(d time.Duration, tag uint32, data []byte) (uint32, error) {
+	if len(data) == 0 {
+		return 0, errors.New("yomoEmitEvery: data is empty")
+	}
+	id := yomoEmitEvery(uint32(d.Milliseconds()), tag, &data[0], len(data))
+	if id == 0 {
+		return 0, errors.New("yomoEmitEvery error")
+	}
+	return id, nil
+}
+
+// CancelTimer cancels the timer scheduled by EmitAfter or EmitEvery.
+func CancelTimer(id uint32) error {
+	if yomoCancelTimer(id) != 0 {
+		return errors.New("yomoCancelTimer: timer not found")
+	}
+	return nil
+}
+
+//export yomo_now
+//go:linkname yomoNow
+func yomoNow() int64
+
+//export yomo_emit_after
+//go:linkname yomoEmitAfter
+func yomoEmitAfter(ms uint32, tag uint32, pointer *byte, length int) uint32
+
+//export yomo_emit_every
+//go:linkname yomoEmitEvery
+func yomoEmitEvery(ms uint32, tag uint32, pointer *byte, length int) uint32
+
+//export yomo_cancel_timer
+//go:linkname yomoCancelTimer
+func yomoCancelTimer(id uint32) uint32
@@ -0,0 +1,107 @@
+//! Procedural macros of the YoMo Rust guest SDK, they export the user functions with the
+//! names required by the YoMo wasm host.
+
+use proc_macro::TokenStream;
+use quote::quote;
+use syn::{parse_macro_input, ItemFn};
+
+/// Exports the function as `yomo_init`, the function must have the signature
+/// `fn() -> Result<(), E>` where `E: Display`.
+#[proc_macro_attribute]
+pub fn init(_attr: TokenStream, item: TokenStream) -> TokenStream {
+    let func = parse_macro_input!(item as ItemFn);
+    let name = &func.sig.ident;
+    quote! {
+        #func
+
+        #[no_mangle]
+        pub extern "C" fn yomo_init() -> u32 {
+            match #name() {
+                Ok(()) => 0,
+                Err(e) => {
+                    eprintln!("yomo_init error: {}", e);
+                    1
+                }
+            }
+        }
+    }
+    .into()
+}
+
+/// Exports the function as `yomo_close`, it runs when the sfn is shutdown. The function must
+/// have the signature `fn() -> Result<(), E>` where `E: Display`.
+#[proc_macro_attribute]
+pub fn close(_attr: TokenStream, item: TokenStream) -> TokenStream {
+    let func = parse_macro_input!(item as ItemFn);
+    let name = &func.sig.ident;
+    quote! {
+        #func
+
+        #[no_mangle]
+        pub extern "C" fn yomo_close() -> u32 {
+            match #name() {
+                Ok(()) => 0,
+                Err(e) => {
+                    eprintln!("yomo_close error: {}", e);
+                    1
+                }
+            }
+        }
+    }
+    .into()
+}
+
+/// Exports the function as `yomo_observe_datatags`, the function must have the signature
+/// `fn() -> Vec<u32>`.
+#[proc_macro_attribute]
+pub fn observe_datatags(_attr: TokenStream, item: TokenStream) -> TokenStream {
+    let func = parse_macro_input!(item as ItemFn);
+    let name = &func.sig.ident;
+    quote! {
+        #func
+
+        #[no_mangle]
+        pub extern "C" fn yomo_observe_datatags() {
+            for tag in #name() {
+                ::yomo::observe_datatag(tag);
+            }
+        }
+    }
+    .into()
+}
+
+/// Exports the function as `yomo_wanted_target`, the function must have the signature
+/// `fn() -> String`.
+#[proc_macro_attribute]
+pub fn wanted_target(_attr: TokenStream, item: TokenStream) -> TokenStream {
+    let func = parse_macro_input!(item as ItemFn);
+    let name = &func.sig.ident;
+    quote! {
+        #func
+
+        #[no_mangle]
+        pub extern "C" fn yomo_wanted_target() {
+            ::yomo::set_wanted_target(&#name());
+        }
+    }
+    .into()
+}
+
+/// Exports the function as `yomo_handler`, the function must have the signature
+/// `fn(ctx: yomo::Context) -> Result<(), E>` where `E: Display`.
+#[proc_macro_attribute]
+pub fn handler(_attr: TokenStream, item: TokenStream) -> TokenStream {
+    let func = parse_macro_input!(item as ItemFn);
+    let name = &func.sig.ident;
+    quote! {
+        #func
+
+        #[no_mangle]
+        pub extern "C" fn yomo_handler() {
+            if let Err(e) = #name(::yomo::Context::new()) {
+                eprintln!("yomo_handler error: {}", e);
+            }
+        }
+    }
+    .into()
+}
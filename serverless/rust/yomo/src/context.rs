@@ -0,0 +1,185 @@
+use std::cell::OnceCell;
+use std::collections::HashMap;
+
+use crate::error::Error;
+use crate::http::Http;
+use crate::state::State;
+use crate::stream::DataReader;
+use crate::{ffi, memory};
+
+/// Context of the current invocation, it mirrors `serverless.Context` of the Go guest.
+pub struct Context {
+    tag: u32,
+    data: OnceCell<Vec<u8>>,
+}
+
+impl Context {
+    /// Loads the tag of the current invocation from the host, the data is loaded on demand.
+    #[doc(hidden)]
+    pub fn new() -> Self {
+        let tag = unsafe { ffi::yomo_context_tag() };
+        Context {
+            tag,
+            data: OnceCell::new(),
+        }
+    }
+
+    /// Returns the tag of the incoming data.
+    pub fn tag(&self) -> u32 {
+        self.tag
+    }
+
+    /// Returns the incoming data, it is copied from the host at the first call.
+    pub fn data(&self) -> &[u8] {
+        self.data.get_or_init(|| {
+            let size = unsafe { ffi::yomo_context_data_size() };
+            let mut data = vec![0u8; size as usize];
+            if size > 0 {
+                let n = unsafe { ffi::yomo_context_data(data.as_mut_ptr(), size) };
+                data.truncate(n as usize);
+            }
+            data
+        })
+    }
+
+    /// Returns a reader which pulls the incoming data from the host chunk by chunk, so large
+    /// payloads are not materialized in the guest memory at once.
+    pub fn data_reader(&self) -> DataReader {
+        DataReader::new()
+    }
+
+    /// Returns the metadata value of the incoming data by key.
+    pub fn metadata(&self, key: &str) -> Option<String> {
+        if key.is_empty() {
+            return None;
+        }
+        let mut value_ptr: u32 = 0;
+        let mut value_size: u32 = 0;
+        let code = unsafe {
+            ffi::yomo_context_metadata(
+                key.as_ptr(),
+                key.len() as u32,
+                &mut value_ptr,
+                &mut value_size,
+            )
+        };
+        if code != 0 {
+            return None;
+        }
+        String::from_utf8(memory::take(value_ptr, value_size)).ok()
+    }
+
+    /// Sets the metadata carried by the data written afterwards, the keys prefixed with
+    /// `yomo-` are reserved and can't be set.
+    pub fn set_metadata(&self, key: &str, value: &str) -> Result<(), Error> {
+        if key.is_empty() {
+            return Err(Error::new("metadata key is empty"));
+        }
+        let code = unsafe {
+            ffi::yomo_context_set_metadata(
+                key.as_ptr(),
+                key.len() as u32,
+                value.as_ptr(),
+                value.len() as u32,
+            )
+        };
+        match code {
+            0 => Ok(()),
+            code => Err(Error::code("yomo_context_set_metadata", code)),
+        }
+    }
+
+    /// Writes data with tag.
+    pub fn write(&self, tag: u32, data: &[u8]) -> Result<(), Error> {
+        if data.is_empty() {
+            return Ok(());
+        }
+        match unsafe { ffi::yomo_write(tag, data.as_ptr(), data.len() as u32) } {
+            0 => Ok(()),
+            code => Err(Error::code("yomo_write", code)),
+        }
+    }
+
+    /// Writes data with tag to the sfn instance with the specified target.
+    pub fn write_with_target(&self, tag: u32, data: &[u8], target: &str) -> Result<(), Error> {
+        if data.is_empty() {
+            return Ok(());
+        }
+        if target.is_empty() {
+            return self.write(tag, data);
+        }
+        let code = unsafe {
+            ffi::yomo_write_with_target(
+                tag,
+                data.as_ptr(),
+                data.len() as u32,
+                target.as_ptr(),
+                target.len() as u32,
+            )
+        };
+        match code {
+            0 => Ok(()),
+            code => Err(Error::code("yomo_write_with_target", code)),
+        }
+    }
+
+    /// Writes data with tag and additional metadata, the metadata only takes effect on this
+    /// write, the keys prefixed with `yomo-` are reserved.
+    pub fn write_with_metadata(
+        &self,
+        tag: u32,
+        data: &[u8],
+        md: &HashMap<String, String>,
+    ) -> Result<(), Error> {
+        if data.is_empty() {
+            return Ok(());
+        }
+        if md.is_empty() {
+            return self.write(tag, data);
+        }
+        let md = serde_json::to_vec(md)?;
+        let code = unsafe {
+            ffi::yomo_write_with_metadata(
+                tag,
+                data.as_ptr(),
+                data.len() as u32,
+                md.as_ptr(),
+                md.len() as u32,
+            )
+        };
+        match code {
+            0 => Ok(()),
+            code => Err(Error::code("yomo_write_with_metadata", code)),
+        }
+    }
+
+    /// Returns the http client, the requests are sent by the host.
+    pub fn http(&self) -> Http {
+        Http
+    }
+
+    /// Returns the durable key-value state of the sfn, it is persisted by the host.
+    pub fn state(&self) -> State {
+        State
+    }
+
+    /// Returns the tag of the incoming data.
+    #[deprecated(note = "use `tag` instead")]
+    pub fn get_tag(&self) -> u32 {
+        self.tag()
+    }
+
+    /// Returns the incoming data.
+    #[deprecated(note = "use `data` instead")]
+    pub fn load_input(&self) -> &[u8] {
+        self.data()
+    }
+
+    /// Writes the output with tag.
+    #[deprecated(note = "use `write` instead")]
+    pub fn dump_output(&self, tag: u32, output: Vec<u8>) {
+        if let Err(e) = self.write(tag, &output) {
+            eprintln!("dump_output error: {}", e);
+        }
+    }
+}
@@ -0,0 +1,66 @@
+//! The host functions imported from the YoMo wasm runtime.
+
+#[link(wasm_import_module = "env")]
+extern "C" {
+    pub fn yomo_observe_datatag(tag: u32);
+    pub fn yomo_get_wanted_target(ptr: *const u8, size: u32);
+    pub fn yomo_write(tag: u32, ptr: *const u8, size: u32) -> u32;
+    pub fn yomo_write_with_target(
+        tag: u32,
+        ptr: *const u8,
+        size: u32,
+        target_ptr: *const u8,
+        target_size: u32,
+    ) -> u32;
+    pub fn yomo_write_with_metadata(
+        tag: u32,
+        ptr: *const u8,
+        size: u32,
+        md_ptr: *const u8,
+        md_size: u32,
+    ) -> u32;
+    pub fn yomo_context_tag() -> u32;
+    pub fn yomo_context_data(ptr: *mut u8, size: u32) -> u32;
+    pub fn yomo_context_data_size() -> u32;
+    pub fn yomo_context_data_open() -> u32;
+    pub fn yomo_context_data_read(handle: u32, ptr: *mut u8, size: u32) -> i32;
+    pub fn yomo_context_data_close(handle: u32) -> u32;
+    pub fn yomo_context_metadata(
+        key_ptr: *const u8,
+        key_size: u32,
+        value_ptr: *mut u32,
+        value_size: *mut u32,
+    ) -> u32;
+    pub fn yomo_context_set_metadata(
+        key_ptr: *const u8,
+        key_size: u32,
+        value_ptr: *const u8,
+        value_size: u32,
+    ) -> u32;
+    // timer
+    pub fn yomo_now() -> i64;
+    pub fn yomo_emit_after(ms: u32, tag: u32, ptr: *const u8, size: u32) -> u32;
+    pub fn yomo_emit_every(ms: u32, tag: u32, ptr: *const u8, size: u32) -> u32;
+    pub fn yomo_cancel_timer(id: u32) -> u32;
+    // http
+    pub fn yomo_http_send(
+        req_ptr: *const u8,
+        req_size: u32,
+        resp_ptr: *mut u32,
+        resp_size: *mut u32,
+    ) -> u32;
+    // state
+    pub fn yomo_state_get(
+        key_ptr: *const u8,
+        key_size: u32,
+        value_ptr: *mut u32,
+        value_size: *mut u32,
+    ) -> u32;
+    pub fn yomo_state_set(
+        key_ptr: *const u8,
+        key_size: u32,
+        value_ptr: *const u8,
+        value_size: u32,
+    ) -> u32;
+    pub fn yomo_state_delete(key_ptr: *const u8, key_size: u32) -> u32;
+}
@@ -0,0 +1,110 @@
+//! HTTP client of the guest, the requests are sent by the host.
+
+use std::collections::HashMap;
+
+use base64::engine::general_purpose::STANDARD;
+use base64::Engine;
+use serde::{Deserialize, Deserializer, Serialize, Serializer};
+
+use crate::error::Error;
+use crate::{ffi, memory};
+
+/// HTTP request, it is encoded the same as `serverless.HTTPRequest`.
+#[derive(Debug, Default, Clone, Serialize)]
+pub struct Request {
+    /// GET, POST, PUT, DELETE, ...
+    #[serde(rename = "Method")]
+    pub method: String,
+    /// https://example.org
+    #[serde(rename = "URL")]
+    pub url: String,
+    /// {"Content-Type": "application/json"}
+    #[serde(rename = "Header")]
+    pub header: HashMap<String, String>,
+    /// timeout in milliseconds
+    #[serde(rename = "Timeout")]
+    pub timeout: i64,
+    /// request body
+    #[serde(rename = "Body", serialize_with = "encode_body")]
+    pub body: Vec<u8>,
+}
+
+/// HTTP response, it is decoded the same as `serverless.HTTPResponse`.
+#[derive(Debug, Default, Clone, Deserialize)]
+pub struct Response {
+    /// "200 OK"
+    #[serde(rename = "Status")]
+    pub status: String,
+    /// 200, 404, ...
+    #[serde(rename = "StatusCode")]
+    pub status_code: i32,
+    /// {"Content-Type": "application/json"}
+    #[serde(rename = "Header", default)]
+    pub header: HashMap<String, String>,
+    /// response body
+    #[serde(rename = "Body", default, deserialize_with = "decode_body")]
+    pub body: Vec<u8>,
+}
+
+// the body is encoded as base64 string, the same as []byte in Go.
+fn encode_body<S: Serializer>(body: &[u8], s: S) -> Result<S::Ok, S::Error> {
+    s.serialize_str(&STANDARD.encode(body))
+}
+
+fn decode_body<'de, D: Deserializer<'de>>(d: D) -> Result<Vec<u8>, D::Error> {
+    let s: Option<String> = Option::deserialize(d)?;
+    match s {
+        Some(s) => STANDARD.decode(s).map_err(serde::de::Error::custom),
+        None => Ok(Vec::new()),
+    }
+}
+
+/// HTTP client of the guest.
+pub struct Http;
+
+impl Http {
+    /// Sends the http request and returns the http response.
+    pub fn send(&self, req: &Request) -> Result<Response, Error> {
+        let req = serde_json::to_vec(req)?;
+        let mut resp_ptr: u32 = 0;
+        let mut resp_size: u32 = 0;
+        let code = unsafe {
+            ffi::yomo_http_send(
+                req.as_ptr(),
+                req.len() as u32,
+                &mut resp_ptr,
+                &mut resp_size,
+            )
+        };
+        if code != 0 {
+            return Err(Error::code("http request", code));
+        }
+        let resp = memory::take(resp_ptr, resp_size);
+        if resp.is_empty() {
+            return Err(Error::new("http response is empty"));
+        }
+        Ok(serde_json::from_slice(&resp)?)
+    }
+
+    /// Sends the http GET request.
+    pub fn get(&self, url: &str) -> Result<Response, Error> {
+        self.send(&Request {
+            method: "GET".to_string(),
+            url: url.to_string(),
+            ..Default::default()
+        })
+    }
+
+    /// Sends the http POST request.
+    pub fn post(&self, url: &str, content_type: &str, body: Vec<u8>) -> Result<Response, Error> {
+        let mut header = HashMap::new();
+        header.insert("Content-Type".to_string(), content_type.to_string());
+        self.send(&Request {
+            method: "POST".to_string(),
+            url: url.to_string(),
+            header,
+            body,
+            ..Default::default()
+        })
+    }
+}
@@ -0,0 +1,47 @@
+//! YoMo guest SDK for implementing WebAssembly stream functions in Rust.
+//!
+//! It mirrors the Go guest package `github.com/yomorun/yomo/serverless/guest`:
+//!
+//! ```ignore
+//! #[yomo::observe_datatags]
+//! fn observe_datatags() -> Vec<u32> {
+//!     vec![0x33]
+//! }
+//!
+//! #[yomo::handler]
+//! fn handler(ctx: yomo::Context) -> Result<(), yomo::Error> {
+//!     let output = String::from_utf8_lossy(ctx.data()).to_uppercase();
+//!     ctx.write(0x34, output.as_bytes())
+//! }
+//! ```
+//!
+//! Build the stream function with `cargo build --release --target wasm32-wasip1`,
+//! and run it with `yomo run sfn.wasm`.
+
+mod context;
+mod error;
+mod ffi;
+pub mod http;
+mod memory;
+pub mod state;
+pub mod stream;
+pub mod timer;
+
+pub use context::Context;
+pub use error::Error;
+pub use yomo_macros::{close, handler, init, observe_datatags, wanted_target};
+
+/// Observes the data tag, it is called by the `observe_datatags` macro.
+#[doc(hidden)]
+pub fn observe_datatag(tag: u32) {
+    unsafe { ffi::yomo_observe_datatag(tag) }
+}
+
+/// Sets the wanted target, it is called by the `wanted_target` macro.
+#[doc(hidden)]
+pub fn set_wanted_target(target: &str) {
+    if target.is_empty() {
+        return;
+    }
+    unsafe { ffi::yomo_get_wanted_target(target.as_ptr(), target.len() as u32) }
+}
@@ -0,0 +1,18 @@
+//! Memory shared with the host, the host allocates the guest memory by `yomo_alloc` to
+//! return variable-length results, and the guest takes the ownership back by `take`.
+
+/// Allocates a buffer of size bytes for the host.
+#[no_mangle]
+pub extern "C" fn yomo_alloc(size: u32) -> *mut u8 {
+    let buf = vec![0u8; size as usize].into_boxed_slice();
+    Box::into_raw(buf) as *mut u8
+}
+
+/// Takes the ownership of the buffer allocated by `yomo_alloc`.
+pub(crate) fn take(ptr: u32, size: u32) -> Vec<u8> {
+    if ptr == 0 || size == 0 {
+        return Vec::new();
+    }
+    let slice = std::ptr::slice_from_raw_parts_mut(ptr as usize as *mut u8, size as usize);
+    unsafe { Box::from_raw(slice) }.into_vec()
+}
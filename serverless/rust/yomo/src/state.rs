@@ -0,0 +1,61 @@
+//! Durable key-value state of the sfn, it is scoped by the sfn name and persisted by the host.
+
+use crate::error::Error;
+use crate::{ffi, memory};
+
+/// Durable key-value state of the sfn.
+pub struct State;
+
+impl State {
+    /// Returns the value of the key, `None` if the key does not exist.
+    pub fn get(&self, key: &str) -> Result<Option<Vec<u8>>, Error> {
+        if key.is_empty() {
+            return Err(Error::new("state key is empty"));
+        }
+        let mut value_ptr: u32 = 0;
+        let mut value_size: u32 = 0;
+        let code = unsafe {
+            ffi::yomo_state_get(
+                key.as_ptr(),
+                key.len() as u32,
+                &mut value_ptr,
+                &mut value_size,
+            )
+        };
+        match code {
+            0 => Ok(Some(memory::take(value_ptr, value_size))),
+            1 => Ok(None),
+            code => Err(Error::code("state get", code)),
+        }
+    }
+
+    /// Sets the value of the key.
+    pub fn set(&self, key: &str, value: &[u8]) -> Result<(), Error> {
+        if key.is_empty() {
+            return Err(Error::new("state key is empty"));
+        }
+        let code = unsafe {
+            ffi::yomo_state_set(
+                key.as_ptr(),
+                key.len() as u32,
+                value.as_ptr(),
+                value.len() as u32,
+            )
+        };
+        match code {
+            0 => Ok(()),
+            code => Err(Error::code("state set", code)),
+        }
+    }
+
+    /// Deletes the key.
+    pub fn delete(&self, key: &str) -> Result<(), Error> {
+        if key.is_empty() {
+            return Err(Error::new("state key is empty"));
+        }
+        match unsafe { ffi::yomo_state_delete(key.as_ptr(), key.len() as u32) } {
+            0 => Ok(()),
+            code => Err(Error::code("state delete", code)),
+        }
+    }
+}
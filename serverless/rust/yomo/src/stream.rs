@@ -0,0 +1,60 @@
+//! Incremental reads of the incoming data.
+
+use std::io;
+
+use crate::ffi;
+
+/// Reader of the incoming data, it pulls the data from the host chunk by chunk.
+pub struct DataReader {
+    handle: u32,
+    done: bool,
+}
+
+impl DataReader {
+    pub(crate) fn new() -> Self {
+        DataReader {
+            handle: 0,
+            done: false,
+        }
+    }
+}
+
+impl io::Read for DataReader {
+    fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+        if self.done {
+            return Ok(0);
+        }
+        if self.handle == 0 {
+            self.handle = unsafe { ffi::yomo_context_data_open() };
+            if self.handle == 0 {
+                return Err(io::Error::new(
+                    io::ErrorKind::Other,
+                    "yomo_context_data_open error",
+                ));
+            }
+        }
+        if buf.is_empty() {
+            return Ok(0);
+        }
+        let n =
+            unsafe { ffi::yomo_context_data_read(self.handle, buf.as_mut_ptr(), buf.len() as u32) };
+        if n < 0 {
+            return Err(io::Error::new(
+                io::ErrorKind::Other,
+                "yomo_context_data_read error",
+            ));
+        }
+        if n == 0 {
+            self.done = true;
+        }
+        Ok(n as usize)
+    }
+}
+
+impl Drop for DataReader {
+    fn drop(&mut self) {
+        if self.handle != 0 {
+            unsafe { ffi::yomo_context_data_close(self.handle) };
+        }
+    }
+}
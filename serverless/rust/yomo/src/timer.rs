@@ -0,0 +1,47 @@
+//! Timers owned by the host, they are cancelled when the sfn disconnects.
+
+use std::time::Duration;
+
+use crate::error::Error;
+use crate::ffi;
+
+/// Returns the monotonic time of the host in nanoseconds.
+pub fn now() -> i64 {
+    unsafe { ffi::yomo_now() }
+}
+
+/// Writes data with tag after the given duration, it returns the timer id.
+pub fn emit_after(d: Duration, tag: u32, data: &[u8]) -> Result<u32, Error> {
+    if data.is_empty() {
+        return Err(Error::new("emit_after: data is empty"));
+    }
+    let id = unsafe {
+        ffi::yomo_emit_after(d.as_millis() as u32, tag, data.as_ptr(), data.len() as u32)
+    };
+    if id == 0 {
+        return Err(Error::new("emit_after error"));
+    }
+    Ok(id)
+}
+
+/// Writes data with tag periodically with the given interval, it returns the timer id.
+pub fn emit_every(d: Duration, tag: u32, data: &[u8]) -> Result<u32, Error> {
+    if data.is_empty() {
+        return Err(Error::new("emit_every: data is empty"));
+    }
+    let id = unsafe {
+        ffi::yomo_emit_every(d.as_millis() as u32, tag, data.as_ptr(), data.len() as u32)
+    };
+    if id == 0 {
+        return Err(Error::new("emit_every error"));
+    }
+    Ok(id)
+}
+
+/// Cancels the timer scheduled by `emit_after` or `emit_every`.
+pub fn cancel(id: u32) -> Result<(), Error> {
+    if unsafe { ffi::yomo_cancel_timer(id) } != 0 {
+        return Err(Error::new("cancel timer: timer not found"));
+    }
+    Ok(())
+}
@@ -3,15 +3,20 @@ package yomo
 import (
 	"context"
 	"errors"
+	"slices"
+	"sync"
 
 	"github.com/robfig/cron/v3"
 
+	"github.com/yomorun/yomo/ai"
 	"github.com/yomorun/yomo/core"
 	"github.com/yomorun/yomo/core/frame"
 	"github.com/yomorun/yomo/core/metadata"
 	"github.com/yomorun/yomo/core/serverless"
 	"github.com/yomorun/yomo/pkg/id"
+	"github.com/yomorun/yomo/pkg/state"
 	"github.com/yomorun/yomo/pkg/trace"
+	yserverless "github.com/yomorun/yomo/serverless"
 	"go.opentelemetry.io/otel/attribute"
 )
 
@@ -22,8 +27,18 @@ type StreamFunction interface {
 	SetWantedTarget(string)
 	// SetObserveDataTags set the data tag list that will be observed
 	SetObserveDataTags(tag ...uint32)
+	// SetObserveTopics sets the topic filters that will be observed, eg: `sensors/+/temperature`, `sensors/#`.
+	// The sfn only receives the data of the observed tags carrying a topic matched by one of the filters.
+	// This function is optional and it should be called before Connect().
+	SetObserveTopics(filters ...string)
 	// Init will initialize the stream function
 	Init(fn func() error) error
+	// SetInitHandler sets the init handler, it is invoked once when the sfn connects to the zipper,
+	// the sfn will not connect if the handler returns an error. It is used to open resources like DB pools.
+	SetInitHandler(fn func() error)
+	// SetCloseHandler sets the close handler, it is invoked once when the sfn is closed or shutdown
+	// gracefully. It is used to release resources and flush buffers.
+	SetCloseHandler(fn func() error)
 	// SetHandler set the handler function, which accept the raw bytes data and return the tag & response
 	SetHandler(fn core.AsyncHandler) error
 	// SetErrorHandler set the error handler function when server error occurs
@@ -61,11 +76,18 @@ func NewStreamFunction(name, zipperAddr string, opts ...SfnOption) StreamFunctio
 		"zipper_addr", zipperAddr,
 	)
 
+	// the state is persisted to disk, or to the redis of `YOMO_STATE_REDIS`, by default
+	stateStore := client.StateStore()
+	if stateStore == nil {
+		stateStore = state.Open(name)
+	}
+
 	sfn := &streamFunction{
 		name:            name,
 		zipperAddr:      zipperAddr,
 		client:          client,
 		observeDataTags: make([]uint32, 0),
+		state:           stateStore,
 	}
 
 	return sfn
@@ -86,6 +108,11 @@ type streamFunction struct {
 	cronFn          core.CronHandler
 	cron            *cron.Cron
 	pOut            chan *frame.DataFrame
+	state           yserverless.State
+	initFn          func() error
+	closeFn         func() error
+	closeOnce       sync.Once
+	invokes         sync.Map // reqID -> chan *ai.FunctionCall
 }
 
 func (s *streamFunction) SetWantedTarget(target string) {
@@ -102,6 +129,12 @@ func (s *streamFunction) SetObserveDataTags(tag ...uint32) {
 	s.client.Logger.Debug("set sfn observe data tasg", "tags", s.observeDataTags)
 }
 
+// SetObserveTopics sets the topic filters that will be observed.
+func (s *streamFunction) SetObserveTopics(filters ...string) {
+	s.client.SetObserveTopics(filters...)
+	s.client.Logger.Debug("set sfn observe topics", "topics", filters)
+}
+
 // SetHandler set the handler function, which accept the raw bytes data and return the tag & response.
 func (s *streamFunction) SetHandler(fn core.AsyncHandler) error {
 	s.fn = fn
@@ -125,6 +158,12 @@ func (s *streamFunction) SetPipeHandler(fn core.PipeHandler) error {
 // Connect create a connection to the zipper, when data arrvied, the data will be passed to the
 // handler set by SetHandler method.
 func (s *streamFunction) Connect() error {
+	if s.initFn != nil {
+		if err := s.initFn(); err != nil {
+			return err
+		}
+	}
+
 	hasCron := s.cronFn != nil && s.cronSpec != ""
 	if hasCron {
 		s.cron = cron.New()
@@ -145,6 +184,11 @@ func (s *streamFunction) Connect() error {
 		return errors.New("streamFunction cannot observe data because the required tag has not been set")
 	}
 
+	// the llm sfn receives the results of the functions it invokes
+	if s.fn != nil && s.client.IsAIFunction() {
+		s.client.SetObserveDataTags(append(slices.Clone(s.observeDataTags), ai.FunctionInvokeResultTag)...)
+	}
+
 	s.client.Logger.Debug("sfn connecting to zipper ...")
 	// notify underlying network operations, when data with tag we observed arrived, invoke the func
 	s.client.SetDataFrameObserver(func(data *frame.DataFrame) {
@@ -215,6 +259,8 @@ func (s *streamFunction) Close() error {
 
 	_ = s.client.Close()
 
+	s.runCloseHandler()
+
 	trace.ShutdownTracerProvider()
 
 	s.client.Logger.Debug("the sfn is closed")
@@ -222,14 +268,30 @@ func (s *streamFunction) Close() error {
 	return nil
 }
 
-// Wait waits sfn to finish.
+// Wait waits sfn to finish, the close handler is invoked after the sfn finished.
 func (s *streamFunction) Wait() {
 	s.client.Wait()
+	s.runCloseHandler()
+}
+
+func (s *streamFunction) runCloseHandler() {
+	s.closeOnce.Do(func() {
+		if s.closeFn == nil {
+			return
+		}
+		if err := s.closeFn(); err != nil {
+			s.client.Logger.Error("sfn close handler error", "err", err)
+		}
+	})
 }
 
 // when DataFrame we observed arrived, invoke the user's function
 // func (s *streamFunction) onDataFrame(data []byte, metaFrame *frame.MetaFrame) {
 func (s *streamFunction) onDataFrame(dataFrame *frame.DataFrame) {
+	if dataFrame.Tag == ai.FunctionInvokeResultTag && s.client.IsAIFunction() {
+		s.onInvokeResult(dataFrame)
+		return
+	}
 	if s.fn != nil {
 		go func(dataFrame *frame.DataFrame) {
 			md, err := metadata.Decode(dataFrame.Metadata)
@@ -250,6 +312,10 @@ func (s *streamFunction) onDataFrame(dataFrame *frame.DataFrame) {
 			)
 
 			serverlessCtx := serverless.NewContext(s.client, dataFrame.Tag, md, dataFrame.Payload)
+			serverlessCtx.SetState(s.state)
+			if s.client.IsAIFunction() {
+				serverlessCtx.SetInvoker(s)
+			}
 			s.fn(serverlessCtx)
 		}(dataFrame)
 	} else if s.pfn != nil {
@@ -261,6 +327,36 @@ func (s *streamFunction) onDataFrame(dataFrame *frame.DataFrame) {
 	}
 }
 
+// onInvokeResult delivers the result of the invoked function to the handler awaiting it.
+func (s *streamFunction) onInvokeResult(dataFrame *frame.DataFrame) {
+	result := &ai.FunctionCall{}
+	if err := result.FromBytes(dataFrame.Payload); err != nil {
+		s.client.Logger.Error("sfn decode invoke result error", "err", err)
+		return
+	}
+	ch, ok := s.invokes.Load(result.ReqID)
+	if !ok {
+		// the result belongs to other sfn, or it is timeout
+		return
+	}
+	select {
+	case ch.(chan *ai.FunctionCall) <- result:
+	default:
+	}
+}
+
+// Name returns the name of the sfn.
+func (s *streamFunction) Name() string {
+	return s.name
+}
+
+// Await returns the channel to receive the result of the function invoked by the request.
+func (s *streamFunction) Await(reqID string) (<-chan *ai.FunctionCall, func()) {
+	ch := make(chan *ai.FunctionCall, 1)
+	s.invokes.Store(reqID, ch)
+	return ch, func() { s.invokes.Delete(reqID) }
+}
+
 // SetErrorHandler set the error handler function when server error occurs
 func (s *streamFunction) SetErrorHandler(fn func(err error)) {
 	s.client.SetErrorHandler(fn)
@@ -270,3 +366,15 @@ func (s *streamFunction) SetErrorHandler(fn func(err error)) {
 func (s *streamFunction) Init(fn func() error) error {
 	return fn()
 }
+
+// SetInitHandler sets the init handler, it is invoked once when the sfn connects to the zipper.
+func (s *streamFunction) SetInitHandler(fn func() error) {
+	s.initFn = fn
+	s.client.Logger.Debug("set init handler")
+}
+
+// SetCloseHandler sets the close handler, it is invoked once when the sfn is closed.
+func (s *streamFunction) SetCloseHandler(fn func() error) {
+	s.closeFn = fn
+	s.client.Logger.Debug("set close handler")
+}
@@ -1,6 +1,7 @@
 package yomo
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -124,6 +125,43 @@ func TestSfnInit(t *testing.T) {
 	assert.Equal(t, int64(1), total)
 }
 
+func TestSfnInitAndCloseHandler(t *testing.T) {
+	t.Parallel()
+
+	sfn := NewStreamFunction("sfn-lifecycle", "localhost:9000", WithSfnCredential("token:<CREDENTIAL>"))
+	sfn.SetObserveDataTags(0x23)
+	sfn.SetHandler(func(ctx serverless.Context) {})
+
+	var inited, closed int
+	sfn.SetInitHandler(func() error {
+		inited++
+		return nil
+	})
+	sfn.SetCloseHandler(func() error {
+		closed++
+		return nil
+	})
+
+	err := sfn.Connect()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, inited)
+
+	sfn.Close()
+	sfn.Wait()
+	assert.Equal(t, 1, closed)
+
+	t.Run("init error", func(t *testing.T) {
+		sfn := NewStreamFunction("sfn-lifecycle-error", "localhost:9000", WithSfnCredential("token:<CREDENTIAL>"))
+		sfn.SetObserveDataTags(0x23)
+		sfn.SetInitHandler(func() error {
+			return errors.New("init error")
+		})
+
+		err := sfn.Connect()
+		assert.EqualError(t, err, "init error")
+	})
+}
+
 func TestSfnCron(t *testing.T) {
 	t.Parallel()
 
@@ -2,9 +2,12 @@ package yomo
 
 import (
 	"context"
+	"strings"
 
 	"github.com/yomorun/yomo/core"
 	"github.com/yomorun/yomo/core/frame"
+	"github.com/yomorun/yomo/core/metadata"
+	"github.com/yomorun/yomo/core/router"
 	"github.com/yomorun/yomo/pkg/id"
 	"github.com/yomorun/yomo/pkg/trace"
 	"go.opentelemetry.io/otel/attribute"
@@ -18,12 +21,33 @@ type Source interface {
 	Connect() error
 	// Write the data to directed downstream.
 	Write(tag uint32, data []byte) error
+	// WriteContext writes the data like Write, the write blocked on a congested connection returns
+	// the cause of the ctx once the ctx is done, so the callers can time out or cancel the write.
+	WriteContext(ctx context.Context, tag uint32, data []byte) error
 	// WriteWithTarget writes data to sfn instance with specified target.
 	WriteWithTarget(tag uint32, data []byte, target string) error
+	// WriteWithTopic writes data carrying the topic, eg: `sensors/eu/temperature`, the data is routed to
+	// the sfns observing the tag, the sfns observing the topics receive it only if the topic matches.
+	WriteWithTopic(tag uint32, data []byte, topic string) error
+	// WriteBatch writes the batch in one pipelined write, the data are sent back to back without waiting
+	// for each other, eg: the parallel tool calls of a llm response.
+	WriteBatch(batch []TaggedData) error
 	// SetErrorHandler set the error handler function when server error occurs
 	SetErrorHandler(fn func(err error))
 }
 
+// TaggedData is the data with its tag, it is written by Source.WriteBatch.
+type TaggedData struct {
+	Tag  uint32
+	Data []byte
+	// AllInstances routes the data to all the instances observing the tag, even if the source
+	// routes the data to the nearest instance.
+	AllInstances bool
+	// CallerScopes are the scopes of the caller of the data, the data is only routed to the scoped
+	// instances whose scopes overlap them if it's not nil.
+	CallerScopes []string
+}
+
 // YoMo-Source
 type yomoSource struct {
 	name       string
@@ -71,19 +95,27 @@ func (s *yomoSource) Connect() error {
 
 // Write writes data with specified tag.
 func (s *yomoSource) Write(tag uint32, data []byte) error {
+	return s.WriteContext(context.Background(), tag, data)
+}
+
+// WriteContext writes data with specified tag, the write is canceled once the ctx is done.
+func (s *yomoSource) WriteContext(ctx context.Context, tag uint32, data []byte) (err error) {
 	if err := frame.IsReservedTag(tag); err != nil {
 		return err
 	}
-	md := core.NewMetadata(s.client.ClientID(), id.New())
+	md := s.newMetadata()
 	// add trace
 	tracer := trace.NewTracer("Source")
 	span := tracer.Start(md, s.name)
-	defer tracer.End(
-		md,
-		span,
-		attribute.Int("send_data_tag", int(tag)),
-		attribute.Int("send_data_len", len(data)),
-	)
+	defer func() {
+		trace.RecordError(span, err)
+		tracer.End(
+			md,
+			span,
+			attribute.Int("send_data_tag", int(tag)),
+			attribute.Int("send_data_len", len(data)),
+		)
+	}()
 
 	mdBytes, err := md.Encode()
 	// metadata
@@ -96,25 +128,72 @@ func (s *yomoSource) Write(tag uint32, data []byte) error {
 		Payload:  data,
 	}
 	s.client.Logger.Debug("source write", "tag", tag, "dataLen", len(data))
-	return s.client.WriteFrame(f)
+	return s.client.WriteFrameContext(ctx, f)
+}
+
+// WriteBatch writes the batch in one pipelined write, every data has its own tid and span.
+func (s *yomoSource) WriteBatch(batch []TaggedData) (err error) {
+	for _, d := range batch {
+		if err := frame.IsReservedTag(d.Tag); err != nil {
+			return err
+		}
+	}
+	tracer := trace.NewTracer("Source")
+	frames := make([]frame.Frame, 0, len(batch))
+	for _, d := range batch {
+		md := s.newMetadata()
+		if d.AllInstances {
+			delete(md, metadata.NearestKey)
+		}
+		if d.CallerScopes != nil {
+			md.Set(metadata.CallerScopesKey, strings.Join(d.CallerScopes, ","))
+		}
+		// add trace
+		span := tracer.Start(md, s.name)
+		defer func(d TaggedData) {
+			trace.RecordError(span, err)
+			tracer.End(
+				md,
+				span,
+				attribute.Int("send_data_tag", int(d.Tag)),
+				attribute.Int("send_data_len", len(d.Data)),
+				attribute.Int("send_batch_len", len(batch)),
+			)
+		}(d)
+
+		mdBytes, err := md.Encode()
+		if err != nil {
+			return err
+		}
+		frames = append(frames, &frame.DataFrame{
+			Tag:      d.Tag,
+			Metadata: mdBytes,
+			Payload:  d.Data,
+		})
+	}
+	s.client.Logger.Debug("source write batch", "batchLen", len(batch))
+	return s.client.WriteFrames(frames...)
 }
 
 // WritePayload writes `yomo.Payload` with specified tag.
-func (s *yomoSource) WriteWithTarget(tag uint32, data []byte, target string) error {
+func (s *yomoSource) WriteWithTarget(tag uint32, data []byte, target string) (err error) {
 	if err := frame.IsReservedTag(tag); err != nil {
 		return err
 	}
-	md := core.NewMetadata(s.client.ClientID(), id.New())
+	md := s.newMetadata()
 	// add trace
 	tracer := trace.NewTracer("Source")
 	span := tracer.Start(md, s.name)
-	defer tracer.End(
-		md,
-		span,
-		attribute.Int("send_data_tag", int(tag)),
-		attribute.String("send_data_target", target),
-		attribute.Int("send_data_len", len(data)),
-	)
+	defer func() {
+		trace.RecordError(span, err)
+		tracer.End(
+			md,
+			span,
+			attribute.Int("send_data_tag", int(tag)),
+			attribute.String("send_data_target", target),
+			attribute.Int("send_data_len", len(data)),
+		)
+	}()
 
 	if target != "" {
 		core.SetMetadataTarget(md, target)
@@ -133,6 +212,59 @@ func (s *yomoSource) WriteWithTarget(tag uint32, data []byte, target string) err
 	return s.client.WriteFrame(f)
 }
 
+// WriteWithTopic writes data carrying the topic with specified tag.
+func (s *yomoSource) WriteWithTopic(tag uint32, data []byte, topic string) (err error) {
+	if err := frame.IsReservedTag(tag); err != nil {
+		return err
+	}
+	if err := router.ValidateTopic(topic); err != nil {
+		return err
+	}
+	md := s.newMetadata()
+	// add trace
+	tracer := trace.NewTracer("Source")
+	span := tracer.Start(md, s.name)
+	defer func() {
+		trace.RecordError(span, err)
+		tracer.End(
+			md,
+			span,
+			attribute.Int("send_data_tag", int(tag)),
+			attribute.String("send_data_topic", topic),
+			attribute.Int("send_data_len", len(data)),
+		)
+	}()
+
+	md.Set(metadata.TopicKey, topic)
+
+	mdBytes, err := md.Encode()
+	if err != nil {
+		return err
+	}
+	f := &frame.DataFrame{
+		Tag:      tag,
+		Metadata: mdBytes,
+		Payload:  data,
+	}
+	s.client.Logger.Debug("source write with topic", "tag", tag, "dataLen", len(data), "topic", topic)
+	return s.client.WriteFrame(f)
+}
+
+// newMetadata returns the metadata of the data written by the source.
+func (s *yomoSource) newMetadata() metadata.M {
+	md := core.NewMetadata(s.client.ClientID(), id.New())
+	core.SetMetadataFrameID(md, id.New())
+	if s.client.NearestRouting() {
+		core.SetMetadataNearest(md)
+	}
+	return md
+}
+
+// Connected returns true if the source is connected to zipper.
+func (s *yomoSource) Connected() bool {
+	return s.client.Connected()
+}
+
 // SetErrorHandler set the error handler function when server error occurs
 func (s *yomoSource) SetErrorHandler(fn func(err error)) {
 	s.client.SetErrorHandler(fn)
@@ -2,12 +2,16 @@ package yomo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
+	"time"
 
 	"github.com/yomorun/yomo/core"
 	"github.com/yomorun/yomo/core/frame"
 	"github.com/yomorun/yomo/pkg/config"
+	"github.com/yomorun/yomo/pkg/webhook"
 )
 
 // Zipper is the orchestrator of yomo. There are two types of zipper:
@@ -66,30 +70,83 @@ func NewZipper(name string, meshConfig map[string]config.Mesh, options ...Zipper
 		if meshName == "" || meshName == name {
 			continue
 		}
-		addr := fmt.Sprintf("%s:%d", meshConf.Host, meshConf.Port)
+		server.AddDownstreamServer(newDownstream(server, meshName, meshConf, opts))
+	}
 
-		clientOptions := []core.ClientOption{
-			core.WithCredential(meshConf.Credential),
-			core.WithNonBlockWrite(),
-			core.WithReConnect(),
-			core.WithLogger(server.Logger().With("downstream_name", meshName, "downstream_addr", addr)),
-		}
-		clientOptions = append(clientOptions, opts.clientOption...)
+	// watch signal.
+	go waitSignalForShutdownServer(server)
+
+	return server, nil
+}
+
+// DrainZipper asks all the clients connected to the running zipper to reconnect, the connections are closed
+// if the clients don't reconnect in the grace period, eg: before the zipper is restarted.
+func DrainZipper(zipper Zipper, reason string, grace time.Duration) error {
+	server, ok := zipper.(*core.Server)
+	if !ok {
+		return errors.New("yomo: the zipper can not be drained")
+	}
+	server.Drain(reason, grace)
+	return nil
+}
 
-		downstream := &downstream{
-			localName: meshName,
-			client:    core.NewClient(name, addr, core.ClientTypeUpstreamZipper, clientOptions...),
+// UpdateZipperMesh applies the changes of the mesh config to the running zipper, the downstreams which are
+// removed or changed are closed, and the downstreams which are added or changed are connected.
+func UpdateZipperMesh(zipper Zipper, oldMesh, newMesh map[string]config.Mesh, options ...ZipperOption) error {
+	server, ok := zipper.(*core.Server)
+	if !ok {
+		return errors.New("yomo: the mesh of the zipper can not be updated")
+	}
+
+	opts := &zipperOptions{}
+	for _, o := range options {
+		o(opts)
+	}
+
+	downstreams := server.Downstreams()
+	for meshName, meshConf := range oldMesh {
+		if newConf, ok := newMesh[meshName]; ok && newConf == meshConf {
+			continue
+		}
+		if id, ok := downstreams[meshName]; ok {
+			server.Logger().Info("remove downstream", "downstream_id", id, "downstream_name", meshName)
+			server.RemoveDownstreamServer(id)
+		}
+	}
+	for meshName, meshConf := range newMesh {
+		if meshName == "" || meshName == server.Name() {
+			continue
 		}
+		if oldConf, ok := oldMesh[meshName]; ok && oldConf == meshConf {
+			continue
+		}
+		server.AddDownstreamServer(newDownstream(server, meshName, meshConf, opts))
+	}
 
-		server.Logger().Info("add downstream", "downstream_id", downstream.ID(), "downstream_name", downstream.LocalName(), "downstream_addr", addr)
+	return nil
+}
+
+func newDownstream(server *core.Server, meshName string, meshConf config.Mesh, opts *zipperOptions) *downstream {
+	addr := fmt.Sprintf("%s:%d", meshConf.Host, meshConf.Port)
 
-		server.AddDownstreamServer(downstream)
+	clientOptions := []core.ClientOption{
+		core.WithCredential(meshConf.Credential),
+		core.WithNonBlockWrite(),
+		core.WithReConnect(),
+		core.WithLogger(server.Logger().With("downstream_name", meshName, "downstream_addr", addr)),
 	}
+	clientOptions = append(clientOptions, opts.clientOption...)
 
-	// watch signal.
-	go waitSignalForShutdownServer(server)
+	downstream := &downstream{
+		localName: meshName,
+		addr:      addr,
+		client:    core.NewClient(server.Name(), addr, core.ClientTypeUpstreamZipper, clientOptions...),
+	}
+	downstream.client.SetErrorHandler(downstream.handleError)
 
-	return server, nil
+	server.Logger().Info("add downstream", "downstream_id", downstream.ID(), "downstream_name", downstream.LocalName(), "downstream_addr", addr)
+
+	return downstream
 }
 
 func statsToLogger(server *core.Server) {
@@ -106,10 +163,46 @@ func statsToLogger(server *core.Server) {
 
 type downstream struct {
 	localName string
+	addr      string
 	client    *core.Client
+	// notifiedAt is the unix nano of the last unreachable event, the events are throttled by it.
+	notifiedAt atomic.Int64
+	// closed is true if the downstream is closed, it's not unreachable then.
+	closed atomic.Bool
+}
+
+// downstreamNotifyInterval is the min interval of the unreachable events of a downstream,
+// the downstream is reconnected every second, so the events are throttled.
+const downstreamNotifyInterval = time.Minute
+
+// handleError logs the error of the downstream, and notifies the webhooks that the downstream is unreachable.
+func (d *downstream) handleError(err error) {
+	d.client.Logger.Error("downstream error", "err", err)
+	if d.closed.Load() {
+		return
+	}
+
+	now := time.Now()
+	last := d.notifiedAt.Load()
+	if now.Sub(time.Unix(0, last)) < downstreamNotifyInterval || !d.notifiedAt.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	webhook.Default().Notify(webhook.Event{
+		Type:       webhook.EventDownstreamUnreachable,
+		Time:       now,
+		Zipper:     d.client.Name(),
+		ClientID:   d.ID(),
+		Name:       d.localName,
+		RemoteAddr: d.addr,
+		Error:      err.Error(),
+	})
+}
+
+func (d *downstream) Close() error {
+	d.closed.Store(true)
+	return d.client.Close()
 }
 
-func (d *downstream) Close() error                      { return d.client.Close() }
 func (d *downstream) Connect(ctx context.Context) error { return d.client.Connect(ctx) }
 func (d *downstream) ID() string                        { return d.client.ClientID() }
 func (d *downstream) LocalName() string                 { return d.localName }
@@ -29,6 +29,7 @@ func waitSignalForShutdownServer(server *core.Server) {
 			// waiting for the server to finish processing the current request
 			server.Close()
 			trace.ShutdownTracerProvider()
+			trace.ShutdownMeterProvider()
 			os.Exit(0)
 		} else if p1 == syscall.SIGUSR2 {
 			var m runtime.MemStats
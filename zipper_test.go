@@ -32,3 +32,35 @@ func TestZipperRun(t *testing.T) {
 	time.Sleep(time.Second)
 	assert.Nil(t, err)
 }
+
+func TestUpdateZipperMesh(t *testing.T) {
+	zipper, err := NewZipper("zipper", map[string]config.Mesh{
+		"zipper-us": {Host: "127.0.0.1", Port: 19001},
+		"zipper-eu": {Host: "127.0.0.1", Port: 19002},
+	})
+	assert.NoError(t, err)
+	defer zipper.Close()
+
+	go zipper.ListenAndServe(context.TODO(), "localhost:19000")
+	time.Sleep(time.Second)
+
+	server := zipper.(*core.Server)
+	usID := server.Downstreams()["zipper-us"]
+
+	err = UpdateZipperMesh(zipper,
+		map[string]config.Mesh{
+			"zipper-us": {Host: "127.0.0.1", Port: 19001},
+			"zipper-eu": {Host: "127.0.0.1", Port: 19002},
+		},
+		map[string]config.Mesh{
+			"zipper-us": {Host: "127.0.0.1", Port: 19001},
+			"zipper-ap": {Host: "127.0.0.1", Port: 19003},
+		},
+	)
+	assert.NoError(t, err)
+
+	downstreams := server.Downstreams()
+	assert.Len(t, downstreams, 2)
+	assert.Equal(t, usID, downstreams["zipper-us"], "the unchanged downstream is kept")
+	assert.Contains(t, downstreams, "zipper-ap")
+}
@@ -24,6 +24,7 @@ func waitSignalForShutdownServer(server *core.Server) {
 		if p1 == syscall.SIGTERM || p1 == syscall.SIGINT {
 			server.Close()
 			trace.ShutdownTracerProvider()
+			trace.ShutdownMeterProvider()
 			ylog.Debug("graceful shutting down ...", "sign", p1)
 			os.Exit(0)
 		}